@@ -3,26 +3,128 @@ package app
 import (
 	"context"
 	"errors"
+	"io"
+	"net"
 	"net/http"
-	"time"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	"github.com/go-playground/validator/v10"
 	v1 "github.com/jaennil/guide_helper/backend/cache/internal/infrastructure/http/v1"
 	"github.com/jaennil/guide_helper/backend/cache/internal/infrastructure/http/v1/handler"
+	"github.com/jaennil/guide_helper/backend/cache/internal/infrastructure/rpc"
 	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
 	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
 	"github.com/jaennil/guide_helper/backend/cache/pkg/config"
 	"github.com/jaennil/guide_helper/backend/cache/pkg/http_server"
 	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
 	"github.com/jaennil/guide_helper/backend/cache/pkg/telemetry"
+	"google.golang.org/grpc"
 )
 
+// selectBackend names the cache backend to open: CACHE_BACKEND when set,
+// otherwise the first configured of redis, remote, s3, mbtiles and memory,
+// falling back to sqlite.
+func selectBackend(cfg *config.Config) string {
+	switch {
+	case cfg.Backend != "":
+		return cfg.Backend
+	case cfg.Redis.Enabled:
+		return "redis"
+	case cfg.Remote.BaseURL != "":
+		return "remote"
+	case cfg.S3.Bucket != "":
+		return "s3"
+	case cfg.MBTiles.Path != "":
+		return "mbtiles"
+	case cfg.Memory.Enabled && !cfg.Memory.Tier:
+		return "map"
+	}
+	return "sqlite"
+}
+
+// logStartup logs the effective configuration with secrets redacted and
+// names the cache backend that will serve tiles.
+func logStartup(l logger.Logger, cfg *config.Config) {
+	l.Info("app config", "cfg", cfg.Redact())
+
+	switch backend := selectBackend(cfg); backend {
+	case "redis":
+		l.Info("cache backend selected",
+			"backend", backend,
+			"addr", cfg.Redis.Addr,
+			"db", cfg.Redis.DB,
+			"password_set", cfg.Redis.Password != "",
+			"ttl", cfg.Redis.TTL,
+			"zoom_ttls", cfg.Redis.ZoomTTLs,
+			"key_prefix", cfg.Redis.KeyPrefix,
+			"invalidation_channel", cfg.Redis.InvalidationChannel)
+	case "remote":
+		l.Info("cache backend selected",
+			"backend", backend,
+			"base_url", cfg.Remote.BaseURL,
+			"timeout", cfg.Remote.Timeout)
+	case "s3":
+		l.Info("cache backend selected",
+			"backend", backend,
+			"endpoint", cfg.S3.Endpoint,
+			"region", cfg.S3.Region,
+			"bucket", cfg.S3.Bucket,
+			"prefix", cfg.S3.Prefix,
+			"extension", cfg.S3.Extension,
+			"path_style", cfg.S3.PathStyle,
+			"secret_key_set", cfg.S3.SecretKey != "")
+	case "map":
+		l.Info("cache backend selected",
+			"backend", backend,
+			"max_entries", cfg.Memory.MaxEntries,
+			"max_bytes", cfg.Memory.MaxBytes)
+	case "mbtiles":
+		l.Info("cache backend selected",
+			"backend", backend,
+			"path", cfg.MBTiles.Path)
+	case "filesystem":
+		l.Info("cache backend selected",
+			"backend", backend,
+			"root", cfg.Filesystem.Root)
+	case "badger":
+		l.Info("cache backend selected",
+			"backend", backend,
+			"path", cfg.Badger.Path,
+			"sync_writes", cfg.Badger.SyncWrites,
+			"gc_interval", cfg.Badger.GCInterval)
+	case "sqlite":
+		l.Info("cache backend selected",
+			"backend", backend,
+			"path", cfg.SQLite.Path,
+			"access_flush_interval", cfg.SQLite.AccessFlushInterval,
+			"dedup", cfg.SQLite.Dedup,
+			"migration_timeout", cfg.SQLite.MigrationTimeout,
+			"ttl", "none",
+			"max_size_bytes", cfg.MaxSizeBytes)
+	default:
+		l.Info("cache backend selected", "backend", backend)
+	}
+}
+
+// backendsInUse returns the backend opened at startup and, when a migration
+// replaced it, the one serving now.
+func backendsInUse(opened cache.TileCache, current *cache.SwappableCache) []cache.TileCache {
+	if now := current.Current(); now != opened {
+		return []cache.TileCache{opened, now}
+	}
+	return []cache.TileCache{opened}
+}
+
 func Run(cfg *config.Config) {
 	l := logger.NewZapLogger(cfg.Logger)
 
-	l.Info("app config", "cfg", cfg)
+	logStartup(l, cfg)
 
-	ctx := context.TODO()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	ctx = logger.WithLogger(ctx, l)
 
@@ -48,63 +150,205 @@ func Run(cfg *config.Config) {
 	}
 
 	// Initialize the cache repository
-	var tileCache cache.TileCache
-	if cfg.Redis.Enabled {
-		l.Info("initializing Redis cache", "addr", cfg.Redis.Addr)
-		redisCache, err := cache.NewRedisCache(cache.RedisConfig{
-			Addr:     cfg.Redis.Addr,
-			Password: cfg.Redis.Password,
-			DB:       cfg.Redis.DB,
-			TTL:      cfg.Redis.TTL,
-		}, l)
-		if err != nil {
-			l.Fatal("failed to initialize Redis cache", "error", err)
-		}
-		tileCache = redisCache
-		l.Info("Redis cache initialized successfully")
-	} else {
-		l.Info("initializing SQLite in-memory cache")
-		sqliteCache, err := cache.NewSQLiteCache("file:cache.db?cache=shared&mode=memory", l)
-		if err != nil {
-			l.Fatal("failed to initialize SQLite cache", "error", err)
-		}
-		tileCache = sqliteCache
-		l.Info("SQLite cache initialized successfully")
+	backend := selectBackend(cfg)
+	l.Info("initializing cache backend", "backend", backend)
+	backends, err := backendConfig(cfg)
+	if err != nil {
+		l.Fatal("invalid cache backend config", "error", err)
+	}
+	backendCache, err := cache.OpenBackend(backend, backends, l)
+	if err != nil {
+		l.Fatal("failed to initialize cache backend", "backend", backend, "error", err)
+	}
+	l.Info("cache backend initialized successfully", "backend", backend)
+
+	// Everything serving or maintaining tiles goes through current, so a
+	// finished migration swaps the backend for all of them at once.
+	// Lifecycle hooks such as Close keep using the backends themselves.
+	current := cache.NewSwappableCache(backendCache)
+
+	servedCache := cache.TileCache(current)
+	var tiered *cache.TieredCache
+	if cfg.Memory.Enabled && cfg.Memory.Tier {
+		tiered = cache.NewTieredCache(cache.NewLRUMapCache(backends.Map, l), current, l)
+		servedCache = tiered
+		l.Info("memory tier enabled", "max_entries", cfg.Memory.MaxEntries, "max_bytes", cfg.Memory.MaxBytes)
+	}
+
+	tileCache, err := wrapStorage(servedCache, cfg.Storage)
+	if err != nil {
+		l.Fatal("failed to initialize storage", "error", err)
 	}
+	l.Info("storage format", "value_format", cfg.Storage.ValueFormat,
+		"compression", cfg.Storage.Compression, "compression_level", cfg.Storage.CompressionLevel)
 
 	// Initialize the use case
 	tileCacheUseCase := usecase.NewTileCacheUseCase(tileCache, l)
+	tileCacheUseCase.BackendName(backend)
+	if cfg.Storage.CoalesceStores {
+		tileCacheUseCase.CoalesceStores(cfg.Storage.CoalesceWindow)
+	}
+	tileCacheUseCase.NotFoundTTL(cfg.Storage.NotFoundTTL)
+	tileCacheUseCase.OperationTimeout(cfg.Storage.OperationTimeout)
+	tileCacheUseCase.MaxInFlightOperations(cfg.Storage.MaxInFlight)
+	validators, err := usecase.NewStoreValidators(usecase.StoreValidatorConfig{
+		Names:   cfg.Storage.Validators,
+		MinSize: cfg.Storage.ValidateMinSize,
+		MaxSize: cfg.Storage.ValidateMaxSize,
+	})
+	if err != nil {
+		l.Fatal("invalid store validators", "error", err)
+	}
+	tileCacheUseCase.ValidateStores(validators...)
+	auditSink, err := usecase.NewAuditSink(usecase.AuditConfig{
+		Sink:  cfg.Audit.Sink,
+		Path:  cfg.Audit.Path,
+		Level: cfg.Audit.Level,
+	}, l)
+	if err != nil {
+		l.Fatal("failed to initialize audit sink", "error", err)
+	}
+	if auditSink != nil {
+		tileCacheUseCase.AuditMutations(auditSink)
+		l.Info("audit logging enabled", "sink", cfg.Audit.Sink)
+	}
+	targets := &migrationTargets{cfg: cfg, logger: l}
+	tileCacheUseCase.EnableMigration(ctx, usecase.MigrationConfig{
+		Backend: current,
+		Open:    targets.open,
+		Wrap: func(tc cache.TileCache) (cache.TileCache, error) {
+			return wrapStorage(tc, cfg.Storage)
+		},
+		Rate: cfg.Storage.MigrationRate,
+	})
 
 	// Initialize the HTTP handler
 	validate := validator.New()
 	handler := handler.NewHandler(validate, tileCacheUseCase)
-	router := v1.NewRouter(handler, l, cfg.Telemetry.Enabled)
+	for _, name := range cfg.HTTP.HealthChecks {
+		switch name {
+		case "cache":
+			handler.AddHealthCheck(name, tileCacheUseCase.CheckBackend)
+		case "none":
+		default:
+			l.Fatal("unknown health check", "check", name)
+		}
+	}
+	router := v1.NewRouter(handler, l, cfg.Telemetry.Enabled, cfg.Auth.APIKeys)
+	root := v1.Root(v1.RootConfig{
+		Format:  cfg.HTTP.RootFormat,
+		Text:    cfg.HTTP.RootText,
+		Service: cfg.Telemetry.ServiceName,
+		Version: cfg.Telemetry.ServiceVersion,
+	})
+	router.GET("/", root)
+	router.HEAD("/", root)
+
+	// Background workers must exit before the Redis connection is closed
+	var workers sync.WaitGroup
+
+	if backend == "redis" && cfg.Redis.InvalidationChannel != "" {
+		// Redis is shared, so an invalidation only drops what this instance
+		// keeps locally; deleting from Redis again could drop a newer tile
+		publisher, err := startInvalidation(ctx, &workers, backendCache, cfg.Redis.InvalidationChannel, func(inv cache.Invalidation) {
+			tileCacheUseCase.ForgetStores(inv)
+			if tiered == nil {
+				return
+			}
+			if err := tiered.Evict(inv.Matches); err != nil {
+				l.Warn("failed to drop invalidated tiles from the memory tier", "key", inv.Key.String(), "purge", inv.Purge, "error", err)
+			}
+		}, l)
+		if err != nil {
+			l.Fatal("failed to start invalidation subscriber", "error", err)
+		}
+		tileCacheUseCase.PublishInvalidations(publisher)
+		l.Info("invalidation subscriber started", "channel", cfg.Redis.InvalidationChannel)
+	}
+
+	if cfg.MaxSizeBytes > 0 {
+		// The janitor deletes through the tiers so the memory tier does not
+		// keep serving evicted tiles
+		janitor, err := cache.NewSizeJanitor(servedCache, cache.JanitorConfig{
+			MaxBytes: cfg.MaxSizeBytes,
+			Interval: cfg.SweepInterval,
+		}, l)
+		if err != nil {
+			l.Fatal("failed to enable the size limit", "backend", backend, "error", err)
+		}
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			janitor.Run(ctx)
+		}()
+		l.Info("size limit enabled", "max_size_bytes", cfg.MaxSizeBytes, "sweep_interval", cfg.SweepInterval)
+	}
+
+	// SIGHUP applies settings that do not need a restart
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go watchReload(ctx, l, hup, config.Reload, cfg, reloadTargets{logger: l, backend: current})
 
 	httpServer := http_server.NewServer(ctx, cfg.HTTP.Server, router)
 
-	l.Info("starting http server...", "address", httpServer.Addr)
+	go func() {
+		l.Info("starting http server...", "address", httpServer.Addr)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			l.Fatal("http server failed", "error", err)
+		}
+		l.Info("http server stopped", "address", httpServer.Addr)
+	}()
 
-	serverErr := httpServer.ListenAndServe()
-	if serverErr != nil && !errors.Is(serverErr, http.ErrServerClosed) {
-		l.Fatal("http server failed", "error", serverErr)
+	var grpcServer *grpc.Server
+	if cfg.GRPC.Enabled {
+		lis, err := net.Listen("tcp", ":"+cfg.GRPC.Port)
+		if err != nil {
+			l.Fatal("failed to listen for grpc", "port", cfg.GRPC.Port, "error", err)
+		}
+		grpcServer = rpc.NewServer(tileCacheUseCase, handler.CountLookup, l).GRPCServer()
+		go func() {
+			l.Info("starting grpc server...", "address", lis.Addr().String())
+			if err := grpcServer.Serve(lis); err != nil {
+				l.Fatal("grpc server failed", "error", err)
+			}
+			l.Info("grpc server stopped", "address", lis.Addr().String())
+		}()
 	}
-	l.Info("http server stopped", "address", httpServer.Addr)
 
 	<-ctx.Done()
 	l.Info("received shutdown signal")
 
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer shutdownCancel()
-
-	l.Info("shutting down http server...", "address", httpServer.Addr)
-	if err := httpServer.Shutdown(shutdownCtx); err != nil {
-		l.Error("http server shutdown failed", "error", err)
-	} else {
-		l.Info("http_server shutdown completed")
+	drainHTTP(l, httpServer, cfg.Shutdown.HTTPDrainTimeout)
+	if grpcServer != nil {
+		drainGRPC(l, grpcServer, cfg.Shutdown.GRPCDrainTimeout)
+	}
+	drainWorkers(l, workers.Wait, cfg.Shutdown.WorkerDrainTimeout)
+	drainWorkers(l, tileCacheUseCase.WaitForMigration, cfg.Shutdown.WorkerDrainTimeout)
+	// Backend calls that timed out may still be running on the backend
+	// about to be closed
+	drainWorkers(l, tileCacheUseCase.WaitForOperations, cfg.Shutdown.WorkerDrainTimeout)
+	// A finished migration left the startup backend idle, and the one
+	// serving now may write behind as well
+	for _, b := range backendsInUse(backendCache, current) {
+		if writer, ok := b.(cache.BackgroundWriter); ok {
+			stopWriter(l, writer, cfg.Shutdown.WorkerDrainTimeout)
+		}
 	}
 
-	<-shutdownCtx.Done()
-	l.Warn("timeout waiting for http server to finish")
+	if closer, ok := backendCache.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			l.Error("failed to close cache backend", "backend", backend, "error", err)
+		}
+	}
+	if err := targets.Close(); err != nil {
+		l.Error("failed to close migration target", "error", err)
+	}
+	if closer, ok := auditSink.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			l.Error("failed to close audit log", "error", err)
+		}
+	}
 
 	l.Info("application shutdown completed")
 }
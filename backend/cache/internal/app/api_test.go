@@ -0,0 +1,97 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/config"
+)
+
+type recordingLogger struct {
+	lines []string
+}
+
+func (r *recordingLogger) record(msg string, keysAndValues ...any) {
+	r.lines = append(r.lines, fmt.Sprintf("%s %+v", msg, keysAndValues))
+}
+
+func (r *recordingLogger) Debug(msg string, kv ...any) { r.record(msg, kv...) }
+func (r *recordingLogger) Info(msg string, kv ...any)  { r.record(msg, kv...) }
+func (r *recordingLogger) Warn(msg string, kv ...any)  { r.record(msg, kv...) }
+func (r *recordingLogger) Error(msg string, kv ...any) { r.record(msg, kv...) }
+func (r *recordingLogger) Fatal(msg string, kv ...any) { r.record(msg, kv...) }
+
+func TestLogStartup_RedactsSecrets(t *testing.T) {
+	const password = "hunter2-super-secret"
+
+	cfg := &config.Config{
+		Redis: config.Redis{
+			Enabled:  true,
+			Addr:     "redis:6379",
+			Password: password,
+		},
+	}
+	l := &recordingLogger{}
+	logStartup(l, cfg)
+
+	logged := strings.Join(l.lines, "\n")
+	if strings.Contains(logged, password) {
+		t.Fatalf("password leaked into startup logs:\n%s", logged)
+	}
+	if !strings.Contains(logged, "[REDACTED]") {
+		t.Fatalf("expected redacted password in logged config:\n%s", logged)
+	}
+	if !strings.Contains(logged, "backend redis") {
+		t.Fatalf("expected selected backend to be logged:\n%s", logged)
+	}
+
+	if cfg.Redis.Password != password {
+		t.Fatal("Redact must not modify the original config")
+	}
+}
+
+func TestLogStartup_RedactsS3SecretKey(t *testing.T) {
+	const secret = "wJalrXUtnFEMI-super-secret"
+
+	cfg := &config.Config{
+		S3: config.S3{
+			Bucket:    "tiles",
+			AccessKey: "AKIDEXAMPLE",
+			SecretKey: secret,
+		},
+	}
+	l := &recordingLogger{}
+	logStartup(l, cfg)
+
+	logged := strings.Join(l.lines, "\n")
+	if strings.Contains(logged, secret) {
+		t.Fatalf("secret key leaked into startup logs:\n%s", logged)
+	}
+	if !strings.Contains(logged, "backend s3") {
+		t.Fatalf("expected selected backend to be logged:\n%s", logged)
+	}
+}
+
+func TestSelectBackend(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+		want string
+	}{
+		{name: "default", want: "sqlite"},
+		{name: "redis wins over s3", cfg: config.Config{Redis: config.Redis{Enabled: true}, S3: config.S3{Bucket: "tiles"}}, want: "redis"},
+		{name: "s3", cfg: config.Config{S3: config.S3{Bucket: "tiles"}}, want: "s3"},
+		{name: "mbtiles", cfg: config.Config{MBTiles: config.MBTiles{Path: "seed.mbtiles"}}, want: "mbtiles"},
+		{name: "memory", cfg: config.Config{Memory: config.Memory{Enabled: true}}, want: "map"},
+		{name: "memory tier keeps sqlite", cfg: config.Config{Memory: config.Memory{Enabled: true, Tier: true}}, want: "sqlite"},
+		{name: "explicit", cfg: config.Config{Backend: "badger", Redis: config.Redis{Enabled: true}}, want: "badger"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectBackend(&tt.cfg); got != tt.want {
+				t.Fatalf("selectBackend = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+//go:build redis
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+// startInvalidation runs a subscriber for tiles invalidated by cache
+// instances on the Redis backend until ctx is done, and returns it to
+// publish this instance's invalidations.
+func startInvalidation(ctx context.Context, workers *sync.WaitGroup, backend cache.TileCache, channel string, onInvalidate func(cache.Invalidation), l logger.Logger) (usecase.InvalidationPublisher, error) {
+	rc, ok := backend.(*cache.RedisCache)
+	if !ok {
+		return nil, fmt.Errorf("invalidation needs the redis backend, got %T", backend)
+	}
+	subscriber := cache.NewInvalidationSubscriber(rc.Client(), channel, onInvalidate, l)
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		subscriber.Run(ctx)
+	}()
+	return subscriber, nil
+}
@@ -0,0 +1,17 @@
+//go:build !redis
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func startInvalidation(_ context.Context, _ *sync.WaitGroup, _ cache.TileCache, _ string, _ func(cache.Invalidation), _ logger.Logger) (usecase.InvalidationPublisher, error) {
+	return nil, fmt.Errorf("%w: redis, rebuild with -tags redis", cache.ErrBackendNotBuilt)
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"maps"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/config"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+// reloadTargets are the components whose settings can change at runtime.
+type reloadTargets struct {
+	logger *logger.ZapLogger
+	// backend holds the cache backend, whose TTLs are reloaded when it is
+	// Redis. It may be nil.
+	backend *cache.SwappableCache
+}
+
+// ttlSetter is implemented by backends whose TTLs can change at runtime.
+type ttlSetter interface {
+	SetTTLs(ttl time.Duration, zoomTTLs map[int]time.Duration)
+}
+
+// redisTTLs returns the backend as a ttlSetter, or nil for backends without
+// TTLs.
+func redisTTLs(tc cache.TileCache) ttlSetter {
+	s, _ := tc.(ttlSetter)
+	return s
+}
+
+// redis returns the backend serving now when it has TTLs, nil otherwise.
+func (t reloadTargets) redis() ttlSetter {
+	if t.backend == nil {
+		return nil
+	}
+	return redisTTLs(t.backend.Current())
+}
+
+// watchReload reloads the config on every signal until ctx is done. A config
+// that fails to load is logged and the current one stays in effect.
+func watchReload(ctx context.Context, l logger.Logger, signals <-chan os.Signal, load func() (*config.Config, error), current *config.Config, t reloadTargets) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			l.Info("reloading config", "signal", sig)
+			next, err := load()
+			if err != nil {
+				l.Error("failed to reload config, keeping the current one", "error", err)
+				continue
+			}
+			current = applyReload(l, current, next, t)
+		}
+	}
+}
+
+// applyReload applies the fields of next that can change without a restart
+// and returns the config now in effect. Other changes are logged and ignored.
+func applyReload(l logger.Logger, current, next *config.Config, t reloadTargets) *config.Config {
+	applied := *current
+
+	if next.Logger.Level != current.Logger.Level {
+		t.logger.SetLevel(next.Logger.Level)
+		applied.Logger.Level = next.Logger.Level
+		l.Info("log level reloaded", "from", current.Logger.Level, "to", next.Logger.Level)
+	}
+
+	if redis := t.redis(); redis != nil && (next.Redis.TTL != current.Redis.TTL || !maps.Equal(next.Redis.ZoomTTLs, current.Redis.ZoomTTLs)) {
+		redis.SetTTLs(next.Redis.TTL, next.Redis.ZoomTTLs)
+		applied.Redis.TTL = next.Redis.TTL
+		applied.Redis.ZoomTTLs = next.Redis.ZoomTTLs
+		l.Info("redis ttls reloaded", "ttl", next.Redis.TTL, "zoom_ttls", next.Redis.ZoomTTLs)
+	}
+
+	if ignored := changedFields(reflect.ValueOf(applied), reflect.ValueOf(*next), ""); len(ignored) > 0 {
+		l.Warn("config changes require a restart, ignoring them", "fields", ignored)
+	}
+
+	return &applied
+}
+
+// changedFields lists the dotted names of the leaf fields that differ
+// between two values of the same struct type. Values are not included so
+// secrets stay out of the logs.
+func changedFields(a, b reflect.Value, prefix string) []string {
+	if a.Kind() != reflect.Struct {
+		if reflect.DeepEqual(a.Interface(), b.Interface()) {
+			return nil
+		}
+		return []string{prefix}
+	}
+
+	var changed []string
+	for i := 0; i < a.NumField(); i++ {
+		name := a.Type().Field(i).Name
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		changed = append(changed, changedFields(a.Field(i), b.Field(i), name)...)
+	}
+	return changed
+}
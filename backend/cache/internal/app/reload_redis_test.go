@@ -0,0 +1,48 @@
+//go:build redis
+
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/config"
+)
+
+func TestApplyReload_RedisTTLs(t *testing.T) {
+	mr := miniredis.RunT(t)
+	current := &config.Config{Redis: config.Redis{Addr: mr.Addr(), TTL: time.Hour}}
+	rc, err := cache.NewRedisCache(cache.RedisConfig{Addr: mr.Addr(), TTL: current.Redis.TTL}, &recordingLogger{})
+	if err != nil {
+		t.Fatalf("failed to create redis cache: %v", err)
+	}
+	defer rc.Close()
+
+	next := *current
+	next.Redis.TTL = 2 * time.Hour
+	next.Redis.ZoomTTLs = map[int]time.Duration{0: 24 * time.Hour}
+
+	rec := &recordingLogger{}
+	applied := applyReload(rec, current, &next, reloadTargets{backend: cache.NewSwappableCache(rc)})
+	if applied.Redis.TTL != next.Redis.TTL {
+		t.Fatalf("expected TTL %s to be applied, got %s", next.Redis.TTL, applied.Redis.TTL)
+	}
+	if strings.Contains(strings.Join(rec.lines, "\n"), "require a restart") {
+		t.Fatalf("TTL changes must not need a restart:\n%s", strings.Join(rec.lines, "\n"))
+	}
+
+	for _, k := range []cache.TileCacheKey{{Z: 5}, {Z: 0}} {
+		if err := rc.Set(k, cache.TileCacheValue("tile")); err != nil {
+			t.Fatalf("failed to set tile: %v", err)
+		}
+	}
+	if ttl := mr.TTL("tile:5:0:0"); ttl != 2*time.Hour {
+		t.Fatalf("expected reloaded default TTL, got %s", ttl)
+	}
+	if ttl := mr.TTL("tile:0:0:0"); ttl != 24*time.Hour {
+		t.Fatalf("expected reloaded zoom TTL, got %s", ttl)
+	}
+}
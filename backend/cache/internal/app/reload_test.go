@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	v1 "github.com/jaennil/guide_helper/backend/cache/internal/infrastructure/http/v1"
+	"github.com/jaennil/guide_helper/backend/cache/internal/infrastructure/http/v1/handler"
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/config"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestWatchReload_ChangesLogLevelWhileServing(t *testing.T) {
+	current := &config.Config{
+		Logger: config.Logger{Level: "INFO"},
+		HTTP:   config.HTTP{Server: config.Server{Port: "8080"}},
+	}
+	zl := logger.NewZapLogger(current.Logger)
+	uc := usecase.NewTileCacheUseCase(cache.NewMapCache(zl), zl)
+	srv := httptest.NewServer(v1.NewRouter(handler.NewHandler(validator.New(), uc), zl, false, nil))
+	defer srv.Close()
+
+	next := *current
+	next.Logger.Level = "DEBUG"
+	next.HTTP.Server.Port = "9090"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	rec := &recordingLogger{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchReload(ctx, rec, signals, func() (*config.Config, error) { return &next, nil }, current, reloadTargets{logger: zl})
+	}()
+
+	signals <- syscall.SIGHUP
+
+	deadline := time.Now().Add(time.Second)
+	for zl.Level() != zapcore.DebugLevel {
+		if time.Now().After(deadline) {
+			t.Fatalf("log level is still %s after reload", zl.Level())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	resp, err := http.Get(srv.URL + "/api/v1/healthz")
+	if err != nil {
+		t.Fatalf("server stopped serving after reload: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 after reload, got %d", resp.StatusCode)
+	}
+
+	cancel()
+	<-done
+
+	logged := strings.Join(rec.lines, "\n")
+	if !strings.Contains(logged, "HTTP.Server.Port") {
+		t.Fatalf("expected the port change to be reported as needing a restart:\n%s", logged)
+	}
+	if strings.Contains(logged, "Logger.Level") {
+		t.Fatalf("log level must not be reported as needing a restart:\n%s", logged)
+	}
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"google.golang.org/grpc"
+)
+
+// drainHTTP stops accepting new requests and waits up to timeout for
+// in-flight ones. Connections still open after that are closed forcibly.
+func drainHTTP(l logger.Logger, server *http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	l.Info("shutting down http server...", "address", server.Addr, "drain_timeout", timeout)
+	if err := server.Shutdown(ctx); err != nil {
+		l.Warn("http server did not drain in time, closing connections", "error", err)
+		if err := server.Close(); err != nil {
+			l.Error("failed to close http server", "error", err)
+		}
+		return
+	}
+	l.Info("http_server shutdown completed")
+}
+
+// drainGRPC stops accepting new calls and waits up to timeout for in-flight
+// ones, which are cancelled after that.
+func drainGRPC(l logger.Logger, server *grpc.Server, timeout time.Duration) {
+	l.Info("shutting down grpc server...", "drain_timeout", timeout)
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-stopped:
+		l.Info("grpc server shutdown completed")
+	case <-timer.C:
+		l.Warn("grpc server did not drain in time, cancelling calls")
+		server.Stop()
+	}
+}
+
+// drainWorkers waits up to timeout for wait to return and reports whether it
+// did. Workers still running after that are abandoned.
+func drainWorkers(l logger.Logger, wait func(), timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		l.Info("background workers stopped")
+		return true
+	case <-timer.C:
+		l.Warn("timeout waiting for background workers to finish", "drain_timeout", timeout)
+		return false
+	}
+}
+
+// stopWriter stops the backend's write-behind workers and waits up to timeout
+// for their final flush, logging its error.
+func stopWriter(l logger.Logger, writer cache.BackgroundWriter, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-writer.StopWriting():
+		if err != nil {
+			l.Error("failed to flush pending writes", "error", err)
+			return
+		}
+		l.Info("pending writes flushed")
+	case <-timer.C:
+		l.Warn("timeout waiting for pending writes to flush", "drain_timeout", timeout)
+	}
+}
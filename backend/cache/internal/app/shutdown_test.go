@@ -0,0 +1,111 @@
+package app
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDrainHTTP_ForcesCloseAfterTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go server.Serve(ln)
+
+	clientErr := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err == nil {
+			resp.Body.Close()
+		}
+		clientErr <- err
+	}()
+	<-started
+
+	const timeout = 100 * time.Millisecond
+	start := time.Now()
+	drainHTTP(&recordingLogger{}, server, timeout)
+	elapsed := time.Since(start)
+
+	if elapsed < timeout {
+		t.Fatalf("drain returned after %v, before the %v timeout", elapsed, timeout)
+	}
+	if elapsed > timeout+time.Second {
+		t.Fatalf("drain took %v, expected about %v", elapsed, timeout)
+	}
+
+	select {
+	case err := <-clientErr:
+		if err == nil {
+			t.Fatal("expected the in-flight request to be cut off")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("in-flight connection was not closed")
+	}
+}
+
+func TestDrainWorkers(t *testing.T) {
+	var workers sync.WaitGroup
+	workers.Add(1)
+	release := make(chan struct{})
+	go func() {
+		defer workers.Done()
+		<-release
+	}()
+
+	const timeout = 50 * time.Millisecond
+	start := time.Now()
+	if drainWorkers(&recordingLogger{}, workers.Wait, timeout) {
+		t.Fatal("expected drain to give up on a stuck worker")
+	}
+	if elapsed := time.Since(start); elapsed < timeout || elapsed > timeout+time.Second {
+		t.Fatalf("drain took %v, expected about %v", elapsed, timeout)
+	}
+
+	close(release)
+	if !drainWorkers(&recordingLogger{}, workers.Wait, time.Second) {
+		t.Fatal("expected finished workers to drain")
+	}
+}
+
+// fakeWriter finishes its final flush with err, or never when stuck.
+type fakeWriter struct {
+	err   error
+	stuck bool
+}
+
+func (w fakeWriter) StopWriting() <-chan error {
+	done := make(chan error, 1)
+	if !w.stuck {
+		done <- w.err
+	}
+	return done
+}
+
+func TestStopWriter(t *testing.T) {
+	l := &recordingLogger{}
+	stopWriter(l, fakeWriter{err: errors.New("disk full")}, time.Second)
+	if len(l.lines) != 1 || !strings.Contains(l.lines[0], "disk full") {
+		t.Fatalf("expected the flush error to be logged, got %v", l.lines)
+	}
+
+	const timeout = 50 * time.Millisecond
+	start := time.Now()
+	stopWriter(&recordingLogger{}, fakeWriter{stuck: true}, timeout)
+	if elapsed := time.Since(start); elapsed < timeout || elapsed > timeout+time.Second {
+		t.Fatalf("stop took %v, expected about %v", elapsed, timeout)
+	}
+}
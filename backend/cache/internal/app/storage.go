@@ -0,0 +1,137 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/config"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+// backendConfig collects the settings of every cache backend.
+func backendConfig(cfg *config.Config) (cache.BackendConfig, error) {
+	layout, err := cache.ParseFilesystemLayout(cfg.Filesystem.Layout)
+	if err != nil {
+		return cache.BackendConfig{}, err
+	}
+
+	return cache.BackendConfig{
+		Redis: cache.RedisConfig{
+			Addr:        cfg.Redis.Addr,
+			Password:    cfg.Redis.Password,
+			DB:          cfg.Redis.DB,
+			TTL:         cfg.Redis.TTL,
+			ZoomTTLs:    cfg.Redis.ZoomTTLs,
+			KeyPrefix:   cfg.Redis.KeyPrefix,
+			NotFoundTTL: cfg.Storage.NotFoundTTL,
+		},
+		SQLite: cache.SQLiteConfig{
+			Path:                cfg.SQLite.Path,
+			AccessFlushInterval: cfg.SQLite.AccessFlushInterval,
+			Dedup:               cfg.SQLite.Dedup,
+			MigrationTimeout:    cfg.SQLite.MigrationTimeout,
+		},
+		Remote: cache.RemoteConfig{
+			BaseURL: cfg.Remote.BaseURL,
+			Timeout: cfg.Remote.Timeout,
+		},
+		Map: cache.MapConfig{
+			MaxEntries: cfg.Memory.MaxEntries,
+			MaxBytes:   cfg.Memory.MaxBytes,
+		},
+		Filesystem: cache.FilesystemConfig{
+			Root:         cfg.Filesystem.Root,
+			Layout:       layout,
+			MaxOpenFiles: cfg.Filesystem.MaxOpenFiles,
+		},
+		MBTiles: cache.MBTilesConfig{
+			Path: cfg.MBTiles.Path,
+		},
+		Badger: cache.BadgerConfig{
+			Path:       cfg.Badger.Path,
+			SyncWrites: cfg.Badger.SyncWrites,
+			GCInterval: cfg.Badger.GCInterval,
+		},
+		S3: cache.S3Config{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			Prefix:    cfg.S3.Prefix,
+			Extension: cfg.S3.Extension,
+			PathStyle: cfg.S3.PathStyle,
+			Timeout:   cfg.S3.Timeout,
+		},
+	}, nil
+}
+
+// wrapStorage applies the configured compression and value format to a
+// backend.
+func wrapStorage(tc cache.TileCache, cfg config.Storage) (cache.TileCache, error) {
+	if cfg.Compression != "" && cfg.Compression != "none" {
+		compressing, err := cache.NewCompressingCache(tc, cache.CompressionConfig{
+			Codec: cfg.Compression,
+			Level: cfg.CompressionLevel,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize compression: %w", err)
+		}
+		tc = compressing
+	}
+
+	switch cfg.ValueFormat {
+	case "envelope":
+		tc = cache.NewEnvelopeCache(tc, cache.EnvelopeCodec{})
+	case "", "raw":
+	default:
+		return nil, fmt.Errorf("unknown storage value format %q", cfg.ValueFormat)
+	}
+	return tc, nil
+}
+
+// migrationTargets opens the backends a running cache can migrate to and
+// keeps them for closing at shutdown.
+type migrationTargets struct {
+	cfg    *config.Config
+	logger logger.Logger
+
+	mu      sync.Mutex
+	closers []io.Closer
+}
+
+// open returns the named backend, e.g. "redis" or "sqlite", configured like
+// it would be at startup. The storage format is left to the migration, which
+// copies tiles as they are stored.
+func (t *migrationTargets) open(name string) (cache.TileCache, error) {
+	backends, err := backendConfig(t.cfg)
+	if err != nil {
+		return nil, err
+	}
+	tc, err := cache.OpenBackend(name, backends, t.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if closer, ok := tc.(io.Closer); ok {
+		t.mu.Lock()
+		t.closers = append(t.closers, closer)
+		t.mu.Unlock()
+	}
+
+	return tc, nil
+}
+
+func (t *migrationTargets) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var errs []error
+	for _, c := range t.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/config"
+)
+
+func TestWrapStorage_DefaultStoresPlainTiles(t *testing.T) {
+	t.Setenv("HTTP_SERVER_PORT", "8080")
+	t.Setenv("LOGGER_LEVEL", "info")
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	backend := cache.NewMapCache(&recordingLogger{})
+	tc, err := wrapStorage(backend, cfg.Storage)
+	if err != nil {
+		t.Fatalf("wrapStorage failed: %v", err)
+	}
+
+	// Filesystem, S3 and MBTiles files must stay images other tools can read
+	key := cache.TileCacheKey{Z: 5, X: 10, Y: 12}
+	if err := tc.Set(key, []byte("png")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	stored, exists, err := backend.Get(key)
+	if err != nil || !exists || string(stored) != "png" {
+		t.Fatalf("expected the backend to hold the tile bytes, got %q exists=%v err=%v", stored, exists, err)
+	}
+}
+
+func TestWrapStorage_EnvelopeKeepsUpstreamValidators(t *testing.T) {
+	t.Setenv("HTTP_SERVER_PORT", "8080")
+	t.Setenv("LOGGER_LEVEL", "info")
+	t.Setenv("STORAGE_VALUE_FORMAT", "envelope")
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	tc, err := wrapStorage(cache.NewMapCache(&recordingLogger{}), cfg.Storage)
+	if err != nil {
+		t.Fatalf("wrapStorage failed: %v", err)
+	}
+
+	up, ok := tc.(cache.UpstreamTileCache)
+	if !ok {
+		t.Fatalf("envelope storage %T does not record upstream info", tc)
+	}
+	key := cache.TileCacheKey{Z: 5, X: 10, Y: 12}
+	lastModified := time.Date(2026, 10, 1, 8, 30, 0, 0, time.UTC)
+	if err := up.SetWithUpstream(key, []byte("png"), cache.UpstreamInfo{ETag: `"v1"`, LastModified: lastModified}); err != nil {
+		t.Fatalf("SetWithUpstream failed: %v", err)
+	}
+
+	_, meta, exists, err := tc.(cache.MetadataTileCache).GetWithMetadata(key)
+	if err != nil || !exists {
+		t.Fatalf("GetWithMetadata returned exists=%v, %v", exists, err)
+	}
+	if meta.UpstreamETag != `"v1"` || !meta.LastModified.Equal(lastModified) {
+		t.Fatalf("expected the upstream validators back, got %+v", meta)
+	}
+}
+
+func TestBackendConfig_Filesystem(t *testing.T) {
+	t.Setenv("HTTP_SERVER_PORT", "8080")
+	t.Setenv("LOGGER_LEVEL", "info")
+	t.Setenv("FILESYSTEM_LAYOUT", "hashed")
+	t.Setenv("FILESYSTEM_MAX_OPEN_FILES", "64")
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	backends, err := backendConfig(cfg)
+	if err != nil {
+		t.Fatalf("backendConfig failed: %v", err)
+	}
+	if fs := backends.Filesystem; fs.Layout != cache.LayoutHashed || fs.MaxOpenFiles != 64 {
+		t.Fatalf("expected the hashed layout with 64 open files, got %+v", fs)
+	}
+
+	cfg.Filesystem.Layout = "flat"
+	if _, err := backendConfig(cfg); err == nil {
+		t.Fatal("expected an unknown layout to fail")
+	}
+}
@@ -1,6 +1,93 @@
 package dto
 
+import "time"
+
 type TileCacheResponse struct {
 	Data []byte `json:"data"`
 	Exists bool `json:"exists"`
+	// StoredAt is omitted when the backend does not track store time
+	StoredAt *time.Time `json:"stored_at,omitempty"`
+	ETag string `json:"etag,omitempty"`
+	// ContentType is the type recorded when the tile was stored, omitted
+	// unless the storage value format records metadata
+	ContentType string `json:"content_type,omitempty"`
+	// NotFound is set when the tile is recorded as missing upstream
+	NotFound bool `json:"not_found,omitempty"`
+	// UpstreamETag and LastModified are the validators upstream served the
+	// tile with, omitted unless the storing client reported them
+	UpstreamETag string `json:"upstream_etag,omitempty"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+}
+
+// TileMetaResponse describes a cached tile without its data.
+type TileMetaResponse struct {
+	Exists bool `json:"exists"`
+	Size   int  `json:"size"`
+	// StoredAt is omitted when the backend does not track store time
+	StoredAt    *time.Time `json:"stored_at,omitempty"`
+	ETag        string     `json:"etag,omitempty"`
+	ContentType string     `json:"content_type,omitempty"`
+	NotFound    bool       `json:"not_found,omitempty"`
+	// Source is the upstream URL the tile was fetched from, and
+	// UpstreamETag and LastModified the validators it was served with,
+	// omitted unless the storing client reported them
+	Source       string     `json:"source,omitempty"`
+	UpstreamETag string     `json:"upstream_etag,omitempty"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+}
+
+type TileCoord struct {
+	Z int `json:"z" validate:"min=0,max=30"`
+	X int `json:"x" validate:"min=0"`
+	Y int `json:"y" validate:"min=0"`
+}
+
+type TileBatchRequest struct {
+	Tiles []TileCoord `json:"tiles" validate:"required,min=1,max=256,dive"`
+}
+
+type TileBatchItem struct {
+	TileCoord
+	Data   []byte `json:"data"`
+	Exists bool   `json:"exists"`
+}
+
+type TileBatchResponse struct {
+	Tiles []TileBatchItem `json:"tiles"`
+}
+
+type MigrationRequest struct {
+	// Destination names the backend to migrate to, e.g. "redis"
+	Destination string `json:"destination" validate:"required"`
+}
+
+// PurgeRequest selects the tiles removed by a purge. BBox is
+// "west,south,east,north" in degrees; without it whole zoom levels are
+// purged.
+type PurgeRequest struct {
+	MinZ *int   `json:"minZ" validate:"required,min=0,max=30"`
+	MaxZ *int   `json:"maxZ" validate:"required,min=0,max=30"`
+	BBox string `json:"bbox,omitempty"`
+}
+
+type PurgeResponse struct {
+	Removed int64 `json:"removed"`
+}
+
+// CacheStatsResponse summarises the cached tiles. Hits, Misses and HitRatio
+// count the lookups answered by this instance since it started.
+type CacheStatsResponse struct {
+	Backend  string      `json:"backend"`
+	Tiles    int64       `json:"tiles"`
+	Bytes    int64       `json:"bytes"`
+	Zooms    []ZoomStats `json:"zooms"`
+	Hits     int64       `json:"hits"`
+	Misses   int64       `json:"misses"`
+	HitRatio float64     `json:"hit_ratio"`
+}
+
+type ZoomStats struct {
+	Z     int   `json:"z"`
+	Tiles int64 `json:"tiles"`
+	Bytes int64 `json:"bytes"`
 }
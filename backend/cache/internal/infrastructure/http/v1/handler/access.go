@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+const ndjson = "application/x-ndjson"
+
+// accessFlushEvery is how many records are written between flushes, so
+// consumers see progress without a flush per line.
+const accessFlushEvery = 1000
+
+// ExportAccess streams the last access time and hit count of every tile as
+// NDJSON, one {"z","x","y","last_access","hit_count"} record per line.
+// Errors after the first record can only end the stream early.
+func (h *Handler) ExportAccess(c *gin.Context) {
+	log, _ := c.Get("logger")
+	l := log.(*logger.ZapLogger)
+
+	enc := json.NewEncoder(c.Writer)
+	written := 0
+	err := h.tileCacheUseCase.ExportAccess(func(r usecase.AccessRecord) error {
+		if written == 0 {
+			c.Header("Content-Type", ndjson)
+			c.Status(http.StatusOK)
+		}
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+		written++
+		if written%accessFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, usecase.ErrNoAccessTracking):
+		h.RespondWithJSON(c, http.StatusUnprocessableEntity, err.Error(), nil)
+	case err != nil && !c.Writer.Written():
+		l.Error("failed to export tile access", "error", err)
+		h.RespondWithCacheError(c, err)
+	case err != nil:
+		l.Error("tile access export ended early", "records", written, "error", err)
+	case !c.Writer.Written():
+		c.Data(http.StatusOK, ndjson, nil)
+	}
+}
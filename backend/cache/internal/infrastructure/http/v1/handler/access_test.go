@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tilecache "github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
+)
+
+// accessCache is a map cache that reports fixed access records.
+type accessCache struct {
+	*tilecache.MapCache
+	access map[tilecache.TileCacheKey]tilecache.AccessInfo
+}
+
+func (c *accessCache) IterateAccess(fn func(tilecache.TileCacheKey, tilecache.AccessInfo) bool) error {
+	for k, info := range c.access {
+		if !fn(k, info) {
+			break
+		}
+	}
+	return nil
+}
+
+func TestExportAccess(t *testing.T) {
+	last := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	want := map[tilecache.TileCacheKey]usecase.AccessRecord{
+		{Z: 3, X: 1, Y: 2}: {Z: 3, X: 1, Y: 2, LastAccess: last, HitCount: 7},
+		{Z: 5, X: 8, Y: 9}: {Z: 5, X: 8, Y: 9, LastAccess: last.Add(-time.Hour), HitCount: 1},
+		{Z: 0, X: 0, Y: 0}: {Z: 0, X: 0, Y: 0, LastAccess: last.Add(time.Minute), HitCount: 0},
+	}
+	tc := &accessCache{MapCache: newTestMapCache(), access: map[tilecache.TileCacheKey]tilecache.AccessInfo{}}
+	for k, r := range want {
+		tc.access[k] = tilecache.AccessInfo{LastAccess: r.LastAccess, Hits: r.HitCount}
+	}
+	r, _ := newTestRouter(t, tc)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/access", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ndjson {
+		t.Fatalf("expected %s, got %q", ndjson, ct)
+	}
+
+	got := 0
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var record usecase.AccessRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %q is not a record: %v", scanner.Text(), err)
+		}
+		k := tilecache.TileCacheKey{Z: record.Z, X: record.X, Y: record.Y}
+		expected, ok := want[k]
+		if !ok {
+			t.Fatalf("unexpected record %+v", record)
+		}
+		if !record.LastAccess.Equal(expected.LastAccess) || record.HitCount != expected.HitCount {
+			t.Fatalf("record %+v, want %+v", record, expected)
+		}
+		got++
+	}
+	if got != len(want) {
+		t.Fatalf("expected %d records, got %d", len(want), got)
+	}
+}
+
+func TestExportAccess_Untracked(t *testing.T) {
+	r, _ := newTestRouter(t, newTestMapCache())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/access", nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for a backend without access tracking, got %d", w.Code)
+	}
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/cache/internal/infrastructure/http/v1/dto"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/metrics"
+)
+
+const multipartMixed = "multipart/mixed"
+
+// TileBatch returns several tiles in one response. Clients sending
+// "Accept: multipart/mixed" receive one part per tile with raw bytes,
+// streamed as each tile is read, instead of a single base64 JSON document.
+func (h *Handler) TileBatch(c *gin.Context) {
+	log, _ := c.Get("logger")
+	l := log.(*logger.ZapLogger)
+
+	var req dto.TileBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		l.Warn("invalid batch request", "error", err)
+		h.RespondWithJSON(c, http.StatusBadRequest, ErrFailedToDecodeRequestBody.Error(), nil)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		l.Warn("invalid batch request", "error", err)
+		h.RespondWithJSON(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	l.Info("batch tile request", "count", len(req.Tiles))
+
+	if strings.Contains(c.GetHeader("Accept"), multipartMixed) {
+		h.streamTileBatch(c, l, req.Tiles)
+		return
+	}
+
+	resp := dto.TileBatchResponse{
+		Tiles: make([]dto.TileBatchItem, 0, len(req.Tiles)),
+	}
+	for _, coord := range req.Tiles {
+		data, _, exists, err := h.tileCacheUseCase.GetCachedTile(coord.X, coord.Y, coord.Z)
+		if err != nil {
+			l.Error("failed to get cached tile", "z", coord.Z, "x", coord.X, "y", coord.Y, "error", err)
+			h.RespondWithCacheError(c, err)
+			return
+		}
+		h.CountLookup(exists)
+		resp.Tiles = append(resp.Tiles, dto.TileBatchItem{
+			TileCoord: coord,
+			Data:      data,
+			Exists:    exists,
+		})
+	}
+
+	h.RespondWithJSON(c, http.StatusOK, "got tiles", resp)
+}
+
+func (h *Handler) streamTileBatch(c *gin.Context, l *logger.ZapLogger, coords []dto.TileCoord) {
+	mw := multipart.NewWriter(c.Writer)
+	c.Header("Content-Type", fmt.Sprintf("%s; boundary=%s", multipartMixed, mw.Boundary()))
+	c.Status(http.StatusOK)
+
+	for _, coord := range coords {
+		data, _, exists, err := h.tileCacheUseCase.GetCachedTile(coord.X, coord.Y, coord.Z)
+		if err != nil {
+			// Headers are already sent, so the failure is reported on the part itself
+			l.Error("failed to get cached tile", "z", coord.Z, "x", coord.X, "y", coord.Y, "error", err)
+		}
+		h.CountLookup(exists)
+
+		header := textproto.MIMEHeader{}
+		header.Set("X-Tile-Z", strconv.Itoa(coord.Z))
+		header.Set("X-Tile-X", strconv.Itoa(coord.X))
+		header.Set("X-Tile-Y", strconv.Itoa(coord.Y))
+		header.Set("X-Tile-Exists", strconv.FormatBool(exists))
+		if err != nil {
+			header.Set("X-Tile-Error", internalServerErrorText)
+		}
+		if exists {
+			header.Set("Content-Type", "image/png")
+		}
+
+		part, err := mw.CreatePart(header)
+		if err != nil {
+			l.Warn("failed to write batch part, client likely disconnected", "error", err)
+			return
+		}
+		if _, err := part.Write(data); err != nil {
+			l.Warn("failed to write batch part, client likely disconnected", "error", err)
+			return
+		}
+		c.Writer.Flush()
+	}
+
+	if err := mw.Close(); err != nil {
+		l.Warn("failed to finish batch response", "error", err)
+	}
+}
+
+// CountLookup records a tile lookup in the metrics and the stats
+// endpoint's hit ratio, for lookups served outside the handler too.
+func (h *Handler) CountLookup(exists bool) {
+	if exists {
+		metrics.CacheHits.Inc()
+		h.hits.Add(1)
+	} else {
+		metrics.CacheMisses.Inc()
+		h.misses.Add(1)
+	}
+}
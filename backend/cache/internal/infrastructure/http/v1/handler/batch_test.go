@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/infrastructure/http/v1/dto"
+	tilecache "github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+)
+
+const batchBody = `{"tiles":[{"z":1,"x":0,"y":0},{"z":2,"x":1,"y":3},{"z":5,"x":9,"y":9}]}`
+
+func seedBatchCache(t *testing.T) *tilecache.MapCache {
+	t.Helper()
+	mc := newTestMapCache()
+	mc.Set(tilecache.TileCacheKey{Z: 1, X: 0, Y: 0}, []byte("tile-1-0-0"))
+	mc.Set(tilecache.TileCacheKey{Z: 2, X: 1, Y: 3}, []byte("tile-2-1-3"))
+	return mc
+}
+
+func TestTileBatch_Multipart(t *testing.T) {
+	r, _ := newTestRouter(t, seedBatchCache(t))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tiles/batch", strings.NewReader(batchBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "multipart/mixed")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("unexpected content type %q: %v", w.Header().Get("Content-Type"), err)
+	}
+
+	want := []struct {
+		z, x, y string
+		exists  string
+		body    string
+	}{
+		{"1", "0", "0", "true", "tile-1-0-0"},
+		{"2", "1", "3", "true", "tile-2-1-3"},
+		{"5", "9", "9", "false", ""},
+	}
+
+	mr := multipart.NewReader(w.Body, params["boundary"])
+	for i, exp := range want {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		if part.Header.Get("X-Tile-Z") != exp.z || part.Header.Get("X-Tile-X") != exp.x || part.Header.Get("X-Tile-Y") != exp.y {
+			t.Fatalf("part %d: unexpected coordinates %v", i, part.Header)
+		}
+		if part.Header.Get("X-Tile-Exists") != exp.exists {
+			t.Fatalf("part %d: expected exists=%s, got %s", i, exp.exists, part.Header.Get("X-Tile-Exists"))
+		}
+		body, _ := io.ReadAll(part)
+		if string(body) != exp.body {
+			t.Fatalf("part %d: expected body %q, got %q", i, exp.body, body)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Fatalf("expected end of multipart body, got %v", err)
+	}
+}
+
+func TestTileBatch_JSON(t *testing.T) {
+	r, _ := newTestRouter(t, seedBatchCache(t))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tiles/batch", strings.NewReader(batchBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data dto.TileBatchResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Data.Tiles) != 3 {
+		t.Fatalf("expected 3 tiles, got %d", len(resp.Data.Tiles))
+	}
+	if string(resp.Data.Tiles[1].Data) != "tile-2-1-3" || resp.Data.Tiles[2].Exists {
+		t.Fatalf("unexpected tiles: %+v", resp.Data.Tiles)
+	}
+}
+
+func TestTileBatch_RejectsEmptyBatch(t *testing.T) {
+	r, _ := newTestRouter(t, newTestMapCache())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tiles/batch", strings.NewReader(`{"tiles":[]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
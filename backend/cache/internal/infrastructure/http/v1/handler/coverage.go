@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+)
+
+// maxMissingListed caps how many missing tiles a coverage response lists.
+const maxMissingListed = 1000
+
+// CheckCoverage reports how many tiles of a region are cached, e.g.
+// "?bbox=37.5,55.6,37.7,55.8&z=10-14,16".
+func (h *Handler) CheckCoverage(c *gin.Context) {
+	log, _ := c.Get("logger")
+	l := log.(*logger.ZapLogger)
+
+	bbox, err := tilemath.ParseBBox(c.Query("bbox"))
+	if err != nil {
+		h.RespondWithJSON(c, http.StatusBadRequest, "bbox should be west,south,east,north in degrees", nil)
+		return
+	}
+
+	zooms, err := parseZooms(c.Query("z"))
+	if err != nil {
+		h.RespondWithJSON(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	coverage, err := h.tileCacheUseCase.CheckCoverage(bbox, zooms, maxMissingListed)
+	switch {
+	case errors.Is(err, usecase.ErrInvalidZoom), errors.Is(err, usecase.ErrCoverageTooLarge):
+		h.RespondWithJSON(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	case err != nil:
+		l.Error("failed to check coverage", "error", err)
+		h.RespondWithInternalServerError(c)
+		return
+	}
+
+	h.RespondWithJSON(c, http.StatusOK, "checked coverage", coverage)
+}
+
+// parseZooms parses a comma separated list of zoom levels and inclusive
+// ranges, such as "10-14,16". Duplicates are dropped.
+func parseZooms(s string) ([]int, error) {
+	if s == "" {
+		return nil, errors.New("z is required")
+	}
+
+	seen := map[int]bool{}
+	var zooms []int
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zoom %q", part)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(hi); err != nil || to < from {
+				return nil, fmt.Errorf("invalid zoom range %q", part)
+			}
+		}
+		if from < 0 || to > tilemath.MaxZoom {
+			return nil, fmt.Errorf("zoom %q out of range 0-%d", part, tilemath.MaxZoom)
+		}
+
+		for z := from; z <= to; z++ {
+			if !seen[z] {
+				seen[z] = true
+				zooms = append(zooms, z)
+			}
+		}
+	}
+	return zooms, nil
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	tilecache "github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+)
+
+func TestCheckCoverage(t *testing.T) {
+	mc := newTestMapCache()
+	// The region is covered by the four zoom 1 tiles and x,y in 1..2 at zoom 2
+	for _, k := range []tilecache.TileCacheKey{
+		{Z: 1, X: 0, Y: 0}, {Z: 1, X: 0, Y: 1}, {Z: 1, X: 1, Y: 0}, {Z: 1, X: 1, Y: 1},
+		{Z: 2, X: 1, Y: 1},
+		// Outside the region, must not be counted
+		{Z: 2, X: 0, Y: 0},
+	} {
+		mc.Set(k, []byte("tile"))
+	}
+	r, _ := newTestRouter(t, mc)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/coverage/check?bbox=-10,-10,10,10&z=1-2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data usecase.Coverage `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	got := resp.Data
+	if got.Total != 8 || got.Present != 5 || got.Missing != 3 || got.Truncated {
+		t.Fatalf("unexpected coverage %+v", got)
+	}
+	want := []tilemath.Tile{{Z: 2, X: 1, Y: 2}, {Z: 2, X: 2, Y: 1}, {Z: 2, X: 2, Y: 2}}
+	if !slices.Equal(got.MissingTiles, want) {
+		t.Fatalf("missing tiles %v, want %v", got.MissingTiles, want)
+	}
+}
+
+func TestCheckCoverage_InvalidQuery(t *testing.T) {
+	r, _ := newTestRouter(t, newTestMapCache())
+
+	for _, query := range []string{
+		"bbox=-10,-10,10,10",
+		"bbox=10,10,-10,-10&z=1",
+		"bbox=-10,-10,10,10&z=3-1",
+		"bbox=-10,-10,10,10&z=31",
+		"bbox=-180,-85,180,85&z=18",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/coverage/check?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
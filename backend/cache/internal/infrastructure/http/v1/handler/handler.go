@@ -1,10 +1,13 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	tilecache "github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
 	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
 )
 
@@ -22,6 +25,10 @@ type response struct {
 type Handler struct {
 	validate *validator.Validate
 	tileCacheUseCase *usecase.TileCacheUseCase
+	healthChecks []HealthCheck
+	// hits and misses count the tile lookups answered since start
+	hits   atomic.Int64
+	misses atomic.Int64
 }
 
 func NewHandler(v *validator.Validate, uc *usecase.TileCacheUseCase) *Handler {
@@ -35,6 +42,25 @@ func (h *Handler) RespondWithInternalServerError(c *gin.Context) {
 	h.RespondWithJSON(c, http.StatusInternalServerError, internalServerErrorText, nil)
 }
 
+// RespondWithCacheError answers a failed cache operation, with 504 when the
+// backend did not answer in time and 501 when it cannot hold the tile's
+// layer.
+func (h *Handler) RespondWithCacheError(c *gin.Context, err error) {
+	if errors.Is(err, usecase.ErrBackendTimeout) {
+		h.RespondWithJSON(c, http.StatusGatewayTimeout, "cache backend timed out", nil)
+		return
+	}
+	if errors.Is(err, tilecache.ErrLayerUnsupported) {
+		h.RespondWithJSON(c, http.StatusNotImplemented, err.Error(), nil)
+		return
+	}
+	h.RespondWithInternalServerError(c)
+}
+
+func (h *Handler) MethodNotAllowed(c *gin.Context) {
+	h.RespondWithJSON(c, http.StatusMethodNotAllowed, "method not allowed", nil)
+}
+
 func (h *Handler) RespondWithJSON(c *gin.Context, code int, message string, data any) {
 	success := code < 400
 
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	tilecache "github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/config"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+// newTestRouter wires a handler over tc the way v1.NewRouter does, without
+// request logging or telemetry.
+func newTestRouter(t *testing.T, tc tilecache.TileCache) (*gin.Engine, *Handler) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	l := logger.NewZapLogger(config.Logger{Level: "ERROR"})
+
+	h := NewHandler(validator.New(), usecase.NewTileCacheUseCase(tc, l))
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("logger", l)
+		c.Next()
+	})
+	v1 := r.Group("/api/v1")
+	v1.GET("/tile/:z/:x/:y", h.Tile)
+	v1.POST("/tile/:z/:x/:y", h.StoreTile)
+	v1.DELETE("/tile/:z/:x/:y", h.DeleteTile)
+	v1.GET("/tile/:z/:x/:y/meta", h.TileMeta)
+	v1.GET("/tile/:z/:x/:y/raw", h.RawTile)
+	v1.GET("/layers/:layer/tile/:z/:x/:y", h.Tile)
+	v1.POST("/layers/:layer/tile/:z/:x/:y", h.StoreTile)
+	v1.DELETE("/layers/:layer/tile/:z/:x/:y", h.DeleteTile)
+	v1.GET("/layers/:layer/tile/:z/:x/:y/raw", h.RawTile)
+	v1.POST("/tiles/batch", h.TileBatch)
+	v1.GET("/coverage/check", h.CheckCoverage)
+	v1.POST("/cache/purge", h.PurgeTiles)
+	v1.GET("/cache/stats", h.CacheStats)
+	v1.POST("/admin/migration", h.StartMigration)
+	v1.GET("/admin/migration", h.MigrationStatus)
+	v1.GET("/admin/access", h.ExportAccess)
+	return r, h
+}
+
+func newTestMapCache() *tilecache.MapCache {
+	return tilecache.NewMapCache(logger.NewZapLogger(config.Logger{Level: "ERROR"}))
+}
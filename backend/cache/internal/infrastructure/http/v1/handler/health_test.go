@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthz_ListsDependencies(t *testing.T) {
+	tests := []struct {
+		name       string
+		failing    string
+		wantCode   int
+		wantStatus string
+	}{
+		{name: "healthy", wantCode: http.StatusOK, wantStatus: "ok"},
+		{name: "dependency down", failing: "replica", wantCode: http.StatusServiceUnavailable, wantStatus: "degraded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, h := newTestRouter(t, newTestMapCache())
+			r.GET("/api/v1/healthz", h.Healthz)
+			h.AddHealthCheck("cache", h.tileCacheUseCase.CheckBackend)
+			h.AddHealthCheck("replica", func(context.Context) error {
+				if tt.failing == "replica" {
+					return errors.New("connection refused")
+				}
+				return nil
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/healthz", nil))
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			var resp healthResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to parse response: %v", err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("expected status %q, got %q", tt.wantStatus, resp.Status)
+			}
+			if len(resp.Checks) != 2 || resp.Checks[0].Name != "cache" || resp.Checks[1].Name != "replica" {
+				t.Fatalf("expected the cache and replica checks in order, got %+v", resp.Checks)
+			}
+			for _, dep := range resp.Checks {
+				want := "ok"
+				if dep.Name == tt.failing {
+					want = "down"
+				}
+				if dep.Status != want {
+					t.Errorf("%s: expected status %q, got %q", dep.Name, want, dep.Status)
+				}
+			}
+			if tt.failing != "" && resp.Checks[1].Error != "connection refused" {
+				t.Errorf("expected the failure to be reported, got %q", resp.Checks[1].Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/cache/internal/infrastructure/http/v1/dto"
+	tilecache "github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+)
+
+// TileSourceHeader carries the upstream URL of a stored tile, and
+// TileETagHeader and TileLastModifiedHeader the validators upstream served
+// it with.
+const (
+	TileSourceHeader       = "X-Tile-Source"
+	TileETagHeader         = "X-Tile-ETag"
+	TileLastModifiedHeader = "X-Tile-Last-Modified"
+)
+
+// TileMeta returns the metadata of a cached tile, including where it was
+// fetched from, without its data.
+func (h *Handler) TileMeta(c *gin.Context) {
+	log, _ := c.Get("logger")
+	l := log.(*logger.ZapLogger)
+
+	key, ok := tileKey(c, l)
+	if !ok {
+		return
+	}
+
+	data, meta, exists, err := h.tileCacheUseCase.GetCachedTileAt(key)
+	if err != nil {
+		l.Error("failed to get cached tile metadata", "z", key.Z, "x", key.X, "y", key.Y, "layer", key.Layer, "error", err)
+		h.RespondWithCacheError(c, err)
+		return
+	}
+
+	resp := dto.TileMetaResponse{
+		Exists:   exists,
+		NotFound: meta.NotFound,
+	}
+	if exists {
+		resp.Size = len(data)
+		resp.ETag = meta.ETag
+		resp.ContentType = meta.ContentType
+		resp.Source = meta.Source
+		resp.UpstreamETag = meta.UpstreamETag
+		if !meta.StoredAt.IsZero() {
+			resp.StoredAt = &meta.StoredAt
+		}
+		if !meta.LastModified.IsZero() {
+			resp.LastModified = &meta.LastModified
+		}
+	}
+
+	h.RespondWithJSON(c, http.StatusOK, "got tile metadata", resp)
+}
+
+// tileParams parses the z, x and y route parameters, answering 400 for the
+// first invalid one.
+func tileParams(c *gin.Context, l logger.Logger) (z, x, y int, ok bool) {
+	var coords [3]int
+	for i, name := range []string{"z", "x", "y"} {
+		value := c.Param(name)
+		coord, err := tilemath.ParseCoord(value)
+		if err != nil {
+			l.Error("invalid "+name+" parameter", "value", value, "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": name + " should be a non-negative integer without leading zeros",
+			})
+			return 0, 0, 0, false
+		}
+		coords[i] = coord
+	}
+	return coords[0], coords[1], coords[2], true
+}
+
+// tileKey parses the layer and tile route parameters into a cache key,
+// answering 400 for the first invalid one. Routes without a layer parameter
+// address the default layer.
+func tileKey(c *gin.Context, l logger.Logger) (tilecache.TileCacheKey, bool) {
+	layer := c.Param("layer")
+	if layer != "" {
+		if err := tilemath.ValidateLayer(layer); err != nil {
+			l.Error("invalid layer parameter", "value", layer, "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "layer should be lowercase letters, digits and dashes, starting with a letter",
+			})
+			return tilecache.TileCacheKey{}, false
+		}
+	}
+
+	z, x, y, ok := tileParams(c, l)
+	if !ok {
+		return tilecache.TileCacheKey{}, false
+	}
+	return tilecache.TileCacheKey{X: x, Y: y, Z: z, Layer: layer}, true
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/infrastructure/http/v1/dto"
+	tilecache "github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+)
+
+func TestTileMeta_ReturnsStoredSource(t *testing.T) {
+	r, _ := newTestRouter(t, tilecache.NewEnvelopeCache(newTestMapCache(), tilecache.EnvelopeCodec{}))
+	const source = "https://tile.openstreetmap.org/5/10/12.png"
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tile/5/10/12", strings.NewReader("png"))
+	req.Header.Set(TileSourceHeader, source)
+	req.Header.Set(TileETagHeader, `"upstream-1"`)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("store: expected 200, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/5/10/12/meta", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data dto.TileMetaResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !resp.Data.Exists || resp.Data.Size != 3 || resp.Data.Source != source || resp.Data.UpstreamETag != `"upstream-1"` {
+		t.Fatalf("expected the tile's metadata with its source, got %+v", resp.Data)
+	}
+	if strings.Contains(w.Body.String(), `"data":"`) {
+		t.Fatalf("expected no tile data, got %s", w.Body.String())
+	}
+}
+
+func TestTileMeta_Missing(t *testing.T) {
+	r, _ := newTestRouter(t, newTestMapCache())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/5/10/12/meta", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"exists":false`) {
+		t.Fatalf("expected a missing tile, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/cache/internal/infrastructure/http/v1/dto"
+	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+// StartMigration starts copying the cache into another backend, which
+// takes over once every tile was copied.
+func (h *Handler) StartMigration(c *gin.Context) {
+	log, _ := c.Get("logger")
+	l := log.(*logger.ZapLogger)
+
+	var req dto.MigrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		l.Warn("invalid migration request", "error", err)
+		h.RespondWithJSON(c, http.StatusBadRequest, ErrFailedToDecodeRequestBody.Error(), nil)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		h.RespondWithJSON(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	err := h.tileCacheUseCase.StartMigration(req.Destination)
+	switch {
+	case errors.Is(err, usecase.ErrMigrationDisabled):
+		h.RespondWithJSON(c, http.StatusNotImplemented, err.Error(), nil)
+		return
+	case errors.Is(err, usecase.ErrMigrationRunning):
+		h.RespondWithJSON(c, http.StatusConflict, err.Error(), h.tileCacheUseCase.MigrationStatus())
+		return
+	case errors.Is(err, usecase.ErrNotIterable):
+		h.RespondWithJSON(c, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	case err != nil:
+		l.Error("failed to start cache migration", "destination", req.Destination, "error", err)
+		h.RespondWithJSON(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	h.RespondWithJSON(c, http.StatusAccepted, "migration started", h.tileCacheUseCase.MigrationStatus())
+}
+
+// MigrationStatus reports the progress of the running or last migration.
+func (h *Handler) MigrationStatus(c *gin.Context) {
+	h.RespondWithJSON(c, http.StatusOK, "migration status", h.tileCacheUseCase.MigrationStatus())
+}
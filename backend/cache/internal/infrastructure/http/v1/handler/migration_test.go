@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tilecache "github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
+)
+
+func TestMigration(t *testing.T) {
+	src := newTestMapCache()
+	src.Set(tilecache.TileCacheKey{Z: 3, X: 1, Y: 2}, []byte("tile"))
+	dst := newTestMapCache()
+	current := tilecache.NewSwappableCache(src)
+	r, h := newTestRouter(t, current)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/admin/migration", strings.NewReader(body)))
+		return w
+	}
+
+	if w := post(`{"destination":"fresh"}`); w.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501 before migrations are enabled, got %d", w.Code)
+	}
+
+	h.tileCacheUseCase.EnableMigration(context.Background(), usecase.MigrationConfig{
+		Backend: current,
+		Open: func(name string) (tilecache.TileCache, error) {
+			if name != "fresh" {
+				return nil, errors.New("unknown cache backend")
+			}
+			return dst, nil
+		},
+	})
+
+	if w := post(`{}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a destination, got %d", w.Code)
+	}
+	if w := post(`{"destination":"other"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown destination, got %d", w.Code)
+	}
+	if w := post(`{"destination":"fresh"}`); w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	h.tileCacheUseCase.WaitForMigration()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/migration", nil))
+	var resp struct {
+		Data usecase.MigrationStatus `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Data.State != usecase.MigrationDone || resp.Data.Destination != "fresh" || resp.Data.Copied != 1 {
+		t.Fatalf("unexpected status %+v", resp.Data)
+	}
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/cache/internal/infrastructure/http/v1/dto"
+	tilecache "github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+)
+
+// PurgeTiles removes every cached tile in a zoom range, optionally limited
+// to a bounding box, and reports how many were removed.
+func (h *Handler) PurgeTiles(c *gin.Context) {
+	log, _ := c.Get("logger")
+	l := log.(*logger.ZapLogger)
+
+	var req dto.PurgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		l.Warn("invalid purge request", "error", err)
+		h.RespondWithJSON(c, http.StatusBadRequest, ErrFailedToDecodeRequestBody.Error(), nil)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		h.RespondWithJSON(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	filter := tilecache.PurgeFilter{MinZ: *req.MinZ, MaxZ: *req.MaxZ}
+	if req.BBox != "" {
+		bbox, err := tilemath.ParseBBox(req.BBox)
+		if err != nil {
+			h.RespondWithJSON(c, http.StatusBadRequest, "bbox should be west,south,east,north in degrees", nil)
+			return
+		}
+		filter.BBox = &bbox
+	}
+
+	removed, err := h.tileCacheUseCase.PurgeTiles(filter, usecase.Origin{Actor: c.ClientIP()})
+	switch {
+	case errors.Is(err, usecase.ErrInvalidZoom):
+		h.RespondWithJSON(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	case errors.Is(err, usecase.ErrPurgeUnsupported):
+		h.RespondWithJSON(c, http.StatusNotImplemented, err.Error(), nil)
+		return
+	case err != nil:
+		l.Error("failed to purge tiles", "removed", removed, "error", err)
+		h.RespondWithCacheError(c, err)
+		return
+	}
+
+	h.RespondWithJSON(c, http.StatusOK, "tiles purged", dto.PurgeResponse{Removed: removed})
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tilecache "github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+)
+
+func TestPurgeTiles(t *testing.T) {
+	mc := newTestMapCache()
+	// x,y in 1..2 cover the box at zoom 2
+	inside := []tilecache.TileCacheKey{{Z: 2, X: 1, Y: 1}, {Z: 2, X: 2, Y: 2}}
+	outside := []tilecache.TileCacheKey{{Z: 2, X: 0, Y: 0}, {Z: 1, X: 0, Y: 0}, {Z: 3, X: 3, Y: 3}}
+	for _, k := range append(inside, outside...) {
+		mc.Set(k, []byte("tile"))
+	}
+	r, _ := newTestRouter(t, mc)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/cache/purge",
+		strings.NewReader(`{"minZ": 2, "maxZ": 2, "bbox": "-10,-10,10,10"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			Removed int64 `json:"removed"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Data.Removed != int64(len(inside)) {
+		t.Fatalf("removed %d tiles, want %d", resp.Data.Removed, len(inside))
+	}
+	for _, k := range inside {
+		if _, exists, _ := mc.Get(k); exists {
+			t.Errorf("tile %v should be purged", k)
+		}
+	}
+	for _, k := range outside {
+		if _, exists, _ := mc.Get(k); !exists {
+			t.Errorf("tile %v should be kept", k)
+		}
+	}
+}
+
+func TestPurgeTiles_WholeZoomLevels(t *testing.T) {
+	mc := newTestMapCache()
+	for _, k := range []tilecache.TileCacheKey{{Z: 0, X: 0, Y: 0}, {Z: 1, X: 1, Y: 0}, {Z: 2, X: 3, Y: 3}} {
+		mc.Set(k, []byte("tile"))
+	}
+	r, _ := newTestRouter(t, mc)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/cache/purge", strings.NewReader(`{"minZ": 0, "maxZ": 1}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"removed":2`) {
+		t.Fatalf("expected two tiles removed, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, exists, _ := mc.Get(tilecache.TileCacheKey{Z: 2, X: 3, Y: 3}); !exists {
+		t.Fatal("zoom 2 should be kept")
+	}
+}
+
+func TestPurgeTiles_RejectsInvalidRequests(t *testing.T) {
+	r, _ := newTestRouter(t, newTestMapCache())
+
+	for _, body := range []string{
+		`{"maxZ": 2}`,
+		`{"minZ": 3, "maxZ": 2}`,
+		`{"minZ": 0, "maxZ": 31}`,
+		`{"minZ": 0, "maxZ": 2, "bbox": "10,10,-10,-10"}`,
+		`not json`,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/cache/purge", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestPurgeTiles_Unsupported(t *testing.T) {
+	// Embedding only TileCache hides the map's Iterate and Delete
+	r, _ := newTestRouter(t, struct{ tilecache.TileCache }{newTestMapCache()})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/cache/purge", strings.NewReader(`{"minZ": 0, "maxZ": 30}`)))
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501, got %d", w.Code)
+	}
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+// TileStoredAtHeader carries when a raw tile was stored, in RFC 3339 with
+// nanoseconds. TileNotFoundHeader marks a 404 for a tile recorded as
+// missing upstream, as opposed to one that is not cached.
+const (
+	TileStoredAtHeader = "X-Tile-Stored-At"
+	TileNotFoundHeader = "X-Tile-Not-Found"
+)
+
+// defaultTileContentType is served for tiles stored without a content type
+const defaultTileContentType = "image/png"
+
+// RawTile serves the tile data itself rather than base64 in JSON, answering
+// 404 for tiles that are not cached.
+func (h *Handler) RawTile(c *gin.Context) {
+	log, _ := c.Get("logger")
+	l := log.(*logger.ZapLogger)
+
+	key, ok := tileKey(c, l)
+	if !ok {
+		return
+	}
+
+	data, meta, exists, err := h.tileCacheUseCase.GetCachedTileAt(key)
+	if err != nil {
+		l.Error("failed to get cached tile", "z", key.Z, "x", key.X, "y", key.Y, "layer", key.Layer, "error", err)
+		h.RespondWithCacheError(c, err)
+		return
+	}
+	h.CountLookup(exists)
+
+	if !exists {
+		if meta.NotFound {
+			c.Header(TileNotFoundHeader, "true")
+		}
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	// A tile without upstream validators last changed when it was stored
+	lastModified := meta.LastModified
+	if lastModified.IsZero() {
+		lastModified = meta.StoredAt
+	}
+	c.Header("ETag", meta.ETag)
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if !meta.StoredAt.IsZero() {
+		c.Header(TileStoredAtHeader, meta.StoredAt.UTC().Format(time.RFC3339Nano))
+	}
+	if notModified(c.Request, meta.ETag, lastModified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	contentType := meta.ContentType
+	if contentType == "" {
+		contentType = defaultTileContentType
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tilecache "github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+)
+
+func TestRawTile(t *testing.T) {
+	r, _ := newTestRouter(t, tilecache.NewEnvelopeCache(newTestMapCache(), tilecache.EnvelopeCodec{}))
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/tile/5/10/12", bytes.NewReader(png)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("store: expected 200, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/5/10/12/raw", nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), png) {
+		t.Fatalf("expected the tile bytes, got %d %q", w.Code, w.Body.Bytes())
+	}
+	if got := w.Header().Get("Content-Type"); got != "image/png" {
+		t.Errorf("Content-Type = %q, want image/png", got)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, w.Header().Get(TileStoredAtHeader)); err != nil {
+		t.Errorf("invalid %s header: %v", TileStoredAtHeader, err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/tile/5/10/12/raw", nil)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("expected 304 without a body, got %d", w.Code)
+	}
+}
+
+func TestRawTile_Missing(t *testing.T) {
+	r, _ := newTestRouter(t, tilecache.NewEnvelopeCache(newTestMapCache(), tilecache.EnvelopeCodec{}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/5/10/12/raw", nil))
+	if w.Code != http.StatusNotFound || w.Header().Get(TileNotFoundHeader) != "" {
+		t.Fatalf("expected a plain 404 for a miss, got %d %v", w.Code, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/tile/5/10/13?not_found=true", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("store: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/5/10/13/raw", nil))
+	if w.Code != http.StatusNotFound || w.Header().Get(TileNotFoundHeader) != "true" {
+		t.Fatalf("expected a 404 marked as missing upstream, got %d %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/cache/internal/infrastructure/http/v1/dto"
+	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+// CacheStats reports how many tiles the cache holds and their size, overall
+// and per zoom level, together with the hit ratio of the tile lookups this
+// instance answered since it started.
+func (h *Handler) CacheStats(c *gin.Context) {
+	log, _ := c.Get("logger")
+	l := log.(*logger.ZapLogger)
+
+	backend, stats, err := h.tileCacheUseCase.Stats()
+	switch {
+	case errors.Is(err, usecase.ErrStatsUnsupported):
+		h.RespondWithJSON(c, http.StatusNotImplemented, err.Error(), nil)
+		return
+	case err != nil:
+		l.Error("failed to collect cache stats", "error", err)
+		h.RespondWithCacheError(c, err)
+		return
+	}
+
+	resp := dto.CacheStatsResponse{
+		Backend: backend,
+		Tiles:   stats.Tiles,
+		Bytes:   stats.Bytes,
+		Zooms:   make([]dto.ZoomStats, 0, len(stats.Zooms)),
+		Hits:    h.hits.Load(),
+		Misses:  h.misses.Load(),
+	}
+	for z, zs := range stats.Zooms {
+		resp.Zooms = append(resp.Zooms, dto.ZoomStats{Z: z, Tiles: zs.Tiles, Bytes: zs.Bytes})
+	}
+	sort.Slice(resp.Zooms, func(i, j int) bool { return resp.Zooms[i].Z < resp.Zooms[j].Z })
+	if lookups := resp.Hits + resp.Misses; lookups > 0 {
+		resp.HitRatio = float64(resp.Hits) / float64(lookups)
+	}
+
+	h.RespondWithJSON(c, http.StatusOK, "cache stats", resp)
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/infrastructure/http/v1/dto"
+	tilecache "github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+)
+
+func TestCacheStats(t *testing.T) {
+	mc := newTestMapCache()
+	mc.Set(tilecache.TileCacheKey{Z: 1, X: 0, Y: 0}, []byte("abc"))
+	mc.Set(tilecache.TileCacheKey{Z: 1, X: 1, Y: 0}, []byte("de"))
+	mc.Set(tilecache.TileCacheKey{Z: 3, X: 2, Y: 5}, []byte("fghij"))
+	r, _ := newTestRouter(t, mc)
+
+	// three hits and one miss
+	for _, path := range []string{"/api/v1/tile/1/0/0", "/api/v1/tile/1/1/0", "/api/v1/tile/3/2/5", "/api/v1/tile/4/0/0"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/cache/stats", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data dto.CacheStatsResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	got := resp.Data
+	if got.Tiles != 3 || got.Bytes != 10 {
+		t.Errorf("tiles = %d, bytes = %d, want 3 and 10", got.Tiles, got.Bytes)
+	}
+	want := []dto.ZoomStats{{Z: 1, Tiles: 2, Bytes: 5}, {Z: 3, Tiles: 1, Bytes: 5}}
+	if len(got.Zooms) != len(want) {
+		t.Fatalf("zooms = %+v, want %+v", got.Zooms, want)
+	}
+	for i := range want {
+		if got.Zooms[i] != want[i] {
+			t.Errorf("zoom %d = %+v, want %+v", i, got.Zooms[i], want[i])
+		}
+	}
+	if got.Hits != 3 || got.Misses != 1 || got.HitRatio != 0.75 {
+		t.Errorf("hits = %d, misses = %d, ratio = %v, want 3, 1 and 0.75", got.Hits, got.Misses, got.HitRatio)
+	}
+}
+
+func TestCacheStats_Unsupported(t *testing.T) {
+	// Embedding only TileCache hides the map's Iterate
+	r, _ := newTestRouter(t, struct{ tilecache.TileCache }{newTestMapCache()})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/cache/stats", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501, got %d", w.Code)
+	}
+}
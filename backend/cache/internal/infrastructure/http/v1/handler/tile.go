@@ -1,12 +1,15 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
-	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jaennil/guide_helper/backend/cache/internal/infrastructure/http/v1/dto"
+	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
 	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
 	"github.com/jaennil/guide_helper/backend/cache/pkg/metrics"
 )
@@ -17,54 +20,53 @@ func (h *Handler) Tile(c *gin.Context) {
 	log, _ := c.Get("logger")
 	l := log.(*logger.ZapLogger)
 
-	strX := c.Param("x")
-	strY := c.Param("y")
-	strZ := c.Param("z")
-
-	x, err := strconv.Atoi(strX)
-	if err != nil {
-		l.Error("invalid x parameter", "value", strX, "error", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "x should be integer",
-		})
+	key, ok := tileKey(c, l)
+	if !ok {
 		return
 	}
+	z, x, y := key.Z, key.X, key.Y
 
-	y, err := strconv.Atoi(strY)
+	data, meta, exists, err := h.tileCacheUseCase.GetCachedTileAt(key)
 	if err != nil {
-		l.Error("invalid y parameter", "value", strY, "error", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "y should be integer",
-		})
+		l.Error("failed to get cached tile", "z", z, "x", x, "y", y, "layer", key.Layer, "error", err)
+		h.RespondWithCacheError(c, err)
 		return
 	}
 
-	z, err := strconv.Atoi(strZ)
-	if err != nil {
-		l.Error("invalid z parameter", "value", strZ, "error", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "z should be integer",
-		})
-		return
-	}
-
-	data, exists, err := h.tileCacheUseCase.GetCachedTile(x, y, z)
-	if err != nil {
-		l.Error("failed to get cached tile", "z", z, "x", x, "y", y, "error", err)
-		h.RespondWithInternalServerError(c)
-		return
+	if exists {
+		l.Info("returned cached tile")
 	}
+	h.CountLookup(exists)
 
 	if exists {
-		l.Info("returned cached tile")
-		metrics.CacheHits.Inc()
-	} else {
-		metrics.CacheMisses.Inc()
+		// A tile without upstream validators last changed when it was stored
+		lastModified := meta.LastModified
+		if lastModified.IsZero() {
+			lastModified = meta.StoredAt
+		}
+		c.Header("ETag", meta.ETag)
+		if !lastModified.IsZero() {
+			c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+		}
+		if notModified(c.Request, meta.ETag, lastModified) {
+			c.Status(http.StatusNotModified)
+			return
+		}
 	}
 
 	resp := dto.TileCacheResponse {
 		Data: data,
 		Exists: exists,
+		ETag: meta.ETag,
+		ContentType: meta.ContentType,
+		NotFound: meta.NotFound,
+		UpstreamETag: meta.UpstreamETag,
+	}
+	if exists && !meta.StoredAt.IsZero() {
+		resp.StoredAt = &meta.StoredAt
+	}
+	if exists && !meta.LastModified.IsZero() {
+		resp.LastModified = &meta.LastModified
 	}
 
 	h.RespondWithJSON(c, http.StatusOK, "got tile", resp)
@@ -74,34 +76,22 @@ func (h *Handler) StoreTile(c *gin.Context) {
 	log, _ := c.Get("logger")
 	l := log.(*logger.ZapLogger)
 
-	strX := c.Param("x")
-	strY := c.Param("y")
-	strZ := c.Param("z")
-
-	x, err := strconv.Atoi(strX)
-	if err != nil {
-		l.Error("invalid x parameter", "value", strX, "error", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "x should be integer",
-		})
+	key, ok := tileKey(c, l)
+	if !ok {
 		return
 	}
-
-	y, err := strconv.Atoi(strY)
-	if err != nil {
-		l.Error("invalid y parameter", "value", strY, "error", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "y should be integer",
-		})
-		return
-	}
-
-	z, err := strconv.Atoi(strZ)
-	if err != nil {
-		l.Error("invalid z parameter", "value", strZ, "error", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "z should be integer",
-		})
+	z, x, y := key.Z, key.X, key.Y
+
+	// "?not_found=true" records that upstream has no such tile
+	if c.Query("not_found") == "true" {
+		l.Info("storing missing tile", "z", z, "x", x, "y", y, "layer", key.Layer)
+		if err := h.tileCacheUseCase.CacheNotFoundAt(key, usecase.Origin{Actor: c.ClientIP()}); err != nil {
+			l.Error("failed to cache missing tile", "error", err)
+			h.RespondWithCacheError(c, err)
+			return
+		}
+		metrics.CacheStores.Inc()
+		h.RespondWithJSON(c, http.StatusOK, "missing tile stored", nil)
 		return
 	}
 
@@ -115,12 +105,30 @@ func (h *Handler) StoreTile(c *gin.Context) {
 		return
 	}
 
-	l.Info("storing tile", "z", z, "x", x, "y", y, "size", len(tileData))
+	l.Info("storing tile", "z", z, "x", x, "y", y, "layer", key.Layer, "size", len(tileData))
 
-	err = h.tileCacheUseCase.CacheTile(x, y, z, tileData)
+	// Stores of tiles instances report the upstream URL the tile came from
+	// and the validators it was served with
+	origin := usecase.Origin{
+		Actor:  c.ClientIP(),
+		Source: c.GetHeader(TileSourceHeader),
+		ETag:   c.GetHeader(TileETagHeader),
+	}
+	if value := c.GetHeader(TileLastModifiedHeader); value != "" {
+		lastModified, err := http.ParseTime(value)
+		if err != nil {
+			l.Warn("ignoring invalid last modified header", "value", value, "error", err)
+		}
+		origin.LastModified = lastModified
+	}
+	err = h.tileCacheUseCase.CacheTileAt(key, tileData, origin)
+	if errors.Is(err, usecase.ErrTileRejected) {
+		h.RespondWithJSON(c, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
 	if err != nil {
 		l.Error("failed to cache tile", "error", err)
-		h.RespondWithInternalServerError(c)
+		h.RespondWithCacheError(c, err)
 		return
 	}
 
@@ -128,3 +136,60 @@ func (h *Handler) StoreTile(c *gin.Context) {
 	h.RespondWithJSON(c, http.StatusOK, "tile stored", nil)
 }
 
+// DeleteTile drops the cached tile, e.g. after upstream re-rendered it.
+// Deleting a tile that is not cached succeeds.
+func (h *Handler) DeleteTile(c *gin.Context) {
+	log, _ := c.Get("logger")
+	l := log.(*logger.ZapLogger)
+
+	key, ok := tileKey(c, l)
+	if !ok {
+		return
+	}
+
+	l.Info("deleting tile", "z", key.Z, "x", key.X, "y", key.Y, "layer", key.Layer)
+	err := h.tileCacheUseCase.DeleteTile(key, usecase.Origin{Actor: c.ClientIP()})
+	if errors.Is(err, usecase.ErrDeleteUnsupported) {
+		h.RespondWithJSON(c, http.StatusNotImplemented, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		l.Error("failed to delete tile", "error", err)
+		h.RespondWithCacheError(c, err)
+		return
+	}
+
+	h.RespondWithJSON(c, http.StatusOK, "tile deleted", nil)
+}
+
+// notModified evaluates the request's conditional headers against the tile.
+// If-Modified-Since is only considered without If-None-Match, as RFC 9110
+// specifies.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, etag)
+	}
+	if lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// etagMatches reports whether an If-None-Match header lists etag. Weak
+// validators match too, as If-None-Match uses weak comparison.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
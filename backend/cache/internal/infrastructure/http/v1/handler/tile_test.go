@@ -0,0 +1,286 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/infrastructure/http/v1/dto"
+	tilecache "github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+)
+
+func TestStoreTile_RejectsNonCanonicalCoordinates(t *testing.T) {
+	r, _ := newTestRouter(t, newTestMapCache())
+
+	for _, path := range []string{"/api/v1/tile/05/10/12", "/api/v1/tile/5/+10/12", "/api/v1/tile/5/10/-12"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader("png")))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", path, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/tile/5/10/12", strings.NewReader("png")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a canonical key, got %d", w.Code)
+	}
+}
+
+func TestTile_ConditionalRequest(t *testing.T) {
+	r, _ := newTestRouter(t, tilecache.NewEnvelopeCache(newTestMapCache(), tilecache.EnvelopeCodec{}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/tile/5/10/12", strings.NewReader("png")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("store: expected 200, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/5/10/12", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag != tilecache.ContentETag([]byte("png")) {
+		t.Fatalf("expected 200 with the content ETag, got %d and %q", w.Code, etag)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/tile/5/10/12", nil)
+	req.Header.Set("If-None-Match", `"other", `+etag)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for a matching ETag, got %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Fatalf("expected an empty body, got %q", w.Body.String())
+	}
+}
+
+func TestTile_UpstreamValidators(t *testing.T) {
+	r, _ := newTestRouter(t, tilecache.NewEnvelopeCache(newTestMapCache(), tilecache.EnvelopeCodec{}))
+	const lastModified = "Thu, 01 Oct 2026 08:30:00 GMT"
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tile/5/10/12", strings.NewReader("png"))
+	req.Header.Set(TileETagHeader, `"upstream-1"`)
+	req.Header.Set(TileLastModifiedHeader, lastModified)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("store: expected 200, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/5/10/12", nil))
+	if got := w.Header().Get("Last-Modified"); got != lastModified {
+		t.Fatalf("expected the upstream Last-Modified, got %q", got)
+	}
+	var resp struct {
+		Data dto.TileCacheResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Data.UpstreamETag != `"upstream-1"` || resp.Data.LastModified == nil ||
+		resp.Data.LastModified.UTC().Format(http.TimeFormat) != lastModified {
+		t.Fatalf("expected the upstream validators, got %+v", resp.Data)
+	}
+
+	for since, want := range map[string]int{
+		lastModified:                    http.StatusNotModified,
+		"Fri, 02 Oct 2026 00:00:00 GMT": http.StatusNotModified,
+		"Wed, 30 Sep 2026 00:00:00 GMT": http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/tile/5/10/12", nil)
+		req.Header.Set("If-Modified-Since", since)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Fatalf("If-Modified-Since %s: expected %d, got %d", since, want, w.Code)
+		}
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/tile/5/10/12", nil)
+	req.Header.Set("If-None-Match", `"other"`)
+	req.Header.Set("If-Modified-Since", lastModified)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a non-matching ETag, got %d", w.Code)
+	}
+}
+
+func TestStoreTile_NotFound(t *testing.T) {
+	r, _ := newTestRouter(t, newTestMapCache())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/tile/3/1/2?not_found=true", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/3/1/2", nil))
+	var resp struct {
+		Data dto.TileCacheResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Data.Exists || !resp.Data.NotFound || resp.Data.Data != nil {
+		t.Fatalf("expected a missing tile without data, got %+v", resp.Data)
+	}
+}
+
+func TestTile_ReportsStoredContentType(t *testing.T) {
+	r, _ := newTestRouter(t, tilecache.NewEnvelopeCache(newTestMapCache(), tilecache.EnvelopeCodec{}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/tile/5/10/12", strings.NewReader("GIF89a tile")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("store: expected 200, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/5/10/12", nil))
+	var resp struct {
+		Data dto.TileCacheResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Data.ContentType != "image/gif" {
+		t.Fatalf("expected the stored content type, got %q", resp.Data.ContentType)
+	}
+}
+
+// slowCache holds every Get for delay.
+type slowCache struct {
+	tilecache.TileCache
+	delay time.Duration
+}
+
+func (c *slowCache) Get(k tilecache.TileCacheKey) (tilecache.TileCacheValue, bool, error) {
+	time.Sleep(c.delay)
+	return c.TileCache.Get(k)
+}
+
+func TestTile_BackendTimeout(t *testing.T) {
+	r, h := newTestRouter(t, &slowCache{TileCache: newTestMapCache(), delay: time.Second})
+	h.tileCacheUseCase.OperationTimeout(20 * time.Millisecond)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/5/10/12", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504, got %d", w.Code)
+	}
+}
+
+func TestDeleteTile(t *testing.T) {
+	r, _ := newTestRouter(t, newTestMapCache())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/tile/5/10/12", strings.NewReader("png")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("store: expected 200, got %d", w.Code)
+	}
+
+	// Deleting twice succeeds, the second time there is nothing to delete
+	for range 2 {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/tile/5/10/12", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("delete: expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/5/10/12", nil))
+	if !strings.Contains(w.Body.String(), `"exists":false`) {
+		t.Fatalf("expected the tile to be gone, got %s", w.Body.String())
+	}
+}
+
+func TestDeleteTile_Unsupported(t *testing.T) {
+	// Embedding only TileCache hides the map's Delete
+	r, _ := newTestRouter(t, struct{ tilecache.TileCache }{newTestMapCache()})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/tile/5/10/12", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/tile/5/010/12", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a non-canonical key, got %d", w.Code)
+	}
+}
+
+func TestTile_Layers(t *testing.T) {
+	r, _ := newTestRouter(t, tilecache.NewEnvelopeCache(newTestMapCache(), tilecache.EnvelopeCodec{}))
+
+	for path, body := range map[string]string{
+		"/api/v1/tile/5/10/12":                "osm",
+		"/api/v1/layers/cyclosm/tile/5/10/12": "cyclosm",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("store %s: expected 200, got %d", path, w.Code)
+		}
+	}
+
+	for path, want := range map[string]string{
+		"/api/v1/tile/5/10/12/raw":                "osm",
+		"/api/v1/layers/cyclosm/tile/5/10/12/raw": "cyclosm",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Fatalf("GET %s: expected %q, got %d %q", path, want, w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/layers/cyclosm/tile/5/10/12", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/5/10/12/raw", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("deleting a layer's tile removed the default one: %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/layers/CycloSM/tile/5/10/12", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid layer, got %d", w.Code)
+	}
+}
+
+// defaultLayerCache holds the default layer only, like an MBTiles file.
+type defaultLayerCache struct {
+	tilecache.TileCache
+}
+
+func (c defaultLayerCache) Get(k tilecache.TileCacheKey) (tilecache.TileCacheValue, bool, error) {
+	if k.Layer != "" {
+		return nil, false, tilecache.ErrLayerUnsupported
+	}
+	return c.TileCache.Get(k)
+}
+
+func TestTile_LayerUnsupported(t *testing.T) {
+	r, _ := newTestRouter(t, defaultLayerCache{newTestMapCache()})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/layers/cyclosm/tile/5/10/12", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501, got %d", w.Code)
+	}
+}
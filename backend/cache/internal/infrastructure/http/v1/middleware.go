@@ -0,0 +1,41 @@
+package v1
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// requireAPIKey rejects requests that do not carry one of the configured keys.
+// With no keys configured every request is rejected.
+func requireAPIKey(keys []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided := c.GetHeader(apiKeyHeader)
+		if provided == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "missing api key",
+			})
+			return
+		}
+
+		if !validAPIKey(keys, provided) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "invalid api key",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func validAPIKey(keys []string, provided string) bool {
+	for _, key := range keys {
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
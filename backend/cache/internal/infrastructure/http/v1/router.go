@@ -1,6 +1,8 @@
 package v1
 
 import (
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -10,7 +12,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func NewRouter(handler *handler.Handler, l logger.Logger, telemetryEnabled bool) *gin.Engine {
+func NewRouter(handler *handler.Handler, l logger.Logger, telemetryEnabled bool, apiKeys []string) *gin.Engine {
 	r := gin.Default()
 
 	r.Use(gin.Recovery())
@@ -22,12 +24,47 @@ func NewRouter(handler *handler.Handler, l logger.Logger, telemetryEnabled bool)
 
 	r.Use(ginZapLogger(l))
 
+	// Unsupported methods on known routes get 405, gin sets the Allow header
+	r.HandleMethodNotAllowed = true
+	r.NoMethod(handler.MethodNotAllowed)
+
 	api := r.Group("/api")
 	v1 := api.Group("/v1")
 
 	v1.GET("/healthz", handler.Healthz)
 	v1.GET("/tile/:z/:x/:y", handler.Tile)
+	v1.HEAD("/tile/:z/:x/:y", handler.Tile)
 	v1.POST("/tile/:z/:x/:y", handler.StoreTile)
+	v1.DELETE("/tile/:z/:x/:y", handler.DeleteTile)
+	v1.OPTIONS("/tile/:z/:x/:y", allow(http.MethodGet, http.MethodHead, http.MethodPost, http.MethodDelete))
+	v1.GET("/tile/:z/:x/:y/meta", handler.TileMeta)
+	v1.GET("/tile/:z/:x/:y/raw", handler.RawTile)
+	v1.HEAD("/tile/:z/:x/:y/raw", handler.RawTile)
+
+	// The same tile routes for a named layer, whose tiles are kept apart
+	// from the default layer's
+	layer := v1.Group("/layers/:layer")
+	layer.GET("/tile/:z/:x/:y", handler.Tile)
+	layer.HEAD("/tile/:z/:x/:y", handler.Tile)
+	layer.POST("/tile/:z/:x/:y", handler.StoreTile)
+	layer.DELETE("/tile/:z/:x/:y", handler.DeleteTile)
+	layer.OPTIONS("/tile/:z/:x/:y", allow(http.MethodGet, http.MethodHead, http.MethodPost, http.MethodDelete))
+	layer.GET("/tile/:z/:x/:y/meta", handler.TileMeta)
+	layer.GET("/tile/:z/:x/:y/raw", handler.RawTile)
+	layer.HEAD("/tile/:z/:x/:y/raw", handler.RawTile)
+
+	v1.POST("/tiles/batch", handler.TileBatch)
+	v1.OPTIONS("/tiles/batch", allow(http.MethodPost))
+	v1.GET("/coverage/check", handler.CheckCoverage)
+	v1.GET("/cache/stats", handler.CacheStats)
+
+	cache := v1.Group("/cache", requireAPIKey(apiKeys))
+	cache.POST("/purge", handler.PurgeTiles)
+
+	admin := v1.Group("/admin", requireAPIKey(apiKeys))
+	admin.POST("/migration", handler.StartMigration)
+	admin.GET("/migration", handler.MigrationStatus)
+	admin.GET("/access", handler.ExportAccess)
 
 	// Prometheus metrics endpoint
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
@@ -35,6 +72,15 @@ func NewRouter(handler *handler.Handler, l logger.Logger, telemetryEnabled bool)
 	return r
 }
 
+// allow answers OPTIONS with the methods a route supports.
+func allow(methods ...string) gin.HandlerFunc {
+	value := strings.Join(methods, ", ")
+	return func(c *gin.Context) {
+		c.Header("Allow", value)
+		c.Status(http.StatusNoContent)
+	}
+}
+
 func ginZapLogger(l logger.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Set("logger", l)
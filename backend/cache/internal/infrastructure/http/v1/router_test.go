@@ -0,0 +1,140 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/jaennil/guide_helper/backend/cache/internal/infrastructure/http/v1/handler"
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func TestRouter_OptionsListsAllowedMethods(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := logger.FromContext(context.Background())
+	h := handler.NewHandler(validator.New(), usecase.NewTileCacheUseCase(cache.NewMapCache(l), l))
+	r := NewRouter(h, l, false, nil)
+
+	tests := []struct {
+		path  string
+		allow string
+	}{
+		{"/api/v1/tile/1/2/3", "GET, HEAD, POST, DELETE"},
+		{"/api/v1/tiles/batch", "POST"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, tt.path, nil))
+
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%s: expected 204, got %d", tt.path, w.Code)
+		}
+		if got := w.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("%s: Allow = %q, want %q", tt.path, got, tt.allow)
+		}
+	}
+}
+
+func TestRoot_ServesAttribution(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", Root(RootConfig{Format: "text"}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if got := w.Body.String(); got != DefaultAttribution {
+		t.Fatalf("body = %q, want the attribution", got)
+	}
+}
+
+func TestRoot_JSONDescriptor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", Root(RootConfig{Format: "json", Service: "svc", Version: "1.2.3"}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if body["service"] != "svc" || body["version"] != "1.2.3" || body["attribution"] != DefaultAttribution {
+		t.Fatalf("unexpected descriptor %v", body)
+	}
+}
+
+func TestRouter_MethodNotAllowed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := logger.FromContext(context.Background())
+	h := handler.NewHandler(validator.New(), usecase.NewTileCacheUseCase(cache.NewMapCache(l), l))
+	r := NewRouter(h, l, false, nil)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/v1/tile/1/2/3", nil))
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", w.Code)
+	}
+	if got, want := w.Header().Get("Allow"), "GET, HEAD, POST, DELETE, OPTIONS"; got != want {
+		t.Fatalf("Allow = %q, want %q", got, want)
+	}
+	var body struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Success || body.Message == "" {
+		t.Fatalf("expected a json error body, got %q", w.Body.String())
+	}
+}
+
+func TestRouter_AdminRoutesRequireAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := logger.FromContext(context.Background())
+	h := handler.NewHandler(validator.New(), usecase.NewTileCacheUseCase(cache.NewMapCache(l), l))
+	r := NewRouter(h, l, false, []string{"secret"})
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/api/v1/admin/migration"},
+		{http.MethodGet, "/api/v1/admin/migration"},
+		{http.MethodGet, "/api/v1/admin/access"},
+		{http.MethodPost, "/api/v1/cache/purge"},
+	}
+	for _, route := range routes {
+		for key, want := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusForbidden} {
+			req := httptest.NewRequest(route.method, route.path, nil)
+			if key != "" {
+				req.Header.Set(apiKeyHeader, key)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != want {
+				t.Errorf("%s %s with key %q: expected %d, got %d", route.method, route.path, key, want, w.Code)
+			}
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/migration", nil)
+	req.Header.Set(apiKeyHeader, "secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 with a valid key, got %d: %s", w.Code, w.Body.String())
+	}
+}
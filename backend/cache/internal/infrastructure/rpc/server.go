@@ -0,0 +1,198 @@
+// Package rpc serves the cache over gRPC, next to the HTTP API, for tiles
+// instances that want tile data without base64 encoding.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	tilecache "github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/cacherpc"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/metrics"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements cacherpc.TileCacheServiceServer with the same use case,
+// and the same metrics and audit trail, as the HTTP handlers.
+type Server struct {
+	cacherpc.UnimplementedTileCacheServiceServer
+	tileCacheUseCase *usecase.TileCacheUseCase
+	// countLookup records a tile lookup, e.g. for the stats endpoint
+	countLookup func(exists bool)
+	logger      logger.Logger
+}
+
+func NewServer(uc *usecase.TileCacheUseCase, countLookup func(exists bool), l logger.Logger) *Server {
+	return &Server{tileCacheUseCase: uc, countLookup: countLookup, logger: l}
+}
+
+// GRPCServer returns a gRPC server serving s.
+func (s *Server) GRPCServer() *grpc.Server {
+	gs := grpc.NewServer()
+	cacherpc.RegisterTileCacheServiceServer(gs, s)
+	return gs
+}
+
+var _ cacherpc.TileCacheServiceServer = (*Server)(nil)
+
+func (s *Server) Get(ctx context.Context, req *cacherpc.GetRequest) (*cacherpc.GetResponse, error) {
+	key, err := tileKey(req.Z, req.X, req.Y, req.Layer)
+	if err != nil {
+		return nil, err
+	}
+	data, meta, exists, err := s.tileCacheUseCase.GetCachedTileAt(key)
+	if err != nil {
+		s.logger.Error("failed to get cached tile", "z", req.Z, "x", req.X, "y", req.Y, "layer", req.Layer, "error", err)
+		return nil, cacheError(err)
+	}
+	s.countLookup(exists)
+
+	resp := &cacherpc.GetResponse{
+		Exists:      exists,
+		Data:        data,
+		NotFound:    meta.NotFound,
+		Etag:        meta.ETag,
+		ContentType: meta.ContentType,
+	}
+	if exists && !meta.StoredAt.IsZero() {
+		resp.StoredAtUnixNanos = meta.StoredAt.UnixNano()
+	}
+	return resp, nil
+}
+
+func (s *Server) Set(ctx context.Context, req *cacherpc.SetRequest) (*cacherpc.SetResponse, error) {
+	key, err := tileKey(req.Z, req.X, req.Y, req.Layer)
+	if err != nil {
+		return nil, err
+	}
+	origin := usecase.Origin{
+		Actor:        actor(ctx),
+		Source:       req.Source,
+		ETag:         req.UpstreamEtag,
+		LastModified: unixNanos(req.LastModifiedUnixNanos),
+	}
+
+	switch {
+	case req.NotFound:
+		err = s.tileCacheUseCase.CacheNotFoundAt(key, usecase.Origin{Actor: origin.Actor})
+	case len(req.Data) == 0:
+		return nil, status.Error(codes.InvalidArgument, "invalid tile data")
+	default:
+		err = s.tileCacheUseCase.CacheTileAt(key, req.Data, origin)
+	}
+	if errors.Is(err, usecase.ErrTileRejected) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to cache tile", "z", req.Z, "x", req.X, "y", req.Y, "layer", req.Layer, "error", err)
+		return nil, cacheError(err)
+	}
+
+	metrics.CacheStores.Inc()
+	return &cacherpc.SetResponse{}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, req *cacherpc.DeleteRequest) (*cacherpc.DeleteResponse, error) {
+	key, err := tileKey(req.Z, req.X, req.Y, req.Layer)
+	if err != nil {
+		return nil, err
+	}
+	err = s.tileCacheUseCase.DeleteTile(key, usecase.Origin{Actor: actor(ctx)})
+	if errors.Is(err, usecase.ErrDeleteUnsupported) {
+		return nil, status.Error(codes.Unimplemented, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to delete tile", "z", req.Z, "x", req.X, "y", req.Y, "layer", req.Layer, "error", err)
+		return nil, cacheError(err)
+	}
+	return &cacherpc.DeleteResponse{}, nil
+}
+
+// GetStream answers a stream of lookups, one response per request.
+func (s *Server) GetStream(stream cacherpc.TileCacheService_GetStreamServer) error {
+	return serveStream(stream, s.Get)
+}
+
+// SetStream stores a stream of tiles, acknowledging each one.
+func (s *Server) SetStream(stream cacherpc.TileCacheService_SetStreamServer) error {
+	return serveStream(stream, s.Set)
+}
+
+// DeleteStream deletes a stream of tiles, acknowledging each one.
+func (s *Server) DeleteStream(stream cacherpc.TileCacheService_DeleteStreamServer) error {
+	return serveStream(stream, s.Delete)
+}
+
+// serveStream answers every request on stream with call until the client
+// closes its side. The first failing request ends the stream with its
+// status.
+func serveStream[Req, Resp any](stream grpc.BidiStreamingServer[Req, Resp], call func(context.Context, *Req) (*Resp, error)) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		resp, err := call(stream.Context(), req)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// tileKey builds the cache key of a request, rejecting invalid layer names.
+func tileKey(z, x, y uint32, layer string) (tilecache.TileCacheKey, error) {
+	if layer != "" {
+		if err := tilemath.ValidateLayer(layer); err != nil {
+			return tilecache.TileCacheKey{}, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	return tilecache.TileCacheKey{X: int(x), Y: int(y), Z: int(z), Layer: layer}, nil
+}
+
+// cacheError maps a failed cache operation to a status, as
+// RespondWithCacheError does for HTTP.
+func cacheError(err error) error {
+	if errors.Is(err, usecase.ErrBackendTimeout) {
+		return status.Error(codes.DeadlineExceeded, "cache backend timed out")
+	}
+	if errors.Is(err, tilecache.ErrLayerUnsupported) {
+		return status.Error(codes.Unimplemented, err.Error())
+	}
+	return status.Error(codes.Internal, "cache operation failed")
+}
+
+// unixNanos converts a timestamp of the API, zero when unknown.
+func unixNanos(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// actor is the client's IP address, recorded in the audit log.
+func actor(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,179 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	tilecache "github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/cacherpc"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/config"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient serves the map cache over an in-memory connection and
+// returns a client for it with the lookups it counted.
+func newTestClient(t *testing.T, mc *tilecache.MapCache) (*cacherpc.Client, *[]bool) {
+	t.Helper()
+
+	l := logger.NewZapLogger(config.Logger{Level: "ERROR"})
+	var lookups []bool
+	srv := NewServer(usecase.NewTileCacheUseCase(mc, l), func(exists bool) {
+		lookups = append(lookups, exists)
+	}, l).GRPCServer()
+
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	c, err := cacherpc.Dial("passthrough:///bufnet", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, &lookups
+}
+
+func TestServer_StoresAndServesTiles(t *testing.T) {
+	mc := tilecache.NewMapCache(logger.NewZapLogger(config.Logger{Level: "ERROR"}))
+	c, lookups := newTestClient(t, mc)
+	ctx := context.Background()
+
+	resp, err := c.Get(ctx, &cacherpc.GetRequest{Z: 5, X: 1, Y: 2})
+	if err != nil || resp.Exists {
+		t.Fatalf("expected a miss, got %+v, %v", resp, err)
+	}
+
+	tile := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0}
+	if _, err := c.Set(ctx, &cacherpc.SetRequest{Z: 5, X: 1, Y: 2, Data: tile, Source: "https://tile.example/5/1/2.png"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if data, ok, _ := mc.Get(tilecache.TileCacheKey{Z: 5, X: 1, Y: 2}); !ok || !bytes.Equal(data, tile) {
+		t.Fatalf("tile not stored in the backend: %v", data)
+	}
+
+	resp, err = c.Get(ctx, &cacherpc.GetRequest{Z: 5, X: 1, Y: 2})
+	if err != nil || !resp.Exists || !bytes.Equal(resp.Data, tile) {
+		t.Fatalf("expected the stored tile, got %+v, %v", resp, err)
+	}
+	if len(*lookups) != 2 || (*lookups)[0] || !(*lookups)[1] {
+		t.Fatalf("lookups counted as %v, want a miss then a hit", *lookups)
+	}
+
+	if _, err := c.Delete(ctx, &cacherpc.DeleteRequest{Z: 5, X: 1, Y: 2}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, ok, _ := mc.Get(tilecache.TileCacheKey{Z: 5, X: 1, Y: 2}); ok {
+		t.Fatal("deleted tile still cached")
+	}
+}
+
+func TestServer_RejectsEmptyTiles(t *testing.T) {
+	mc := tilecache.NewMapCache(logger.NewZapLogger(config.Logger{Level: "ERROR"}))
+	c, _ := newTestClient(t, mc)
+
+	_, err := c.Set(context.Background(), &cacherpc.SetRequest{Z: 5, X: 1, Y: 2})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	if _, ok, _ := mc.Get(tilecache.TileCacheKey{Z: 5, X: 1, Y: 2}); ok {
+		t.Fatal("empty tile was stored")
+	}
+}
+
+func TestServer_KeepsLayersApart(t *testing.T) {
+	mc := tilecache.NewMapCache(logger.NewZapLogger(config.Logger{Level: "ERROR"}))
+	c, _ := newTestClient(t, mc)
+	ctx := context.Background()
+
+	if _, err := c.Set(ctx, &cacherpc.SetRequest{Z: 5, X: 1, Y: 2, Data: []byte("cyclosm"), Layer: "cyclosm"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, ok, _ := mc.Get(tilecache.TileCacheKey{Z: 5, X: 1, Y: 2, Layer: "cyclosm"}); !ok {
+		t.Fatal("tile not stored in its layer")
+	}
+	if resp, err := c.Get(ctx, &cacherpc.GetRequest{Z: 5, X: 1, Y: 2}); err != nil || resp.Exists {
+		t.Fatalf("default layer should miss, got %+v, %v", resp, err)
+	}
+	resp, err := c.Get(ctx, &cacherpc.GetRequest{Z: 5, X: 1, Y: 2, Layer: "cyclosm"})
+	if err != nil || string(resp.Data) != "cyclosm" {
+		t.Fatalf("expected the layer's tile, got %+v, %v", resp, err)
+	}
+
+	if _, err := c.Get(ctx, &cacherpc.GetRequest{Z: 5, X: 1, Y: 2, Layer: "Not/A/Layer"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestServer_StreamsTiles(t *testing.T) {
+	mc := tilecache.NewMapCache(logger.NewZapLogger(config.Logger{Level: "ERROR"}))
+	c, _ := newTestClient(t, mc)
+	ctx := context.Background()
+
+	set, err := c.SetStream(ctx)
+	if err != nil {
+		t.Fatalf("SetStream failed: %v", err)
+	}
+	for x := uint32(0); x < 3; x++ {
+		if err := set.Send(&cacherpc.SetRequest{Z: 5, X: x, Y: 2, Data: []byte{byte(x)}}); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		if _, err := set.Recv(); err != nil {
+			t.Fatalf("tile %d not acknowledged: %v", x, err)
+		}
+	}
+	set.CloseSend()
+	if _, err := set.Recv(); err != io.EOF {
+		t.Fatalf("expected the stream to end, got %v", err)
+	}
+
+	get, err := c.GetStream(ctx)
+	if err != nil {
+		t.Fatalf("GetStream failed: %v", err)
+	}
+	for x := uint32(0); x < 4; x++ {
+		if err := get.Send(&cacherpc.GetRequest{Z: 5, X: x, Y: 2}); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+	get.CloseSend()
+	for x := uint32(0); x < 4; x++ {
+		resp, err := get.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if resp.Exists != (x < 3) || (resp.Exists && !bytes.Equal(resp.Data, []byte{byte(x)})) {
+			t.Fatalf("tile %d answered with %+v", x, resp)
+		}
+	}
+
+	// A bad request ends the stream with its status
+	del, err := c.DeleteStream(ctx)
+	if err != nil {
+		t.Fatalf("DeleteStream failed: %v", err)
+	}
+	if err := del.Send(&cacherpc.DeleteRequest{Z: 5, X: 0, Y: 2}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if _, err := del.Recv(); err != nil {
+		t.Fatalf("delete not acknowledged: %v", err)
+	}
+	if _, ok, _ := mc.Get(tilecache.TileCacheKey{Z: 5, X: 0, Y: 2}); ok {
+		t.Fatal("deleted tile still cached")
+	}
+	if err := del.Send(&cacherpc.DeleteRequest{Z: 5, X: 1, Y: 2, Layer: "Not/A/Layer"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if _, err := del.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+}
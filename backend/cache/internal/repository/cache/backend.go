@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+var (
+	// ErrBackendNotBuilt is returned for a backend left out of the binary by
+	// its build tag.
+	ErrBackendNotBuilt = errors.New("cache backend not built in")
+	ErrUnknownBackend  = errors.New("unknown cache backend")
+)
+
+// BackendConfig holds the settings of every backend OpenBackend can open;
+// only those of the opened one are used.
+type BackendConfig struct {
+	Redis      RedisConfig
+	SQLite     SQLiteConfig
+	Remote     RemoteConfig
+	Filesystem FilesystemConfig
+	Map        MapConfig
+	S3         S3Config
+	Badger     BadgerConfig
+	MBTiles    MBTilesConfig
+}
+
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+	TTL      time.Duration
+	// ZoomTTLs overrides TTL for individual zoom levels
+	ZoomTTLs map[int]time.Duration
+	// KeyPrefix namespaces the keys, e.g. "guidehelper:", when the Redis
+	// instance is shared with other services
+	KeyPrefix string
+	// NotFoundTTL is the TTL of entries recording tiles missing upstream,
+	// usually much shorter than TTL so a tile published later is picked up
+	// soon. Zero applies TTL.
+	NotFoundTTL time.Duration
+}
+
+type SQLiteConfig struct {
+	Path string
+	// AccessFlushInterval is how often batched access times are written back
+	AccessFlushInterval time.Duration
+	// Dedup stores identical tiles once, see setDeduplicated
+	Dedup bool
+	// MigrationTimeout bounds the schema migrations run on open, zero waits
+	MigrationTimeout time.Duration
+}
+
+type BadgerConfig struct {
+	// Path is the directory holding the LSM tree and value log
+	Path string
+	// SyncWrites fsyncs every write; off, a crash loses the last writes but
+	// ingestion is much faster
+	SyncWrites bool
+	// GCInterval is how often the value log is compacted to reclaim space of
+	// overwritten and deleted tiles
+	GCInterval time.Duration
+}
+
+type S3Config struct {
+	// Endpoint is the base URL of the S3 API, e.g. "https://s3.eu-west-1.amazonaws.com"
+	// or "http://minio:9000"
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// Prefix and Extension frame the tile keys, "tiles/" and ".png" store
+	// tiles as tiles/{z}/{x}/{y}.png
+	Prefix    string
+	Extension string
+	// PathStyle addresses the bucket in the path rather than the host name,
+	// as MinIO and most other S3-compatible stores expect
+	PathStyle bool
+	Timeout   time.Duration
+}
+
+type MBTilesConfig struct {
+	// Path of the .mbtiles file, created when missing
+	Path string
+}
+
+type backendOpener func(cfg BackendConfig, l logger.Logger) (TileCache, error)
+
+// backends are the backends compiled into the binary. Those pulling in heavy
+// dependencies register themselves from files guarded by their build tag.
+var backends = map[string]backendOpener{
+	"map": func(cfg BackendConfig, l logger.Logger) (TileCache, error) {
+		if cfg.Map.MaxEntries > 0 || cfg.Map.MaxBytes > 0 {
+			return NewLRUMapCache(cfg.Map, l), nil
+		}
+		return NewMapCache(l), nil
+	},
+	"remote": func(cfg BackendConfig, l logger.Logger) (TileCache, error) {
+		return NewRemoteCache(cfg.Remote, l), nil
+	},
+	"filesystem": func(cfg BackendConfig, l logger.Logger) (TileCache, error) {
+		return NewFilesystemCache(cfg.Filesystem, l), nil
+	},
+}
+
+// backendTags names the build tag of each optional backend.
+var backendTags = map[string]string{
+	"badger":  "badger",
+	"mbtiles": "sqlite",
+	"redis":   "redis",
+	"s3":      "s3",
+	"sqlite":  "sqlite",
+}
+
+// OpenBackend opens the named backend, "map", "remote", "filesystem", "s3",
+// "redis", "sqlite", "mbtiles" or "badger". The last five are only
+// available in binaries built with their tag, e.g. go build -tags
+// sqlite,redis,s3; mbtiles comes with sqlite.
+func OpenBackend(name string, cfg BackendConfig, l logger.Logger) (TileCache, error) {
+	if open, ok := backends[name]; ok {
+		return open(cfg, l)
+	}
+	if tag, ok := backendTags[name]; ok {
+		return nil, fmt.Errorf("%w: %s, rebuild with -tags %s", ErrBackendNotBuilt, name, tag)
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownBackend, name)
+}
@@ -0,0 +1,58 @@
+//go:build badger
+
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func newTestBadgerCache(t *testing.T) *BadgerCache {
+	t.Helper()
+
+	c, err := NewBadgerCache(BadgerConfig{Path: t.TempDir()}, logger.FromContext(context.Background()))
+	if err != nil {
+		t.Fatalf("failed to create badger cache: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func init() {
+	taggedIterableBackends = append(taggedIterableBackends, iterableBackend{
+		name: "badger",
+		cache: func(t *testing.T) iterableCache {
+			return newTestBadgerCache(t)
+		},
+	})
+}
+
+func TestOpenBackend_Badger(t *testing.T) {
+	l := logger.FromContext(context.Background())
+
+	c, err := OpenBackend("badger", BackendConfig{Badger: BadgerConfig{Path: t.TempDir()}}, l)
+	if err != nil {
+		t.Fatalf("OpenBackend failed: %v", err)
+	}
+	bc, ok := c.(*BadgerCache)
+	if !ok {
+		t.Fatalf("expected a badger cache, got %T", c)
+	}
+	defer bc.Close()
+
+	k := TileCacheKey{Z: 1, X: 1, Y: 1}
+	if err := c.Set(k, TileCacheValue("tile")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if data, exists, err := c.Get(k); err != nil || !exists || string(data) != "tile" {
+		t.Fatalf("Get = %q, %v, %v", data, exists, err)
+	}
+	if err := bc.Delete(k); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if exists, err := bc.Has(k); err != nil || exists {
+		t.Fatalf("Has after Delete = %v, %v", exists, err)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !badger
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func TestOpenBackend_BadgerNotBuilt(t *testing.T) {
+	l := logger.FromContext(context.Background())
+
+	_, err := OpenBackend("badger", BackendConfig{}, l)
+	if !errors.Is(err, ErrBackendNotBuilt) {
+		t.Fatalf("expected ErrBackendNotBuilt, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "-tags badger") {
+		t.Fatalf("expected the error to name the build tag, got %v", err)
+	}
+}
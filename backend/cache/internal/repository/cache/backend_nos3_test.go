@@ -0,0 +1,24 @@
+//go:build !s3
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func TestOpenBackend_S3NotBuilt(t *testing.T) {
+	l := logger.FromContext(context.Background())
+
+	_, err := OpenBackend("s3", BackendConfig{S3: S3Config{Bucket: "tiles"}}, l)
+	if !errors.Is(err, ErrBackendNotBuilt) {
+		t.Fatalf("expected ErrBackendNotBuilt, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "-tags s3") {
+		t.Fatalf("expected the error to name the build tag, got %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !sqlite
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func TestOpenBackend_SQLiteNotBuilt(t *testing.T) {
+	l := logger.FromContext(context.Background())
+
+	for _, name := range []string{"sqlite", "mbtiles"} {
+		_, err := OpenBackend(name, BackendConfig{}, l)
+		if !errors.Is(err, ErrBackendNotBuilt) {
+			t.Fatalf("%s: expected ErrBackendNotBuilt, got %v", name, err)
+		}
+		if !strings.Contains(err.Error(), "-tags sqlite") {
+			t.Fatalf("%s: expected the error to name the build tag, got %v", name, err)
+		}
+	}
+}
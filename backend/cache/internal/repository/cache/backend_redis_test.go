@@ -0,0 +1,61 @@
+//go:build redis
+
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func init() {
+	taggedIterableBackends = append(taggedIterableBackends, iterableBackend{
+		name: "redis",
+		cache: func(t *testing.T) iterableCache {
+			mr := miniredis.RunT(t)
+			// Keys of other services sharing the instance are skipped
+			mr.Set("other:tile:1:2:3", "x")
+			return newTestRedisCache(t, mr, RedisConfig{KeyPrefix: "gh:"})
+		},
+	})
+}
+
+func TestOpenBackend_Redis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	l := logger.FromContext(context.Background())
+
+	c, err := OpenBackend("redis", BackendConfig{Redis: RedisConfig{Addr: mr.Addr()}}, l)
+	if err != nil {
+		t.Fatalf("OpenBackend failed: %v", err)
+	}
+	rc, ok := c.(*RedisCache)
+	if !ok {
+		t.Fatalf("expected a redis cache, got %T", c)
+	}
+	defer rc.Close()
+
+	k := TileCacheKey{Z: 1, X: 1, Y: 1}
+	if err := c.Set(k, TileCacheValue("tile")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if !mr.Exists("tile:1:1:1") {
+		t.Fatalf("expected the tile in redis, keys: %v", mr.Keys())
+	}
+}
+
+func TestOpenBackend_RedisUnreachable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	addr := mr.Addr()
+	mr.Close()
+	l := logger.FromContext(context.Background())
+
+	c, err := OpenBackend("redis", BackendConfig{Redis: RedisConfig{Addr: addr}}, l)
+	if err == nil {
+		t.Fatalf("expected an error for an unreachable redis")
+	}
+	if c != nil {
+		t.Fatalf("expected no cache on error, got %T", c)
+	}
+}
@@ -0,0 +1,47 @@
+//go:build s3
+
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func init() {
+	taggedIterableBackends = append(taggedIterableBackends, iterableBackend{
+		name: "s3",
+		cache: func(t *testing.T) iterableCache {
+			c, _ := newTestS3Cache(t)
+			return c
+		},
+	})
+}
+
+func TestOpenBackend_S3(t *testing.T) {
+	l := logger.FromContext(context.Background())
+	_, srv := newFakeS3(t, "tiles-bucket")
+
+	c, err := OpenBackend("s3", BackendConfig{S3: S3Config{
+		Endpoint:  srv.URL,
+		Bucket:    "tiles-bucket",
+		AccessKey: "test-key",
+		SecretKey: "test-secret",
+		PathStyle: true,
+	}}, l)
+	if err != nil {
+		t.Fatalf("OpenBackend failed: %v", err)
+	}
+	if _, ok := c.(*S3Cache); !ok {
+		t.Fatalf("expected an s3 cache, got %T", c)
+	}
+
+	k := TileCacheKey{Z: 1, X: 1, Y: 1}
+	if err := c.Set(k, TileCacheValue("tile")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if data, exists, err := c.Get(k); err != nil || !exists || string(data) != "tile" {
+		t.Fatalf("Get = %q, %v, %v", data, exists, err)
+	}
+}
@@ -0,0 +1,43 @@
+//go:build sqlite
+
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func init() {
+	taggedIterableBackends = append(taggedIterableBackends, iterableBackend{
+		name: "sqlite",
+		cache: func(t *testing.T) iterableCache {
+			return newTestSQLiteCacheWithConfig(t, SQLiteConfig{Dedup: true})
+		},
+	})
+}
+
+func TestOpenBackend_SQLite(t *testing.T) {
+	l := logger.FromContext(context.Background())
+	cfg := BackendConfig{SQLite: SQLiteConfig{Path: filepath.Join(t.TempDir(), "cache.db")}}
+
+	c, err := OpenBackend("sqlite", cfg, l)
+	if err != nil {
+		t.Fatalf("OpenBackend failed: %v", err)
+	}
+	sc, ok := c.(*SQLiteCache)
+	if !ok {
+		t.Fatalf("expected a sqlite cache, got %T", c)
+	}
+	defer sc.Close()
+
+	k := TileCacheKey{Z: 1, X: 1, Y: 1}
+	if err := c.Set(k, TileCacheValue("tile")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, exists, err := c.Get(k); err != nil || !exists {
+		t.Fatalf("expected the tile to be stored, exists=%v err=%v", exists, err)
+	}
+}
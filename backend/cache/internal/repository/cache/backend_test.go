@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func TestOpenBackend_Map(t *testing.T) {
+	l := logger.FromContext(context.Background())
+
+	c, err := OpenBackend("map", BackendConfig{}, l)
+	if err != nil {
+		t.Fatalf("OpenBackend failed: %v", err)
+	}
+	if _, ok := c.(*MapCache); !ok {
+		t.Fatalf("expected a map cache, got %T", c)
+	}
+}
+
+func TestOpenBackend_BoundedMap(t *testing.T) {
+	l := logger.FromContext(context.Background())
+
+	c, err := OpenBackend("map", BackendConfig{Map: MapConfig{MaxBytes: 1 << 20}}, l)
+	if err != nil {
+		t.Fatalf("OpenBackend failed: %v", err)
+	}
+	if _, ok := c.(*LRUMapCache); !ok {
+		t.Fatalf("expected an LRU map cache, got %T", c)
+	}
+}
+
+func TestOpenBackend_Unknown(t *testing.T) {
+	l := logger.FromContext(context.Background())
+
+	_, err := OpenBackend("memcached", BackendConfig{}, l)
+	if !errors.Is(err, ErrUnknownBackend) {
+		t.Fatalf("expected ErrUnknownBackend, got %v", err)
+	}
+	if errors.Is(err, ErrBackendNotBuilt) {
+		t.Fatalf("an unknown backend must not be reported as left out of the build: %v", err)
+	}
+}
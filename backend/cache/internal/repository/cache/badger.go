@@ -0,0 +1,234 @@
+//go:build badger
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/options"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+const (
+	defaultBadgerGCInterval = 10 * time.Minute
+	// badgerGCDiscardRatio rewrites a value log file once half of it is stale
+	badgerGCDiscardRatio = 0.5
+	// badgerValueThreshold keeps every tile but the smallest in the value log,
+	// so compactions of the LSM tree move keys only
+	badgerValueThreshold = 256
+	badgerKeyPrefix      = "tile:"
+)
+
+// BadgerCache stores tiles in an embedded BadgerDB. Its LSM tree with a
+// separate value log absorbs concurrent writes far better than SQLite's
+// single writer, which suits bulk tile ingestion.
+type BadgerCache struct {
+	db     *badger.DB
+	logger logger.Logger
+
+	stopGC chan struct{}
+	gcDone sync.WaitGroup
+}
+
+func init() {
+	backends["badger"] = func(cfg BackendConfig, l logger.Logger) (TileCache, error) {
+		c, err := NewBadgerCache(cfg.Badger, l)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+}
+
+func NewBadgerCache(cfg BadgerConfig, l logger.Logger) (*BadgerCache, error) {
+	// Tiles are PNG or otherwise compressed already, compressing them again
+	// costs CPU for nothing
+	opts := badger.DefaultOptions(cfg.Path).
+		WithCompression(options.None).
+		WithValueThreshold(badgerValueThreshold).
+		WithNumVersionsToKeep(1).
+		WithSyncWrites(cfg.SyncWrites).
+		WithLogger(badgerLogger{l})
+
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, fmt.Errorf("open badger: %w", err)
+	}
+
+	c := &BadgerCache{
+		db:     db,
+		logger: l,
+		stopGC: make(chan struct{}),
+	}
+
+	gcInterval := cfg.GCInterval
+	if gcInterval <= 0 {
+		gcInterval = defaultBadgerGCInterval
+	}
+	c.gcDone.Add(1)
+	go c.runValueLogGC(gcInterval)
+
+	l.Info("badger cache initialized", "path", cfg.Path, "sync_writes", cfg.SyncWrites)
+
+	return c, nil
+}
+
+var _ TileCache = (*BadgerCache)(nil)
+var _ Deleter = (*BadgerCache)(nil)
+var _ Haser = (*BadgerCache)(nil)
+var _ Iterator = (*BadgerCache)(nil)
+
+func badgerKey(k TileCacheKey) []byte {
+	return []byte(badgerKeyPrefix + k.String())
+}
+
+func (c *BadgerCache) Get(k TileCacheKey) (TileCacheValue, bool, error) {
+	c.logger.Debug("badger cache get", "z", k.Z, "x", k.X, "y", k.Y)
+
+	var data []byte
+	err := c.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(badgerKey(k))
+		if err != nil {
+			return err
+		}
+		data, err = item.ValueCopy(nil)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		c.logger.Error("badger cache get failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (c *BadgerCache) Set(k TileCacheKey, v TileCacheValue) error {
+	c.logger.Debug("badger cache set", "z", k.Z, "x", k.X, "y", k.Y)
+
+	err := c.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(badgerKey(k), v)
+	})
+	if err != nil {
+		c.logger.Error("badger cache set failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *BadgerCache) Delete(k TileCacheKey) error {
+	c.logger.Debug("badger cache delete", "z", k.Z, "x", k.X, "y", k.Y)
+
+	err := c.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(badgerKey(k))
+	})
+	if err != nil {
+		c.logger.Error("badger cache delete failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Has reads the key only, the value stays in the value log.
+func (c *BadgerCache) Has(k TileCacheKey) (bool, error) {
+	err := c.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(badgerKey(k))
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		c.logger.Error("badger cache has failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// Iterate walks the keys without fetching values from the value log. Badger
+// does not record store times.
+func (c *BadgerCache) Iterate(fn func(TileCacheKey, EntryInfo) bool) error {
+	err := c.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = []byte(badgerKeyPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			k, err := ParseTileCacheKey(strings.TrimPrefix(string(item.Key()), badgerKeyPrefix))
+			if err != nil {
+				continue
+			}
+			if !fn(k, EntryInfo{Size: item.ValueSize()}) {
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.logger.Error("badger cache iterate failed", "error", err)
+	}
+	return err
+}
+
+// runValueLogGC reclaims value log space until Close, rewriting files for as
+// long as Badger finds one worth rewriting.
+func (c *BadgerCache) runValueLogGC(interval time.Duration) {
+	defer c.gcDone.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopGC:
+			return
+		case <-ticker.C:
+			for {
+				err := c.db.RunValueLogGC(badgerGCDiscardRatio)
+				if err != nil {
+					if !errors.Is(err, badger.ErrNoRewrite) {
+						c.logger.Warn("badger value log gc failed", "error", err)
+					}
+					break
+				}
+			}
+		}
+	}
+}
+
+func (c *BadgerCache) Close() error {
+	close(c.stopGC)
+	c.gcDone.Wait()
+	return c.db.Close()
+}
+
+// badgerLogger routes Badger's own logging to the service logger, demoting
+// its chatty info output to debug.
+type badgerLogger struct {
+	l logger.Logger
+}
+
+func (b badgerLogger) Errorf(format string, args ...any) {
+	b.l.Error("badger: " + strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
+
+func (b badgerLogger) Warningf(format string, args ...any) {
+	b.l.Warn("badger: " + strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
+
+func (b badgerLogger) Infof(format string, args ...any) {
+	b.l.Debug("badger: " + strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
+
+func (b badgerLogger) Debugf(format string, args ...any) {
+	b.l.Debug("badger: " + strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
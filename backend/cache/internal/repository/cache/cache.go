@@ -1,15 +1,169 @@
 package cache
 
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+)
+
 type TileCacheKey struct {
 	X int
 	Y int
 	Z int
+	// Layer names the tile set, e.g. "cyclosm". Empty is the default layer,
+	// which holds the tiles of requests that name none.
+	Layer string
 }
 
-type TileCacheValue []byte
+// String returns the canonical "z/x/y" key shared with the tiles service,
+// prefixed with the layer as "layer/z/x/y" outside the default layer.
+func (k TileCacheKey) String() string {
+	return tilemath.LayerKey(k.Layer, k.Z, k.X, k.Y)
+}
+
+// ParseTileCacheKey reverses TileCacheKey.String.
+func ParseTileCacheKey(s string) (TileCacheKey, error) {
+	layer, t, err := tilemath.ParseLayerKey(s)
+	if err != nil {
+		return TileCacheKey{}, err
+	}
+	return TileCacheKey{X: t.X, Y: t.Y, Z: t.Z, Layer: layer}, nil
+}
+
+// ErrLayerUnsupported is returned by backends holding a single tile set, such
+// as an MBTiles file, for tiles outside the default layer.
+var ErrLayerUnsupported = fmt.Errorf("the cache backend only holds the default layer: %w", errors.ErrUnsupported)
 
+type TileCacheValue []byte
 
 type TileCache interface {
 	Get(TileCacheKey) (TileCacheValue, bool, error)
 	Set(TileCacheKey, TileCacheValue) error
 }
+
+// Deleter is implemented by backends that can drop a single tile,
+// e.g. when another instance announces an invalidation.
+type Deleter interface {
+	Delete(TileCacheKey) error
+}
+
+// PurgeFilter selects the tiles removed by a purge: those with a zoom level
+// between MinZ and MaxZ inclusive that cover BBox, or all of them when BBox
+// is nil.
+type PurgeFilter struct {
+	MinZ int            `json:"min_z"`
+	MaxZ int            `json:"max_z"`
+	BBox *tilemath.BBox `json:"bbox,omitempty"`
+}
+
+// Matches reports whether the filter selects the tile.
+func (f PurgeFilter) Matches(k TileCacheKey) bool {
+	if k.Z < f.MinZ || k.Z > f.MaxZ {
+		return false
+	}
+	if f.BBox == nil {
+		return true
+	}
+	nw, se := tilemath.TileRange(*f.BBox, k.Z)
+	return k.X >= nw.X && k.X <= se.X && k.Y >= nw.Y && k.Y <= se.Y
+}
+
+// Purger is implemented by backends that can remove every tile matching a
+// filter faster than by listing and deleting them one by one. Purge returns
+// how many tiles were removed.
+type Purger interface {
+	Purge(PurgeFilter) (int64, error)
+}
+
+// Haser is implemented by backends that can check for a tile without
+// reading it.
+type Haser interface {
+	Has(TileCacheKey) (bool, error)
+}
+
+// EntryInfo describes a stored tile without its data.
+type EntryInfo struct {
+	// Size is the stored size in bytes
+	Size int64
+	// StoredAt is zero when the backend does not record it
+	StoredAt time.Time
+}
+
+// Iterator is implemented by backends that can enumerate their tiles for
+// maintenance tasks such as eviction, export and statistics. Iteration stops
+// early once fn returns false. fn must not modify the cache; collect the keys
+// and change them after Iterate returned.
+type Iterator interface {
+	Iterate(fn func(TileCacheKey, EntryInfo) bool) error
+}
+
+// Stats summarises the tiles a backend holds. Bytes are stored sizes.
+type Stats struct {
+	Tiles int64
+	Bytes int64
+	// Zooms breaks the totals down by zoom level
+	Zooms map[int]ZoomStats
+}
+
+type ZoomStats struct {
+	Tiles int64
+	Bytes int64
+}
+
+func (s *Stats) add(z int, size int64) {
+	if s.Zooms == nil {
+		s.Zooms = make(map[int]ZoomStats)
+	}
+	zs := s.Zooms[z]
+	zs.Tiles++
+	zs.Bytes += size
+	s.Zooms[z] = zs
+	s.Tiles++
+	s.Bytes += size
+}
+
+// StatsReporter is implemented by backends that can summarise their tiles
+// faster than by listing them.
+type StatsReporter interface {
+	Stats() (Stats, error)
+}
+
+// CollectStats summarises a backend by listing every tile.
+func CollectStats(it Iterator) (Stats, error) {
+	var s Stats
+	err := it.Iterate(func(k TileCacheKey, info EntryInfo) bool {
+		s.add(k.Z, info.Size)
+		return true
+	})
+	return s, err
+}
+
+// AccessInfo describes how a tile has been read.
+type AccessInfo struct {
+	// LastAccess is when the tile was last read, or stored if it never was
+	LastAccess time.Time
+	Hits       int64
+}
+
+// AccessTracker is implemented by backends that record tile reads, so the
+// access pattern can be exported for analytics. The same rules as for
+// Iterator apply to fn.
+type AccessTracker interface {
+	IterateAccess(fn func(TileCacheKey, AccessInfo) bool) error
+}
+
+// BackgroundWriter is implemented by backends that write behind in the
+// background. StopWriting asks the workers to flush their pending writes
+// and exit; the returned channel yields the error of the final flush, nil
+// included, once they have.
+type BackgroundWriter interface {
+	StopWriting() <-chan error
+}
+
+// TimestampedTileCache is implemented by backends that record when a tile
+// was stored, so clients can enforce their own freshness limits.
+type TimestampedTileCache interface {
+	GetWithStoredAt(TileCacheKey) (TileCacheValue, time.Time, bool, error)
+}
@@ -0,0 +1,157 @@
+//go:build badger
+
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+// The Badger benchmarks mirror the SQLite ones so the two can be compared
+// with benchstat.
+func setupBadgerCache(b *testing.B) (*BadgerCache, func()) {
+	b.Helper()
+	l := logger.FromContext(context.Background())
+	cache, err := NewBadgerCache(BadgerConfig{Path: b.TempDir()}, l)
+	if err != nil {
+		b.Fatalf("Failed to create Badger cache: %v", err)
+	}
+	return cache, func() {
+		cache.Close()
+	}
+}
+
+func BenchmarkSet_Badger_Small(b *testing.B) {
+	cache, cleanup := setupBadgerCache(b)
+	defer cleanup()
+	data := generateTileData(smallTileSize)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := TileCacheKey{X: i % 1000, Y: i % 1000, Z: i % 20}
+		if err := cache.Set(key, data); err != nil {
+			b.Fatalf("Set failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkSet_Badger_Large(b *testing.B) {
+	cache, cleanup := setupBadgerCache(b)
+	defer cleanup()
+	data := generateTileData(largeTileSize)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := TileCacheKey{X: i % 1000, Y: i % 1000, Z: i % 20}
+		if err := cache.Set(key, data); err != nil {
+			b.Fatalf("Set failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkGet_Badger_Small(b *testing.B) {
+	cache, cleanup := setupBadgerCache(b)
+	defer cleanup()
+	data := generateTileData(smallTileSize)
+
+	// Populate cache
+	for i := 0; i < 100; i++ {
+		key := TileCacheKey{X: i, Y: i, Z: i % 20}
+		cache.Set(key, data)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := TileCacheKey{X: i % 100, Y: i % 100, Z: i % 20}
+		_, _, err := cache.Get(key)
+		if err != nil {
+			b.Fatalf("Get failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkGet_Badger_Large(b *testing.B) {
+	cache, cleanup := setupBadgerCache(b)
+	defer cleanup()
+	data := generateTileData(largeTileSize)
+
+	// Populate cache
+	for i := 0; i < 100; i++ {
+		key := TileCacheKey{X: i, Y: i, Z: i % 20}
+		cache.Set(key, data)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := TileCacheKey{X: i % 100, Y: i % 100, Z: i % 20}
+		_, _, err := cache.Get(key)
+		if err != nil {
+			b.Fatalf("Get failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkMixed_Badger(b *testing.B) {
+	cache, cleanup := setupBadgerCache(b)
+	defer cleanup()
+	data := generateTileData(mediumTileSize)
+
+	// Pre-populate with some data
+	for i := 0; i < 50; i++ {
+		key := TileCacheKey{X: i, Y: i, Z: i % 20}
+		cache.Set(key, data)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := TileCacheKey{X: i % 100, Y: i % 100, Z: i % 20}
+		if i%5 == 0 {
+			// 20% writes
+			cache.Set(key, data)
+		} else {
+			// 80% reads
+			cache.Get(key)
+		}
+	}
+}
+
+func BenchmarkConcurrent_Badger(b *testing.B) {
+	cache, cleanup := setupBadgerCache(b)
+	defer cleanup()
+	data := generateTileData(mediumTileSize)
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := TileCacheKey{X: i % 100, Y: i % 100, Z: i % 20}
+			if i%5 == 0 {
+				cache.Set(key, data)
+			} else {
+				cache.Get(key)
+			}
+			i++
+		}
+	})
+}
+
+// Tile ingestion writes from many goroutines at once
+func BenchmarkConcurrentSet_Badger(b *testing.B) {
+	cache, cleanup := setupBadgerCache(b)
+	defer cleanup()
+	data := generateTileData(mediumTileSize)
+
+	var n atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := int(n.Add(1))
+			key := TileCacheKey{X: i % 1000, Y: i / 1000 % 1000, Z: 14}
+			if err := cache.Set(key, data); err != nil {
+				b.Errorf("Set failed: %v", err)
+				return
+			}
+		}
+	})
+}
@@ -4,8 +4,6 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
-	"os"
-	"path/filepath"
 	"testing"
 
 	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
@@ -31,20 +29,6 @@ func generateRandomKey() TileCacheKey {
 	}
 }
 
-func setupSQLiteCache(b *testing.B) (*SQLiteCache, func()) {
-	b.Helper()
-	tmpFile := filepath.Join(b.TempDir(), "test.db")
-	l := logger.FromContext(context.Background())
-	cache, err := NewSQLiteCache(tmpFile, l)
-	if err != nil {
-		b.Fatalf("Failed to create SQLite cache: %v", err)
-	}
-	return cache, func() {
-		cache.db.Close()
-		os.Remove(tmpFile)
-	}
-}
-
 func setupMapCache(b *testing.B) (*MapCache, func()) {
 	b.Helper()
 	l := logger.FromContext(context.Background())
@@ -53,43 +37,11 @@ func setupMapCache(b *testing.B) (*MapCache, func()) {
 
 func setupFilesystemCache(b *testing.B) (*FilesystemCache, func()) {
 	b.Helper()
-	tmpDir := b.TempDir()
-
-	// Create directory structure for filesystem cache
-	for z := 0; z < 20; z++ {
-		for x := 0; x < 1000; x++ {
-			dirPath := filepath.Join(tmpDir, fmt.Sprintf("%d/%d", z, x))
-			if err := os.MkdirAll(dirPath, 0755); err != nil {
-				b.Fatalf("Failed to create directory: %v", err)
-			}
-		}
-	}
-
-	// Change to temp directory for relative paths
-	oldDir, _ := os.Getwd()
-	os.Chdir(tmpDir)
-
 	l := logger.FromContext(context.Background())
-	return &FilesystemCache{logger: l}, func() {
-		os.Chdir(oldDir)
-	}
+	return NewFilesystemCache(FilesystemConfig{Root: b.TempDir()}, l), func() {}
 }
 
 // Benchmark Set operations
-func BenchmarkSet_SQLite_Small(b *testing.B) {
-	cache, cleanup := setupSQLiteCache(b)
-	defer cleanup()
-	data := generateTileData(smallTileSize)
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		key := TileCacheKey{X: i % 1000, Y: i % 1000, Z: i % 20}
-		if err := cache.Set(key, data); err != nil {
-			b.Fatalf("Set failed: %v", err)
-		}
-	}
-}
-
 func BenchmarkSet_Map_Small(b *testing.B) {
 	cache, cleanup := setupMapCache(b)
 	defer cleanup()
@@ -118,20 +70,6 @@ func BenchmarkSet_Filesystem_Small(b *testing.B) {
 	}
 }
 
-func BenchmarkSet_SQLite_Large(b *testing.B) {
-	cache, cleanup := setupSQLiteCache(b)
-	defer cleanup()
-	data := generateTileData(largeTileSize)
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		key := TileCacheKey{X: i % 1000, Y: i % 1000, Z: i % 20}
-		if err := cache.Set(key, data); err != nil {
-			b.Fatalf("Set failed: %v", err)
-		}
-	}
-}
-
 func BenchmarkSet_Map_Large(b *testing.B) {
 	cache, cleanup := setupMapCache(b)
 	defer cleanup()
@@ -161,27 +99,6 @@ func BenchmarkSet_Filesystem_Large(b *testing.B) {
 }
 
 // Benchmark Get operations
-func BenchmarkGet_SQLite_Small(b *testing.B) {
-	cache, cleanup := setupSQLiteCache(b)
-	defer cleanup()
-	data := generateTileData(smallTileSize)
-
-	// Populate cache
-	for i := 0; i < 100; i++ {
-		key := TileCacheKey{X: i, Y: i, Z: i % 20}
-		cache.Set(key, data)
-	}
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		key := TileCacheKey{X: i % 100, Y: i % 100, Z: i % 20}
-		_, _, err := cache.Get(key)
-		if err != nil {
-			b.Fatalf("Get failed: %v", err)
-		}
-	}
-}
-
 func BenchmarkGet_Map_Small(b *testing.B) {
 	cache, cleanup := setupMapCache(b)
 	defer cleanup()
@@ -224,27 +141,6 @@ func BenchmarkGet_Filesystem_Small(b *testing.B) {
 	}
 }
 
-func BenchmarkGet_SQLite_Large(b *testing.B) {
-	cache, cleanup := setupSQLiteCache(b)
-	defer cleanup()
-	data := generateTileData(largeTileSize)
-
-	// Populate cache
-	for i := 0; i < 100; i++ {
-		key := TileCacheKey{X: i, Y: i, Z: i % 20}
-		cache.Set(key, data)
-	}
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		key := TileCacheKey{X: i % 100, Y: i % 100, Z: i % 20}
-		_, _, err := cache.Get(key)
-		if err != nil {
-			b.Fatalf("Get failed: %v", err)
-		}
-	}
-}
-
 func BenchmarkGet_Map_Large(b *testing.B) {
 	cache, cleanup := setupMapCache(b)
 	defer cleanup()
@@ -288,30 +184,6 @@ func BenchmarkGet_Filesystem_Large(b *testing.B) {
 }
 
 // Benchmark mixed operations (80% reads, 20% writes - typical cache pattern)
-func BenchmarkMixed_SQLite(b *testing.B) {
-	cache, cleanup := setupSQLiteCache(b)
-	defer cleanup()
-	data := generateTileData(mediumTileSize)
-
-	// Pre-populate with some data
-	for i := 0; i < 50; i++ {
-		key := TileCacheKey{X: i, Y: i, Z: i % 20}
-		cache.Set(key, data)
-	}
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		key := TileCacheKey{X: i % 100, Y: i % 100, Z: i % 20}
-		if i%5 == 0 {
-			// 20% writes
-			cache.Set(key, data)
-		} else {
-			// 80% reads
-			cache.Get(key)
-		}
-	}
-}
-
 func BenchmarkMixed_Map(b *testing.B) {
 	cache, cleanup := setupMapCache(b)
 	defer cleanup()
@@ -361,25 +233,6 @@ func BenchmarkMixed_Filesystem(b *testing.B) {
 }
 
 // Benchmark concurrent operations
-func BenchmarkConcurrent_SQLite(b *testing.B) {
-	cache, cleanup := setupSQLiteCache(b)
-	defer cleanup()
-	data := generateTileData(mediumTileSize)
-
-	b.RunParallel(func(pb *testing.PB) {
-		i := 0
-		for pb.Next() {
-			key := TileCacheKey{X: i % 100, Y: i % 100, Z: i % 20}
-			if i%5 == 0 {
-				cache.Set(key, data)
-			} else {
-				cache.Get(key)
-			}
-			i++
-		}
-	})
-}
-
 func BenchmarkConcurrent_Map(b *testing.B) {
 	cache, cleanup := setupMapCache(b)
 	defer cleanup()
@@ -417,3 +270,38 @@ func BenchmarkConcurrent_Filesystem(b *testing.B) {
 		}
 	})
 }
+
+// Compare stored size and CPU across compression levels
+func BenchmarkCompressingCache_Levels(b *testing.B) {
+	tile := generateCompressibleTileData(largeTileSize)
+	l := logger.FromContext(context.Background())
+
+	for _, cfg := range []CompressionConfig{
+		{Codec: CompressionGzip, Level: 1},
+		{Codec: CompressionGzip, Level: 6},
+		{Codec: CompressionGzip, Level: 9},
+		{Codec: CompressionZstd, Level: 1},
+		{Codec: CompressionZstd, Level: 3},
+		{Codec: CompressionZstd, Level: 19},
+	} {
+		b.Run(fmt.Sprintf("%s-%d", cfg.Codec, cfg.Level), func(b *testing.B) {
+			inner := NewMapCache(l)
+			c, err := NewCompressingCache(inner, cfg)
+			if err != nil {
+				b.Fatalf("NewCompressingCache failed: %v", err)
+			}
+			k := TileCacheKey{X: 1, Y: 2, Z: 3}
+
+			b.SetBytes(int64(len(tile)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.Set(k, tile)
+				c.Get(k)
+			}
+			b.StopTimer()
+
+			stored, _, _ := inner.Get(k)
+			b.ReportMetric(float64(len(stored)), "stored_bytes")
+		})
+	}
+}
@@ -0,0 +1,214 @@
+//go:build sqlite
+
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func setupSQLiteCache(b *testing.B) (*SQLiteCache, func()) {
+	b.Helper()
+	tmpFile := filepath.Join(b.TempDir(), "test.db")
+	l := logger.FromContext(context.Background())
+	cache, err := NewSQLiteCache(SQLiteConfig{Path: tmpFile}, l)
+	if err != nil {
+		b.Fatalf("Failed to create SQLite cache: %v", err)
+	}
+	return cache, func() {
+		cache.Close()
+		os.Remove(tmpFile)
+	}
+}
+
+func BenchmarkSet_SQLite_Small(b *testing.B) {
+	cache, cleanup := setupSQLiteCache(b)
+	defer cleanup()
+	data := generateTileData(smallTileSize)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := TileCacheKey{X: i % 1000, Y: i % 1000, Z: i % 20}
+		if err := cache.Set(key, data); err != nil {
+			b.Fatalf("Set failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkSet_SQLite_Large(b *testing.B) {
+	cache, cleanup := setupSQLiteCache(b)
+	defer cleanup()
+	data := generateTileData(largeTileSize)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := TileCacheKey{X: i % 1000, Y: i % 1000, Z: i % 20}
+		if err := cache.Set(key, data); err != nil {
+			b.Fatalf("Set failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkGet_SQLite_Small(b *testing.B) {
+	cache, cleanup := setupSQLiteCache(b)
+	defer cleanup()
+	data := generateTileData(smallTileSize)
+
+	// Populate cache
+	for i := 0; i < 100; i++ {
+		key := TileCacheKey{X: i, Y: i, Z: i % 20}
+		cache.Set(key, data)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := TileCacheKey{X: i % 100, Y: i % 100, Z: i % 20}
+		_, _, err := cache.Get(key)
+		if err != nil {
+			b.Fatalf("Get failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkGet_SQLite_Large(b *testing.B) {
+	cache, cleanup := setupSQLiteCache(b)
+	defer cleanup()
+	data := generateTileData(largeTileSize)
+
+	// Populate cache
+	for i := 0; i < 100; i++ {
+		key := TileCacheKey{X: i, Y: i, Z: i % 20}
+		cache.Set(key, data)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := TileCacheKey{X: i % 100, Y: i % 100, Z: i % 20}
+		_, _, err := cache.Get(key)
+		if err != nil {
+			b.Fatalf("Get failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkMixed_SQLite(b *testing.B) {
+	cache, cleanup := setupSQLiteCache(b)
+	defer cleanup()
+	data := generateTileData(mediumTileSize)
+
+	// Pre-populate with some data
+	for i := 0; i < 50; i++ {
+		key := TileCacheKey{X: i, Y: i, Z: i % 20}
+		cache.Set(key, data)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := TileCacheKey{X: i % 100, Y: i % 100, Z: i % 20}
+		if i%5 == 0 {
+			// 20% writes
+			cache.Set(key, data)
+		} else {
+			// 80% reads
+			cache.Get(key)
+		}
+	}
+}
+
+func BenchmarkConcurrent_SQLite(b *testing.B) {
+	cache, cleanup := setupSQLiteCache(b)
+	defer cleanup()
+	data := generateTileData(mediumTileSize)
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := TileCacheKey{X: i % 100, Y: i % 100, Z: i % 20}
+			if i%5 == 0 {
+				cache.Set(key, data)
+			} else {
+				cache.Get(key)
+			}
+			i++
+		}
+	})
+}
+
+// Compare coordinate lookups on the migrated table against an unindexed copy
+// to show what the (x, y, z) index buys Get on a populated cache.
+func setupCoordinateLookup(b *testing.B, table string) (*SQLiteCache, func()) {
+	b.Helper()
+	cache, cleanup := setupSQLiteCache(b)
+	data := generateTileData(smallTileSize)
+
+	// Insert in one transaction, going through Set would dominate the setup
+	tx, err := cache.db.Begin()
+	if err != nil {
+		b.Fatalf("failed to begin: %v", err)
+	}
+	for i := 0; i < 10000; i++ {
+		if _, err := tx.Exec(`INSERT INTO tile_cache (x, y, z, tile_data) VALUES (?, ?, ?, ?)`, i%1000, i/1000, 14, data); err != nil {
+			b.Fatalf("insert failed: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		b.Fatalf("failed to commit: %v", err)
+	}
+	if table != "tile_cache" {
+		if _, err := cache.db.Exec(`CREATE TABLE ` + table + ` AS SELECT * FROM tile_cache`); err != nil {
+			b.Fatalf("failed to copy table: %v", err)
+		}
+	}
+	return cache, cleanup
+}
+
+func benchmarkCoordinateLookup(b *testing.B, table string) {
+	cache, cleanup := setupCoordinateLookup(b, table)
+	defer cleanup()
+
+	stmt, err := cache.db.Prepare(`SELECT tile_data FROM ` + table + ` WHERE x = ? AND y = ? AND z = ?`)
+	if err != nil {
+		b.Fatalf("failed to prepare lookup: %v", err)
+	}
+	defer stmt.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var data []byte
+		if err := stmt.QueryRow(i%1000, (i/1000)%10, 14).Scan(&data); err != nil {
+			b.Fatalf("lookup failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkGet_SQLite_CoordinateIndex(b *testing.B) {
+	benchmarkCoordinateLookup(b, "tile_cache")
+}
+
+func BenchmarkGet_SQLite_NoCoordinateIndex(b *testing.B) {
+	benchmarkCoordinateLookup(b, "tile_cache_unindexed")
+}
+
+// Tile ingestion writes from many goroutines at once
+func BenchmarkConcurrentSet_SQLite(b *testing.B) {
+	cache, cleanup := setupSQLiteCache(b)
+	defer cleanup()
+	data := generateTileData(mediumTileSize)
+
+	var n atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := int(n.Add(1))
+			key := TileCacheKey{X: i % 1000, Y: i / 1000 % 1000, Z: 14}
+			if err := cache.Set(key, data); err != nil {
+				b.Errorf("Set failed: %v", err)
+				return
+			}
+		}
+	})
+}
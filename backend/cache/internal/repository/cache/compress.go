@@ -0,0 +1,253 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/metrics"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+var ErrInvalidCompressionLevel = errors.New("invalid compression level")
+
+// compressedMagic starts every compressed value, followed by a byte naming
+// the codec. Values without it are stored uncompressed, e.g. written before
+// compression was enabled.
+var compressedMagic = []byte("GHZ\x01")
+
+const (
+	codecGzip byte = 'g'
+	codecZstd byte = 'z'
+)
+
+// CompressionConfig selects the codec and level of a CompressingCache.
+type CompressionConfig struct {
+	// Codec is CompressionGzip or CompressionZstd
+	Codec string
+	// Level trades CPU for space: 1 to 9 for gzip, 1 to 22 for zstd, with
+	// higher levels compressing better and slower. Zero picks the codec
+	// default.
+	Level int
+}
+
+// CompressingCache compresses tiles before storing them in another backend.
+// Values written with either codec, or uncompressed, stay readable when the
+// configuration changes.
+type CompressingCache struct {
+	inner     TileCache
+	codecName string
+	codec     byte
+	gzipLevel int
+	encoder   *zstd.Encoder
+	decoder   *zstd.Decoder
+}
+
+func NewCompressingCache(inner TileCache, cfg CompressionConfig) (*CompressingCache, error) {
+	c := &CompressingCache{inner: inner, codecName: cfg.Codec}
+
+	switch cfg.Codec {
+	case CompressionGzip:
+		level := cfg.Level
+		if level == 0 {
+			level = gzip.DefaultCompression
+		} else if level < gzip.BestSpeed || level > gzip.BestCompression {
+			return nil, fmt.Errorf("%w: gzip levels are %d to %d, got %d",
+				ErrInvalidCompressionLevel, gzip.BestSpeed, gzip.BestCompression, level)
+		}
+		c.codec = codecGzip
+		c.gzipLevel = level
+	case CompressionZstd:
+		level := zstd.SpeedDefault
+		if cfg.Level != 0 {
+			if cfg.Level < 1 || cfg.Level > 22 {
+				return nil, fmt.Errorf("%w: zstd levels are 1 to 22, got %d", ErrInvalidCompressionLevel, cfg.Level)
+			}
+			level = zstd.EncoderLevelFromZstd(cfg.Level)
+		}
+		encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		c.codec = codecZstd
+		c.encoder = encoder
+	default:
+		return nil, fmt.Errorf("unknown compression codec %q", cfg.Codec)
+	}
+
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+	c.decoder = decoder
+
+	return c, nil
+}
+
+var _ TileCache = (*CompressingCache)(nil)
+var _ TimestampedTileCache = (*CompressingCache)(nil)
+var _ Deleter = (*CompressingCache)(nil)
+var _ Haser = (*CompressingCache)(nil)
+var _ Iterator = (*CompressingCache)(nil)
+var _ AccessTracker = (*CompressingCache)(nil)
+var _ Purger = (*CompressingCache)(nil)
+var _ StatsReporter = (*CompressingCache)(nil)
+
+func (c *CompressingCache) Get(k TileCacheKey) (TileCacheValue, bool, error) {
+	raw, exists, err := c.inner.Get(k)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	data, err := c.decompress(raw)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (c *CompressingCache) GetWithStoredAt(k TileCacheKey) (TileCacheValue, time.Time, bool, error) {
+	tc, ok := c.inner.(TimestampedTileCache)
+	if !ok {
+		data, exists, err := c.Get(k)
+		return data, time.Time{}, exists, err
+	}
+	raw, storedAt, exists, err := tc.GetWithStoredAt(k)
+	if err != nil || !exists {
+		return nil, time.Time{}, exists, err
+	}
+	data, err := c.decompress(raw)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	return data, storedAt, true, nil
+}
+
+// Set stores entries recording missing tiles uncompressed, so backends can
+// tell them apart. The raw and compressed sizes of stored tiles are counted
+// per codec, their ratio is the space compression saves.
+func (c *CompressingCache) Set(k TileCacheKey, v TileCacheValue) error {
+	if IsNotFound(v) {
+		return c.inner.Set(k, v)
+	}
+	raw, err := c.compress(v)
+	if err != nil {
+		return err
+	}
+	if err := c.inner.Set(k, raw); err != nil {
+		return err
+	}
+	metrics.CacheCompressionBytes.WithLabelValues(c.codecName, "raw").Add(float64(len(v)))
+	metrics.CacheCompressionBytes.WithLabelValues(c.codecName, "compressed").Add(float64(len(raw)))
+	return nil
+}
+
+func (c *CompressingCache) Delete(k TileCacheKey) error {
+	d, ok := c.inner.(Deleter)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return d.Delete(k)
+}
+
+func (c *CompressingCache) Has(k TileCacheKey) (bool, error) {
+	if h, ok := c.inner.(Haser); ok {
+		return h.Has(k)
+	}
+	_, exists, err := c.inner.Get(k)
+	return exists, err
+}
+
+// Iterate passes through to the backend, so sizes are compressed sizes.
+func (c *CompressingCache) Iterate(fn func(TileCacheKey, EntryInfo) bool) error {
+	it, ok := c.inner.(Iterator)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return it.Iterate(fn)
+}
+
+// Purge passes through to the backend.
+func (c *CompressingCache) Purge(f PurgeFilter) (int64, error) {
+	p, ok := c.inner.(Purger)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	return p.Purge(f)
+}
+
+// Stats passes through to the backend.
+func (c *CompressingCache) Stats() (Stats, error) {
+	sr, ok := c.inner.(StatsReporter)
+	if !ok {
+		return Stats{}, errors.ErrUnsupported
+	}
+	return sr.Stats()
+}
+
+// IterateAccess passes through to the backend.
+func (c *CompressingCache) IterateAccess(fn func(TileCacheKey, AccessInfo) bool) error {
+	at, ok := c.inner.(AccessTracker)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return at.IterateAccess(fn)
+}
+
+func (c *CompressingCache) compress(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(compressedMagic)+1+len(data)/2)
+	out = append(out, compressedMagic...)
+	out = append(out, c.codec)
+
+	if c.codec == codecZstd {
+		return c.encoder.EncodeAll(data, out), nil
+	}
+
+	buf := bytes.NewBuffer(out)
+	w, err := gzip.NewWriterLevel(buf, c.gzipLevel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gzip writer: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress tile: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress tile: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *CompressingCache) decompress(raw []byte) ([]byte, error) {
+	if !bytes.HasPrefix(raw, compressedMagic) || len(raw) == len(compressedMagic) {
+		return raw, nil
+	}
+	body := raw[len(compressedMagic)+1:]
+
+	switch raw[len(compressedMagic)] {
+	case codecZstd:
+		data, err := c.decoder.DecodeAll(body, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress zstd tile: %w", err)
+		}
+		return data, nil
+	case codecGzip:
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress gzip tile: %w", err)
+		}
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress gzip tile: %w", err)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("unknown compression codec %q", raw[len(compressedMagic)])
+}
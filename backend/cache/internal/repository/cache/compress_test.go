@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// generateCompressibleTileData mimics decoded map tiles: flat areas with
+// some noise, unlike generateTileData's incompressible random bytes.
+func generateCompressibleTileData(size int) []byte {
+	data := make([]byte, size)
+	seed := uint32(1)
+	for i := range data {
+		seed = seed*1664525 + 1013904223
+		data[i] = byte(i / 512)
+		if i%16 == 0 {
+			data[i] = byte(seed >> 24)
+		}
+	}
+	return data
+}
+
+func TestCompressingCache_RoundTripAtEachLevel(t *testing.T) {
+	tile := generateCompressibleTileData(mediumTileSize)
+
+	for _, cfg := range []CompressionConfig{
+		{Codec: CompressionGzip},
+		{Codec: CompressionGzip, Level: 1},
+		{Codec: CompressionGzip, Level: 9},
+		{Codec: CompressionZstd},
+		{Codec: CompressionZstd, Level: 1},
+		{Codec: CompressionZstd, Level: 19},
+	} {
+		t.Run(fmt.Sprintf("%s-%d", cfg.Codec, cfg.Level), func(t *testing.T) {
+			inner := NewMapCache(logger.FromContext(context.Background()))
+			c, err := NewCompressingCache(inner, cfg)
+			if err != nil {
+				t.Fatalf("NewCompressingCache failed: %v", err)
+			}
+
+			k := TileCacheKey{X: 1, Y: 2, Z: 3}
+			if err := c.Set(k, tile); err != nil {
+				t.Fatalf("set failed: %v", err)
+			}
+			data, ok, err := c.Get(k)
+			if err != nil || !ok || !bytes.Equal(data, tile) {
+				t.Fatalf("expected the stored tile back, got ok=%v err=%v", ok, err)
+			}
+
+			stored, _, _ := inner.Get(k)
+			if len(stored) >= len(tile) {
+				t.Fatalf("expected the stored value to be compressed, got %d >= %d bytes", len(stored), len(tile))
+			}
+		})
+	}
+}
+
+func TestCompressingCache_RejectsLevelsOutOfRange(t *testing.T) {
+	inner := NewMapCache(logger.FromContext(context.Background()))
+	for _, cfg := range []CompressionConfig{
+		{Codec: CompressionGzip, Level: 10},
+		{Codec: CompressionGzip, Level: -3},
+		{Codec: CompressionZstd, Level: 23},
+		{Codec: CompressionZstd, Level: -1},
+	} {
+		if _, err := NewCompressingCache(inner, cfg); !errors.Is(err, ErrInvalidCompressionLevel) {
+			t.Errorf("%s level %d: expected ErrInvalidCompressionLevel, got %v", cfg.Codec, cfg.Level, err)
+		}
+	}
+}
+
+func TestCompressingCache_ReadsValuesFromOtherConfigurations(t *testing.T) {
+	inner := NewMapCache(logger.FromContext(context.Background()))
+	gz, _ := NewCompressingCache(inner, CompressionConfig{Codec: CompressionGzip})
+	zs, _ := NewCompressingCache(inner, CompressionConfig{Codec: CompressionZstd})
+
+	legacy := TileCacheKey{X: 1, Y: 1, Z: 1}
+	inner.Set(legacy, pngTile)
+	gz.Set(TileCacheKey{X: 2, Y: 2, Z: 2}, pngTile)
+
+	for _, k := range []TileCacheKey{legacy, {X: 2, Y: 2, Z: 2}} {
+		data, ok, err := zs.Get(k)
+		if err != nil || !ok || !bytes.Equal(data, pngTile) {
+			t.Fatalf("%v: expected the tile back, got ok=%v err=%v", k, ok, err)
+		}
+	}
+}
+
+func TestCompressingCache_CountsRawAndCompressedBytes(t *testing.T) {
+	inner := NewMapCache(logger.FromContext(context.Background()))
+	c, err := NewCompressingCache(inner, CompressionConfig{Codec: CompressionZstd})
+	if err != nil {
+		t.Fatalf("NewCompressingCache failed: %v", err)
+	}
+
+	raw := metrics.CacheCompressionBytes.WithLabelValues(CompressionZstd, "raw")
+	compressed := metrics.CacheCompressionBytes.WithLabelValues(CompressionZstd, "compressed")
+	rawBefore, compressedBefore := testutil.ToFloat64(raw), testutil.ToFloat64(compressed)
+
+	k := TileCacheKey{Z: 1, X: 1, Y: 1}
+	tile := generateCompressibleTileData(16 * 1024)
+	if err := c.Set(k, tile); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	// Missing tile markers are stored as they are and not counted
+	if err := c.Set(TileCacheKey{Z: 1, X: 0, Y: 0}, NotFoundMarker); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	stored, _, _ := inner.Get(k)
+	if got := testutil.ToFloat64(raw) - rawBefore; got != float64(len(tile)) {
+		t.Fatalf("raw bytes = %v, want %d", got, len(tile))
+	}
+	if got := testutil.ToFloat64(compressed) - compressedBefore; got != float64(len(stored)) {
+		t.Fatalf("compressed bytes = %v, want %d", got, len(stored))
+	}
+}
@@ -0,0 +1,331 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// TileMetadata describes a stored tile. Fields are zero when unknown, e.g.
+// for values written before metadata was recorded.
+type TileMetadata struct {
+	ContentType string
+	// ETag identifies the stored content, it is derived from the tile data
+	ETag string
+	// StoredAt is when the tile was fetched and stored
+	StoredAt time.Time
+	// NotFound is set for tiles recorded as missing upstream, which have
+	// no data
+	NotFound bool
+	// Source is the upstream URL the tile was fetched from, when the
+	// storing client reported it
+	Source string
+	// UpstreamETag and LastModified are the validators upstream served the
+	// tile with, when the storing client reported them, so it can be
+	// revalidated with a conditional request
+	UpstreamETag string
+	LastModified time.Time
+}
+
+// MetadataTileCache is implemented by caches that record metadata with each
+// tile.
+type MetadataTileCache interface {
+	GetWithMetadata(k TileCacheKey) (TileCacheValue, TileMetadata, bool, error)
+}
+
+// UpstreamInfo describes where a stored tile came from. Empty fields are
+// unknown.
+type UpstreamInfo struct {
+	// Source is the upstream URL the tile was fetched from
+	Source string
+	// ETag and LastModified are the validators upstream served the tile with
+	ETag         string
+	LastModified time.Time
+}
+
+// UpstreamTileCache is implemented by caches that can record where a tile
+// was fetched from.
+type UpstreamTileCache interface {
+	SetWithUpstream(k TileCacheKey, v TileCacheValue, up UpstreamInfo) error
+}
+
+// ContentETag derives a strong ETag from the tile content.
+func ContentETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf(`"%x"`, sum[:8])
+}
+
+// ValueCodec converts between tiles with metadata and the bytes a backend
+// stores.
+type ValueCodec interface {
+	Encode(data []byte, meta TileMetadata) ([]byte, error)
+	Decode(raw []byte) ([]byte, TileMetadata, error)
+}
+
+// RawCodec stores the tile bytes as they are and drops the metadata.
+type RawCodec struct{}
+
+func (RawCodec) Encode(data []byte, _ TileMetadata) ([]byte, error) {
+	return data, nil
+}
+
+func (RawCodec) Decode(raw []byte) ([]byte, TileMetadata, error) {
+	return raw, TileMetadata{}, nil
+}
+
+// envelopeMagic starts every envelope, its last byte being the version.
+// Values without it are legacy raw tiles; PNG and JPEG tiles cannot start
+// with it.
+var (
+	envelopeMagic   = []byte("GHT\x03")
+	envelopeMagicV2 = []byte("GHT\x02")
+	envelopeMagicV1 = []byte("GHT\x01")
+)
+
+var ErrInvalidEnvelope = errors.New("invalid value envelope")
+
+// EnvelopeCodec prefixes the tile bytes with its metadata:
+//
+//	magic | uvarint len + content type | uvarint len + etag | varint stored_at unix ns | uvarint len + source |
+//	varint last_modified unix s | uvarint len + upstream etag | data
+//
+// Version 1 envelopes, without the source, and version 2 ones, without the
+// upstream validators, still decode. Values without the magic prefix decode
+// as raw tiles without metadata.
+type EnvelopeCodec struct{}
+
+func (EnvelopeCodec) Encode(data []byte, meta TileMetadata) ([]byte, error) {
+	buf := make([]byte, 0, len(envelopeMagic)+len(meta.ContentType)+len(meta.ETag)+len(meta.Source)+len(meta.UpstreamETag)+
+		6*binary.MaxVarintLen64+len(data))
+	buf = append(buf, envelopeMagic...)
+	buf = binary.AppendUvarint(buf, uint64(len(meta.ContentType)))
+	buf = append(buf, meta.ContentType...)
+	buf = binary.AppendUvarint(buf, uint64(len(meta.ETag)))
+	buf = append(buf, meta.ETag...)
+	var storedAt int64
+	if !meta.StoredAt.IsZero() {
+		storedAt = meta.StoredAt.UnixNano()
+	}
+	buf = binary.AppendVarint(buf, storedAt)
+	buf = binary.AppendUvarint(buf, uint64(len(meta.Source)))
+	buf = append(buf, meta.Source...)
+	// HTTP dates have whole seconds
+	var lastModified int64
+	if !meta.LastModified.IsZero() {
+		lastModified = meta.LastModified.Unix()
+	}
+	buf = binary.AppendVarint(buf, lastModified)
+	buf = binary.AppendUvarint(buf, uint64(len(meta.UpstreamETag)))
+	buf = append(buf, meta.UpstreamETag...)
+	return append(buf, data...), nil
+}
+
+func (EnvelopeCodec) Decode(raw []byte) ([]byte, TileMetadata, error) {
+	var version int
+	switch {
+	case bytes.HasPrefix(raw, envelopeMagic):
+		version = 3
+	case bytes.HasPrefix(raw, envelopeMagicV2):
+		version = 2
+	case bytes.HasPrefix(raw, envelopeMagicV1):
+		version = 1
+	default:
+		return raw, TileMetadata{}, nil
+	}
+	rest := raw[len(envelopeMagic):]
+
+	var meta TileMetadata
+	var err error
+	if meta.ContentType, rest, err = readString(rest); err != nil {
+		return nil, TileMetadata{}, err
+	}
+	if meta.ETag, rest, err = readString(rest); err != nil {
+		return nil, TileMetadata{}, err
+	}
+	storedAt, n := binary.Varint(rest)
+	if n <= 0 {
+		return nil, TileMetadata{}, fmt.Errorf("%w: stored_at", ErrInvalidEnvelope)
+	}
+	if storedAt != 0 {
+		meta.StoredAt = time.Unix(0, storedAt)
+	}
+	rest = rest[n:]
+	if version == 1 {
+		return rest, meta, nil
+	}
+	if meta.Source, rest, err = readString(rest); err != nil {
+		return nil, TileMetadata{}, err
+	}
+	if version == 2 {
+		return rest, meta, nil
+	}
+	lastModified, n := binary.Varint(rest)
+	if n <= 0 {
+		return nil, TileMetadata{}, fmt.Errorf("%w: last_modified", ErrInvalidEnvelope)
+	}
+	if lastModified != 0 {
+		meta.LastModified = time.Unix(lastModified, 0)
+	}
+	rest = rest[n:]
+	if meta.UpstreamETag, rest, err = readString(rest); err != nil {
+		return nil, TileMetadata{}, err
+	}
+
+	return rest, meta, nil
+}
+
+func readString(b []byte) (string, []byte, error) {
+	length, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < length {
+		return "", nil, fmt.Errorf("%w: truncated field", ErrInvalidEnvelope)
+	}
+	end := n + int(length)
+	return string(b[n:end]), b[end:], nil
+}
+
+// EnvelopeCache stores tiles in another backend through a ValueCodec,
+// recording metadata on Set. It works with any backend since the backend
+// only sees opaque bytes. The ETag is hashed once on Set so hits can answer
+// conditional requests without rehashing the tile.
+type EnvelopeCache struct {
+	inner TileCache
+	codec ValueCodec
+	now   func() time.Time
+	etag  func([]byte) string
+}
+
+func NewEnvelopeCache(inner TileCache, codec ValueCodec) *EnvelopeCache {
+	return &EnvelopeCache{
+		inner: inner,
+		codec: codec,
+		now:   time.Now,
+		etag:  ContentETag,
+	}
+}
+
+var _ TileCache = (*EnvelopeCache)(nil)
+var _ TimestampedTileCache = (*EnvelopeCache)(nil)
+var _ Deleter = (*EnvelopeCache)(nil)
+var _ Haser = (*EnvelopeCache)(nil)
+var _ Iterator = (*EnvelopeCache)(nil)
+var _ AccessTracker = (*EnvelopeCache)(nil)
+var _ Purger = (*EnvelopeCache)(nil)
+var _ StatsReporter = (*EnvelopeCache)(nil)
+var _ MetadataTileCache = (*EnvelopeCache)(nil)
+var _ UpstreamTileCache = (*EnvelopeCache)(nil)
+
+func (c *EnvelopeCache) Get(k TileCacheKey) (TileCacheValue, bool, error) {
+	data, _, exists, err := c.GetWithMetadata(k)
+	return data, exists, err
+}
+
+// GetWithMetadata returns the tile with the metadata recorded when it was
+// stored. When the backend tracks store times itself, they fill in for
+// values stored without metadata.
+func (c *EnvelopeCache) GetWithMetadata(k TileCacheKey) (TileCacheValue, TileMetadata, bool, error) {
+	var (
+		raw      TileCacheValue
+		storedAt time.Time
+		exists   bool
+		err      error
+	)
+	if tc, ok := c.inner.(TimestampedTileCache); ok {
+		raw, storedAt, exists, err = tc.GetWithStoredAt(k)
+	} else {
+		raw, exists, err = c.inner.Get(k)
+	}
+	if err != nil || !exists {
+		return nil, TileMetadata{}, exists, err
+	}
+
+	data, meta, err := c.codec.Decode(raw)
+	if err != nil {
+		return nil, TileMetadata{}, false, err
+	}
+	if meta.StoredAt.IsZero() {
+		meta.StoredAt = storedAt
+	}
+	return data, meta, true, nil
+}
+
+func (c *EnvelopeCache) GetWithStoredAt(k TileCacheKey) (TileCacheValue, time.Time, bool, error) {
+	data, meta, exists, err := c.GetWithMetadata(k)
+	return data, meta.StoredAt, exists, err
+}
+
+func (c *EnvelopeCache) Set(k TileCacheKey, v TileCacheValue) error {
+	return c.SetWithUpstream(k, v, UpstreamInfo{})
+}
+
+// SetWithUpstream stores the tile with its metadata, including where it was
+// fetched from.
+func (c *EnvelopeCache) SetWithUpstream(k TileCacheKey, v TileCacheValue, up UpstreamInfo) error {
+	raw, err := c.codec.Encode(v, TileMetadata{
+		ContentType:  http.DetectContentType(v),
+		ETag:         c.etag(v),
+		StoredAt:     c.now(),
+		Source:       up.Source,
+		UpstreamETag: up.ETag,
+		LastModified: up.LastModified,
+	})
+	if err != nil {
+		return err
+	}
+	return c.inner.Set(k, raw)
+}
+
+func (c *EnvelopeCache) Delete(k TileCacheKey) error {
+	d, ok := c.inner.(Deleter)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return d.Delete(k)
+}
+
+// Iterate passes through to the backend, so sizes include the envelope.
+func (c *EnvelopeCache) Iterate(fn func(TileCacheKey, EntryInfo) bool) error {
+	it, ok := c.inner.(Iterator)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return it.Iterate(fn)
+}
+
+// Purge passes through to the backend.
+func (c *EnvelopeCache) Purge(f PurgeFilter) (int64, error) {
+	p, ok := c.inner.(Purger)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	return p.Purge(f)
+}
+
+// Stats passes through to the backend.
+func (c *EnvelopeCache) Stats() (Stats, error) {
+	sr, ok := c.inner.(StatsReporter)
+	if !ok {
+		return Stats{}, errors.ErrUnsupported
+	}
+	return sr.Stats()
+}
+
+// IterateAccess passes through to the backend.
+func (c *EnvelopeCache) IterateAccess(fn func(TileCacheKey, AccessInfo) bool) error {
+	at, ok := c.inner.(AccessTracker)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return at.IterateAccess(fn)
+}
+
+func (c *EnvelopeCache) Has(k TileCacheKey) (bool, error) {
+	if h, ok := c.inner.(Haser); ok {
+		return h.Has(k)
+	}
+	_, exists, err := c.inner.Get(k)
+	return exists, err
+}
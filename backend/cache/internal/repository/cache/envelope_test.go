@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+// pngTile starts like a real PNG so content type detection has something to go on
+var pngTile = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0x42}, 64)...)
+
+func TestEnvelopeCodec_RoundTrip(t *testing.T) {
+	meta := TileMetadata{
+		ContentType:  "image/png",
+		ETag:         `"0123456789abcdef"`,
+		StoredAt:     time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+		Source:       "https://tile.openstreetmap.org/5/10/12.png",
+		UpstreamETag: `W/"upstream-1"`,
+		LastModified: time.Date(2026, 10, 1, 8, 30, 0, 0, time.UTC),
+	}
+
+	raw, err := EnvelopeCodec{}.Encode(pngTile, meta)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	data, got, err := EnvelopeCodec{}.Decode(raw)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+
+	if !bytes.Equal(data, pngTile) {
+		t.Fatal("tile bytes changed in the round trip")
+	}
+	if got.ContentType != meta.ContentType || got.ETag != meta.ETag || !got.StoredAt.Equal(meta.StoredAt) || got.Source != meta.Source ||
+		got.UpstreamETag != meta.UpstreamETag || !got.LastModified.Equal(meta.LastModified) {
+		t.Fatalf("metadata %+v, want %+v", got, meta)
+	}
+}
+
+func TestEnvelopeCodec_DecodesVersion2(t *testing.T) {
+	// magic | "image/png" | no etag | stored_at 1ns | source "s" | data,
+	// without the upstream validators
+	raw := append([]byte("GHT\x02\x09image/png\x00\x02\x01s"), pngTile...)
+
+	data, meta, err := EnvelopeCodec{}.Decode(raw)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !bytes.Equal(data, pngTile) || meta.Source != "s" || meta.UpstreamETag != "" || !meta.LastModified.IsZero() {
+		t.Fatalf("expected the version 2 tile and metadata, got %d bytes and %+v", len(data), meta)
+	}
+}
+
+func TestEnvelopeCodec_DecodesVersion1(t *testing.T) {
+	// magic | "image/png" | no etag | stored_at 1ns | data, without a source
+	raw := append([]byte("GHT\x01\x09image/png\x00\x02"), pngTile...)
+
+	data, meta, err := EnvelopeCodec{}.Decode(raw)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !bytes.Equal(data, pngTile) || meta.ContentType != "image/png" || meta.StoredAt.UnixNano() != 1 || meta.Source != "" {
+		t.Fatalf("expected the version 1 tile and metadata, got %d bytes and %+v", len(data), meta)
+	}
+}
+
+func TestEnvelopeCodec_DecodesLegacyRawValue(t *testing.T) {
+	data, meta, err := EnvelopeCodec{}.Decode(pngTile)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !bytes.Equal(data, pngTile) || meta != (TileMetadata{}) {
+		t.Fatalf("expected the raw tile without metadata, got %d bytes and %+v", len(data), meta)
+	}
+}
+
+func TestEnvelopeCodec_RejectsTruncatedEnvelope(t *testing.T) {
+	raw, _ := EnvelopeCodec{}.Encode(pngTile, TileMetadata{ContentType: "image/png"})
+	if _, _, err := (EnvelopeCodec{}).Decode(raw[:len(envelopeMagic)+3]); err == nil {
+		t.Fatal("expected an error for a truncated envelope")
+	}
+}
+
+func TestEnvelopeCache_RecordsMetadataAndReadsLegacyValues(t *testing.T) {
+	inner := NewMapCache(logger.FromContext(context.Background()))
+	c := NewEnvelopeCache(inner, EnvelopeCodec{})
+	storedAt := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return storedAt }
+
+	fresh := TileCacheKey{X: 1, Y: 2, Z: 3}
+	if err := c.Set(fresh, pngTile); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	data, meta, ok, err := c.GetWithMetadata(fresh)
+	if err != nil || !ok || !bytes.Equal(data, pngTile) {
+		t.Fatalf("expected the stored tile, got ok=%v err=%v", ok, err)
+	}
+	if meta.ContentType != "image/png" || meta.ETag == "" || !meta.StoredAt.Equal(storedAt) {
+		t.Fatalf("unexpected metadata %+v", meta)
+	}
+
+	// Written by a raw-format instance before the switch
+	legacy := TileCacheKey{X: 4, Y: 5, Z: 6}
+	inner.Set(legacy, pngTile)
+	data, ok, err = c.Get(legacy)
+	if err != nil || !ok || !bytes.Equal(data, pngTile) {
+		t.Fatalf("expected the legacy tile, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestEnvelopeCache_PrecomputesETag(t *testing.T) {
+	c := NewEnvelopeCache(NewMapCache(logger.FromContext(context.Background())), EnvelopeCodec{})
+	var hashed int
+	c.etag = func(data []byte) string {
+		hashed++
+		return ContentETag(data)
+	}
+
+	k := TileCacheKey{X: 1, Y: 2, Z: 3}
+	if err := c.Set(k, pngTile); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		_, meta, ok, err := c.GetWithMetadata(k)
+		if err != nil || !ok {
+			t.Fatalf("expected the stored tile, got ok=%v err=%v", ok, err)
+		}
+		if meta.ETag != ContentETag(pngTile) {
+			t.Fatalf("ETag = %s, want the content hash %s", meta.ETag, ContentETag(pngTile))
+		}
+	}
+	if hashed != 1 {
+		t.Fatalf("expected the tile to be hashed once on set, hashed %d times", hashed)
+	}
+}
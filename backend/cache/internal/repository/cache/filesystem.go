@@ -1,23 +1,109 @@
 package cache
 
 import (
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"hash/fnv"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
 )
 
+const filesystemLockShards = 256
+
+// FilesystemLayout decides where a tile lives on disk.
+type FilesystemLayout int
+
+const (
+	// LayoutZXY stores tiles as z/x/y, mirroring the tile URL, with tiles
+	// of other layers than the default one under layer/z/x/y
+	LayoutZXY FilesystemLayout = iota
+	// LayoutHashed shards tiles into two levels of 256 directories named
+	// after a hash of the key, bounding the fan-out of every directory
+	LayoutHashed
+)
+
+// ParseFilesystemLayout returns the layout named "zxy" or "hashed".
+func ParseFilesystemLayout(name string) (FilesystemLayout, error) {
+	switch name {
+	case "", "zxy":
+		return LayoutZXY, nil
+	case "hashed":
+		return LayoutHashed, nil
+	}
+	return 0, fmt.Errorf("unknown filesystem layout %q", name)
+}
+
+type FilesystemConfig struct {
+	// Root is the directory tiles are stored under, the working directory
+	// when empty. It is created on the first Set.
+	Root   string
+	Layout FilesystemLayout
+	// MaxOpenFiles caps the files open at once across Get and Set, keeping
+	// bursts of concurrent requests below the process file descriptor limit.
+	// Zero means no limit.
+	MaxOpenFiles int
+}
+
 type FilesystemCache struct {
 	logger logger.Logger
+	root   string
+	layout FilesystemLayout
+
+	// keyLocks serialises writes per key; keys are spread over a fixed set of shards
+	keyLocks [filesystemLockShards]sync.Mutex
+	// openFiles holds a token per open file, nil when unlimited
+	openFiles chan struct{}
+	// readFile and writeFile are os.ReadFile and writeFileAtomic unless
+	// replaced in tests
+	readFile  func(name string) ([]byte, error)
+	writeFile func(name string, data []byte, perm os.FileMode) error
+}
+
+func NewFilesystemCache(cfg FilesystemConfig, l logger.Logger) *FilesystemCache {
+	root := cfg.Root
+	if root == "" {
+		root = "."
+	}
+	c := &FilesystemCache{
+		logger: l,
+		root:   root,
+		layout: cfg.Layout,
+	}
+	if cfg.MaxOpenFiles > 0 {
+		c.openFiles = make(chan struct{}, cfg.MaxOpenFiles)
+	}
+	return c
 }
 
 var _ TileCache = (*FilesystemCache)(nil)
+var _ Deleter = (*FilesystemCache)(nil)
+var _ Haser = (*FilesystemCache)(nil)
+var _ Iterator = (*FilesystemCache)(nil)
+var _ Purger = (*FilesystemCache)(nil)
 
+// Get reports a missing tile as a miss, and any other failure to read it as
+// an error.
 func (c *FilesystemCache) Get(k TileCacheKey) (TileCacheValue, bool, error) {
-	strKey := c.keyToString(k)
+	strKey := c.path(k)
 	c.logger.Debug("filesystem cache get", "path", strKey)
-	content, err := ioutil.ReadFile(strKey)
+
+	read := c.readFile
+	if read == nil {
+		read = os.ReadFile
+	}
+	c.acquireFile()
+	content, err := read(strKey)
+	c.releaseFile()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
 	if err != nil {
 		c.logger.Error("filesystem cache get failed", "path", strKey, "error", err)
 		return nil, false, err
@@ -26,16 +112,310 @@ func (c *FilesystemCache) Get(k TileCacheKey) (TileCacheValue, bool, error) {
 	return content, true, nil
 }
 
+// Set writes the tile unless a concurrent Set for the same key stored it
+// while this call was waiting for the key lock. Missing directories are
+// created, and the tile is written to a temporary file renamed into place,
+// so readers never see a partial tile.
 func (c *FilesystemCache) Set(k TileCacheKey, v TileCacheValue) error {
-	strKey := c.keyToString(k)
+	strKey := c.path(k)
 	c.logger.Debug("filesystem cache set", "path", strKey)
-	if err := os.WriteFile(strKey, v, 0644); err != nil {
+
+	before, errBefore := os.Stat(strKey)
+
+	mu := c.lockFor(strKey)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if after, err := os.Stat(strKey); err == nil && changedSince(before, errBefore, after) {
+		c.logger.Debug("filesystem cache set skipped, written concurrently", "path", strKey)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(strKey), 0755); err != nil {
+		c.logger.Error("filesystem cache set failed", "path", strKey, "error", err)
+		return err
+	}
+
+	write := c.writeFile
+	if write == nil {
+		write = writeFileAtomic
+	}
+	c.acquireFile()
+	err := write(strKey, v, 0644)
+	c.releaseFile()
+	if err != nil {
 		c.logger.Error("filesystem cache set failed", "path", strKey, "error", err)
 		return err
 	}
 	return nil
 }
 
+func (c *FilesystemCache) Has(k TileCacheKey) (bool, error) {
+	strKey := c.path(k)
+	if _, err := os.Stat(strKey); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		c.logger.Error("filesystem cache has failed", "path", strKey, "error", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *FilesystemCache) Delete(k TileCacheKey) error {
+	strKey := c.path(k)
+	c.logger.Debug("filesystem cache delete", "path", strKey)
+
+	mu := c.lockFor(strKey)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := os.Remove(strKey); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		c.logger.Error("filesystem cache delete failed", "path", strKey, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Iterate walks the tile directories. Files and directories that are not
+// laid out like tiles are skipped, since tiles may share the root with
+// whatever else lives there, as well as temporary files of writes in
+// progress. Store times are file modification times.
+func (c *FilesystemCache) Iterate(fn func(TileCacheKey, EntryInfo) bool) error {
+	err := c.walk(func(rel string, d fs.DirEntry) error {
+		k, isTile, descend := c.parsePath(rel, d.IsDir())
+		if d.IsDir() {
+			if !descend {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isTile {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !fn(k, EntryInfo{Size: info.Size(), StoredAt: info.ModTime()}) {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		c.logger.Error("filesystem cache iterate failed", "error", err)
+	}
+	return err
+}
+
+// Purge walks the tile directories and removes the matching tiles. With the
+// z/x/y layout, zoom and column directories outside the filter are skipped
+// without being read.
+func (c *FilesystemCache) Purge(f PurgeFilter) (int64, error) {
+	var removed int64
+	err := c.walk(func(rel string, d fs.DirEntry) error {
+		k, isTile, descend := c.parsePath(rel, d.IsDir())
+		if d.IsDir() {
+			if !descend || !c.mayContain(rel, f) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isTile || !f.Matches(k) {
+			return nil
+		}
+
+		if err := c.Delete(k); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		c.logger.Error("filesystem cache purge failed", "removed", removed, "error", err)
+	}
+	return removed, err
+}
+
+// walk calls fn for everything under the root with its slash-separated
+// path relative to the root. A root that does not exist yet holds no tiles.
+func (c *FilesystemCache) walk(fn func(rel string, d fs.DirEntry) error) error {
+	err := filepath.WalkDir(c.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(c.root, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		return fn(filepath.ToSlash(rel), d)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		if _, statErr := os.Stat(c.root); errors.Is(statErr, fs.ErrNotExist) {
+			return nil
+		}
+	}
+	return err
+}
+
+// mayContain reports whether a tile directory accepted by parsePath can hold
+// tiles matching the filter. Hashed shards can hold any tile.
+func (c *FilesystemCache) mayContain(dir string, f PurgeFilter) bool {
+	if c.layout == LayoutHashed {
+		return true
+	}
+	if layer, rest, _ := strings.Cut(dir, "/"); tilemath.ValidateLayer(layer) == nil {
+		if rest == "" {
+			return true
+		}
+		dir = rest
+	}
+	zStr, xStr, isColumn := strings.Cut(dir, "/")
+	z, _ := tilemath.ParseCoord(zStr)
+	if z < f.MinZ || z > f.MaxZ {
+		return false
+	}
+	if !isColumn || f.BBox == nil {
+		return true
+	}
+	x, _ := tilemath.ParseCoord(xStr)
+	nw, se := tilemath.TileRange(*f.BBox, z)
+	return x >= nw.X && x <= se.X
+}
+
+// parsePath reverses keyToString. For directories it reports whether they
+// can contain tiles.
+func (c *FilesystemCache) parsePath(path string, dir bool) (k TileCacheKey, isTile, descend bool) {
+	parts := strings.Split(path, "/")
+
+	if c.layout == LayoutHashed {
+		if dir {
+			return TileCacheKey{}, false, len(parts) <= 2 && isShard(parts[len(parts)-1])
+		}
+		if len(parts) != 3 {
+			return TileCacheKey{}, false, false
+		}
+		k, err := ParseTileCacheKey(strings.ReplaceAll(parts[2], "_", "/"))
+		if err != nil || c.keyToString(k) != path {
+			return TileCacheKey{}, false, false
+		}
+		return k, true, false
+	}
+
+	// Tiles outside the default layer live under a directory named after
+	// their layer
+	var layer string
+	if tilemath.ValidateLayer(parts[0]) == nil {
+		layer, parts = parts[0], parts[1:]
+		if len(parts) == 0 {
+			return TileCacheKey{}, false, dir
+		}
+	}
+	if dir {
+		if len(parts) > 2 {
+			return TileCacheKey{}, false, false
+		}
+		_, err := tilemath.ParseCoord(parts[len(parts)-1])
+		return TileCacheKey{}, false, err == nil
+	}
+	t, err := tilemath.ParseKey(strings.Join(parts, "/"))
+	if err != nil {
+		return TileCacheKey{}, false, false
+	}
+	return TileCacheKey{Z: t.Z, X: t.X, Y: t.Y, Layer: layer}, true, false
+}
+
+// isShard reports whether name is a two digit lowercase hex directory.
+func isShard(name string) bool {
+	if len(name) != 2 {
+		return false
+	}
+	for _, r := range name {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// acquireFile blocks until another file may be opened.
+func (c *FilesystemCache) acquireFile() {
+	if c.openFiles != nil {
+		c.openFiles <- struct{}{}
+	}
+}
+
+func (c *FilesystemCache) releaseFile() {
+	if c.openFiles != nil {
+		<-c.openFiles
+	}
+}
+
+func (c *FilesystemCache) lockFor(strKey string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(strKey))
+	return &c.keyLocks[h.Sum32()%filesystemLockShards]
+}
+
+// writeFileAtomic writes data to a temporary file next to name and renames
+// it over name, replacing any previous file in one step.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// changedSince reports whether the file was created or rewritten between
+// the two stat calls.
+func changedSince(before fs.FileInfo, errBefore error, after fs.FileInfo) bool {
+	if errors.Is(errBefore, fs.ErrNotExist) {
+		return true
+	}
+	if errBefore != nil {
+		return false
+	}
+	return !after.ModTime().Equal(before.ModTime()) || after.Size() != before.Size()
+}
+
+// path returns where the tile lives on disk.
+func (c *FilesystemCache) path(k TileCacheKey) string {
+	return filepath.Join(c.root, filepath.FromSlash(c.keyToString(k)))
+}
+
+// keyToString returns the slash-separated path of a tile relative to the
+// root.
 func (c *FilesystemCache) keyToString(k TileCacheKey) string {
-	return fmt.Sprintf("%d/%d/%d", k.Z, k.X, k.Y)
+	if c.layout == LayoutHashed {
+		h := fnv.New64a()
+		io.WriteString(h, k.String())
+		sum := h.Sum64()
+		name := strings.ReplaceAll(k.String(), "/", "_")
+		return fmt.Sprintf("%02x/%02x/%s", byte(sum>>56), byte(sum>>48), name)
+	}
+	return k.String()
 }
@@ -0,0 +1,342 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+)
+
+func newTestFilesystemCache(t *testing.T) *FilesystemCache {
+	t.Helper()
+
+	return NewFilesystemCache(FilesystemConfig{Root: t.TempDir()}, logger.FromContext(context.Background()))
+}
+
+func TestFilesystemCache_ConcurrentSetsWriteOnce(t *testing.T) {
+	c := newTestFilesystemCache(t)
+
+	var writes atomic.Int64
+	c.writeFile = func(name string, data []byte, perm os.FileMode) error {
+		writes.Add(1)
+		// Keep the first writer busy so the others queue up on the key lock
+		time.Sleep(50 * time.Millisecond)
+		return writeFileAtomic(name, data, perm)
+	}
+
+	k := TileCacheKey{Z: 12, X: 100, Y: 200}
+	const writers = 16
+
+	var start, wg sync.WaitGroup
+	start.Add(1)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start.Wait()
+			if err := c.Set(k, []byte("tile")); err != nil {
+				t.Errorf("Set failed: %v", err)
+			}
+		}()
+	}
+	start.Done()
+	wg.Wait()
+
+	if got := writes.Load(); got != 1 {
+		t.Fatalf("expected a single file write, got %d", got)
+	}
+
+	data, _, err := c.Get(k)
+	if err != nil || string(data) != "tile" {
+		t.Fatalf("unexpected content %q: %v", data, err)
+	}
+}
+
+func TestFilesystemCache_SequentialSetOverwrites(t *testing.T) {
+	c := newTestFilesystemCache(t)
+
+	k := TileCacheKey{Z: 1, X: 0, Y: 0}
+	for _, v := range []string{"old", "new"} {
+		if err := c.Set(k, []byte(v)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	data, _, err := c.Get(k)
+	if err != nil || string(data) != "new" {
+		t.Fatalf("expected overwritten tile, got %q: %v", data, err)
+	}
+}
+
+func TestFilesystemCache_HashedLayout(t *testing.T) {
+	root := t.TempDir()
+	c := NewFilesystemCache(FilesystemConfig{Root: root, Layout: LayoutHashed}, logger.FromContext(context.Background()))
+
+	var keys []TileCacheKey
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			keys = append(keys, TileCacheKey{Z: 16, X: 30000 + x, Y: 20000 + y})
+		}
+	}
+	for _, k := range keys {
+		if err := c.Set(k, []byte(c.keyToString(k))); err != nil {
+			t.Fatalf("Set %+v failed: %v", k, err)
+		}
+	}
+	for _, k := range keys {
+		data, ok, err := c.Get(k)
+		if err != nil || !ok || string(data) != c.keyToString(k) {
+			t.Fatalf("Get %+v = %q, %v, %v", k, data, ok, err)
+		}
+	}
+
+	// Every tile sits exactly two shard directories deep and no directory
+	// holds more than 256 shards
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		depth := strings.Count(filepath.ToSlash(rel), "/")
+		if !d.IsDir() {
+			if depth != 2 {
+				t.Errorf("tile %s is not two directories deep", path)
+			}
+			return nil
+		}
+		if rel == "." || depth == 0 {
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return err
+			}
+			if len(entries) > 256 {
+				t.Errorf("directory %s has %d entries", path, len(entries))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+
+	if err := c.Delete(keys[0]); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := os.Stat(c.path(keys[0])); !os.IsNotExist(err) {
+		t.Fatalf("tile still on disk after Delete: %v", err)
+	}
+	if err := c.Delete(keys[0]); err != nil {
+		t.Fatalf("Delete of missing tile failed: %v", err)
+	}
+}
+
+func TestFilesystemCache_MaxOpenFiles(t *testing.T) {
+	const maxOpen = 3
+	c := NewFilesystemCache(FilesystemConfig{Root: t.TempDir(), Layout: LayoutHashed, MaxOpenFiles: maxOpen}, logger.FromContext(context.Background()))
+
+	var open, peak atomic.Int64
+	track := func() func() {
+		n := open.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		// Hold the file long enough for the other goroutines to pile up
+		time.Sleep(5 * time.Millisecond)
+		return func() { open.Add(-1) }
+	}
+	c.writeFile = func(name string, data []byte, perm os.FileMode) error {
+		defer track()()
+		return writeFileAtomic(name, data, perm)
+	}
+	c.readFile = func(name string) ([]byte, error) {
+		defer track()()
+		return os.ReadFile(name)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			k := TileCacheKey{Z: 10, X: i, Y: i}
+			if err := c.Set(k, []byte("tile")); err != nil {
+				t.Errorf("Set failed: %v", err)
+				return
+			}
+			if _, _, err := c.Get(k); err != nil {
+				t.Errorf("Get failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > maxOpen {
+		t.Fatalf("expected at most %d files open at once, got %d", maxOpen, got)
+	}
+	if got := peak.Load(); got < 2 {
+		t.Fatalf("expected files to be opened concurrently, peak was %d", got)
+	}
+}
+
+func TestFilesystemCache_Purge(t *testing.T) {
+	for _, layout := range []FilesystemLayout{LayoutZXY, LayoutHashed} {
+		root := t.TempDir()
+		c := NewFilesystemCache(FilesystemConfig{Root: root, Layout: layout}, logger.FromContext(context.Background()))
+
+		// x,y in 1..2 cover the box at zoom 2 and 3..4 at zoom 3
+		inside := []TileCacheKey{{Z: 2, X: 1, Y: 1}, {Z: 2, X: 2, Y: 2}, {Z: 3, X: 4, Y: 3}}
+		outside := []TileCacheKey{{Z: 2, X: 0, Y: 0}, {Z: 3, X: 5, Y: 3}, {Z: 4, X: 7, Y: 7}}
+		for _, k := range append(inside, outside...) {
+			if err := c.Set(k, []byte("tile")); err != nil {
+				t.Fatalf("Set %+v failed: %v", k, err)
+			}
+		}
+		// Not a tile, must survive any purge
+		notes := filepath.Join(root, "2_notes.txt")
+		if err := os.WriteFile(notes, []byte("keep"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		bbox := tilemath.BBox{West: -10, South: -10, East: 10, North: 10}
+		removed, err := c.Purge(PurgeFilter{MinZ: 2, MaxZ: 3, BBox: &bbox})
+		if err != nil {
+			t.Fatalf("layout %d: Purge failed: %v", layout, err)
+		}
+		if removed != int64(len(inside)) {
+			t.Fatalf("layout %d: removed %d tiles, want %d", layout, removed, len(inside))
+		}
+		for _, k := range inside {
+			if exists, _ := c.Has(k); exists {
+				t.Errorf("layout %d: tile %+v should be purged", layout, k)
+			}
+		}
+		for _, k := range outside {
+			if exists, _ := c.Has(k); !exists {
+				t.Errorf("layout %d: tile %+v should be kept", layout, k)
+			}
+		}
+
+		removed, err = c.Purge(PurgeFilter{MinZ: 0, MaxZ: tilemath.MaxZoom})
+		if err != nil || removed != int64(len(outside)) {
+			t.Fatalf("layout %d: purging everything removed %d tiles, %v", layout, removed, err)
+		}
+		if _, err := os.Stat(notes); err != nil {
+			t.Fatalf("layout %d: purge removed a file that is not a tile: %v", layout, err)
+		}
+	}
+}
+
+func TestFilesystemCache_CreatesRootAndDirectories(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "tiles")
+	c := NewFilesystemCache(FilesystemConfig{Root: root}, logger.FromContext(context.Background()))
+
+	k := TileCacheKey{Z: 14, X: 9000, Y: 5000}
+	if data, ok, err := c.Get(k); err != nil || ok {
+		t.Fatalf("Get before the root exists = %q, %v, %v", data, ok, err)
+	}
+	if err := c.Iterate(func(TileCacheKey, EntryInfo) bool { return true }); err != nil {
+		t.Fatalf("Iterate before the root exists failed: %v", err)
+	}
+
+	if err := c.Set(k, []byte("tile")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "14", "9000", "5000")); err != nil {
+		t.Fatalf("tile not stored under the root: %v", err)
+	}
+
+	// Only the tile is left behind, no temporary files
+	entries, err := os.ReadDir(filepath.Join(root, "14", "9000"))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected a single file in the column directory, got %v: %v", entries, err)
+	}
+}
+
+func TestFilesystemCache_GetReportsReadErrors(t *testing.T) {
+	c := newTestFilesystemCache(t)
+	k := TileCacheKey{Z: 1, X: 1, Y: 1}
+
+	// A directory where the tile should be cannot be read as one
+	if err := os.MkdirAll(c.path(k), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := c.Get(k); err == nil || ok {
+		t.Fatalf("expected a read error, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestFilesystemCache_FailedWriteKeepsPreviousTile(t *testing.T) {
+	c := newTestFilesystemCache(t)
+	k := TileCacheKey{Z: 3, X: 2, Y: 1}
+	if err := c.Set(k, []byte("old")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// Make the column directory read-only so the temporary file cannot be
+	// created
+	dir := filepath.Dir(c.path(k))
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0755) })
+	if f, err := os.CreateTemp(dir, "probe"); err == nil {
+		f.Close()
+		os.Remove(f.Name())
+		t.Skip("directory permissions are not enforced, e.g. running as root")
+	}
+
+	if err := c.Set(k, []byte("new, larger")); err == nil {
+		t.Fatal("expected Set to fail")
+	}
+	if data, ok, err := c.Get(k); err != nil || !ok || string(data) != "old" {
+		t.Fatalf("expected the previous tile to survive, got %q, %v, %v", data, ok, err)
+	}
+}
+
+func TestFilesystemCache_Layers(t *testing.T) {
+	for name, layout := range map[string]FilesystemLayout{"zxy": LayoutZXY, "hashed": LayoutHashed} {
+		t.Run(name, func(t *testing.T) {
+			c := NewFilesystemCache(FilesystemConfig{Root: t.TempDir(), Layout: layout}, logger.FromContext(context.Background()))
+
+			keys := []TileCacheKey{{Z: 5, X: 10, Y: 12}, {Z: 5, X: 10, Y: 12, Layer: "cyclosm"}}
+			for _, k := range keys {
+				if err := c.Set(k, []byte(k.String())); err != nil {
+					t.Fatalf("Set %+v failed: %v", k, err)
+				}
+			}
+			for _, k := range keys {
+				data, ok, err := c.Get(k)
+				if err != nil || !ok || string(data) != k.String() {
+					t.Fatalf("Get %+v = %q, %v, %v", k, data, ok, err)
+				}
+			}
+
+			var listed []TileCacheKey
+			if err := c.Iterate(func(k TileCacheKey, _ EntryInfo) bool {
+				listed = append(listed, k)
+				return true
+			}); err != nil {
+				t.Fatalf("Iterate failed: %v", err)
+			}
+			if len(listed) != 2 || !slices.Contains(listed, keys[0]) || !slices.Contains(listed, keys[1]) {
+				t.Fatalf("listed %+v, want %+v", listed, keys)
+			}
+
+			removed, err := c.Purge(PurgeFilter{MinZ: 5, MaxZ: 5})
+			if err != nil || removed != 2 {
+				t.Fatalf("Purge removed %d, %v, want both layers' tiles", removed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+//go:build redis
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	invalidationMinBackoff = 100 * time.Millisecond
+	invalidationMaxBackoff = 30 * time.Second
+)
+
+// InvalidationSubscriber listens on a Redis pub/sub channel for tiles
+// invalidated by cache instances, itself included, and passes each
+// invalidation to onInvalidate. It also publishes them.
+type InvalidationSubscriber struct {
+	client       *redis.Client
+	channel      string
+	onInvalidate func(Invalidation)
+	logger       logger.Logger
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	// subscribed is signalled every time a subscription is confirmed by Redis
+	subscribed chan struct{}
+}
+
+func NewInvalidationSubscriber(client *redis.Client, channel string, onInvalidate func(Invalidation), l logger.Logger) *InvalidationSubscriber {
+	return &InvalidationSubscriber{
+		client:       client,
+		channel:      channel,
+		onInvalidate: onInvalidate,
+		logger:       l,
+		minBackoff:   invalidationMinBackoff,
+		maxBackoff:   invalidationMaxBackoff,
+	}
+}
+
+// Publish announces that tiles were removed and cached copies must be
+// dropped.
+func (s *InvalidationSubscriber) Publish(ctx context.Context, inv Invalidation) error {
+	payload, err := invalidationPayload(inv)
+	if err != nil {
+		return err
+	}
+	if err := s.client.Publish(ctx, s.channel, payload).Err(); err != nil {
+		return fmt.Errorf("redis publish error: %w", err)
+	}
+	return nil
+}
+
+// Run blocks until ctx is cancelled, resubscribing with exponential backoff
+// whenever the pub/sub connection drops.
+func (s *InvalidationSubscriber) Run(ctx context.Context) {
+	backoff := s.minBackoff
+	for {
+		confirmed, err := s.subscribe(ctx)
+		if ctx.Err() != nil {
+			s.logger.Info("invalidation subscriber stopped", "channel", s.channel)
+			return
+		}
+		if confirmed {
+			backoff = s.minBackoff
+		}
+
+		s.logger.Warn("invalidation subscription lost, reconnecting", "channel", s.channel, "backoff", backoff, "error", err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.logger.Info("invalidation subscriber stopped", "channel", s.channel)
+			return
+		case <-timer.C:
+		}
+
+		backoff = min(backoff*2, s.maxBackoff)
+	}
+}
+
+// subscribe consumes messages until the connection fails or ctx is cancelled.
+// It reports whether Redis confirmed the subscription before the failure.
+func (s *InvalidationSubscriber) subscribe(ctx context.Context) (bool, error) {
+	pubsub := s.client.Subscribe(ctx, s.channel)
+
+	var closeOnce sync.Once
+	release := func() {
+		closeOnce.Do(func() {
+			// ctx may already be cancelled, so unsubscribe on a short detached deadline
+			unsubCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := pubsub.Unsubscribe(unsubCtx, s.channel); err != nil {
+				s.logger.Debug("invalidation unsubscribe failed", "channel", s.channel, "error", err)
+			}
+			if err := pubsub.Close(); err != nil {
+				s.logger.Debug("invalidation pubsub close failed", "channel", s.channel, "error", err)
+			}
+		})
+	}
+	defer release()
+
+	// A blocked ReceiveMessage does not observe ctx, closing the pubsub unblocks it
+	stop := context.AfterFunc(ctx, release)
+	defer stop()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return false, err
+	}
+	s.logger.Info("subscribed to tile invalidations", "channel", s.channel)
+	if s.subscribed != nil {
+		s.subscribed <- struct{}{}
+	}
+
+	for {
+		msg, err := pubsub.ReceiveMessage(ctx)
+		if err != nil {
+			return true, err
+		}
+
+		inv, err := parseInvalidationPayload(msg.Payload)
+		if err != nil {
+			s.logger.Warn("ignoring malformed invalidation", "payload", msg.Payload, "error", err)
+			continue
+		}
+
+		s.logger.Debug("tiles invalidated", "payload", msg.Payload)
+		s.onInvalidate(inv)
+	}
+}
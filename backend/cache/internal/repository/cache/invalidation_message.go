@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Invalidation announces tiles removed from a backend shared by several
+// cache instances, so each drops the copies it keeps locally: the tile at
+// Key, or every tile matching Purge when it is set.
+type Invalidation struct {
+	Key   TileCacheKey
+	Purge *PurgeFilter
+}
+
+// Matches reports whether the invalidation covers the tile.
+func (inv Invalidation) Matches(k TileCacheKey) bool {
+	if inv.Purge != nil {
+		return inv.Purge.Matches(k)
+	}
+	return k == inv.Key
+}
+
+// purgePayloadPrefix starts the payload of a purge, followed by its filter
+// as JSON. Tile keys cannot start with it.
+const purgePayloadPrefix = "purge "
+
+func invalidationPayload(inv Invalidation) (string, error) {
+	if inv.Purge == nil {
+		return inv.Key.String(), nil
+	}
+	filter, err := json.Marshal(inv.Purge)
+	if err != nil {
+		return "", err
+	}
+	return purgePayloadPrefix + string(filter), nil
+}
+
+func parseInvalidationPayload(payload string) (Invalidation, error) {
+	if filter, ok := strings.CutPrefix(payload, purgePayloadPrefix); ok {
+		var f PurgeFilter
+		if err := json.Unmarshal([]byte(filter), &f); err != nil {
+			return Invalidation{}, fmt.Errorf("invalid purge filter: %w", err)
+		}
+		return Invalidation{Purge: &f}, nil
+	}
+	k, err := ParseTileCacheKey(payload)
+	if err != nil {
+		return Invalidation{}, err
+	}
+	return Invalidation{Key: k}, nil
+}
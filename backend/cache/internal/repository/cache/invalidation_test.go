@@ -0,0 +1,161 @@
+//go:build redis
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestSubscriber(t *testing.T, mr *miniredis.Miniredis, received chan Invalidation) *InvalidationSubscriber {
+	t.Helper()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	l := logger.FromContext(context.Background())
+	s := NewInvalidationSubscriber(client, "tiles:invalidate", func(inv Invalidation) {
+		received <- inv
+	}, l)
+	s.minBackoff = 10 * time.Millisecond
+	s.maxBackoff = 50 * time.Millisecond
+	s.subscribed = make(chan struct{}, 10)
+	return s
+}
+
+func waitSubscribed(t *testing.T, s *InvalidationSubscriber) {
+	t.Helper()
+	select {
+	case <-s.subscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriber did not subscribe in time")
+	}
+}
+
+func TestInvalidationSubscriber_StopsOnContextCancel(t *testing.T) {
+	mr := miniredis.RunT(t)
+	received := make(chan Invalidation, 1)
+	s := newTestSubscriber(t, mr, received)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	waitSubscribed(t, s)
+
+	mr.Publish("tiles:invalidate", "3/4/5")
+	select {
+	case inv := <-received:
+		if inv.Key != (TileCacheKey{Z: 3, X: 4, Y: 5}) || inv.Purge != nil {
+			t.Fatalf("unexpected invalidation: %+v", inv)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("invalidation not delivered")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriber did not stop after context cancel")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(mr.PubSubChannels("")) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscription still active after stop")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestInvalidationSubscriber_ResubscribesAfterDisconnect(t *testing.T) {
+	mr := miniredis.RunT(t)
+	received := make(chan Invalidation, 1)
+	s := newTestSubscriber(t, mr, received)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	waitSubscribed(t, s)
+
+	// Drop every connection, then bring the server back on the same address
+	mr.Close()
+	if err := mr.Restart(); err != nil {
+		t.Fatalf("failed to restart redis: %v", err)
+	}
+	waitSubscribed(t, s)
+
+	mr.Publish("tiles:invalidate", "10/20/30")
+	select {
+	case inv := <-received:
+		if inv.Key != (TileCacheKey{Z: 10, X: 20, Y: 30}) {
+			t.Fatalf("unexpected invalidation: %+v", inv)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("invalidation not delivered after resubscribe")
+	}
+}
+
+func TestInvalidationSubscriber_PublishesToOthers(t *testing.T) {
+	mr := miniredis.RunT(t)
+	received := make(chan Invalidation, 1)
+	s := newTestSubscriber(t, mr, received)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	waitSubscribed(t, s)
+
+	publisher := newTestSubscriber(t, mr, make(chan Invalidation))
+	purge := PurgeFilter{MinZ: 3, MaxZ: 5}
+	if err := publisher.Publish(ctx, Invalidation{Purge: &purge}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	select {
+	case inv := <-received:
+		if inv.Purge == nil || *inv.Purge != purge {
+			t.Fatalf("unexpected invalidation: %+v", inv)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("invalidation not delivered")
+	}
+}
+
+func TestInvalidationPayload_RoundTrip(t *testing.T) {
+	for _, k := range []TileCacheKey{{Z: 12, X: 2048, Y: 1361}, {Z: 12, X: 2048, Y: 1361, Layer: "cyclosm"}} {
+		payload, err := invalidationPayload(Invalidation{Key: k})
+		if err != nil {
+			t.Fatalf("payload failed: %v", err)
+		}
+		got, err := parseInvalidationPayload(payload)
+		if err != nil {
+			t.Fatalf("parse failed: %v", err)
+		}
+		if got.Key != k || got.Purge != nil {
+			t.Fatalf("got %+v, want %+v", got, k)
+		}
+	}
+
+	bbox := tilemath.BBox{West: 37.3, South: 55.5, East: 37.9, North: 55.9}
+	payload, err := invalidationPayload(Invalidation{Purge: &PurgeFilter{MinZ: 10, MaxZ: 14, BBox: &bbox}})
+	if err != nil {
+		t.Fatalf("payload failed: %v", err)
+	}
+	got, err := parseInvalidationPayload(payload)
+	if err != nil || got.Purge == nil || got.Purge.MinZ != 10 || got.Purge.MaxZ != 14 || *got.Purge.BBox != bbox {
+		t.Fatalf("purge round trip gave %+v, %v", got.Purge, err)
+	}
+
+	if _, err := parseInvalidationPayload("not-a-key"); err == nil {
+		t.Fatal("expected error for malformed payload")
+	}
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+type iterableCache interface {
+	TileCache
+	Iterator
+}
+
+type iterableBackend struct {
+	name  string
+	cache func(t *testing.T) iterableCache
+}
+
+// taggedIterableBackends are added by the test files of backends behind a
+// build tag.
+var taggedIterableBackends []iterableBackend
+
+func TestIterate_VisitsEveryKeyOnce(t *testing.T) {
+	l := logger.FromContext(context.Background())
+
+	backends := append([]iterableBackend{
+		{name: "map", cache: func(t *testing.T) iterableCache {
+			return NewMapCache(l)
+		}},
+		{name: "bounded map", cache: func(t *testing.T) iterableCache {
+			return NewLRUMapCache(MapConfig{MaxEntries: 100}, l)
+		}},
+		{name: "filesystem", cache: func(t *testing.T) iterableCache {
+			c := newTestFilesystemCache(t)
+			// Unrelated files under the root are skipped
+			os.WriteFile(filepath.Join(c.root, "README"), []byte("x"), 0644)
+			os.MkdirAll(filepath.Join(c.root, "logs", "2026"), 0755)
+			return c
+		}},
+		{name: "filesystem hashed", cache: func(t *testing.T) iterableCache {
+			return NewFilesystemCache(FilesystemConfig{Root: t.TempDir(), Layout: LayoutHashed}, l)
+		}},
+		{name: "envelope", cache: func(t *testing.T) iterableCache {
+			return NewEnvelopeCache(NewMapCache(l), EnvelopeCodec{})
+		}},
+	}, taggedIterableBackends...)
+
+	keys := []TileCacheKey{
+		{Z: 0, X: 0, Y: 0},
+		{Z: 5, X: 10, Y: 12},
+		{Z: 5, X: 10, Y: 13},
+		{Z: 12, X: 2048, Y: 1361},
+	}
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			c := b.cache(t)
+			for _, k := range keys {
+				if err := c.Set(k, TileCacheValue("tile")); err != nil {
+					t.Fatalf("Set %+v failed: %v", k, err)
+				}
+			}
+
+			visits := make(map[TileCacheKey]int)
+			err := c.Iterate(func(k TileCacheKey, info EntryInfo) bool {
+				visits[k]++
+				if info.Size < int64(len("tile")) {
+					t.Errorf("%+v reported %d bytes", k, info.Size)
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatalf("Iterate failed: %v", err)
+			}
+
+			if len(visits) != len(keys) {
+				t.Fatalf("visited %v, want %v", visits, keys)
+			}
+			for _, k := range keys {
+				if visits[k] != 1 {
+					t.Fatalf("%+v visited %d times", k, visits[k])
+				}
+			}
+
+			n := 0
+			if err := c.Iterate(func(TileCacheKey, EntryInfo) bool { n++; return false }); err != nil {
+				t.Fatalf("Iterate failed: %v", err)
+			}
+			if n != 1 {
+				t.Fatalf("iteration did not stop early, visited %d tiles", n)
+			}
+		})
+	}
+}
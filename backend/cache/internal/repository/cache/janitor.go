@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/metrics"
+)
+
+const defaultJanitorInterval = time.Minute
+
+type JanitorConfig struct {
+	// MaxBytes is the most tile data the backend may hold, counted in stored
+	// bytes, i.e. after compression
+	MaxBytes int64
+	Interval time.Duration
+}
+
+// SizeJanitor keeps a backend within a size limit by deleting the least
+// recently accessed tiles, or the oldest ones when the backend does not
+// track reads, e.g. the filesystem with its modification times.
+//
+// The limit counts tile data, not the size of the files holding it: SQLite
+// reuses the pages of deleted tiles rather than shrinking the database.
+type SizeJanitor struct {
+	tc       TileCache
+	maxBytes int64
+	interval time.Duration
+	logger   logger.Logger
+}
+
+// NewSizeJanitor fails with errors.ErrUnsupported for backends that cannot
+// list and delete their tiles.
+func NewSizeJanitor(tc TileCache, cfg JanitorConfig, l logger.Logger) (*SizeJanitor, error) {
+	_, canList := tc.(Iterator)
+	_, canDelete := tc.(Deleter)
+	if !canList || !canDelete {
+		return nil, fmt.Errorf("size limit needs a backend that lists and deletes tiles: %w", errors.ErrUnsupported)
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultJanitorInterval
+	}
+	return &SizeJanitor{tc: tc, maxBytes: cfg.MaxBytes, interval: interval, logger: l}, nil
+}
+
+// Run sweeps every interval until ctx is cancelled.
+func (j *SizeJanitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			j.logger.Info("size janitor stopped")
+			return
+		case <-ticker.C:
+			if _, _, err := j.Sweep(); err != nil {
+				j.logger.Error("size janitor sweep failed", "error", err)
+			}
+		}
+	}
+}
+
+type janitorEntry struct {
+	key  TileCacheKey
+	size int64
+	at   time.Time
+}
+
+// Sweep deletes tiles, least recently accessed first, until the backend
+// holds at most the limit. It returns how many tiles and bytes it removed.
+func (j *SizeJanitor) Sweep() (removed, freed int64, err error) {
+	var entries []janitorEntry
+	var total int64
+	if err := j.tc.(Iterator).Iterate(func(k TileCacheKey, info EntryInfo) bool {
+		entries = append(entries, janitorEntry{key: k, size: info.Size, at: info.StoredAt})
+		total += info.Size
+		return true
+	}); err != nil {
+		return 0, 0, fmt.Errorf("list tiles: %w", err)
+	}
+	metrics.CacheStoredBytes.Set(float64(total))
+	if total <= j.maxBytes {
+		return 0, 0, nil
+	}
+
+	if at, ok := j.tc.(AccessTracker); ok {
+		lastAccess := make(map[TileCacheKey]time.Time, len(entries))
+		err := at.IterateAccess(func(k TileCacheKey, info AccessInfo) bool {
+			lastAccess[k] = info.LastAccess
+			return true
+		})
+		if err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			return 0, 0, fmt.Errorf("list tile access: %w", err)
+		}
+		for i := range entries {
+			if t, ok := lastAccess[entries[i].key]; ok && !t.IsZero() {
+				entries[i].at = t
+			}
+		}
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].at.Before(entries[b].at)
+	})
+
+	d := j.tc.(Deleter)
+	for _, e := range entries {
+		if total <= j.maxBytes {
+			break
+		}
+		if err := d.Delete(e.key); err != nil {
+			metrics.CacheStoredBytes.Set(float64(total))
+			return removed, freed, fmt.Errorf("delete tile %s: %w", e.key, err)
+		}
+		total -= e.size
+		removed++
+		freed += e.size
+	}
+	metrics.CacheStoredBytes.Set(float64(total))
+	metrics.CacheSizeEvictions.Add(float64(removed))
+
+	j.logger.Info("size janitor evicted tiles", "removed", removed, "freed_bytes", freed,
+		"stored_bytes", total, "max_bytes", j.maxBytes)
+	return removed, freed, nil
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+// accessMapCache reports fixed access times, like a backend tracking reads.
+type accessMapCache struct {
+	*MapCache
+	access map[TileCacheKey]time.Time
+}
+
+func (c accessMapCache) IterateAccess(fn func(TileCacheKey, AccessInfo) bool) error {
+	for k, at := range c.access {
+		if !fn(k, AccessInfo{LastAccess: at}) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func newTestSizeJanitor(t *testing.T, tc TileCache, maxBytes int64) *SizeJanitor {
+	t.Helper()
+
+	j, err := NewSizeJanitor(tc, JanitorConfig{MaxBytes: maxBytes}, logger.FromContext(context.Background()))
+	if err != nil {
+		t.Fatalf("NewSizeJanitor failed: %v", err)
+	}
+	return j
+}
+
+func TestSizeJanitor_EvictsLeastRecentlyAccessed(t *testing.T) {
+	l := logger.FromContext(context.Background())
+	c := accessMapCache{MapCache: NewMapCache(l), access: map[TileCacheKey]time.Time{}}
+
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	hot := TileCacheKey{Z: 5, X: 0, Y: 0}
+	warm := TileCacheKey{Z: 5, X: 1, Y: 0}
+	cold := TileCacheKey{Z: 5, X: 2, Y: 0}
+	for i, k := range []TileCacheKey{cold, warm, hot} {
+		c.Set(k, make([]byte, 100))
+		c.access[k] = t0.Add(time.Duration(i) * time.Hour)
+	}
+
+	removed, freed, err := newTestSizeJanitor(t, c, 250).Sweep()
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if removed != 1 || freed != 100 {
+		t.Fatalf("removed %d tiles and %d bytes, want 1 and 100", removed, freed)
+	}
+	for k, want := range map[TileCacheKey]bool{hot: true, warm: true, cold: false} {
+		if exists, _ := c.Has(k); exists != want {
+			t.Fatalf("tile %+v: exists=%v, want %v", k, exists, want)
+		}
+	}
+}
+
+func TestSizeJanitor_EvictsOldestFiles(t *testing.T) {
+	c := newTestFilesystemCache(t)
+
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	keys := []TileCacheKey{{Z: 3, X: 0, Y: 0}, {Z: 3, X: 1, Y: 0}, {Z: 3, X: 2, Y: 0}, {Z: 3, X: 3, Y: 0}}
+	for i, k := range keys {
+		if err := c.Set(k, make([]byte, 100)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		// Written in order, the first key is the oldest
+		at := t0.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(c.path(k), at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	j := newTestSizeJanitor(t, c, 200)
+	removed, _, err := j.Sweep()
+	if err != nil || removed != 2 {
+		t.Fatalf("Sweep removed %d tiles, %v; want 2", removed, err)
+	}
+	for i, k := range keys {
+		if exists, _ := c.Has(k); exists != (i >= 2) {
+			t.Fatalf("tile %+v: exists=%v", k, exists)
+		}
+	}
+
+	// Within the limit, nothing more is removed
+	if removed, _, err := j.Sweep(); err != nil || removed != 0 {
+		t.Fatalf("second Sweep removed %d tiles, %v", removed, err)
+	}
+}
+
+func TestSizeJanitor_RequiresListingAndDeleting(t *testing.T) {
+	l := logger.FromContext(context.Background())
+	_, err := NewSizeJanitor(struct{ TileCache }{NewMapCache(l)}, JanitorConfig{MaxBytes: 1}, l)
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("expected errors.ErrUnsupported, got %v", err)
+	}
+}
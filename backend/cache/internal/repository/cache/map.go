@@ -28,6 +28,16 @@ func (c *TypedSyncMap) Store(k TileCacheKey, v TileCacheValue) {
 	c.m.Store(k, v)
 }
 
+func (c *TypedSyncMap) Delete(k TileCacheKey) {
+	c.m.Delete(k)
+}
+
+func (c *TypedSyncMap) Range(fn func(TileCacheKey, TileCacheValue) bool) {
+	c.m.Range(func(k, v any) bool {
+		return fn(k.(TileCacheKey), v.(TileCacheValue))
+	})
+}
+
 func NewMapCache(l logger.Logger) *MapCache {
 	return &MapCache{
 		m:      &TypedSyncMap{},
@@ -36,6 +46,9 @@ func NewMapCache(l logger.Logger) *MapCache {
 }
 
 var _ TileCache = (*MapCache)(nil)
+var _ Deleter = (*MapCache)(nil)
+var _ Haser = (*MapCache)(nil)
+var _ Iterator = (*MapCache)(nil)
 
 func (c *MapCache) Get(k TileCacheKey) (TileCacheValue, bool, error) {
 	v, exists := c.m.Load(k)
@@ -48,3 +61,22 @@ func (c *MapCache) Set(k TileCacheKey, v TileCacheValue) error {
 	c.m.Store(k, v)
 	return nil
 }
+
+func (c *MapCache) Has(k TileCacheKey) (bool, error) {
+	_, exists := c.m.Load(k)
+	return exists, nil
+}
+
+func (c *MapCache) Delete(k TileCacheKey) error {
+	c.logger.Debug("map cache delete", "z", k.Z, "x", k.X, "y", k.Y)
+	c.m.Delete(k)
+	return nil
+}
+
+// Iterate visits every tile. The map does not record store times.
+func (c *MapCache) Iterate(fn func(TileCacheKey, EntryInfo) bool) error {
+	c.m.Range(func(k TileCacheKey, v TileCacheValue) bool {
+		return fn(k, EntryInfo{Size: int64(len(v))})
+	})
+	return nil
+}
@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/metrics"
+)
+
+// MapConfig bounds the in-memory backend. Zero leaves a bound open; with
+// both open the map grows without limit.
+type MapConfig struct {
+	MaxEntries int
+	// MaxBytes bounds the total size of the stored tiles, keys and
+	// bookkeeping not included
+	MaxBytes int64
+}
+
+// LRUMapCache is an in-memory backend that evicts the least recently used
+// tiles to stay within its bounds. A tile larger than MaxBytes on its own
+// is not stored.
+type LRUMapCache struct {
+	mu      sync.Mutex
+	cfg     MapConfig
+	entries map[TileCacheKey]*list.Element
+	// order holds the entries, most recently used first
+	order  *list.List
+	bytes  int64
+	logger logger.Logger
+}
+
+type lruEntry struct {
+	key   TileCacheKey
+	value TileCacheValue
+}
+
+func NewLRUMapCache(cfg MapConfig, l logger.Logger) *LRUMapCache {
+	return &LRUMapCache{
+		cfg:     cfg,
+		entries: make(map[TileCacheKey]*list.Element),
+		order:   list.New(),
+		logger:  l,
+	}
+}
+
+var _ TileCache = (*LRUMapCache)(nil)
+var _ Deleter = (*LRUMapCache)(nil)
+var _ Haser = (*LRUMapCache)(nil)
+var _ Iterator = (*LRUMapCache)(nil)
+
+func (c *LRUMapCache) Get(k TileCacheKey) (TileCacheValue, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, exists := c.entries[k]
+	c.logger.Debug("map cache get", "z", k.Z, "x", k.X, "y", k.Y, "hit", exists)
+	if !exists {
+		return nil, false, nil
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true, nil
+}
+
+func (c *LRUMapCache) Set(k TileCacheKey, v TileCacheValue) error {
+	c.logger.Debug("map cache set", "z", k.Z, "x", k.X, "y", k.Y)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cfg.MaxBytes > 0 && int64(len(v)) > c.cfg.MaxBytes {
+		c.logger.Warn("tile larger than the map cache, not storing it",
+			"z", k.Z, "x", k.X, "y", k.Y, "size", len(v), "max_bytes", c.cfg.MaxBytes)
+		c.remove(k)
+		return nil
+	}
+
+	if e, exists := c.entries[k]; exists {
+		entry := e.Value.(*lruEntry)
+		c.bytes += int64(len(v) - len(entry.value))
+		entry.value = v
+		c.order.MoveToFront(e)
+	} else {
+		c.entries[k] = c.order.PushFront(&lruEntry{key: k, value: v})
+		c.bytes += int64(len(v))
+	}
+	c.evict()
+	return nil
+}
+
+// evict drops the least recently used tiles until the cache is within its
+// bounds.
+func (c *LRUMapCache) evict() {
+	for c.overLimit() {
+		oldest := c.order.Back().Value.(*lruEntry)
+		c.remove(oldest.key)
+		metrics.CacheEvictions.Inc()
+	}
+}
+
+func (c *LRUMapCache) overLimit() bool {
+	return (c.cfg.MaxEntries > 0 && c.order.Len() > c.cfg.MaxEntries) ||
+		(c.cfg.MaxBytes > 0 && c.bytes > c.cfg.MaxBytes)
+}
+
+func (c *LRUMapCache) remove(k TileCacheKey) {
+	e, exists := c.entries[k]
+	if !exists {
+		return
+	}
+	c.order.Remove(e)
+	delete(c.entries, k)
+	c.bytes -= int64(len(e.Value.(*lruEntry).value))
+}
+
+// Has does not count as a use of the tile.
+func (c *LRUMapCache) Has(k TileCacheKey) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, exists := c.entries[k]
+	return exists, nil
+}
+
+func (c *LRUMapCache) Delete(k TileCacheKey) error {
+	c.logger.Debug("map cache delete", "z", k.Z, "x", k.X, "y", k.Y)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.remove(k)
+	return nil
+}
+
+// Iterate visits every tile, most recently used first, without counting as
+// a use. The map does not record store times. The cache is locked
+// throughout, so fn must not call back into it.
+func (c *LRUMapCache) Iterate(fn func(TileCacheKey, EntryInfo) bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for e := c.order.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(*lruEntry)
+		if !fn(entry.key, EntryInfo{Size: int64(len(entry.value))}) {
+			break
+		}
+	}
+	return nil
+}
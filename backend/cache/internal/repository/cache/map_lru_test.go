@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func lruKeys(t *testing.T, c *LRUMapCache) []TileCacheKey {
+	t.Helper()
+
+	var keys []TileCacheKey
+	c.Iterate(func(k TileCacheKey, _ EntryInfo) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
+
+func TestLRUMapCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRUMapCache(MapConfig{MaxEntries: 2}, logger.FromContext(context.Background()))
+	a, b, d := TileCacheKey{Z: 1, X: 0, Y: 0}, TileCacheKey{Z: 1, X: 1, Y: 0}, TileCacheKey{Z: 1, X: 0, Y: 1}
+
+	c.Set(a, []byte("a"))
+	c.Set(b, []byte("b"))
+	// Reading a makes b the least recently used
+	if _, ok, _ := c.Get(a); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	c.Set(d, []byte("d"))
+
+	if ok, _ := c.Has(b); ok {
+		t.Fatal("expected the least recently used tile to be evicted")
+	}
+	if keys := lruKeys(t, c); len(keys) != 2 || keys[0] != d || keys[1] != a {
+		t.Fatalf("expected d and a to remain, got %v", keys)
+	}
+}
+
+func TestLRUMapCache_MaxBytes(t *testing.T) {
+	c := NewLRUMapCache(MapConfig{MaxBytes: 10}, logger.FromContext(context.Background()))
+	a, b := TileCacheKey{Z: 1, X: 0, Y: 0}, TileCacheKey{Z: 1, X: 1, Y: 0}
+
+	c.Set(a, make([]byte, 6))
+	c.Set(b, make([]byte, 4))
+	if c.bytes != 10 || len(lruKeys(t, c)) != 2 {
+		t.Fatalf("expected both tiles to fit, got %d bytes", c.bytes)
+	}
+
+	// Growing b pushes a out
+	c.Set(b, make([]byte, 5))
+	if ok, _ := c.Has(a); ok || c.bytes != 5 {
+		t.Fatalf("expected a to be evicted, %d bytes left", c.bytes)
+	}
+
+	// A tile larger than the whole cache is not stored and evicts nothing
+	c.Set(a, make([]byte, 11))
+	if ok, _ := c.Has(a); ok || c.bytes != 5 {
+		t.Fatalf("expected the oversized tile to be skipped, %d bytes used", c.bytes)
+	}
+
+	c.Delete(b)
+	if c.bytes != 0 || len(lruKeys(t, c)) != 0 {
+		t.Fatalf("expected an empty cache, %d bytes used", c.bytes)
+	}
+}
@@ -0,0 +1,215 @@
+//go:build sqlite
+
+package cache
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// MBTilesCache serves and stores tiles in an MBTiles file, so the cache can
+// be seeded from a standard export and keep serving offline. MBTiles
+// addresses rows in TMS order, counted from the south, which is flipped to
+// and from the XYZ keys the service uses. A file is a single tile set, so
+// only the default layer is served.
+//
+// Both the flat layout, a tiles table, and the deduplicated one, a tiles
+// view over map and images, are supported. A missing file is created with
+// the flat layout.
+type MBTilesCache struct {
+	db *sql.DB
+	// dedup is set for the map and images layout
+	dedup  bool
+	logger logger.Logger
+}
+
+func init() {
+	backends["mbtiles"] = func(cfg BackendConfig, l logger.Logger) (TileCache, error) {
+		c, err := NewMBTilesCache(cfg.MBTiles, l)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+}
+
+func NewMBTilesCache(cfg MBTilesConfig, l logger.Logger) (*MBTilesCache, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("mbtiles path is required")
+	}
+	db, err := sql.Open("sqlite3", cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	c := &MBTilesCache{db: db, logger: l}
+	if err := c.init(cfg.Path); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open mbtiles %s: %w", cfg.Path, err)
+	}
+
+	l.Info("mbtiles cache initialized", "path", cfg.Path, "dedup", c.dedup)
+	return c, nil
+}
+
+// init detects the layout of an existing file or creates the flat one.
+func (c *MBTilesCache) init(path string) error {
+	var kind string
+	err := c.db.QueryRow(`SELECT type FROM sqlite_master WHERE name = 'tiles'`).Scan(&kind)
+	switch {
+	case err == nil:
+		c.dedup = kind == "view"
+		return nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	_, err = c.db.Exec(`
+	CREATE TABLE IF NOT EXISTS metadata (name TEXT, value TEXT);
+	CREATE UNIQUE INDEX IF NOT EXISTS metadata_name ON metadata (name);
+	CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB);
+	CREATE UNIQUE INDEX tile_index ON tiles (zoom_level, tile_column, tile_row);
+	INSERT OR IGNORE INTO metadata (name, value) VALUES ('name', ?), ('format', 'png');`, name)
+	return err
+}
+
+var _ TileCache = (*MBTilesCache)(nil)
+var _ Deleter = (*MBTilesCache)(nil)
+var _ Haser = (*MBTilesCache)(nil)
+var _ Iterator = (*MBTilesCache)(nil)
+
+// tmsRow flips an XYZ y to the TMS row MBTiles stores, and back.
+func tmsRow(z, y int) int {
+	return (1 << z) - 1 - y
+}
+
+func (c *MBTilesCache) Get(k TileCacheKey) (TileCacheValue, bool, error) {
+	c.logger.Debug("mbtiles cache get", "z", k.Z, "x", k.X, "y", k.Y)
+	if k.Layer != "" {
+		return nil, false, ErrLayerUnsupported
+	}
+
+	var data []byte
+	err := c.db.QueryRow(`SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?`,
+		k.Z, k.X, tmsRow(k.Z, k.Y)).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		c.logger.Error("mbtiles cache get failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// Set replaces the tile by updating its row or inserting one, since exports
+// do not always carry the unique index INSERT OR REPLACE relies on.
+func (c *MBTilesCache) Set(k TileCacheKey, v TileCacheValue) error {
+	c.logger.Debug("mbtiles cache set", "z", k.Z, "x", k.X, "y", k.Y)
+	if k.Layer != "" {
+		return ErrLayerUnsupported
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	table, column, value := "tiles", "tile_data", any([]byte(v))
+	if c.dedup {
+		sum := sha256.Sum256(v)
+		id := hex.EncodeToString(sum[:])
+		if _, err := tx.Exec(`INSERT INTO images (tile_data, tile_id) SELECT ?, ? WHERE NOT EXISTS (SELECT 1 FROM images WHERE tile_id = ?)`, []byte(v), id, id); err != nil {
+			c.logger.Error("mbtiles cache set failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+			return err
+		}
+		table, column, value = "map", "tile_id", id
+	}
+
+	row := tmsRow(k.Z, k.Y)
+	res, err := tx.Exec(`UPDATE `+table+` SET `+column+` = ? WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?`, value, k.Z, k.X, row)
+	if err == nil {
+		var n int64
+		if n, err = res.RowsAffected(); err == nil && n == 0 {
+			_, err = tx.Exec(`INSERT INTO `+table+` (zoom_level, tile_column, tile_row, `+column+`) VALUES (?, ?, ?, ?)`, k.Z, k.X, row, value)
+		}
+	}
+	if err != nil {
+		c.logger.Error("mbtiles cache set failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete leaves the image of a deduplicated file in place, other tiles may
+// share it.
+func (c *MBTilesCache) Delete(k TileCacheKey) error {
+	c.logger.Debug("mbtiles cache delete", "z", k.Z, "x", k.X, "y", k.Y)
+	if k.Layer != "" {
+		return ErrLayerUnsupported
+	}
+
+	table := "tiles"
+	if c.dedup {
+		table = "map"
+	}
+	_, err := c.db.Exec(`DELETE FROM `+table+` WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?`, k.Z, k.X, tmsRow(k.Z, k.Y))
+	if err != nil {
+		c.logger.Error("mbtiles cache delete failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *MBTilesCache) Has(k TileCacheKey) (bool, error) {
+	if k.Layer != "" {
+		return false, ErrLayerUnsupported
+	}
+	var exists bool
+	err := c.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?)`,
+		k.Z, k.X, tmsRow(k.Z, k.Y)).Scan(&exists)
+	if err != nil {
+		c.logger.Error("mbtiles cache has failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		return false, err
+	}
+	return exists, nil
+}
+
+// Iterate visits every tile with a single cursor query. MBTiles does not
+// record store times.
+func (c *MBTilesCache) Iterate(fn func(TileCacheKey, EntryInfo) bool) error {
+	rows, err := c.db.Query(`SELECT zoom_level, tile_column, tile_row, LENGTH(tile_data) FROM tiles`)
+	if err != nil {
+		c.logger.Error("mbtiles cache iterate failed", "error", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k TileCacheKey
+		var row int
+		var info EntryInfo
+		if err := rows.Scan(&k.Z, &k.X, &row, &info.Size); err != nil {
+			c.logger.Error("mbtiles cache iterate failed", "error", err)
+			return err
+		}
+		k.Y = tmsRow(k.Z, row)
+		if !fn(k, info) {
+			return nil
+		}
+	}
+	return rows.Err()
+}
+
+func (c *MBTilesCache) Close() error {
+	return c.db.Close()
+}
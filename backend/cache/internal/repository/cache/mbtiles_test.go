@@ -0,0 +1,137 @@
+//go:build sqlite
+
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func init() {
+	taggedIterableBackends = append(taggedIterableBackends, iterableBackend{
+		name: "mbtiles",
+		cache: func(t *testing.T) iterableCache {
+			return newTestMBTilesCache(t, filepath.Join(t.TempDir(), "tiles.mbtiles"))
+		},
+	})
+}
+
+func newTestMBTilesCache(t *testing.T, path string) *MBTilesCache {
+	t.Helper()
+
+	c, err := NewMBTilesCache(MBTilesConfig{Path: path}, logger.FromContext(context.Background()))
+	if err != nil {
+		t.Fatalf("failed to open mbtiles: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// writeExport creates an MBTiles file the way other tools do, without going
+// through the cache.
+func writeExport(t *testing.T, path, schema string, args ...any) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(schema, args...); err != nil {
+		t.Fatalf("failed to write export: %v", err)
+	}
+}
+
+func TestMBTilesCache_FlipsRowsToTMS(t *testing.T) {
+	c := newTestMBTilesCache(t, filepath.Join(t.TempDir(), "new.mbtiles"))
+	k := TileCacheKey{Z: 3, X: 2, Y: 1}
+
+	if err := c.Set(k, TileCacheValue("tile")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	var row int
+	if err := c.db.QueryRow(`SELECT tile_row FROM tiles WHERE zoom_level = 3 AND tile_column = 2`).Scan(&row); err != nil {
+		t.Fatalf("failed to read row: %v", err)
+	}
+	if row != 6 {
+		t.Fatalf("stored TMS row %d, want 6", row)
+	}
+	if data, ok, err := c.Get(k); err != nil || !ok || string(data) != "tile" {
+		t.Fatalf("Get = %q, %v, %v", data, ok, err)
+	}
+
+	var name string
+	c.db.QueryRow(`SELECT value FROM metadata WHERE name = 'name'`).Scan(&name)
+	if name != "new" {
+		t.Fatalf("expected the file name as the tileset name, got %q", name)
+	}
+}
+
+func TestMBTilesCache_ServesExistingExport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.mbtiles")
+	// No unique index, as some exporters leave it out
+	writeExport(t, path, `
+	CREATE TABLE metadata (name TEXT, value TEXT);
+	CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB);
+	INSERT INTO tiles VALUES (1, 0, 1, ?);`, []byte("north-west"))
+
+	c := newTestMBTilesCache(t, path)
+	k := TileCacheKey{Z: 1, X: 0, Y: 0}
+	if data, ok, err := c.Get(k); err != nil || !ok || string(data) != "north-west" {
+		t.Fatalf("Get = %q, %v, %v", data, ok, err)
+	}
+
+	if err := c.Set(k, TileCacheValue("updated")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	var rows int
+	c.db.QueryRow(`SELECT COUNT(*) FROM tiles`).Scan(&rows)
+	if rows != 1 {
+		t.Fatalf("overwriting a tile left %d rows", rows)
+	}
+	if data, _, _ := c.Get(k); string(data) != "updated" {
+		t.Fatalf("Get after Set = %q", data)
+	}
+}
+
+func TestMBTilesCache_DeduplicatedLayout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.mbtiles")
+	writeExport(t, path, `
+	CREATE TABLE metadata (name TEXT, value TEXT);
+	CREATE TABLE map (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_id TEXT);
+	CREATE TABLE images (tile_data BLOB, tile_id TEXT);
+	CREATE VIEW tiles AS SELECT map.zoom_level AS zoom_level, map.tile_column AS tile_column,
+		map.tile_row AS tile_row, images.tile_data AS tile_data
+		FROM map JOIN images ON images.tile_id = map.tile_id;`)
+
+	c := newTestMBTilesCache(t, path)
+	if !c.dedup {
+		t.Fatal("expected the map and images layout to be detected")
+	}
+
+	a, b := TileCacheKey{Z: 2, X: 0, Y: 0}, TileCacheKey{Z: 2, X: 1, Y: 3}
+	for _, k := range []TileCacheKey{a, b} {
+		if err := c.Set(k, TileCacheValue("ocean")); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	var images int
+	c.db.QueryRow(`SELECT COUNT(*) FROM images`).Scan(&images)
+	if images != 1 {
+		t.Fatalf("identical tiles stored %d images", images)
+	}
+
+	if err := c.Delete(a); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if ok, _ := c.Has(a); ok {
+		t.Fatal("expected the deleted tile to be gone")
+	}
+	if data, ok, err := c.Get(b); err != nil || !ok || string(data) != "ocean" {
+		t.Fatalf("the tile sharing the image should remain, got %q, %v, %v", data, ok, err)
+	}
+}
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tile_cache ADD COLUMN accessed_at INTEGER;
+CREATE INDEX IF NOT EXISTS idx_tile_accessed_at ON tile_cache(accessed_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_tile_accessed_at;
+ALTER TABLE tile_cache DROP COLUMN accessed_at;
+-- +goose StatementEnd
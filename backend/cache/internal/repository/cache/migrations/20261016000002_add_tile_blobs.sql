@@ -0,0 +1,50 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Deduplicated tiles keep their bytes in tile_blobs, keyed by content hash,
+-- and leave tile_cache.tile_data empty. refs counts the tile_cache rows
+-- pointing at a blob and is maintained by the triggers below, so deletes and
+-- evictions release blobs without the application having to.
+CREATE TABLE IF NOT EXISTS tile_blobs (
+    hash TEXT PRIMARY KEY,
+    data BLOB NOT NULL,
+    refs INTEGER NOT NULL DEFAULT 0
+);
+
+ALTER TABLE tile_cache ADD COLUMN blob_hash TEXT;
+
+CREATE TRIGGER IF NOT EXISTS tile_blobs_ref_insert
+AFTER INSERT ON tile_cache
+WHEN new.blob_hash IS NOT NULL
+BEGIN
+    UPDATE tile_blobs SET refs = refs + 1 WHERE hash = new.blob_hash;
+END;
+
+CREATE TRIGGER IF NOT EXISTS tile_blobs_ref_update
+AFTER UPDATE OF blob_hash ON tile_cache
+WHEN old.blob_hash IS NOT new.blob_hash
+BEGIN
+    UPDATE tile_blobs SET refs = refs + 1 WHERE hash = new.blob_hash;
+    UPDATE tile_blobs SET refs = refs - 1 WHERE hash = old.blob_hash;
+    DELETE FROM tile_blobs WHERE hash = old.blob_hash AND refs <= 0;
+END;
+
+CREATE TRIGGER IF NOT EXISTS tile_blobs_ref_delete
+AFTER DELETE ON tile_cache
+WHEN old.blob_hash IS NOT NULL
+BEGIN
+    UPDATE tile_blobs SET refs = refs - 1 WHERE hash = old.blob_hash;
+    DELETE FROM tile_blobs WHERE hash = old.blob_hash AND refs <= 0;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS tile_blobs_ref_insert;
+DROP TRIGGER IF EXISTS tile_blobs_ref_update;
+DROP TRIGGER IF EXISTS tile_blobs_ref_delete;
+UPDATE tile_cache
+SET tile_data = (SELECT data FROM tile_blobs WHERE hash = tile_cache.blob_hash)
+WHERE blob_hash IS NOT NULL;
+ALTER TABLE tile_cache DROP COLUMN blob_hash;
+DROP TABLE IF EXISTS tile_blobs;
+-- +goose StatementEnd
@@ -0,0 +1,107 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Tiles of named layers share coordinates with the default layer, whose
+-- tiles keep an empty layer. SQLite cannot change the UNIQUE constraint in
+-- place, so the table is rebuilt. The blob triggers are created after the
+-- copy, which leaves the reference counts as they were.
+CREATE TABLE tile_cache_layered (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    x INTEGER NOT NULL,
+    y INTEGER NOT NULL,
+    z INTEGER NOT NULL,
+    layer TEXT NOT NULL DEFAULT '',
+    tile_data BLOB NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    accessed_at INTEGER,
+    blob_hash TEXT,
+    hit_count INTEGER NOT NULL DEFAULT 0,
+    UNIQUE(x, y, z, layer)
+);
+
+INSERT INTO tile_cache_layered (id, x, y, z, tile_data, created_at, accessed_at, blob_hash, hit_count)
+SELECT id, x, y, z, tile_data, created_at, accessed_at, blob_hash, hit_count FROM tile_cache;
+
+DROP TABLE tile_cache;
+ALTER TABLE tile_cache_layered RENAME TO tile_cache;
+
+CREATE INDEX IF NOT EXISTS idx_tile_coords ON tile_cache(x, y, z);
+CREATE INDEX IF NOT EXISTS idx_tile_created_at ON tile_cache(created_at);
+CREATE INDEX IF NOT EXISTS idx_tile_accessed_at ON tile_cache(accessed_at);
+
+CREATE TRIGGER IF NOT EXISTS tile_blobs_ref_insert
+AFTER INSERT ON tile_cache
+WHEN new.blob_hash IS NOT NULL
+BEGIN
+    UPDATE tile_blobs SET refs = refs + 1 WHERE hash = new.blob_hash;
+END;
+
+CREATE TRIGGER IF NOT EXISTS tile_blobs_ref_update
+AFTER UPDATE OF blob_hash ON tile_cache
+WHEN old.blob_hash IS NOT new.blob_hash
+BEGIN
+    UPDATE tile_blobs SET refs = refs + 1 WHERE hash = new.blob_hash;
+    UPDATE tile_blobs SET refs = refs - 1 WHERE hash = old.blob_hash;
+    DELETE FROM tile_blobs WHERE hash = old.blob_hash AND refs <= 0;
+END;
+
+CREATE TRIGGER IF NOT EXISTS tile_blobs_ref_delete
+AFTER DELETE ON tile_cache
+WHEN old.blob_hash IS NOT NULL
+BEGIN
+    UPDATE tile_blobs SET refs = refs - 1 WHERE hash = old.blob_hash;
+    DELETE FROM tile_blobs WHERE hash = old.blob_hash AND refs <= 0;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Tiles of named layers are dropped, releasing their blobs
+DELETE FROM tile_cache WHERE layer != '';
+
+CREATE TABLE tile_cache_default (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    x INTEGER NOT NULL,
+    y INTEGER NOT NULL,
+    z INTEGER NOT NULL,
+    tile_data BLOB NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    accessed_at INTEGER,
+    blob_hash TEXT,
+    hit_count INTEGER NOT NULL DEFAULT 0,
+    UNIQUE(x, y, z)
+);
+
+INSERT INTO tile_cache_default (id, x, y, z, tile_data, created_at, accessed_at, blob_hash, hit_count)
+SELECT id, x, y, z, tile_data, created_at, accessed_at, blob_hash, hit_count FROM tile_cache;
+
+DROP TABLE tile_cache;
+ALTER TABLE tile_cache_default RENAME TO tile_cache;
+
+CREATE INDEX IF NOT EXISTS idx_tile_coords ON tile_cache(x, y, z);
+CREATE INDEX IF NOT EXISTS idx_tile_created_at ON tile_cache(created_at);
+CREATE INDEX IF NOT EXISTS idx_tile_accessed_at ON tile_cache(accessed_at);
+
+CREATE TRIGGER IF NOT EXISTS tile_blobs_ref_insert
+AFTER INSERT ON tile_cache
+WHEN new.blob_hash IS NOT NULL
+BEGIN
+    UPDATE tile_blobs SET refs = refs + 1 WHERE hash = new.blob_hash;
+END;
+
+CREATE TRIGGER IF NOT EXISTS tile_blobs_ref_update
+AFTER UPDATE OF blob_hash ON tile_cache
+WHEN old.blob_hash IS NOT new.blob_hash
+BEGIN
+    UPDATE tile_blobs SET refs = refs + 1 WHERE hash = new.blob_hash;
+    UPDATE tile_blobs SET refs = refs - 1 WHERE hash = old.blob_hash;
+    DELETE FROM tile_blobs WHERE hash = old.blob_hash AND refs <= 0;
+END;
+
+CREATE TRIGGER IF NOT EXISTS tile_blobs_ref_delete
+AFTER DELETE ON tile_cache
+WHEN old.blob_hash IS NOT NULL
+BEGIN
+    UPDATE tile_blobs SET refs = refs - 1 WHERE hash = old.blob_hash;
+    DELETE FROM tile_blobs WHERE hash = old.blob_hash AND refs <= 0;
+END;
+-- +goose StatementEnd
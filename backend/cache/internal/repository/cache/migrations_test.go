@@ -0,0 +1,208 @@
+//go:build sqlite
+
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func openTestDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// embeddedVersions returns the migration versions in the order goose must
+// apply them.
+func embeddedVersions(t *testing.T) []int64 {
+	t.Helper()
+
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		t.Fatalf("failed to list migrations: %v", err)
+	}
+
+	var versions []int64
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(filepath.Base(name), "_")
+		v, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			t.Fatalf("migration %s has no numeric version: %v", name, err)
+		}
+		versions = append(versions, v)
+	}
+	slices.Sort(versions)
+	return versions
+}
+
+func appliedVersions(t *testing.T, db *sql.DB) []int64 {
+	t.Helper()
+
+	rows, err := db.Query(`SELECT version_id FROM goose_db_version WHERE version_id > 0 ORDER BY id`)
+	if err != nil {
+		t.Fatalf("failed to read goose versions: %v", err)
+	}
+	defer rows.Close()
+
+	var versions []int64
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			t.Fatalf("failed to scan version: %v", err)
+		}
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+func TestMigrations_ApplyInOrderAndAreIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "migrate.db")
+	l := logger.FromContext(context.Background())
+
+	// Opening the cache twice runs the migrations twice; the second run must be a no-op
+	for i := 0; i < 2; i++ {
+		c, err := NewSQLiteCache(SQLiteConfig{Path: path}, l)
+		if err != nil {
+			t.Fatalf("run %d: failed to migrate: %v", i+1, err)
+		}
+		if err := c.Close(); err != nil {
+			t.Fatalf("run %d: failed to close: %v", i+1, err)
+		}
+	}
+
+	db := openTestDB(t, path)
+	if got, want := appliedVersions(t, db), embeddedVersions(t); !slices.Equal(got, want) {
+		t.Fatalf("applied versions %v, want each of %v exactly once in order", got, want)
+	}
+}
+
+func TestMigrations_Schema(t *testing.T) {
+	c := newTestSQLiteCache(t)
+
+	rows, err := c.db.Query(`SELECT name FROM pragma_table_info('tile_cache')`)
+	if err != nil {
+		t.Fatalf("failed to read columns: %v", err)
+	}
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("failed to scan column: %v", err)
+		}
+		columns = append(columns, name)
+	}
+	rows.Close()
+
+	for _, want := range []string{"id", "x", "y", "z", "layer", "tile_data", "created_at", "accessed_at", "blob_hash"} {
+		if !slices.Contains(columns, want) {
+			t.Errorf("column %s missing, have %v", want, columns)
+		}
+	}
+
+	// The coordinates must be unique per layer so Set can upsert and Get
+	// hits one row
+	var uniqueCoords bool
+	err = c.db.QueryRow(`
+		SELECT COUNT(*) > 0 FROM pragma_index_list('tile_cache') il
+		WHERE il."unique" = 1
+		AND (SELECT group_concat(name, ',') FROM (
+			SELECT name FROM pragma_index_info(il.name) ORDER BY seqno
+		)) = 'x,y,z,layer'`).Scan(&uniqueCoords)
+	if err != nil {
+		t.Fatalf("failed to read indexes: %v", err)
+	}
+	if !uniqueCoords {
+		t.Error("expected a unique index on (x, y, z, layer)")
+	}
+
+	for _, index := range []string{"idx_tile_coords", "idx_tile_created_at", "idx_tile_accessed_at"} {
+		var n int
+		if err := c.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?`, index).Scan(&n); err != nil {
+			t.Fatalf("failed to look up index %s: %v", index, err)
+		}
+		if n != 1 {
+			t.Errorf("index %s missing", index)
+		}
+	}
+}
+
+func TestMigrations_CoordinateLookupUsesIndex(t *testing.T) {
+	c := newTestSQLiteCache(t)
+
+	rows, err := c.db.Query(`EXPLAIN QUERY PLAN SELECT tile_data FROM tile_cache WHERE x = ? AND y = ? AND z = ?`, 1, 2, 3)
+	if err != nil {
+		t.Fatalf("failed to explain lookup: %v", err)
+	}
+	defer rows.Close()
+
+	var plan []string
+	for rows.Next() {
+		var id, parent, notused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notused, &detail); err != nil {
+			t.Fatalf("failed to scan plan: %v", err)
+		}
+		plan = append(plan, detail)
+	}
+
+	joined := strings.Join(plan, "; ")
+	if !strings.Contains(joined, "USING INDEX") || !strings.Contains(joined, "x=? AND y=? AND z=?") {
+		t.Fatalf("lookup does not use a composite index: %s", joined)
+	}
+}
+
+func TestMigrations_TimeOutOnLockedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	// Another process holds the database; the busy timeout has the
+	// migrations wait longer than the configured bound
+	lock := openTestDB(t, path)
+	lock.SetMaxOpenConns(1)
+	if _, err := lock.Exec(`BEGIN EXCLUSIVE`); err != nil {
+		t.Fatalf("failed to lock db: %v", err)
+	}
+	t.Cleanup(func() { lock.Exec(`ROLLBACK`) })
+
+	const timeout = 200 * time.Millisecond
+	start := time.Now()
+	_, err := NewSQLiteCache(SQLiteConfig{
+		Path:             path + "?_busy_timeout=1000",
+		MigrationTimeout: timeout,
+	}, logger.FromContext(context.Background()))
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, ErrMigrationTimeout) {
+		t.Fatalf("expected ErrMigrationTimeout, got %v", err)
+	}
+	if elapsed > timeout+500*time.Millisecond {
+		t.Fatalf("expected the migrations to give up after about %v, took %v", timeout, elapsed)
+	}
+
+	// Let the abandoned migrations give up on the lock, then the next start
+	// migrates from scratch
+	time.Sleep(2 * time.Second)
+	if _, err := lock.Exec(`ROLLBACK`); err != nil {
+		t.Fatalf("failed to unlock db: %v", err)
+	}
+	c, err := NewSQLiteCache(SQLiteConfig{Path: path}, logger.FromContext(context.Background()))
+	if err != nil {
+		t.Fatalf("expected the migrations to succeed once unlocked: %v", err)
+	}
+	c.Close()
+}
@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// NotFoundMarker is stored in place of a tile that does not exist upstream,
+// so repeated requests for it are answered without asking upstream again.
+// No image starts with a NUL byte, so it cannot be mistaken for a tile.
+//
+// Markers written by NewNotFoundMarker carry their store time after it, so
+// they can expire on backends that do not record store times. A bare
+// marker, as written before, expires only where the backend records one.
+var NotFoundMarker = TileCacheValue("\x00guide_helper:not_found\x00")
+
+// NewNotFoundMarker returns a marker recording that the tile was found
+// missing at storedAt.
+func NewNotFoundMarker(storedAt time.Time) TileCacheValue {
+	return binary.BigEndian.AppendUint64(bytes.Clone(NotFoundMarker), uint64(storedAt.UnixNano()))
+}
+
+// IsNotFound reports whether a stored value records a missing tile rather
+// than tile data.
+func IsNotFound(v []byte) bool {
+	return bytes.HasPrefix(v, NotFoundMarker) && (len(v) == len(NotFoundMarker) || len(v) == len(NotFoundMarker)+8)
+}
+
+// NotFoundStoredAt returns the store time carried by a marker, and false for
+// bare markers and values that are not markers.
+func NotFoundStoredAt(v []byte) (time.Time, bool) {
+	if !IsNotFound(v) || len(v) == len(NotFoundMarker) {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(v[len(NotFoundMarker):]))), true
+}
@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNotFoundMarker_CarriesStoreTime(t *testing.T) {
+	storedAt := time.Unix(1700000000, 123)
+	marker := NewNotFoundMarker(storedAt)
+	if !IsNotFound(marker) {
+		t.Fatal("expected the marker recognised")
+	}
+	if got, ok := NotFoundStoredAt(marker); !ok || !got.Equal(storedAt) {
+		t.Fatalf("NotFoundStoredAt = %v, %v, want %v", got, ok, storedAt)
+	}
+
+	// Markers written before carry no time
+	if !IsNotFound(NotFoundMarker) {
+		t.Fatal("expected the bare marker recognised")
+	}
+	if _, ok := NotFoundStoredAt(NotFoundMarker); ok {
+		t.Fatal("expected no store time in the bare marker")
+	}
+	if IsNotFound([]byte("\x89PNG")) {
+		t.Fatal("expected a tile not to be a marker")
+	}
+}
@@ -1,8 +1,13 @@
+//go:build redis
+
 package cache
 
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
@@ -11,16 +16,27 @@ import (
 )
 
 type RedisCache struct {
-	client *redis.Client
-	ttl    time.Duration
-	logger logger.Logger
+	client      *redis.Client
+	ttls        atomic.Pointer[redisTTLs]
+	notFoundTTL time.Duration
+	prefix      string
+	logger      logger.Logger
+}
+
+// redisTTLs is swapped as a whole so a reload never mixes old and new values.
+type redisTTLs struct {
+	ttl  time.Duration
+	zoom map[int]time.Duration
 }
 
-type RedisConfig struct {
-	Addr     string
-	Password string
-	DB       int
-	TTL      time.Duration
+func init() {
+	backends["redis"] = func(cfg BackendConfig, l logger.Logger) (TileCache, error) {
+		c, err := NewRedisCache(cfg.Redis, l)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
 }
 
 func NewRedisCache(cfg RedisConfig, l logger.Logger) (*RedisCache, error) {
@@ -37,16 +53,13 @@ func NewRedisCache(cfg RedisConfig, l logger.Logger) (*RedisCache, error) {
 		return nil, fmt.Errorf("failed to connect to redis: %w", err)
 	}
 
-	ttl := cfg.TTL
-	if ttl == 0 {
-		ttl = 24 * time.Hour // default TTL
-	}
-
 	cache := &RedisCache{
-		client: client,
-		ttl:    ttl,
-		logger: l,
+		client:      client,
+		notFoundTTL: cfg.NotFoundTTL,
+		prefix:      cfg.KeyPrefix,
+		logger:      l,
 	}
+	cache.SetTTLs(cfg.TTL, cfg.ZoomTTLs)
 
 	// Start pool stats collector
 	go cache.collectPoolStats()
@@ -55,9 +68,173 @@ func NewRedisCache(cfg RedisConfig, l logger.Logger) (*RedisCache, error) {
 }
 
 var _ TileCache = (*RedisCache)(nil)
+var _ TimestampedTileCache = (*RedisCache)(nil)
+var _ Haser = (*RedisCache)(nil)
+var _ Deleter = (*RedisCache)(nil)
+var _ Iterator = (*RedisCache)(nil)
 
+// keyFor returns "tile:z:x:y" under the prefix, or "tile:layer:z:x:y"
+// outside the default layer.
 func (c *RedisCache) keyFor(k TileCacheKey) string {
-	return fmt.Sprintf("tile:%d:%d:%d", k.Z, k.X, k.Y)
+	return c.prefix + "tile:" + strings.ReplaceAll(k.String(), "/", ":")
+}
+
+// storedAtKeyFor returns the key holding when the tile at key was written,
+// in Unix nanoseconds. It is written and expires along with the tile, and
+// sits outside the "tile:" namespace so scans of tiles skip it.
+func (c *RedisCache) storedAtKeyFor(key string) string {
+	return c.prefix + "stored_at:" + strings.TrimPrefix(key, c.prefix+"tile:")
+}
+
+// storedAt returns when a tile was written: from its stored_at key, or for
+// tiles written before those were recorded, from the remaining TTL and the
+// TTL configured now. The latter drifts once TTLs are reloaded, but such
+// tiles are gone after one TTL.
+func (c *RedisCache) storedAt(z int, data []byte, recorded string, remaining time.Duration, now time.Time) time.Time {
+	if ns, err := strconv.ParseInt(recorded, 10, 64); err == nil {
+		return time.Unix(0, ns)
+	}
+	if remaining > 0 {
+		return now.Add(remaining - c.ttlForValue(z, data))
+	}
+	return time.Time{}
+}
+
+// scanBatch is how many keys Flush and Iterate scan per round trip.
+const scanBatch = 500
+
+// Flush deletes every tile in this cache's namespace and returns how many
+// were removed. Keys outside the namespace are left alone.
+func (c *RedisCache) Flush(ctx context.Context) (int64, error) {
+	pattern := c.prefix + "tile:*"
+	c.logger.Info("flushing redis cache", "pattern", pattern)
+
+	var deleted int64
+	var cursor uint64
+	for {
+		keys, next, err := c.client.Scan(ctx, cursor, pattern, scanBatch).Result()
+		if err != nil {
+			metrics.RedisErrors.WithLabelValues("scan").Inc()
+			return deleted, fmt.Errorf("redis scan error: %w", err)
+		}
+
+		if len(keys) > 0 {
+			storedAtKeys := make([]string, len(keys))
+			for i, key := range keys {
+				storedAtKeys[i] = c.storedAtKeyFor(key)
+			}
+			var unlinked *redis.IntCmd
+			_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				unlinked = pipe.Unlink(ctx, keys...)
+				pipe.Unlink(ctx, storedAtKeys...)
+				return nil
+			})
+			if err != nil {
+				metrics.RedisErrors.WithLabelValues("unlink").Inc()
+				return deleted, fmt.Errorf("redis unlink error: %w", err)
+			}
+			deleted += unlinked.Val()
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	c.logger.Info("flushed redis cache", "pattern", pattern, "deleted", deleted)
+	return deleted, nil
+}
+
+// Iterate visits every tile in this cache's namespace, with store times as
+// GetWithStoredAt returns them. Tiles written or
+// expiring during the scan may be missed, as SCAN only guarantees to return
+// keys present for its whole duration.
+func (c *RedisCache) Iterate(fn func(TileCacheKey, EntryInfo) bool) error {
+	ctx := context.Background()
+	pattern := c.prefix + "tile:*"
+
+	var cursor uint64
+	for {
+		keys, next, err := c.client.Scan(ctx, cursor, pattern, scanBatch).Result()
+		if err != nil {
+			metrics.RedisErrors.WithLabelValues("scan").Inc()
+			return fmt.Errorf("redis scan error: %w", err)
+		}
+
+		start := time.Now()
+		sizes := make([]*redis.IntCmd, len(keys))
+		ttls := make([]*redis.DurationCmd, len(keys))
+		recorded := make([]*redis.StringCmd, len(keys))
+		_, err = c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range keys {
+				sizes[i] = pipe.StrLen(ctx, key)
+				ttls[i] = pipe.PTTL(ctx, key)
+				recorded[i] = pipe.Get(ctx, c.storedAtKeyFor(key))
+			}
+			return nil
+		})
+		if err != nil && err != redis.Nil {
+			metrics.RedisErrors.WithLabelValues("scan").Inc()
+			return fmt.Errorf("redis scan error: %w", err)
+		}
+
+		for i, key := range keys {
+			k, ok := c.parseKey(key)
+			if !ok {
+				c.logger.Warn("skipping unexpected redis key", "key", key)
+				continue
+			}
+			info := EntryInfo{
+				Size:     sizes[i].Val(),
+				StoredAt: c.storedAt(k.Z, nil, recorded[i].Val(), ttls[i].Val(), start),
+			}
+			if !fn(k, info) {
+				return nil
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// parseKey reverses keyFor.
+func (c *RedisCache) parseKey(key string) (TileCacheKey, bool) {
+	rest, ok := strings.CutPrefix(key, c.prefix+"tile:")
+	if !ok {
+		return TileCacheKey{}, false
+	}
+	k, err := ParseTileCacheKey(strings.ReplaceAll(rest, ":", "/"))
+	return k, err == nil
+}
+
+// ttlFor returns the TTL for tiles at zoom z, falling back to the default.
+func (c *RedisCache) ttlFor(z int) time.Duration {
+	ttls := c.ttls.Load()
+	if ttl, ok := ttls.zoom[z]; ok && ttl > 0 {
+		return ttl
+	}
+	return ttls.ttl
+}
+
+// ttlForValue is ttlFor, except for entries recording a missing tile.
+func (c *RedisCache) ttlForValue(z int, v []byte) time.Duration {
+	if c.notFoundTTL > 0 && IsNotFound(v) {
+		return c.notFoundTTL
+	}
+	return c.ttlFor(z)
+}
+
+// SetTTLs replaces the TTLs applied to tiles stored from now on. Tiles
+// already in Redis keep the TTL and store time they were written with.
+func (c *RedisCache) SetTTLs(ttl time.Duration, zoomTTLs map[int]time.Duration) {
+	if ttl == 0 {
+		ttl = 24 * time.Hour // default TTL
+	}
+	c.ttls.Store(&redisTTLs{ttl: ttl, zoom: zoomTTLs})
 }
 
 func (c *RedisCache) Get(k TileCacheKey) (TileCacheValue, bool, error) {
@@ -88,10 +265,15 @@ func (c *RedisCache) Set(k TileCacheKey, v TileCacheValue) error {
 	ctx := context.Background()
 	key := c.keyFor(k)
 
-	c.logger.Debug("redis cache set", "key", key)
+	ttl := c.ttlForValue(k.Z, v)
+	c.logger.Debug("redis cache set", "key", key, "ttl", ttl)
 
 	// Cast TileCacheValue to []byte for redis
-	err := c.client.Set(ctx, key, []byte(v), c.ttl).Err()
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, []byte(v), ttl)
+		pipe.Set(ctx, c.storedAtKeyFor(key), start.UnixNano(), ttl)
+		return nil
+	})
 	duration := time.Since(start).Seconds()
 	metrics.RedisOperationDuration.WithLabelValues("set").Observe(duration)
 
@@ -104,6 +286,82 @@ func (c *RedisCache) Set(k TileCacheKey, v TileCacheValue) error {
 	return nil
 }
 
+func (c *RedisCache) Delete(k TileCacheKey) error {
+	start := time.Now()
+	key := c.keyFor(k)
+
+	c.logger.Debug("redis cache delete", "key", key)
+
+	err := c.client.Del(context.Background(), key, c.storedAtKeyFor(key)).Err()
+	metrics.RedisOperationDuration.WithLabelValues("delete").Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.RedisErrors.WithLabelValues("delete").Inc()
+		c.logger.Error("redis cache delete failed", "key", key, "error", err)
+		return fmt.Errorf("redis delete error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *RedisCache) Has(k TileCacheKey) (bool, error) {
+	start := time.Now()
+	key := c.keyFor(k)
+
+	n, err := c.client.Exists(context.Background(), key).Result()
+	metrics.RedisOperationDuration.WithLabelValues("exists").Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.RedisErrors.WithLabelValues("exists").Inc()
+		c.logger.Error("redis cache exists failed", "key", key, "error", err)
+		return false, fmt.Errorf("redis exists error: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+// GetWithStoredAt returns the tile with the time it was written, recorded
+// next to it by Set.
+func (c *RedisCache) GetWithStoredAt(k TileCacheKey) (TileCacheValue, time.Time, bool, error) {
+	start := time.Now()
+	ctx := context.Background()
+	key := c.keyFor(k)
+
+	c.logger.Debug("redis cache get with stored_at", "key", key)
+
+	var getCmd, storedAtCmd *redis.StringCmd
+	var ttlCmd *redis.DurationCmd
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		getCmd = pipe.Get(ctx, key)
+		storedAtCmd = pipe.Get(ctx, c.storedAtKeyFor(key))
+		ttlCmd = pipe.PTTL(ctx, key)
+		return nil
+	})
+
+	duration := time.Since(start).Seconds()
+	metrics.RedisOperationDuration.WithLabelValues("get").Observe(duration)
+
+	if err != nil && err != redis.Nil {
+		metrics.RedisErrors.WithLabelValues("get").Inc()
+		c.logger.Error("redis cache get failed", "key", key, "error", err)
+		return nil, time.Time{}, false, fmt.Errorf("redis get error: %w", err)
+	}
+
+	data, err := getCmd.Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, time.Time{}, false, nil
+		}
+		metrics.RedisErrors.WithLabelValues("get").Inc()
+		return nil, time.Time{}, false, fmt.Errorf("redis get error: %w", err)
+	}
+
+	return data, c.storedAt(k.Z, data, storedAtCmd.Val(), ttlCmd.Val(), start), true, nil
+}
+
+// Client exposes the underlying connection for pub/sub consumers.
+func (c *RedisCache) Client() *redis.Client {
+	return c.client
+}
+
 func (c *RedisCache) Close() error {
 	c.logger.Info("redis connection closed")
 	return c.client.Close()
@@ -0,0 +1,244 @@
+//go:build redis
+
+package cache
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func newTestRedisCache(t *testing.T, mr *miniredis.Miniredis, cfg RedisConfig) *RedisCache {
+	t.Helper()
+
+	cfg.Addr = mr.Addr()
+	c, err := NewRedisCache(cfg, logger.FromContext(context.Background()))
+	if err != nil {
+		t.Fatalf("failed to create redis cache: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestRedisCache_PerZoomTTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := newTestRedisCache(t, mr, RedisConfig{
+		TTL: 24 * time.Hour,
+		ZoomTTLs: map[int]time.Duration{
+			2:  30 * 24 * time.Hour,
+			18: 6 * time.Hour,
+		},
+	})
+
+	tests := []struct {
+		key  TileCacheKey
+		want time.Duration
+	}{
+		{TileCacheKey{Z: 2, X: 1, Y: 1}, 30 * 24 * time.Hour},
+		{TileCacheKey{Z: 18, X: 5, Y: 7}, 6 * time.Hour},
+		{TileCacheKey{Z: 10, X: 3, Y: 4}, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if err := c.Set(tt.key, []byte("tile")); err != nil {
+			t.Fatalf("Set %+v failed: %v", tt.key, err)
+		}
+		if got := mr.TTL(c.keyFor(tt.key)); got != tt.want {
+			t.Errorf("zoom %d: TTL = %s, want %s", tt.key.Z, got, tt.want)
+		}
+	}
+}
+
+func TestRedisCache_StoredAtUsesZoomTTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := newTestRedisCache(t, mr, RedisConfig{
+		TTL:      24 * time.Hour,
+		ZoomTTLs: map[int]time.Duration{18: time.Hour},
+	})
+
+	k := TileCacheKey{Z: 18, X: 5, Y: 7}
+	before := time.Now()
+	if err := c.Set(k, []byte("tile")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	_, storedAt, ok, err := c.GetWithStoredAt(k)
+	if err != nil || !ok {
+		t.Fatalf("GetWithStoredAt = %v, %v", ok, err)
+	}
+	if d := storedAt.Sub(before); d < -time.Second || d > time.Second {
+		t.Fatalf("stored_at %s is %s away from the write", storedAt, d)
+	}
+}
+
+func TestRedisCache_StoredAtSurvivesTTLReload(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := newTestRedisCache(t, mr, RedisConfig{TTL: 24 * time.Hour})
+
+	k := TileCacheKey{Z: 10, X: 5, Y: 7}
+	if err := c.Set(k, []byte("tile")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	written := time.Now()
+
+	// Lowering or raising the TTL must not move the store time of tiles
+	// written before
+	for _, ttl := range []time.Duration{time.Hour, 30 * 24 * time.Hour} {
+		c.SetTTLs(ttl, nil)
+		_, storedAt, ok, err := c.GetWithStoredAt(k)
+		if err != nil || !ok {
+			t.Fatalf("GetWithStoredAt = %v, %v", ok, err)
+		}
+		if d := storedAt.Sub(written); d < -time.Second || d > time.Second {
+			t.Fatalf("TTL %s: stored_at %s is %s away from the write", ttl, storedAt, d)
+		}
+		if err := c.Iterate(func(_ TileCacheKey, info EntryInfo) bool {
+			if d := info.StoredAt.Sub(written); d < -time.Second || d > time.Second {
+				t.Fatalf("TTL %s: iterated stored_at %s is %s away from the write", ttl, info.StoredAt, d)
+			}
+			return true
+		}); err != nil {
+			t.Fatalf("Iterate failed: %v", err)
+		}
+	}
+
+	// Tiles written without a stored_at key fall back to the remaining TTL
+	legacy := TileCacheKey{Z: 10, X: 6, Y: 7}
+	mr.Set(c.keyFor(legacy), "tile")
+	mr.SetTTL(c.keyFor(legacy), 20*24*time.Hour)
+	_, storedAt, _, err := c.GetWithStoredAt(legacy)
+	if err != nil {
+		t.Fatalf("GetWithStoredAt failed: %v", err)
+	}
+	if d := time.Since(storedAt); d < 10*24*time.Hour-time.Second || d > 10*24*time.Hour+time.Second {
+		t.Fatalf("legacy stored_at %s is %s old, want 10 days", storedAt, d)
+	}
+}
+
+func TestRedisCache_Has(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := newTestRedisCache(t, mr, RedisConfig{TTL: time.Hour})
+	k := TileCacheKey{X: 1, Y: 2, Z: 3}
+
+	if ok, err := c.Has(k); err != nil || ok {
+		t.Fatalf("expected missing tile, got ok=%v err=%v", ok, err)
+	}
+	if err := c.Set(k, TileCacheValue("tile")); err != nil {
+		t.Fatalf("failed to set tile: %v", err)
+	}
+	if ok, err := c.Has(k); err != nil || !ok {
+		t.Fatalf("expected stored tile, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestRedisCache_Delete(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := newTestRedisCache(t, mr, RedisConfig{TTL: time.Hour, KeyPrefix: "gh:"})
+	k := TileCacheKey{X: 1, Y: 2, Z: 3}
+
+	if err := c.Set(k, TileCacheValue("tile")); err != nil {
+		t.Fatalf("failed to set tile: %v", err)
+	}
+	if err := c.Delete(k); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if mr.Exists(c.keyFor(k)) || mr.Exists(c.storedAtKeyFor(c.keyFor(k))) {
+		t.Fatalf("expected the keys to be deleted, have %v", mr.Keys())
+	}
+	if err := c.Delete(k); err != nil {
+		t.Fatalf("deleting a missing tile failed: %v", err)
+	}
+}
+
+func TestRedisCache_KeyPrefixAndNamespacedFlush(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := newTestRedisCache(t, mr, RedisConfig{TTL: time.Hour, KeyPrefix: "guidehelper:"})
+
+	for x := 0; x < 3; x++ {
+		if err := c.Set(TileCacheKey{X: x, Y: 2, Z: 3}, TileCacheValue("tile")); err != nil {
+			t.Fatalf("failed to set tile: %v", err)
+		}
+	}
+	if !mr.Exists("guidehelper:tile:3:0:2") {
+		t.Fatalf("expected prefixed key, have %v", mr.Keys())
+	}
+
+	// Another service sharing the instance, including one using the same tile keys
+	mr.Set("tile:3:0:2", "other")
+	mr.Set("sessions:42", "other")
+
+	deleted, err := c.Flush(context.Background())
+	if err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+	if deleted != 3 {
+		t.Fatalf("expected 3 deleted keys, got %d", deleted)
+	}
+	if keys := mr.Keys(); !slices.Equal(keys, []string{"sessions:42", "tile:3:0:2"}) {
+		t.Fatalf("flush touched unrelated keys, left %v", keys)
+	}
+}
+
+func TestRedisCache_NotFoundTTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := newTestRedisCache(t, mr, RedisConfig{
+		TTL:         24 * time.Hour,
+		NotFoundTTL: time.Hour,
+	})
+
+	missing := TileCacheKey{Z: 12, X: 1, Y: 1}
+	present := TileCacheKey{Z: 12, X: 2, Y: 2}
+	if err := c.Set(missing, NotFoundMarker); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := c.Set(present, []byte("tile")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	data, storedAt, ok, err := c.GetWithStoredAt(missing)
+	if err != nil || !ok || !IsNotFound(data) {
+		t.Fatalf("expected the not found entry, got %q ok=%v err=%v", data, ok, err)
+	}
+	if d := time.Since(storedAt); d < -time.Second || d > time.Second {
+		t.Fatalf("stored_at %s is %s away from the write", storedAt, d)
+	}
+
+	mr.FastForward(2 * time.Hour)
+
+	if _, ok, _ := c.Get(missing); ok {
+		t.Fatal("expected the not found entry to expire on the not found TTL")
+	}
+	if data, ok, _ := c.Get(present); !ok || string(data) != "tile" {
+		t.Fatal("expected the tile to persist on the tile TTL")
+	}
+}
+
+func TestRedisCache_Layers(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := newTestRedisCache(t, mr, RedisConfig{TTL: time.Hour})
+
+	k := TileCacheKey{X: 0, Y: 2, Z: 3, Layer: "cyclosm"}
+	if err := c.Set(k, TileCacheValue("tile")); err != nil {
+		t.Fatalf("failed to set tile: %v", err)
+	}
+	if !mr.Exists("tile:cyclosm:3:0:2") {
+		t.Fatalf("expected a layered key, have %v", mr.Keys())
+	}
+	if _, ok, _ := c.Get(TileCacheKey{X: 0, Y: 2, Z: 3}); ok {
+		t.Fatal("the default layer should not see the layer's tile")
+	}
+
+	var listed []TileCacheKey
+	if err := c.Iterate(func(k TileCacheKey, _ EntryInfo) bool {
+		listed = append(listed, k)
+		return true
+	}); err != nil {
+		t.Fatalf("iterate failed: %v", err)
+	}
+	if len(listed) != 1 || listed[0] != k {
+		t.Fatalf("listed %+v, want %+v", listed, k)
+	}
+}
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+)
+
+const defaultRemoteTimeout = 5 * time.Second
+
+// RemoteCache forwards to another cache service over its HTTP API, so cache
+// instances can be chained into tiers (edge -> regional -> origin).
+type RemoteCache struct {
+	baseURL string
+	client  *http.Client
+	logger  logger.Logger
+}
+
+type RemoteConfig struct {
+	// BaseURL of the next cache tier, e.g. "http://cache-regional:8080"
+	BaseURL string
+	Timeout time.Duration
+}
+
+type remoteResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Data    struct {
+		Data     []byte     `json:"data"`
+		Exists   bool       `json:"exists"`
+		StoredAt *time.Time `json:"stored_at"`
+	} `json:"data"`
+}
+
+func NewRemoteCache(cfg RemoteConfig, l logger.Logger) *RemoteCache {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultRemoteTimeout
+	}
+
+	return &RemoteCache{
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+		logger:  l,
+	}
+}
+
+var _ TileCache = (*RemoteCache)(nil)
+var _ TimestampedTileCache = (*RemoteCache)(nil)
+var _ Deleter = (*RemoteCache)(nil)
+
+func (c *RemoteCache) urlFor(k TileCacheKey) string {
+	if k.Layer != "" {
+		return c.baseURL + "/api/v1/layers/" + k.Layer + "/tile/" + tilemath.Key(k.Z, k.X, k.Y)
+	}
+	return c.baseURL + "/api/v1/tile/" + k.String()
+}
+
+func (c *RemoteCache) Get(k TileCacheKey) (TileCacheValue, bool, error) {
+	data, _, exists, err := c.GetWithStoredAt(k)
+	return data, exists, err
+}
+
+// GetWithStoredAt accepts both the JSON envelope and a raw tile body, in
+// which case a 404 is a miss.
+func (c *RemoteCache) GetWithStoredAt(k TileCacheKey) (TileCacheValue, time.Time, bool, error) {
+	url := c.urlFor(k)
+	c.logger.Debug("remote cache get", "url", url)
+
+	resp, err := c.client.Get(url)
+	if err != nil {
+		c.logger.Error("remote cache get failed", "url", url, "error", err)
+		return nil, time.Time{}, false, fmt.Errorf("remote get error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("remote get error: %w", err)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "application/json") {
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			return nil, time.Time{}, false, nil
+		case resp.StatusCode != http.StatusOK:
+			return nil, time.Time{}, false, fmt.Errorf("remote get error: status %d", resp.StatusCode)
+		}
+		return body, time.Time{}, len(body) > 0, nil
+	}
+
+	var r remoteResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("remote get error: invalid response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || !r.Success {
+		return nil, time.Time{}, false, fmt.Errorf("remote get error: status %d: %s", resp.StatusCode, r.Message)
+	}
+	if !r.Data.Exists {
+		return nil, time.Time{}, false, nil
+	}
+
+	var storedAt time.Time
+	if r.Data.StoredAt != nil {
+		storedAt = *r.Data.StoredAt
+	}
+	return r.Data.Data, storedAt, true, nil
+}
+
+func (c *RemoteCache) Set(k TileCacheKey, v TileCacheValue) error {
+	url := c.urlFor(k)
+	c.logger.Debug("remote cache set", "url", url, "size", len(v))
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(v))
+	if err != nil {
+		return fmt.Errorf("remote set error: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	return c.do(req, "set")
+}
+
+// Delete needs the remote to expose DELETE on the tile route.
+func (c *RemoteCache) Delete(k TileCacheKey) error {
+	url := c.urlFor(k)
+	c.logger.Debug("remote cache delete", "url", url)
+
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		return fmt.Errorf("remote delete error: %w", err)
+	}
+
+	return c.do(req, "delete")
+}
+
+func (c *RemoteCache) do(req *http.Request, op string) error {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.logger.Error("remote cache request failed", "op", op, "url", req.URL.String(), "error", err)
+		return fmt.Errorf("remote %s error: %w", op, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		c.logger.Error("remote cache request rejected", "op", op, "url", req.URL.String(), "status", resp.StatusCode)
+		return fmt.Errorf("remote %s error: status %d", op, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+// fakeCacheService mimics the tile routes of the cache service HTTP API.
+func fakeCacheService(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	var mu sync.Mutex
+	tiles := make(map[string][]byte)
+	storedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var z, x, y int
+		if _, err := fmt.Sscanf(r.URL.Path, "/api/v1/tile/%d/%d/%d", &z, &x, &y); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		key := fmt.Sprintf("%d/%d/%d", z, x, y)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := tiles[key]
+			resp := map[string]any{"success": true, "message": "got tile", "data": map[string]any{"data": data, "exists": ok}}
+			if ok {
+				resp["data"].(map[string]any)["stored_at"] = storedAt
+			}
+			json.NewEncoder(w).Encode(resp)
+		case http.MethodPost:
+			body, _ := io.ReadAll(r.Body)
+			tiles[key] = body
+			json.NewEncoder(w).Encode(map[string]any{"success": true, "message": "tile stored"})
+		case http.MethodDelete:
+			delete(tiles, key)
+			json.NewEncoder(w).Encode(map[string]any{"success": true, "message": "tile deleted"})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRemoteCache_RoundTrip(t *testing.T) {
+	srv := fakeCacheService(t)
+	c := NewRemoteCache(RemoteConfig{BaseURL: srv.URL + "/"}, logger.FromContext(context.Background()))
+	k := TileCacheKey{Z: 12, X: 2048, Y: 1361}
+
+	if _, exists, err := c.Get(k); err != nil || exists {
+		t.Fatalf("expected miss before Set, got exists=%v err=%v", exists, err)
+	}
+
+	tile := []byte{0x89, 'P', 'N', 'G', 0, 1, 2, 3}
+	if err := c.Set(k, tile); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	data, storedAt, exists, err := c.GetWithStoredAt(k)
+	if err != nil || !exists {
+		t.Fatalf("expected hit after Set, got exists=%v err=%v", exists, err)
+	}
+	if string(data) != string(tile) {
+		t.Fatalf("got %v, want %v", data, tile)
+	}
+	if storedAt.IsZero() {
+		t.Fatal("expected stored_at to be forwarded")
+	}
+
+	if err := c.Delete(k); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, exists, err := c.Get(k); err != nil || exists {
+		t.Fatalf("expected miss after Delete, got exists=%v err=%v", exists, err)
+	}
+}
+
+func TestRemoteCache_RawResponses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/tile/1/0/0" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewRemoteCache(RemoteConfig{BaseURL: srv.URL}, logger.FromContext(context.Background()))
+
+	data, exists, err := c.Get(TileCacheKey{Z: 1, X: 0, Y: 0})
+	if err != nil || !exists || string(data) != "png" {
+		t.Fatalf("raw hit = %q, %v, %v", data, exists, err)
+	}
+	if _, exists, err := c.Get(TileCacheKey{Z: 1, X: 1, Y: 0}); err != nil || exists {
+		t.Fatalf("raw 404 should be a miss, got exists=%v err=%v", exists, err)
+	}
+}
+
+func TestRemoteCache_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	c := NewRemoteCache(RemoteConfig{BaseURL: srv.URL, Timeout: 50 * time.Millisecond}, logger.FromContext(context.Background()))
+
+	start := time.Now()
+	if _, _, err := c.Get(TileCacheKey{Z: 1, X: 0, Y: 0}); err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Get took %s despite the timeout", elapsed)
+	}
+}
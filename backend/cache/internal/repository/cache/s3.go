@@ -0,0 +1,248 @@
+//go:build s3
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	defaultS3Region    = "us-east-1"
+	defaultS3Timeout   = 10 * time.Second
+	defaultS3Extension = ".png"
+)
+
+// ErrS3Config is returned by NewS3Cache for an incomplete configuration.
+var ErrS3Config = errors.New("invalid s3 configuration")
+
+// S3Cache stores tiles as objects in an S3-compatible bucket, so replicas
+// can share one durable cache. It talks to the bucket through the MinIO
+// client, which works with AWS S3 as well.
+type S3Cache struct {
+	cfg     S3Config
+	client  *minio.Client
+	timeout time.Duration
+	logger  logger.Logger
+}
+
+func init() {
+	backends["s3"] = func(cfg BackendConfig, l logger.Logger) (TileCache, error) {
+		c, err := NewS3Cache(cfg.S3, l)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+}
+
+func NewS3Cache(cfg S3Config, l logger.Logger) (*S3Cache, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("%w: bucket is required", ErrS3Config)
+	}
+	endpoint, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("%w: endpoint %q should be an http or https URL", ErrS3Config, cfg.Endpoint)
+	}
+	if endpoint.Path != "" {
+		return nil, fmt.Errorf("%w: endpoint %q should not have a path", ErrS3Config, cfg.Endpoint)
+	}
+	if cfg.Region == "" {
+		cfg.Region = defaultS3Region
+	}
+	if cfg.Extension == "" {
+		cfg.Extension = defaultS3Extension
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultS3Timeout
+	}
+
+	secure := endpoint.Scheme == "https"
+	transport, err := minio.DefaultTransport(secure)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 transport: %w", err)
+	}
+	// Listing runs without an overall deadline, a stalled page still fails
+	transport.ResponseHeaderTimeout = timeout
+
+	lookup := minio.BucketLookupDNS
+	if cfg.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:       secure,
+		Transport:    transport,
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrS3Config, err)
+	}
+
+	l.Info("s3 cache initialized", "endpoint", endpoint.String(), "bucket", cfg.Bucket, "prefix", cfg.Prefix)
+
+	return &S3Cache{
+		cfg:     cfg,
+		client:  client,
+		timeout: timeout,
+		logger:  l,
+	}, nil
+}
+
+var _ TileCache = (*S3Cache)(nil)
+var _ TimestampedTileCache = (*S3Cache)(nil)
+var _ Deleter = (*S3Cache)(nil)
+var _ Haser = (*S3Cache)(nil)
+var _ Iterator = (*S3Cache)(nil)
+
+// objectKey returns the object key of a tile, e.g. "tiles/5/10/12.png", or
+// "tiles/cyclosm/5/10/12.png" outside the default layer.
+func (c *S3Cache) objectKey(k TileCacheKey) string {
+	return c.cfg.Prefix + k.String() + c.cfg.Extension
+}
+
+// parseObjectKey reverses objectKey, skipping objects that are not tiles.
+func (c *S3Cache) parseObjectKey(key string) (TileCacheKey, bool) {
+	rest, ok := strings.CutPrefix(key, c.cfg.Prefix)
+	if !ok {
+		return TileCacheKey{}, false
+	}
+	rest, ok = strings.CutSuffix(rest, c.cfg.Extension)
+	if !ok {
+		return TileCacheKey{}, false
+	}
+	k, err := ParseTileCacheKey(rest)
+	return k, err == nil
+}
+
+// missing reports whether err says the object does not exist. A missing
+// bucket is an error like any other.
+func missing(err error) bool {
+	return minio.ToErrorResponse(err).Code == minio.NoSuchKey
+}
+
+// fail logs a failed request and wraps its error.
+func (c *S3Cache) fail(op, key string, err error) error {
+	resp := minio.ToErrorResponse(err)
+	c.logger.Error("s3 cache request failed", "op", op, "key", key,
+		"status", resp.StatusCode, "code", resp.Code, "error", err)
+	return fmt.Errorf("s3 %s error: %w", op, err)
+}
+
+func (c *S3Cache) Get(k TileCacheKey) (TileCacheValue, bool, error) {
+	data, _, exists, err := c.GetWithStoredAt(k)
+	return data, exists, err
+}
+
+// GetWithStoredAt reports the object's Last-Modified time, which S3 gives in
+// whole seconds.
+func (c *S3Cache) GetWithStoredAt(k TileCacheKey) (TileCacheValue, time.Time, bool, error) {
+	key := c.objectKey(k)
+	c.logger.Debug("s3 cache get", "key", key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	obj, err := c.client.GetObject(ctx, c.cfg.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, time.Time{}, false, c.fail("get", key, err)
+	}
+	defer obj.Close()
+
+	info, err := obj.Stat()
+	if missing(err) {
+		return nil, time.Time{}, false, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, false, c.fail("get", key, err)
+	}
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, time.Time{}, false, c.fail("get", key, err)
+	}
+	return data, info.LastModified, true, nil
+}
+
+func (c *S3Cache) Set(k TileCacheKey, v TileCacheValue) error {
+	key := c.objectKey(k)
+	c.logger.Debug("s3 cache set", "key", key, "size", len(v))
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	_, err := c.client.PutObject(ctx, c.cfg.Bucket, key, bytes.NewReader(v), int64(len(v)), minio.PutObjectOptions{
+		ContentType: mime.TypeByExtension(c.cfg.Extension),
+	})
+	if err != nil {
+		return c.fail("set", key, err)
+	}
+	return nil
+}
+
+// Delete succeeds for missing tiles, as S3 does.
+func (c *S3Cache) Delete(k TileCacheKey) error {
+	key := c.objectKey(k)
+	c.logger.Debug("s3 cache delete", "key", key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	if err := c.client.RemoveObject(ctx, c.cfg.Bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return c.fail("delete", key, err)
+	}
+	return nil
+}
+
+func (c *S3Cache) Has(k TileCacheKey) (bool, error) {
+	key := c.objectKey(k)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	_, err := c.client.StatObject(ctx, c.cfg.Bucket, key, minio.StatObjectOptions{})
+	if missing(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, c.fail("has", key, err)
+	}
+	return true, nil
+}
+
+// Iterate lists the objects under the prefix, which the client fetches page
+// by page. Objects that are not tiles are skipped.
+func (c *S3Cache) Iterate(fn func(TileCacheKey, EntryInfo) bool) error {
+	// Cancelling stops the client listing further pages
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for obj := range c.client.ListObjects(ctx, c.cfg.Bucket, minio.ListObjectsOptions{
+		Prefix:    c.cfg.Prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return c.fail("list", c.cfg.Prefix, obj.Err)
+		}
+		k, ok := c.parseObjectKey(obj.Key)
+		if !ok {
+			continue
+		}
+		if !fn(k, EntryInfo{Size: obj.Size, StoredAt: obj.LastModified}) {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+//go:build s3
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+// fakeS3 mimics the object and ListObjectsV2 routes of a path-style S3 API
+// for a single bucket.
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	pageSize int
+}
+
+func newFakeS3(t *testing.T, bucket string) (*fakeS3, *httptest.Server) {
+	t.Helper()
+
+	f := &fakeS3{objects: make(map[string][]byte), pageSize: 2}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		key, ok := strings.CutPrefix(r.URL.Path, "/"+bucket)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		key = strings.TrimPrefix(key, "/")
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		switch {
+		case key == "" && r.Method == http.MethodGet:
+			f.list(w, r)
+		case r.Method == http.MethodGet || r.Method == http.MethodHead:
+			data, ok := f.objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Last-Modified", "Wed, 01 Oct 2025 12:00:00 GMT")
+			w.Write(data)
+		case r.Method == http.MethodPut:
+			body, err := readS3Payload(r)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			f.objects[key] = body
+		case r.Method == http.MethodDelete:
+			delete(f.objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+// readS3Payload reads the body of a PUT, decoding the aws-chunked encoding
+// clients sign payloads with over plain HTTP.
+func readS3Payload(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+
+	var body []byte
+	br := bufio.NewReader(r.Body)
+	for {
+		header, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return body, nil
+		}
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		body = append(body, chunk[:size]...)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, r.URL.Query().Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	start := 0
+	if token := r.URL.Query().Get("continuation-token"); token != "" {
+		fmt.Sscan(token, &start)
+	}
+	end := min(start+f.pageSize, len(keys))
+
+	type object struct {
+		Key  string `xml:"Key"`
+		Size int    `xml:"Size"`
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		IsTruncated           bool     `xml:"IsTruncated"`
+		NextContinuationToken string   `xml:"NextContinuationToken,omitempty"`
+		Contents              []object `xml:"Contents"`
+	}{IsTruncated: end < len(keys)}
+	if result.IsTruncated {
+		result.NextContinuationToken = fmt.Sprint(end)
+	}
+	for _, key := range keys[start:end] {
+		result.Contents = append(result.Contents, object{Key: key, Size: len(f.objects[key])})
+	}
+	xml.NewEncoder(w).Encode(result)
+}
+
+func newTestS3Cache(t *testing.T) (*S3Cache, *fakeS3) {
+	t.Helper()
+
+	f, srv := newFakeS3(t, "tiles-bucket")
+	c, err := NewS3Cache(S3Config{
+		Endpoint:  srv.URL,
+		Bucket:    "tiles-bucket",
+		AccessKey: "test-key",
+		SecretKey: "test-secret",
+		Prefix:    "tiles/",
+		PathStyle: true,
+	}, logger.FromContext(context.Background()))
+	if err != nil {
+		t.Fatalf("NewS3Cache failed: %v", err)
+	}
+	return c, f
+}
+
+func TestS3Cache_RoundTrip(t *testing.T) {
+	c, f := newTestS3Cache(t)
+	k := TileCacheKey{Z: 5, X: 10, Y: 12}
+
+	if _, ok, err := c.Get(k); err != nil || ok {
+		t.Fatalf("expected a miss, got %v, %v", ok, err)
+	}
+	if err := c.Set(k, TileCacheValue("tile")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, ok := f.objects["tiles/5/10/12.png"]; !ok {
+		t.Fatalf("expected the tile at tiles/5/10/12.png, objects %v", f.objects)
+	}
+
+	data, storedAt, ok, err := c.GetWithStoredAt(k)
+	if err != nil || !ok || string(data) != "tile" {
+		t.Fatalf("GetWithStoredAt = %q, %v, %v", data, ok, err)
+	}
+	if !storedAt.Equal(time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected stored_at %v", storedAt)
+	}
+	if ok, err := c.Has(k); err != nil || !ok {
+		t.Fatalf("Has = %v, %v", ok, err)
+	}
+
+	if err := c.Delete(k); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if ok, err := c.Has(k); err != nil || ok {
+		t.Fatalf("Has after Delete = %v, %v", ok, err)
+	}
+}
+
+func TestS3Cache_IteratePages(t *testing.T) {
+	c, f := newTestS3Cache(t)
+	want := []TileCacheKey{{Z: 1, X: 0, Y: 0}, {Z: 1, X: 0, Y: 1}, {Z: 1, X: 1, Y: 0}, {Z: 2, X: 3, Y: 3}, {Z: 4, X: 15, Y: 9}}
+	for _, k := range want {
+		if err := c.Set(k, TileCacheValue("tile")); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	// Neither is a tile, both must be skipped
+	f.objects["tiles/README.txt"] = []byte("not a tile")
+	f.objects["tiles/1/01/0.png"] = []byte("not canonical")
+
+	seen := map[TileCacheKey]bool{}
+	err := c.Iterate(func(k TileCacheKey, info EntryInfo) bool {
+		if info.Size != 4 {
+			t.Errorf("tile %+v has size %d", k, info.Size)
+		}
+		seen[k] = true
+		return true
+	})
+	if err != nil {
+		t.Fatalf("Iterate failed: %v", err)
+	}
+	if len(seen) != len(want) {
+		t.Fatalf("iterated %v, want %v", seen, want)
+	}
+	for _, k := range want {
+		if !seen[k] {
+			t.Errorf("tile %+v was not iterated", k)
+		}
+	}
+}
+
+func TestS3Cache_RejectedRequestsFail(t *testing.T) {
+	_, srv := newFakeS3(t, "tiles-bucket")
+	c, err := NewS3Cache(S3Config{
+		Endpoint:  srv.URL,
+		Bucket:    "tiles-bucket",
+		AccessKey: "wrong-key",
+		SecretKey: "test-secret",
+		PathStyle: true,
+	}, logger.FromContext(context.Background()))
+	if err != nil {
+		t.Fatalf("NewS3Cache failed: %v", err)
+	}
+
+	if _, _, err := c.Get(TileCacheKey{Z: 1}); err == nil {
+		t.Fatal("expected a rejected request to fail rather than miss")
+	}
+}
+
+func TestNewS3Cache_ValidatesConfig(t *testing.T) {
+	l := logger.FromContext(context.Background())
+	for _, cfg := range []S3Config{
+		{Endpoint: "http://minio:9000"},
+		{Endpoint: "minio:9000", Bucket: "tiles"},
+		{Endpoint: "http://minio:9000/s3", Bucket: "tiles"},
+	} {
+		if _, err := NewS3Cache(cfg, l); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+}
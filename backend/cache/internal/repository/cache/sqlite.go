@@ -1,46 +1,97 @@
+//go:build sqlite
+
 package cache
 
 import (
+	"context"
 	"database/sql"
 	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pressly/goose/v3"
 )
 
+const defaultAccessFlushInterval = 5 * time.Second
+
+// ErrMigrationTimeout is returned by NewSQLiteCache when the schema
+// migrations do not finish within SQLiteConfig.MigrationTimeout.
+var ErrMigrationTimeout = errors.New("sqlite migrations timed out")
+
 type SQLiteCache struct {
 	db     *sql.DB
 	logger logger.Logger
+	access *accessRecorder
+	dedup  bool
+	now    func() time.Time
+
+	// stopFlusher cancels the access flusher, which sends the error of its
+	// final flush to flusherDone before closing it
+	stopFlusher context.CancelFunc
+	flusherDone chan error
 }
 
-func NewSQLiteCache(path string, l logger.Logger) (*SQLiteCache, error) {
-	db, err := sql.Open("sqlite3", path)
-	if err != nil {
-		return nil, err
+func init() {
+	backends["sqlite"] = func(cfg BackendConfig, l logger.Logger) (TileCache, error) {
+		c, err := NewSQLiteCache(cfg.SQLite, l)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
 	}
+}
 
-	err = db.Ping()
+func NewSQLiteCache(cfg SQLiteConfig, l logger.Logger) (*SQLiteCache, error) {
+	path := cfg.Path
+	db, err := sql.Open("sqlite3", path)
 	if err != nil {
 		return nil, err
 	}
 
 	c := &SQLiteCache{
-		db:     db,
-		logger: l,
+		db:          db,
+		logger:      l,
+		access:      newAccessRecorder(),
+		dedup:       cfg.Dedup,
+		now:         time.Now,
+		flusherDone: make(chan error, 1),
 	}
 
-	err = c.runMigrations()
+	// Connecting already waits on a lock held by another process, so it is
+	// bounded by the migration timeout too
+	err = c.runMigrations(cfg.MigrationTimeout)
 	if err != nil {
+		// A migration cut off by the timeout may still be waiting on the
+		// lock, which Close would wait for too
+		go db.Close()
 		return nil, err
 	}
 
-	l.Info("sqlite cache initialized", "path", path)
+	flushInterval := cfg.AccessFlushInterval
+	if flushInterval <= 0 {
+		flushInterval = defaultAccessFlushInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.stopFlusher = cancel
+	go c.runAccessFlusher(ctx, flushInterval)
+
+	l.Info("sqlite cache initialized", "path", path, "dedup", cfg.Dedup)
 
 	return c, nil
 }
 
-func (c *SQLiteCache) runMigrations() error {
+// runMigrations applies the pending migrations, giving up after timeout
+// (zero waits) so a locked or huge database fails startup instead of hanging
+// it. SQLite's busy wait does not notice a cancelled context, so on timeout
+// the migrations are left to fail or finish in the background. Each one runs
+// in its own transaction, so one that is cut off is rolled back and applied
+// again on the next start.
+func (c *SQLiteCache) runMigrations(timeout time.Duration) error {
 	goose.SetBaseFS(migrations)
 
 	err := goose.SetDialect("sqlite3")
@@ -48,25 +99,52 @@ func (c *SQLiteCache) runMigrations() error {
 		return err
 	}
 
-	err = goose.Up(c.db, "migrations")
-	if err != nil {
-		return err
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	return nil
+	done := make(chan error, 1)
+	go func() {
+		if err := c.db.PingContext(ctx); err != nil {
+			done <- err
+			return
+		}
+		done <- goose.UpContext(ctx, c.db, "migrations")
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil && ctx.Err() != nil {
+			return fmt.Errorf("%w after %v: %w", ErrMigrationTimeout, timeout, err)
+		}
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%w after %v, the database may be locked by another process", ErrMigrationTimeout, timeout)
+	}
 }
 
 var _ TileCache = (*SQLiteCache)(nil)
+var _ TimestampedTileCache = (*SQLiteCache)(nil)
+var _ Deleter = (*SQLiteCache)(nil)
+var _ Haser = (*SQLiteCache)(nil)
+var _ Iterator = (*SQLiteCache)(nil)
+var _ Purger = (*SQLiteCache)(nil)
+var _ AccessTracker = (*SQLiteCache)(nil)
+var _ StatsReporter = (*SQLiteCache)(nil)
 
 func (c *SQLiteCache) Get(k TileCacheKey) (TileCacheValue, bool, error) {
 	c.logger.Debug("sqlite cache get", "z", k.Z, "x", k.X, "y", k.Y)
 
-	query := `SELECT tile_data
-	FROM tile_cache
-	WHERE x = ? AND y = ? AND z = ?`
+	query := `SELECT COALESCE(b.data, t.tile_data)
+	FROM tile_cache t
+	LEFT JOIN tile_blobs b ON b.hash = t.blob_hash
+	WHERE t.x = ? AND t.y = ? AND t.z = ? AND t.layer = ?`
 
 	var tileData []byte
-	err := c.db.QueryRow(query, k.X, k.Y, k.Z).Scan(&tileData)
+	err := c.db.QueryRow(query, k.X, k.Y, k.Z, k.Layer).Scan(&tileData)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, false, nil
@@ -75,17 +153,24 @@ func (c *SQLiteCache) Get(k TileCacheKey) (TileCacheValue, bool, error) {
 		return nil, false, err
 	}
 
+	c.access.touch(k, c.now())
+
 	return tileData, true, nil
 }
 
 func (c *SQLiteCache) Set(k TileCacheKey, v TileCacheValue) error {
 	c.logger.Debug("sqlite cache set", "z", k.Z, "x", k.X, "y", k.Y)
 
-	query := `INSERT INTO tile_cache (x, y, z, tile_data)
-	VALUES (?, ?, ?, ?)
-	ON CONFLICT(x, y, z) DO UPDATE SET tile_data = excluded.tile_data`
+	if c.dedup {
+		return c.setDeduplicated(k, v)
+	}
+
+	// Clearing blob_hash releases the blob of a previously deduplicated tile
+	query := `INSERT INTO tile_cache (x, y, z, layer, tile_data, accessed_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(x, y, z, layer) DO UPDATE SET tile_data = excluded.tile_data, blob_hash = NULL, created_at = CURRENT_TIMESTAMP, accessed_at = excluded.accessed_at`
 
-	_, err := c.db.Exec(query, k.X, k.Y, k.Z, v)
+	_, err := c.db.Exec(query, k.X, k.Y, k.Z, k.Layer, v, c.now().UnixMilli())
 	if err != nil {
 		c.logger.Error("sqlite cache set failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
 		return err
@@ -93,3 +178,126 @@ func (c *SQLiteCache) Set(k TileCacheKey, v TileCacheValue) error {
 
 	return nil
 }
+
+func (c *SQLiteCache) GetWithStoredAt(k TileCacheKey) (TileCacheValue, time.Time, bool, error) {
+	c.logger.Debug("sqlite cache get with stored_at", "z", k.Z, "x", k.X, "y", k.Y)
+
+	query := `SELECT COALESCE(b.data, t.tile_data), t.created_at
+	FROM tile_cache t
+	LEFT JOIN tile_blobs b ON b.hash = t.blob_hash
+	WHERE t.x = ? AND t.y = ? AND t.z = ? AND t.layer = ?`
+
+	var tileData []byte
+	var storedAt time.Time
+	err := c.db.QueryRow(query, k.X, k.Y, k.Z, k.Layer).Scan(&tileData, &storedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, time.Time{}, false, nil
+		}
+		c.logger.Error("sqlite cache get failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		return nil, time.Time{}, false, err
+	}
+
+	c.access.touch(k, c.now())
+
+	return tileData, storedAt, true, nil
+}
+
+func (c *SQLiteCache) Delete(k TileCacheKey) error {
+	c.logger.Debug("sqlite cache delete", "z", k.Z, "x", k.X, "y", k.Y)
+
+	_, err := c.db.Exec(`DELETE FROM tile_cache WHERE x = ? AND y = ? AND z = ? AND layer = ?`, k.X, k.Y, k.Z, k.Layer)
+	if err != nil {
+		c.logger.Error("sqlite cache delete failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// Purge removes the matching tiles with a single DELETE, which bounds every
+// zoom level to the tile range covering the box.
+func (c *SQLiteCache) Purge(f PurgeFilter) (int64, error) {
+	query := `DELETE FROM tile_cache WHERE z BETWEEN ? AND ?`
+	args := []any{f.MinZ, f.MaxZ}
+	if f.BBox != nil {
+		var ranges []string
+		for z := f.MinZ; z <= f.MaxZ; z++ {
+			nw, se := tilemath.TileRange(*f.BBox, z)
+			ranges = append(ranges, `(z = ? AND x BETWEEN ? AND ? AND y BETWEEN ? AND ?)`)
+			args = append(args, z, nw.X, se.X, nw.Y, se.Y)
+		}
+		query += ` AND (` + strings.Join(ranges, ` OR `) + `)`
+	}
+
+	res, err := c.db.Exec(query, args...)
+	if err != nil {
+		c.logger.Error("sqlite cache purge failed", "min_z", f.MinZ, "max_z", f.MaxZ, "error", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (c *SQLiteCache) Has(k TileCacheKey) (bool, error) {
+	var exists bool
+	err := c.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM tile_cache WHERE x = ? AND y = ? AND z = ? AND layer = ?)`, k.X, k.Y, k.Z, k.Layer).Scan(&exists)
+	if err != nil {
+		c.logger.Error("sqlite cache has failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// Iterate visits every tile with a single cursor query.
+func (c *SQLiteCache) Iterate(fn func(TileCacheKey, EntryInfo) bool) error {
+	rows, err := c.db.Query(`SELECT t.z, t.x, t.y, t.layer, LENGTH(COALESCE(b.data, t.tile_data)), t.created_at
+	FROM tile_cache t
+	LEFT JOIN tile_blobs b ON b.hash = t.blob_hash`)
+	if err != nil {
+		c.logger.Error("sqlite cache iterate failed", "error", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k TileCacheKey
+		var info EntryInfo
+		if err := rows.Scan(&k.Z, &k.X, &k.Y, &k.Layer, &info.Size, &info.StoredAt); err != nil {
+			c.logger.Error("sqlite cache iterate failed", "error", err)
+			return err
+		}
+		if !fn(k, info) {
+			return nil
+		}
+	}
+	return rows.Err()
+}
+
+// Stats aggregates per zoom level in SQL. Deduplicated tiles count with
+// their full size, like Iterate reports them.
+func (c *SQLiteCache) Stats() (Stats, error) {
+	rows, err := c.db.Query(`SELECT t.z, COUNT(*), COALESCE(SUM(LENGTH(COALESCE(b.data, t.tile_data))), 0)
+	FROM tile_cache t
+	LEFT JOIN tile_blobs b ON b.hash = t.blob_hash
+	GROUP BY t.z`)
+	if err != nil {
+		c.logger.Error("sqlite cache stats failed", "error", err)
+		return Stats{}, err
+	}
+	defer rows.Close()
+
+	s := Stats{Zooms: make(map[int]ZoomStats)}
+	for rows.Next() {
+		var z int
+		var zs ZoomStats
+		if err := rows.Scan(&z, &zs.Tiles, &zs.Bytes); err != nil {
+			c.logger.Error("sqlite cache stats failed", "error", err)
+			return Stats{}, err
+		}
+		s.Zooms[z] = zs
+		s.Tiles += zs.Tiles
+		s.Bytes += zs.Bytes
+	}
+	return s, rows.Err()
+}
@@ -0,0 +1,197 @@
+//go:build sqlite
+
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// pendingAccess is the latest access time of a tile and how often it was
+// read since the last flush.
+type pendingAccess struct {
+	at   int64
+	hits int64
+}
+
+// accessRecorder collects the latest access time and read count per tile in
+// memory so that reads never wait on a write; the batch is persisted by
+// SQLiteCache.Flush.
+type accessRecorder struct {
+	mu      sync.Mutex
+	pending map[TileCacheKey]pendingAccess
+}
+
+func newAccessRecorder() *accessRecorder {
+	return &accessRecorder{
+		pending: make(map[TileCacheKey]pendingAccess),
+	}
+}
+
+func (r *accessRecorder) touch(k TileCacheKey, at time.Time) {
+	r.mu.Lock()
+	p := r.pending[k]
+	r.pending[k] = pendingAccess{at: at.UnixMilli(), hits: p.hits + 1}
+	r.mu.Unlock()
+}
+
+// drain hands over the pending batch and starts a new one.
+func (r *accessRecorder) drain() map[TileCacheKey]pendingAccess {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pending) == 0 {
+		return nil
+	}
+	batch := r.pending
+	r.pending = make(map[TileCacheKey]pendingAccess, len(batch))
+	return batch
+}
+
+// runAccessFlusher flushes the access times every interval until ctx is
+// cancelled. A flush in progress is finished rather than abandoned, and the
+// pending batch is flushed once more before it exits.
+func (c *SQLiteCache) runAccessFlusher(ctx context.Context, interval time.Duration) {
+	defer close(c.flusherDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.flusherDone <- c.Flush()
+			return
+		case <-ticker.C:
+			if err := c.Flush(); err != nil {
+				c.logger.Error("failed to flush tile access times", "error", err)
+			}
+		}
+	}
+}
+
+// Flush writes the batched access times and read counts in a single
+// transaction.
+func (c *SQLiteCache) Flush() error {
+	batch := c.access.drain()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin access flush: %w", err)
+	}
+	defer tx.Rollback()
+
+	// MAX keeps a late flush from moving accessed_at backwards past a newer Set
+	stmt, err := tx.Prepare(`UPDATE tile_cache
+	SET accessed_at = MAX(COALESCE(accessed_at, 0), ?), hit_count = hit_count + ?
+	WHERE x = ? AND y = ? AND z = ? AND layer = ?`)
+	if err != nil {
+		return fmt.Errorf("prepare access flush: %w", err)
+	}
+	defer stmt.Close()
+
+	for k, a := range batch {
+		if _, err := stmt.Exec(a.at, a.hits, k.X, k.Y, k.Z, k.Layer); err != nil {
+			return fmt.Errorf("update accessed_at: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit access flush: %w", err)
+	}
+
+	c.logger.Debug("flushed tile access times", "count", len(batch))
+	return nil
+}
+
+// IterateAccess visits the access time and read count of every tile with a
+// single cursor query, after flushing the pending ones.
+func (c *SQLiteCache) IterateAccess(fn func(TileCacheKey, AccessInfo) bool) error {
+	if err := c.Flush(); err != nil {
+		return err
+	}
+
+	rows, err := c.db.Query(`SELECT z, x, y, layer, accessed_at, hit_count FROM tile_cache`)
+	if err != nil {
+		c.logger.Error("sqlite cache iterate access failed", "error", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k TileCacheKey
+		var accessedAt sql.NullInt64
+		var info AccessInfo
+		if err := rows.Scan(&k.Z, &k.X, &k.Y, &k.Layer, &accessedAt, &info.Hits); err != nil {
+			c.logger.Error("sqlite cache iterate access failed", "error", err)
+			return err
+		}
+		if accessedAt.Valid {
+			info.LastAccess = time.UnixMilli(accessedAt.Int64).UTC()
+		}
+		if !fn(k, info) {
+			return nil
+		}
+	}
+	return rows.Err()
+}
+
+// EvictLeastRecentlyUsed deletes up to n tiles with the oldest access time
+// and returns how many were removed. Pending access times are flushed first
+// so recently read tiles are not mistaken for cold ones.
+func (c *SQLiteCache) EvictLeastRecentlyUsed(n int) (int64, error) {
+	if n <= 0 {
+		return 0, nil
+	}
+	if err := c.Flush(); err != nil {
+		return 0, err
+	}
+
+	res, err := c.db.Exec(`DELETE FROM tile_cache
+	WHERE id IN (
+		SELECT id FROM tile_cache
+		ORDER BY COALESCE(accessed_at, 0) ASC
+		LIMIT ?
+	)`, n)
+	if err != nil {
+		return 0, fmt.Errorf("evict tiles: %w", err)
+	}
+
+	evicted, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	c.logger.Info("evicted least recently used tiles", "count", evicted)
+	return evicted, nil
+}
+
+var _ BackgroundWriter = (*SQLiteCache)(nil)
+
+// StopWriting stops the access flusher after a final flush. Reads after it
+// still record access times, which Close persists.
+func (c *SQLiteCache) StopWriting() <-chan error {
+	c.stopFlusher()
+	return c.flusherDone
+}
+
+// Close stops the access flusher, persists outstanding access times and
+// closes the database.
+func (c *SQLiteCache) Close() error {
+	// The final flush error is only reported to the first reader, which
+	// logged it already if it was StopWriting's caller
+	if err := <-c.StopWriting(); err != nil {
+		c.logger.Error("failed to flush tile access times on close", "error", err)
+	}
+
+	if err := c.Flush(); err != nil {
+		c.logger.Error("failed to flush tile access times on close", "error", err)
+	}
+	return c.db.Close()
+}
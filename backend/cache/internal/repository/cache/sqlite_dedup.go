@@ -0,0 +1,43 @@
+//go:build sqlite
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// setDeduplicated stores the tile bytes once per distinct content in
+// tile_blobs and points the coordinate at them. Many tiles, such as open
+// ocean, are byte-identical, so this saves space at the cost of a join on
+// reads. Reference counts are kept by triggers on tile_cache.
+func (c *SQLiteCache) setDeduplicated(k TileCacheKey, v TileCacheValue) error {
+	sum := sha256.Sum256(v)
+	hash := hex.EncodeToString(sum[:])
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin dedup set: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The blob starts unreferenced; the trigger counts the row pointing at it
+	_, err = tx.Exec(`INSERT INTO tile_blobs (hash, data) VALUES (?, ?)
+	ON CONFLICT(hash) DO NOTHING`, hash, []byte(v))
+	if err != nil {
+		c.logger.Error("sqlite cache set blob failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO tile_cache (x, y, z, layer, tile_data, blob_hash, accessed_at)
+	VALUES (?, ?, ?, ?, x'', ?, ?)
+	ON CONFLICT(x, y, z, layer) DO UPDATE SET tile_data = x'', blob_hash = excluded.blob_hash, created_at = CURRENT_TIMESTAMP, accessed_at = excluded.accessed_at`,
+		k.X, k.Y, k.Z, k.Layer, hash, c.now().UnixMilli())
+	if err != nil {
+		c.logger.Error("sqlite cache set failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,464 @@
+//go:build sqlite
+
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+)
+
+func newTestSQLiteCache(t *testing.T) *SQLiteCache {
+	t.Helper()
+	return newTestSQLiteCacheWithConfig(t, SQLiteConfig{})
+}
+
+func newTestSQLiteCacheWithConfig(t *testing.T, cfg SQLiteConfig) *SQLiteCache {
+	t.Helper()
+
+	l := logger.FromContext(context.Background())
+	cfg.Path = filepath.Join(t.TempDir(), "test.db")
+	cfg.AccessFlushInterval = time.Hour
+	c, err := NewSQLiteCache(cfg, l)
+	if err != nil {
+		t.Fatalf("failed to create sqlite cache: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func accessedAt(t *testing.T, c *SQLiteCache, k TileCacheKey) int64 {
+	t.Helper()
+
+	var at int64
+	err := c.db.QueryRow(`SELECT accessed_at FROM tile_cache WHERE x = ? AND y = ? AND z = ?`, k.X, k.Y, k.Z).Scan(&at)
+	if err != nil {
+		t.Fatalf("failed to read accessed_at: %v", err)
+	}
+	return at
+}
+
+func TestSQLiteCache_AccessedAtAdvancesAfterFlush(t *testing.T) {
+	c := newTestSQLiteCache(t)
+
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return t0 }
+
+	k := TileCacheKey{Z: 1, X: 1, Y: 1}
+	if err := c.Set(k, []byte("tile")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	t1 := t0.Add(time.Hour)
+	c.now = func() time.Time { return t1 }
+	if _, _, err := c.Get(k); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	if got := accessedAt(t, c, k); got != t0.UnixMilli() {
+		t.Fatalf("accessed_at should not change before flush, got %d", got)
+	}
+
+	if err := c.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if got := accessedAt(t, c, k); got != t1.UnixMilli() {
+		t.Fatalf("expected accessed_at %d after flush, got %d", t1.UnixMilli(), got)
+	}
+}
+
+func TestSQLiteCache_StopWritingFlushesPendingAccess(t *testing.T) {
+	c := newTestSQLiteCache(t)
+
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return t0 }
+	k := TileCacheKey{Z: 1, X: 1, Y: 1}
+	if err := c.Set(k, []byte("tile")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// The read is pending, the flush interval is far away
+	t1 := t0.Add(time.Hour)
+	c.now = func() time.Time { return t1 }
+	if _, _, err := c.Get(k); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	select {
+	case err := <-c.StopWriting():
+		if err != nil {
+			t.Fatalf("final flush failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("flusher did not exit")
+	}
+	if got := accessedAt(t, c, k); got != t1.UnixMilli() {
+		t.Fatalf("expected the pending access %d to be flushed, got %d", t1.UnixMilli(), got)
+	}
+	if _, ok := <-c.flusherDone; ok {
+		t.Fatal("expected the flusher to have exited")
+	}
+}
+
+func TestSQLiteCache_IterateAccessCountsHits(t *testing.T) {
+	c := newTestSQLiteCache(t)
+
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return t0 }
+
+	hot, cold := TileCacheKey{Z: 1, X: 0, Y: 0}, TileCacheKey{Z: 1, X: 1, Y: 0}
+	for _, k := range []TileCacheKey{hot, cold} {
+		if err := c.Set(k, []byte("tile")); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	t1 := t0.Add(time.Hour)
+	c.now = func() time.Time { return t1 }
+	for i := 0; i < 3; i++ {
+		if _, _, err := c.Get(hot); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+	}
+	// Hits already flushed add up with pending ones
+	if err := c.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if _, _, err := c.Get(hot); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	got := map[TileCacheKey]AccessInfo{}
+	if err := c.IterateAccess(func(k TileCacheKey, info AccessInfo) bool {
+		got[k] = info
+		return true
+	}); err != nil {
+		t.Fatalf("IterateAccess failed: %v", err)
+	}
+	if info := got[hot]; info.Hits != 4 || !info.LastAccess.Equal(t1) {
+		t.Fatalf("hot tile: %+v, want 4 hits last at %v", info, t1)
+	}
+	if info := got[cold]; info.Hits != 0 || !info.LastAccess.Equal(t0) {
+		t.Fatalf("cold tile: %+v, want no hits last at %v", info, t0)
+	}
+}
+
+func TestSQLiteCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newTestSQLiteCache(t)
+
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return t0 }
+
+	hot := TileCacheKey{Z: 2, X: 0, Y: 0}
+	cold := TileCacheKey{Z: 2, X: 1, Y: 0}
+	fresh := TileCacheKey{Z: 2, X: 2, Y: 0}
+
+	// hot is inserted first, so insertion-order eviction would pick it
+	for _, k := range []TileCacheKey{hot, cold} {
+		if err := c.Set(k, []byte("tile")); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	c.now = func() time.Time { return t0.Add(time.Minute) }
+	if err := c.Set(fresh, []byte("tile")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	c.now = func() time.Time { return t0.Add(time.Hour) }
+	if _, _, err := c.Get(hot); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	evicted, err := c.EvictLeastRecentlyUsed(1)
+	if err != nil {
+		t.Fatalf("EvictLeastRecentlyUsed failed: %v", err)
+	}
+	if evicted != 1 {
+		t.Fatalf("expected 1 evicted tile, got %d", evicted)
+	}
+
+	for k, want := range map[TileCacheKey]bool{hot: true, cold: false, fresh: true} {
+		_, exists, err := c.Get(k)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if exists != want {
+			t.Fatalf("tile %+v: exists=%v, want %v", k, exists, want)
+		}
+	}
+}
+
+func TestSQLiteCache_SizeJanitorKeepsRecentlyRead(t *testing.T) {
+	c := newTestSQLiteCache(t)
+
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return t0 }
+
+	read := TileCacheKey{Z: 4, X: 0, Y: 0}
+	unread := TileCacheKey{Z: 4, X: 1, Y: 0}
+	for _, k := range []TileCacheKey{read, unread} {
+		if err := c.Set(k, make([]byte, 100)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	// read is the older tile, but the only one read since
+	c.now = func() time.Time { return t0.Add(time.Hour) }
+	if _, _, err := c.Get(read); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	removed, _, err := newTestSizeJanitor(t, c, 150).Sweep()
+	if err != nil || removed != 1 {
+		t.Fatalf("Sweep removed %d tiles, %v; want 1", removed, err)
+	}
+	if exists, _ := c.Has(read); !exists {
+		t.Fatal("the recently read tile should be kept")
+	}
+	if exists, _ := c.Has(unread); exists {
+		t.Fatal("the unread tile should be evicted")
+	}
+}
+
+func TestSQLiteCache_ConcurrentReadsDuringFlush(t *testing.T) {
+	c := newTestSQLiteCache(t)
+
+	for i := 0; i < 20; i++ {
+		if err := c.Set(TileCacheKey{Z: 3, X: i, Y: i}, []byte("tile")); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				if _, _, err := c.Get(TileCacheKey{Z: 3, X: i % 20, Y: i % 20}); err != nil {
+					t.Errorf("Get failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if err := c.Flush(); err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+	}
+	wg.Wait()
+}
+
+func blobRefs(t *testing.T, c *SQLiteCache) map[string]int {
+	t.Helper()
+
+	rows, err := c.db.Query(`SELECT hash, refs FROM tile_blobs`)
+	if err != nil {
+		t.Fatalf("failed to read blobs: %v", err)
+	}
+	defer rows.Close()
+
+	refs := map[string]int{}
+	for rows.Next() {
+		var hash string
+		var n int
+		if err := rows.Scan(&hash, &n); err != nil {
+			t.Fatalf("failed to scan blob: %v", err)
+		}
+		refs[hash] = n
+	}
+	return refs
+}
+
+func TestSQLiteCache_DedupStoresIdenticalTilesOnce(t *testing.T) {
+	c := newTestSQLiteCacheWithConfig(t, SQLiteConfig{Dedup: true})
+
+	ocean := TileCacheValue("blank ocean tile")
+	for x := 0; x < 50; x++ {
+		if err := c.Set(TileCacheKey{X: x, Y: 1, Z: 10}, ocean); err != nil {
+			t.Fatalf("failed to set tile %d: %v", x, err)
+		}
+	}
+	if err := c.Set(TileCacheKey{X: 0, Y: 2, Z: 10}, TileCacheValue("coastline")); err != nil {
+		t.Fatalf("failed to set tile: %v", err)
+	}
+
+	refs := blobRefs(t, c)
+	if len(refs) != 2 {
+		t.Fatalf("expected 2 stored blobs, got %d", len(refs))
+	}
+	counts := []int{}
+	for _, n := range refs {
+		counts = append(counts, n)
+	}
+	if !(counts[0] == 50 && counts[1] == 1 || counts[0] == 1 && counts[1] == 50) {
+		t.Fatalf("expected reference counts 50 and 1, got %v", refs)
+	}
+
+	v, ok, err := c.Get(TileCacheKey{X: 42, Y: 1, Z: 10})
+	if err != nil || !ok || string(v) != string(ocean) {
+		t.Fatalf("expected deduplicated tile to read back, got %q ok=%v err=%v", v, ok, err)
+	}
+	_, storedAt, ok, err := c.GetWithStoredAt(TileCacheKey{X: 0, Y: 2, Z: 10})
+	if err != nil || !ok || storedAt.IsZero() {
+		t.Fatalf("expected stored_at for deduplicated tile, got %v ok=%v err=%v", storedAt, ok, err)
+	}
+}
+
+func TestSQLiteCache_DedupReleasesBlobs(t *testing.T) {
+	c := newTestSQLiteCacheWithConfig(t, SQLiteConfig{Dedup: true})
+
+	ocean := TileCacheValue("blank ocean tile")
+	for x := 0; x < 3; x++ {
+		if err := c.Set(TileCacheKey{X: x, Y: 1, Z: 10}, ocean); err != nil {
+			t.Fatalf("failed to set tile %d: %v", x, err)
+		}
+	}
+
+	// Overwriting with new content moves the reference to the new blob
+	if err := c.Set(TileCacheKey{X: 0, Y: 1, Z: 10}, TileCacheValue("island")); err != nil {
+		t.Fatalf("failed to overwrite tile: %v", err)
+	}
+	if err := c.Delete(TileCacheKey{X: 1, Y: 1, Z: 10}); err != nil {
+		t.Fatalf("failed to delete tile: %v", err)
+	}
+
+	refs := blobRefs(t, c)
+	if len(refs) != 2 {
+		t.Fatalf("expected 2 blobs, got %v", refs)
+	}
+	for _, n := range refs {
+		if n != 1 {
+			t.Fatalf("expected every blob referenced once, got %v", refs)
+		}
+	}
+
+	if _, err := c.EvictLeastRecentlyUsed(10); err != nil {
+		t.Fatalf("failed to evict: %v", err)
+	}
+	if refs := blobRefs(t, c); len(refs) != 0 {
+		t.Fatalf("expected evicting every tile to free every blob, got %v", refs)
+	}
+}
+
+func TestSQLiteCache_Has(t *testing.T) {
+	c := newTestSQLiteCacheWithConfig(t, SQLiteConfig{Dedup: true})
+	k := TileCacheKey{X: 1, Y: 2, Z: 3}
+
+	if ok, err := c.Has(k); err != nil || ok {
+		t.Fatalf("expected missing tile, got ok=%v err=%v", ok, err)
+	}
+	if err := c.Set(k, TileCacheValue("tile")); err != nil {
+		t.Fatalf("failed to set tile: %v", err)
+	}
+	if ok, err := c.Has(k); err != nil || !ok {
+		t.Fatalf("expected stored tile, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestSQLiteCache_Purge(t *testing.T) {
+	c := newTestSQLiteCacheWithConfig(t, SQLiteConfig{Dedup: true})
+
+	// x,y in 1..2 cover the box at zoom 2 and 3..4 at zoom 3
+	inside := []TileCacheKey{{Z: 2, X: 1, Y: 1}, {Z: 2, X: 2, Y: 2}, {Z: 3, X: 4, Y: 3}}
+	outside := []TileCacheKey{{Z: 2, X: 0, Y: 0}, {Z: 3, X: 5, Y: 3}, {Z: 4, X: 7, Y: 7}}
+	for _, k := range append(inside, outside...) {
+		if err := c.Set(k, TileCacheValue("tile")); err != nil {
+			t.Fatalf("Set %+v failed: %v", k, err)
+		}
+	}
+
+	bbox := tilemath.BBox{West: -10, South: -10, East: 10, North: 10}
+	removed, err := c.Purge(PurgeFilter{MinZ: 2, MaxZ: 3, BBox: &bbox})
+	if err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if removed != int64(len(inside)) {
+		t.Fatalf("removed %d tiles, want %d", removed, len(inside))
+	}
+	for _, k := range inside {
+		if exists, _ := c.Has(k); exists {
+			t.Errorf("tile %+v should be purged", k)
+		}
+	}
+	for _, k := range outside {
+		if exists, _ := c.Has(k); !exists {
+			t.Errorf("tile %+v should be kept", k)
+		}
+	}
+
+	removed, err = c.Purge(PurgeFilter{MinZ: 0, MaxZ: tilemath.MaxZoom})
+	if err != nil || removed != int64(len(outside)) {
+		t.Fatalf("purging everything removed %d tiles, %v", removed, err)
+	}
+	if refs := blobRefs(t, c); len(refs) != 0 {
+		t.Fatalf("purged tiles left blobs behind: %v", refs)
+	}
+}
+
+func TestSQLiteCache_StatsMatchListing(t *testing.T) {
+	c := newTestSQLiteCacheWithConfig(t, SQLiteConfig{Dedup: true})
+
+	// Two tiles share a blob, each still counts towards its zoom
+	for k, v := range map[TileCacheKey]string{
+		{Z: 1, X: 0, Y: 0}: "same",
+		{Z: 1, X: 1, Y: 0}: "same",
+		{Z: 2, X: 3, Y: 1}: "different",
+	} {
+		if err := c.Set(k, TileCacheValue(v)); err != nil {
+			t.Fatalf("Set %+v failed: %v", k, err)
+		}
+	}
+
+	got, err := c.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	want, err := CollectStats(c)
+	if err != nil {
+		t.Fatalf("CollectStats failed: %v", err)
+	}
+	if got.Tiles != 3 || got.Tiles != want.Tiles || got.Bytes != want.Bytes {
+		t.Fatalf("Stats = %d tiles, %d bytes, listing gives %d and %d", got.Tiles, got.Bytes, want.Tiles, want.Bytes)
+	}
+	for z, zs := range want.Zooms {
+		if got.Zooms[z] != zs {
+			t.Errorf("zoom %d = %+v, want %+v", z, got.Zooms[z], zs)
+		}
+	}
+}
+
+func TestSQLiteCache_Layers(t *testing.T) {
+	for _, dedup := range []bool{false, true} {
+		c := newTestSQLiteCacheWithConfig(t, SQLiteConfig{Dedup: dedup})
+		keys := []TileCacheKey{{X: 1, Y: 2, Z: 3}, {X: 1, Y: 2, Z: 3, Layer: "cyclosm"}}
+		for _, k := range keys {
+			if err := c.Set(k, TileCacheValue(k.String())); err != nil {
+				t.Fatalf("dedup=%v: failed to set %+v: %v", dedup, k, err)
+			}
+		}
+		for _, k := range keys {
+			data, ok, err := c.Get(k)
+			if err != nil || !ok || string(data) != k.String() {
+				t.Fatalf("dedup=%v: Get %+v = %q, %v, %v", dedup, k, data, ok, err)
+			}
+		}
+
+		if err := c.Delete(keys[1]); err != nil {
+			t.Fatalf("dedup=%v: delete failed: %v", dedup, err)
+		}
+		if ok, _ := c.Has(keys[1]); ok {
+			t.Fatalf("dedup=%v: layer's tile still cached", dedup)
+		}
+		if ok, _ := c.Has(keys[0]); !ok {
+			t.Fatalf("dedup=%v: deleting the layer's tile removed the default one", dedup)
+		}
+	}
+}
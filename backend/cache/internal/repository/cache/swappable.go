@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// SwappableCache passes everything through to a backend that can be
+// replaced at runtime, e.g. by a finished migration. It sits right above the
+// backend, so the storage format, the memory tier and the maintenance tasks
+// stacked on it follow the swap without being rebuilt.
+//
+// It offers every capability; those the current backend lacks fail with
+// errors.ErrUnsupported.
+type SwappableCache struct {
+	mu sync.RWMutex
+	tc TileCache
+}
+
+func NewSwappableCache(tc TileCache) *SwappableCache {
+	return &SwappableCache{tc: tc}
+}
+
+var _ TileCache = (*SwappableCache)(nil)
+var _ Deleter = (*SwappableCache)(nil)
+var _ Haser = (*SwappableCache)(nil)
+var _ Iterator = (*SwappableCache)(nil)
+var _ Purger = (*SwappableCache)(nil)
+var _ AccessTracker = (*SwappableCache)(nil)
+var _ StatsReporter = (*SwappableCache)(nil)
+var _ TimestampedTileCache = (*SwappableCache)(nil)
+
+// Current returns the backend everything is passed to.
+func (c *SwappableCache) Current() TileCache {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tc
+}
+
+// Swap passes everything to tc from now on and returns the backend it
+// replaced. Calls already passed on finish on the old backend.
+func (c *SwappableCache) Swap(tc TileCache) TileCache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := c.tc
+	c.tc = tc
+	return old
+}
+
+func (c *SwappableCache) Get(k TileCacheKey) (TileCacheValue, bool, error) {
+	return c.Current().Get(k)
+}
+
+func (c *SwappableCache) Set(k TileCacheKey, v TileCacheValue) error {
+	return c.Current().Set(k, v)
+}
+
+// GetWithStoredAt reports a zero store time when the current backend does
+// not record it.
+func (c *SwappableCache) GetWithStoredAt(k TileCacheKey) (TileCacheValue, time.Time, bool, error) {
+	tc := c.Current()
+	if ts, ok := tc.(TimestampedTileCache); ok {
+		return ts.GetWithStoredAt(k)
+	}
+	v, exists, err := tc.Get(k)
+	return v, time.Time{}, exists, err
+}
+
+func (c *SwappableCache) Delete(k TileCacheKey) error {
+	d, ok := c.Current().(Deleter)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return d.Delete(k)
+}
+
+// Has falls back to reading the tile when the current backend cannot check
+// for it.
+func (c *SwappableCache) Has(k TileCacheKey) (bool, error) {
+	tc := c.Current()
+	if h, ok := tc.(Haser); ok {
+		return h.Has(k)
+	}
+	_, exists, err := tc.Get(k)
+	return exists, err
+}
+
+func (c *SwappableCache) Iterate(fn func(TileCacheKey, EntryInfo) bool) error {
+	it, ok := c.Current().(Iterator)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return it.Iterate(fn)
+}
+
+func (c *SwappableCache) Purge(f PurgeFilter) (int64, error) {
+	p, ok := c.Current().(Purger)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	return p.Purge(f)
+}
+
+func (c *SwappableCache) Stats() (Stats, error) {
+	sr, ok := c.Current().(StatsReporter)
+	if !ok {
+		return Stats{}, errors.ErrUnsupported
+	}
+	return sr.Stats()
+}
+
+func (c *SwappableCache) IterateAccess(fn func(TileCacheKey, AccessInfo) bool) error {
+	at, ok := c.Current().(AccessTracker)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return at.IterateAccess(fn)
+}
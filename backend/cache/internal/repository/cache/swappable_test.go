@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func TestSwappableCache_PassesToTheCurrentBackend(t *testing.T) {
+	l := logger.FromContext(context.Background())
+	before, after := NewMapCache(l), NewMapCache(l)
+	c := NewSwappableCache(before)
+	k := TileCacheKey{Z: 3, X: 1, Y: 2}
+
+	if err := c.Set(k, []byte("old")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if old := c.Swap(after); old != TileCache(before) {
+		t.Fatalf("Swap returned %v", old)
+	}
+	if _, exists, _ := c.Get(k); exists {
+		t.Fatal("expected reads to reach the new backend")
+	}
+	if err := c.Set(k, []byte("new")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if v, _, _ := after.Get(k); string(v) != "new" {
+		t.Fatalf("expected the store in the new backend, got %q", v)
+	}
+	if v, _, _ := before.Get(k); string(v) != "old" {
+		t.Fatalf("expected the old backend left alone, got %q", v)
+	}
+}
+
+func TestSwappableCache_UnsupportedCapabilities(t *testing.T) {
+	l := logger.FromContext(context.Background())
+	c := NewSwappableCache(NewRemoteCache(RemoteConfig{BaseURL: "http://127.0.0.1:1"}, l))
+
+	if err := c.Iterate(func(TileCacheKey, EntryInfo) bool { return true }); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("Iterate: expected errors.ErrUnsupported, got %v", err)
+	}
+	if _, err := c.Stats(); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("Stats: expected errors.ErrUnsupported, got %v", err)
+	}
+}
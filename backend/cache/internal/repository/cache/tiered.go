@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/metrics"
+)
+
+// TieredCache serves tiles from a fast L1 backend, usually a bounded map,
+// in front of a persistent L2 backend. Reads missing L1 fall through to L2
+// and promote the tile into L1; writes and deletes go to both. L2 holds
+// every tile, so listing, purging and access tracking use it alone.
+//
+// L1 keeps a tile until it is evicted or deleted, it does not observe L2
+// expiry. Deletes through the cache reach both tiers; tiles removed from a
+// shared L2 by other instances are dropped from L1 with Evict.
+type TieredCache struct {
+	l1     TileCache
+	l2     TileCache
+	logger logger.Logger
+
+	// mu orders promotions after the writes that raced them: gen counts
+	// writes, and a read only promotes a tile if none happened since it
+	// started, so a stale tile read from L2 is not resurrected in L1
+	mu  sync.Mutex
+	gen uint64
+}
+
+func NewTieredCache(l1, l2 TileCache, l logger.Logger) *TieredCache {
+	return &TieredCache{l1: l1, l2: l2, logger: l}
+}
+
+var _ TileCache = (*TieredCache)(nil)
+var _ Deleter = (*TieredCache)(nil)
+var _ Haser = (*TieredCache)(nil)
+var _ Iterator = (*TieredCache)(nil)
+var _ Purger = (*TieredCache)(nil)
+var _ AccessTracker = (*TieredCache)(nil)
+var _ StatsReporter = (*TieredCache)(nil)
+
+// Get falls back to L2 when L1 fails, so a broken L1 only costs speed.
+func (c *TieredCache) Get(k TileCacheKey) (TileCacheValue, bool, error) {
+	v, exists, err := c.l1.Get(k)
+	if err != nil {
+		c.logger.Warn("tiered cache l1 get failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+	}
+	if err == nil && exists {
+		metrics.CacheTierLookups.WithLabelValues("l1", "hit").Inc()
+		return v, true, nil
+	}
+	metrics.CacheTierLookups.WithLabelValues("l1", "miss").Inc()
+
+	c.mu.Lock()
+	gen := c.gen
+	c.mu.Unlock()
+
+	v, exists, err = c.l2.Get(k)
+	if err != nil {
+		return nil, false, err
+	}
+	if !exists {
+		metrics.CacheTierLookups.WithLabelValues("l2", "miss").Inc()
+		return nil, false, nil
+	}
+	metrics.CacheTierLookups.WithLabelValues("l2", "hit").Inc()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen == gen {
+		if err := c.l1.Set(k, v); err != nil {
+			c.logger.Warn("tiered cache promotion failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		}
+	}
+	return v, true, nil
+}
+
+// Set writes through to L2 first, so a tile only reaches L1 once it is
+// stored persistently.
+func (c *TieredCache) Set(k TileCacheKey, v TileCacheValue) error {
+	if err := c.l2.Set(k, v); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	if err := c.l1.Set(k, v); err != nil {
+		c.logger.Warn("tiered cache l1 set failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+	}
+	return nil
+}
+
+// Delete removes the tile from both tiers. It fails with
+// errors.ErrUnsupported when L2 cannot delete, after dropping the tile from
+// L1 so it is at least read from L2 again.
+func (c *TieredCache) Delete(k TileCacheKey) error {
+	var err error
+	if d, ok := c.l2.(Deleter); ok {
+		err = d.Delete(k)
+	} else {
+		err = errors.ErrUnsupported
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	if d, ok := c.l1.(Deleter); ok {
+		if err := d.Delete(k); err != nil {
+			c.logger.Warn("tiered cache l1 delete failed", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		}
+	}
+	return err
+}
+
+// Has checks L2, which holds every tile, without promoting it.
+func (c *TieredCache) Has(k TileCacheKey) (bool, error) {
+	if h, ok := c.l2.(Haser); ok {
+		return h.Has(k)
+	}
+	_, exists, err := c.l2.Get(k)
+	return exists, err
+}
+
+// Iterate passes through to L2.
+func (c *TieredCache) Iterate(fn func(TileCacheKey, EntryInfo) bool) error {
+	it, ok := c.l2.(Iterator)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return it.Iterate(fn)
+}
+
+// Purge purges L2 and then drops the matching tiles from L1. The count is
+// that of L2.
+func (c *TieredCache) Purge(f PurgeFilter) (int64, error) {
+	p, ok := c.l2.(Purger)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	removed, err := p.Purge(f)
+	if err != nil {
+		return removed, err
+	}
+	return removed, c.Evict(f.Matches)
+}
+
+// Evict drops the matching tiles from L1 only, e.g. once another instance
+// removed them from a shared L2. L1 backends that cannot list or delete
+// are left alone.
+func (c *TieredCache) Evict(matches func(TileCacheKey) bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	it, canList := c.l1.(Iterator)
+	d, canDelete := c.l1.(Deleter)
+	if !canList || !canDelete {
+		return nil
+	}
+	var keys []TileCacheKey
+	if err := it.Iterate(func(k TileCacheKey, _ EntryInfo) bool {
+		if matches(k) {
+			keys = append(keys, k)
+		}
+		return true
+	}); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := d.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats passes through to L2.
+func (c *TieredCache) Stats() (Stats, error) {
+	sr, ok := c.l2.(StatsReporter)
+	if !ok {
+		return Stats{}, errors.ErrUnsupported
+	}
+	return sr.Stats()
+}
+
+// IterateAccess passes through to L2, which does not see reads served by
+// L1.
+func (c *TieredCache) IterateAccess(fn func(TileCacheKey, AccessInfo) bool) error {
+	at, ok := c.l2.(AccessTracker)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return at.IterateAccess(fn)
+}
@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newTestTieredCache(t *testing.T) (*TieredCache, *LRUMapCache, *MapCache) {
+	t.Helper()
+
+	l := logger.FromContext(context.Background())
+	l1, l2 := NewLRUMapCache(MapConfig{MaxEntries: 16}, l), NewMapCache(l)
+	return NewTieredCache(l1, l2, l), l1, l2
+}
+
+func TestTieredCache_PromotesOnRead(t *testing.T) {
+	c, l1, l2 := newTestTieredCache(t)
+	k := TileCacheKey{Z: 3, X: 1, Y: 2}
+	l2.Set(k, []byte("tile"))
+
+	l1Hits := testutil.ToFloat64(metrics.CacheTierLookups.WithLabelValues("l1", "hit"))
+	l2Hits := testutil.ToFloat64(metrics.CacheTierLookups.WithLabelValues("l2", "hit"))
+
+	for range 2 {
+		v, ok, err := c.Get(k)
+		if err != nil || !ok || string(v) != "tile" {
+			t.Fatalf("Get = %q, %v, %v", v, ok, err)
+		}
+	}
+	if ok, _ := l1.Has(k); !ok {
+		t.Fatal("expected the tile to be promoted into l1")
+	}
+	if got := testutil.ToFloat64(metrics.CacheTierLookups.WithLabelValues("l2", "hit")) - l2Hits; got != 1 {
+		t.Fatalf("expected one l2 hit, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.CacheTierLookups.WithLabelValues("l1", "hit")) - l1Hits; got != 1 {
+		t.Fatalf("expected one l1 hit, got %v", got)
+	}
+
+	if _, ok, _ := c.Get(TileCacheKey{Z: 3, X: 0, Y: 0}); ok {
+		t.Fatal("expected a miss for a tile in neither tier")
+	}
+}
+
+func TestTieredCache_WritesThroughAndDeletesBoth(t *testing.T) {
+	c, l1, l2 := newTestTieredCache(t)
+	k := TileCacheKey{Z: 3, X: 1, Y: 2}
+
+	if err := c.Set(k, []byte("tile")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	for name, tier := range map[string]Haser{"l1": l1, "l2": l2} {
+		if ok, _ := tier.Has(k); !ok {
+			t.Fatalf("expected the tile in %s", name)
+		}
+	}
+
+	if err := c.Delete(k); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	for name, tier := range map[string]Haser{"l1": l1, "l2": l2} {
+		if ok, _ := tier.Has(k); ok {
+			t.Fatalf("expected the tile deleted from %s", name)
+		}
+	}
+}
+
+func TestTieredCache_EvictDropsL1Only(t *testing.T) {
+	c, l1, l2 := newTestTieredCache(t)
+	evicted, kept := TileCacheKey{Z: 3, X: 1, Y: 2}, TileCacheKey{Z: 4, X: 1, Y: 2}
+	for _, k := range []TileCacheKey{evicted, kept} {
+		if err := c.Set(k, []byte("tile")); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	if err := c.Evict(Invalidation{Key: evicted}.Matches); err != nil {
+		t.Fatalf("Evict failed: %v", err)
+	}
+	if ok, _ := l1.Has(evicted); ok {
+		t.Fatal("expected the tile dropped from l1")
+	}
+	if ok, _ := l1.Has(kept); !ok {
+		t.Fatal("expected other tiles kept in l1")
+	}
+	if ok, _ := l2.Has(evicted); !ok {
+		t.Fatal("expected l2 left alone")
+	}
+}
+
+// blockingCache reads a tile, then holds it until release is closed, like a
+// slow backend whose answer is overtaken by a write.
+type blockingCache struct {
+	TileCache
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingCache) Get(k TileCacheKey) (TileCacheValue, bool, error) {
+	v, ok, err := c.TileCache.Get(k)
+	close(c.read)
+	<-c.release
+	return v, ok, err
+}
+
+func TestTieredCache_DoesNotPromoteOvertakenReads(t *testing.T) {
+	l := logger.FromContext(context.Background())
+	l1 := NewLRUMapCache(MapConfig{MaxEntries: 16}, l)
+	l2 := &blockingCache{TileCache: NewMapCache(l), read: make(chan struct{}), release: make(chan struct{})}
+	c := NewTieredCache(l1, l2, l)
+	k := TileCacheKey{Z: 3, X: 1, Y: 2}
+	l2.TileCache.Set(k, []byte("stale"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Get(k)
+	}()
+	<-l2.read
+	if err := c.Set(k, []byte("fresh")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	close(l2.release)
+	<-done
+
+	if v, _, _ := l1.Get(k); string(v) != "fresh" {
+		t.Fatalf("l1 holds %q, the overtaken read must not replace the newer tile", v)
+	}
+}
@@ -0,0 +1,43 @@
+package usecase
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+)
+
+var ErrNoAccessTracking = errors.New("the cache backend does not track tile access")
+
+// AccessRecord is how often and when a tile was last read, as exported for
+// analytics such as prefetch prediction.
+type AccessRecord struct {
+	Z          int       `json:"z"`
+	X          int       `json:"x"`
+	Y          int       `json:"y"`
+	LastAccess time.Time `json:"last_access"`
+	HitCount   int64     `json:"hit_count"`
+}
+
+// ExportAccess passes the access record of every tile to fn, one at a time so
+// the whole dataset is never held in memory. It stops at the first error fn
+// returns and returns it.
+func (uc *TileCacheUseCase) ExportAccess(fn func(AccessRecord) error) error {
+	tracker, ok := uc.backend().(cache.AccessTracker)
+	if !ok {
+		return ErrNoAccessTracking
+	}
+
+	var fnErr error
+	err := tracker.IterateAccess(func(k cache.TileCacheKey, info cache.AccessInfo) bool {
+		fnErr = fn(AccessRecord{Z: k.Z, X: k.X, Y: k.Y, LastAccess: info.LastAccess, HitCount: info.Hits})
+		return fnErr == nil
+	})
+	if errors.Is(err, errors.ErrUnsupported) {
+		return ErrNoAccessTracking
+	}
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
@@ -0,0 +1,195 @@
+package usecase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+// ErrUnknownAuditSink is returned by NewAuditSink for an unsupported sink.
+var ErrUnknownAuditSink = errors.New("unknown audit sink")
+
+// Audited actions.
+const (
+	AuditStore         = "store"
+	AuditStoreNotFound = "store_not_found"
+	AuditDelete        = "delete"
+	AuditPurge         = "purge"
+)
+
+// Origin describes who asked for a cache mutation and, for stores, where
+// the tile was fetched from. Empty fields are unknown.
+type Origin struct {
+	// Actor is the client address, or the component for internal mutations
+	// such as "invalidation"
+	Actor string
+	// Source is the upstream URL, ETag and LastModified the validators
+	// upstream served the tile with
+	Source       string
+	ETag         string
+	LastModified time.Time
+}
+
+func (o Origin) upstream() cache.UpstreamInfo {
+	return cache.UpstreamInfo{Source: o.Source, ETag: o.ETag, LastModified: o.LastModified}
+}
+
+// AuditRecord is one cache mutation. Failed mutations are recorded too, with
+// their error.
+type AuditRecord struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Actor  string    `json:"actor"`
+	Z      int       `json:"z"`
+	X      int       `json:"x"`
+	Y      int       `json:"y"`
+	// Layer is empty for the default layer
+	Layer string `json:"layer,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Purge and Removed describe a purge, whose record has no coordinates
+	Purge   *cache.PurgeFilter `json:"purge,omitempty"`
+	Removed int64              `json:"removed,omitempty"`
+}
+
+// AuditSink receives the audit trail.
+type AuditSink interface {
+	Audit(AuditRecord) error
+}
+
+// LogAuditSink writes audit records to the logger at Level, "debug", "info",
+// "warn" or "error", so they can be routed apart from request logs.
+type LogAuditSink struct {
+	Logger logger.Logger
+	Level  string
+}
+
+func (s LogAuditSink) Audit(r AuditRecord) error {
+	log := s.Logger.Warn
+	switch strings.ToLower(s.Level) {
+	case "debug":
+		log = s.Logger.Debug
+	case "info":
+		log = s.Logger.Info
+	case "error":
+		log = s.Logger.Error
+	}
+	kv := []any{"time", r.Time, "action", r.Action, "actor", r.Actor}
+	if r.Purge != nil {
+		kv = append(kv, "purge", *r.Purge, "removed", r.Removed)
+	} else {
+		kv = append(kv, "z", r.Z, "x", r.X, "y", r.Y)
+		if r.Layer != "" {
+			kv = append(kv, "layer", r.Layer)
+		}
+	}
+	if r.Error != "" {
+		kv = append(kv, "error", r.Error)
+	}
+	log("audit", kv...)
+	return nil
+}
+
+// FileAuditSink appends audit records to a file as NDJSON.
+type FileAuditSink struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	return &FileAuditSink{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (s *FileAuditSink) Audit(r AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(r)
+}
+
+func (s *FileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+// AuditConfig selects the audit sink: "none", "log" or "file".
+type AuditConfig struct {
+	Sink string
+	// Path is the file the "file" sink appends to
+	Path string
+	// Level is the log level of the "log" sink
+	Level string
+}
+
+// NewAuditSink builds the sink named in cfg, nil for "none".
+func NewAuditSink(cfg AuditConfig, l logger.Logger) (AuditSink, error) {
+	switch cfg.Sink {
+	case "", "none":
+		return nil, nil
+	case "log":
+		return LogAuditSink{Logger: l, Level: cfg.Level}, nil
+	case "file":
+		return NewFileAuditSink(cfg.Path)
+	default:
+		return nil, fmt.Errorf("%w %q, expected none, log or file", ErrUnknownAuditSink, cfg.Sink)
+	}
+}
+
+// AuditMutations records every store, delete and purge in sink. It must be called
+// before the use case serves requests.
+func (uc *TileCacheUseCase) AuditMutations(sink AuditSink) {
+	uc.auditSink = sink
+}
+
+// audit records a mutation of k and its outcome.
+func (uc *TileCacheUseCase) audit(action string, origin Origin, k cache.TileCacheKey, err error) {
+	if uc.auditSink == nil {
+		return
+	}
+	r := AuditRecord{
+		Time:   time.Now().UTC(),
+		Action: action,
+		Actor:  origin.Actor,
+		Z:      k.Z,
+		X:      k.X,
+		Y:      k.Y,
+		Layer:  k.Layer,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if err := uc.auditSink.Audit(r); err != nil {
+		uc.logger.Error("failed to write audit record", "action", action, "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+	}
+}
+
+// auditPurge records a purge and how many tiles it removed.
+func (uc *TileCacheUseCase) auditPurge(origin Origin, filter cache.PurgeFilter, removed int64, err error) {
+	if uc.auditSink == nil {
+		return
+	}
+	r := AuditRecord{
+		Time:    time.Now().UTC(),
+		Action:  AuditPurge,
+		Actor:   origin.Actor,
+		Purge:   &filter,
+		Removed: removed,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if err := uc.auditSink.Audit(r); err != nil {
+		uc.logger.Error("failed to write audit record", "action", AuditPurge, "error", err)
+	}
+}
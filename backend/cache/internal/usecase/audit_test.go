@@ -0,0 +1,77 @@
+package usecase
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/config"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func TestAuditMutations_RecordsStoreAndDelete(t *testing.T) {
+	l := logger.NewZapLogger(config.Logger{Level: "ERROR"})
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewAuditSink(AuditConfig{Sink: "file", Path: path}, l)
+	if err != nil {
+		t.Fatalf("failed to open audit sink: %v", err)
+	}
+	uc := NewTileCacheUseCase(cache.NewMapCache(l), l)
+	uc.AuditMutations(sink)
+
+	before := time.Now().UTC()
+	if err := uc.CacheTileFrom(10, 12, 5, []byte("png"), Origin{Actor: "192.0.2.1"}); err != nil {
+		t.Fatalf("CacheTileFrom failed: %v", err)
+	}
+	if err := uc.DeleteTile(cache.TileCacheKey{Z: 5, X: 10, Y: 12}, Origin{Actor: "invalidation"}); err != nil {
+		t.Fatalf("DeleteTile failed: %v", err)
+	}
+	if err := sink.(*FileAuditSink).Close(); err != nil {
+		t.Fatalf("failed to close audit sink: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	defer f.Close()
+	var records []AuditRecord
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var r AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, r)
+	}
+
+	want := []AuditRecord{
+		{Action: AuditStore, Actor: "192.0.2.1", Z: 5, X: 10, Y: 12},
+		{Action: AuditDelete, Actor: "invalidation", Z: 5, X: 10, Y: 12},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("expected %d audit records, got %+v", len(want), records)
+	}
+	for i, r := range records {
+		if r.Time.Before(before) || r.Time.After(time.Now().UTC()) {
+			t.Fatalf("record %d: unexpected time %v", i, r.Time)
+		}
+		r.Time = time.Time{}
+		if r != want[i] {
+			t.Fatalf("record %d: got %+v, want %+v", i, r, want[i])
+		}
+	}
+}
+
+func TestNewAuditSink_OffByDefault(t *testing.T) {
+	sink, err := NewAuditSink(AuditConfig{Sink: "none"}, nil)
+	if err != nil || sink != nil {
+		t.Fatalf("expected no sink, got %v and %v", sink, err)
+	}
+	if _, err := NewAuditSink(AuditConfig{Sink: "syslog"}, nil); err == nil {
+		t.Fatal("expected an error for an unknown sink")
+	}
+}
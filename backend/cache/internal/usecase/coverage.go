@@ -0,0 +1,88 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+)
+
+// MaxCoverageTiles bounds how many tiles a single coverage check may probe.
+const MaxCoverageTiles = 100000
+
+var (
+	ErrCoverageTooLarge = errors.New("coverage check covers too many tiles")
+	ErrInvalidZoom      = errors.New("invalid zoom level")
+)
+
+// Coverage reports how much of a region is cached. MissingTiles lists at most
+// the requested number of missing tiles; Truncated is set when there are more.
+type Coverage struct {
+	Total        int             `json:"total"`
+	Present      int             `json:"present"`
+	Missing      int             `json:"missing"`
+	MissingTiles []tilemath.Tile `json:"missing_tiles"`
+	Truncated    bool            `json:"truncated"`
+}
+
+// CheckCoverage counts which tiles covering bbox at the given zooms are
+// cached, listing up to maxListed of the missing ones.
+func (uc *TileCacheUseCase) CheckCoverage(bbox tilemath.BBox, zooms []int, maxListed int) (Coverage, error) {
+	if err := bbox.Validate(); err != nil {
+		return Coverage{}, err
+	}
+
+	total := 0
+	for _, z := range zooms {
+		if z < 0 || z > tilemath.MaxZoom {
+			return Coverage{}, fmt.Errorf("%w: %d", ErrInvalidZoom, z)
+		}
+		total += tilemath.CountInBBox(bbox, z)
+	}
+	if total > MaxCoverageTiles {
+		return Coverage{}, fmt.Errorf("%w: %d tiles, limit is %d", ErrCoverageTooLarge, total, MaxCoverageTiles)
+	}
+
+	uc.logger.Debug("checking coverage", "bbox", bbox, "zooms", zooms, "tiles", total)
+
+	coverage := Coverage{Total: total, MissingTiles: []tilemath.Tile{}}
+	var err error
+	for _, z := range zooms {
+		tilemath.TilesInBBox(bbox, z, func(t tilemath.Tile) bool {
+			var exists bool
+			exists, err = uc.has(cache.TileCacheKey{X: t.X, Y: t.Y, Z: t.Z})
+			if err != nil {
+				return false
+			}
+
+			if exists {
+				coverage.Present++
+				return true
+			}
+			coverage.Missing++
+			if len(coverage.MissingTiles) < maxListed {
+				coverage.MissingTiles = append(coverage.MissingTiles, t)
+			} else {
+				coverage.Truncated = true
+			}
+			return true
+		})
+		if err != nil {
+			uc.logger.Error("coverage check failed", "error", err)
+			return Coverage{}, err
+		}
+	}
+
+	return coverage, nil
+}
+
+// has checks for a tile without reading it when the backend allows it.
+func (uc *TileCacheUseCase) has(k cache.TileCacheKey) (bool, error) {
+	backend := uc.backend()
+	if h, ok := backend.(cache.Haser); ok {
+		return h.Has(k)
+	}
+	_, exists, err := backend.Get(k)
+	return exists, err
+}
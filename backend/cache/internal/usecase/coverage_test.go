@@ -0,0 +1,24 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/config"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+)
+
+func TestCheckCoverage_TruncatesMissingList(t *testing.T) {
+	l := logger.NewZapLogger(config.Logger{Level: "ERROR"})
+	uc := NewTileCacheUseCase(cache.NewMapCache(l), l)
+
+	bbox := tilemath.BBox{West: -10, South: -10, East: 10, North: 10}
+	coverage, err := uc.CheckCoverage(bbox, []int{1}, 2)
+	if err != nil {
+		t.Fatalf("CheckCoverage failed: %v", err)
+	}
+	if coverage.Missing != 4 || len(coverage.MissingTiles) != 2 || !coverage.Truncated {
+		t.Fatalf("unexpected coverage %+v", coverage)
+	}
+}
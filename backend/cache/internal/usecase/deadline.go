@@ -0,0 +1,88 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/metrics"
+)
+
+// ErrBackendTimeout is returned when a backend read or write does not finish
+// within the operation timeout.
+var ErrBackendTimeout = errors.New("cache backend operation timed out")
+
+// OperationTimeout bounds each backend read and write, so a slow backend
+// fails the request instead of holding it. Zero waits for the backend. It
+// must be called before the use case serves requests.
+func (uc *TileCacheUseCase) OperationTimeout(timeout time.Duration) {
+	uc.opTimeout = timeout
+}
+
+// MaxInFlightOperations bounds the backend operations running under the
+// operation timeout, counting those that timed out and still run. Zero
+// leaves them unbounded. It must be called before the use case serves
+// requests.
+func (uc *TileCacheUseCase) MaxInFlightOperations(n int) {
+	uc.opSlots = nil
+	if n > 0 {
+		uc.opSlots = make(chan struct{}, n)
+	}
+}
+
+// WaitForOperations blocks until the backend operations run under the
+// operation timeout have returned, including those that timed out, so the
+// backend is not closed under them.
+func (uc *TileCacheUseCase) WaitForOperations() {
+	uc.ops.Wait()
+}
+
+// withDeadline runs a backend operation under the operation timeout. The
+// backends take no context, so an operation that times out keeps running in
+// the background and its result is dropped. It holds an in-flight slot until
+// it returns, so once a stalled backend has taken every slot operations fail
+// without reaching it, instead of piling up behind it and landing writes
+// long after they were reported failed.
+func withDeadline[T any](uc *TileCacheUseCase, op string, fn func() (T, error)) (T, error) {
+	if uc.opTimeout <= 0 {
+		return fn()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), uc.opTimeout)
+	defer cancel()
+
+	var zero T
+	if uc.opSlots != nil {
+		select {
+		case uc.opSlots <- struct{}{}:
+		case <-ctx.Done():
+			metrics.CacheBackendTimeouts.WithLabelValues(op).Inc()
+			return zero, fmt.Errorf("%w: %s found all %d backend operations still running after %s",
+				ErrBackendTimeout, op, cap(uc.opSlots), uc.opTimeout)
+		}
+	}
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	uc.ops.Add(1)
+	go func() {
+		defer uc.ops.Done()
+		value, err := fn()
+		if uc.opSlots != nil {
+			<-uc.opSlots
+		}
+		done <- result{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		metrics.CacheBackendTimeouts.WithLabelValues(op).Inc()
+		return zero, fmt.Errorf("%w: %s took longer than %s", ErrBackendTimeout, op, uc.opTimeout)
+	}
+}
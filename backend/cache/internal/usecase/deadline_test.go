@@ -0,0 +1,98 @@
+package usecase
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/config"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+// slowCache delays every Get and Set by delay and counts the calls.
+type slowCache struct {
+	cache.TileCache
+	delay atomic.Int64
+	calls atomic.Int32
+}
+
+func newSlowCache(l logger.Logger, delay time.Duration) *slowCache {
+	c := &slowCache{TileCache: cache.NewMapCache(l)}
+	c.delay.Store(int64(delay))
+	return c
+}
+
+func (c *slowCache) Get(k cache.TileCacheKey) (cache.TileCacheValue, bool, error) {
+	c.calls.Add(1)
+	time.Sleep(time.Duration(c.delay.Load()))
+	return c.TileCache.Get(k)
+}
+
+func (c *slowCache) Set(k cache.TileCacheKey, v cache.TileCacheValue) error {
+	c.calls.Add(1)
+	time.Sleep(time.Duration(c.delay.Load()))
+	return c.TileCache.Set(k, v)
+}
+
+func TestOperationTimeout(t *testing.T) {
+	l := logger.NewZapLogger(config.Logger{Level: "ERROR"})
+	backend := newSlowCache(l, 200*time.Millisecond)
+	uc := NewTileCacheUseCase(backend, l)
+	uc.OperationTimeout(50 * time.Millisecond)
+
+	start := time.Now()
+	_, _, _, err := uc.GetCachedTile(1, 2, 3)
+	if !errors.Is(err, ErrBackendTimeout) {
+		t.Fatalf("expected ErrBackendTimeout from Get, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Fatalf("expected Get to give up after the deadline, took %s", elapsed)
+	}
+
+	if err := uc.CacheTile(1, 2, 3, []byte("tile")); !errors.Is(err, ErrBackendTimeout) {
+		t.Fatalf("expected ErrBackendTimeout from Set, got %v", err)
+	}
+	// The abandoned calls finish in the background
+	uc.WaitForOperations()
+
+	// A backend answering within the deadline is unaffected
+	backend.delay.Store(0)
+	if err := uc.CacheTile(1, 2, 3, []byte("tile")); err != nil {
+		t.Fatalf("CacheTile failed: %v", err)
+	}
+	if data, _, exists, err := uc.GetCachedTile(1, 2, 3); err != nil || !exists || string(data) != "tile" {
+		t.Fatalf("expected the stored tile, got %q exists=%v err=%v", data, exists, err)
+	}
+}
+
+func TestMaxInFlightOperations(t *testing.T) {
+	l := logger.NewZapLogger(config.Logger{Level: "ERROR"})
+	backend := newSlowCache(l, 300*time.Millisecond)
+	uc := NewTileCacheUseCase(backend, l)
+	uc.OperationTimeout(50 * time.Millisecond)
+	uc.MaxInFlightOperations(1)
+	defer uc.WaitForOperations()
+
+	if _, _, _, err := uc.GetCachedTile(1, 2, 3); !errors.Is(err, ErrBackendTimeout) {
+		t.Fatalf("expected ErrBackendTimeout from Get, got %v", err)
+	}
+	// The abandoned Get still holds the only slot, so these never reach the
+	// backend
+	for range 3 {
+		if err := uc.CacheTile(1, 2, 3, []byte("tile")); !errors.Is(err, ErrBackendTimeout) {
+			t.Fatalf("expected ErrBackendTimeout from Set, got %v", err)
+		}
+	}
+	if calls := backend.calls.Load(); calls != 1 {
+		t.Fatalf("expected the backend to see 1 call, got %d", calls)
+	}
+
+	// Once it returns the slot is free again
+	uc.WaitForOperations()
+	backend.delay.Store(0)
+	if err := uc.CacheTile(1, 2, 3, []byte("tile")); err != nil {
+		t.Fatalf("CacheTile failed: %v", err)
+	}
+}
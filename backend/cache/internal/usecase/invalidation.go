@@ -0,0 +1,47 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+)
+
+// publishTimeout bounds announcing an invalidation, which must not hold the
+// delete or purge that caused it for long.
+const publishTimeout = 5 * time.Second
+
+// InvalidationPublisher announces tiles removed from a backend shared with
+// other cache instances, so they drop the copies they keep locally.
+type InvalidationPublisher interface {
+	Publish(ctx context.Context, inv cache.Invalidation) error
+}
+
+// PublishInvalidations announces every tile deleted or purged from now on
+// through p. It must be called before the use case serves requests.
+func (uc *TileCacheUseCase) PublishInvalidations(p InvalidationPublisher) {
+	uc.publisher = p
+}
+
+// publishInvalidation announces removed tiles. The tiles are gone from the
+// shared backend either way, so a failure only leaves other instances
+// serving local copies until those expire, and is logged.
+func (uc *TileCacheUseCase) publishInvalidation(inv cache.Invalidation) {
+	if uc.publisher == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := uc.publisher.Publish(ctx, inv); err != nil {
+		uc.logger.Warn("failed to publish invalidation", "key", inv.Key.String(), "purge", inv.Purge, "error", err)
+	}
+}
+
+// ForgetStores drops what the use case remembers of invalidated tiles, so
+// the next store of one on this instance reaches the backend even when an
+// identical store was coalesced before another instance removed it.
+func (uc *TileCacheUseCase) ForgetStores(inv cache.Invalidation) {
+	if uc.coalescer != nil {
+		uc.coalescer.forget(inv.Matches)
+	}
+}
@@ -0,0 +1,302 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/metrics"
+)
+
+var (
+	ErrMigrationDisabled = errors.New("cache migration is not enabled")
+	ErrMigrationRunning  = errors.New("a cache migration is already running")
+	ErrNotIterable       = errors.New("the cache backend cannot list its tiles")
+	ErrDeleteUnsupported = errors.New("the cache backend cannot delete tiles")
+)
+
+// Migration states
+const (
+	MigrationRunning = "running"
+	MigrationDone    = "done"
+	MigrationFailed  = "failed"
+)
+
+// MigrationConfig enables copying the cache into another backend at runtime.
+type MigrationConfig struct {
+	// Backend holds the backend tiles are served from, below the storage
+	// format and the memory tier. A finished migration swaps the
+	// destination into it.
+	Backend *cache.SwappableCache
+	// Open returns the destination backend with the given name
+	Open func(name string) (cache.TileCache, error)
+	// Wrap applies the storage format to the destination, so tiles stored
+	// during the migration reach it like they reach the backend. Nil stores
+	// them as they are.
+	Wrap func(cache.TileCache) (cache.TileCache, error)
+	// Rate caps the tiles copied per second. Zero copies as fast as the
+	// backends allow.
+	Rate int
+}
+
+// MigrationStatus reports the progress of the last migration.
+type MigrationStatus struct {
+	State       string     `json:"state,omitempty"`
+	Destination string     `json:"destination,omitempty"`
+	Copied      int64      `json:"copied"`
+	Skipped     int64      `json:"skipped"`
+	Failed      int64      `json:"failed"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+type migration struct {
+	ctx  context.Context
+	cfg  MigrationConfig
+	done sync.WaitGroup
+
+	// dst receives every store while a migration runs, in the storage
+	// format, guarded by the use case's mu like the backend itself
+	dst    cache.TileCache
+	status MigrationStatus
+}
+
+// EnableMigration allows StartMigration. Migrations stop when ctx is
+// cancelled. It must be called before the use case serves requests.
+func (uc *TileCacheUseCase) EnableMigration(ctx context.Context, cfg MigrationConfig) {
+	uc.migration.ctx = ctx
+	uc.migration.cfg = cfg
+}
+
+// StartMigration copies every tile into the named backend in the background.
+// Tiles keep being served from the current backend, while new stores go to
+// both, until the copy completes and the named backend replaces it in the
+// configured SwappableCache. A migration that fails leaves the current
+// backend in place.
+func (uc *TileCacheUseCase) StartMigration(name string) error {
+	cfg := uc.migration.cfg
+	if cfg.Open == nil || cfg.Backend == nil {
+		return ErrMigrationDisabled
+	}
+
+	uc.mu.Lock()
+	if uc.migration.status.State == MigrationRunning {
+		uc.mu.Unlock()
+		return ErrMigrationRunning
+	}
+	src := cfg.Backend.Current()
+	if _, ok := src.(cache.Iterator); !ok {
+		uc.mu.Unlock()
+		return ErrNotIterable
+	}
+	dst, err := cfg.Open(name)
+	if err != nil {
+		uc.mu.Unlock()
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	stored := dst
+	if cfg.Wrap != nil {
+		if stored, err = cfg.Wrap(dst); err != nil {
+			uc.mu.Unlock()
+			return fmt.Errorf("failed to open %s: %w", name, err)
+		}
+	}
+	started := time.Now()
+	uc.migration.dst = stored
+	uc.migration.status = MigrationStatus{State: MigrationRunning, Destination: name, StartedAt: &started}
+	uc.mu.Unlock()
+
+	uc.logger.Info("cache migration started", "destination", name, "rate", cfg.Rate)
+	uc.migration.done.Add(1)
+	go func() {
+		defer uc.migration.done.Done()
+		uc.migrate(src, dst)
+	}()
+	return nil
+}
+
+// MigrationStatus returns the progress of the running or last migration.
+func (uc *TileCacheUseCase) MigrationStatus() MigrationStatus {
+	uc.mu.RLock()
+	defer uc.mu.RUnlock()
+	return uc.migration.status
+}
+
+// WaitForMigration blocks until a running migration has stopped.
+func (uc *TileCacheUseCase) WaitForMigration() {
+	uc.migration.done.Wait()
+}
+
+// migrate copies the tiles of src, the backend being replaced, into dst as
+// they are stored, storage format included.
+func (uc *TileCacheUseCase) migrate(src, dst cache.TileCache) {
+	ctx := uc.migration.ctx
+	var tick *time.Ticker
+	if uc.migration.cfg.Rate > 0 {
+		tick = time.NewTicker(time.Second / time.Duration(uc.migration.cfg.Rate))
+		defer tick.Stop()
+	}
+
+	err := src.(cache.Iterator).Iterate(func(k cache.TileCacheKey, _ cache.EntryInfo) bool {
+		if tick != nil {
+			select {
+			case <-tick.C:
+			case <-ctx.Done():
+				return false
+			}
+		} else if ctx.Err() != nil {
+			return false
+		}
+
+		result := uc.migrateTile(k, src, dst)
+		metrics.CacheMigrationTiles.WithLabelValues(result).Inc()
+
+		uc.mu.Lock()
+		switch result {
+		case "copied":
+			uc.migration.status.Copied++
+		case "skipped":
+			uc.migration.status.Skipped++
+		default:
+			uc.migration.status.Failed++
+		}
+		uc.mu.Unlock()
+		return true
+	})
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	finished := time.Now()
+	uc.migration.status.FinishedAt = &finished
+	uc.migration.dst = nil
+	if err != nil {
+		uc.migration.status.State = MigrationFailed
+		uc.migration.status.Error = err.Error()
+		uc.logger.Error("cache migration failed, keeping the current backend",
+			"destination", uc.migration.status.Destination, "error", err)
+		return
+	}
+
+	uc.migration.cfg.Backend.Swap(dst)
+	uc.backendName = uc.migration.status.Destination
+	uc.migration.status.State = MigrationDone
+	uc.logger.Info("cache migration completed, serving from the new backend",
+		"destination", uc.migration.status.Destination, "copied", uc.migration.status.Copied,
+		"skipped", uc.migration.status.Skipped, "failed", uc.migration.status.Failed)
+}
+
+// migrateTile copies a tile unless it expired meanwhile or the destination
+// already has it, which means it was stored during the migration and is at
+// least as fresh. The stored bytes are copied as they are, so an envelope
+// keeps the tile's store time and upstream metadata.
+func (uc *TileCacheUseCase) migrateTile(k cache.TileCacheKey, src, dst cache.TileCache) string {
+	if h, ok := dst.(cache.Haser); ok {
+		if exists, err := h.Has(k); err == nil && exists {
+			return "skipped"
+		}
+	}
+
+	data, exists, err := src.Get(k)
+	if err != nil {
+		uc.logger.Warn("failed to read tile for migration", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		return "failed"
+	}
+	if !exists {
+		return "skipped"
+	}
+	if err := dst.Set(k, data); err != nil {
+		uc.logger.Warn("failed to migrate tile", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		return "failed"
+	}
+	return "copied"
+}
+
+// backend returns the backend tiles are served from.
+func (uc *TileCacheUseCase) backend() cache.TileCache {
+	uc.mu.RLock()
+	defer uc.mu.RUnlock()
+	return uc.cache
+}
+
+// store writes the tile to the backend and, during a migration, to its
+// destination too so the tile is not lost when the destination takes over.
+// Where the tile came from is recorded by the backend only.
+func (uc *TileCacheUseCase) store(k cache.TileCacheKey, data []byte, up cache.UpstreamInfo) error {
+	uc.mu.RLock()
+	backend, dst := uc.cache, uc.migration.dst
+	uc.mu.RUnlock()
+
+	_, err := withDeadline(uc, "set", func() (struct{}, error) {
+		return struct{}{}, setWithUpstream(backend, k, data, up)
+	})
+	if err != nil {
+		return err
+	}
+	if dst != nil {
+		_, err := withDeadline(uc, "set", func() (struct{}, error) {
+			return struct{}{}, setWithUpstream(dst, k, data, up)
+		})
+		if err != nil {
+			uc.logger.Warn("failed to store tile in migration destination", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		}
+	}
+	return nil
+}
+
+// setWithUpstream stores the tile with where it came from on backends that
+// record it.
+func setWithUpstream(tc cache.TileCache, k cache.TileCacheKey, data []byte, up cache.UpstreamInfo) error {
+	if w, ok := tc.(cache.UpstreamTileCache); ok && up != (cache.UpstreamInfo{}) {
+		return w.SetWithUpstream(k, data, up)
+	}
+	return tc.Set(k, data)
+}
+
+// DeleteTile removes the tile from the backend and, during a migration, from
+// its destination. It fails with ErrDeleteUnsupported when the backend
+// cannot delete; a migration destination that cannot is skipped. origin is
+// recorded in the audit trail, and other instances are told to drop their
+// copies of the tile.
+func (uc *TileCacheUseCase) DeleteTile(k cache.TileCacheKey, origin Origin) error {
+	err := uc.deleteTile(k)
+	uc.audit(AuditDelete, origin, k, err)
+	if err == nil {
+		uc.publishInvalidation(cache.Invalidation{Key: k})
+	}
+	return err
+}
+
+func (uc *TileCacheUseCase) deleteTile(k cache.TileCacheKey) error {
+	// Once deleted, the tile must be written again by the next store of it
+	if uc.coalescer != nil {
+		defer uc.coalescer.forget(func(key cache.TileCacheKey) bool { return key == k })
+	}
+
+	uc.mu.RLock()
+	targets := []cache.TileCache{uc.cache, uc.migration.dst}
+	uc.mu.RUnlock()
+
+	if _, ok := targets[0].(cache.Deleter); !ok {
+		return ErrDeleteUnsupported
+	}
+	for i, target := range targets {
+		if d, ok := target.(cache.Deleter); ok {
+			err := d.Delete(k)
+			if errors.Is(err, errors.ErrUnsupported) && i == 0 {
+				return ErrDeleteUnsupported
+			}
+			if err != nil && !errors.Is(err, errors.ErrUnsupported) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/config"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func TestStartMigration_CopiesEveryTileThenSwaps(t *testing.T) {
+	l := logger.NewZapLogger(config.Logger{Level: "ERROR"})
+	src := cache.NewMapCache(l)
+	for x := 0; x < 50; x++ {
+		src.Set(cache.TileCacheKey{Z: 10, X: x, Y: 7}, []byte{byte(x)})
+	}
+	dst := cache.NewMapCache(l)
+
+	current := cache.NewSwappableCache(src)
+	uc := NewTileCacheUseCase(current, l)
+	uc.EnableMigration(context.Background(), MigrationConfig{
+		Backend: current,
+		Open: func(name string) (cache.TileCache, error) {
+			if name != "fresh" {
+				return nil, errors.New("unknown backend")
+			}
+			return dst, nil
+		},
+	})
+
+	if err := uc.StartMigration("fresh"); err != nil {
+		t.Fatalf("StartMigration failed: %v", err)
+	}
+	uc.WaitForMigration()
+
+	status := uc.MigrationStatus()
+	if status.State != MigrationDone || status.Copied != 50 || status.Failed != 0 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	for x := 0; x < 50; x++ {
+		data, exists, err := dst.Get(cache.TileCacheKey{Z: 10, X: x, Y: 7})
+		if err != nil || !exists || len(data) != 1 || data[0] != byte(x) {
+			t.Fatalf("tile %d not migrated: exists=%v err=%v", x, exists, err)
+		}
+	}
+
+	// The destination now serves and receives tiles
+	if current.Current() != cache.TileCache(dst) {
+		t.Fatal("expected the destination swapped in")
+	}
+	if err := uc.CacheTile(1, 2, 3, []byte("new")); err != nil {
+		t.Fatalf("CacheTile failed: %v", err)
+	}
+	if _, exists, _ := dst.Get(cache.TileCacheKey{X: 1, Y: 2, Z: 3}); !exists {
+		t.Fatal("expected stores to go to the new backend")
+	}
+	if _, exists, _ := src.Get(cache.TileCacheKey{X: 1, Y: 2, Z: 3}); exists {
+		t.Fatal("expected the old backend to be left alone")
+	}
+}
+
+// blockingCache holds every Set until release is closed.
+type blockingCache struct {
+	cache.TileCache
+	release chan struct{}
+}
+
+func (c *blockingCache) Set(k cache.TileCacheKey, v cache.TileCacheValue) error {
+	<-c.release
+	return c.TileCache.Set(k, v)
+}
+
+func TestStartMigration_ServesSourceUntilDone(t *testing.T) {
+	l := logger.NewZapLogger(config.Logger{Level: "ERROR"})
+	src := cache.NewMapCache(l)
+	src.Set(cache.TileCacheKey{Z: 1, X: 0, Y: 0}, []byte("old"))
+	dst := &blockingCache{TileCache: cache.NewMapCache(l), release: make(chan struct{})}
+
+	current := cache.NewSwappableCache(src)
+	uc := NewTileCacheUseCase(current, l)
+	uc.EnableMigration(context.Background(), MigrationConfig{
+		Backend: current,
+		Open:    func(string) (cache.TileCache, error) { return dst, nil },
+		Rate:    1000,
+	})
+	if err := uc.StartMigration("fresh"); err != nil {
+		t.Fatalf("StartMigration failed: %v", err)
+	}
+	if err := uc.StartMigration("fresh"); !errors.Is(err, ErrMigrationRunning) {
+		t.Fatalf("expected ErrMigrationRunning, got %v", err)
+	}
+
+	data, _, exists, err := uc.GetCachedTile(0, 0, 1)
+	if err != nil || !exists || string(data) != "old" {
+		t.Fatalf("expected the tile from the source, got %q exists=%v err=%v", data, exists, err)
+	}
+
+	close(dst.release)
+	// Stored during the migration, so it must reach the destination too
+	if err := uc.CacheTile(5, 5, 5, []byte("during")); err != nil {
+		t.Fatalf("CacheTile failed: %v", err)
+	}
+	uc.WaitForMigration()
+
+	if _, exists, _ := dst.Get(cache.TileCacheKey{X: 5, Y: 5, Z: 5}); !exists {
+		t.Fatal("expected a tile stored during the migration in the destination")
+	}
+}
+
+func TestStartMigration_Disabled(t *testing.T) {
+	l := logger.NewZapLogger(config.Logger{Level: "ERROR"})
+	uc := NewTileCacheUseCase(cache.NewMapCache(l), l)
+	if err := uc.StartMigration("redis"); !errors.Is(err, ErrMigrationDisabled) {
+		t.Fatalf("expected ErrMigrationDisabled, got %v", err)
+	}
+}
+
+func TestStartMigration_CancelledKeepsSource(t *testing.T) {
+	l := logger.NewZapLogger(config.Logger{Level: "ERROR"})
+	src := cache.NewMapCache(l)
+	for x := 0; x < 10; x++ {
+		src.Set(cache.TileCacheKey{Z: 4, X: x, Y: 0}, []byte("tile"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	current := cache.NewSwappableCache(src)
+	uc := NewTileCacheUseCase(current, l)
+	uc.EnableMigration(ctx, MigrationConfig{
+		Backend: current,
+		Open:    func(string) (cache.TileCache, error) { return cache.NewMapCache(l), nil },
+		Rate:    1,
+	})
+	if err := uc.StartMigration("fresh"); err != nil {
+		t.Fatalf("StartMigration failed: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	uc.WaitForMigration()
+
+	if status := uc.MigrationStatus(); status.State != MigrationFailed {
+		t.Fatalf("expected the migration to fail, got %+v", status)
+	}
+	if current.Current() != cache.TileCache(src) {
+		t.Fatal("expected the source to keep serving")
+	}
+}
+
+func TestStartMigration_KeepsMetadataAndTier(t *testing.T) {
+	l := logger.NewZapLogger(config.Logger{Level: "ERROR"})
+	src, dst := cache.NewMapCache(l), cache.NewMapCache(l)
+	current := cache.NewSwappableCache(src)
+	l1 := cache.NewMapCache(l)
+	tiered := cache.NewTieredCache(l1, current, l)
+	wrap := func(tc cache.TileCache) (cache.TileCache, error) {
+		return cache.NewEnvelopeCache(tc, cache.EnvelopeCodec{}), nil
+	}
+	served, _ := wrap(tiered)
+
+	uc := NewTileCacheUseCase(served, l)
+	uc.EnableMigration(context.Background(), MigrationConfig{
+		Backend: current,
+		Open:    func(string) (cache.TileCache, error) { return dst, nil },
+		Wrap:    wrap,
+	})
+
+	lastModified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	copied := cache.TileCacheKey{Z: 3, X: 1, Y: 2}
+	err := uc.CacheTileAt(copied, []byte("png"), Origin{Source: "https://tile.example.com/3/1/2.png", ETag: `"v1"`, LastModified: lastModified})
+	if err != nil {
+		t.Fatalf("CacheTileAt failed: %v", err)
+	}
+	_, before, _, _ := uc.GetCachedTileAt(copied)
+	// Let a re-stamped store time show
+	time.Sleep(10 * time.Millisecond)
+
+	if err := uc.StartMigration("fresh"); err != nil {
+		t.Fatalf("StartMigration failed: %v", err)
+	}
+	uc.WaitForMigration()
+	if status := uc.MigrationStatus(); status.State != MigrationDone || status.Copied != 1 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	// Read the destination without the tier
+	envelope, _ := wrap(dst)
+	_, after, exists, err := envelope.(cache.MetadataTileCache).GetWithMetadata(copied)
+	if err != nil || !exists {
+		t.Fatalf("tile not migrated: exists=%v err=%v", exists, err)
+	}
+	if !after.StoredAt.Equal(before.StoredAt) || after.UpstreamETag != `"v1"` || !after.LastModified.Equal(lastModified) || after.Source == "" {
+		t.Fatalf("metadata not kept: before %+v, after %+v", before, after)
+	}
+
+	// Stores after the swap reach the destination through the memory tier
+	stored := cache.TileCacheKey{Z: 4, X: 1, Y: 2}
+	if err := uc.CacheTileAt(stored, []byte("new"), Origin{}); err != nil {
+		t.Fatalf("CacheTileAt failed: %v", err)
+	}
+	for name, tc := range map[string]cache.TileCache{"memory tier": l1, "destination": dst} {
+		if _, exists, _ := tc.Get(stored); !exists {
+			t.Fatalf("expected the new tile in the %s", name)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+)
+
+// ErrPurgeUnsupported is returned when the backend can neither purge nor
+// list and delete its tiles.
+var ErrPurgeUnsupported = errors.New("the cache backend cannot purge tiles")
+
+// PurgeTiles removes every tile matching the filter from the backend and,
+// during a migration, from its destination, and returns how many the
+// backend removed. Backends without a purge of their own are listed and
+// purged tile by tile. origin is recorded in the audit trail, and other
+// instances are told to drop their copies of the tiles.
+func (uc *TileCacheUseCase) PurgeTiles(filter cache.PurgeFilter, origin Origin) (int64, error) {
+	if filter.MinZ < 0 || filter.MaxZ > tilemath.MaxZoom || filter.MinZ > filter.MaxZ {
+		return 0, fmt.Errorf("%w: %d-%d", ErrInvalidZoom, filter.MinZ, filter.MaxZ)
+	}
+	if filter.BBox != nil {
+		if err := filter.BBox.Validate(); err != nil {
+			return 0, err
+		}
+	}
+
+	// Once purged, tiles must be written again by the next store of them
+	if uc.coalescer != nil {
+		defer uc.coalescer.forget(filter.Matches)
+	}
+
+	uc.mu.RLock()
+	backend, dst := uc.cache, uc.migration.dst
+	uc.mu.RUnlock()
+
+	uc.logger.Info("purging tiles", "min_z", filter.MinZ, "max_z", filter.MaxZ, "bbox", filter.BBox, "actor", origin.Actor)
+
+	removed, err := purge(backend, filter)
+	// A failed purge may still have removed some tiles
+	uc.publishInvalidation(cache.Invalidation{Purge: &filter})
+	uc.auditPurge(origin, filter, removed, err)
+	if err != nil {
+		uc.logger.Error("failed to purge tiles", "removed", removed, "error", err)
+		return removed, err
+	}
+	if dst != nil {
+		if _, err := purge(dst, filter); err != nil && !errors.Is(err, ErrPurgeUnsupported) {
+			uc.logger.Warn("failed to purge tiles from migration destination", "error", err)
+		}
+	}
+
+	uc.logger.Info("purged tiles", "removed", removed)
+	return removed, nil
+}
+
+// purge removes the matching tiles from c, falling back to listing and
+// deleting them when c has no purge of its own.
+func purge(c cache.TileCache, filter cache.PurgeFilter) (int64, error) {
+	if p, ok := c.(cache.Purger); ok {
+		removed, err := p.Purge(filter)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return removed, err
+		}
+	}
+
+	it, canList := c.(cache.Iterator)
+	d, canDelete := c.(cache.Deleter)
+	if !canList || !canDelete {
+		return 0, ErrPurgeUnsupported
+	}
+
+	var keys []cache.TileCacheKey
+	err := it.Iterate(func(k cache.TileCacheKey, _ cache.EntryInfo) bool {
+		if filter.Matches(k) {
+			keys = append(keys, k)
+		}
+		return true
+	})
+	if errors.Is(err, errors.ErrUnsupported) {
+		return 0, ErrPurgeUnsupported
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int64
+	for _, k := range keys {
+		err := d.Delete(k)
+		if errors.Is(err, errors.ErrUnsupported) {
+			return removed, ErrPurgeUnsupported
+		}
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,45 @@
+package usecase
+
+import (
+	"errors"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+)
+
+// ErrStatsUnsupported is returned when the backend can neither summarise nor
+// list its tiles.
+var ErrStatsUnsupported = errors.New("the cache backend cannot report statistics")
+
+// BackendName records the name of the backend for Stats, e.g. "sqlite". A
+// completed migration replaces it with the destination's. It must be called
+// before the use case serves requests.
+func (uc *TileCacheUseCase) BackendName(name string) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	uc.backendName = name
+}
+
+// Stats summarises the tiles held by the backend serving requests, and
+// returns its name. Backends without a summary of their own are listed tile
+// by tile.
+func (uc *TileCacheUseCase) Stats() (string, cache.Stats, error) {
+	uc.mu.RLock()
+	backend, name := uc.cache, uc.backendName
+	uc.mu.RUnlock()
+
+	if sr, ok := backend.(cache.StatsReporter); ok {
+		s, err := sr.Stats()
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return name, s, err
+		}
+	}
+	it, ok := backend.(cache.Iterator)
+	if !ok {
+		return name, cache.Stats{}, ErrStatsUnsupported
+	}
+	s, err := cache.CollectStats(it)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return name, cache.Stats{}, ErrStatsUnsupported
+	}
+	return name, s, err
+}
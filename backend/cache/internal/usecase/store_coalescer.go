@@ -0,0 +1,97 @@
+package usecase
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+)
+
+// storeCoalescer collapses identical stores of a tile into one backend
+// write. A store is identical when it carries the same bytes for the same
+// key; it joins one in flight, or one finished within the window. Deleting
+// or purging a tile forgets its stores, so storing it again writes it.
+type storeCoalescer struct {
+	mu        sync.Mutex
+	window    time.Duration
+	now       func() time.Time
+	stores    map[cache.TileCacheKey]*coalescedStore
+	lastSweep time.Time
+}
+
+type coalescedStore struct {
+	// sum identifies the bytes stored, a collision would drop a write
+	sum      [sha256.Size]byte
+	done     chan struct{}
+	err      error
+	finished time.Time
+}
+
+func newStoreCoalescer(window time.Duration) *storeCoalescer {
+	return &storeCoalescer{
+		window: window,
+		now:    time.Now,
+		stores: make(map[cache.TileCacheKey]*coalescedStore),
+	}
+}
+
+// do runs store unless an identical store of k is in flight or finished
+// within the window, in which case it shares that store's result. It
+// reports whether store ran.
+func (c *storeCoalescer) do(k cache.TileCacheKey, data []byte, store func() error) (bool, error) {
+	sum := sha256.Sum256(data)
+
+	c.mu.Lock()
+	now := c.now()
+	if s, ok := c.stores[k]; ok && s.sum == sum && (s.finished.IsZero() || now.Sub(s.finished) <= c.window) {
+		c.mu.Unlock()
+		<-s.done
+		return false, s.err
+	}
+	c.sweep(now)
+	s := &coalescedStore{sum: sum, done: make(chan struct{})}
+	c.stores[k] = s
+	c.mu.Unlock()
+
+	err := store()
+
+	c.mu.Lock()
+	s.err = err
+	s.finished = c.now()
+	// Failed stores are not shared with later callers, they may retry
+	if (c.window <= 0 || err != nil) && c.stores[k] == s {
+		delete(c.stores, k)
+	}
+	c.mu.Unlock()
+	close(s.done)
+
+	return true, err
+}
+
+// forget drops the stores of tiles matching the filter, so the next store
+// of one reaches the backend even when it carries the same bytes. A store
+// in flight still finishes, its result is just not shared any more.
+func (c *storeCoalescer) forget(matches func(cache.TileCacheKey) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.stores {
+		if matches(key) {
+			delete(c.stores, key)
+		}
+	}
+}
+
+// sweep forgets finished stores past the window, at most once per window.
+// It must be called with mu held.
+func (c *storeCoalescer) sweep(now time.Time) {
+	if c.window <= 0 || now.Sub(c.lastSweep) < c.window {
+		return
+	}
+	c.lastSweep = now
+	for key, s := range c.stores {
+		if !s.finished.IsZero() && now.Sub(s.finished) > c.window {
+			delete(c.stores, key)
+		}
+	}
+}
@@ -1,13 +1,40 @@
 package usecase
 
 import (
+	"context"
+	"sync"
+	"time"
+
 	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
 	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/metrics"
 )
 
 type TileCacheUseCase struct {
-	cache  cache.TileCache
-	logger logger.Logger
+	// mu guards the backend's name, which a finished migration replaces,
+	// and the migration's state
+	mu          sync.RWMutex
+	cache       cache.TileCache
+	backendName string
+	coalescer   *storeCoalescer
+	migration   migration
+	// validators check tiles before CacheTile stores them
+	validators StoreValidatorChain
+	// notFoundTTL expires entries recording missing tiles on backends
+	// without TTLs of their own
+	notFoundTTL time.Duration
+	// opTimeout bounds each backend read and write, zero waits
+	opTimeout time.Duration
+	// opSlots bounds the backend operations running under opTimeout, nil
+	// leaves them unbounded; ops tracks them, including abandoned ones
+	opSlots chan struct{}
+	ops     sync.WaitGroup
+	// auditSink records stores and deletes, nil disables auditing
+	auditSink AuditSink
+	// publisher announces deletes and purges to other instances, nil
+	// announces none
+	publisher InvalidationPublisher
+	logger    logger.Logger
 }
 
 func NewTileCacheUseCase(cache cache.TileCache, l logger.Logger) *TileCacheUseCase {
@@ -18,31 +45,219 @@ func NewTileCacheUseCase(cache cache.TileCache, l logger.Logger) *TileCacheUseCa
 }
 
 func (uc *TileCacheUseCase) CacheTile(x, y, z int, data []byte) error {
-	uc.logger.Debug("caching tile", "z", z, "x", x, "y", y, "size", len(data))
-	key := cache.TileCacheKey{
-		X: x,
-		Y: y,
-		Z: z,
+	return uc.CacheTileFrom(x, y, z, data, Origin{})
+}
+
+// CacheTileFrom is CacheTile recording who stored the tile in the audit
+// trail and, on backends that keep metadata, the upstream URL and validators
+// it was fetched with.
+func (uc *TileCacheUseCase) CacheTileFrom(x, y, z int, data []byte, origin Origin) error {
+	return uc.CacheTileAt(cache.TileCacheKey{X: x, Y: y, Z: z}, data, origin)
+}
+
+// CacheTileAt is CacheTileFrom for a tile of any layer.
+func (uc *TileCacheUseCase) CacheTileAt(key cache.TileCacheKey, data []byte, origin Origin) error {
+	err := uc.cacheTile(key, data, origin.upstream())
+	uc.audit(AuditStore, origin, key, err)
+	return err
+}
+
+func (uc *TileCacheUseCase) cacheTile(key cache.TileCacheKey, data []byte, up cache.UpstreamInfo) error {
+	z, x, y := key.Z, key.X, key.Y
+	uc.logger.Debug("caching tile", "z", z, "x", x, "y", y, "size", len(data), "source", up.Source)
+	if err := uc.validate(key, data); err != nil {
+		return err
+	}
+
+	var err error
+	if uc.coalescer != nil {
+		var stored bool
+		stored, err = uc.coalescer.do(key, data, func() error { return uc.store(key, data, up) })
+		if !stored {
+			uc.logger.Debug("coalesced identical tile store", "z", z, "x", x, "y", y)
+			metrics.CacheStoresCoalesced.Inc()
+			return err
+		}
+	} else {
+		err = uc.store(key, data, up)
 	}
-	if err := uc.cache.Set(key, data); err != nil {
+	if err != nil {
 		uc.logger.Error("failed to cache tile", "z", z, "x", x, "y", y, "error", err)
 		return err
 	}
 	return nil
 }
 
-func (uc *TileCacheUseCase) GetCachedTile(x, y, z int) ([]byte, bool, error) {
-	uc.logger.Debug("cache lookup", "z", z, "x", x, "y", y)
-	key := cache.TileCacheKey{
-		X: x,
-		Y: y,
-		Z: z,
+// CoalesceStores collapses identical concurrent stores of a tile into one
+// backend write, e.g. when several tiles instances store the same tile at
+// once. Identical stores arriving up to window after a write finished are
+// collapsed too. It must be called before the use case serves requests.
+func (uc *TileCacheUseCase) CoalesceStores(window time.Duration) {
+	uc.coalescer = newStoreCoalescer(window)
+}
+
+// NotFoundTTL sets how long a tile recorded as missing upstream stays
+// recorded, based on the store time the record carries, or the backend's
+// for records written before they carried one. It must be called before the
+// use case serves requests.
+func (uc *TileCacheUseCase) NotFoundTTL(ttl time.Duration) {
+	uc.notFoundTTL = ttl
+}
+
+// CacheNotFound records that the tile does not exist upstream.
+func (uc *TileCacheUseCase) CacheNotFound(x, y, z int) error {
+	return uc.CacheNotFoundFrom(x, y, z, Origin{})
+}
+
+// CacheNotFoundFrom is CacheNotFound recording who reported the tile missing
+// in the audit trail.
+func (uc *TileCacheUseCase) CacheNotFoundFrom(x, y, z int, origin Origin) error {
+	return uc.CacheNotFoundAt(cache.TileCacheKey{X: x, Y: y, Z: z}, origin)
+}
+
+// CacheNotFoundAt is CacheNotFoundFrom for a tile of any layer.
+func (uc *TileCacheUseCase) CacheNotFoundAt(key cache.TileCacheKey, origin Origin) error {
+	uc.logger.Debug("caching missing tile", "z", key.Z, "x", key.X, "y", key.Y, "layer", key.Layer)
+	// The marker replaces the tile like a delete does, so the next store of
+	// the tile must be written even when it carries the same bytes as before
+	if uc.coalescer != nil {
+		defer uc.coalescer.forget(func(k cache.TileCacheKey) bool { return k == key })
+	}
+	err := uc.store(key, cache.NewNotFoundMarker(time.Now()), cache.UpstreamInfo{})
+	uc.audit(AuditStoreNotFound, origin, key, err)
+	if err != nil {
+		uc.logger.Error("failed to cache missing tile", "z", key.Z, "x", key.X, "y", key.Y, "layer", key.Layer, "error", err)
+		return err
 	}
+	return nil
+}
 
-	data, exists, err := uc.cache.Get(key)
+// notFound reports whether data records a missing tile that has not expired.
+// Expired entries are reported as plain misses through exists.
+func (uc *TileCacheUseCase) notFound(data []byte, storedAt time.Time) (notFound, exists bool) {
+	if !cache.IsNotFound(data) {
+		return false, true
+	}
+	if recorded, ok := cache.NotFoundStoredAt(data); ok {
+		storedAt = recorded
+	}
+	if uc.notFoundTTL > 0 && !storedAt.IsZero() && time.Since(storedAt) > uc.notFoundTTL {
+		return false, false
+	}
+	return true, false
+}
+
+// GetCachedTile returns the cached tile and, when the backend records it, the
+// time it was stored (zero otherwise). Tiles recorded as missing upstream
+// are reported as not existing.
+func (uc *TileCacheUseCase) GetCachedTile(x, y, z int) ([]byte, time.Time, bool, error) {
+	data, storedAt, exists, err := uc.lookup(cache.TileCacheKey{X: x, Y: y, Z: z})
+	if err != nil || !exists {
+		return nil, time.Time{}, false, err
+	}
+	if _, exists := uc.notFound(data, storedAt); !exists {
+		return nil, time.Time{}, false, nil
+	}
+	return data, storedAt, true, nil
+}
+
+// GetCachedTileWithMetadata is GetCachedTile with the tile's metadata. The
+// ETag is the one recorded when the tile was stored if the backend keeps
+// metadata, and is computed from the content otherwise. Tiles recorded as
+// missing upstream are reported as not existing, with NotFound set.
+func (uc *TileCacheUseCase) GetCachedTileWithMetadata(x, y, z int) ([]byte, cache.TileMetadata, bool, error) {
+	return uc.GetCachedTileAt(cache.TileCacheKey{X: x, Y: y, Z: z})
+}
+
+// GetCachedTileAt is GetCachedTileWithMetadata for a tile of any layer.
+func (uc *TileCacheUseCase) GetCachedTileAt(key cache.TileCacheKey) ([]byte, cache.TileMetadata, bool, error) {
+	z, x, y := key.Z, key.X, key.Y
+	mc, ok := uc.backend().(cache.MetadataTileCache)
+	if !ok {
+		data, storedAt, exists, err := uc.lookup(key)
+		if err != nil || !exists {
+			return nil, cache.TileMetadata{}, false, err
+		}
+		if notFound, exists := uc.notFound(data, storedAt); !exists {
+			return nil, cache.TileMetadata{NotFound: notFound, StoredAt: storedAt}, false, nil
+		}
+		return data, cache.TileMetadata{ETag: cache.ContentETag(data), StoredAt: storedAt}, true, nil
+	}
+
+	uc.logger.Debug("cache lookup", "z", z, "x", x, "y", y, "layer", key.Layer)
+
+	type result struct {
+		data   cache.TileCacheValue
+		meta   cache.TileMetadata
+		exists bool
+	}
+	r, err := withDeadline(uc, "get", func() (result, error) {
+		data, meta, exists, err := mc.GetWithMetadata(key)
+		return result{data, meta, exists}, err
+	})
+	data, meta, exists := r.data, r.meta, r.exists
 	if err != nil {
 		uc.logger.Error("cache lookup failed", "z", z, "x", x, "y", y, "error", err)
-		return nil, false, err
+		return nil, cache.TileMetadata{}, false, err
+	}
+	if !exists {
+		return nil, cache.TileMetadata{}, false, nil
+	}
+	if notFound, exists := uc.notFound(data, meta.StoredAt); !exists {
+		return nil, cache.TileMetadata{NotFound: notFound, StoredAt: meta.StoredAt}, false, nil
+	}
+	// Stored before metadata was recorded
+	if meta.ETag == "" {
+		meta.ETag = cache.ContentETag(data)
+	}
+	return data, meta, true, nil
+}
+
+// lookup reads the stored value and, when the backend records it, the time
+// it was stored.
+func (uc *TileCacheUseCase) lookup(key cache.TileCacheKey) ([]byte, time.Time, bool, error) {
+	z, x, y := key.Z, key.X, key.Y
+	uc.logger.Debug("cache lookup", "z", z, "x", x, "y", y, "layer", key.Layer)
+
+	type result struct {
+		data     cache.TileCacheValue
+		storedAt time.Time
+		exists   bool
+	}
+	backend := uc.backend()
+	r, err := withDeadline(uc, "get", func() (result, error) {
+		var r result
+		var err error
+		if tc, ok := backend.(cache.TimestampedTileCache); ok {
+			r.data, r.storedAt, r.exists, err = tc.GetWithStoredAt(key)
+		} else {
+			r.data, r.exists, err = backend.Get(key)
+		}
+		return r, err
+	})
+	data, storedAt, exists := r.data, r.storedAt, r.exists
+	if err != nil {
+		uc.logger.Error("cache lookup failed", "z", z, "x", x, "y", y, "error", err)
+		return nil, time.Time{}, false, err
+	}
+
+	return data, storedAt, exists, nil
+}
+
+// CheckBackend reports whether the cache backend answers a lookup. A backend
+// that does not answer before ctx is done is reported as failing, though the
+// lookup itself cannot be cancelled.
+func (uc *TileCacheUseCase) CheckBackend(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := uc.has(cache.TileCacheKey{})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return data, exists, nil
 }
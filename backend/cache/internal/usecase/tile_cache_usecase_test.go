@@ -0,0 +1,162 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/config"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+// countingCache counts Set calls, holding each until release is closed.
+type countingCache struct {
+	cache.TileCache
+	sets    atomic.Int64
+	release chan struct{}
+}
+
+func (c *countingCache) Set(k cache.TileCacheKey, v cache.TileCacheValue) error {
+	c.sets.Add(1)
+	<-c.release
+	return c.TileCache.Set(k, v)
+}
+
+func TestCacheTile_CoalescesIdenticalStores(t *testing.T) {
+	l := logger.NewZapLogger(config.Logger{Level: "ERROR"})
+	backend := &countingCache{TileCache: cache.NewMapCache(l), release: make(chan struct{})}
+	uc := NewTileCacheUseCase(backend, l)
+	uc.CoalesceStores(time.Minute)
+
+	const stores = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, stores)
+	for i := 0; i < stores; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- uc.CacheTile(10, 12, 5, []byte("png"))
+		}()
+	}
+	close(backend.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("CacheTile failed: %v", err)
+		}
+	}
+	if got := backend.sets.Load(); got != 1 {
+		t.Fatalf("expected 1 backend Set, got %d", got)
+	}
+
+	// Different bytes for the same tile are a new store
+	if err := uc.CacheTile(10, 12, 5, []byte("newer png")); err != nil {
+		t.Fatalf("CacheTile failed: %v", err)
+	}
+	if got := backend.sets.Load(); got != 2 {
+		t.Fatalf("expected a store with new data to reach the backend, got %d Sets", got)
+	}
+}
+
+// recordingPublisher records the invalidations published.
+type recordingPublisher struct {
+	published []cache.Invalidation
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, inv cache.Invalidation) error {
+	p.published = append(p.published, inv)
+	return nil
+}
+
+func TestDeleteAndPurge_PublishInvalidations(t *testing.T) {
+	l := logger.NewZapLogger(config.Logger{Level: "ERROR"})
+	uc := NewTileCacheUseCase(cache.NewMapCache(l), l)
+	publisher := &recordingPublisher{}
+	uc.PublishInvalidations(publisher)
+
+	k := cache.TileCacheKey{X: 10, Y: 12, Z: 5, Layer: "cyclosm"}
+	if err := uc.DeleteTile(k, Origin{}); err != nil {
+		t.Fatalf("DeleteTile failed: %v", err)
+	}
+	filter := cache.PurgeFilter{MinZ: 3, MaxZ: 7}
+	if _, err := uc.PurgeTiles(filter, Origin{}); err != nil {
+		t.Fatalf("PurgeTiles failed: %v", err)
+	}
+
+	if len(publisher.published) != 2 {
+		t.Fatalf("expected 2 invalidations, got %+v", publisher.published)
+	}
+	if got := publisher.published[0]; got.Key != k || got.Purge != nil {
+		t.Fatalf("delete published %+v", got)
+	}
+	if got := publisher.published[1]; got.Purge == nil || *got.Purge != filter {
+		t.Fatalf("purge published %+v", got)
+	}
+}
+
+func TestCacheTile_StoresAgainAfterDeletePurgeAndNotFound(t *testing.T) {
+	l := logger.NewZapLogger(config.Logger{Level: "ERROR"})
+	uc := NewTileCacheUseCase(cache.NewMapCache(l), l)
+	uc.CoalesceStores(time.Minute)
+
+	removals := map[string]func() error{
+		"delete": func() error { return uc.DeleteTile(cache.TileCacheKey{X: 10, Y: 12, Z: 5}, Origin{}) },
+		"purge": func() error {
+			_, err := uc.PurgeTiles(cache.PurgeFilter{MinZ: 5, MaxZ: 5}, Origin{})
+			return err
+		},
+		"not found": func() error { return uc.CacheNotFound(10, 12, 5) },
+	}
+	for name, remove := range removals {
+		if err := uc.CacheTile(10, 12, 5, []byte("png")); err != nil {
+			t.Fatalf("%s: CacheTile failed: %v", name, err)
+		}
+		if err := remove(); err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		// The same bytes within the window must be written again
+		if err := uc.CacheTile(10, 12, 5, []byte("png")); err != nil {
+			t.Fatalf("%s: CacheTile failed: %v", name, err)
+		}
+		if _, _, exists, err := uc.GetCachedTile(10, 12, 5); err != nil || !exists {
+			t.Fatalf("%s: expected the tile stored again, exists=%v err=%v", name, exists, err)
+		}
+	}
+}
+
+func TestCacheNotFound_ExpiresOnRawFilesystem(t *testing.T) {
+	l := logger.NewZapLogger(config.Logger{Level: "ERROR"})
+	fs := cache.NewFilesystemCache(cache.FilesystemConfig{Root: t.TempDir()}, l)
+	uc := NewTileCacheUseCase(fs, l)
+	uc.NotFoundTTL(time.Hour)
+
+	fresh := cache.TileCacheKey{X: 1, Y: 2, Z: 3}
+	if err := uc.CacheNotFoundAt(fresh, Origin{}); err != nil {
+		t.Fatalf("CacheNotFoundAt failed: %v", err)
+	}
+	if _, meta, exists, err := uc.GetCachedTileAt(fresh); err != nil || exists || !meta.NotFound {
+		t.Fatalf("expected a fresh negative entry, got meta=%+v exists=%v err=%v", meta, exists, err)
+	}
+
+	// The filesystem records no store time, the marker carries it
+	stale := cache.TileCacheKey{X: 2, Y: 2, Z: 3}
+	if err := fs.Set(stale, cache.NewNotFoundMarker(time.Now().Add(-2*time.Hour))); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, meta, exists, err := uc.GetCachedTileAt(stale); err != nil || exists || meta.NotFound {
+		t.Fatalf("expected the negative entry expired, got meta=%+v exists=%v err=%v", meta, exists, err)
+	}
+
+	// A tile found upstream since is stored over the expired entry
+	if err := uc.CacheTileAt(stale, []byte("png"), Origin{}); err != nil {
+		t.Fatalf("CacheTileAt failed: %v", err)
+	}
+	if data, _, exists, err := uc.GetCachedTileAt(stale); err != nil || !exists || string(data) != "png" {
+		t.Fatalf("expected the tile, got %q exists=%v err=%v", data, exists, err)
+	}
+}
@@ -0,0 +1,114 @@
+package usecase
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"strings"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/metrics"
+)
+
+var (
+	// ErrTileRejected is returned by CacheTile for tiles a store validator
+	// refuses; nothing is written for them.
+	ErrTileRejected          = errors.New("tile rejected")
+	ErrUnknownStoreValidator = errors.New("unknown store validator")
+)
+
+// StoreValidator checks a tile before it is stored, e.g. to keep "no data"
+// placeholders or truncated downloads out of the cache. A non-nil error
+// rejects the tile.
+type StoreValidator interface {
+	Validate(k cache.TileCacheKey, data []byte) error
+}
+
+// StoreValidatorFunc adapts a function to StoreValidator.
+type StoreValidatorFunc func(k cache.TileCacheKey, data []byte) error
+
+func (f StoreValidatorFunc) Validate(k cache.TileCacheKey, data []byte) error {
+	return f(k, data)
+}
+
+// StoreValidatorChain runs validators in order, stopping at the first that
+// rejects the tile.
+type StoreValidatorChain []StoreValidator
+
+func (c StoreValidatorChain) Validate(k cache.TileCacheKey, data []byte) error {
+	for _, v := range c {
+		if err := v.Validate(k, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PNGValidator rejects tiles that are not a decodable PNG header. It only
+// reads the header, so corruption further in goes unnoticed.
+type PNGValidator struct{}
+
+func (PNGValidator) Validate(_ cache.TileCacheKey, data []byte) error {
+	if _, err := png.DecodeConfig(bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("not a valid png: %w", err)
+	}
+	return nil
+}
+
+// SizeRangeValidator rejects tiles smaller than Min or larger than Max bytes.
+// Zero leaves that bound open.
+type SizeRangeValidator struct {
+	Min int
+	Max int
+}
+
+func (v SizeRangeValidator) Validate(_ cache.TileCacheKey, data []byte) error {
+	if v.Min > 0 && len(data) < v.Min {
+		return fmt.Errorf("size %d is below the minimum of %d bytes", len(data), v.Min)
+	}
+	if v.Max > 0 && len(data) > v.Max {
+		return fmt.Errorf("size %d is above the maximum of %d bytes", len(data), v.Max)
+	}
+	return nil
+}
+
+// StoreValidatorConfig selects the built-in validators, by name in the
+// order they run: "png" and "size".
+type StoreValidatorConfig struct {
+	Names   []string
+	MinSize int
+	MaxSize int
+}
+
+// NewStoreValidators builds the chain of built-in validators named in cfg.
+func NewStoreValidators(cfg StoreValidatorConfig) (StoreValidatorChain, error) {
+	var chain StoreValidatorChain
+	for _, name := range cfg.Names {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "png":
+			chain = append(chain, PNGValidator{})
+		case "size":
+			chain = append(chain, SizeRangeValidator{Min: cfg.MinSize, Max: cfg.MaxSize})
+		default:
+			return nil, fmt.Errorf("%w %q, expected png or size", ErrUnknownStoreValidator, name)
+		}
+	}
+	return chain, nil
+}
+
+// ValidateStores makes CacheTile run validators before writing a tile. It
+// must be called before the use case serves requests.
+func (uc *TileCacheUseCase) ValidateStores(validators ...StoreValidator) {
+	uc.validators = append(uc.validators, validators...)
+}
+
+func (uc *TileCacheUseCase) validate(k cache.TileCacheKey, data []byte) error {
+	if err := uc.validators.Validate(k, data); err != nil {
+		metrics.CacheStoresRejected.Inc()
+		uc.logger.Warn("tile rejected by store validator", "z", k.Z, "x", k.X, "y", k.Y, "error", err)
+		return fmt.Errorf("%w: %v", ErrTileRejected, err)
+	}
+	return nil
+}
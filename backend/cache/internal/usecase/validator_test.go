@@ -0,0 +1,57 @@
+package usecase
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/cache/internal/repository/cache"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/config"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/logger"
+)
+
+func TestCacheTile_StoreValidatorRejects(t *testing.T) {
+	l := logger.NewZapLogger(config.Logger{Level: "ERROR"})
+	backend := cache.NewMapCache(l)
+	uc := NewTileCacheUseCase(backend, l)
+
+	noData := []byte("NO DATA")
+	uc.ValidateStores(StoreValidatorFunc(func(_ cache.TileCacheKey, data []byte) error {
+		if bytes.Contains(data, noData) {
+			return errors.New("no data placeholder")
+		}
+		return nil
+	}))
+
+	if err := uc.CacheTile(1, 2, 3, []byte("tile with NO DATA inside")); !errors.Is(err, ErrTileRejected) {
+		t.Fatalf("expected ErrTileRejected, got %v", err)
+	}
+	if _, _, exists, _ := uc.GetCachedTile(1, 2, 3); exists {
+		t.Fatal("a rejected tile must not be stored")
+	}
+
+	if err := uc.CacheTile(1, 2, 3, []byte("tile")); err != nil {
+		t.Fatalf("CacheTile failed: %v", err)
+	}
+	if _, _, exists, _ := uc.GetCachedTile(1, 2, 3); !exists {
+		t.Fatal("expected a valid tile to be stored")
+	}
+}
+
+func TestNewStoreValidators(t *testing.T) {
+	chain, err := NewStoreValidators(StoreValidatorConfig{Names: []string{"size", "png"}, MinSize: 8})
+	if err != nil {
+		t.Fatalf("NewStoreValidators failed: %v", err)
+	}
+	k := cache.TileCacheKey{X: 1, Y: 2, Z: 3}
+	if err := chain.Validate(k, []byte("tiny")); err == nil {
+		t.Fatal("expected a tile below the minimum size to be rejected")
+	}
+	if err := chain.Validate(k, []byte("not a png at all")); err == nil {
+		t.Fatal("expected a non-PNG tile to be rejected")
+	}
+
+	if _, err := NewStoreValidators(StoreValidatorConfig{Names: []string{"watermark"}}); !errors.Is(err, ErrUnknownStoreValidator) {
+		t.Fatalf("expected ErrUnknownStoreValidator, got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package cacherpc
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// mapServer keeps tiles in a map, keyed like the cache.
+type mapServer struct {
+	UnimplementedTileCacheServiceServer
+	tiles map[[3]uint32][]byte
+}
+
+func (s *mapServer) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+	data, ok := s.tiles[[3]uint32{req.Z, req.X, req.Y}]
+	return &GetResponse{Exists: ok, Data: data}, nil
+}
+
+func (s *mapServer) Set(ctx context.Context, req *SetRequest) (*SetResponse, error) {
+	if len(req.Data) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "empty tile")
+	}
+	s.tiles[[3]uint32{req.Z, req.X, req.Y}] = req.Data
+	return &SetResponse{}, nil
+}
+
+func (s *mapServer) Delete(ctx context.Context, req *DeleteRequest) (*DeleteResponse, error) {
+	delete(s.tiles, [3]uint32{req.Z, req.X, req.Y})
+	return &DeleteResponse{}, nil
+}
+
+func TestClient_CallsServer(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	var intercepted []string
+	srv := grpc.NewServer(grpc.UnaryInterceptor(
+		func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			intercepted = append(intercepted, info.FullMethod)
+			return handler(ctx, req)
+		}))
+	RegisterTileCacheServiceServer(srv, &mapServer{tiles: make(map[[3]uint32][]byte)})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	c, err := Dial("passthrough:///bufnet", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	ctx := context.Background()
+	tile := []byte{0x89, 'P', 'N', 'G', 0}
+	if _, err := c.Set(ctx, &SetRequest{Z: 3, X: 1, Y: 2, Data: tile}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	resp, err := c.Get(ctx, &GetRequest{Z: 3, X: 1, Y: 2})
+	if err != nil || !resp.Exists || !bytes.Equal(resp.Data, tile) {
+		t.Fatalf("Get returned %+v, %v", resp, err)
+	}
+	if _, err := c.Delete(ctx, &DeleteRequest{Z: 3, X: 1, Y: 2}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if resp, _ := c.Get(ctx, &GetRequest{Z: 3, X: 1, Y: 2}); resp.Exists {
+		t.Fatal("deleted tile still exists")
+	}
+
+	if _, err := c.Set(ctx, &SetRequest{Z: 3, X: 1, Y: 2}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	if len(intercepted) != 5 || intercepted[0] != "/tilecache.v1.TileCacheService/Set" {
+		t.Fatalf("interceptor saw %v", intercepted)
+	}
+}
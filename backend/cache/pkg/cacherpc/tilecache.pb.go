@@ -0,0 +1,542 @@
+// The gRPC API between the tiles and cache services. Tile data travels as
+// raw bytes instead of the base64 the JSON API needs.
+//
+// The Go code in tilecache.pb.go and tilecache_grpc.pb.go is generated from
+// this file, see generate.go. Timestamps are Unix nanoseconds, zero when
+// unknown.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: tilecache.proto
+
+package cacherpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Z     uint32                 `protobuf:"varint,1,opt,name=z,proto3" json:"z,omitempty"`
+	X     uint32                 `protobuf:"varint,2,opt,name=x,proto3" json:"x,omitempty"`
+	Y     uint32                 `protobuf:"varint,3,opt,name=y,proto3" json:"y,omitempty"`
+	// layer names the tile set, empty for the default layer
+	Layer         string `protobuf:"bytes,4,opt,name=layer,proto3" json:"layer,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRequest) Reset() {
+	*x = GetRequest{}
+	mi := &file_tilecache_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRequest) ProtoMessage() {}
+
+func (x *GetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tilecache_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRequest.ProtoReflect.Descriptor instead.
+func (*GetRequest) Descriptor() ([]byte, []int) {
+	return file_tilecache_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetRequest) GetZ() uint32 {
+	if x != nil {
+		return x.Z
+	}
+	return 0
+}
+
+func (x *GetRequest) GetX() uint32 {
+	if x != nil {
+		return x.X
+	}
+	return 0
+}
+
+func (x *GetRequest) GetY() uint32 {
+	if x != nil {
+		return x.Y
+	}
+	return 0
+}
+
+func (x *GetRequest) GetLayer() string {
+	if x != nil {
+		return x.Layer
+	}
+	return ""
+}
+
+type GetResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Exists bool                   `protobuf:"varint,1,opt,name=exists,proto3" json:"exists,omitempty"`
+	Data   []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	// not_found records that upstream has no such tile
+	NotFound          bool   `protobuf:"varint,3,opt,name=not_found,json=notFound,proto3" json:"not_found,omitempty"`
+	StoredAtUnixNanos int64  `protobuf:"varint,4,opt,name=stored_at_unix_nanos,json=storedAtUnixNanos,proto3" json:"stored_at_unix_nanos,omitempty"`
+	Etag              string `protobuf:"bytes,5,opt,name=etag,proto3" json:"etag,omitempty"`
+	ContentType       string `protobuf:"bytes,6,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *GetResponse) Reset() {
+	*x = GetResponse{}
+	mi := &file_tilecache_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetResponse) ProtoMessage() {}
+
+func (x *GetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tilecache_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetResponse.ProtoReflect.Descriptor instead.
+func (*GetResponse) Descriptor() ([]byte, []int) {
+	return file_tilecache_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetResponse) GetExists() bool {
+	if x != nil {
+		return x.Exists
+	}
+	return false
+}
+
+func (x *GetResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *GetResponse) GetNotFound() bool {
+	if x != nil {
+		return x.NotFound
+	}
+	return false
+}
+
+func (x *GetResponse) GetStoredAtUnixNanos() int64 {
+	if x != nil {
+		return x.StoredAtUnixNanos
+	}
+	return 0
+}
+
+func (x *GetResponse) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+func (x *GetResponse) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+type SetRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Z     uint32                 `protobuf:"varint,1,opt,name=z,proto3" json:"z,omitempty"`
+	X     uint32                 `protobuf:"varint,2,opt,name=x,proto3" json:"x,omitempty"`
+	Y     uint32                 `protobuf:"varint,3,opt,name=y,proto3" json:"y,omitempty"`
+	Data  []byte                 `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+	// not_found records that upstream has no such tile, data is ignored
+	NotFound bool `protobuf:"varint,5,opt,name=not_found,json=notFound,proto3" json:"not_found,omitempty"`
+	// source is the upstream URL the tile was fetched from
+	Source                string `protobuf:"bytes,6,opt,name=source,proto3" json:"source,omitempty"`
+	UpstreamEtag          string `protobuf:"bytes,7,opt,name=upstream_etag,json=upstreamEtag,proto3" json:"upstream_etag,omitempty"`
+	LastModifiedUnixNanos int64  `protobuf:"varint,8,opt,name=last_modified_unix_nanos,json=lastModifiedUnixNanos,proto3" json:"last_modified_unix_nanos,omitempty"`
+	Layer                 string `protobuf:"bytes,9,opt,name=layer,proto3" json:"layer,omitempty"`
+	unknownFields         protoimpl.UnknownFields
+	sizeCache             protoimpl.SizeCache
+}
+
+func (x *SetRequest) Reset() {
+	*x = SetRequest{}
+	mi := &file_tilecache_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetRequest) ProtoMessage() {}
+
+func (x *SetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tilecache_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetRequest.ProtoReflect.Descriptor instead.
+func (*SetRequest) Descriptor() ([]byte, []int) {
+	return file_tilecache_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SetRequest) GetZ() uint32 {
+	if x != nil {
+		return x.Z
+	}
+	return 0
+}
+
+func (x *SetRequest) GetX() uint32 {
+	if x != nil {
+		return x.X
+	}
+	return 0
+}
+
+func (x *SetRequest) GetY() uint32 {
+	if x != nil {
+		return x.Y
+	}
+	return 0
+}
+
+func (x *SetRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *SetRequest) GetNotFound() bool {
+	if x != nil {
+		return x.NotFound
+	}
+	return false
+}
+
+func (x *SetRequest) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *SetRequest) GetUpstreamEtag() string {
+	if x != nil {
+		return x.UpstreamEtag
+	}
+	return ""
+}
+
+func (x *SetRequest) GetLastModifiedUnixNanos() int64 {
+	if x != nil {
+		return x.LastModifiedUnixNanos
+	}
+	return 0
+}
+
+func (x *SetRequest) GetLayer() string {
+	if x != nil {
+		return x.Layer
+	}
+	return ""
+}
+
+type SetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetResponse) Reset() {
+	*x = SetResponse{}
+	mi := &file_tilecache_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetResponse) ProtoMessage() {}
+
+func (x *SetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tilecache_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetResponse.ProtoReflect.Descriptor instead.
+func (*SetResponse) Descriptor() ([]byte, []int) {
+	return file_tilecache_proto_rawDescGZIP(), []int{3}
+}
+
+type DeleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Z             uint32                 `protobuf:"varint,1,opt,name=z,proto3" json:"z,omitempty"`
+	X             uint32                 `protobuf:"varint,2,opt,name=x,proto3" json:"x,omitempty"`
+	Y             uint32                 `protobuf:"varint,3,opt,name=y,proto3" json:"y,omitempty"`
+	Layer         string                 `protobuf:"bytes,4,opt,name=layer,proto3" json:"layer,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRequest) Reset() {
+	*x = DeleteRequest{}
+	mi := &file_tilecache_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tilecache_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return file_tilecache_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DeleteRequest) GetZ() uint32 {
+	if x != nil {
+		return x.Z
+	}
+	return 0
+}
+
+func (x *DeleteRequest) GetX() uint32 {
+	if x != nil {
+		return x.X
+	}
+	return 0
+}
+
+func (x *DeleteRequest) GetY() uint32 {
+	if x != nil {
+		return x.Y
+	}
+	return 0
+}
+
+func (x *DeleteRequest) GetLayer() string {
+	if x != nil {
+		return x.Layer
+	}
+	return ""
+}
+
+type DeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteResponse) Reset() {
+	*x = DeleteResponse{}
+	mi := &file_tilecache_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteResponse) ProtoMessage() {}
+
+func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tilecache_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteResponse.ProtoReflect.Descriptor instead.
+func (*DeleteResponse) Descriptor() ([]byte, []int) {
+	return file_tilecache_proto_rawDescGZIP(), []int{5}
+}
+
+var File_tilecache_proto protoreflect.FileDescriptor
+
+const file_tilecache_proto_rawDesc = "" +
+	"\n" +
+	"\x0ftilecache.proto\x12\ftilecache.v1\"L\n" +
+	"\n" +
+	"GetRequest\x12\f\n" +
+	"\x01z\x18\x01 \x01(\rR\x01z\x12\f\n" +
+	"\x01x\x18\x02 \x01(\rR\x01x\x12\f\n" +
+	"\x01y\x18\x03 \x01(\rR\x01y\x12\x14\n" +
+	"\x05layer\x18\x04 \x01(\tR\x05layer\"\xbe\x01\n" +
+	"\vGetResponse\x12\x16\n" +
+	"\x06exists\x18\x01 \x01(\bR\x06exists\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\x12\x1b\n" +
+	"\tnot_found\x18\x03 \x01(\bR\bnotFound\x12/\n" +
+	"\x14stored_at_unix_nanos\x18\x04 \x01(\x03R\x11storedAtUnixNanos\x12\x12\n" +
+	"\x04etag\x18\x05 \x01(\tR\x04etag\x12!\n" +
+	"\fcontent_type\x18\x06 \x01(\tR\vcontentType\"\xf3\x01\n" +
+	"\n" +
+	"SetRequest\x12\f\n" +
+	"\x01z\x18\x01 \x01(\rR\x01z\x12\f\n" +
+	"\x01x\x18\x02 \x01(\rR\x01x\x12\f\n" +
+	"\x01y\x18\x03 \x01(\rR\x01y\x12\x12\n" +
+	"\x04data\x18\x04 \x01(\fR\x04data\x12\x1b\n" +
+	"\tnot_found\x18\x05 \x01(\bR\bnotFound\x12\x16\n" +
+	"\x06source\x18\x06 \x01(\tR\x06source\x12#\n" +
+	"\rupstream_etag\x18\a \x01(\tR\fupstreamEtag\x127\n" +
+	"\x18last_modified_unix_nanos\x18\b \x01(\x03R\x15lastModifiedUnixNanos\x12\x14\n" +
+	"\x05layer\x18\t \x01(\tR\x05layer\"\r\n" +
+	"\vSetResponse\"O\n" +
+	"\rDeleteRequest\x12\f\n" +
+	"\x01z\x18\x01 \x01(\rR\x01z\x12\f\n" +
+	"\x01x\x18\x02 \x01(\rR\x01x\x12\f\n" +
+	"\x01y\x18\x03 \x01(\rR\x01y\x12\x14\n" +
+	"\x05layer\x18\x04 \x01(\tR\x05layer\"\x10\n" +
+	"\x0eDeleteResponse2\xaa\x03\n" +
+	"\x10TileCacheService\x12:\n" +
+	"\x03Get\x12\x18.tilecache.v1.GetRequest\x1a\x19.tilecache.v1.GetResponse\x12:\n" +
+	"\x03Set\x12\x18.tilecache.v1.SetRequest\x1a\x19.tilecache.v1.SetResponse\x12C\n" +
+	"\x06Delete\x12\x1b.tilecache.v1.DeleteRequest\x1a\x1c.tilecache.v1.DeleteResponse\x12D\n" +
+	"\tGetStream\x12\x18.tilecache.v1.GetRequest\x1a\x19.tilecache.v1.GetResponse(\x010\x01\x12D\n" +
+	"\tSetStream\x12\x18.tilecache.v1.SetRequest\x1a\x19.tilecache.v1.SetResponse(\x010\x01\x12M\n" +
+	"\fDeleteStream\x12\x1b.tilecache.v1.DeleteRequest\x1a\x1c.tilecache.v1.DeleteResponse(\x010\x01B<Z:github.com/jaennil/guide_helper/backend/cache/pkg/cacherpcb\x06proto3"
+
+var (
+	file_tilecache_proto_rawDescOnce sync.Once
+	file_tilecache_proto_rawDescData []byte
+)
+
+func file_tilecache_proto_rawDescGZIP() []byte {
+	file_tilecache_proto_rawDescOnce.Do(func() {
+		file_tilecache_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_tilecache_proto_rawDesc), len(file_tilecache_proto_rawDesc)))
+	})
+	return file_tilecache_proto_rawDescData
+}
+
+var file_tilecache_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_tilecache_proto_goTypes = []any{
+	(*GetRequest)(nil),     // 0: tilecache.v1.GetRequest
+	(*GetResponse)(nil),    // 1: tilecache.v1.GetResponse
+	(*SetRequest)(nil),     // 2: tilecache.v1.SetRequest
+	(*SetResponse)(nil),    // 3: tilecache.v1.SetResponse
+	(*DeleteRequest)(nil),  // 4: tilecache.v1.DeleteRequest
+	(*DeleteResponse)(nil), // 5: tilecache.v1.DeleteResponse
+}
+var file_tilecache_proto_depIdxs = []int32{
+	0, // 0: tilecache.v1.TileCacheService.Get:input_type -> tilecache.v1.GetRequest
+	2, // 1: tilecache.v1.TileCacheService.Set:input_type -> tilecache.v1.SetRequest
+	4, // 2: tilecache.v1.TileCacheService.Delete:input_type -> tilecache.v1.DeleteRequest
+	0, // 3: tilecache.v1.TileCacheService.GetStream:input_type -> tilecache.v1.GetRequest
+	2, // 4: tilecache.v1.TileCacheService.SetStream:input_type -> tilecache.v1.SetRequest
+	4, // 5: tilecache.v1.TileCacheService.DeleteStream:input_type -> tilecache.v1.DeleteRequest
+	1, // 6: tilecache.v1.TileCacheService.Get:output_type -> tilecache.v1.GetResponse
+	3, // 7: tilecache.v1.TileCacheService.Set:output_type -> tilecache.v1.SetResponse
+	5, // 8: tilecache.v1.TileCacheService.Delete:output_type -> tilecache.v1.DeleteResponse
+	1, // 9: tilecache.v1.TileCacheService.GetStream:output_type -> tilecache.v1.GetResponse
+	3, // 10: tilecache.v1.TileCacheService.SetStream:output_type -> tilecache.v1.SetResponse
+	5, // 11: tilecache.v1.TileCacheService.DeleteStream:output_type -> tilecache.v1.DeleteResponse
+	6, // [6:12] is the sub-list for method output_type
+	0, // [0:6] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_tilecache_proto_init() }
+func file_tilecache_proto_init() {
+	if File_tilecache_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_tilecache_proto_rawDesc), len(file_tilecache_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_tilecache_proto_goTypes,
+		DependencyIndexes: file_tilecache_proto_depIdxs,
+		MessageInfos:      file_tilecache_proto_msgTypes,
+	}.Build()
+	File_tilecache_proto = out.File
+	file_tilecache_proto_goTypes = nil
+	file_tilecache_proto_depIdxs = nil
+}
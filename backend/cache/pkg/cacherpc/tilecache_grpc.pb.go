@@ -0,0 +1,309 @@
+// The gRPC API between the tiles and cache services. Tile data travels as
+// raw bytes instead of the base64 the JSON API needs.
+//
+// The Go code in tilecache.pb.go and tilecache_grpc.pb.go is generated from
+// this file, see generate.go. Timestamps are Unix nanoseconds, zero when
+// unknown.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: tilecache.proto
+
+package cacherpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	TileCacheService_Get_FullMethodName          = "/tilecache.v1.TileCacheService/Get"
+	TileCacheService_Set_FullMethodName          = "/tilecache.v1.TileCacheService/Set"
+	TileCacheService_Delete_FullMethodName       = "/tilecache.v1.TileCacheService/Delete"
+	TileCacheService_GetStream_FullMethodName    = "/tilecache.v1.TileCacheService/GetStream"
+	TileCacheService_SetStream_FullMethodName    = "/tilecache.v1.TileCacheService/SetStream"
+	TileCacheService_DeleteStream_FullMethodName = "/tilecache.v1.TileCacheService/DeleteStream"
+)
+
+// TileCacheServiceClient is the client API for TileCacheService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TileCacheServiceClient interface {
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	// Delete succeeds for tiles that are not cached
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// The streaming variants answer every request on the stream in order, so
+	// a batch of tiles shares one call. The first failing request ends the
+	// stream with its status.
+	GetStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[GetRequest, GetResponse], error)
+	SetStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SetRequest, SetResponse], error)
+	DeleteStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[DeleteRequest, DeleteResponse], error)
+}
+
+type tileCacheServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTileCacheServiceClient(cc grpc.ClientConnInterface) TileCacheServiceClient {
+	return &tileCacheServiceClient{cc}
+}
+
+func (c *tileCacheServiceClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, TileCacheService_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tileCacheServiceClient) Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetResponse)
+	err := c.cc.Invoke(ctx, TileCacheService_Set_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tileCacheServiceClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, TileCacheService_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tileCacheServiceClient) GetStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[GetRequest, GetResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TileCacheService_ServiceDesc.Streams[0], TileCacheService_GetStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GetRequest, GetResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TileCacheService_GetStreamClient = grpc.BidiStreamingClient[GetRequest, GetResponse]
+
+func (c *tileCacheServiceClient) SetStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SetRequest, SetResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TileCacheService_ServiceDesc.Streams[1], TileCacheService_SetStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SetRequest, SetResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TileCacheService_SetStreamClient = grpc.BidiStreamingClient[SetRequest, SetResponse]
+
+func (c *tileCacheServiceClient) DeleteStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[DeleteRequest, DeleteResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TileCacheService_ServiceDesc.Streams[2], TileCacheService_DeleteStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DeleteRequest, DeleteResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TileCacheService_DeleteStreamClient = grpc.BidiStreamingClient[DeleteRequest, DeleteResponse]
+
+// TileCacheServiceServer is the server API for TileCacheService service.
+// All implementations must embed UnimplementedTileCacheServiceServer
+// for forward compatibility.
+type TileCacheServiceServer interface {
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	Set(context.Context, *SetRequest) (*SetResponse, error)
+	// Delete succeeds for tiles that are not cached
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// The streaming variants answer every request on the stream in order, so
+	// a batch of tiles shares one call. The first failing request ends the
+	// stream with its status.
+	GetStream(grpc.BidiStreamingServer[GetRequest, GetResponse]) error
+	SetStream(grpc.BidiStreamingServer[SetRequest, SetResponse]) error
+	DeleteStream(grpc.BidiStreamingServer[DeleteRequest, DeleteResponse]) error
+	mustEmbedUnimplementedTileCacheServiceServer()
+}
+
+// UnimplementedTileCacheServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTileCacheServiceServer struct{}
+
+func (UnimplementedTileCacheServiceServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedTileCacheServiceServer) Set(context.Context, *SetRequest) (*SetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Set not implemented")
+}
+func (UnimplementedTileCacheServiceServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedTileCacheServiceServer) GetStream(grpc.BidiStreamingServer[GetRequest, GetResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method GetStream not implemented")
+}
+func (UnimplementedTileCacheServiceServer) SetStream(grpc.BidiStreamingServer[SetRequest, SetResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method SetStream not implemented")
+}
+func (UnimplementedTileCacheServiceServer) DeleteStream(grpc.BidiStreamingServer[DeleteRequest, DeleteResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method DeleteStream not implemented")
+}
+func (UnimplementedTileCacheServiceServer) mustEmbedUnimplementedTileCacheServiceServer() {}
+func (UnimplementedTileCacheServiceServer) testEmbeddedByValue()                          {}
+
+// UnsafeTileCacheServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TileCacheServiceServer will
+// result in compilation errors.
+type UnsafeTileCacheServiceServer interface {
+	mustEmbedUnimplementedTileCacheServiceServer()
+}
+
+func RegisterTileCacheServiceServer(s grpc.ServiceRegistrar, srv TileCacheServiceServer) {
+	// If the following call pancis, it indicates UnimplementedTileCacheServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&TileCacheService_ServiceDesc, srv)
+}
+
+func _TileCacheService_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TileCacheServiceServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TileCacheService_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TileCacheServiceServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TileCacheService_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TileCacheServiceServer).Set(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TileCacheService_Set_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TileCacheServiceServer).Set(ctx, req.(*SetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TileCacheService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TileCacheServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TileCacheService_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TileCacheServiceServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TileCacheService_GetStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TileCacheServiceServer).GetStream(&grpc.GenericServerStream[GetRequest, GetResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TileCacheService_GetStreamServer = grpc.BidiStreamingServer[GetRequest, GetResponse]
+
+func _TileCacheService_SetStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TileCacheServiceServer).SetStream(&grpc.GenericServerStream[SetRequest, SetResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TileCacheService_SetStreamServer = grpc.BidiStreamingServer[SetRequest, SetResponse]
+
+func _TileCacheService_DeleteStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TileCacheServiceServer).DeleteStream(&grpc.GenericServerStream[DeleteRequest, DeleteResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TileCacheService_DeleteStreamServer = grpc.BidiStreamingServer[DeleteRequest, DeleteResponse]
+
+// TileCacheService_ServiceDesc is the grpc.ServiceDesc for TileCacheService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TileCacheService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tilecache.v1.TileCacheService",
+	HandlerType: (*TileCacheServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _TileCacheService_Get_Handler,
+		},
+		{
+			MethodName: "Set",
+			Handler:    _TileCacheService_Set_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _TileCacheService_Delete_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetStream",
+			Handler:       _TileCacheService_GetStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "SetStream",
+			Handler:       _TileCacheService_SetStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DeleteStream",
+			Handler:       _TileCacheService_DeleteStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "tilecache.proto",
+}
@@ -10,15 +10,52 @@ import (
 
 type (
 	Config struct {
-		HTTP           HTTP      `envPrefix:"HTTP_"`
-		Logger         Logger    `envPrefix:"LOGGER_"`
-		Telemetry      Telemetry `envPrefix:"TELEMETRY_"`
-		Redis          Redis     `envPrefix:"REDIS_"`
+		// Backend names the cache backend explicitly, e.g. "badger". Empty
+		// picks it from the other settings: redis when enabled, then remote,
+		// s3, mbtiles, memory and finally sqlite.
+		Backend        string        `env:"CACHE_BACKEND" envDefault:""`
+		// MaxSizeBytes caps the tile data the backend holds, zero means no
+		// limit. Every SweepInterval the least recently accessed tiles beyond
+		// it are deleted. Needs a backend that lists and deletes tiles, such
+		// as sqlite or filesystem.
+		MaxSizeBytes   int64         `env:"CACHE_MAX_SIZE_BYTES" envDefault:"0"`
+		SweepInterval  time.Duration `env:"CACHE_SWEEP_INTERVAL" envDefault:"1m"`
+		HTTP           HTTP          `envPrefix:"HTTP_"`
+		GRPC           GRPC          `envPrefix:"GRPC_"`
+		Logger         Logger        `envPrefix:"LOGGER_"`
+		Telemetry      Telemetry     `envPrefix:"TELEMETRY_"`
+		Redis          Redis         `envPrefix:"REDIS_"`
+		SQLite         SQLite        `envPrefix:"SQLITE_"`
+		Badger         Badger        `envPrefix:"BADGER_"`
+		Filesystem     Filesystem    `envPrefix:"FILESYSTEM_"`
+		MBTiles        MBTiles       `envPrefix:"MBTILES_"`
+		Remote         Remote        `envPrefix:"REMOTE_"`
+		S3             S3            `envPrefix:"S3_"`
+		Memory         Memory        `envPrefix:"MEMORY_"`
+		Shutdown       Shutdown      `envPrefix:"SHUTDOWN_"`
+		Storage        Storage       `envPrefix:"STORAGE_"`
+		Audit          Audit         `envPrefix:"AUDIT_"`
+		Auth           Auth          `envPrefix:"AUTH_"`
 	}
 
 	HTTP struct {
 		Server  Server        `envPrefix:"SERVER_"`
 		Timeout time.Duration `envPrefix:"TIMEOUT" envDefault:"10s"`
+		// RootFormat is "text", serving RootText at "/", or "json", serving a
+		// service descriptor that includes it. RootText defaults to the
+		// OpenStreetMap attribution.
+		RootFormat string `env:"ROOT_FORMAT" envDefault:"text"`
+		RootText   string `env:"ROOT_TEXT"`
+		// HealthChecks lists the dependencies checked by /healthz, out of
+		// "cache"; "none" checks nothing
+		HealthChecks []string `env:"HEALTH_CHECKS" envDefault:"cache"`
+	}
+
+	// GRPC serves TileCacheService on Port next to the HTTP API when
+	// Enabled
+	GRPC struct {
+		Enabled bool   `env:"ENABLED" envDefault:"false"`
+		Port    string `env:"PORT" envDefault:"9090"`
 	}
 
 	Server struct {
@@ -30,6 +67,14 @@ type (
 
 	Logger struct {
 		Level string `env:"LEVEL,required"`
+		// Encoding is "console" or "json"
+		Encoding string `env:"ENCODING" envDefault:"console"`
+		// Field keys override the encoder defaults to match the log platform,
+		// e.g. LEVEL_KEY=severity for GCP Cloud Logging
+		LevelKey   string `env:"LEVEL_KEY" envDefault:""`
+		MessageKey string `env:"MESSAGE_KEY" envDefault:""`
+		TimeKey    string `env:"TIME_KEY" envDefault:""`
+		CallerKey  string `env:"CALLER_KEY" envDefault:""`
 	}
 
 	Telemetry struct {
@@ -46,9 +91,181 @@ type (
 		Password string        `env:"PASSWORD" envDefault:""`
 		DB       int           `env:"DB" envDefault:"0"`
 		TTL      time.Duration `env:"TTL" envDefault:"24h"`
+		// ZoomTTLs overrides TTL per zoom level, e.g. "0=720h,1=720h,18=6h"
+		ZoomTTLs map[int]time.Duration `env:"ZOOM_TTLS" envSeparator:"," envKeyValSeparator:"="`
+		// KeyPrefix namespaces tile keys in a shared Redis, e.g. "guidehelper:"
+		KeyPrefix string `env:"KEY_PREFIX" envDefault:""`
+
+		// InvalidationChannel enables cross-instance invalidation over pub/sub when set
+		InvalidationChannel string `env:"INVALIDATION_CHANNEL" envDefault:""`
+	}
+
+	// Remote chains this instance in front of another cache service when BaseURL is set
+	Remote struct {
+		BaseURL string        `env:"BASE_URL" envDefault:""`
+		Timeout time.Duration `env:"TIMEOUT" envDefault:"5s"`
+	}
+
+	// S3 stores tiles in an S3-compatible bucket when Bucket is set, so
+	// replicas can share durable storage. Tiles are stored as
+	// {Prefix}{z}/{x}/{y}{Extension}. Needs a binary built with -tags s3.
+	S3 struct {
+		Endpoint  string        `env:"ENDPOINT" envDefault:"https://s3.amazonaws.com"`
+		Region    string        `env:"REGION" envDefault:"us-east-1"`
+		Bucket    string        `env:"BUCKET" envDefault:""`
+		AccessKey string        `env:"ACCESS_KEY" envDefault:""`
+		SecretKey string        `env:"SECRET_KEY" envDefault:""`
+		Prefix    string        `env:"PREFIX" envDefault:"tiles/"`
+		Extension string        `env:"EXTENSION" envDefault:".png"`
+		PathStyle bool          `env:"PATH_STYLE" envDefault:"true"`
+		Timeout   time.Duration `env:"TIMEOUT" envDefault:"10s"`
+	}
+
+	// Memory keeps tiles in process memory when Enabled, evicting the least
+	// recently used ones beyond MaxEntries tiles or MaxBytes of tile data.
+	// Zero leaves a bound open. Tiles are lost on restart. With Tier the
+	// memory cache fronts the persistent backend as an L1 instead of
+	// replacing it.
+	Memory struct {
+		Enabled    bool  `env:"ENABLED" envDefault:"false"`
+		Tier       bool  `env:"TIER" envDefault:"false"`
+		MaxEntries int   `env:"MAX_ENTRIES" envDefault:"0"`
+		MaxBytes   int64 `env:"MAX_BYTES" envDefault:"268435456"`
+	}
+
+	Storage struct {
+		// ValueFormat is "raw" to store tile bytes only, which keeps the
+		// files of the filesystem, S3 and MBTiles backends plain images, or
+		// "envelope" to store them with their content type, ETag, store time
+		// and upstream validators. Raw values written earlier remain readable
+		// in envelope mode, envelopes are not readable in raw mode.
+		ValueFormat string `env:"VALUE_FORMAT" envDefault:"raw"`
+		// Compression is "none", "gzip" or "zstd". CompressionLevel trades CPU
+		// for space, 1-9 for gzip and 1-22 for zstd; 0 is the codec default.
+		Compression      string `env:"COMPRESSION" envDefault:"none"`
+		CompressionLevel int    `env:"COMPRESSION_LEVEL" envDefault:"0"`
+		// CoalesceStores collapses identical concurrent stores of a tile into
+		// one backend write, and those within CoalesceWindow after it
+		CoalesceStores bool          `env:"COALESCE_STORES" envDefault:"true"`
+		CoalesceWindow time.Duration `env:"COALESCE_WINDOW" envDefault:"0"`
+		// MigrationRate caps the tiles per second copied by a backend
+		// migration started through the admin API, zero means unlimited
+		MigrationRate int `env:"MIGRATION_RATE" envDefault:"500"`
+		// NotFoundTTL is how long a tile missing upstream is remembered as
+		// such, shorter than the tile TTL so it is re-checked sooner. It
+		// applies on every backend, the record carries its store time.
+		NotFoundTTL time.Duration `env:"NOT_FOUND_TTL" envDefault:"1h"`
+		// OperationTimeout bounds each backend read and write; a backend that
+		// does not answer in time fails the request with 504. Zero waits.
+		OperationTimeout time.Duration `env:"OPERATION_TIMEOUT" envDefault:"5s"`
+		// MaxInFlight bounds the backend operations running at once, those
+		// that timed out and still run included; zero leaves them unbounded
+		MaxInFlight int `env:"MAX_IN_FLIGHT" envDefault:"256"`
+		// Validators are the checks a tile must pass to be stored, run in
+		// order: "png" for a valid PNG header, "size" for a size between
+		// ValidateMinSize and ValidateMaxSize bytes (zero leaves a bound open)
+		Validators      []string `env:"VALIDATORS" envSeparator:","`
+		ValidateMinSize int      `env:"VALIDATE_MIN_SIZE" envDefault:"0"`
+		ValidateMaxSize int      `env:"VALIDATE_MAX_SIZE" envDefault:"0"`
+	}
+
+	// Audit records every tile store and delete with who made it and when.
+	// Sink is "none", "log" to log the records at Level, or "file" to append
+	// them as NDJSON to Path.
+	Audit struct {
+		Sink  string `env:"SINK" envDefault:"none"`
+		Path  string `env:"PATH" envDefault:"audit.log"`
+		Level string `env:"LEVEL" envDefault:"warn"`
+	}
+
+	Auth struct {
+		// APIKeys grant access to the admin endpoints: migration, access
+		// export and purge. With none set those endpoints reject every
+		// request.
+		APIKeys []string `env:"API_KEYS" envSeparator:","`
+	}
+
+	// Shutdown bounds how long in-flight requests and background workers may
+	// take to finish before the process exits anyway
+	Shutdown struct {
+		HTTPDrainTimeout   time.Duration `env:"HTTP_DRAIN_TIMEOUT" envDefault:"30s"`
+		GRPCDrainTimeout   time.Duration `env:"GRPC_DRAIN_TIMEOUT" envDefault:"30s"`
+		WorkerDrainTimeout time.Duration `env:"WORKER_DRAIN_TIMEOUT" envDefault:"30s"`
+	}
+
+	SQLite struct {
+		Path                string        `env:"PATH" envDefault:"file:cache.db?cache=shared&mode=memory"`
+		AccessFlushInterval time.Duration `env:"ACCESS_FLUSH_INTERVAL" envDefault:"5s"`
+		// Dedup stores byte-identical tiles, e.g. blank ocean, only once
+		Dedup bool `env:"DEDUP" envDefault:"false"`
+		// MigrationTimeout fails startup when the schema migrations take
+		// longer, e.g. on a database locked by another process. Zero waits.
+		MigrationTimeout time.Duration `env:"MIGRATION_TIMEOUT" envDefault:"1m"`
+	}
+
+	// MBTiles serves and stores tiles in an MBTiles file when Path is set,
+	// e.g. to seed the cache from an export. A missing file is created.
+	// Needs a binary built with -tags sqlite.
+	MBTiles struct {
+		Path string `env:"PATH" envDefault:""`
+	}
+
+	// Filesystem is used when CACHE_BACKEND is "filesystem", storing tiles
+	// under Root, which is created when missing. Layout is "zxy" for
+	// Root/z/x/y files or "hashed" to shard them into directories by a hash
+	// of the key. MaxOpenFiles caps the files open at once, zero means no
+	// limit.
+	Filesystem struct {
+		Root         string `env:"ROOT" envDefault:"tiles"`
+		Layout       string `env:"LAYOUT" envDefault:"zxy"`
+		MaxOpenFiles int    `env:"MAX_OPEN_FILES" envDefault:"0"`
+	}
+
+	// Badger is used when CACHE_BACKEND is "badger", in binaries built with
+	// -tags badger.
+	Badger struct {
+		Path       string        `env:"PATH" envDefault:"badger"`
+		SyncWrites bool          `env:"SYNC_WRITES" envDefault:"false"`
+		GCInterval time.Duration `env:"GC_INTERVAL" envDefault:"10m"`
 	}
 )
 
+const redacted = "[REDACTED]"
+
+// Redact returns a copy of the config with secrets masked so it can be logged.
+func (c Config) Redact() Config {
+	if c.Redis.Password != "" {
+		c.Redis.Password = redacted
+	}
+	if c.S3.SecretKey != "" {
+		c.S3.SecretKey = redacted
+	}
+	if len(c.Auth.APIKeys) > 0 {
+		keys := make([]string, len(c.Auth.APIKeys))
+		for i := range keys {
+			keys[i] = redacted
+		}
+		c.Auth.APIKeys = keys
+	}
+	return c
+}
+
+// Reload reads the config again for a running service. Values in the .env
+// file take precedence over the environment here, since the environment of a
+// running process cannot change.
+func Reload() (*Config, error) {
+	if err := godotenv.Overload(); err != nil {
+		log.Printf("NOTICE: .env file not found or cannot be loaded: %v\n", err)
+	}
+
+	cfg, err := env.ParseAs[Config]()
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
 func New() (*Config, error) {
 	err := godotenv.Load()
 	if err != nil {
@@ -10,11 +10,32 @@ import (
 
 type ZapLogger struct {
 	logger *zap.SugaredLogger
+	level  zap.AtomicLevel
 }
 
 var _ Logger = (*ZapLogger)(nil)
 
 func NewZapLogger(cfg config.Logger) *ZapLogger {
+	zc := zapConfig(cfg)
+	logger, err := zc.Build(
+		zap.AddCaller(),
+		zap.AddCallerSkip(1),
+	)
+	if err != nil {
+		log.Fatal("error occurred while building zap logger: ", err)
+	}
+
+	sugared := logger.Sugar()
+
+	return &ZapLogger{
+		logger: sugared,
+		level:  zc.Level,
+	}
+}
+
+// zapConfig builds the zap configuration, applying any field keys set in cfg
+// on top of the development encoder defaults.
+func zapConfig(cfg config.Logger) zap.Config {
 	developmentConfig := zap.NewDevelopmentConfig()
 
 	developmentConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
@@ -24,18 +45,23 @@ func NewZapLogger(cfg config.Logger) *ZapLogger {
 	level := toZapLevel(cfg.Level)
 	developmentConfig.Level = zap.NewAtomicLevelAt(level)
 
-	logger, err := developmentConfig.Build(
-		zap.AddCaller(),
-		zap.AddCallerSkip(1),
-	)
-	if err != nil {
-		log.Fatal("error occurred while building zap logger: ", err)
+	if cfg.Encoding == "json" {
+		developmentConfig.Encoding = "json"
+		// Color codes would end up inside the JSON strings
+		developmentConfig.EncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
 	}
 
-	sugared := logger.Sugar()
+	setKey(&developmentConfig.EncoderConfig.LevelKey, cfg.LevelKey)
+	setKey(&developmentConfig.EncoderConfig.MessageKey, cfg.MessageKey)
+	setKey(&developmentConfig.EncoderConfig.TimeKey, cfg.TimeKey)
+	setKey(&developmentConfig.EncoderConfig.CallerKey, cfg.CallerKey)
 
-	return &ZapLogger{
-		logger: sugared,
+	return developmentConfig
+}
+
+func setKey(key *string, override string) {
+	if override != "" {
+		*key = override
 	}
 }
 
@@ -50,6 +76,15 @@ func toZapLevel(levelStr string) zapcore.Level {
 	return level
 }
 
+// SetLevel changes the minimum level of entries logged from now on.
+func (l *ZapLogger) SetLevel(levelStr string) {
+	l.level.SetLevel(toZapLevel(levelStr))
+}
+
+func (l *ZapLogger) Level() zapcore.Level {
+	return l.level.Level()
+}
+
 func (l *ZapLogger) Debug(msg string, keysAndValues ...any) {
 	l.logger.Debugw(msg, keysAndValues...)
 }
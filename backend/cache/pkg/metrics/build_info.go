@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Build variables, set at link time:
+//
+//	go build -ldflags "-X github.com/jaennil/guide_helper/backend/cache/pkg/metrics.Version=1.2.3 -X github.com/jaennil/guide_helper/backend/cache/pkg/metrics.Commit=abc1234"
+var (
+	Version = "dev"
+	Commit  = "unknown"
+)
+
+// BuildInfo is always 1; its labels identify the running build.
+var BuildInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "build_info",
+	Help: "Build information of the running binary",
+}, []string{"version", "commit", "goversion"})
+
+func init() {
+	BuildInfo.WithLabelValues(Version, Commit, runtime.Version()).Set(1)
+}
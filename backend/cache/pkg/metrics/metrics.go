@@ -21,6 +21,51 @@ var (
 		Help: "Total number of cache store operations",
 	})
 
+	CacheStoresCoalesced = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cache_stores_coalesced_total",
+		Help: "Total number of tile stores collapsed into an identical store of the same tile",
+	})
+
+	CacheStoresRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cache_stores_rejected_total",
+		Help: "Total number of tile stores refused by a store validator",
+	})
+
+	CacheMigrationTiles = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_migration_tiles_total",
+		Help: "Total number of tiles visited by backend migrations, by result",
+	}, []string{"result"})
+
+	CacheBackendTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_backend_timeouts_total",
+		Help: "Total number of backend operations abandoned for exceeding the operation timeout, by operation",
+	}, []string{"operation"})
+
+	CacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cache_evictions_total",
+		Help: "Total number of tiles evicted from the in-memory cache to stay within its bounds",
+	})
+
+	CacheSizeEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cache_size_evictions_total",
+		Help: "Total number of tiles deleted from the backend to stay within the size limit",
+	})
+
+	CacheStoredBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "cache_stored_bytes",
+		Help: "Bytes of tile data held by the backend as of the last size limit check",
+	})
+
+	CacheTierLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_tier_lookups_total",
+		Help: "Total number of tile lookups per tier of a tiered cache, by tier (l1, l2) and result (hit, miss)",
+	}, []string{"tier", "result"})
+
+	CacheCompressionBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_compression_bytes_total",
+		Help: "Total bytes of tiles stored through compression, by codec and size (raw, compressed)",
+	}, []string{"codec", "size"})
+
 	// Redis metrics
 	RedisOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "redis_operation_duration_seconds",
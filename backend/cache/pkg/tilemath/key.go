@@ -0,0 +1,105 @@
+package tilemath
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidKey is returned for tile keys and coordinates that are not in
+// canonical form.
+var ErrInvalidKey = errors.New("invalid tile key")
+
+// Key formats tile coordinates as "z/x/y" in plain decimal. The tiles and
+// cache services both address tiles this way, in cache URLs, invalidation
+// messages and storage paths, and the tiles service imports it from here so
+// the format cannot drift between them.
+func Key(z, x, y int) string {
+	return strconv.Itoa(z) + "/" + strconv.Itoa(x) + "/" + strconv.Itoa(y)
+}
+
+// ParseKey parses a key produced by Key. Other spellings of the same tile,
+// such as "05/10/12" or "+5/10/12", are rejected so that a tile never has
+// more than one key.
+func ParseKey(key string) (Tile, error) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 3 {
+		return Tile{}, fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+
+	var coords [3]int
+	for i, part := range parts {
+		v, err := ParseCoord(part)
+		if err != nil {
+			return Tile{}, fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+		coords[i] = v
+	}
+	return Tile{Z: coords[0], X: coords[1], Y: coords[2]}, nil
+}
+
+// ParseCoord parses a single coordinate in canonical form: a non-negative
+// decimal integer without sign or leading zeros.
+func ParseCoord(s string) (int, error) {
+	if s == "" || (len(s) > 1 && s[0] == '0') {
+		return 0, fmt.Errorf("%w: coordinate %q", ErrInvalidKey, s)
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("%w: coordinate %q", ErrInvalidKey, s)
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: coordinate %q", ErrInvalidKey, s)
+	}
+	return v, nil
+}
+
+// ErrInvalidLayer is returned for layer names that cannot be used in keys.
+var ErrInvalidLayer = errors.New("invalid layer name")
+
+// maxLayerLen bounds layer names, which end up in URLs, storage keys and
+// file names.
+const maxLayerLen = 32
+
+// ValidateLayer checks a layer name: a lowercase letter followed by
+// lowercase letters, digits and dashes, 32 characters at most. Starting with
+// a letter keeps a layer apart from the coordinates that follow it in a key,
+// and none of the characters need escaping in URLs, storage keys or paths.
+func ValidateLayer(layer string) error {
+	if layer == "" || len(layer) > maxLayerLen || layer[0] < 'a' || layer[0] > 'z' {
+		return fmt.Errorf("%w: %q", ErrInvalidLayer, layer)
+	}
+	for _, r := range layer {
+		if !('a' <= r && r <= 'z' || '0' <= r && r <= '9' || r == '-') {
+			return fmt.Errorf("%w: %q", ErrInvalidLayer, layer)
+		}
+	}
+	return nil
+}
+
+// LayerKey is Key prefixed with the tile's layer, "layer/z/x/y". Tiles of
+// the default layer, the empty one, keep their plain "z/x/y" key.
+func LayerKey(layer string, z, x, y int) string {
+	if layer == "" {
+		return Key(z, x, y)
+	}
+	return layer + "/" + Key(z, x, y)
+}
+
+// ParseLayerKey parses a key produced by LayerKey.
+func ParseLayerKey(key string) (string, Tile, error) {
+	layer, rest, found := strings.Cut(key, "/")
+	if !found || ValidateLayer(layer) != nil {
+		t, err := ParseKey(key)
+		return "", t, err
+	}
+	t, err := ParseKey(rest)
+	if err != nil {
+		return "", Tile{}, fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return layer, t, nil
+}
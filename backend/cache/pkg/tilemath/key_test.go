@@ -0,0 +1,82 @@
+package tilemath
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var keyVectors = filepath.Join("testdata", "tile_keys.json")
+
+func TestKey_SharedVectors(t *testing.T) {
+	raw, err := os.ReadFile(keyVectors)
+	if err != nil {
+		t.Fatalf("failed to read shared key vectors: %v", err)
+	}
+	var vectors struct {
+		Valid []struct {
+			Z   int    `json:"z"`
+			X   int    `json:"x"`
+			Y   int    `json:"y"`
+			Key string `json:"key"`
+		} `json:"valid"`
+		Invalid []string `json:"invalid"`
+	}
+	if err := json.Unmarshal(raw, &vectors); err != nil {
+		t.Fatalf("failed to parse shared key vectors: %v", err)
+	}
+
+	for _, v := range vectors.Valid {
+		if got := Key(v.Z, v.X, v.Y); got != v.Key {
+			t.Errorf("Key(%d, %d, %d) = %q, want %q", v.Z, v.X, v.Y, got, v.Key)
+		}
+		tile, err := ParseKey(v.Key)
+		if err != nil {
+			t.Errorf("ParseKey(%q) failed: %v", v.Key, err)
+			continue
+		}
+		if tile != (Tile{Z: v.Z, X: v.X, Y: v.Y}) {
+			t.Errorf("ParseKey(%q) = %+v", v.Key, tile)
+		}
+	}
+
+	for _, key := range vectors.Invalid {
+		if _, err := ParseKey(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("ParseKey(%q) should fail with ErrInvalidKey, got %v", key, err)
+		}
+	}
+}
+
+func TestLayerKey(t *testing.T) {
+	if got := LayerKey("", 5, 10, 12); got != "5/10/12" {
+		t.Fatalf("default layer key %q", got)
+	}
+	key := LayerKey("cyclosm", 5, 10, 12)
+	if key != "cyclosm/5/10/12" {
+		t.Fatalf("layer key %q", key)
+	}
+	for in, want := range map[string]string{key: "cyclosm", "5/10/12": ""} {
+		layer, tile, err := ParseLayerKey(in)
+		if err != nil || layer != want || tile != (Tile{Z: 5, X: 10, Y: 12}) {
+			t.Errorf("ParseLayerKey(%q) = %q, %+v, %v", in, layer, tile, err)
+		}
+	}
+	for _, in := range []string{"cyclosm/5/10", "Cyclosm/5/10/12", "1a/5/10/12", "cyclosm/05/10/12"} {
+		if _, _, err := ParseLayerKey(in); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("ParseLayerKey(%q) should fail with ErrInvalidKey, got %v", in, err)
+		}
+	}
+
+	for _, layer := range []string{"osm", "open-topo", "s2"} {
+		if err := ValidateLayer(layer); err != nil {
+			t.Errorf("ValidateLayer(%q) failed: %v", layer, err)
+		}
+	}
+	for _, layer := range []string{"", "OSM", "2gis", "a_b", "a/b", "layer-name-that-is-far-too-long-x"} {
+		if err := ValidateLayer(layer); !errors.Is(err, ErrInvalidLayer) {
+			t.Errorf("ValidateLayer(%q) should fail, got %v", layer, err)
+		}
+	}
+}
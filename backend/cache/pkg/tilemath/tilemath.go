@@ -0,0 +1,99 @@
+// Package tilemath maps WGS84 bounding boxes to the slippy map tiles that
+// cover them.
+package tilemath
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const MaxZoom = 30
+
+var ErrInvalidBBox = errors.New("invalid bounding box")
+
+type Tile struct {
+	Z int `json:"z"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// BBox is a geographic rectangle in degrees.
+type BBox struct {
+	West  float64 `json:"west"`
+	South float64 `json:"south"`
+	East  float64 `json:"east"`
+	North float64 `json:"north"`
+}
+
+// ParseBBox parses "west,south,east,north" in degrees.
+func ParseBBox(s string) (BBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return BBox{}, ErrInvalidBBox
+	}
+
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return BBox{}, ErrInvalidBBox
+		}
+		v[i] = f
+	}
+
+	b := BBox{West: v[0], South: v[1], East: v[2], North: v[3]}
+	return b, b.Validate()
+}
+
+func (b BBox) Validate() error {
+	if b.West < -180 || b.East > 180 || b.South < -90 || b.North > 90 {
+		return ErrInvalidBBox
+	}
+	if b.West >= b.East || b.South >= b.North {
+		return ErrInvalidBBox
+	}
+	return nil
+}
+
+// LatLonToTile returns the tile containing the point at zoom z.
+func LatLonToTile(lat, lon float64, z int) Tile {
+	n := math.Exp2(float64(z))
+	x := int(math.Floor((lon + 180) / 360 * n))
+
+	latRad := lat * math.Pi / 180
+	y := int(math.Floor((1 - math.Log(math.Tan(latRad)+1/math.Cos(latRad))/math.Pi) / 2 * n))
+
+	maxIndex := int(n) - 1
+	return Tile{Z: z, X: clamp(x, 0, maxIndex), Y: clamp(y, 0, maxIndex)}
+}
+
+// TileRange returns the north-west and south-east corner tiles of the tiles
+// covering the box at zoom z.
+func TileRange(b BBox, z int) (nw, se Tile) {
+	return LatLonToTile(b.North, b.West, z), LatLonToTile(b.South, b.East, z)
+}
+
+// CountInBBox returns how many tiles cover the box at zoom z.
+func CountInBBox(b BBox, z int) int {
+	nw, se := TileRange(b, z)
+	return (se.X - nw.X + 1) * (se.Y - nw.Y + 1)
+}
+
+// TilesInBBox calls fn for every tile covering the box at zoom z, stopping
+// early when fn returns false.
+func TilesInBBox(b BBox, z int, fn func(Tile) bool) {
+	nw, se := TileRange(b, z)
+	for x := nw.X; x <= se.X; x++ {
+		for y := nw.Y; y <= se.Y; y++ {
+			if !fn(Tile{Z: z, X: x, Y: y}) {
+				return
+			}
+		}
+	}
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
@@ -0,0 +1,35 @@
+package tilemath
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseBBox(t *testing.T) {
+	b, err := ParseBBox("37.5, 55.6,37.7,55.8")
+	if err != nil {
+		t.Fatalf("ParseBBox failed: %v", err)
+	}
+	if b != (BBox{West: 37.5, South: 55.6, East: 37.7, North: 55.8}) {
+		t.Fatalf("unexpected bbox %+v", b)
+	}
+
+	for _, s := range []string{"", "1,2,3", "a,2,3,4", "10,0,5,1", "-190,0,0,1"} {
+		if _, err := ParseBBox(s); !errors.Is(err, ErrInvalidBBox) {
+			t.Errorf("ParseBBox(%q): expected ErrInvalidBBox, got %v", s, err)
+		}
+	}
+}
+
+func TestTilesInBBox(t *testing.T) {
+	b := BBox{West: -10, South: -10, East: 10, North: 10}
+
+	var tiles []Tile
+	TilesInBBox(b, 1, func(tile Tile) bool {
+		tiles = append(tiles, tile)
+		return true
+	})
+	if len(tiles) != 4 || CountInBBox(b, 1) != 4 {
+		t.Fatalf("expected the four zoom 1 tiles, got %v", tiles)
+	}
+}
@@ -8,14 +8,16 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
+	"github.com/gin-gonic/gin"
 	v1 "github.com/jaennil/guide_helper/backend/tiles/internal/infrastructure/http/v1"
 	"github.com/jaennil/guide_helper/backend/tiles/internal/infrastructure/http/v1/handler"
 	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
 	"github.com/jaennil/guide_helper/backend/tiles/pkg/config"
 	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
 	"github.com/jaennil/guide_helper/backend/tiles/pkg/telemetry"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/tilemath"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func Run() {
@@ -26,9 +28,9 @@ func Run() {
 	}
 
 	// Initialize logger
-	l := logger.NewZapLogger(cfg.Logger.Level)
+	l := logger.NewZapLogger(cfg.Logger)
 
-	l.Info("starting tiles service", "config", cfg)
+	l.Info("starting tiles service", "config", cfg.Redact())
 
 	// Initialize OpenTelemetry if enabled
 	var shutdownTelemetry func(context.Context) error
@@ -51,18 +53,233 @@ func Run() {
 		l.Info("telemetry initialized", "service", cfg.Telemetry.ServiceName)
 	}
 
+	var servePrometheus bool
+	for _, exporter := range cfg.Telemetry.MetricsExporters {
+		switch exporter {
+		case "prometheus":
+			servePrometheus = true
+		case "otlp":
+			endpoint := cfg.Telemetry.MetricsEndpoint
+			if endpoint == "" {
+				endpoint = cfg.Telemetry.OTLPEndpoint
+			}
+			shutdownMetrics, err := telemetry.InitMetrics(telemetry.Config{
+				ServiceName:    cfg.Telemetry.ServiceName,
+				ServiceVersion: cfg.Telemetry.ServiceVersion,
+				Environment:    cfg.Telemetry.Environment,
+				OTLPEndpoint:   endpoint,
+			}, cfg.Telemetry.MetricsInterval, l)
+			if err != nil {
+				l.Fatal("failed to initialize otlp metrics export", "error", err)
+			}
+			defer func() {
+				if err := shutdownMetrics(context.Background()); err != nil {
+					l.Error("failed to shutdown otlp metrics export", "error", err)
+				}
+			}()
+		default:
+			l.Fatal("unknown metrics exporter", "exporter", exporter)
+		}
+	}
+
+	maintenanceWindows, err := usecase.ParseMaintenanceWindows(cfg.Maintenance.Windows)
+	if err != nil {
+		l.Fatal("invalid maintenance window", "error", err)
+	}
+
+	signers, err := usecase.ParseSigners(cfg.Upstream.Signers)
+	if err != nil {
+		l.Fatal("invalid upstream signer", "error", err)
+	}
+
+	contentTypeModes, err := usecase.ParseContentTypeModes(cfg.Upstream.ContentTypes)
+	if err != nil {
+		l.Fatal("invalid upstream content type mode", "error", err)
+	}
+
+	encoders, err := usecase.ParseEncoders(cfg.HTTP.Encoders)
+	if err != nil {
+		l.Fatal("invalid tile encoder", "error", err)
+	}
+
+	layers, err := usecase.ParseLayers(cfg.Upstream.Layers, cfg.Upstream.LayerAttributions)
+	if err != nil {
+		l.Fatal("invalid tile layer", "error", err)
+	}
+
+	var maxZoomPlaceholder []byte
+	if cfg.Upstream.MaxZoomPlaceholder != "" {
+		maxZoomPlaceholder, err = os.ReadFile(cfg.Upstream.MaxZoomPlaceholder)
+		if err != nil {
+			l.Fatal("failed to read max zoom placeholder", "error", err)
+		}
+	}
+
 	// Initialize usecase
-	tileUseCase := usecase.NewTileUseCase(
-		cfg.Cache.BaseURL,
-		cfg.Upstream.TileServerURL,
-		l,
-	)
+	tileUseCase, err := usecase.NewTileUseCase(usecase.TileUseCaseConfig{
+		CacheBaseURL:     cfg.Cache.BaseURL,
+		CacheGRPCAddr:    cfg.Cache.GRPCAddr,
+		CacheAPIKey:      cfg.Cache.APIKey,
+		UpstreamTileURL:  cfg.Upstream.TileServerURL,
+		MaxServedAge:     cfg.Cache.MaxServedAge,
+		Providers:        cfg.Upstream.Providers,
+		Subdomains:       cfg.Upstream.Subdomains,
+		Retina:           cfg.Upstream.Retina,
+		Signers:          signers,
+		ContentTypeModes: contentTypeModes,
+		Layers:           layers,
+		IgnoreNoStore:    cfg.Upstream.IgnoreNoStore,
+		CacheNotFound:    cfg.Cache.NotFound,
+		Maintenance:      cfg.Maintenance.Enabled,
+		StoreRetry: usecase.StoreRetryConfig{
+			MaxAttempts: cfg.Cache.StoreMaxAttempts,
+			BaseDelay:   cfg.Cache.StoreRetryBaseDelay,
+			MaxDelay:    cfg.Cache.StoreRetryMaxDelay,
+		},
+		VerifySampleRate:      cfg.Cache.VerifySampleRate,
+		OptimizePNG:           cfg.Cache.OptimizePNG,
+		MinTileBytes:          cfg.Cache.MinTileBytes,
+		MaxTileBytes:          cfg.Cache.MaxTileBytes,
+		ResponseBudget:        cfg.HTTP.ResponseBudget,
+		UpstreamProtocol:      cfg.Upstream.Protocol,
+		MaxBufferBytes:        cfg.Upstream.MaxBodyBytes,
+		ClientDisconnectGrace: cfg.HTTP.ClientDisconnectGrace,
+		VariantCacheSize:      cfg.HTTP.QualityCacheSize,
+		Encoders:              encoders,
+		Budget: usecase.UpstreamBudgetConfig{
+			Daily:       cfg.Upstream.DailyBudget,
+			Monthly:     cfg.Upstream.MonthlyBudget,
+			DailyFile:   cfg.Upstream.DailyBudgetFile,
+			MonthlyFile: cfg.Upstream.MonthlyBudgetFile,
+		},
+		MaintenanceWindows: maintenanceWindows,
+		WeightedUpstream: usecase.WeightedUpstreamConfig{
+			Weights:          cfg.Upstream.Weights,
+			FailoverCooldown: cfg.Upstream.FailoverCooldown,
+		},
+		NeighborPrefetch: usecase.NeighborPrefetchConfig{
+			Enabled:     cfg.Prefetch.NeighborsEnabled,
+			Radius:      cfg.Prefetch.NeighborRadius,
+			MinInterval: cfg.Prefetch.NeighborMinInterval,
+			MaxPending:  cfg.Prefetch.NeighborMaxPending,
+		},
+		CacheCircuit: usecase.CacheCircuitConfig{
+			ParseErrorRate: cfg.Cache.ParseErrorRate,
+			Window:         cfg.Cache.ParseErrorWindow,
+			Cooldown:       cfg.Cache.ParseErrorCooldown,
+		},
+		SecondMiss: usecase.SecondMissConfig{
+			Window:   cfg.Cache.SecondMissWindow,
+			Capacity: cfg.Cache.SecondMissCapacity,
+		},
+		MaxZoom: usecase.MaxZoomConfig{
+			Native:      cfg.Upstream.MaxZoom,
+			Overzoom:    cfg.Upstream.Overzoom,
+			Placeholder: maxZoomPlaceholder,
+		},
+		RateLimit: usecase.UpstreamRateLimitConfig{
+			Rate:         cfg.Upstream.RateLimit,
+			Burst:        cfg.Upstream.RateLimitBurst,
+			MaxQueue:     cfg.Upstream.RateLimitQueue,
+			QueueTimeout: cfg.Upstream.RateLimitTimeout,
+		},
+		RetryBudget: usecase.RetryBudgetConfig{
+			Retries:    cfg.HTTP.RetryBudget,
+			Deadline:   cfg.HTTP.RetryDeadline,
+			Backoff:    cfg.HTTP.RetryBackoff,
+			MaxBackoff: cfg.HTTP.RetryMaxBackoff,
+			Jitter:     cfg.HTTP.RetryJitter,
+		},
+		SharedFetch: usecase.SharedFetchConfig{
+			MaxFetches: cfg.Upstream.MaxFetchesPerTile,
+			Wait:       cfg.Upstream.SharedFetchWait,
+		},
+		EarlyRefresh: usecase.EarlyRefreshConfig{
+			TTL:   cfg.Cache.EarlyRefreshTTL,
+			Delta: cfg.Cache.EarlyRefreshDelta,
+			Beta:  cfg.Cache.EarlyRefreshBeta,
+		},
+		StoreSource: cfg.Cache.StoreSource,
+		CacheLatency: usecase.CacheLatencyConfig{
+			Threshold: cfg.Cache.ProbeLatencyThreshold,
+			Samples:   cfg.Cache.ProbeLatencySamples,
+			Cooldown:  cfg.Cache.ProbeLatencyCooldown,
+		},
+	}, l)
+	if err != nil {
+		l.Fatal("failed to initialize tile usecase", "error", err)
+	}
+
+	// Background jobs are cancelled once the server shuts down
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+
+	prefetcher, err := usecase.NewPrefetcher(jobsCtx, tileUseCase, usecase.PrefetchConfig{
+		Workers:        cfg.Prefetch.Workers,
+		MinInterval:    cfg.Prefetch.MinInterval,
+		DailyBudget:    cfg.Prefetch.DailyBudget,
+		BudgetFile:     cfg.Prefetch.BudgetFile,
+		MaxTiles:       cfg.Prefetch.MaxTiles,
+		JobTTL:         cfg.Prefetch.JobTTL,
+		MaxRunningJobs: cfg.Prefetch.MaxRunningJobs,
+		JobStateFile:   cfg.Prefetch.JobStateFile,
+	}, l)
+	if err != nil {
+		l.Fatal("failed to initialize prefetcher", "error", err)
+	}
+
+	allowedRegions, err := tilemath.ParseBBoxes(cfg.Region.Allowed)
+	if err != nil {
+		l.Fatal("invalid allowed region", "error", err)
+	}
+	deniedRegions, err := tilemath.ParseBBoxes(cfg.Region.Denied)
+	if err != nil {
+		l.Fatal("invalid denied region", "error", err)
+	}
+
+	var healthChecks []handler.HealthCheck
+	for _, name := range cfg.HTTP.HealthChecks {
+		switch name {
+		case "cache":
+			healthChecks = append(healthChecks, handler.HealthCheck{Name: name, Check: tileUseCase.CheckCache})
+		case "upstream":
+			healthChecks = append(healthChecks, handler.HealthCheck{Name: name, Check: tileUseCase.CheckUpstream})
+		case "none":
+		default:
+			l.Fatal("unknown health check", "check", name)
+		}
+	}
 
 	// Initialize handler
-	h := handler.NewHandler(tileUseCase)
+	h := handler.NewHandler(tileUseCase, prefetcher, handler.Config{
+		BoundsHeaders:      cfg.HTTP.BoundsHeaders,
+		RequireImageAccept: cfg.HTTP.RequireImageAccept,
+		ServerTiming:       cfg.HTTP.ServerTiming,
+		AnonymousCacheOnly: cfg.Auth.AnonymousCacheOnly,
+		RedirectMisses:     cfg.HTTP.RedirectMisses,
+		Regions: handler.RegionPolicy{
+			Allowed: allowedRegions,
+			Denied:  deniedRegions,
+		},
+		HealthChecks: healthChecks,
+	})
 
 	// Initialize router
-	router := v1.NewRouter(h, l, cfg.Telemetry.Enabled)
+	router := v1.NewRouter(h, l, cfg.Telemetry.Enabled, cfg.Auth.APIKeys)
+	if err := v1.NormalizePaths(router, cfg.HTTP.Paths); err != nil {
+		l.Fatal("invalid path mode", "error", err)
+	}
+	root := v1.Root(v1.RootConfig{
+		Format:  cfg.HTTP.RootFormat,
+		Text:    cfg.HTTP.RootText,
+		Service: cfg.Telemetry.ServiceName,
+		Version: cfg.Telemetry.ServiceVersion,
+	})
+	router.GET("/", root)
+	router.HEAD("/", root)
+	if servePrometheus {
+		router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	}
 
 	// Initialize HTTP server
 	server := &http.Server{
@@ -73,6 +290,12 @@ func Run() {
 		IdleTimeout:  cfg.HTTP.Server.IdleTimeout,
 	}
 
+	// SIGHUP applies settings that do not need a restart
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go watchReload(jobsCtx, l, hup, config.Reload, cfg, reloadTargets{logger: l, rateLimit: tileUseCase, prefetcher: prefetcher})
+
 	// Start server
 	go func() {
 		l.Info("starting http server", "port", cfg.HTTP.Server.Port)
@@ -88,11 +311,16 @@ func Run() {
 
 	l.Info("shutting down server...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	drainHTTP(l, server, cfg.Shutdown.HTTPDrainTimeout)
 
-	if err := server.Shutdown(ctx); err != nil {
-		l.Fatal("server forced to shutdown", "error", err)
+	// Stop background jobs, then let queued cache stores finish
+	cancelJobs()
+	drainWorkers(l, func() {
+		prefetcher.Wait()
+		tileUseCase.WaitForStores()
+	}, cfg.Shutdown.WorkerDrainTimeout)
+	if err := tileUseCase.Close(); err != nil {
+		l.Error("failed to close cache connection", "error", err)
 	}
 
 	l.Info("server stopped")
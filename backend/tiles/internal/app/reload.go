@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/config"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+)
+
+// reloadTargets are the components whose settings can change at runtime.
+type reloadTargets struct {
+	logger     *logger.ZapLogger
+	rateLimit  rateLimitSetter
+	prefetcher intervalSetter
+}
+
+// rateLimitSetter is implemented by the tile use case.
+type rateLimitSetter interface {
+	SetUpstreamRateLimit(cfg usecase.UpstreamRateLimitConfig)
+}
+
+// intervalSetter is implemented by the prefetcher.
+type intervalSetter interface {
+	SetMinInterval(interval time.Duration)
+}
+
+// watchReload reloads the config on every signal until ctx is done. A config
+// that fails to load is logged and the current one stays in effect.
+func watchReload(ctx context.Context, l logger.Logger, signals <-chan os.Signal, load func() (*config.Config, error), current *config.Config, t reloadTargets) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			l.Info("reloading config", "signal", sig)
+			next, err := load()
+			if err != nil {
+				l.Error("failed to reload config, keeping the current one", "error", err)
+				continue
+			}
+			current = applyReload(l, current, next, t)
+		}
+	}
+}
+
+// applyReload applies the fields of next that can change without a restart
+// and returns the config now in effect. Other changes are logged and ignored.
+func applyReload(l logger.Logger, current, next *config.Config, t reloadTargets) *config.Config {
+	applied := *current
+
+	if next.Logger.Level != current.Logger.Level {
+		t.logger.SetLevel(next.Logger.Level)
+		applied.Logger.Level = next.Logger.Level
+		l.Info("log level reloaded", "from", current.Logger.Level, "to", next.Logger.Level)
+	}
+
+	if rateLimitConfig(next) != rateLimitConfig(current) {
+		t.rateLimit.SetUpstreamRateLimit(rateLimitConfig(next))
+		applied.Upstream.RateLimit = next.Upstream.RateLimit
+		applied.Upstream.RateLimitBurst = next.Upstream.RateLimitBurst
+		applied.Upstream.RateLimitQueue = next.Upstream.RateLimitQueue
+		applied.Upstream.RateLimitTimeout = next.Upstream.RateLimitTimeout
+		l.Info("upstream rate limit reloaded", "rate", next.Upstream.RateLimit, "burst", next.Upstream.RateLimitBurst,
+			"queue", next.Upstream.RateLimitQueue, "timeout", next.Upstream.RateLimitTimeout)
+	}
+
+	if next.Prefetch.MinInterval != current.Prefetch.MinInterval {
+		t.prefetcher.SetMinInterval(next.Prefetch.MinInterval)
+		applied.Prefetch.MinInterval = next.Prefetch.MinInterval
+		l.Info("prefetch interval reloaded", "from", current.Prefetch.MinInterval, "to", next.Prefetch.MinInterval)
+	}
+
+	if ignored := changedFields(reflect.ValueOf(applied), reflect.ValueOf(*next), ""); len(ignored) > 0 {
+		l.Warn("config changes require a restart, ignoring them", "fields", ignored)
+	}
+
+	return &applied
+}
+
+// rateLimitConfig returns the upstream rate limit set in cfg.
+func rateLimitConfig(cfg *config.Config) usecase.UpstreamRateLimitConfig {
+	return usecase.UpstreamRateLimitConfig{
+		Rate:         cfg.Upstream.RateLimit,
+		Burst:        cfg.Upstream.RateLimitBurst,
+		MaxQueue:     cfg.Upstream.RateLimitQueue,
+		QueueTimeout: cfg.Upstream.RateLimitTimeout,
+	}
+}
+
+// changedFields lists the dotted names of the leaf fields that differ
+// between two values of the same struct type. Values are not included so
+// secrets stay out of the logs.
+func changedFields(a, b reflect.Value, prefix string) []string {
+	if a.Kind() != reflect.Struct {
+		if reflect.DeepEqual(a.Interface(), b.Interface()) {
+			return nil
+		}
+		return []string{prefix}
+	}
+
+	var changed []string
+	for i := 0; i < a.NumField(); i++ {
+		name := a.Type().Field(i).Name
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		changed = append(changed, changedFields(a.Field(i), b.Field(i), name)...)
+	}
+	return changed
+}
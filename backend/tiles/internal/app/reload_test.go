@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/config"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+	"go.uber.org/zap/zapcore"
+)
+
+type recordingLogger struct {
+	lines []string
+}
+
+func (r *recordingLogger) record(msg string, keysAndValues ...any) {
+	r.lines = append(r.lines, fmt.Sprintf("%s %+v", msg, keysAndValues))
+}
+
+func (r *recordingLogger) Debug(msg string, kv ...any) { r.record(msg, kv...) }
+func (r *recordingLogger) Info(msg string, kv ...any)  { r.record(msg, kv...) }
+func (r *recordingLogger) Warn(msg string, kv ...any)  { r.record(msg, kv...) }
+func (r *recordingLogger) Error(msg string, kv ...any) { r.record(msg, kv...) }
+func (r *recordingLogger) Fatal(msg string, kv ...any) { r.record(msg, kv...) }
+
+type fakeReloadTarget struct {
+	rateLimits chan usecase.UpstreamRateLimitConfig
+	intervals  chan time.Duration
+}
+
+func (f *fakeReloadTarget) SetUpstreamRateLimit(cfg usecase.UpstreamRateLimitConfig) {
+	f.rateLimits <- cfg
+}
+
+func (f *fakeReloadTarget) SetMinInterval(interval time.Duration) {
+	f.intervals <- interval
+}
+
+func TestWatchReload_AppliesReloadableFields(t *testing.T) {
+	current := &config.Config{
+		Logger:   config.Logger{Level: "INFO"},
+		HTTP:     config.HTTP{Server: config.Server{Port: "8080"}},
+		Upstream: config.Upstream{RateLimit: 2, RateLimitBurst: 10},
+		Prefetch: config.Prefetch{MinInterval: time.Second},
+	}
+	zl := logger.NewZapLogger(current.Logger)
+
+	next := *current
+	next.Logger.Level = "DEBUG"
+	next.HTTP.Server.Port = "9090"
+	next.Upstream.RateLimit = 5
+	next.Prefetch.MinInterval = 200 * time.Millisecond
+
+	target := &fakeReloadTarget{
+		rateLimits: make(chan usecase.UpstreamRateLimitConfig, 1),
+		intervals:  make(chan time.Duration, 1),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	rec := &recordingLogger{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchReload(ctx, rec, signals, func() (*config.Config, error) { return &next, nil }, current,
+			reloadTargets{logger: zl, rateLimit: target, prefetcher: target})
+	}()
+
+	signals <- syscall.SIGHUP
+
+	select {
+	case got := <-target.rateLimits:
+		if got != (usecase.UpstreamRateLimitConfig{Rate: 5, Burst: 10}) {
+			t.Fatalf("unexpected rate limit: %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("rate limit not reloaded")
+	}
+	select {
+	case got := <-target.intervals:
+		if got != 200*time.Millisecond {
+			t.Fatalf("unexpected prefetch interval: %v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("prefetch interval not reloaded")
+	}
+
+	cancel()
+	<-done
+
+	if zl.Level() != zapcore.DebugLevel {
+		t.Fatalf("log level is still %s after reload", zl.Level())
+	}
+	logged := strings.Join(rec.lines, "\n")
+	if !strings.Contains(logged, "HTTP.Server.Port") {
+		t.Fatalf("expected the port change to be reported as needing a restart:\n%s", logged)
+	}
+	for _, field := range []string{"Logger.Level", "Upstream.RateLimit", "Prefetch.MinInterval"} {
+		if strings.Contains(logged, field) {
+			t.Fatalf("%s must not be reported as needing a restart:\n%s", field, logged)
+		}
+	}
+}
+
+func TestApplyReload_KeepsUnchangedSettings(t *testing.T) {
+	current := &config.Config{
+		Logger:   config.Logger{Level: "INFO"},
+		Upstream: config.Upstream{RateLimit: 2, RateLimitBurst: 10},
+		Prefetch: config.Prefetch{MinInterval: time.Second},
+	}
+	target := &fakeReloadTarget{
+		rateLimits: make(chan usecase.UpstreamRateLimitConfig, 1),
+		intervals:  make(chan time.Duration, 1),
+	}
+	next := *current
+	applyReload(&recordingLogger{}, current, &next, reloadTargets{logger: logger.NewZapLogger(current.Logger), rateLimit: target, prefetcher: target})
+
+	if len(target.rateLimits) != 0 || len(target.intervals) != 0 {
+		t.Fatal("expected unchanged settings left alone")
+	}
+}
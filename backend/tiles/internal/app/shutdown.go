@@ -0,0 +1,48 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+)
+
+// drainHTTP stops accepting new requests and waits up to timeout for
+// in-flight ones. Connections still open after that are closed forcibly.
+func drainHTTP(l logger.Logger, server *http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	l.Info("shutting down http server...", "address", server.Addr, "drain_timeout", timeout)
+	if err := server.Shutdown(ctx); err != nil {
+		l.Warn("http server did not drain in time, closing connections", "error", err)
+		if err := server.Close(); err != nil {
+			l.Error("failed to close http server", "error", err)
+		}
+		return
+	}
+	l.Info("http server stopped")
+}
+
+// drainWorkers waits up to timeout for wait to return and reports whether it
+// did. Workers still running after that are abandoned.
+func drainWorkers(l logger.Logger, wait func(), timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		l.Info("background workers stopped")
+		return true
+	case <-timer.C:
+		l.Warn("timeout waiting for background workers to finish", "drain_timeout", timeout)
+		return false
+	}
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+)
+
+// TileDiff compares the same tile between the providers given in the
+// "a" and "b" query parameters.
+func (h *Handler) TileDiff(c *gin.Context) {
+	log, _ := c.Get("logger")
+	l := log.(logger.Logger)
+
+	z, x, y, ok := parseTileParams(c, l)
+	if !ok {
+		return
+	}
+
+	providerA := c.Query("a")
+	providerB := c.Query("b")
+	if providerA == "" || providerB == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "providers a and b are required",
+		})
+		return
+	}
+
+	diff, err := h.tileUseCase.DiffTile(z, x, y, providerA, providerB)
+	if err != nil {
+		if errors.Is(err, usecase.ErrUnknownProvider) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		l.Error("failed to diff tile", "z", z, "x", x, "y", y, "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": "failed to compare tile",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
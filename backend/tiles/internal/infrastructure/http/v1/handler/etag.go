@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tileETag is a strong validator of the tile bytes served. It is derived
+// like the ETag the cache service stores with each tile, so tiles the cache
+// sent without one get the same ETag it would have, while reduced and
+// transcoded tiles get their own.
+func tileETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf(`"%x"`, sum[:8])
+}
+
+// serveTile responds with the tile and its ETag, or with 304 Not Modified
+// when If-None-Match lists the ETag, so clients keep unchanged tiles. etag
+// is the one the cache stored for data; the tile is hashed only when it is
+// empty.
+func serveTile(c *gin.Context, contentType string, data []byte, etag string) {
+	if etag == "" {
+		etag = tileETag(data)
+	}
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// etagMatches reports whether an If-None-Match header lists etag. Weak
+// validators match too, as If-None-Match uses weak comparison.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
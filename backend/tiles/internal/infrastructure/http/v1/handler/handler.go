@@ -1,22 +1,43 @@
 package handler
 
 import (
-	"net/http"
-
-	"github.com/gin-gonic/gin"
 	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
 )
 
+type Config struct {
+	// BoundsHeaders adds X-Tile-Bounds and X-Tile-Center to tile responses
+	BoundsHeaders bool
+	// RequireImageAccept rejects tile requests whose Accept header does not
+	// ask for an image, such as browsers opening a tile as a document
+	RequireImageAccept bool
+	// ServerTiming reports per-phase durations in a Server-Timing header
+	ServerTiming bool
+	// AnonymousCacheOnly serves requests without a valid API key from the
+	// cache only, leaving upstream fetches to authenticated clients
+	AnonymousCacheOnly bool
+	// RedirectMisses serves cache hits and redirects misses to the upstream
+	// tile server, so only tiles already cached cost bandwidth
+	RedirectMisses bool
+	// Regions answers 403 to tiles outside the served area
+	Regions RegionPolicy
+	// HealthChecks are the dependencies reported by Healthz
+	HealthChecks []HealthCheck
+}
+
+// AuthenticatedKey is set in the gin context for requests carrying a valid
+// API key.
+const AuthenticatedKey = "authenticated"
+
 type Handler struct {
 	tileUseCase *usecase.TileUseCase
+	prefetcher  *usecase.Prefetcher
+	cfg         Config
 }
 
-func NewHandler(uc *usecase.TileUseCase) *Handler {
+func NewHandler(uc *usecase.TileUseCase, prefetcher *usecase.Prefetcher, cfg Config) *Handler {
 	return &Handler{
 		tileUseCase: uc,
+		prefetcher:  prefetcher,
+		cfg:         cfg,
 	}
 }
-
-func (h *Handler) Healthz(c *gin.Context) {
-	c.String(http.StatusOK, "OK")
-}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+)
+
+// newTestRouter serves the tile and admin routes backed by an always-missing
+// cache and an upstream that answers every tile with upstreamBody. Paths of
+// tiles stored in the cache are sent on the returned channel.
+func newTestRouter(t *testing.T, cfg Config, upstreamBody []byte) (*gin.Engine, <-chan string) {
+	t.Helper()
+
+	stored := make(chan string, 100)
+	cacheSvc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+		case http.MethodPost:
+			if r.URL.Path == "/api/v1/cache/purge" {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"success":true,"data":{"removed":2}}`))
+				return
+			}
+			// Long jobs may store more tiles than the channel holds
+			select {
+			case stored <- r.URL.Path:
+			default:
+			}
+		}
+	}))
+	t.Cleanup(cacheSvc.Close)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(upstreamBody)
+	}))
+	t.Cleanup(upstream.Close)
+
+	l := logger.FromContext(context.Background())
+	uc, err := usecase.NewTileUseCase(usecase.TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.URL,
+		UpstreamTileURL: upstream.URL,
+	}, l)
+	if err != nil {
+		t.Fatalf("failed to create tile usecase: %v", err)
+	}
+	prefetcher, err := usecase.NewPrefetcher(context.Background(), uc, usecase.PrefetchConfig{Workers: 2}, l)
+	if err != nil {
+		t.Fatalf("failed to create prefetcher: %v", err)
+	}
+	h := NewHandler(uc, prefetcher, cfg)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("logger", l)
+		c.Next()
+	})
+	r.GET("/api/v1/tile/:z/:x/:y", h.Tile)
+	r.POST("/api/v1/admin/warm", h.Warm)
+	r.POST("/api/v1/admin/prefetch", h.Prefetch)
+	r.GET("/api/v1/admin/prefetch/:id", h.JobStatus)
+	r.POST("/api/v1/cache/seed", h.Seed)
+	r.GET("/api/v1/cache/seed/:id", h.JobStatus)
+	r.POST("/api/v1/cache/purge", h.PurgeCache)
+	r.GET("/api/v1/jobs/:id", h.JobStatus)
+	r.DELETE("/api/v1/jobs/:id", h.CancelJob)
+	return r, stored
+}
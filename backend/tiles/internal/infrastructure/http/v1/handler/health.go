@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// healthCheckTimeout bounds each dependency check so a hanging dependency
+// is reported as down instead of hanging the probe.
+const healthCheckTimeout = 2 * time.Second
+
+// HealthCheck is a dependency probed by Healthz.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type healthResponse struct {
+	// Status is "ok" when every check passed and "degraded" otherwise
+	Status string             `json:"status"`
+	Checks []dependencyHealth `json:"checks"`
+}
+
+type dependencyHealth struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Healthz runs the configured checks concurrently and answers 200 when all
+// of them pass, 503 otherwise.
+func (h *Handler) Healthz(c *gin.Context) {
+	resp := healthResponse{Status: "ok", Checks: make([]dependencyHealth, len(h.cfg.HealthChecks))}
+
+	var wg sync.WaitGroup
+	for i, check := range h.cfg.HealthChecks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp.Checks[i] = runHealthCheck(c.Request.Context(), check)
+		}()
+	}
+	wg.Wait()
+
+	code := http.StatusOK
+	for _, dep := range resp.Checks {
+		if dep.Status != "ok" {
+			resp.Status = "degraded"
+			code = http.StatusServiceUnavailable
+		}
+	}
+	c.JSON(code, resp)
+}
+
+func runHealthCheck(ctx context.Context, check HealthCheck) dependencyHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	dep := dependencyHealth{
+		Name:      check.Name,
+		Status:    "ok",
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		dep.Status = "down"
+		dep.Error = err.Error()
+	}
+	return dep
+}
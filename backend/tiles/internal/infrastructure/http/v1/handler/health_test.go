@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+)
+
+func TestHealthz_ListsDependencies(t *testing.T) {
+	cacheSvc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`"OK"`))
+	}))
+	defer cacheSvc.Close()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	uc, err := usecase.NewTileUseCase(usecase.TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.URL,
+		UpstreamTileURL: upstream.URL,
+	}, logger.FromContext(context.Background()))
+	if err != nil {
+		t.Fatalf("failed to create tile usecase: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		checks     []HealthCheck
+		wantCode   int
+		wantStatus string
+		wantDeps   map[string]string
+	}{
+		{
+			name:       "no checks",
+			wantCode:   http.StatusOK,
+			wantStatus: "ok",
+			wantDeps:   map[string]string{},
+		},
+		{
+			name:       "cache up",
+			checks:     []HealthCheck{{Name: "cache", Check: uc.CheckCache}},
+			wantCode:   http.StatusOK,
+			wantStatus: "ok",
+			wantDeps:   map[string]string{"cache": "ok"},
+		},
+		{
+			name: "upstream down",
+			checks: []HealthCheck{
+				{Name: "cache", Check: uc.CheckCache},
+				{Name: "upstream", Check: uc.CheckUpstream},
+			},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "degraded",
+			wantDeps:   map[string]string{"cache": "ok", "upstream": "down"},
+		},
+		{
+			name:       "failing check",
+			checks:     []HealthCheck{{Name: "disk", Check: func(context.Context) error { return errors.New("full") }}},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "degraded",
+			wantDeps:   map[string]string{"disk": "down"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(uc, nil, Config{HealthChecks: tt.checks})
+
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.GET("/api/v1/healthz", h.Healthz)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/healthz", nil))
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			var resp healthResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to parse response: %v", err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("expected status %q, got %q", tt.wantStatus, resp.Status)
+			}
+			if len(resp.Checks) != len(tt.wantDeps) {
+				t.Fatalf("expected %d checks, got %+v", len(tt.wantDeps), resp.Checks)
+			}
+			for _, dep := range resp.Checks {
+				if want := tt.wantDeps[dep.Name]; dep.Status != want {
+					t.Errorf("%s: expected status %q, got %q", dep.Name, want, dep.Status)
+				}
+				if dep.Status == "down" && dep.Error == "" {
+					t.Errorf("%s: expected an error for a failed check", dep.Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+)
+
+// CancelJob stops a queued or running job. The answer carries the status at
+// the time of the request; a running job reports cancelled once its
+// current work has wound down.
+func (h *Handler) CancelJob(c *gin.Context) {
+	log, _ := c.Get("logger")
+	l := log.(logger.Logger)
+
+	job, err := h.prefetcher.CancelJob(c.Param("id"))
+	switch {
+	case errors.Is(err, usecase.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	case errors.Is(err, usecase.ErrJobFinished):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+			"job":   job,
+		})
+		return
+	}
+
+	l.Info("job cancelled", "job", job.ID, "kind", job.Kind)
+	c.JSON(http.StatusAccepted, job)
+}
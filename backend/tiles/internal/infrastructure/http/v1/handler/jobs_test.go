@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
+)
+
+// startJob posts body to path and returns the job's status URL.
+func startJob(t *testing.T, r *gin.Engine, path, body string) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	return w.Header().Get("Location")
+}
+
+// pollJob fetches the job's status until it reaches state.
+func pollJob(t *testing.T, r *gin.Engine, location string, state usecase.JobState) usecase.JobStatus {
+	t.Helper()
+
+	var status usecase.JobStatus
+	deadline := time.Now().Add(5 * time.Second)
+	for status.State != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not reach %s, last status %+v", state, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, location, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+			t.Fatalf("failed to decode status: %v", err)
+		}
+	}
+	return status
+}
+
+func TestPurgeCache_RunsAsJob(t *testing.T) {
+	r, _ := newTestRouter(t, Config{}, []byte("png"))
+
+	// Zoom levels 1 and 2, the fake cache removes two tiles per level
+	location := startJob(t, r, "/api/v1/cache/purge", `{"bbox":{"west":-10,"south":-10,"east":10,"north":10},"minZoom":1,"maxZoom":2}`)
+	if !strings.HasPrefix(location, "/api/v1/jobs/") {
+		t.Fatalf("unexpected Location %q", location)
+	}
+
+	status := pollJob(t, r, location, usecase.JobDone)
+	if status.Kind != "purge" || status.Removed != 4 || status.Done != status.Total {
+		t.Fatalf("unexpected final status %+v", status)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	r, _ := newTestRouter(t, Config{}, []byte("png"))
+
+	// Far more tiles than the test could fetch
+	location := startJob(t, r, "/api/v1/cache/seed", `{"bbox":{"west":-180,"south":-85,"east":180,"north":85},"minZoom":0,"maxZoom":12}`)
+	jobURL := "/api/v1/jobs/" + strings.TrimPrefix(location, "/api/v1/cache/seed/")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, jobURL, nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	status := pollJob(t, r, jobURL, usecase.JobCancelled)
+	if status.Done >= status.Total || status.FinishedAt == nil {
+		t.Fatalf("unexpected cancelled status %+v", status)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, jobURL, nil))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("cancelling a finished job: expected 409, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/jobs/nope", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
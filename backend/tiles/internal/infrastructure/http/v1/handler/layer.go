@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+)
+
+type layerResponse struct {
+	Name        string `json:"name"`
+	Attribution string `json:"attribution,omitempty"`
+	// Tiles is the URL template of the layer's tiles on this service
+	Tiles string `json:"tiles"`
+}
+
+// Layers lists the named tile layers with the attribution clients must show
+// along with their tiles.
+func (h *Handler) Layers(c *gin.Context) {
+	layers := []layerResponse{}
+	for _, name := range h.tileUseCase.Layers() {
+		layer, _ := h.tileUseCase.Layer(name)
+		layers = append(layers, layerResponse{
+			Name:        name,
+			Attribution: layer.Attribution,
+			Tiles:       "/api/v1/tiles/" + name + "/{z}/{x}/{y}",
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"layers": layers})
+}
+
+// LayerTile serves a tile of a named layer in whatever format the layer's
+// upstream serves it. Layer tiles are not reduced in quality nor
+// transcoded.
+func (h *Handler) LayerTile(c *gin.Context) {
+	log, _ := c.Get("logger")
+	l := log.(logger.Logger)
+
+	if !h.acceptImage(c, nil) {
+		return
+	}
+
+	name := c.Param("layer")
+	if _, ok := h.tileUseCase.Layer(name); !ok {
+		respondTileError(c, l, usecase.ErrUnknownLayer)
+		return
+	}
+
+	z, x, y, ok := parseTileParams(c, l)
+	if !ok {
+		return
+	}
+
+	l.Info("layer tile request", "layer", name, "z", z, "x", x, "y", y)
+
+	tileData, info, ok := h.getTile(c, l, name, z, x, y)
+	if !ok {
+		return
+	}
+	serveTile(c, http.DetectContentType(tileData), tileData, info.ETag)
+}
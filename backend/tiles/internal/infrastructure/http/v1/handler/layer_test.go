@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+)
+
+// newLayerTestRouter serves the layer routes backed by an always-missing
+// cache and a cyclosm layer whose upstream answers with a JPEG.
+func newLayerTestRouter(t *testing.T, cfg Config) *gin.Engine {
+	t.Helper()
+
+	cacheSvc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(cacheSvc.Close)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("\xff\xd8\xff\xe0jpeg"))
+	}))
+	t.Cleanup(upstream.Close)
+
+	l := logger.FromContext(context.Background())
+	uc, err := usecase.NewTileUseCase(usecase.TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.URL,
+		UpstreamTileURL: upstream.URL,
+		Layers: map[string]usecase.LayerConfig{
+			"cyclosm": {URLTemplate: upstream.URL + "/cyclosm/{z}/{x}/{y}.jpg", Attribution: "© OpenStreetMap contributors, CyclOSM"},
+		},
+	}, l)
+	if err != nil {
+		t.Fatalf("failed to create tile usecase: %v", err)
+	}
+	t.Cleanup(uc.WaitForStores)
+	h := NewHandler(uc, nil, cfg)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("logger", l)
+		c.Next()
+	})
+	r.GET("/api/v1/tiles", h.Layers)
+	r.GET("/api/v1/tiles/:layer/:z/:x/:y", h.LayerTile)
+	return r
+}
+
+func TestLayerTile(t *testing.T) {
+	r := newLayerTestRouter(t, Config{})
+
+	tests := []struct {
+		path        string
+		want        int
+		contentType string
+	}{
+		{"/api/v1/tiles/cyclosm/5/10/12", http.StatusOK, "image/jpeg"},
+		{"/api/v1/tiles/satellite/5/10/12", http.StatusNotFound, "application/json; charset=utf-8"},
+		{"/api/v1/tiles/cyclosm/5/10/012", http.StatusBadRequest, "application/json; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.want || w.Header().Get("Content-Type") != tt.contentType {
+			t.Errorf("%s: got %d %q, want %d %q", tt.path, w.Code, w.Header().Get("Content-Type"), tt.want, tt.contentType)
+		}
+	}
+}
+
+func TestLayerTile_RequireImageAccept(t *testing.T) {
+	r := newLayerTestRouter(t, Config{RequireImageAccept: true})
+
+	for accept, want := range map[string]int{
+		"text/html,application/xhtml+xml,*/*;q=0.8": http.StatusNotAcceptable,
+		"image/avif,image/webp,*/*":                 http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/tiles/cyclosm/5/10/12", nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want || w.Header().Get("Vary") != "Accept" {
+			t.Errorf("Accept %q: got %d with Vary %q, want %d with Vary Accept", accept, w.Code, w.Header().Get("Vary"), want)
+		}
+	}
+}
+
+func TestLayers_ListsAttributions(t *testing.T) {
+	r := newLayerTestRouter(t, Config{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tiles", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	var body struct {
+		Layers []layerResponse `json:"layers"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	want := layerResponse{
+		Name:        "cyclosm",
+		Attribution: "© OpenStreetMap contributors, CyclOSM",
+		Tiles:       "/api/v1/tiles/cyclosm/{z}/{x}/{y}",
+	}
+	if len(body.Layers) != 1 || body.Layers[0] != want {
+		t.Fatalf("unexpected layers %+v", body.Layers)
+	}
+}
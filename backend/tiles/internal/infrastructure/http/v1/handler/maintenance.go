@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+)
+
+type maintenanceRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// Info reports the current operating mode of the service.
+func (h *Handler) Info(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"maintenance":               h.tileUseCase.Maintenance(),
+		"upstream_budget_exhausted": h.tileUseCase.UpstreamBudgetExhausted(),
+	})
+}
+
+// SetMaintenance turns maintenance mode on or off at runtime.
+func (h *Handler) SetMaintenance(c *gin.Context) {
+	log, _ := c.Get("logger")
+	l := log.(logger.Logger)
+
+	var req maintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request body",
+		})
+		return
+	}
+
+	h.tileUseCase.SetMaintenance(*req.Enabled)
+	l.Info("maintenance mode set", "enabled", *req.Enabled)
+
+	c.JSON(http.StatusOK, gin.H{
+		"maintenance": *req.Enabled,
+	})
+}
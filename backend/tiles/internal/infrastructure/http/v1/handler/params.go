@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+)
+
+// parseTileParams reads z/x/y from the route, responding with 400 and
+// returning ok=false when any of them is not a canonical coordinate.
+func parseTileParams(c *gin.Context, l logger.Logger) (z, x, y int, ok bool) {
+	strX := c.Param("x")
+	strY := c.Param("y")
+	strZ := c.Param("z")
+
+	x, err := tilemath.ParseCoord(strX)
+	if err != nil {
+		l.Warn("invalid x parameter", "x", strX, "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "x should be a non-negative integer without leading zeros",
+		})
+		return 0, 0, 0, false
+	}
+
+	y, err = tilemath.ParseCoord(strY)
+	if err != nil {
+		l.Warn("invalid y parameter", "y", strY, "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "y should be a non-negative integer without leading zeros",
+		})
+		return 0, 0, 0, false
+	}
+
+	z, err = tilemath.ParseCoord(strZ)
+	if err != nil {
+		l.Warn("invalid z parameter", "z", strZ, "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "z should be a non-negative integer without leading zeros",
+		})
+		return 0, 0, 0, false
+	}
+
+	return z, x, y, true
+}
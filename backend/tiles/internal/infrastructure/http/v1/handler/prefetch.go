@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/tilemath"
+)
+
+type prefetchRequest struct {
+	BBox    tilemath.BBox `json:"bbox"`
+	MinZoom int           `json:"min_zoom"`
+	MaxZoom int           `json:"max_zoom"`
+}
+
+// Prefetch starts warming the cache for a bounding box and zoom range.
+func (h *Handler) Prefetch(c *gin.Context) {
+	log, _ := c.Get("logger")
+	l := log.(logger.Logger)
+
+	var req prefetchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request body",
+		})
+		return
+	}
+
+	job, err := h.prefetcher.Start(usecase.PrefetchRequest{
+		BBox:    req.BBox,
+		MinZoom: req.MinZoom,
+		MaxZoom: req.MaxZoom,
+	})
+	if err != nil {
+		respondJobError(c, l, "prefetch", err)
+		return
+	}
+
+	l.Info("prefetch started", "job", job.ID, "tiles", job.Total, "min_zoom", req.MinZoom, "max_zoom", req.MaxZoom)
+	respondJobStarted(c, "/api/v1/admin/prefetch/", job)
+}
+
+// JobStatus reports the progress of a background job of any kind:
+// prefetch, warm, seed or purge.
+func (h *Handler) JobStatus(c *gin.Context) {
+	job, err := h.prefetcher.JobStatus(c.Param("id"))
+	if errors.Is(err, usecase.ErrJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// respondJobStarted answers with the ID to poll the job's status with under
+// statusPath.
+func respondJobStarted(c *gin.Context, statusPath string, job usecase.JobStatus) {
+	c.Header("Location", statusPath+job.ID)
+	c.JSON(http.StatusAccepted, gin.H{
+		"job_id": job.ID,
+		"tiles":  job.Total,
+	})
+}
+
+// respondJobError maps errors from starting a background fetch job.
+func respondJobError(c *gin.Context, l logger.Logger, job string, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrMaintenance):
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, usecase.ErrBudgetExhausted),
+		errors.Is(err, usecase.ErrUpstreamBudgetExhausted):
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, tilemath.ErrInvalidBBox),
+		errors.Is(err, usecase.ErrInvalidZoomRange),
+		errors.Is(err, usecase.ErrPrefetchTooLarge):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		l.Error("failed to start "+job, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to start " + job,
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
+)
+
+func TestPrefetch_StatusPollsToCompletion(t *testing.T) {
+	r, _ := newTestRouter(t, Config{}, []byte("png"))
+
+	// The four tiles of zoom level 1
+	body := strings.NewReader(`{"bbox":{"west":-10,"south":-10,"east":10,"north":10},"min_zoom":1,"max_zoom":1}`)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/admin/prefetch", body))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var started struct {
+		JobID string `json:"job_id"`
+		Tiles int    `json:"tiles"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &started); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if started.JobID == "" || started.Tiles != 4 {
+		t.Fatalf("unexpected response %s", w.Body.String())
+	}
+	if got := w.Header().Get("Location"); got != "/api/v1/admin/prefetch/"+started.JobID {
+		t.Fatalf("unexpected Location %q", got)
+	}
+
+	var status usecase.JobStatus
+	deadline := time.Now().Add(5 * time.Second)
+	for status.State != usecase.JobDone {
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not finish, last status %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/prefetch/"+started.JobID, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+			t.Fatalf("failed to decode status: %v", err)
+		}
+		if status.State == usecase.JobFailed {
+			t.Fatalf("job failed: %+v", status)
+		}
+	}
+
+	if status.Total != 4 || status.Done != 4 || status.Fetched != 4 || status.Failed != 0 {
+		t.Fatalf("unexpected final status %+v", status)
+	}
+	if status.FinishedAt == nil {
+		t.Fatal("finished job has no finish time")
+	}
+}
+
+func TestPrefetch_UnknownJob(t *testing.T) {
+	r, _ := newTestRouter(t, Config{}, []byte("png"))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/prefetch/nope", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,37 @@
+package handler
+
+import "github.com/jaennil/guide_helper/backend/tiles/pkg/tilemath"
+
+// RegionPolicy restricts serving to geographic areas, e.g. for licensing.
+// The zero value permits every tile.
+type RegionPolicy struct {
+	// Allowed boxes, if any, are the only areas whose tiles are served
+	Allowed []tilemath.BBox
+	// Denied boxes are never served, even where they overlap an allowed box
+	Denied []tilemath.BBox
+}
+
+// Permits reports whether the tile may be served. A tile counts as inside a
+// box as soon as it overlaps it, so tiles on the border of an allowed area
+// are served and those on the border of a denied area are not.
+func (p RegionPolicy) Permits(z, x, y int) bool {
+	if len(p.Allowed) == 0 && len(p.Denied) == 0 {
+		return true
+	}
+
+	tile := tilemath.TileToLatLonBounds(z, x, y).BBox()
+	for _, denied := range p.Denied {
+		if tile.Intersects(denied) {
+			return false
+		}
+	}
+	if len(p.Allowed) == 0 {
+		return true
+	}
+	for _, allowed := range p.Allowed {
+		if tile.Intersects(allowed) {
+			return true
+		}
+	}
+	return false
+}
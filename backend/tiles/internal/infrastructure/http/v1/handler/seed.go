@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/tilemath"
+)
+
+// regionJobRequest selects the tiles of a seed or purge job.
+type regionJobRequest struct {
+	BBox    tilemath.BBox `json:"bbox"`
+	MinZoom *int          `json:"minZoom"`
+	MaxZoom *int          `json:"maxZoom"`
+}
+
+// Seed preloads the cache with every tile of a bounding box and zoom range,
+// fetching the missing ones from upstream at the prefetch pace. Large
+// regions take hours, so the job runs in the background and its progress
+// is polled at the returned Location.
+func (h *Handler) Seed(c *gin.Context) {
+	log, _ := c.Get("logger")
+	l := log.(logger.Logger)
+
+	req, ok := bindRegionJob(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.prefetcher.StartSeed(req)
+	if err != nil {
+		respondJobError(c, l, "seed", err)
+		return
+	}
+
+	l.Info("seed started", "job", job.ID, "tiles", job.Total, "min_zoom", req.MinZoom, "max_zoom", req.MaxZoom)
+	respondJobStarted(c, "/api/v1/cache/seed/", job)
+}
+
+// PurgeCache removes the cached tiles of a bounding box and zoom range in a
+// background job, polled and cancelled under /api/v1/jobs.
+func (h *Handler) PurgeCache(c *gin.Context) {
+	log, _ := c.Get("logger")
+	l := log.(logger.Logger)
+
+	req, ok := bindRegionJob(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.prefetcher.StartPurge(req)
+	if err != nil {
+		respondJobError(c, l, "purge", err)
+		return
+	}
+
+	l.Info("purge started", "job", job.ID, "tiles", job.Total, "min_zoom", req.MinZoom, "max_zoom", req.MaxZoom)
+	respondJobStarted(c, "/api/v1/jobs/", job)
+}
+
+// bindRegionJob reads a regionJobRequest, answering 400 if it is incomplete.
+func bindRegionJob(c *gin.Context) (usecase.PrefetchRequest, bool) {
+	var req regionJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.MinZoom == nil || req.MaxZoom == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "request body should be {bbox, minZoom, maxZoom}",
+		})
+		return usecase.PrefetchRequest{}, false
+	}
+	return usecase.PrefetchRequest{
+		BBox:    req.BBox,
+		MinZoom: *req.MinZoom,
+		MaxZoom: *req.MaxZoom,
+	}, true
+}
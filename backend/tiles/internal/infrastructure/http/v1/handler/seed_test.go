@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
+)
+
+func TestSeed_StoresTilesAndReportsProgress(t *testing.T) {
+	r, stored := newTestRouter(t, Config{}, []byte("png"))
+
+	// The four tiles of zoom level 1
+	body := strings.NewReader(`{"bbox":{"west":-10,"south":-10,"east":10,"north":10},"minZoom":1,"maxZoom":1}`)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/cache/seed", body))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var started struct {
+		JobID string `json:"job_id"`
+		Tiles int    `json:"tiles"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &started); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	location := w.Header().Get("Location")
+	if started.Tiles != 4 || location != "/api/v1/cache/seed/"+started.JobID {
+		t.Fatalf("unexpected response %s with Location %q", w.Body.String(), location)
+	}
+
+	var status usecase.JobStatus
+	deadline := time.Now().Add(5 * time.Second)
+	for status.State != usecase.JobDone {
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not finish, last status %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, location, nil))
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+			t.Fatalf("failed to decode status: %v", err)
+		}
+		if status.State == usecase.JobFailed {
+			t.Fatalf("job failed: %+v", status)
+		}
+	}
+	if status.Kind != "seed" || status.Fetched != 4 {
+		t.Fatalf("unexpected final status %+v", status)
+	}
+	if len(stored) != 4 {
+		t.Fatalf("stored %d tiles in the cache, want 4", len(stored))
+	}
+}
+
+func TestSeed_RejectsInvalidRequests(t *testing.T) {
+	r, _ := newTestRouter(t, Config{}, []byte("png"))
+
+	for _, body := range []string{
+		`{"bbox":{"west":-10,"south":-10,"east":10,"north":10},"maxZoom":1}`,
+		`{"bbox":{"west":-10,"south":-10,"east":10,"north":10},"minZoom":3,"maxZoom":1}`,
+		`{"bbox":{"west":10,"south":-10,"east":-10,"north":10},"minZoom":1,"maxZoom":1}`,
+		`not json`,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/cache/seed", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
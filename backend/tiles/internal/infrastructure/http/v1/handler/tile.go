@@ -1,60 +1,279 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
 	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/tilemath"
 )
 
 func (h *Handler) Tile(c *gin.Context) {
 	log, _ := c.Get("logger")
 	l := log.(logger.Logger)
 
-	strX := c.Param("x")
-	strY := c.Param("y")
-	strZ := c.Param("z")
-
-	x, err := strconv.Atoi(strX)
-	if err != nil {
-		l.Warn("invalid x parameter", "x", strX, "error", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "x should be integer",
-		})
+	formats := h.tileUseCase.Formats()
+	if !h.acceptImage(c, formats) {
 		return
 	}
 
-	y, err := strconv.Atoi(strY)
-	if err != nil {
-		l.Warn("invalid y parameter", "y", strY, "error", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "y should be integer",
-		})
+	z, x, y, ok := parseTileParams(c, l)
+	if !ok {
 		return
 	}
 
-	z, err := strconv.Atoi(strZ)
+	quality, err := usecase.ParseQuality(c.Query("q"))
 	if err != nil {
-		l.Warn("invalid z parameter", "z", strZ, "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "z should be integer",
+			"error": err.Error(),
 		})
 		return
 	}
 
 	l.Info("tile request", "z", z, "x", x, "y", y)
 
-	tileData, err := h.tileUseCase.GetTile(z, x, y)
+	tileData, info, ok := h.getTile(c, l, "", z, x, y)
+	if !ok {
+		return
+	}
+	encodeStart := time.Now()
+
+	// The cache's ETag only describes the tile as it holds it
+	etag := info.ETag
+	if quality != usecase.QualityOriginal {
+		etag = ""
+	}
+	tileData, contentType := h.tileUseCase.Reduce(z, x, y, quality, tileData)
+	if format := negotiateFormat(c.GetHeader("Accept"), formats); quality == usecase.QualityOriginal && format != "" {
+		tileData, contentType = h.tileUseCase.Transcode(z, x, y, format, tileData)
+		etag = ""
+	}
+	if h.cfg.ServerTiming {
+		c.Header("Server-Timing", serverTiming(info.Timings, time.Since(encodeStart)))
+	}
+	serveTile(c, contentType, tileData, etag)
+}
+
+// acceptImage sets Vary: Accept when the response depends on it, as it does
+// with formats to transcode to, and answers 406 to requests that do not
+// accept images. It reports whether the request may go on.
+func (h *Handler) acceptImage(c *gin.Context, formats []usecase.Format) bool {
+	// Shared caches must not answer a request with the response to another
+	// Accept
+	if h.cfg.RequireImageAccept || len(formats) > 0 {
+		c.Header("Vary", "Accept")
+	}
+	if h.cfg.RequireImageAccept && !acceptsImage(c.GetHeader("Accept")) {
+		c.JSON(http.StatusNotAcceptable, gin.H{
+			"error": "tiles are served as images, set Accept to image/* or */*",
+		})
+		return false
+	}
+	return true
+}
+
+// getTile gets the tile of a layer, empty for the default one, from the
+// cache alone for requests that may not reach upstream, and sets the
+// headers every tile response carries. When the tile cannot be served it
+// answers the request and reports false.
+func (h *Handler) getTile(c *gin.Context, l logger.Logger, layer string, z, x, y int) ([]byte, usecase.TileInfo, bool) {
+	if !h.cfg.Regions.Permits(z, x, y) {
+		l.Debug("tile outside the served region", "layer", layer, "z", z, "x", x, "y", y)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "tile is outside the served region",
+		})
+		return nil, usecase.TileInfo{}, false
+	}
+
+	var (
+		tileData []byte
+		info     usecase.TileInfo
+		err      error
+	)
+	cacheOnly := h.cfg.RedirectMisses || (h.cfg.AnonymousCacheOnly && !c.GetBool(AuthenticatedKey))
+	switch {
+	case layer == "" && cacheOnly:
+		tileData, info, err = h.tileUseCase.GetTileFromCache(z, x, y)
+	case layer == "":
+		tileData, info, err = h.tileUseCase.GetTileTimed(c.Request.Context(), z, x, y)
+	case cacheOnly:
+		tileData, info, err = h.tileUseCase.GetLayerTileFromCache(layer, z, x, y)
+	default:
+		tileData, info, err = h.tileUseCase.GetLayerTileTimed(c.Request.Context(), layer, z, x, y)
+	}
+	if errors.Is(err, context.Canceled) && c.Request.Context().Err() != nil {
+		l.Debug("client disconnected before the tile was served", "layer", layer, "z", z, "x", x, "y", y)
+		return nil, info, false
+	}
+	if errors.Is(err, usecase.ErrNotCached) && h.cfg.RedirectMisses {
+		upstreamURL := h.tileUseCase.UpstreamURL(z, x, y)
+		if layer != "" {
+			upstreamURL = h.tileUseCase.LayerUpstreamURL(layer, z, x, y)
+		}
+		c.Redirect(http.StatusFound, upstreamURL)
+		return nil, info, false
+	}
+	if errors.Is(err, usecase.ErrNotCached) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "tile not cached, an api key is required to fetch it from upstream",
+		})
+		return nil, info, false
+	}
 	if err != nil {
-		l.Error("failed to get tile", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to get tile",
+		respondTileError(c, l, err)
+		return nil, info, false
+	}
+
+	if h.cfg.BoundsHeaders {
+		setBoundsHeaders(c, z, x, y)
+	}
+	// 24h browser cache, revalidated with the tile's ETag
+	c.Header("Cache-Control", "public, max-age=86400")
+	return tileData, info, true
+}
+
+// respondTileError answers a request for a tile that could not be served
+// with the status matching err.
+func respondTileError(c *gin.Context, l logger.Logger, err error) {
+	if errors.Is(err, usecase.ErrUnknownLayer) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "unknown tile layer",
 		})
 		return
 	}
+	if errors.Is(err, usecase.ErrBeyondMaxZoom) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "tile is beyond the provider's max zoom",
+		})
+		return
+	}
+	if errors.Is(err, usecase.ErrTileNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "tile does not exist upstream",
+		})
+		return
+	}
+	if errors.Is(err, usecase.ErrMaintenance) || errors.Is(err, usecase.ErrUpstreamBudgetExhausted) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "tile not cached and upstream is unavailable: " + err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, usecase.ErrResponseBudgetExceeded) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error": "tile not available within the response budget",
+		})
+		return
+	}
+	if errors.Is(err, usecase.ErrUpstreamBodyTooLarge) {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": "upstream response too large",
+		})
+		return
+	}
+	if errors.Is(err, usecase.ErrUnexpectedContentType) {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": "upstream served an unexpected content type",
+		})
+		return
+	}
+	if errors.Is(err, usecase.ErrUpstreamThrottled) {
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "tile not cached and upstream is rate limited",
+		})
+		return
+	}
+	l.Error("failed to get tile", "error", err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": "failed to get tile",
+	})
+}
 
-	// Return PNG image with cache headers (24h browser cache)
-	c.Header("Cache-Control", "public, max-age=86400")
-	c.Data(http.StatusOK, "image/png", tileData)
+// setBoundsHeaders describes the tile extent as "north,south,east,west" and
+// its center as "lat,lon", in degrees.
+func setBoundsHeaders(c *gin.Context, z, x, y int) {
+	b := tilemath.TileToLatLonBounds(z, x, y)
+	lat, lon := b.Center()
+
+	c.Header("X-Tile-Bounds", strings.Join([]string{
+		formatDegrees(b.North),
+		formatDegrees(b.South),
+		formatDegrees(b.East),
+		formatDegrees(b.West),
+	}, ","))
+	c.Header("X-Tile-Center", formatDegrees(lat)+","+formatDegrees(lon))
+}
+
+// serverTiming formats the phases of a tile request as a Server-Timing
+// header value with durations in milliseconds.
+func serverTiming(t usecase.Timings, encode time.Duration) string {
+	metric := func(name string, d time.Duration) string {
+		return name + ";dur=" + strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+	}
+
+	parts := []string{metric("cache", t.CacheProbe)}
+	if t.UpstreamFetch > 0 {
+		parts = append(parts, metric("upstream", t.UpstreamFetch))
+	}
+	parts = append(parts, metric("encode", encode))
+	return strings.Join(parts, ", ")
+}
+
+func formatDegrees(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// acceptsImage reports whether an Accept header allows an image response.
+// Headers listing text/html are refused since those come from documents.
+func acceptsImage(accept string) bool {
+	image := false
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if refusedByQuality(params) {
+			continue
+		}
+
+		switch {
+		case mediaType == "text/html":
+			return false
+		case mediaType == "*/*", strings.HasPrefix(mediaType, "image/"):
+			image = true
+		}
+	}
+	return image
+}
+
+// negotiateFormat picks the first of formats, the most compact first, that
+// the Accept header lists by name. Wildcards do not count, browsers send
+// them along with formats they cannot decode. Empty serves the tile as is.
+func negotiateFormat(accept string, formats []usecase.Format) usecase.Format {
+	for _, format := range formats {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, _ := strings.Cut(part, ";")
+			if strings.EqualFold(strings.TrimSpace(mediaType), format.ContentType()) && !refusedByQuality(params) {
+				return format
+			}
+		}
+	}
+	return ""
+}
+
+// refusedByQuality reports whether media type parameters carry q=0.
+func refusedByQuality(params string) bool {
+	for _, param := range strings.Split(params, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if strings.EqualFold(key, "q") {
+			q, err := strconv.ParseFloat(value, 64)
+			return err == nil && q == 0
+		}
+	}
+	return false
 }
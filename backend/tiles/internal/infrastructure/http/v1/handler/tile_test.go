@@ -0,0 +1,409 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/tilemath"
+)
+
+func TestTile_BoundsHeaders(t *testing.T) {
+	r, _ := newTestRouter(t, Config{BoundsHeaders: true}, []byte("png"))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/10/619/320", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	parts := strings.Split(w.Header().Get("X-Tile-Bounds"), ",")
+	if len(parts) != 4 {
+		t.Fatalf("unexpected bounds header %q", w.Header().Get("X-Tile-Bounds"))
+	}
+	var got [4]float64
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			t.Fatalf("bounds value %q is not a number: %v", p, err)
+		}
+		got[i] = v
+	}
+
+	want := tilemath.TileToLatLonBounds(10, 619, 320)
+	if got != [4]float64{want.North, want.South, want.East, want.West} {
+		t.Fatalf("bounds %v do not match %+v", got, want)
+	}
+
+	lat, lon := want.Center()
+	if center := w.Header().Get("X-Tile-Center"); center != formatDegrees(lat)+","+formatDegrees(lon) {
+		t.Fatalf("unexpected center header %q", center)
+	}
+}
+
+func TestTile_NoBoundsHeadersByDefault(t *testing.T) {
+	r, _ := newTestRouter(t, Config{}, []byte("png"))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/10/619/320", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if w.Header().Get("X-Tile-Bounds") != "" || w.Header().Get("X-Tile-Center") != "" {
+		t.Fatal("bounds headers should be off by default")
+	}
+}
+
+func TestTile_RequireImageAccept(t *testing.T) {
+	tests := []struct {
+		name    string
+		require bool
+		accept  string
+		want    int
+	}{
+		{"html rejected when required", true, "text/html", http.StatusNotAcceptable},
+		{"html accepted when not required", false, "text/html", http.StatusOK},
+		{"browser navigation rejected", true, "text/html,application/xhtml+xml,*/*;q=0.8", http.StatusNotAcceptable},
+		{"img element accepted", true, "image/avif,image/webp,image/*,*/*;q=0.8", http.StatusOK},
+		{"wildcard accepted", true, "*/*", http.StatusOK},
+		{"missing header rejected", true, "", http.StatusNotAcceptable},
+		{"images refused by quality", true, "image/*;q=0", http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestRouter(t, Config{RequireImageAccept: tt.require}, []byte("png"))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/tile/10/619/320", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestTile_VaryAccept(t *testing.T) {
+	for _, require := range []bool{true, false} {
+		r, _ := newTestRouter(t, Config{RequireImageAccept: require}, []byte("png"))
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/tile/10/619/320", nil)
+		req.Header.Set("Accept", "image/*")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		want := ""
+		if require {
+			want = "Accept"
+		}
+		if got := w.Header().Get("Vary"); got != want {
+			t.Fatalf("RequireImageAccept %v: expected Vary %q, got %q", require, want, got)
+		}
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	formats := []usecase.Format{usecase.FormatAVIF, usecase.FormatWebP}
+	tests := []struct {
+		accept string
+		want   usecase.Format
+	}{
+		{"image/avif,image/webp,image/apng,image/*,*/*;q=0.8", usecase.FormatAVIF},
+		{"image/webp,*/*", usecase.FormatWebP},
+		{"image/avif;q=0,image/webp", usecase.FormatWebP},
+		{"image/*,*/*", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateFormat(tt.accept, formats); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+	if got := negotiateFormat("image/avif", nil); got != "" {
+		t.Errorf("negotiated %q without encoders", got)
+	}
+}
+
+func TestTile_ETag(t *testing.T) {
+	r, _ := newTestRouter(t, Config{}, []byte("png"))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/10/619/320", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	// The cache service stores the same ETag with the tile
+	sum := sha256.Sum256([]byte("png"))
+	etag := fmt.Sprintf(`"%x"`, sum[:8])
+	if got := w.Header().Get("ETag"); got != etag {
+		t.Fatalf("expected ETag %s, got %q", etag, got)
+	}
+
+	tests := []struct {
+		ifNoneMatch string
+		want        int
+	}{
+		{etag, http.StatusNotModified},
+		{`"other", W/` + etag, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+		{`"other"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/tile/10/619/320", nil)
+		req.Header.Set("If-None-Match", tt.ifNoneMatch)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("If-None-Match %s: expected %d, got %d", tt.ifNoneMatch, tt.want, w.Code)
+		}
+		if w.Header().Get("ETag") != etag {
+			t.Errorf("If-None-Match %s: expected ETag %s, got %q", tt.ifNoneMatch, etag, w.Header().Get("ETag"))
+		}
+		if tt.want == http.StatusNotModified && w.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: 304 with a %d byte body", tt.ifNoneMatch, w.Body.Len())
+		}
+	}
+}
+
+func TestTile_ReusesCachedETag(t *testing.T) {
+	const etag = `"stored"`
+	cacheSvc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/tile/10/619/320/raw" {
+			w.Header().Set("ETag", etag)
+			w.Write([]byte("png"))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(cacheSvc.Close)
+
+	l := logger.FromContext(context.Background())
+	uc, err := usecase.NewTileUseCase(usecase.TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.URL,
+		UpstreamTileURL: "https://tile.example.org",
+	}, l)
+	if err != nil {
+		t.Fatalf("failed to create tile usecase: %v", err)
+	}
+	h := NewHandler(uc, nil, Config{})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("logger", l)
+		c.Next()
+	})
+	r.GET("/api/v1/tile/:z/:x/:y", h.Tile)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/10/619/320", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("ETag"); got != etag {
+		t.Fatalf("expected the cache's ETag %s, got %q", etag, got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/tile/10/619/320", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for the cache's ETag, got %d", w.Code)
+	}
+
+	// A reduced tile is not the one the cache's ETag describes
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/10/619/320?q=low", nil))
+	if got := w.Header().Get("ETag"); got == etag || got == "" {
+		t.Fatalf("expected a hashed ETag for q=low, got %q", got)
+	}
+}
+
+func TestTile_ServerTiming(t *testing.T) {
+	r, _ := newTestRouter(t, Config{ServerTiming: true}, []byte("png"))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/10/619/320", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	header := w.Header().Get("Server-Timing")
+	durations := map[string]float64{}
+	for _, metric := range strings.Split(header, ",") {
+		name, dur, ok := strings.Cut(strings.TrimSpace(metric), ";dur=")
+		if !ok {
+			t.Fatalf("metric %q in %q has no duration", metric, header)
+		}
+		v, err := strconv.ParseFloat(dur, 64)
+		if err != nil {
+			t.Fatalf("duration %q is not a number: %v", dur, err)
+		}
+		durations[name] = v
+	}
+
+	// The cache misses, so every phase runs
+	for _, phase := range []string{"cache", "upstream", "encode"} {
+		d, ok := durations[phase]
+		if !ok {
+			t.Fatalf("missing %s phase in %q", phase, header)
+		}
+		if d < 0 || d > 5000 {
+			t.Fatalf("implausible %s duration %vms", phase, d)
+		}
+	}
+	if durations["upstream"] == 0 {
+		t.Fatalf("expected a non-zero upstream duration in %q", header)
+	}
+}
+
+func TestTile_ServerTimingDisabled(t *testing.T) {
+	r, _ := newTestRouter(t, Config{}, []byte("png"))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/10/619/320", nil))
+	if got := w.Header().Get("Server-Timing"); got != "" {
+		t.Fatalf("expected no Server-Timing header, got %q", got)
+	}
+}
+
+func TestTile_RegionPolicy(t *testing.T) {
+	moscow := tilemath.BBox{West: 37.3, South: 55.5, East: 37.9, North: 55.9}
+	kremlin := tilemath.BBox{West: 37.61, South: 55.749, East: 37.62, North: 55.753}
+
+	inside := tilemath.LatLonToTile(55.70, 37.50, 14)
+	outside := tilemath.LatLonToTile(48.85, 2.35, 14)
+	denied := tilemath.LatLonToTile(55.751, 37.617, 14)
+
+	r, _ := newTestRouter(t, Config{Regions: RegionPolicy{
+		Allowed: []tilemath.BBox{moscow},
+		Denied:  []tilemath.BBox{kremlin},
+	}}, []byte("png"))
+
+	tests := []struct {
+		name string
+		tile tilemath.Tile
+		want int
+	}{
+		{name: "inside allowed box", tile: inside, want: http.StatusOK},
+		{name: "outside allowed box", tile: outside, want: http.StatusForbidden},
+		{name: "inside denied box", tile: denied, want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/api/v1/tile/" + strconv.Itoa(tt.tile.Z) + "/" + strconv.Itoa(tt.tile.X) + "/" + strconv.Itoa(tt.tile.Y)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTile_QualityParameter(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	seed := uint32(1)
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			seed = seed*1664525 + 1013904223
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(seed >> 24), A: 255})
+		}
+	}
+	var original bytes.Buffer
+	if err := png.Encode(&original, img); err != nil {
+		t.Fatalf("failed to encode test tile: %v", err)
+	}
+
+	r, _ := newTestRouter(t, Config{}, original.Bytes())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/10/619/320", nil))
+	if w.Code != http.StatusOK || w.Body.Len() != original.Len() {
+		t.Fatalf("expected the original tile, got %d with %d bytes", w.Code, w.Body.Len())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/10/619/320?q=low", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if w.Body.Len() >= original.Len() {
+		t.Fatalf("q=low served %d bytes, original has %d", w.Body.Len(), original.Len())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/jpeg" {
+		t.Fatalf("expected image/jpeg, got %s", ct)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/10/619/320?q=best", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown quality, got %d", w.Code)
+	}
+}
+
+func TestTile_RedirectMisses(t *testing.T) {
+	cacheSvc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/tile/5/10/12/raw" {
+			w.Write([]byte("png"))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(cacheSvc.Close)
+
+	l := logger.FromContext(context.Background())
+	uc, err := usecase.NewTileUseCase(usecase.TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.URL,
+		UpstreamTileURL: "https://tile.example.org",
+	}, l)
+	if err != nil {
+		t.Fatalf("failed to create tile usecase: %v", err)
+	}
+	h := NewHandler(uc, nil, Config{RedirectMisses: true})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("logger", l)
+		c.Next()
+	})
+	r.GET("/api/v1/tile/:z/:x/:y", h.Tile)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/5/10/13", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("miss: expected 302, got %d", w.Code)
+	}
+	if got, want := w.Header().Get("Location"), "https://tile.example.org/5/10/13.png"; got != want {
+		t.Fatalf("Location = %q, want %q", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tile/5/10/12", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "png" {
+		t.Fatalf("hit: expected 200 with the cached tile, got %d %q", w.Code, w.Body.String())
+	}
+}
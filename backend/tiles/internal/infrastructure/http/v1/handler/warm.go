@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/tilemath"
+)
+
+// maxWarmBodySize bounds uploaded coordinate lists and access logs
+const maxWarmBodySize = 16 << 20
+
+// Warm re-fetches the tiles listed in the request body, one z/x/y per line,
+// to rebuild a warm cache after a flush or restart.
+func (h *Handler) Warm(c *gin.Context) {
+	log, _ := c.Get("logger")
+	l := log.(logger.Logger)
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxWarmBodySize)
+	tiles, err := tilemath.ParseTileList(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "failed to read tile list",
+		})
+		return
+	}
+	if len(tiles) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "no tile coordinates found",
+		})
+		return
+	}
+
+	job, err := h.prefetcher.StartWarm(tiles)
+	if err != nil {
+		respondJobError(c, l, "warm", err)
+		return
+	}
+
+	l.Info("warm started", "job", job.ID, "tiles", job.Total)
+	respondJobStarted(c, "/api/v1/admin/prefetch/", job)
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWarm_CachesListedTiles(t *testing.T) {
+	r, stored := newTestRouter(t, Config{}, []byte("png"))
+
+	body := strings.NewReader(`12/2048/1361
+10.0.0.1 - - "GET /api/v1/tile/10/619/320 HTTP/1.1" 200 1234
+12/2048/1361
+`)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/admin/warm", body))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"tiles":2`) {
+		t.Fatalf("unexpected response %s", w.Body.String())
+	}
+
+	var paths []string
+	for len(paths) < 2 {
+		select {
+		case p := <-stored:
+			paths = append(paths, p)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %v were cached", paths)
+		}
+	}
+	sort.Strings(paths)
+	want := []string{"/api/v1/tile/10/619/320", "/api/v1/tile/12/2048/1361"}
+	if paths[0] != want[0] || paths[1] != want[1] {
+		t.Fatalf("cached %v, want %v", paths, want)
+	}
+}
+
+func TestWarm_RejectsEmptyList(t *testing.T) {
+	r, _ := newTestRouter(t, Config{}, []byte("png"))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/admin/warm", strings.NewReader("nothing here\n")))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
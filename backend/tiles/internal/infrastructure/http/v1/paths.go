@@ -0,0 +1,62 @@
+package v1
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Path modes decide what happens to a request whose path only matches a
+// route once a trailing slash is removed or its case is fixed, such as
+// /api/v1/tile/5/10/12/ or /API/v1/tile/5/10/12.
+const (
+	// PathsRedirect redirects to the route's path, 301 for GET and 307
+	// otherwise. It is gin's behaviour for trailing slashes, extended to case.
+	PathsRedirect = "redirect"
+	// PathsMatch serves the route directly, for clients that do not follow
+	// redirects. Paths that differ only in case are matched lowercased,
+	// parameters included.
+	PathsMatch = "match"
+	// PathsStrict answers 404 to anything but the exact path
+	PathsStrict = "strict"
+)
+
+// NormalizePaths applies the path mode to the router. It must be called
+// before the router serves requests.
+func NormalizePaths(r *gin.Engine, mode string) error {
+	switch mode {
+	case PathsRedirect:
+		r.RedirectTrailingSlash = true
+		r.RedirectFixedPath = true
+	case PathsMatch:
+		r.RedirectTrailingSlash = false
+		r.RedirectFixedPath = false
+		r.NoRoute(func(c *gin.Context) {
+			path := normalizePath(c.Request.URL.Path)
+			if path == c.Request.URL.Path {
+				return
+			}
+			c.Request.URL.Path = path
+			c.Request.URL.RawPath = ""
+			r.HandleContext(c)
+		})
+	case PathsStrict:
+		r.RedirectTrailingSlash = false
+		r.RedirectFixedPath = false
+	default:
+		return fmt.Errorf("unknown path mode %q, expected redirect, match or strict", mode)
+	}
+	return nil
+}
+
+// normalizePath lowercases the path and removes trailing slashes, which
+// routes never have. normalizePath of its result returns it unchanged, so a
+// normalized path that still matches nothing ends in a 404.
+func normalizePath(path string) string {
+	path = strings.ToLower(path)
+	if trimmed := strings.TrimRight(path, "/"); trimmed != "" {
+		return trimmed
+	}
+	return "/"
+}
@@ -0,0 +1,61 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/tiles/internal/infrastructure/http/v1/handler"
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+)
+
+func TestNormalizePaths(t *testing.T) {
+	tests := []struct {
+		mode     string
+		method   string
+		path     string
+		want     int
+		location string
+	}{
+		{PathsRedirect, http.MethodGet, "/api/v1/tile/5/10/12/", http.StatusMovedPermanently, "/api/v1/tile/5/10/12"},
+		{PathsRedirect, http.MethodGet, "/API/v1/Tile/5/10/12", http.StatusMovedPermanently, "/api/v1/tile/5/10/12"},
+		{PathsMatch, http.MethodOptions, "/api/v1/tile/5/10/12/", http.StatusNoContent, ""},
+		{PathsMatch, http.MethodOptions, "/API/v1/Tile/5/10/12", http.StatusNoContent, ""},
+		{PathsMatch, http.MethodGet, "/api/v1/tiles/5/10/12/", http.StatusNotFound, ""},
+		{PathsStrict, http.MethodGet, "/api/v1/tile/5/10/12/", http.StatusNotFound, ""},
+		{PathsStrict, http.MethodGet, "/API/v1/Tile/5/10/12", http.StatusNotFound, ""},
+	}
+
+	gin.SetMode(gin.TestMode)
+	l := logger.FromContext(context.Background())
+	uc, err := usecase.NewTileUseCase(usecase.TileUseCaseConfig{}, l)
+	if err != nil {
+		t.Fatalf("failed to create tile usecase: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode+" "+tt.method+" "+tt.path, func(t *testing.T) {
+			r := NewRouter(handler.NewHandler(uc, nil, handler.Config{}), l, false, nil)
+			if err := NormalizePaths(r, tt.mode); err != nil {
+				t.Fatalf("NormalizePaths failed: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, w.Code)
+			}
+			if got := w.Header().Get("Location"); got != tt.location {
+				t.Fatalf("expected Location %q, got %q", tt.location, got)
+			}
+		})
+	}
+
+	r := NewRouter(handler.NewHandler(uc, nil, handler.Config{}), l, false, nil)
+	if err := NormalizePaths(r, "lenient"); err == nil {
+		t.Fatal("expected an unknown mode to be refused")
+	}
+}
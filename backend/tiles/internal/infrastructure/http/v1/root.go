@@ -0,0 +1,39 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultAttribution satisfies the OpenStreetMap attribution requirement.
+const DefaultAttribution = "Map data © OpenStreetMap contributors, available under the Open Database License. https://www.openstreetmap.org/copyright"
+
+// RootConfig configures what the service answers at "/".
+type RootConfig struct {
+	// Format is "text", serving Text, or "json", serving a service descriptor
+	Format string
+	// Text defaults to DefaultAttribution
+	Text    string
+	Service string
+	Version string
+}
+
+// Root serves the attribution notice, or with the json format a small
+// descriptor of the service that still carries it.
+func Root(cfg RootConfig) gin.HandlerFunc {
+	if cfg.Text == "" {
+		cfg.Text = DefaultAttribution
+	}
+	return func(c *gin.Context) {
+		if cfg.Format == "json" {
+			c.JSON(http.StatusOK, gin.H{
+				"service":     cfg.Service,
+				"version":     cfg.Version,
+				"attribution": cfg.Text,
+			})
+			return
+		}
+		c.String(http.StatusOK, cfg.Text)
+	}
+}
@@ -1,16 +1,19 @@
 package v1
 
 import (
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jaennil/guide_helper/backend/tiles/internal/infrastructure/http/v1/handler"
 	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
 	"github.com/jaennil/guide_helper/backend/tiles/pkg/telemetry"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-func NewRouter(handler *handler.Handler, l logger.Logger, telemetryEnabled bool) *gin.Engine {
+func NewRouter(handler *handler.Handler, l logger.Logger, telemetryEnabled bool, apiKeys []string) *gin.Engine {
 	r := gin.Default()
 
 	r.Use(gin.Recovery())
@@ -22,18 +25,58 @@ func NewRouter(handler *handler.Handler, l logger.Logger, telemetryEnabled bool)
 
 	r.Use(ginZapLogger(l))
 
+	// Unsupported methods on known routes get 405, gin sets the Allow header
+	r.HandleMethodNotAllowed = true
+	r.NoMethod(methodNotAllowed)
+
 	api := r.Group("/api")
 	v1 := api.Group("/v1")
 
 	v1.GET("/healthz", handler.Healthz)
-	v1.GET("/tile/:z/:x/:y", handler.Tile)
+	v1.GET("/info", handler.Info)
+	v1.GET("/metrics.json", gin.WrapH(metrics.JSONHandler(prometheus.DefaultGatherer)))
+	v1.GET("/tile/:z/:x/:y", identifyAPIKey(apiKeys), handler.Tile)
+	v1.HEAD("/tile/:z/:x/:y", identifyAPIKey(apiKeys), handler.Tile)
+	v1.OPTIONS("/tile/:z/:x/:y", allow(http.MethodGet, http.MethodHead))
+	v1.GET("/tiles", handler.Layers)
+	v1.GET("/tiles/:layer/:z/:x/:y", identifyAPIKey(apiKeys), handler.LayerTile)
+	v1.HEAD("/tiles/:layer/:z/:x/:y", identifyAPIKey(apiKeys), handler.LayerTile)
+	v1.OPTIONS("/tiles/:layer/:z/:x/:y", allow(http.MethodGet, http.MethodHead))
+
+	admin := v1.Group("/admin", requireAPIKey(apiKeys))
+	admin.GET("/diff/:z/:x/:y", handler.TileDiff)
+	admin.POST("/prefetch", handler.Prefetch)
+	admin.GET("/prefetch/:id", handler.JobStatus)
+	admin.POST("/warm", handler.Warm)
+	admin.PUT("/maintenance", handler.SetMaintenance)
+
+	cache := v1.Group("/cache", requireAPIKey(apiKeys))
+	cache.POST("/seed", handler.Seed)
+	cache.GET("/seed/:id", handler.JobStatus)
+	cache.POST("/purge", handler.PurgeCache)
 
-	// Prometheus metrics endpoint
-	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	jobs := v1.Group("/jobs", requireAPIKey(apiKeys))
+	jobs.GET("/:id", handler.JobStatus)
+	jobs.DELETE("/:id", handler.CancelJob)
 
 	return r
 }
 
+// allow answers OPTIONS with the methods a route supports.
+func allow(methods ...string) gin.HandlerFunc {
+	value := strings.Join(methods, ", ")
+	return func(c *gin.Context) {
+		c.Header("Allow", value)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func methodNotAllowed(c *gin.Context) {
+	c.JSON(http.StatusMethodNotAllowed, gin.H{
+		"error": "method not allowed",
+	})
+}
+
 func ginZapLogger(l logger.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Set("logger", l)
@@ -0,0 +1,153 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaennil/guide_helper/backend/tiles/internal/infrastructure/http/v1/handler"
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+)
+
+func TestRouter_OptionsListsAllowedMethods(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := logger.FromContext(context.Background())
+	uc, err := usecase.NewTileUseCase(usecase.TileUseCaseConfig{}, l)
+	if err != nil {
+		t.Fatalf("failed to create tile usecase: %v", err)
+	}
+	r := NewRouter(handler.NewHandler(uc, nil, handler.Config{}), l, false, nil)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/api/v1/tile/1/2/3", nil))
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if got, want := w.Header().Get("Allow"), "GET, HEAD"; got != want {
+		t.Fatalf("Allow = %q, want %q", got, want)
+	}
+}
+
+func TestRouter_AnonymousCacheOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cacheSvc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer cacheSvc.Close()
+
+	var upstreamRequests atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamRequests.Add(1)
+		w.Write([]byte("png"))
+	}))
+	defer upstream.Close()
+
+	l := logger.FromContext(context.Background())
+	uc, err := usecase.NewTileUseCase(usecase.TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.URL,
+		UpstreamTileURL: upstream.URL,
+	}, l)
+	if err != nil {
+		t.Fatalf("failed to create tile usecase: %v", err)
+	}
+	r := NewRouter(handler.NewHandler(uc, nil, handler.Config{AnonymousCacheOnly: true}), l, false, []string{"secret"})
+
+	tests := []struct {
+		name     string
+		key      string
+		want     int
+		upstream int64
+	}{
+		{"anonymous", "", http.StatusNotFound, 0},
+		{"invalid key is anonymous", "wrong", http.StatusNotFound, 0},
+		{"authenticated", "secret", http.StatusOK, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamRequests.Store(0)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/tile/1/0/0", nil)
+			if tt.key != "" {
+				req.Header.Set(apiKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+			if got := upstreamRequests.Load(); got != tt.upstream {
+				t.Fatalf("expected %d upstream requests, got %d", tt.upstream, got)
+			}
+		})
+	}
+}
+
+func TestRoot_ServesAttribution(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", Root(RootConfig{Format: "text"}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if got := w.Body.String(); got != DefaultAttribution {
+		t.Fatalf("body = %q, want the attribution", got)
+	}
+}
+
+func TestRoot_JSONDescriptor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", Root(RootConfig{Format: "json", Service: "svc", Version: "1.2.3"}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if body["service"] != "svc" || body["version"] != "1.2.3" || body["attribution"] != DefaultAttribution {
+		t.Fatalf("unexpected descriptor %v", body)
+	}
+}
+
+func TestRouter_MethodNotAllowed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := logger.FromContext(context.Background())
+	uc, err := usecase.NewTileUseCase(usecase.TileUseCaseConfig{}, l)
+	if err != nil {
+		t.Fatalf("failed to create tile usecase: %v", err)
+	}
+	r := NewRouter(handler.NewHandler(uc, nil, handler.Config{}), l, false, nil)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/v1/tile/1/2/3", nil))
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", w.Code)
+	}
+	if got, want := w.Header().Get("Allow"), "GET, HEAD, OPTIONS"; got != want {
+		t.Fatalf("Allow = %q, want %q", got, want)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["error"] == "" {
+		t.Fatalf("expected a json error body, got %q", w.Body.String())
+	}
+}
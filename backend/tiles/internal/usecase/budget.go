@@ -0,0 +1,238 @@
+package usecase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+)
+
+// ErrUpstreamBudgetExhausted is returned instead of contacting upstream once
+// the daily or monthly upstream request budget is used up.
+var ErrUpstreamBudgetExhausted = errors.New("upstream request budget exhausted")
+
+// budgetPeriod names the UTC period a point in time falls into.
+type budgetPeriod func(time.Time) string
+
+func daily(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+func monthly(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+type budgetState struct {
+	Period string `json:"period"`
+	Used   int    `json:"used"`
+}
+
+// periodBudget counts upstream requests per period and persists the count
+// to a file so restarts cannot be used to exceed it.
+type periodBudget struct {
+	mu     sync.Mutex
+	limit  int
+	path   string
+	period budgetPeriod
+	state  budgetState
+	now    func() time.Time
+}
+
+func loadDailyBudget(path string, limit int, now func() time.Time) (*periodBudget, error) {
+	return loadPeriodBudget(path, limit, daily, now)
+}
+
+func loadMonthlyBudget(path string, limit int, now func() time.Time) (*periodBudget, error) {
+	return loadPeriodBudget(path, limit, monthly, now)
+}
+
+func loadPeriodBudget(path string, limit int, period budgetPeriod, now func() time.Time) (*periodBudget, error) {
+	b := &periodBudget{
+		limit:  limit,
+		path:   path,
+		period: period,
+		now:    now,
+	}
+	if path == "" || limit <= 0 {
+		return b, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return b, nil
+		}
+		return nil, fmt.Errorf("failed to read budget file: %w", err)
+	}
+	if err := json.Unmarshal(raw, &b.state); err != nil {
+		return nil, fmt.Errorf("failed to parse budget file: %w", err)
+	}
+	return b, nil
+}
+
+// Take consumes one request from the current period's budget, reporting
+// false once it is exhausted. A zero limit never runs out.
+func (b *periodBudget) Take() (bool, error) {
+	if b.limit <= 0 {
+		return true, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rollover()
+	if b.state.Used >= b.limit {
+		return false, nil
+	}
+	b.state.Used++
+	return true, b.persist()
+}
+
+// refund returns a request taken in the current period that was not used.
+func (b *periodBudget) refund() error {
+	if b.limit <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rollover()
+	if b.state.Used == 0 {
+		return nil
+	}
+	b.state.Used--
+	return b.persist()
+}
+
+func (b *periodBudget) Exhausted() bool {
+	if b.limit <= 0 {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rollover()
+	return b.state.Used >= b.limit
+}
+
+func (b *periodBudget) rollover() {
+	current := b.period(b.now())
+	if b.state.Period != current {
+		b.state = budgetState{Period: current}
+	}
+}
+
+func (b *periodBudget) persist() error {
+	if b.path == "" {
+		return nil
+	}
+
+	raw, err := json.Marshal(b.state)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a torn file
+	tmp, err := os.CreateTemp(filepath.Dir(b.path), ".budget-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), b.path)
+}
+
+// UpstreamBudgetConfig caps upstream requests over long periods to stay
+// within the tile server usage policy. Zero limits disable a cap.
+type UpstreamBudgetConfig struct {
+	Daily       int
+	Monthly     int
+	DailyFile   string
+	MonthlyFile string
+}
+
+// upstreamBudget enforces the daily and monthly caps together.
+type upstreamBudget struct {
+	daily   *periodBudget
+	monthly *periodBudget
+}
+
+func loadUpstreamBudget(cfg UpstreamBudgetConfig, now func() time.Time) (*upstreamBudget, error) {
+	d, err := loadDailyBudget(cfg.DailyFile, cfg.Daily, now)
+	if err != nil {
+		return nil, fmt.Errorf("daily upstream budget: %w", err)
+	}
+	m, err := loadMonthlyBudget(cfg.MonthlyFile, cfg.Monthly, now)
+	if err != nil {
+		return nil, fmt.Errorf("monthly upstream budget: %w", err)
+	}
+	return &upstreamBudget{daily: d, monthly: m}, nil
+}
+
+// Take consumes one request from both budgets, or from neither.
+func (b *upstreamBudget) Take() (bool, error) {
+	ok, err := b.monthly.Take()
+	if !ok {
+		return false, err
+	}
+	persistErr := err
+
+	ok, err = b.daily.Take()
+	if err != nil {
+		persistErr = err
+	}
+	if !ok {
+		if err := b.monthly.refund(); err != nil {
+			persistErr = err
+		}
+		return false, persistErr
+	}
+	return true, persistErr
+}
+
+func (b *upstreamBudget) Exhausted() bool {
+	return b.daily.Exhausted() || b.monthly.Exhausted()
+}
+
+// takeUpstreamBudget reserves an upstream request, switching the service to
+// cache-only while the budget is exhausted.
+func (uc *TileUseCase) takeUpstreamBudget() error {
+	ok, err := uc.budget.Take()
+	if err != nil {
+		uc.logger.Error("failed to persist upstream budget", "error", err)
+	}
+
+	if !ok {
+		if !uc.budgetExhausted.Swap(true) {
+			uc.logger.Warn("upstream request budget exhausted, serving cached tiles only")
+			metrics.TilesUpstreamBudgetExhausted.Set(1)
+		}
+		return ErrUpstreamBudgetExhausted
+	}
+
+	if uc.budgetExhausted.Swap(false) {
+		uc.logger.Info("upstream request budget reset, fetching from upstream again")
+		metrics.TilesUpstreamBudgetExhausted.Set(0)
+	}
+	return nil
+}
+
+// UpstreamBudgetExhausted reports whether upstream requests are currently
+// refused because the budget ran out.
+func (uc *TileUseCase) UpstreamBudgetExhausted() bool {
+	return uc.budget.Exhausted()
+}
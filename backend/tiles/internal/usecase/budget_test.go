@@ -0,0 +1,104 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetTile_UpstreamBudgetBlocksAndResets(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("tile"))
+	dir := t.TempDir()
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+		Budget: UpstreamBudgetConfig{
+			Daily:       2,
+			Monthly:     3,
+			DailyFile:   filepath.Join(dir, "daily.json"),
+			MonthlyFile: filepath.Join(dir, "monthly.json"),
+		},
+	})
+	now := time.Date(2026, 10, 30, 12, 0, 0, 0, time.UTC)
+	uc.now = func() time.Time { return now }
+
+	fetch := func(x int) error {
+		_, err := uc.GetTile(context.Background(), 5, x, 12)
+		return err
+	}
+
+	for x := 0; x < 2; x++ {
+		if err := fetch(x); err != nil {
+			t.Fatalf("fetch %d failed: %v", x, err)
+		}
+	}
+	if err := fetch(2); !errors.Is(err, ErrUpstreamBudgetExhausted) {
+		t.Fatalf("expected daily budget to be exhausted, got %v", err)
+	}
+	if got := upstream.requests.Load(); got != 2 {
+		t.Fatalf("expected 2 upstream requests, got %d", got)
+	}
+	if !uc.UpstreamBudgetExhausted() {
+		t.Fatal("expected usecase to report the exhausted budget")
+	}
+
+	// The next day only one request is left of the monthly budget
+	now = now.Add(24 * time.Hour)
+	if err := fetch(3); err != nil {
+		t.Fatalf("expected daily budget to reset, got %v", err)
+	}
+	if err := fetch(4); !errors.Is(err, ErrUpstreamBudgetExhausted) {
+		t.Fatalf("expected monthly budget to be exhausted, got %v", err)
+	}
+
+	// A restart within the month keeps the budget exhausted
+	restarted := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+		Budget: UpstreamBudgetConfig{
+			Daily:       2,
+			Monthly:     3,
+			DailyFile:   filepath.Join(dir, "daily.json"),
+			MonthlyFile: filepath.Join(dir, "monthly.json"),
+		},
+	})
+	restarted.now = func() time.Time { return now }
+	if _, err := restarted.GetTile(context.Background(), 5, 5, 12); !errors.Is(err, ErrUpstreamBudgetExhausted) {
+		t.Fatalf("expected persisted budget to stay exhausted, got %v", err)
+	}
+
+	now = time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	if err := fetch(5); err != nil {
+		t.Fatalf("expected budgets to reset in a new month, got %v", err)
+	}
+	if uc.UpstreamBudgetExhausted() {
+		t.Fatal("expected budget to be available again")
+	}
+	if got := upstream.requests.Load(); got != 4 {
+		t.Fatalf("expected 4 upstream requests, got %d", got)
+	}
+}
+
+func TestUpstreamBudget_DailyRefusalDoesNotConsumeMonthly(t *testing.T) {
+	now := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	b, err := loadUpstreamBudget(UpstreamBudgetConfig{Daily: 1, Monthly: 10}, func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("failed to load budget: %v", err)
+	}
+
+	if ok, _ := b.Take(); !ok {
+		t.Fatal("expected first request to be allowed")
+	}
+	for i := 0; i < 5; i++ {
+		if ok, _ := b.Take(); ok {
+			t.Fatal("expected daily budget to refuse")
+		}
+	}
+	if used := b.monthly.state.Used; used != 1 {
+		t.Fatalf("monthly budget used %d, want 1", used)
+	}
+}
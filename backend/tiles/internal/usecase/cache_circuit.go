@@ -0,0 +1,111 @@
+package usecase
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+)
+
+// ErrCacheStoreCircuitOpen is returned for stores skipped while cache
+// responses keep failing to parse.
+var ErrCacheStoreCircuitOpen = errors.New("cache store circuit open")
+
+// cacheCircuitMinLookups keeps a handful of bad responses right after a
+// window starts from tripping the circuit.
+const cacheCircuitMinLookups = 10
+
+// CacheCircuitConfig pauses cache stores when the cache service's responses
+// cannot be parsed, which points at an integration bug rather than a
+// transient failure.
+type CacheCircuitConfig struct {
+	// ParseErrorRate is the fraction of cache lookups within Window that may
+	// fail to parse before stores are paused for Cooldown. Zero disables it.
+	ParseErrorRate float64
+	Window         time.Duration
+	Cooldown       time.Duration
+}
+
+// cacheCircuit counts parse failures over fixed windows.
+type cacheCircuit struct {
+	mu          sync.Mutex
+	cfg         CacheCircuitConfig
+	windowStart time.Time
+	lookups     int
+	failures    int
+	openUntil   time.Time
+}
+
+func newCacheCircuit(cfg CacheCircuitConfig) *cacheCircuit {
+	if cfg.ParseErrorRate <= 0 {
+		return nil
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 5 * time.Minute
+	}
+	return &cacheCircuit{cfg: cfg}
+}
+
+// record counts a parsed cache response and reports whether it tripped the
+// circuit, along with the failure rate that did.
+func (c *cacheCircuit) record(failed bool, now time.Time) (bool, float64) {
+	if c == nil {
+		return false, 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.windowStart) >= c.cfg.Window {
+		c.windowStart = now
+		c.lookups, c.failures = 0, 0
+	}
+	c.lookups++
+	if failed {
+		c.failures++
+	}
+
+	rate := float64(c.failures) / float64(c.lookups)
+	if !failed || now.Before(c.openUntil) || c.lookups < cacheCircuitMinLookups || rate < c.cfg.ParseErrorRate {
+		return false, rate
+	}
+	c.openUntil = now.Add(c.cfg.Cooldown)
+	return true, rate
+}
+
+// open reports whether stores are paused.
+func (c *cacheCircuit) open(now time.Time) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	open := now.Before(c.openUntil)
+	if open {
+		metrics.TilesCacheStoreCircuitOpen.Set(1)
+	} else {
+		metrics.TilesCacheStoreCircuitOpen.Set(0)
+	}
+	return open
+}
+
+// recordCacheParse counts a cache response that was or was not parsed,
+// logging at error level when failures trip the store circuit.
+func (uc *TileUseCase) recordCacheParse(err error) {
+	if err != nil {
+		metrics.TilesCacheParseErrors.Inc()
+	}
+	tripped, rate := uc.circuit.record(err != nil, uc.now())
+	if tripped {
+		uc.logger.Error("cache responses keep failing to parse, pausing cache stores",
+			"error_rate", rate, "threshold", uc.circuit.cfg.ParseErrorRate,
+			"cooldown", uc.circuit.cfg.Cooldown, "error", err)
+		metrics.TilesCacheStoreCircuitOpen.Set(1)
+	}
+}
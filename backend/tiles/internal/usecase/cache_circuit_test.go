@@ -0,0 +1,80 @@
+package usecase
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newMalformedCacheService answers lookups with truncated tiles and counts
+// stores.
+func newMalformedCacheService(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+
+	var stores atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			stores.Add(1)
+			return
+		}
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("\x89PNG"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &stores
+}
+
+func TestGetTile_MalformedCacheResponse(t *testing.T) {
+	cacheSvc, _ := newMalformedCacheService(t)
+	upstream := newFakeUpstream(t, []byte("fresh"))
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.URL,
+		UpstreamTileURL: upstream.server.URL,
+	})
+	before := testutil.ToFloat64(metrics.TilesCacheParseErrors)
+
+	data, err := uc.GetTile(context.Background(), 5, 10, 12)
+	if err != nil {
+		t.Fatalf("GetTile failed: %v", err)
+	}
+	if string(data) != "fresh" {
+		t.Fatalf("expected the upstream tile as fallback, got %q", data)
+	}
+	uc.WaitForStores()
+
+	if got := testutil.ToFloat64(metrics.TilesCacheParseErrors); got != before+1 {
+		t.Fatalf("parse errors = %v, want %v", got, before+1)
+	}
+}
+
+func TestGetTile_ParseErrorsTripStoreCircuit(t *testing.T) {
+	cacheSvc, stores := newMalformedCacheService(t)
+	upstream := newFakeUpstream(t, []byte("fresh"))
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.URL,
+		UpstreamTileURL: upstream.server.URL,
+		CacheCircuit:    CacheCircuitConfig{ParseErrorRate: 0.5},
+	})
+
+	for i := 0; i < cacheCircuitMinLookups+5; i++ {
+		if _, err := uc.GetTile(context.Background(), 12, i, 0); err != nil {
+			t.Fatalf("GetTile failed: %v", err)
+		}
+		uc.WaitForStores()
+	}
+
+	// Stores go through until enough lookups failed to trip the circuit
+	if got := stores.Load(); got != cacheCircuitMinLookups-1 {
+		t.Fatalf("expected %d stores before the circuit opened, got %d", cacheCircuitMinLookups-1, got)
+	}
+	if got := testutil.ToFloat64(metrics.TilesCacheStoreCircuitOpen); got != 1 {
+		t.Fatalf("expected the circuit open gauge to be 1, got %v", got)
+	}
+}
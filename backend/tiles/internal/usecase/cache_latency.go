@@ -0,0 +1,104 @@
+package usecase
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+)
+
+// CacheLatencyConfig stops probing the cache while it is consistently slow,
+// since waiting on it only delays the upstream fetch that follows a miss.
+// Tiles are still stored in the cache meanwhile.
+type CacheLatencyConfig struct {
+	// Threshold is the 95th percentile probe latency, over the last Samples
+	// probes, beyond which probes are skipped for Cooldown. Zero disables it.
+	Threshold time.Duration
+	Samples   int
+	Cooldown  time.Duration
+}
+
+// cacheLatencyCircuit keeps the latencies of the recent cache probes in a
+// ring.
+type cacheLatencyCircuit struct {
+	mu        sync.Mutex
+	cfg       CacheLatencyConfig
+	samples   []time.Duration
+	next      int
+	openUntil time.Time
+}
+
+func newCacheLatencyCircuit(cfg CacheLatencyConfig) *cacheLatencyCircuit {
+	if cfg.Threshold <= 0 {
+		return nil
+	}
+	if cfg.Samples <= 0 {
+		cfg.Samples = 100
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 30 * time.Second
+	}
+	return &cacheLatencyCircuit{
+		cfg:     cfg,
+		samples: make([]time.Duration, 0, cfg.Samples),
+	}
+}
+
+// record adds a probe latency and reports whether it tripped the circuit,
+// along with the percentile that did. The circuit only trips on a full ring
+// of samples, which it starts over with after the cooldown.
+func (c *cacheLatencyCircuit) record(latency time.Duration, now time.Time) (bool, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.samples) < c.cfg.Samples {
+		c.samples = append(c.samples, latency)
+	} else {
+		c.samples[c.next] = latency
+		c.next = (c.next + 1) % c.cfg.Samples
+	}
+	if len(c.samples) < c.cfg.Samples {
+		return false, 0
+	}
+
+	sorted := slices.Clone(c.samples)
+	slices.Sort(sorted)
+	p95 := sorted[(len(sorted)*95+99)/100-1]
+	if p95 <= c.cfg.Threshold {
+		return false, p95
+	}
+	c.openUntil = now.Add(c.cfg.Cooldown)
+	c.samples, c.next = c.samples[:0], 0
+	return true, p95
+}
+
+// open reports whether probes are skipped.
+func (c *cacheLatencyCircuit) open(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return now.Before(c.openUntil)
+}
+
+// lookupCacheUnlessSlow is lookupLayerCache for client requests, skipping
+// the cache while its probes are too slow. A skipped probe is a miss.
+func (uc *TileUseCase) lookupCacheUnlessSlow(ctx context.Context, layer string, z, x, y int) (cacheData, bool) {
+	c := uc.cacheLatency
+	if c == nil {
+		return uc.lookupLayerCache(ctx, layer, z, x, y)
+	}
+	if c.open(uc.now()) {
+		uc.logger.Debug("cache is slow, skipping probe", "layer", layer, "z", z, "x", x, "y", y)
+		metrics.TilesCacheProbeBypassed.Inc()
+		return cacheData{}, false
+	}
+
+	start := time.Now()
+	cached, fresh := uc.lookupLayerCache(ctx, layer, z, x, y)
+	if tripped, p95 := c.record(time.Since(start), uc.now()); tripped {
+		uc.logger.Warn("cache probes are slow, bypassing the cache",
+			"p95", p95, "threshold", c.cfg.Threshold, "cooldown", c.cfg.Cooldown)
+	}
+	return cached, fresh
+}
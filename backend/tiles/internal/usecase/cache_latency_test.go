@@ -0,0 +1,65 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetTile_SlowCacheIsBypassed(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("tile"))
+
+	// The cache answers correctly but every probe takes a while
+	var probes atomic.Int64
+	slowCache := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			probes.Add(1)
+			time.Sleep(20 * time.Millisecond)
+		}
+		cacheSvc.serve(w, r)
+	}))
+	t.Cleanup(slowCache.Close)
+
+	const samples = 5
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    slowCache.URL,
+		UpstreamTileURL: upstream.server.URL,
+		CacheLatency:    CacheLatencyConfig{Threshold: 5 * time.Millisecond, Samples: samples, Cooldown: time.Minute},
+	})
+	now := time.Now()
+	uc.now = func() time.Time { return now }
+
+	for i := range samples {
+		if _, err := uc.GetTile(context.Background(), 5, i, 12); err != nil {
+			t.Fatalf("GetTile failed: %v", err)
+		}
+		cacheSvc.waitStored(t)
+	}
+	if got := probes.Load(); got != samples {
+		t.Fatalf("expected %d probes before the threshold is crossed, got %d", samples, got)
+	}
+
+	data, err := uc.GetTile(context.Background(), 5, 10, 12)
+	if err != nil || !bytes.Equal(data, []byte("tile")) {
+		t.Fatalf("expected the tile from upstream, got %q and %v", data, err)
+	}
+	if got := probes.Load(); got != samples {
+		t.Fatalf("expected the probe to be bypassed, got %d probes", got)
+	}
+	if key := cacheSvc.waitStored(t); key != "5/10/12" {
+		t.Fatalf("expected the tile to still be stored, got %s", key)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := uc.GetTile(context.Background(), 5, 10, 12); err != nil {
+		t.Fatalf("GetTile failed: %v", err)
+	}
+	if got := probes.Load(); got != samples+1 {
+		t.Fatalf("expected the cache to be probed again after the cooldown, got %d probes", got)
+	}
+}
@@ -0,0 +1,65 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/tilemath"
+)
+
+// cacheAPIKeyHeader carries the key the cache's admin endpoints require
+const cacheAPIKeyHeader = "X-API-Key"
+
+type cachePurgeRequest struct {
+	MinZ int    `json:"minZ"`
+	MaxZ int    `json:"maxZ"`
+	BBox string `json:"bbox"`
+}
+
+type cachePurgeResponse struct {
+	Data struct {
+		Removed int64 `json:"removed"`
+	} `json:"data"`
+}
+
+// purgeCache removes the cached tiles of zoom level z within bbox through
+// the cache service and returns how many it removed.
+func (uc *TileUseCase) purgeCache(ctx context.Context, bbox tilemath.BBox, z int) (int64, error) {
+	body, err := json.Marshal(cachePurgeRequest{
+		MinZ: z,
+		MaxZ: z,
+		BBox: fmt.Sprintf("%g,%g,%g,%g", bbox.West, bbox.South, bbox.East, bbox.North),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uc.cacheBaseURL+"/api/v1/cache/purge", bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if uc.cacheAPIKey != "" {
+		req.Header.Set(cacheAPIKeyHeader, uc.cacheAPIKey)
+	}
+
+	resp, err := uc.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge cache: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("cache returned status %d", resp.StatusCode)
+	}
+	var purged cachePurgeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&purged); err != nil {
+		return 0, fmt.Errorf("failed to parse cache response: %w", err)
+	}
+
+	uc.logger.Info("purged tiles from cache", "z", z, "removed", purged.Data.Removed)
+	return purged.Data.Removed, nil
+}
@@ -0,0 +1,130 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/cacherpc"
+	"google.golang.org/grpc"
+)
+
+// rpcCacheService serves the fake cache's tiles over the gRPC API.
+type rpcCacheService struct {
+	cacherpc.UnimplementedTileCacheServiceServer
+	*fakeCacheService
+}
+
+func (s rpcCacheService) Get(ctx context.Context, req *cacherpc.GetRequest) (*cacherpc.GetResponse, error) {
+	tile, ok := s.get(int(req.Z), int(req.X), int(req.Y))
+	resp := &cacherpc.GetResponse{Exists: ok && !tile.notFound, Data: tile.data, NotFound: tile.notFound}
+	if tile.storedAt != nil {
+		resp.StoredAtUnixNanos = tile.storedAt.UnixNano()
+	}
+	return resp, nil
+}
+
+func (s rpcCacheService) Set(ctx context.Context, req *cacherpc.SetRequest) (*cacherpc.SetResponse, error) {
+	now := time.Now()
+	tile := fakeTile{data: req.Data, storedAt: &now, notFound: req.NotFound, source: req.Source, etag: req.UpstreamEtag}
+	if req.LastModifiedUnixNanos != 0 {
+		tile.lastModified = time.Unix(0, req.LastModifiedUnixNanos).UTC().Format(http.TimeFormat)
+	}
+	s.put(int(req.Z), int(req.X), int(req.Y), tile)
+	s.stored <- fmt.Sprintf("%d/%d/%d", req.Z, req.X, req.Y)
+	return &cacherpc.SetResponse{}, nil
+}
+
+func (s rpcCacheService) Delete(ctx context.Context, req *cacherpc.DeleteRequest) (*cacherpc.DeleteResponse, error) {
+	return &cacherpc.DeleteResponse{}, nil
+}
+
+// serveGRPC serves f over the gRPC API as well and returns its address.
+func (f *fakeCacheService) serveGRPC(t *testing.T) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	cacherpc.RegisterTileCacheServiceServer(srv, rpcCacheService{fakeCacheService: f})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+func newRPCTestUseCase(t *testing.T, cfg TileUseCaseConfig) *TileUseCase {
+	t.Helper()
+
+	uc := newTestUseCase(t, cfg)
+	t.Cleanup(func() { uc.Close() })
+	return uc
+}
+
+func TestGetTile_CacheOverGRPC(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("fresh"))
+	upstream.header = http.Header{
+		"Etag":          {`"v1"`},
+		"Last-Modified": {"Mon, 02 Jan 2006 15:04:05 GMT"},
+	}
+
+	// The HTTP API is left unreachable, every tile must go over gRPC
+	uc := newRPCTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    "http://127.0.0.1:1",
+		CacheGRPCAddr:   cacheSvc.serveGRPC(t),
+		UpstreamTileURL: upstream.server.URL,
+		StoreSource:     true,
+	})
+
+	data, err := uc.GetTile(context.Background(), 5, 10, 12)
+	if err != nil || string(data) != "fresh" {
+		t.Fatalf("GetTile returned %q, %v", data, err)
+	}
+	if key := cacheSvc.waitStored(t); key != "5/10/12" {
+		t.Fatalf("stored %s, want 5/10/12", key)
+	}
+	tile, _ := cacheSvc.get(5, 10, 12)
+	if string(tile.data) != "fresh" || tile.source != upstream.server.URL+"/5/10/12.png" ||
+		tile.etag != `"v1"` || tile.lastModified != "Mon, 02 Jan 2006 15:04:05 GMT" {
+		t.Fatalf("unexpected stored tile %+v", tile)
+	}
+
+	data, err = uc.GetTile(context.Background(), 5, 10, 12)
+	if err != nil || string(data) != "fresh" {
+		t.Fatalf("GetTile returned %q, %v", data, err)
+	}
+	if got := upstream.requests.Load(); got != 1 {
+		t.Fatalf("expected the second request to be served from cache, got %d upstream requests", got)
+	}
+}
+
+func TestGetTile_CacheOverGRPCHonoursMaxServedAge(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("fresh"))
+
+	longAgo := time.Now().Add(-365 * 24 * time.Hour)
+	cacheSvc.put(5, 10, 12, fakeTile{data: []byte("stale"), storedAt: &longAgo})
+	cacheSvc.put(5, 10, 13, fakeTile{notFound: true})
+
+	uc := newRPCTestUseCase(t, TileUseCaseConfig{
+		CacheGRPCAddr:   cacheSvc.serveGRPC(t),
+		UpstreamTileURL: upstream.server.URL,
+		MaxServedAge:    time.Hour,
+	})
+
+	if data, err := uc.GetTile(context.Background(), 5, 10, 12); err != nil || string(data) != "fresh" {
+		t.Fatalf("expected refreshed tile, got %q, %v", data, err)
+	}
+	if _, err := uc.GetTile(context.Background(), 5, 10, 13); !errors.Is(err, ErrTileNotFound) {
+		t.Fatalf("expected ErrTileNotFound for the recorded missing tile, got %v", err)
+	}
+	if got := upstream.requests.Load(); got != 1 {
+		t.Fatalf("expected 1 upstream request, got %d", got)
+	}
+}
@@ -0,0 +1,107 @@
+package usecase
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+)
+
+// expectedContentType is what tiles are requested as from upstream.
+const expectedContentType = "image/png"
+
+// ContentTypeMode selects what happens to an upstream tile served with a
+// content type other than image/png.
+type ContentTypeMode string
+
+const (
+	// ContentTypePassthrough serves and caches the tile as upstream sent it,
+	// labelled with its actual type
+	ContentTypePassthrough ContentTypeMode = "passthrough"
+	// ContentTypeConvert re-encodes the tile as PNG
+	ContentTypeConvert ContentTypeMode = "convert"
+	// ContentTypeReject treats the response as a failed fetch
+	ContentTypeReject ContentTypeMode = "reject"
+)
+
+var (
+	ErrInvalidContentTypeMode = errors.New("invalid content type mode")
+	// ErrUnexpectedContentType is returned for upstream tiles of another type
+	// than image/png that are rejected or cannot be converted.
+	ErrUnexpectedContentType = errors.New("unexpected upstream content type")
+)
+
+// ParseContentTypeModes parses the per provider modes, keyed like Signers.
+func ParseContentTypeModes(specs map[string]string) (map[string]ContentTypeMode, error) {
+	modes := make(map[string]ContentTypeMode, len(specs))
+	for provider, spec := range specs {
+		switch mode := ContentTypeMode(strings.TrimSpace(spec)); mode {
+		case ContentTypePassthrough, ContentTypeConvert, ContentTypeReject:
+			modes[provider] = mode
+		default:
+			return nil, fmt.Errorf("%w for %s: %q, expected passthrough, convert or reject",
+				ErrInvalidContentTypeMode, provider, spec)
+		}
+	}
+	return modes, nil
+}
+
+// upstreamContentType is the media type of an upstream tile, sniffed from
+// the data when upstream does not say or only says it is binary.
+func upstreamContentType(header string, data []byte) string {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil || mediaType == "application/octet-stream" {
+		return http.DetectContentType(data)
+	}
+	return mediaType
+}
+
+// tileContentType is the type a tile is served with. Data that does not
+// sniff as an image keeps being served as PNG.
+func tileContentType(data []byte) string {
+	if contentType := http.DetectContentType(data); strings.HasPrefix(contentType, "image/") {
+		return contentType
+	}
+	return expectedContentType
+}
+
+// checkContentType applies the provider's mode to an upstream tile that is
+// not a PNG. Providers without a mode pass tiles through.
+func (uc *TileUseCase) checkContentType(provider, header string, data []byte) ([]byte, error) {
+	contentType := upstreamContentType(header, data)
+	if contentType == expectedContentType {
+		return data, nil
+	}
+
+	mode, ok := uc.contentTypeModes[provider]
+	if !ok {
+		mode = ContentTypePassthrough
+	}
+	metrics.TilesUnexpectedContentType.WithLabelValues(provider, string(mode)).Inc()
+	uc.logger.Warn("upstream tile has an unexpected content type",
+		"provider", provider, "content_type", contentType, "mode", mode)
+
+	switch mode {
+	case ContentTypeReject:
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedContentType, contentType)
+	case ContentTypeConvert:
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: cannot convert %s: %v", ErrUnexpectedContentType, contentType, err)
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("failed to encode png: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+	return data, nil
+}
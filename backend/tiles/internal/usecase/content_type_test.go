@@ -0,0 +1,109 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"net/http"
+	"testing"
+)
+
+func gifTile(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewPaletted(image.Rect(0, 0, 8, 8), palette.Plan9)
+	for x := 0; x < 8; x++ {
+		img.Set(x, x, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("failed to encode gif: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGetTile_UnexpectedContentType(t *testing.T) {
+	tile := gifTile(t)
+
+	tests := []struct {
+		mode ContentTypeMode
+		// check inspects the served tile, or the error when rejected
+		check func(t *testing.T, uc *TileUseCase, cacheSvc *fakeCacheService, data []byte, err error)
+	}{
+		{mode: ContentTypeConvert, check: func(t *testing.T, uc *TileUseCase, cacheSvc *fakeCacheService, data []byte, err error) {
+			if err != nil {
+				t.Fatalf("GetTile failed: %v", err)
+			}
+			if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+				t.Fatalf("expected a PNG, got %v", err)
+			}
+			if _, contentType := uc.Reduce(1, 1, 1, QualityOriginal, data); contentType != "image/png" {
+				t.Fatalf("expected image/png, got %s", contentType)
+			}
+			cacheSvc.waitStored(t)
+			if stored, _ := cacheSvc.get(1, 1, 1); !bytes.Equal(stored.data, data) {
+				t.Fatal("expected the converted tile to be cached")
+			}
+		}},
+		{mode: ContentTypePassthrough, check: func(t *testing.T, uc *TileUseCase, cacheSvc *fakeCacheService, data []byte, err error) {
+			if err != nil {
+				t.Fatalf("GetTile failed: %v", err)
+			}
+			if !bytes.Equal(data, tile) {
+				t.Fatal("expected the upstream GIF unchanged")
+			}
+			if _, contentType := uc.Reduce(1, 1, 1, QualityOriginal, data); contentType != "image/gif" {
+				t.Fatalf("expected image/gif, got %s", contentType)
+			}
+			cacheSvc.waitStored(t)
+			if stored, _ := cacheSvc.get(1, 1, 1); !bytes.Equal(stored.data, tile) {
+				t.Fatal("expected the GIF to be cached as is")
+			}
+		}},
+		{mode: ContentTypeReject, check: func(t *testing.T, uc *TileUseCase, cacheSvc *fakeCacheService, data []byte, err error) {
+			if !errors.Is(err, ErrUnexpectedContentType) {
+				t.Fatalf("expected ErrUnexpectedContentType, got %v", err)
+			}
+			uc.WaitForStores()
+			if _, ok := cacheSvc.get(1, 1, 1); ok {
+				t.Fatal("a rejected tile must not be cached")
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			cacheSvc := newFakeCacheService(t)
+			upstream := newFakeUpstream(t, tile)
+			upstream.header = http.Header{"Content-Type": {"image/gif"}}
+
+			uc := newTestUseCase(t, TileUseCaseConfig{
+				CacheBaseURL:     cacheSvc.server.URL,
+				UpstreamTileURL:  upstream.server.URL,
+				ContentTypeModes: map[string]ContentTypeMode{DefaultProvider: tt.mode},
+			})
+
+			data, err := uc.GetTile(context.Background(), 1, 1, 1)
+			tt.check(t, uc, cacheSvc, data, err)
+		})
+	}
+}
+
+func TestParseContentTypeModes(t *testing.T) {
+	modes, err := ParseContentTypeModes(map[string]string{"default": "convert", "paid": " reject"})
+	if err != nil {
+		t.Fatalf("ParseContentTypeModes failed: %v", err)
+	}
+	if modes["default"] != ContentTypeConvert || modes["paid"] != ContentTypeReject {
+		t.Fatalf("unexpected modes %v", modes)
+	}
+
+	if _, err := ParseContentTypeModes(map[string]string{"default": "transcode"}); !errors.Is(err, ErrInvalidContentTypeMode) {
+		t.Fatalf("expected ErrInvalidContentTypeMode, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package usecase
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+	"golang.org/x/sync/singleflight"
+)
+
+// EarlyRefreshConfig refreshes cached tiles in the background before they
+// expire, with a probability rising as expiry nears (probabilistic early
+// expiration, also known as XFetch). Tiles cached together then do not all
+// expire, and miss, together.
+type EarlyRefreshConfig struct {
+	// TTL is how long the cache keeps a tile. Zero disables early refresh.
+	TTL time.Duration
+	// Delta is about how long refreshing a tile takes. The window in which
+	// tiles are refreshed early scales with it.
+	Delta time.Duration
+	// Beta widens the window above 1 and narrows it below; zero means 1
+	Beta float64
+}
+
+// earlyRefresher decides on and runs early refreshes. Concurrent refreshes
+// of the same tile share one fetch.
+type earlyRefresher struct {
+	ttl   time.Duration
+	delta time.Duration
+	beta  float64
+	// random returns a number in [0, 1), replaced by tests
+	random func() float64
+	group  singleflight.Group
+}
+
+func newEarlyRefresher(cfg EarlyRefreshConfig, random func() float64) *earlyRefresher {
+	if cfg.TTL <= 0 {
+		return nil
+	}
+	beta := cfg.Beta
+	if beta <= 0 {
+		beta = 1
+	}
+	return &earlyRefresher{ttl: cfg.TTL, delta: cfg.Delta, beta: beta, random: random}
+}
+
+// shouldRefreshEarly reports whether a tile served from the cache should be
+// refreshed now. A tile is refreshed once now - delta * beta * ln(r), for a
+// uniform r in (0, 1], passes its expiry, which grows likelier the closer
+// expiry is. Tiles without a store time are never refreshed early.
+func (uc *TileUseCase) shouldRefreshEarly(storedAt *time.Time) bool {
+	r := uc.earlyRefresh
+	if r == nil || storedAt == nil {
+		return false
+	}
+	expiry := storedAt.Add(r.ttl)
+	gap := -float64(r.delta) * r.beta * math.Log(1-r.random())
+	return !uc.now().Add(time.Duration(gap)).Before(expiry)
+}
+
+// refreshEarly fetches the tile of a layer in the background and stores it,
+// whatever the second miss policy, like prefetched tiles.
+func (uc *TileUseCase) refreshEarly(layer string, z, x, y int) {
+	uc.stores.Add(1)
+	go func() {
+		defer uc.stores.Done()
+		uc.earlyRefresh.group.Do(tilemath.LayerKey(layer, z, x, y), func() (any, error) {
+			data, origin, cacheable, err := uc.fetchLayerTile(context.Background(), layer, z, x, y)
+			if err != nil {
+				uc.logger.Debug("failed to refresh tile early", "layer", layer, "z", z, "x", x, "y", y, "error", err)
+				metrics.TilesEarlyRefresh.WithLabelValues("failed").Inc()
+				return nil, nil
+			}
+			metrics.TilesEarlyRefresh.WithLabelValues("refreshed").Inc()
+			if cacheable {
+				uc.storeLayerWithRetry(layer, z, x, y, data, origin)
+			}
+			return nil, nil
+		})
+	}()
+}
@@ -0,0 +1,74 @@
+package usecase
+
+import (
+	"context"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+func TestShouldRefreshEarly_RisesTowardsExpiry(t *testing.T) {
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		EarlyRefresh: EarlyRefreshConfig{TTL: time.Hour, Delta: time.Minute, Beta: 1},
+	})
+	uc.earlyRefresh.random = rand.New(rand.NewPCG(1, 2)).Float64
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	uc.now = func() time.Time { return now }
+
+	const samples = 2000
+	rate := func(age time.Duration) float64 {
+		storedAt := now.Add(-age)
+		refreshed := 0
+		for i := 0; i < samples; i++ {
+			if uc.shouldRefreshEarly(&storedAt) {
+				refreshed++
+			}
+		}
+		return float64(refreshed) / samples
+	}
+
+	ages := []time.Duration{30 * time.Minute, 55 * time.Minute, 58 * time.Minute, 59*time.Minute + 30*time.Second}
+	prev := -1.0
+	for _, age := range ages {
+		got := rate(age)
+		if got <= prev {
+			t.Fatalf("refresh rate %.3f at age %v did not rise from %.3f", got, age, prev)
+		}
+		prev = got
+	}
+	if got := rate(30 * time.Minute); got != 0 {
+		t.Fatalf("expected no refreshes half way to expiry, got rate %.3f", got)
+	}
+	if got := rate(time.Hour); got != 1 {
+		t.Fatalf("expected every request at expiry to refresh, got rate %.3f", got)
+	}
+	if uc.shouldRefreshEarly(nil) {
+		t.Fatal("tiles without a store time must not be refreshed early")
+	}
+}
+
+func TestGetTile_EarlyRefreshStoresFreshTile(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("fresh"))
+
+	storedAt := time.Now().Add(-time.Hour)
+	cacheSvc.put(4, 3, 2, fakeTile{data: []byte("old"), storedAt: &storedAt})
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+		EarlyRefresh:    EarlyRefreshConfig{TTL: time.Hour, Delta: time.Minute},
+	})
+
+	data, err := uc.GetTile(context.Background(), 4, 3, 2)
+	if err != nil {
+		t.Fatalf("GetTile failed: %v", err)
+	}
+	if string(data) != "old" {
+		t.Fatalf("expected the cached tile to be served, got %q", data)
+	}
+	cacheSvc.waitStored(t)
+	if stored, _ := cacheSvc.get(4, 3, 2); string(stored.data) != "fresh" {
+		t.Fatalf("expected the refreshed tile to be stored, got %q", stored.data)
+	}
+}
@@ -0,0 +1,120 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+	"golang.org/x/sync/singleflight"
+)
+
+// SharedFetchConfig bounds the upstream fetches of one tile in flight at
+// once. Requests beyond the limit wait for the shared fetch instead of
+// starting their own, but only for so long, so a stalled fetch does not hold
+// every request for the tile.
+type SharedFetchConfig struct {
+	// MaxFetches is how many fetches of a tile may run at once. Zero lets
+	// every request fetch on its own.
+	MaxFetches int
+	// Wait is how long a request waits for the shared fetch before fetching
+	// on its own
+	Wait time.Duration
+}
+
+// fetchSharing shares one fetch per tile among its requests and counts the
+// fetches of each tile in flight, the shared one included.
+type fetchSharing struct {
+	maxFetches int
+	wait       time.Duration
+	group      singleflight.Group
+
+	mu      sync.Mutex
+	fetches map[string]int
+}
+
+func newFetchSharing(cfg SharedFetchConfig) *fetchSharing {
+	if cfg.MaxFetches <= 0 {
+		return nil
+	}
+	return &fetchSharing{
+		maxFetches: cfg.MaxFetches,
+		wait:       cfg.Wait,
+		fetches:    make(map[string]int),
+	}
+}
+
+// sharedFetchAndCache is fetchAndCache, sharing one fetch of the tile among
+// its requests. While it runs, requests within the fetch limit fetch on
+// their own, the others wait for it up to the configured time. The shared
+// fetch does not stop when the client that started it goes away, the
+// others may still be waiting for it.
+func (uc *TileUseCase) sharedFetchAndCache(ctx context.Context, layer string, z, x, y int) ([]byte, error) {
+	s := uc.fetches
+	if s == nil {
+		return uc.fetchAndCache(ctx, layer, z, x, y)
+	}
+	key := tilemath.LayerKey(layer, z, x, y)
+
+	if s.acquireOwn(key) {
+		metrics.TilesSharedFetch.WithLabelValues("own").Inc()
+		defer s.release(key)
+		return uc.fetchAndCache(ctx, layer, z, x, y)
+	}
+
+	// led is only read once the result arrived, after fn returned
+	led := false
+	results := s.group.DoChan(key, func() (any, error) {
+		led = true
+		s.acquire(key)
+		defer s.release(key)
+		metrics.TilesSharedFetch.WithLabelValues("leader").Inc()
+		return uc.fetchAndCache(context.WithoutCancel(ctx), layer, z, x, y)
+	})
+
+	timer := time.NewTimer(s.wait)
+	defer timer.Stop()
+	select {
+	case r := <-results:
+		if !led {
+			metrics.TilesSharedFetch.WithLabelValues("shared").Inc()
+		}
+		data, _ := r.Val.([]byte)
+		return data, r.Err
+	case <-timer.C:
+		uc.logger.Debug("shared fetch is taking too long, fetching on own",
+			"layer", layer, "z", z, "x", x, "y", y, "wait", s.wait)
+		metrics.TilesSharedFetch.WithLabelValues("timeout").Inc()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return uc.fetchAndCache(ctx, layer, z, x, y)
+}
+
+// acquireOwn counts a fetch of its own for the tile if the shared one runs
+// and the limit leaves room for another.
+func (s *fetchSharing) acquireOwn(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.fetches[key]
+	if n == 0 || n >= s.maxFetches {
+		return false
+	}
+	s.fetches[key]++
+	return true
+}
+
+func (s *fetchSharing) acquire(key string) {
+	s.mu.Lock()
+	s.fetches[key]++
+	s.mu.Unlock()
+}
+
+func (s *fetchSharing) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fetches[key]--; s.fetches[key] <= 0 {
+		delete(s.fetches, key)
+	}
+}
@@ -0,0 +1,156 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForRequests waits until the upstream received n requests.
+func waitForRequests(t *testing.T, requests *atomic.Int64, n int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for requests.Load() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d upstream requests, got %d", n, requests.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGetTile_SharedFetch(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("tile"))
+	upstream.block = make(chan struct{})
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+		SharedFetch:     SharedFetchConfig{MaxFetches: 1, Wait: time.Minute},
+	})
+
+	const requests = 10
+	var wg sync.WaitGroup
+	results := make(chan []byte, requests)
+	get := func() {
+		defer wg.Done()
+		data, err := uc.GetTile(context.Background(), 3, 2, 1)
+		if err != nil {
+			t.Errorf("GetTile failed: %v", err)
+		}
+		results <- data
+	}
+
+	wg.Add(1)
+	go get()
+	waitForRequests(t, &upstream.requests, 1)
+	for i := 1; i < requests; i++ {
+		wg.Add(1)
+		go get()
+	}
+	// Let the followers reach the shared fetch before it finishes
+	time.Sleep(50 * time.Millisecond)
+	close(upstream.block)
+	wg.Wait()
+	close(results)
+
+	for data := range results {
+		if !bytes.Equal(data, []byte("tile")) {
+			t.Fatalf("expected the shared tile, got %q", data)
+		}
+	}
+	if got := upstream.requests.Load(); got != 1 {
+		t.Fatalf("expected the requests to share one fetch, got %d", got)
+	}
+}
+
+func TestGetTile_SharedFetchLeaderStalls(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+
+	// The first fetch stalls until the test ends, later ones answer at once
+	var requests atomic.Int64
+	stall := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			select {
+			case <-stall:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("tile"))
+	}))
+	t.Cleanup(upstream.Close)
+	t.Cleanup(func() { close(stall) })
+
+	const wait = 50 * time.Millisecond
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.URL,
+		SharedFetch:     SharedFetchConfig{MaxFetches: 1, Wait: wait},
+	})
+
+	go uc.GetTile(context.Background(), 3, 2, 1)
+	waitForRequests(t, &requests, 1)
+
+	start := time.Now()
+	data, err := uc.GetTile(context.Background(), 3, 2, 1)
+	if err != nil {
+		t.Fatalf("GetTile failed: %v", err)
+	}
+	if !bytes.Equal(data, []byte("tile")) {
+		t.Fatalf("expected the tile, got %q", data)
+	}
+	if elapsed := time.Since(start); elapsed < wait || elapsed > time.Second {
+		t.Fatalf("expected the request to fetch on its own after %v, took %v", wait, elapsed)
+	}
+}
+
+func TestGetTile_SharedFetchOutlivesLeaderClient(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("tile"))
+	upstream.block = make(chan struct{})
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+		SharedFetch:     SharedFetchConfig{MaxFetches: 1, Wait: time.Minute},
+	})
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := uc.GetTile(leaderCtx, 3, 2, 1)
+		leaderErr <- err
+	}()
+	waitForRequests(t, &upstream.requests, 1)
+
+	follower := make(chan []byte, 1)
+	go func() {
+		data, err := uc.GetTile(context.Background(), 3, 2, 1)
+		if err != nil {
+			t.Errorf("GetTile failed: %v", err)
+		}
+		follower <- data
+	}()
+	// Let the follower reach the shared fetch before the leader goes away
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-leaderErr; err == nil {
+		t.Fatal("expected the cancelled client to fail")
+	}
+	close(upstream.block)
+
+	if data := <-follower; !bytes.Equal(data, []byte("tile")) {
+		t.Fatalf("expected the shared tile, got %q", data)
+	}
+	if got := upstream.requests.Load(); got != 1 {
+		t.Fatalf("expected the follower to share the fetch, got %d upstream requests", got)
+	}
+}
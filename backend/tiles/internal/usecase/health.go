@@ -0,0 +1,48 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// CheckCache reports whether the cache service answers its health check.
+func (uc *TileUseCase) CheckCache(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uc.cacheBaseURL+"/api/v1/healthz", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := uc.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cache unreachable: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cache returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// CheckUpstream reports whether the upstream tile server is reachable. It
+// sends a HEAD request for the world tile, which does not count against the
+// upstream budget. Any answer short of a server error passes, since tile
+// servers may refuse HEAD requests.
+func (uc *TileUseCase) CheckUpstream(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, uc.UpstreamURL(0, 0, 0), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "GuideHelper/1.0 (https://github.com/jaennil/guide_helper)")
+
+	resp, err := uc.upstreamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("upstream unreachable: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+)
+
+var (
+	// ErrUnknownLayer is returned for tiles of a layer that is not
+	// configured.
+	ErrUnknownLayer = errors.New("unknown tile layer")
+	ErrInvalidLayer = errors.New("invalid tile layer")
+)
+
+// LayerConfig is a named tile layer, such as a cycling or satellite style,
+// served from its own upstream next to the default tiles.
+type LayerConfig struct {
+	// URLTemplate is the upstream tile URL with {z}, {x} and {y}
+	// placeholders, and optionally {s} and {r}, as for a URLTemplate, e.g.
+	// "https://{s}.tile.example.org/{z}/{x}/{y}{r}.png"
+	URLTemplate string
+	// Attribution credits the layer's data and style, for clients to show
+	Attribution string
+}
+
+// ParseLayers builds layers from URL templates and attributions keyed by
+// layer name. Every attribution must belong to a layer with a template.
+func ParseLayers(templates, attributions map[string]string) (map[string]LayerConfig, error) {
+	layers := make(map[string]LayerConfig, len(templates))
+	for name, template := range templates {
+		layers[name] = LayerConfig{URLTemplate: template, Attribution: attributions[name]}
+	}
+	for name := range attributions {
+		if _, ok := templates[name]; !ok {
+			return nil, fmt.Errorf("%w: attribution for %s without a url template", ErrInvalidLayer, name)
+		}
+	}
+	return layers, validateLayers(layers)
+}
+
+// validateLayers checks layer names are valid cache key segments and
+// templates are absolute URLs placing the tile coordinates. Unlike other
+// upstreams, layers cannot be given as a base URL.
+func validateLayers(layers map[string]LayerConfig) error {
+	for name, layer := range layers {
+		if err := tilemath.ValidateLayer(name); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidLayer, err)
+		}
+		for _, placeholder := range []string{"{z}", "{x}", "{y}"} {
+			if !strings.Contains(layer.URLTemplate, placeholder) {
+				return fmt.Errorf("%w: url template of %s lacks %s", ErrInvalidLayer, name, placeholder)
+			}
+		}
+		example := strings.NewReplacer("{z}", "0", "{x}", "0", "{y}", "0", "{s}", "a", "{r}", "").Replace(layer.URLTemplate)
+		u, err := url.Parse(example)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: url template of %s is not an http url", ErrInvalidLayer, name)
+		}
+	}
+	return nil
+}
+
+// LayerUpstreamURL returns where a client can fetch a tile of a configured
+// layer from upstream itself.
+func (uc *TileUseCase) LayerUpstreamURL(layer string, z, x, y int) string {
+	return uc.layerURLs[layer].URL(z, x, y)
+}
+
+// Layer returns the configuration of a named layer.
+func (uc *TileUseCase) Layer(name string) (LayerConfig, bool) {
+	layer, ok := uc.layers[name]
+	return layer, ok
+}
+
+// Layers returns the names of the configured layers, sorted.
+func (uc *TileUseCase) Layers() []string {
+	return slices.Sorted(maps.Keys(uc.layers))
+}
+
+// layerProvider names a layer's upstream where fetches are labelled by
+// provider. The colon keeps it apart from provider names, which layer names
+// cannot contain.
+func layerProvider(layer string) string {
+	return "layer:" + layer
+}
+
+// GetLayerTile is GetTile for a tile of a named layer, fetched from the
+// layer's upstream and cached under the layer.
+func (uc *TileUseCase) GetLayerTile(ctx context.Context, layer string, z, x, y int) ([]byte, error) {
+	data, _, err := uc.GetLayerTileTimed(ctx, layer, z, x, y)
+	return data, err
+}
+
+// GetLayerTileTimed is GetTileTimed for a tile of a named layer. It fails
+// with ErrUnknownLayer for layers that are not configured.
+func (uc *TileUseCase) GetLayerTileTimed(ctx context.Context, layer string, z, x, y int) ([]byte, TileInfo, error) {
+	if _, ok := uc.layerURLs[layer]; !ok {
+		return nil, TileInfo{}, fmt.Errorf("%w: %s", ErrUnknownLayer, layer)
+	}
+	return uc.getTileTimed(ctx, layer, z, x, y)
+}
+
+// fetchLayerTile is fetchTile for the tile of a layer, empty for the default
+// one, retrying failed fetches from the layer's upstream.
+func (uc *TileUseCase) fetchLayerTile(ctx context.Context, layer string, z, x, y int) ([]byte, tileOrigin, bool, error) {
+	if layer == "" {
+		return uc.fetchTile(ctx, z, x, y)
+	}
+	if err := uc.upstreamAvailable(z, x, y); err != nil {
+		return nil, tileOrigin{}, false, err
+	}
+	if native := uc.nativeZoomOf(layer); native >= 0 && z > native {
+		return nil, tileOrigin{}, false, fmt.Errorf("%w: %d is above %d", ErrBeyondMaxZoom, z, native)
+	}
+	if err := uc.takeUpstreamBudget(); err != nil {
+		return nil, tileOrigin{}, false, err
+	}
+
+	template := uc.layerURLs[layer]
+	for {
+		upstreamURL := template.URL(z, x, y)
+		uc.logger.Info("fetching from upstream", "layer", layer, "url", upstreamURL)
+		tileData, header, err := uc.fetchUpstream(ctx, layerProvider(layer), upstreamURL)
+		if err == nil {
+			tileData, cacheable := uc.cacheableTile(z, x, y, tileData, header)
+			return tileData, originOf(upstreamURL, header), cacheable, nil
+		}
+		if ctx.Err() != nil || !retryableFetch(err) || !uc.retryAfter(ctx, "upstream", retryAfterOf(err)) {
+			return nil, tileOrigin{}, false, err
+		}
+	}
+}
+
+// GetLayerTileFromCache is GetTileFromCache for a named layer.
+func (uc *TileUseCase) GetLayerTileFromCache(layer string, z, x, y int) ([]byte, TileInfo, error) {
+	if _, ok := uc.layers[layer]; !ok {
+		return nil, TileInfo{}, fmt.Errorf("%w: %s", ErrUnknownLayer, layer)
+	}
+	return uc.getTileFromCache(layer, z, x, y)
+}
@@ -0,0 +1,173 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newLayerCacheService mimics the cache service's tile endpoints of every
+// layer, keyed by their path without the /raw suffix.
+func newLayerCacheService(t *testing.T) (url string, stored <-chan string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	tiles := make(map[string][]byte)
+	storedCh := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := tiles[strings.TrimSuffix(r.URL.Path, "/raw")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		case http.MethodPost:
+			tiles[r.URL.Path], _ = io.ReadAll(r.Body)
+			storedCh <- r.URL.Path
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, storedCh
+}
+
+func TestGetLayerTile_FetchesFromTemplateAndCachesUnderLayer(t *testing.T) {
+	cacheURL, stored := newLayerCacheService(t)
+	jpeg := []byte("\xff\xd8\xff\xe0jpeg")
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	requested := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), paths...)
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(jpeg)
+	}))
+	defer upstream.Close()
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheURL,
+		UpstreamTileURL: upstream.URL + "/default",
+		Layers: map[string]LayerConfig{
+			"satellite": {URLTemplate: upstream.URL + "/imagery/{z}/{y}/{x}", Attribution: "Imagery"},
+		},
+	})
+
+	data, err := uc.GetLayerTile(context.Background(), "satellite", 5, 10, 12)
+	if err != nil || string(data) != string(jpeg) {
+		t.Fatalf("GetLayerTile returned %q, %v", data, err)
+	}
+	if paths := requested(); len(paths) != 1 || paths[0] != "/imagery/5/12/10" {
+		t.Fatalf("upstream saw %v, want the templated path", paths)
+	}
+	select {
+	case path := <-stored:
+		if path != "/api/v1/layers/satellite/tile/5/10/12" {
+			t.Fatalf("tile stored at %s", path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tile was not stored in cache")
+	}
+	uc.WaitForStores()
+
+	if data, err := uc.GetLayerTile(context.Background(), "satellite", 5, 10, 12); err != nil || string(data) != string(jpeg) {
+		t.Fatalf("cached GetLayerTile returned %q, %v", data, err)
+	}
+	if paths := requested(); len(paths) != 1 {
+		t.Fatalf("expected the cached tile to be served, upstream saw %v", paths)
+	}
+	// The default layer's copy of the tile is a separate cache entry
+	if _, _, fresh := uc.lookupCache(context.Background(), 5, 10, 12); fresh {
+		t.Fatal("layer tile served as the default layer's")
+	}
+}
+
+func TestGetLayerTile_SharesTheTilePipeline(t *testing.T) {
+	cacheURL, _ := newLayerCacheService(t)
+	var requests atomic.Int64
+	block := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-block
+		w.Write([]byte("\xff\xd8\xff\xe0jpeg"))
+	}))
+	defer upstream.Close()
+	defer close(block)
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheURL,
+		UpstreamTileURL: upstream.URL + "/default",
+		Layers: map[string]LayerConfig{
+			"satellite": {URLTemplate: upstream.URL + "/imagery/{z}/{y}/{x}"},
+		},
+		MaxZoom:        MaxZoomConfig{Native: map[string]int{"layer:satellite": 5}},
+		ResponseBudget: 50 * time.Millisecond,
+	})
+
+	if _, err := uc.GetLayerTile(context.Background(), "satellite", 6, 20, 24); !errors.Is(err, ErrBeyondMaxZoom) {
+		t.Fatalf("expected ErrBeyondMaxZoom above the layer's max zoom, got %v", err)
+	}
+	if got := requests.Load(); got != 0 {
+		t.Fatalf("expected no upstream request above the max zoom, got %d", got)
+	}
+
+	if _, err := uc.GetLayerTile(context.Background(), "satellite", 5, 10, 12); !errors.Is(err, ErrResponseBudgetExceeded) {
+		t.Fatalf("expected ErrResponseBudgetExceeded for a stalled upstream, got %v", err)
+	}
+}
+
+func TestGetLayerTile_UnknownLayer(t *testing.T) {
+	uc := newTestUseCase(t, TileUseCaseConfig{UpstreamTileURL: "http://upstream.invalid"})
+
+	if _, err := uc.GetLayerTile(context.Background(), "cyclosm", 5, 10, 12); !errors.Is(err, ErrUnknownLayer) {
+		t.Fatalf("expected ErrUnknownLayer, got %v", err)
+	}
+}
+
+func TestParseLayers(t *testing.T) {
+	layers, err := ParseLayers(
+		map[string]string{"osm": "https://tile.example.org/{z}/{x}/{y}.png"},
+		map[string]string{"osm": "© OpenStreetMap contributors"},
+	)
+	if err != nil {
+		t.Fatalf("ParseLayers failed: %v", err)
+	}
+	want := LayerConfig{URLTemplate: "https://tile.example.org/{z}/{x}/{y}.png", Attribution: "© OpenStreetMap contributors"}
+	if layers["osm"] != want {
+		t.Fatalf("unexpected layer %+v", layers["osm"])
+	}
+
+	invalid := []struct {
+		name         string
+		templates    map[string]string
+		attributions map[string]string
+	}{
+		{"bad name", map[string]string{"Satellite": "https://a.example/{z}/{x}/{y}"}, nil},
+		{"missing placeholder", map[string]string{"osm": "https://a.example/{z}/{x}"}, nil},
+		{"relative url", map[string]string{"osm": "/{z}/{x}/{y}.png"}, nil},
+		{"base url", map[string]string{"osm": "https://tile.example.org"}, nil},
+		{"attribution without layer", nil, map[string]string{"osm": "© OpenStreetMap contributors"}},
+	}
+	for _, tt := range invalid {
+		if _, err := ParseLayers(tt.templates, tt.attributions); !errors.Is(err, ErrInvalidLayer) {
+			t.Errorf("%s: expected ErrInvalidLayer, got %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidMaintenanceWindow is returned for windows that do not parse.
+var ErrInvalidMaintenanceWindow = errors.New(`invalid maintenance window, expected "[Mon ]HH:MM-HH:MM"`)
+
+// MaintenanceWindow is a recurring UTC time range during which upstream is
+// known to be unavailable. Windows ending before they start wrap past
+// midnight.
+type MaintenanceWindow struct {
+	// Weekday restricts the window to the day it starts on; nil means daily
+	Weekday *time.Weekday
+	Start   time.Duration
+	End     time.Duration
+}
+
+// ParseMaintenanceWindows parses windows like "02:00-04:00" or
+// "Sun 23:30-01:00".
+func ParseMaintenanceWindows(values []string) ([]MaintenanceWindow, error) {
+	windows := make([]MaintenanceWindow, 0, len(values))
+	for _, value := range values {
+		w, err := parseMaintenanceWindow(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", err, value)
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+func parseMaintenanceWindow(s string) (MaintenanceWindow, error) {
+	var w MaintenanceWindow
+
+	if day, rest, ok := strings.Cut(s, " "); ok {
+		weekday, err := parseWeekday(day)
+		if err != nil {
+			return MaintenanceWindow{}, err
+		}
+		w.Weekday = &weekday
+		s = strings.TrimSpace(rest)
+	}
+
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return MaintenanceWindow{}, ErrInvalidMaintenanceWindow
+	}
+	var err error
+	if w.Start, err = parseClock(from); err != nil {
+		return MaintenanceWindow{}, err
+	}
+	if w.End, err = parseClock(to); err != nil {
+		return MaintenanceWindow{}, err
+	}
+	if w.Start == w.End {
+		return MaintenanceWindow{}, ErrInvalidMaintenanceWindow
+	}
+	return w, nil
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(s, d.String()[:3]) {
+			return d, nil
+		}
+	}
+	return 0, ErrInvalidMaintenanceWindow
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, ErrInvalidMaintenanceWindow
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t falls inside the window.
+func (w MaintenanceWindow) Contains(t time.Time) bool {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	offset := t.Sub(midnight)
+
+	if w.Start < w.End {
+		return w.on(t.Weekday()) && offset >= w.Start && offset < w.End
+	}
+	// Wrapping windows cover the evening of their day and the next morning
+	return (w.on(t.Weekday()) && offset >= w.Start) ||
+		(w.on((t.Weekday()+6)%7) && offset < w.End)
+}
+
+func (w MaintenanceWindow) on(day time.Weekday) bool {
+	return w.Weekday == nil || *w.Weekday == day
+}
+
+// inMaintenanceWindow reports whether upstream is in a scheduled maintenance
+// window right now.
+func (uc *TileUseCase) inMaintenanceWindow() bool {
+	now := uc.now()
+	for _, w := range uc.windows {
+		if w.Contains(now) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGetTile_MaintenanceWindowServesExpiredTile(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("fresh"))
+
+	windows, err := ParseMaintenanceWindows([]string{"02:00-04:00"})
+	if err != nil {
+		t.Fatalf("failed to parse window: %v", err)
+	}
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:       cacheSvc.server.URL,
+		UpstreamTileURL:    upstream.server.URL,
+		MaxServedAge:       time.Hour,
+		MaintenanceWindows: windows,
+	})
+
+	now := time.Date(2026, 10, 16, 3, 0, 0, 0, time.UTC)
+	uc.now = func() time.Time { return now }
+	storedAt := now.Add(-24 * time.Hour)
+	cacheSvc.put(5, 10, 12, fakeTile{data: []byte("expired"), storedAt: &storedAt})
+
+	data, err := uc.GetTile(context.Background(), 5, 10, 12)
+	if err != nil {
+		t.Fatalf("GetTile failed inside the window: %v", err)
+	}
+	if string(data) != "expired" {
+		t.Fatalf("expected the expired tile inside the window, got %q", data)
+	}
+	if _, err := uc.GetTile(context.Background(), 5, 11, 12); !errors.Is(err, ErrMaintenance) {
+		t.Fatalf("expected ErrMaintenance for a miss inside the window, got %v", err)
+	}
+	if got := upstream.requests.Load(); got != 0 {
+		t.Fatalf("expected no upstream requests inside the window, got %d", got)
+	}
+
+	now = time.Date(2026, 10, 16, 5, 0, 0, 0, time.UTC)
+	data, err = uc.GetTile(context.Background(), 5, 10, 12)
+	if err != nil {
+		t.Fatalf("GetTile failed outside the window: %v", err)
+	}
+	if string(data) != "fresh" {
+		t.Fatalf("expected a refreshed tile outside the window, got %q", data)
+	}
+	if got := upstream.requests.Load(); got != 1 {
+		t.Fatalf("expected 1 upstream request outside the window, got %d", got)
+	}
+}
+
+func TestMaintenanceWindow_Contains(t *testing.T) {
+	// 2026-10-18 is a Sunday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		window string
+		at     time.Time
+		want   bool
+	}{
+		{window: "02:00-04:00", at: at(16, 2, 0), want: true},
+		{window: "02:00-04:00", at: at(16, 4, 0), want: false},
+		{window: "23:30-01:00", at: at(16, 23, 45), want: true},
+		{window: "23:30-01:00", at: at(17, 0, 30), want: true},
+		{window: "23:30-01:00", at: at(17, 1, 30), want: false},
+		{window: "Sun 23:30-01:00", at: at(18, 23, 45), want: true},
+		{window: "Sun 23:30-01:00", at: at(19, 0, 30), want: true},
+		{window: "Sun 23:30-01:00", at: at(17, 23, 45), want: false},
+		{window: "sat 10:00-11:00", at: at(17, 10, 15), want: true},
+		{window: "sat 10:00-11:00", at: at(16, 10, 15), want: false},
+	}
+
+	for _, tt := range tests {
+		windows, err := ParseMaintenanceWindows([]string{tt.window})
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", tt.window, err)
+		}
+		if got := windows[0].Contains(tt.at); got != tt.want {
+			t.Errorf("%q contains %s = %v, want %v", tt.window, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestParseMaintenanceWindows_Invalid(t *testing.T) {
+	for _, value := range []string{"02:00", "25:00-26:00", "Funday 02:00-03:00", "02:00-02:00"} {
+		if _, err := ParseMaintenanceWindows([]string{value}); !errors.Is(err, ErrInvalidMaintenanceWindow) {
+			t.Errorf("expected ErrInvalidMaintenanceWindow for %q, got %v", value, err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package usecase
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"strings"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/tilemath"
+)
+
+// ErrBeyondMaxZoom is returned for tiles above the zoom upstream serves when
+// neither overzoom nor a placeholder is configured.
+var ErrBeyondMaxZoom = errors.New("zoom beyond the provider's max zoom")
+
+// MaxZoomConfig keeps requests above the zoom providers serve from reaching
+// upstream, which would only answer 404.
+type MaxZoomConfig struct {
+	// Native is the highest zoom each provider serves, keyed like Signers,
+	// and each named layer's upstream, keyed "layer:<name>". Upstreams
+	// without an entry serve every zoom.
+	Native map[string]int
+	// Overzoom serves tiles above the native zoom by upscaling the part of
+	// their ancestor at the native zoom they cover
+	Overzoom bool
+	// Placeholder is served for such tiles without overzoom. Nil fails them
+	// with ErrBeyondMaxZoom.
+	Placeholder []byte
+}
+
+func validateMaxZoom(cfg MaxZoomConfig, providers map[string]string, layers map[string]LayerConfig) error {
+	for provider, z := range cfg.Native {
+		_, isProvider := providers[provider]
+		layer, isLayer := strings.CutPrefix(provider, layerProvider(""))
+		if isLayer {
+			_, isLayer = layers[layer]
+		}
+		if !isProvider && !isLayer && provider != DefaultProvider {
+			return fmt.Errorf("%w: max zoom for %s", ErrUnknownProvider, provider)
+		}
+		if z < 0 || z > tilemath.MaxZoom {
+			return fmt.Errorf("max zoom for %s must be between 0 and %d, got %d", provider, tilemath.MaxZoom, z)
+		}
+	}
+	return nil
+}
+
+// servesZoom reports whether a provider serves tiles at zoom z.
+func (uc *TileUseCase) servesZoom(provider string, z int) bool {
+	native, ok := uc.maxZoom.Native[provider]
+	return !ok || z <= native
+}
+
+// nativeZoom is the highest zoom upstream serves, or -1 without a limit.
+// With weighted providers it is the highest among them, since fetches skip
+// the providers that do not serve a zoom.
+func (uc *TileUseCase) nativeZoom() int {
+	if uc.upstreams == nil {
+		if native, ok := uc.maxZoom.Native[DefaultProvider]; ok {
+			return native
+		}
+		return -1
+	}
+
+	highest := -1
+	for _, name := range uc.upstreams.names() {
+		native, ok := uc.maxZoom.Native[name]
+		if !ok {
+			return -1
+		}
+		highest = max(highest, native)
+	}
+	return highest
+}
+
+// nativeZoomOf is nativeZoom for the upstream of a layer, empty for the
+// default one.
+func (uc *TileUseCase) nativeZoomOf(layer string) int {
+	if layer == "" {
+		return uc.nativeZoom()
+	}
+	if native, ok := uc.maxZoom.Native[layerProvider(layer)]; ok {
+		return native
+	}
+	return -1
+}
+
+// beyondMaxZoom serves a tile above the native zoom without asking upstream
+// for it: overzoomed from its ancestor, which get serves, or as the
+// placeholder.
+func (uc *TileUseCase) beyondMaxZoom(z, x, y, native int, get func(z, x, y int) ([]byte, TileInfo, error)) ([]byte, TileInfo, error) {
+	if !uc.maxZoom.Overzoom {
+		if uc.maxZoom.Placeholder != nil {
+			metrics.TilesBeyondMaxZoom.WithLabelValues("placeholder").Inc()
+			return uc.maxZoom.Placeholder, TileInfo{}, nil
+		}
+		metrics.TilesBeyondMaxZoom.WithLabelValues("rejected").Inc()
+		return nil, TileInfo{}, fmt.Errorf("%w: %d is above %d", ErrBeyondMaxZoom, z, native)
+	}
+
+	shift := z - native
+	parent, info, err := get(native, x>>shift, y>>shift)
+	// The parent's ETag does not describe the overzoomed tile
+	info.ETag = ""
+	if err != nil {
+		return nil, info, err
+	}
+	data, err := overzoom(parent, shift, x, y)
+	if err != nil {
+		uc.logger.Warn("failed to overzoom tile", "z", z, "x", x, "y", y, "native_zoom", native, "error", err)
+		return nil, info, err
+	}
+	metrics.TilesBeyondMaxZoom.WithLabelValues("overzoomed").Inc()
+	return data, info, nil
+}
+
+// overzoom crops the part of parent covered by tile x, y shift zooms below it
+// and scales it back up to the parent's size, as a PNG. Nearest neighbour
+// scaling keeps labels and lines crisp rather than blurred.
+func overzoom(parent []byte, shift, x, y int) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(parent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode parent tile: %w", err)
+	}
+
+	b := img.Bounds()
+	width, height := b.Dx()>>shift, b.Dy()>>shift
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("parent tile of %dx%d is too small to overzoom %d levels", b.Dx(), b.Dy(), shift)
+	}
+	mask := 1<<shift - 1
+	left, top := b.Min.X+(x&mask)*width, b.Min.Y+(y&mask)*height
+
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for py := 0; py < b.Dy(); py++ {
+		for px := 0; px < b.Dx(); px++ {
+			out.Set(px, py, img.At(left+px>>shift, top+py>>shift))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		return nil, fmt.Errorf("failed to encode overzoomed tile: %w", err)
+	}
+	return buf.Bytes(), nil
+}
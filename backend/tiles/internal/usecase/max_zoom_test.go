@@ -0,0 +1,115 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// gridTile is a 256x256 PNG split into a 4x4 grid of 64px cells, each with
+// its own colour, so the cell a zoom+2 tile covers can be told apart.
+func gridTile(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			img.Set(x, y, gridColor(x/64, y/64))
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func gridColor(cx, cy int) color.RGBA {
+	return color.RGBA{R: uint8(cx * 60), G: uint8(cy * 60), B: 100, A: 255}
+}
+
+func TestGetTile_BeyondMaxZoom(t *testing.T) {
+	// tile 21/41/83 covers cell 1, 3 of its zoom 19 ancestor 19/10/20
+	const z, x, y = 21, 41, 83
+
+	t.Run("overzoom", func(t *testing.T) {
+		cacheSvc := newFakeCacheService(t)
+		cacheSvc.put(19, 10, 20, fakeTile{data: gridTile(t)})
+		upstream := newFakeUpstream(t, []byte("upstream"))
+
+		uc := newTestUseCase(t, TileUseCaseConfig{
+			CacheBaseURL:    cacheSvc.server.URL,
+			UpstreamTileURL: upstream.server.URL,
+			MaxZoom: MaxZoomConfig{
+				Native:   map[string]int{DefaultProvider: 19},
+				Overzoom: true,
+			},
+		})
+
+		data, err := uc.GetTile(context.Background(), z, x, y)
+		if err != nil {
+			t.Fatalf("GetTile failed: %v", err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("expected a PNG, got %v", err)
+		}
+		if b := img.Bounds(); b.Dx() != 256 || b.Dy() != 256 {
+			t.Fatalf("expected a 256x256 tile, got %dx%d", b.Dx(), b.Dy())
+		}
+		want := gridColor(1, 3)
+		for _, p := range []image.Point{{0, 0}, {128, 128}, {255, 255}} {
+			if got := color.RGBAModel.Convert(img.At(p.X, p.Y)); got != want {
+				t.Fatalf("pixel %v: expected %v, got %v", p, want, got)
+			}
+		}
+		if got := upstream.requests.Load(); got != 0 {
+			t.Fatalf("expected no upstream requests, got %d", got)
+		}
+	})
+
+	t.Run("placeholder", func(t *testing.T) {
+		cacheSvc := newFakeCacheService(t)
+		upstream := newFakeUpstream(t, []byte("upstream"))
+		placeholder := []byte("placeholder")
+
+		uc := newTestUseCase(t, TileUseCaseConfig{
+			CacheBaseURL:    cacheSvc.server.URL,
+			UpstreamTileURL: upstream.server.URL,
+			MaxZoom: MaxZoomConfig{
+				Native:      map[string]int{DefaultProvider: 19},
+				Placeholder: placeholder,
+			},
+		})
+
+		data, err := uc.GetTile(context.Background(), z, x, y)
+		if err != nil {
+			t.Fatalf("GetTile failed: %v", err)
+		}
+		if !bytes.Equal(data, placeholder) {
+			t.Fatalf("expected the placeholder, got %q", data)
+		}
+		if got := upstream.requests.Load(); got != 0 {
+			t.Fatalf("expected no upstream requests, got %d", got)
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		cacheSvc := newFakeCacheService(t)
+		upstream := newFakeUpstream(t, []byte("upstream"))
+
+		uc := newTestUseCase(t, TileUseCaseConfig{
+			CacheBaseURL:    cacheSvc.server.URL,
+			UpstreamTileURL: upstream.server.URL,
+			MaxZoom:         MaxZoomConfig{Native: map[string]int{DefaultProvider: 19}},
+		})
+
+		if _, err := uc.GetTile(context.Background(), z, x, y); !errors.Is(err, ErrBeyondMaxZoom) {
+			t.Fatalf("expected ErrBeyondMaxZoom, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package usecase
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+)
+
+// SecondMissConfig enables caching a tile only once it has missed the cache
+// twice within Window, so one-off requests such as scrapers walking random
+// coordinates do not fill the persistent cache.
+type SecondMissConfig struct {
+	// Window is how long a first miss is remembered. Zero caches every miss.
+	Window time.Duration
+	// Capacity bounds how many first misses are remembered; the oldest are
+	// forgotten first.
+	Capacity int
+}
+
+// missTracker remembers recent first misses in a bounded LRU.
+type missTracker struct {
+	mu       sync.Mutex
+	window   time.Duration
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type missEntry struct {
+	key    string
+	seenAt time.Time
+}
+
+func newMissTracker(cfg SecondMissConfig) *missTracker {
+	if cfg.Window <= 0 {
+		return nil
+	}
+	capacity := cfg.Capacity
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	return &missTracker{
+		window:   cfg.Window,
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// repeated records a miss for the tile of a layer at now and reports
+// whether it missed before within the window. A repeated miss is forgotten,
+// so the tile is only cached once per pair of misses. A nil tracker reports
+// every miss as repeated.
+func (t *missTracker) repeated(layer string, z, x, y int, now time.Time) bool {
+	if t == nil {
+		return true
+	}
+	key := tilemath.LayerKey(layer, z, x, y)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if e, ok := t.items[key]; ok {
+		entry := e.Value.(*missEntry)
+		if now.Sub(entry.seenAt) <= t.window {
+			t.order.Remove(e)
+			delete(t.items, key)
+			return true
+		}
+		entry.seenAt = now
+		t.order.MoveToFront(e)
+		return false
+	}
+
+	t.items[key] = t.order.PushFront(&missEntry{key: key, seenAt: now})
+	for t.order.Len() > t.capacity {
+		oldest := t.order.Back()
+		t.order.Remove(oldest)
+		delete(t.items, oldest.Value.(*missEntry).key)
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMissTracker_ForgetsOldestBeyondCapacity(t *testing.T) {
+	tracker := newMissTracker(SecondMissConfig{Window: time.Hour, Capacity: 2})
+	now := time.Now()
+
+	tracker.repeated("", 1, 0, 0, now)
+	tracker.repeated("", 1, 0, 1, now)
+	tracker.repeated("", 1, 1, 0, now)
+
+	if tracker.repeated("", 1, 0, 0, now) {
+		t.Fatal("expected the oldest miss to be forgotten")
+	}
+	if !tracker.repeated("", 1, 1, 0, now) {
+		t.Fatal("expected the newest miss to be remembered")
+	}
+}
@@ -0,0 +1,101 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	tilekey "github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/tilemath"
+	"golang.org/x/sync/singleflight"
+)
+
+// NeighborPrefetchConfig warms the tiles around a cache miss, since a
+// panning client is likely to request them next.
+type NeighborPrefetchConfig struct {
+	Enabled bool
+	// Radius is how many tiles around the miss are warmed; 1 warms the 8
+	// surrounding tiles
+	Radius int
+	// MinInterval is the minimum delay between two neighbor fetches
+	MinInterval time.Duration
+	// MaxPending bounds the neighbor warms in flight; beyond it further
+	// neighbors are dropped rather than queued
+	MaxPending int
+}
+
+// neighborPrefetcher warms neighbors in the background. Concurrent warms of
+// the same tile, e.g. from two misses next to each other, share one fetch.
+type neighborPrefetcher struct {
+	radius  int
+	pacer   *pacer
+	pending chan struct{}
+	group   singleflight.Group
+}
+
+func newNeighborPrefetcher(cfg NeighborPrefetchConfig) *neighborPrefetcher {
+	if !cfg.Enabled || cfg.Radius <= 0 {
+		return nil
+	}
+	maxPending := cfg.MaxPending
+	if maxPending <= 0 {
+		maxPending = 64
+	}
+	return &neighborPrefetcher{
+		radius:  cfg.Radius,
+		pacer:   newPacer(cfg.MinInterval),
+		pending: make(chan struct{}, maxPending),
+	}
+}
+
+// warmNeighbors starts warming the tiles of the layer around a miss without
+// waiting for them. Warmed tiles are stored like prefetched ones, regardless of the
+// second miss policy.
+func (uc *TileUseCase) warmNeighbors(layer string, z, x, y int) {
+	if uc.neighbors == nil || uc.maintenance.Load() || uc.inMaintenanceWindow() {
+		return
+	}
+
+	for _, t := range tilemath.Neighbors(z, x, y, uc.neighbors.radius) {
+		select {
+		case uc.neighbors.pending <- struct{}{}:
+		default:
+			metrics.TilesNeighborPrefetch.WithLabelValues("dropped").Inc()
+			continue
+		}
+
+		uc.stores.Add(1)
+		go func() {
+			defer uc.stores.Done()
+			defer func() { <-uc.neighbors.pending }()
+
+			uc.neighbors.group.Do(tilekey.LayerKey(layer, t.Z, t.X, t.Y), func() (any, error) {
+				uc.warmNeighbor(layer, t)
+				return nil, nil
+			})
+		}()
+	}
+}
+
+func (uc *TileUseCase) warmNeighbor(layer string, t tilemath.Tile) {
+	if _, ok := uc.lookupLayerCache(context.Background(), layer, t.Z, t.X, t.Y); ok {
+		metrics.TilesNeighborPrefetch.WithLabelValues("cached").Inc()
+		return
+	}
+
+	ctx := context.Background()
+	if err := uc.neighbors.pacer.Wait(ctx); err != nil {
+		return
+	}
+
+	data, origin, cacheable, err := uc.fetchLayerTile(ctx, layer, t.Z, t.X, t.Y)
+	if err != nil {
+		uc.logger.Debug("failed to warm neighbor tile", "layer", layer, "z", t.Z, "x", t.X, "y", t.Y, "error", err)
+		metrics.TilesNeighborPrefetch.WithLabelValues("failed").Inc()
+		return
+	}
+	metrics.TilesNeighborPrefetch.WithLabelValues("fetched").Inc()
+	if cacheable {
+		uc.storeLayerWithRetry(layer, t.Z, t.X, t.Y, data, origin)
+	}
+}
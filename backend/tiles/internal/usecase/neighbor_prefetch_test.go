@@ -0,0 +1,104 @@
+package usecase
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	tilekey "github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/tilemath"
+)
+
+func TestGetTile_WarmsNeighborsInBackground(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+
+	// Neighbor fetches are held until released, the requested tile is not
+	release := make(chan struct{})
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = true
+		mu.Unlock()
+		if r.URL.Path != "/5/10/12.png" {
+			<-release
+		}
+		w.Write([]byte("tile"))
+	}))
+	t.Cleanup(upstream.Close)
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:     cacheSvc.server.URL,
+		UpstreamTileURL:  upstream.URL,
+		NeighborPrefetch: NeighborPrefetchConfig{Enabled: true, Radius: 1},
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := uc.GetTile(context.Background(), 5, 10, 12)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("GetTile failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetTile waited for the neighbor fetches")
+	}
+
+	close(release)
+	uc.WaitForStores()
+
+	neighbors := tilemath.Neighbors(5, 10, 12, 1)
+	if len(neighbors) != 8 {
+		t.Fatalf("expected 8 neighbors, got %d", len(neighbors))
+	}
+	for _, n := range neighbors {
+		mu.Lock()
+		fetched := requested["/"+tilekey.Key(n.Z, n.X, n.Y)+".png"]
+		mu.Unlock()
+		if !fetched {
+			t.Fatalf("expected neighbor %v to be fetched", n)
+		}
+		if _, cached := cacheSvc.get(n.Z, n.X, n.Y); !cached {
+			t.Fatalf("expected neighbor %v to be cached", n)
+		}
+	}
+	if len(requested) != 9 {
+		t.Fatalf("expected 9 upstream requests, got %d", len(requested))
+	}
+}
+
+func TestWarmNeighbors_DropsBeyondMaxPending(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("tile"))
+	}))
+	t.Cleanup(upstream.Close)
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:     cacheSvc.server.URL,
+		UpstreamTileURL:  upstream.URL,
+		NeighborPrefetch: NeighborPrefetchConfig{Enabled: true, Radius: 1, MaxPending: 3},
+	})
+
+	uc.warmNeighbors("", 5, 10, 12)
+	close(release)
+	uc.WaitForStores()
+
+	stored := 0
+	for _, n := range tilemath.Neighbors(5, 10, 12, 1) {
+		if _, cached := cacheSvc.get(n.Z, n.X, n.Y); cached {
+			stored++
+		}
+	}
+	if stored != 3 {
+		t.Fatalf("expected 3 warmed neighbors, got %d", stored)
+	}
+}
@@ -0,0 +1,74 @@
+package usecase
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// keptPNGChunks are the ancillary chunks that change how a tile renders:
+// transparency and colour management. Text, timestamps, physical size and
+// the like are dropped.
+var keptPNGChunks = map[string]bool{
+	"tRNS": true,
+	"gAMA": true,
+	"cHRM": true,
+	"sRGB": true,
+	"iCCP": true,
+	"sBIT": true,
+}
+
+// stripPNGChunks removes ancillary chunks that do not affect the rendered
+// image, along with anything after IEND. Critical chunks, including unknown
+// ones, are copied unchanged with their CRCs. Data that is not a well-formed
+// PNG is returned as is.
+func stripPNGChunks(data []byte) []byte {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return data
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+	rest := data[len(pngSignature):]
+	ended := false
+	for len(rest) > 0 && !ended {
+		// length, type, data and CRC
+		if len(rest) < 12 {
+			return data
+		}
+		length := binary.BigEndian.Uint32(rest)
+		if uint64(length) > uint64(len(rest)-12) {
+			return data
+		}
+		size := 12 + int(length)
+		chunkType := string(rest[4:8])
+
+		// Lowercase first letter marks an ancillary chunk
+		critical := chunkType[0]&0x20 == 0
+		if critical || keptPNGChunks[chunkType] {
+			out = append(out, rest[:size]...)
+		}
+		rest = rest[size:]
+		ended = chunkType == "IEND"
+	}
+	if !ended {
+		return data
+	}
+	return out
+}
+
+// optimizeTile strips PNG chunks when enabled, returning the tile unchanged
+// otherwise.
+func (uc *TileUseCase) optimizeTile(data []byte) []byte {
+	if !uc.optimizePNG {
+		return data
+	}
+	optimized := stripPNGChunks(data)
+	if saved := len(data) - len(optimized); saved > 0 {
+		metrics.TilesPNGBytesSaved.Add(float64(saved))
+	}
+	return optimized
+}
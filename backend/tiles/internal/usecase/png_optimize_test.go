@@ -0,0 +1,82 @@
+package usecase
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// pngChunk encodes a chunk with its length and CRC.
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+func TestStripPNGChunks(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 7)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+	encoded := buf.Bytes()
+
+	// Insert metadata chunks after IHDR, which is 8+25 bytes in
+	ihdrEnd := len(pngSignature) + 25
+	var original []byte
+	original = append(original, encoded[:ihdrEnd]...)
+	original = append(original, pngChunk("tEXt", []byte("Comment\x00rendered by a tile server"))...)
+	original = append(original, pngChunk("tIME", []byte{0x07, 0xea, 10, 16, 12, 0, 0})...)
+	original = append(original, pngChunk("gAMA", []byte{0, 0, 0xb1, 0x8f})...)
+	original = append(original, encoded[ihdrEnd:]...)
+
+	optimized := stripPNGChunks(original)
+	if len(optimized) >= len(original) {
+		t.Fatalf("expected the optimized tile to be smaller, got %d >= %d bytes", len(optimized), len(original))
+	}
+	if bytes.Contains(optimized, []byte("tEXt")) || bytes.Contains(optimized, []byte("tIME")) {
+		t.Fatal("expected text and time chunks to be removed")
+	}
+	if !bytes.Contains(optimized, []byte("gAMA")) {
+		t.Fatal("expected the gamma chunk to be kept")
+	}
+
+	before, err := png.Decode(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("failed to decode original: %v", err)
+	}
+	after, err := png.Decode(bytes.NewReader(optimized))
+	if err != nil {
+		t.Fatalf("failed to decode optimized tile: %v", err)
+	}
+	if before.Bounds() != after.Bounds() {
+		t.Fatalf("bounds changed from %v to %v", before.Bounds(), after.Bounds())
+	}
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			if color.NRGBAModel.Convert(before.At(x, y)) != color.NRGBAModel.Convert(after.At(x, y)) {
+				t.Fatalf("pixel %d,%d differs", x, y)
+			}
+		}
+	}
+}
+
+func TestStripPNGChunks_LeavesMalformedDataAlone(t *testing.T) {
+	for _, data := range [][]byte{
+		[]byte("not a png"),
+		append(append([]byte{}, pngSignature...), pngChunk("IHDR", make([]byte, 13))...), // no IEND
+		append(append([]byte{}, pngSignature...), 0, 0, 1, 0, 'I', 'H'),
+	} {
+		if got := stripPNGChunks(data); !bytes.Equal(got, data) {
+			t.Fatalf("expected %q unchanged, got %q", data, got)
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase/seeder"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/tilemath"
+)
+
+var (
+	ErrPrefetchTooLarge = errors.New("prefetch request covers too many tiles")
+	ErrInvalidZoomRange = errors.New("invalid zoom range")
+	ErrBudgetExhausted  = errors.New("daily upstream request budget exhausted")
+)
+
+type PrefetchConfig struct {
+	Workers int
+	// MinInterval is the minimum delay between two upstream requests across
+	// all workers, as required by the OSM bulk download policy
+	MinInterval time.Duration
+	// DailyBudget caps upstream requests per UTC day. Zero disables the cap.
+	DailyBudget int
+	// BudgetFile persists budget usage so restarts do not reset it
+	BudgetFile string
+	MaxTiles   int
+	// JobTTL is how long finished jobs stay queryable. Zero keeps them.
+	JobTTL time.Duration
+	// MaxRunningJobs is how many jobs run at once, later ones queue. Zero
+	// runs every job right away.
+	MaxRunningJobs int
+	// JobStateFile persists job states so they can be polled after a
+	// restart. Empty keeps them in memory only.
+	JobStateFile string
+}
+
+type PrefetchRequest struct {
+	BBox    tilemath.BBox
+	MinZoom int
+	MaxZoom int
+}
+
+type PrefetchResult struct {
+	Total           int  `json:"total"`
+	Cached          int  `json:"cached"`
+	Fetched         int  `json:"fetched"`
+	Failed          int  `json:"failed"`
+	BudgetExhausted bool `json:"budget_exhausted"`
+}
+
+// Prefetcher warms the cache for a region while staying within the
+// upstream usage policy. Its background jobs, cache purges included, run
+// under a seeder.Manager.
+type Prefetcher struct {
+	tiles    *TileUseCase
+	workers  int
+	maxTiles int
+	pacer    *pacer
+	budget   *periodBudget
+	logger   logger.Logger
+	jobs     *seeder.Manager
+}
+
+// NewPrefetcher creates a prefetcher whose background jobs stop when ctx is
+// cancelled.
+func NewPrefetcher(ctx context.Context, tiles *TileUseCase, cfg PrefetchConfig, l logger.Logger) (*Prefetcher, error) {
+	budget, err := loadDailyBudget(cfg.BudgetFile, cfg.DailyBudget, time.Now)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := seeder.NewManager(ctx, seeder.Config{
+		Workers:   cfg.MaxRunningJobs,
+		StateFile: cfg.JobStateFile,
+		TTL:       cfg.JobTTL,
+	}, l)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	return &Prefetcher{
+		tiles:    tiles,
+		workers:  workers,
+		maxTiles: cfg.MaxTiles,
+		pacer:    newPacer(cfg.MinInterval),
+		budget:   budget,
+		logger:   l,
+		jobs:     jobs,
+	}, nil
+}
+
+// Plan validates the request and returns the number of tiles it covers.
+func (p *Prefetcher) Plan(req PrefetchRequest) (int, error) {
+	total, err := req.count()
+	if err != nil {
+		return 0, err
+	}
+	if p.maxTiles > 0 && total > p.maxTiles {
+		return 0, fmt.Errorf("%w: %d tiles, limit is %d", ErrPrefetchTooLarge, total, p.maxTiles)
+	}
+	return total, nil
+}
+
+// count validates the region and returns the number of tiles it covers.
+func (req PrefetchRequest) count() (int, error) {
+	if err := req.BBox.Validate(); err != nil {
+		return 0, err
+	}
+	if req.MinZoom < 0 || req.MaxZoom > tilemath.MaxZoom || req.MinZoom > req.MaxZoom {
+		return 0, ErrInvalidZoomRange
+	}
+	return tilemath.CountInBBox(req.BBox, req.MinZoom, req.MaxZoom), nil
+}
+
+// PlanWarm validates a list of tiles to warm and returns its size.
+func (p *Prefetcher) PlanWarm(tiles []tilemath.Tile) (int, error) {
+	if p.maxTiles > 0 && len(tiles) > p.maxTiles {
+		return 0, fmt.Errorf("%w: %d tiles, limit is %d", ErrPrefetchTooLarge, len(tiles), p.maxTiles)
+	}
+	return len(tiles), nil
+}
+
+// Start validates the request and prefetches it in the background. The
+// returned status carries the job ID to poll with JobStatus.
+func (p *Prefetcher) Start(req PrefetchRequest) (JobStatus, error) {
+	return p.startBBox("prefetch", req)
+}
+
+// StartSeed is Start for seed jobs, which preload a region on request of
+// an operator rather than an internal caller. They share the pacing, the
+// budgets and the job store with prefetch jobs.
+func (p *Prefetcher) StartSeed(req PrefetchRequest) (JobStatus, error) {
+	return p.startBBox("seed", req)
+}
+
+func (p *Prefetcher) startBBox(name string, req PrefetchRequest) (JobStatus, error) {
+	total, err := p.Plan(req)
+	if err != nil {
+		return JobStatus{}, err
+	}
+	return p.startJob(name, total, func(ctx context.Context, progress *seeder.Progress) error {
+		_, err := p.run(ctx, progress, total, eachTileInBBox(req))
+		return err
+	})
+}
+
+// StartWarm validates the list and warms the cache with it in the
+// background, e.g. to restore recently popular tiles after a flush.
+func (p *Prefetcher) StartWarm(tiles []tilemath.Tile) (JobStatus, error) {
+	total, err := p.PlanWarm(tiles)
+	if err != nil {
+		return JobStatus{}, err
+	}
+	return p.startJob("warm", total, func(ctx context.Context, progress *seeder.Progress) error {
+		_, err := p.run(ctx, progress, total, eachTile(tiles))
+		return err
+	})
+}
+
+// StartPurge removes the tiles of a region from the cache in the
+// background, one zoom level at a time, so the job reports progress and can
+// be cancelled between levels. Purging never contacts upstream, so neither
+// the budgets, maintenance nor the tile limit apply.
+func (p *Prefetcher) StartPurge(req PrefetchRequest) (JobStatus, error) {
+	total, err := req.count()
+	if err != nil {
+		return JobStatus{}, err
+	}
+	return p.jobs.Start("purge", total, func(ctx context.Context, progress *seeder.Progress) error {
+		for z := req.MinZoom; z <= req.MaxZoom; z++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			removed, err := p.tiles.purgeCache(ctx, req.BBox, z)
+			if err != nil {
+				return fmt.Errorf("purge zoom %d: %w", z, err)
+			}
+			progress.Removed.Add(removed)
+			progress.Done.Add(int64(tilemath.CountInBBox(req.BBox, z, z)))
+		}
+		return nil
+	}), nil
+}
+
+func (p *Prefetcher) startJob(name string, total int, run seeder.RunFunc) (JobStatus, error) {
+	if p.tiles.Maintenance() {
+		return JobStatus{}, ErrMaintenance
+	}
+	if p.budget.Exhausted() {
+		return JobStatus{}, ErrBudgetExhausted
+	}
+	if p.tiles.UpstreamBudgetExhausted() {
+		return JobStatus{}, ErrUpstreamBudgetExhausted
+	}
+
+	return p.jobs.Start(name, total, run), nil
+}
+
+// JobStatus reports the progress of a job started by the prefetcher. It
+// fails with ErrJobNotFound for unknown or expired jobs.
+func (p *Prefetcher) JobStatus(id string) (JobStatus, error) {
+	return p.jobs.Get(id)
+}
+
+// CancelJob stops a queued or running job. It fails with ErrJobNotFound for
+// unknown jobs and ErrJobFinished for jobs that already ended.
+func (p *Prefetcher) CancelJob(id string) (JobStatus, error) {
+	return p.jobs.Cancel(id)
+}
+
+// SetMinInterval changes the pacing of upstream fetches made from now on,
+// running jobs included.
+func (p *Prefetcher) SetMinInterval(interval time.Duration) {
+	p.pacer.SetInterval(interval)
+}
+
+// Wait blocks until every background job has returned. Jobs stop once the
+// context given to NewPrefetcher is cancelled.
+func (p *Prefetcher) Wait() {
+	p.jobs.Wait()
+}
+
+// Prefetch fetches every tile of the request that is not cached yet. It
+// pauses with ErrBudgetExhausted once the daily budget is used up, and with
+// ErrUpstreamBudgetExhausted or ErrMaintenance once upstream is unavailable.
+func (p *Prefetcher) Prefetch(ctx context.Context, req PrefetchRequest) (PrefetchResult, error) {
+	total, err := p.Plan(req)
+	if err != nil {
+		return PrefetchResult{}, err
+	}
+
+	return p.run(ctx, &seeder.Progress{}, total, eachTileInBBox(req))
+}
+
+// Warm fetches every listed tile that is not cached yet, under the same
+// pacing and budgets as Prefetch.
+func (p *Prefetcher) Warm(ctx context.Context, tiles []tilemath.Tile) (PrefetchResult, error) {
+	total, err := p.PlanWarm(tiles)
+	if err != nil {
+		return PrefetchResult{}, err
+	}
+
+	return p.run(ctx, &seeder.Progress{}, total, eachTile(tiles))
+}
+
+func eachTileInBBox(req PrefetchRequest) func(fn func(tilemath.Tile) bool) {
+	return func(fn func(tilemath.Tile) bool) {
+		tilemath.TilesInBBox(req.BBox, req.MinZoom, req.MaxZoom, fn)
+	}
+}
+
+func eachTile(tiles []tilemath.Tile) func(fn func(tilemath.Tile) bool) {
+	return func(fn func(tilemath.Tile) bool) {
+		for _, t := range tiles {
+			if !fn(t) {
+				return
+			}
+		}
+	}
+}
+
+// run feeds the tiles produced by each to the worker pool, counting them in
+// progress as they are done.
+func (p *Prefetcher) run(ctx context.Context, progress *seeder.Progress, total int, each func(fn func(tilemath.Tile) bool)) (PrefetchResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cached, fetched, failed := &progress.Cached, &progress.Fetched, &progress.Failed
+	exhausted := &progress.BudgetExhausted
+
+	// stop ends the job early, keeping the first reason
+	var stopErr error
+	var stopOnce sync.Once
+	stop := func(err error) {
+		stopOnce.Do(func() {
+			stopErr = err
+			cancel()
+		})
+	}
+
+	coords := make(chan tilemath.Tile)
+	go func() {
+		defer close(coords)
+		each(func(t tilemath.Tile) bool {
+			select {
+			case coords <- t:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range coords {
+				if _, _, ok := p.tiles.lookupCache(ctx, t.Z, t.X, t.Y); ok {
+					cached.Add(1)
+					progress.Done.Add(1)
+					continue
+				}
+
+				ok, err := p.budget.Take()
+				if err != nil {
+					p.logger.Error("failed to persist prefetch budget", "error", err)
+				}
+				if !ok {
+					exhausted.Store(true)
+					stop(ErrBudgetExhausted)
+					return
+				}
+
+				if err := p.pacer.Wait(ctx); err != nil {
+					return
+				}
+
+				if err := p.fetchAndStore(ctx, t); err != nil {
+					switch {
+					case errors.Is(err, ErrUpstreamBudgetExhausted):
+						exhausted.Store(true)
+						stop(err)
+						return
+					case errors.Is(err, ErrMaintenance):
+						stop(err)
+						return
+					}
+					p.logger.Warn("failed to prefetch tile", "z", t.Z, "x", t.X, "y", t.Y, "error", err)
+					failed.Add(1)
+					progress.Done.Add(1)
+					continue
+				}
+				fetched.Add(1)
+				progress.Done.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	result := PrefetchResult{
+		Total:           total,
+		Cached:          int(cached.Load()),
+		Fetched:         int(fetched.Load()),
+		Failed:          int(failed.Load()),
+		BudgetExhausted: exhausted.Load(),
+	}
+
+	if result.BudgetExhausted {
+		metrics.TilesPrefetchBudgetExhausted.Inc()
+	}
+	if stopErr != nil {
+		return result, stopErr
+	}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func (p *Prefetcher) fetchAndStore(ctx context.Context, t tilemath.Tile) error {
+	data, origin, cacheable, err := p.tiles.fetchTile(ctx, t.Z, t.X, t.Y)
+	if err != nil {
+		return err
+	}
+	metrics.TilesPrefetched.Inc()
+	if !cacheable {
+		return nil
+	}
+	return p.tiles.storeTileInCache("", t.Z, t.X, t.Y, data, origin)
+}
+
+// pacer spaces out callers so that consecutive Wait returns are at least
+// interval apart, no matter how many goroutines call it.
+type pacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newPacer(interval time.Duration) *pacer {
+	return &pacer{interval: interval}
+}
+
+// SetInterval changes the spacing of the Wait calls made from now on.
+func (p *pacer) SetInterval(interval time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.interval = interval
+}
+
+func (p *pacer) Wait(ctx context.Context) error {
+	p.mu.Lock()
+	if p.interval <= 0 {
+		p.mu.Unlock()
+		return ctx.Err()
+	}
+	now := time.Now()
+	slot := p.next
+	if slot.Before(now) {
+		slot = now
+	}
+	p.next = slot.Add(p.interval)
+	p.mu.Unlock()
+
+	delay := slot.Sub(now)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,26 @@
+package usecase
+
+import (
+	"github.com/jaennil/guide_helper/backend/tiles/internal/usecase/seeder"
+)
+
+// ErrJobNotFound is returned for unknown job IDs, including finished jobs
+// that expired.
+var ErrJobNotFound = seeder.ErrJobNotFound
+
+// ErrJobFinished is returned when cancelling a job that already ended.
+var ErrJobFinished = seeder.ErrJobFinished
+
+// JobState is the lifecycle stage of a background job.
+type JobState = seeder.State
+
+const (
+	JobQueued    = seeder.Queued
+	JobRunning   = seeder.Running
+	JobDone      = seeder.Done
+	JobFailed    = seeder.Failed
+	JobCancelled = seeder.Cancelled
+)
+
+// JobStatus is a snapshot of a background prefetch, warm, seed or purge job.
+type JobStatus = seeder.Status
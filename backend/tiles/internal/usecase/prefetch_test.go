@@ -0,0 +1,157 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/tilemath"
+)
+
+// fourTiles covers exactly the four tiles of zoom level 1
+var fourTiles = PrefetchRequest{
+	BBox:    tilemath.BBox{West: -10, South: -10, East: 10, North: 10},
+	MinZoom: 1,
+	MaxZoom: 1,
+}
+
+func newTestPrefetcher(t *testing.T, cfg PrefetchConfig) (*Prefetcher, *fakeCacheService, *fakeUpstream) {
+	t.Helper()
+
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("tile"))
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+	})
+
+	p, err := NewPrefetcher(context.Background(), uc, cfg, testLogger())
+	if err != nil {
+		t.Fatalf("failed to create prefetcher: %v", err)
+	}
+	return p, cacheSvc, upstream
+}
+
+func TestPrefetch_HonorsMinInterval(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	p, cacheSvc, upstream := newTestPrefetcher(t, PrefetchConfig{
+		Workers:     4,
+		MinInterval: interval,
+	})
+
+	result, err := p.Prefetch(context.Background(), fourTiles)
+	if err != nil {
+		t.Fatalf("Prefetch failed: %v", err)
+	}
+	if result.Total != 4 || result.Fetched != 4 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	times := upstream.requestTimes()
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	for i := 1; i < len(times); i++ {
+		// Allow a little scheduling slack on the receiving side
+		if gap := times[i].Sub(times[i-1]); gap < interval-10*time.Millisecond {
+			t.Fatalf("requests %d and %d only %v apart, want >= %v", i-1, i, gap, interval)
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		cacheSvc.waitStored(t)
+	}
+}
+
+func TestPrefetch_SetMinInterval(t *testing.T) {
+	p, cacheSvc, upstream := newTestPrefetcher(t, PrefetchConfig{
+		Workers:     4,
+		MinInterval: time.Hour,
+	})
+
+	const interval = 30 * time.Millisecond
+	p.SetMinInterval(interval)
+	start := time.Now()
+	if _, err := p.Prefetch(context.Background(), fourTiles); err != nil {
+		t.Fatalf("Prefetch failed: %v", err)
+	}
+	// Three gaps at the new interval, nowhere near the old one
+	if elapsed := time.Since(start); elapsed < 3*interval-10*time.Millisecond || elapsed > 10*time.Second {
+		t.Fatalf("prefetch took %v at a %v interval", elapsed, interval)
+	}
+	if got := len(upstream.requestTimes()); got != 4 {
+		t.Fatalf("expected 4 upstream requests, got %d", got)
+	}
+
+	for i := 0; i < 4; i++ {
+		cacheSvc.waitStored(t)
+	}
+}
+
+func TestPrefetch_StopsWhenBudgetExhausted(t *testing.T) {
+	budgetFile := filepath.Join(t.TempDir(), "budget.json")
+	p, _, upstream := newTestPrefetcher(t, PrefetchConfig{
+		Workers:     1,
+		DailyBudget: 2,
+		BudgetFile:  budgetFile,
+	})
+
+	result, err := p.Prefetch(context.Background(), fourTiles)
+	if !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("expected ErrBudgetExhausted, got %v", err)
+	}
+	if !result.BudgetExhausted || result.Fetched != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if got := upstream.requests.Load(); got != 2 {
+		t.Fatalf("expected 2 upstream requests, got %d", got)
+	}
+
+	// A restart must not reset the budget within the same day
+	reloaded, err := loadDailyBudget(budgetFile, 2, time.Now)
+	if err != nil {
+		t.Fatalf("failed to reload budget: %v", err)
+	}
+	if !reloaded.Exhausted() {
+		t.Fatal("expected persisted budget to remain exhausted")
+	}
+
+	reloaded.now = func() time.Time { return time.Now().Add(24 * time.Hour) }
+	if ok, err := reloaded.Take(); !ok || err != nil {
+		t.Fatalf("expected budget to reset on a new day, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestPrefetch_RejectsOversizedRequest(t *testing.T) {
+	p, _, _ := newTestPrefetcher(t, PrefetchConfig{MaxTiles: 3})
+
+	if _, err := p.Plan(fourTiles); !errors.Is(err, ErrPrefetchTooLarge) {
+		t.Fatalf("expected ErrPrefetchTooLarge, got %v", err)
+	}
+}
+
+func TestPurgeCache_SendsCacheAPIKey(t *testing.T) {
+	keys := make(chan string, 1)
+	cacheSvc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys <- r.Header.Get(cacheAPIKeyHeader)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"success":true,"data":{"removed":4}}`))
+	}))
+	t.Cleanup(cacheSvc.Close)
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.URL,
+		CacheAPIKey:     "secret",
+		UpstreamTileURL: "https://tile.example.org",
+	})
+	removed, err := uc.purgeCache(context.Background(), fourTiles.BBox, 1)
+	if err != nil || removed != 4 {
+		t.Fatalf("expected 4 tiles purged, got %d: %v", removed, err)
+	}
+	if key := <-keys; key != "secret" {
+		t.Fatalf("expected the cache api key, got %q", key)
+	}
+}
@@ -0,0 +1,156 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+)
+
+// ErrUpstreamThrottled is returned instead of contacting upstream when the
+// rate limiter has no slot for the request within its queue timeout, or its
+// queue is full.
+var ErrUpstreamThrottled = errors.New("upstream rate limit exceeded")
+
+// UpstreamRateLimitConfig caps upstream requests with a token bucket, as
+// the OpenStreetMap tile usage policy expects of proxies. Requests beyond
+// the rate queue for a token.
+type UpstreamRateLimitConfig struct {
+	// Rate is the sustained requests per second, zero disables the limit
+	Rate float64
+	// Burst is how many requests may go out back to back, at least one
+	Burst int
+	// MaxQueue bounds the requests waiting for a token, zero leaves it open
+	MaxQueue int
+	// QueueTimeout is how long a request may wait for a token, zero waits
+	// for as long as the request lasts
+	QueueTimeout time.Duration
+}
+
+// rateLimiter is a token bucket. Waiters reserve a token ahead of time, so
+// they are served in order and the wait is known when they queue. A zero
+// rate lets every request through, so the limit can be turned on later.
+type rateLimiter struct {
+	mu      sync.Mutex
+	cfg     UpstreamRateLimitConfig
+	tokens  float64
+	last    time.Time
+	waiting int
+	now     func() time.Time
+}
+
+func newRateLimiter(cfg UpstreamRateLimitConfig, now func() time.Time) *rateLimiter {
+	if cfg.Burst < 1 {
+		cfg.Burst = 1
+	}
+	return &rateLimiter{cfg: cfg, tokens: float64(cfg.Burst), now: now}
+}
+
+// setConfig changes the limit for requests reserving from now on. Tokens
+// gathered so far are kept up to the new burst.
+func (l *rateLimiter) setConfig(cfg UpstreamRateLimitConfig) {
+	if cfg.Burst < 1 {
+		cfg.Burst = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	if l.cfg.Rate <= 0 {
+		// An unlimited bucket was never drawn from
+		l.tokens = float64(cfg.Burst)
+	}
+	l.cfg = cfg
+	l.tokens = min(l.tokens, float64(cfg.Burst))
+}
+
+// refill adds the tokens gathered since the last call. l.mu must be held.
+func (l *rateLimiter) refill() {
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.cfg.Rate
+		l.tokens = min(l.tokens, float64(l.cfg.Burst))
+	}
+	l.last = now
+}
+
+// reserve takes a token and returns how long to wait until it is due. It
+// reports false, taking nothing, when the wait would outlast the queue
+// timeout or ctx, or the queue is full.
+func (l *rateLimiter) reserve(ctx context.Context) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cfg.Rate <= 0 {
+		return 0, true
+	}
+	l.refill()
+	now := l.last
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0, true
+	}
+
+	delay := time.Duration((1 - l.tokens) / l.cfg.Rate * float64(time.Second))
+	if l.cfg.MaxQueue > 0 && l.waiting >= l.cfg.MaxQueue {
+		return delay, false
+	}
+	if l.cfg.QueueTimeout > 0 && delay > l.cfg.QueueTimeout {
+		return delay, false
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		return delay, false
+	}
+	l.tokens--
+	l.waiting++
+	return delay, true
+}
+
+// cancel hands back the token of a waiter that gave up.
+func (l *rateLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = min(l.tokens+1, float64(l.cfg.Burst))
+	l.waiting--
+}
+
+func (l *rateLimiter) done() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.waiting--
+}
+
+// SetUpstreamRateLimit changes the upstream rate limit for requests made
+// from now on. A zero rate disables it.
+func (uc *TileUseCase) SetUpstreamRateLimit(cfg UpstreamRateLimitConfig) {
+	uc.rateLimiter.setConfig(cfg)
+}
+
+// waitForUpstream blocks until the rate limiter lets a request to upstream
+// go, failing with ErrUpstreamThrottled when it would have to wait too long.
+func (uc *TileUseCase) waitForUpstream(ctx context.Context) error {
+	l := uc.rateLimiter
+	delay, ok := l.reserve(ctx)
+	if !ok {
+		uc.logger.Warn("upstream rate limit exceeded, dropping request", "wait", delay)
+		metrics.TilesUpstreamThrottled.WithLabelValues("dropped").Inc()
+		return ErrUpstreamThrottled
+	}
+	if delay <= 0 {
+		return nil
+	}
+
+	metrics.TilesUpstreamThrottled.WithLabelValues("delayed").Inc()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		l.done()
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,122 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Reserve(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(UpstreamRateLimitConfig{Rate: 2, Burst: 2, MaxQueue: 1, QueueTimeout: time.Second},
+		func() time.Time { return now })
+	ctx := context.Background()
+
+	// The burst goes out right away
+	for i := 0; i < 2; i++ {
+		if delay, ok := l.reserve(ctx); !ok || delay != 0 {
+			t.Fatalf("request %d: got %v, %v, want no wait", i, delay, ok)
+		}
+	}
+
+	// The next one queues for the next token, half a second at 2/s
+	if delay, ok := l.reserve(ctx); !ok || delay != 500*time.Millisecond {
+		t.Fatalf("expected a 500ms wait, got %v, %v", delay, ok)
+	}
+	// The queue holds one
+	if _, ok := l.reserve(ctx); ok {
+		t.Fatal("expected a full queue to drop the request")
+	}
+	l.done()
+	// A second in line would wait a full second, the timeout allows it
+	if delay, ok := l.reserve(ctx); !ok || delay != time.Second {
+		t.Fatalf("expected a 1s wait, got %v, %v", delay, ok)
+	}
+	l.done()
+	if _, ok := l.reserve(ctx); ok {
+		t.Fatal("expected a wait beyond the queue timeout to drop the request")
+	}
+
+	// Tokens refill over time, up to the burst
+	now = now.Add(time.Minute)
+	for i := 0; i < 2; i++ {
+		if delay, ok := l.reserve(ctx); !ok || delay != 0 {
+			t.Fatalf("after refill, request %d: got %v, %v", i, delay, ok)
+		}
+	}
+}
+
+func TestRateLimiter_ContextDeadline(t *testing.T) {
+	l := newRateLimiter(UpstreamRateLimitConfig{Rate: 1, Burst: 1}, time.Now)
+	l.reserve(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, ok := l.reserve(ctx); ok {
+		t.Fatal("expected a wait beyond the request's deadline to drop it")
+	}
+}
+
+func TestRateLimiter_SetConfig(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(UpstreamRateLimitConfig{}, func() time.Time { return now })
+	ctx := context.Background()
+
+	// Without a rate every request goes out
+	for i := 0; i < 5; i++ {
+		if delay, ok := l.reserve(ctx); !ok || delay != 0 {
+			t.Fatalf("unlimited request %d: got %v, %v", i, delay, ok)
+		}
+	}
+
+	l.setConfig(UpstreamRateLimitConfig{Rate: 1, Burst: 1, QueueTimeout: 500 * time.Millisecond})
+	if delay, ok := l.reserve(ctx); !ok || delay != 0 {
+		t.Fatalf("expected the new burst to go out, got %v, %v", delay, ok)
+	}
+	if _, ok := l.reserve(ctx); ok {
+		t.Fatal("expected a 1s wait beyond the new queue timeout to drop the request")
+	}
+
+	// A higher rate applies to the next reservation
+	l.setConfig(UpstreamRateLimitConfig{Rate: 4, Burst: 1, QueueTimeout: time.Second})
+	if delay, ok := l.reserve(ctx); !ok || delay != 250*time.Millisecond {
+		t.Fatalf("expected a 250ms wait at 4/s, got %v, %v", delay, ok)
+	}
+}
+
+func TestGetTile_UpstreamRateLimit(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("fresh"))
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+		RateLimit:       UpstreamRateLimitConfig{Rate: 20, Burst: 1, QueueTimeout: 100 * time.Millisecond},
+	})
+	ctx := context.Background()
+
+	// The second request waits 50ms for its token
+	start := time.Now()
+	for _, y := range []int{1, 2} {
+		if _, err := uc.GetTile(ctx, 5, 10, y); err != nil {
+			t.Fatalf("GetTile failed: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("expected the second fetch to be delayed, took %v", elapsed)
+	}
+	uc.WaitForStores()
+
+	// Three requests in a row need 100ms of tokens beyond the burst, the
+	// last one waits longer than the queue timeout
+	uc.rateLimiter = newRateLimiter(UpstreamRateLimitConfig{Rate: 20, Burst: 1, QueueTimeout: 60 * time.Millisecond}, time.Now)
+	uc.rateLimiter.reserve(ctx)
+	uc.rateLimiter.reserve(ctx)
+	if _, err := uc.GetTile(ctx, 5, 10, 3); !errors.Is(err, ErrUpstreamThrottled) {
+		t.Fatalf("expected ErrUpstreamThrottled, got %v", err)
+	}
+	if got := upstream.requests.Load(); got != 2 {
+		t.Fatalf("expected 2 upstream requests, got %d", got)
+	}
+}
@@ -0,0 +1,179 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+)
+
+// RetryBudgetConfig bounds the retries of one tile request. Cache probes and
+// upstream fetches draw from the same budget, so retries of one cannot add
+// up with those of the other past the request's deadline.
+type RetryBudgetConfig struct {
+	// Retries is how many retries the request may make in total. With a
+	// budget configured, failing over to another weighted provider counts
+	// as a retry too.
+	Retries int
+	// Deadline bounds the whole request, retries included, like
+	// ResponseBudget does; the shorter of the two applies. Zero leaves it
+	// unbounded.
+	Deadline time.Duration
+	// Backoff is the pause before the first retry. It doubles with each
+	// further retry of the request up to MaxBackoff; a zero MaxBackoff keeps
+	// it constant. An upstream asking for a longer wait with Retry-After
+	// gets it, unless that is beyond MaxBackoff, which ends the retries.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Jitter picks each pause at random up to its full length, so requests
+	// failing together do not retry together
+	Jitter bool
+}
+
+// retryBudget is what remains of a request's budget, carried in its context.
+type retryBudget struct {
+	tokens   atomic.Int64
+	retries  atomic.Int64
+	deadline time.Time
+	cfg      RetryBudgetConfig
+}
+
+// pause is the backoff before the retry following the given number of
+// retries.
+func (b *retryBudget) pause(retries int64) time.Duration {
+	pause := b.cfg.Backoff
+	if b.cfg.MaxBackoff > 0 {
+		pause = b.cfg.Backoff << min(retries, 62)
+		if pause <= 0 || pause > b.cfg.MaxBackoff {
+			pause = b.cfg.MaxBackoff
+		}
+	}
+	if b.cfg.Jitter && pause > 0 {
+		pause = rand.N(pause + 1)
+	}
+	return pause
+}
+
+type retryBudgetKey struct{}
+
+// withRetryBudget gives the request in ctx its retry budget. Without a
+// configured budget ctx is returned as is and nothing is retried.
+func (uc *TileUseCase) withRetryBudget(ctx context.Context) context.Context {
+	cfg := uc.retryBudget
+	if cfg.Retries <= 0 && cfg.Deadline <= 0 {
+		return ctx
+	}
+
+	b := &retryBudget{cfg: cfg}
+	b.tokens.Store(int64(cfg.Retries))
+	if cfg.Deadline > 0 {
+		b.deadline = uc.now().Add(cfg.Deadline)
+	}
+	return context.WithValue(ctx, retryBudgetKey{}, b)
+}
+
+func retryBudgetFrom(ctx context.Context) (*retryBudget, bool) {
+	b, ok := ctx.Value(retryBudgetKey{}).(*retryBudget)
+	return b, ok
+}
+
+// retry takes a retry of phase, "cache" or "upstream", from the request's
+// budget and waits out the backoff. It reports false once the budget is used
+// up, when the retry would start past the deadline, or when ctx is done.
+func (uc *TileUseCase) retry(ctx context.Context, phase string) bool {
+	return uc.retryAfter(ctx, phase, 0)
+}
+
+// retryAfter is retry waiting at least wait, the time the other side asked
+// for. It reports false when wait is beyond the maximum backoff.
+func (uc *TileUseCase) retryAfter(ctx context.Context, phase string, wait time.Duration) bool {
+	b, ok := retryBudgetFrom(ctx)
+	if !ok {
+		return false
+	}
+	if wait > 0 && b.cfg.MaxBackoff > 0 && wait > b.cfg.MaxBackoff {
+		metrics.TilesRetryBudgetExhausted.WithLabelValues(phase).Inc()
+		return false
+	}
+	pause := max(b.pause(b.retries.Load()), wait)
+	if !b.deadline.IsZero() && !uc.now().Add(pause).Before(b.deadline) {
+		metrics.TilesRetryBudgetExhausted.WithLabelValues(phase).Inc()
+		return false
+	}
+	if b.tokens.Add(-1) < 0 {
+		metrics.TilesRetryBudgetExhausted.WithLabelValues(phase).Inc()
+		return false
+	}
+	b.retries.Add(1)
+	metrics.TilesRetries.WithLabelValues(phase).Inc()
+	if wait > 0 {
+		metrics.TilesRetryAfter.WithLabelValues(phase).Inc()
+	}
+
+	if pause <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(pause)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// upstreamStatusError is an unexpected upstream status, with the wait
+// upstream asked for in Retry-After, if any.
+type upstreamStatusError struct {
+	status     int
+	retryAfter time.Duration
+}
+
+func (e *upstreamStatusError) Error() string {
+	return fmt.Sprintf("upstream returned status %d", e.status)
+}
+
+// parseRetryAfter parses a Retry-After header, in seconds or as an HTTP
+// date. Missing, invalid and past values are zero.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
+
+// retryAfterOf is the wait upstream asked for along with err, if any.
+func retryAfterOf(err error) time.Duration {
+	var statusErr *upstreamStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.retryAfter
+	}
+	return 0
+}
+
+// retryableFetch reports whether another attempt at an upstream fetch that
+// failed with err could succeed. Of the unexpected statuses only server
+// errors and 429 Too Many Requests are worth retrying.
+func retryableFetch(err error) bool {
+	var statusErr *upstreamStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.status >= http.StatusInternalServerError || statusErr.status == http.StatusTooManyRequests
+	}
+	return !errors.Is(err, ErrTileNotFound) &&
+		!errors.Is(err, ErrUpstreamBodyTooLarge) &&
+		!errors.Is(err, ErrUnexpectedContentType) &&
+		!errors.Is(err, ErrUpstreamThrottled)
+}
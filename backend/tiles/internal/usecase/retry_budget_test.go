@@ -0,0 +1,188 @@
+package usecase
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFailingServer answers every request with 500, counting them.
+func newFailingServer(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestGetTile_RetryBudgetSharedAcrossCacheAndUpstream(t *testing.T) {
+	cacheSvc, cacheRequests := newFailingServer(t)
+	upstream, upstreamRequests := newFailingServer(t)
+	const deadline = 2 * time.Second
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.URL,
+		UpstreamTileURL: upstream.URL,
+		RetryBudget:     RetryBudgetConfig{Retries: 2, Deadline: deadline, Backoff: time.Millisecond},
+	})
+
+	start := time.Now()
+	_, err := uc.GetTile(context.Background(), 1, 1, 1)
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("expected the request to fail")
+	}
+	if elapsed >= deadline {
+		t.Fatalf("expected the request to fail within %v, took %v", deadline, elapsed)
+	}
+	if got := cacheRequests.Load(); got != 3 {
+		t.Fatalf("expected the cache to be probed once and retried twice, got %d probes", got)
+	}
+	if got := upstreamRequests.Load(); got != 1 {
+		t.Fatalf("expected no budget left for upstream retries, got %d fetches", got)
+	}
+}
+
+func TestGetTile_RetryBudgetRetriesUpstream(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream, upstreamRequests := newFailingServer(t)
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.URL,
+		RetryBudget:     RetryBudgetConfig{Retries: 2, Backoff: time.Millisecond},
+	})
+
+	if _, err := uc.GetTile(context.Background(), 1, 1, 1); err == nil {
+		t.Fatal("expected the request to fail")
+	}
+	if got := upstreamRequests.Load(); got != 3 {
+		t.Fatalf("expected the fetch to be retried twice, got %d fetches", got)
+	}
+}
+
+func TestRetryBudget_ExponentialBackoff(t *testing.T) {
+	b := &retryBudget{cfg: RetryBudgetConfig{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}}
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for retries, ms := range want {
+		if got := b.pause(int64(retries)); got != ms*time.Millisecond {
+			t.Errorf("pause after %d retries = %v, want %v", retries, got, ms*time.Millisecond)
+		}
+	}
+	if got := b.pause(100); got != time.Second {
+		t.Errorf("pause after 100 retries = %v, want the maximum", got)
+	}
+
+	b.cfg.Jitter = true
+	for i := 0; i < 100; i++ {
+		if got := b.pause(2); got < 0 || got > 400*time.Millisecond {
+			t.Fatalf("jittered pause %v outside [0, 400ms]", got)
+		}
+	}
+
+	constant := &retryBudget{cfg: RetryBudgetConfig{Backoff: 100 * time.Millisecond}}
+	if got := constant.pause(5); got != 100*time.Millisecond {
+		t.Errorf("without a maximum the pause should stay constant, got %v", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"3":                             3 * time.Second,
+		"-1":                            0,
+		"soon":                          0,
+		"Wed, 01 May 2024 12:00:30 GMT": 30 * time.Second,
+		"Wed, 01 May 2024 11:00:00 GMT": 0,
+	}
+	for value, want := range tests {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+// newStatusServer answers with status, and Retry-After when set, until
+// failures requests were made, then with a tile.
+func newStatusServer(t *testing.T, status int, retryAfter string, failures int64) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("fresh"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestGetTile_RetriesOnlyTransientStatuses(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream, upstreamRequests := newStatusServer(t, http.StatusForbidden, "", 1)
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.URL,
+		RetryBudget:     RetryBudgetConfig{Retries: 2, Backoff: time.Millisecond},
+	})
+
+	if _, err := uc.GetTile(context.Background(), 1, 1, 1); err == nil {
+		t.Fatal("expected the request to fail")
+	}
+	if got := upstreamRequests.Load(); got != 1 {
+		t.Fatalf("expected 403 not to be retried, got %d fetches", got)
+	}
+}
+
+func TestGetTile_RetryHonoursRetryAfter(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream, upstreamRequests := newStatusServer(t, http.StatusTooManyRequests, "1", 1)
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.URL,
+		RetryBudget:     RetryBudgetConfig{Retries: 2, Backoff: time.Millisecond, MaxBackoff: 2 * time.Second},
+	})
+
+	start := time.Now()
+	data, err := uc.GetTile(context.Background(), 1, 1, 1)
+	if err != nil || string(data) != "fresh" {
+		t.Fatalf("expected the retry to succeed, got %q, %v", data, err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("expected the retry to wait the second upstream asked for, took %v", elapsed)
+	}
+	if got := upstreamRequests.Load(); got != 2 {
+		t.Fatalf("expected 2 fetches, got %d", got)
+	}
+
+	// A wait beyond the maximum backoff is not worth holding the request for
+	upstream, upstreamRequests = newStatusServer(t, http.StatusServiceUnavailable, "60", 1)
+	uc = newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.URL,
+		RetryBudget:     RetryBudgetConfig{Retries: 2, Backoff: time.Millisecond, MaxBackoff: 2 * time.Second},
+	})
+	if _, err := uc.GetTile(context.Background(), 1, 1, 2); err == nil {
+		t.Fatal("expected the request to fail")
+	}
+	if got := upstreamRequests.Load(); got != 1 {
+		t.Fatalf("expected no retry, got %d fetches", got)
+	}
+}
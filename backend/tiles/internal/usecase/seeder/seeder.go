@@ -0,0 +1,393 @@
+// Package seeder runs long bulk jobs, such as seeding or purging a region of
+// the cache, in the background. A few jobs run at a time while the rest
+// queue, any of them can be cancelled, and their state is persisted so jobs
+// can still be polled after a restart.
+package seeder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+)
+
+// checkpointInterval is how often the progress of running jobs is persisted
+const checkpointInterval = 5 * time.Second
+
+var (
+	// ErrJobNotFound is returned for unknown job IDs, including finished
+	// jobs that expired.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobFinished is returned when cancelling a job that already ended.
+	ErrJobFinished = errors.New("job already finished")
+	// errInterrupted marks jobs that were unfinished when the service stopped
+	errInterrupted = errors.New("interrupted by a restart")
+)
+
+// State is the lifecycle stage of a job.
+type State string
+
+const (
+	Queued    State = "queued"
+	Running   State = "running"
+	Done      State = "done"
+	Failed    State = "failed"
+	Cancelled State = "cancelled"
+)
+
+// Status is a snapshot of a job. Done counts the tiles processed so far,
+// whichever way; the other counters break them down by outcome.
+type Status struct {
+	ID              string     `json:"id"`
+	Kind            string     `json:"kind"`
+	State           State      `json:"state"`
+	Total           int        `json:"total"`
+	Done            int        `json:"done"`
+	Cached          int        `json:"cached"`
+	Fetched         int        `json:"fetched"`
+	Failed          int        `json:"failed"`
+	Removed         int        `json:"removed"`
+	BudgetExhausted bool       `json:"budget_exhausted"`
+	Error           string     `json:"error,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+}
+
+func (s Status) finished() bool {
+	return s.FinishedAt != nil
+}
+
+// Progress is updated by a running job and read by status queries.
+type Progress struct {
+	Done            atomic.Int64
+	Cached          atomic.Int64
+	Fetched         atomic.Int64
+	Failed          atomic.Int64
+	Removed         atomic.Int64
+	BudgetExhausted atomic.Bool
+}
+
+// RunFunc does the work of a job until it is complete or ctx is cancelled,
+// counting what it does in progress.
+type RunFunc func(ctx context.Context, progress *Progress) error
+
+type Config struct {
+	// Workers is how many jobs run at once, later ones queue. Zero runs
+	// every job right away.
+	Workers int
+	// StateFile persists job states across restarts. Empty keeps them in
+	// memory only.
+	StateFile string
+	// TTL is how long finished jobs stay queryable. Zero keeps them for
+	// good.
+	TTL time.Duration
+}
+
+type job struct {
+	status    Status
+	progress  Progress
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// Manager runs jobs and keeps their state.
+type Manager struct {
+	mu    sync.Mutex
+	jobs  map[string]*job
+	ttl   time.Duration
+	path  string
+	slots chan struct{}
+	ctx   context.Context
+	wg    sync.WaitGroup
+	// saveMu orders writes of the state file
+	saveMu sync.Mutex
+
+	logger logger.Logger
+	now    func() time.Time
+}
+
+// NewManager creates a manager whose jobs stop when ctx is cancelled. Jobs
+// found unfinished in the state file are reported as failed, their work
+// is not resumed.
+func NewManager(ctx context.Context, cfg Config, l logger.Logger) (*Manager, error) {
+	m := &Manager{
+		jobs:   make(map[string]*job),
+		ttl:    cfg.TTL,
+		path:   cfg.StateFile,
+		ctx:    ctx,
+		logger: l,
+		now:    time.Now,
+	}
+	if cfg.Workers > 0 {
+		m.slots = make(chan struct{}, cfg.Workers)
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	if m.path != "" {
+		m.wg.Add(1)
+		go m.checkpoint()
+	}
+	return m, nil
+}
+
+// Start queues a job of kind covering total tiles and returns its status,
+// whose ID is used to poll or cancel it.
+func (m *Manager) Start(kind string, total int, run RunFunc) Status {
+	ctx, cancel := context.WithCancel(m.ctx)
+	j := &job{
+		status: Status{
+			ID:    uuid.NewString(),
+			Kind:  kind,
+			State: Queued,
+			Total: total,
+		},
+		cancel: cancel,
+	}
+
+	m.mu.Lock()
+	m.prune()
+	j.status.CreatedAt = m.now()
+	m.jobs[j.status.ID] = j
+	status := j.status
+	m.mu.Unlock()
+	m.save()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+
+		if !m.acquire(ctx) {
+			m.finish(j, ctx.Err())
+			return
+		}
+		defer m.release()
+
+		m.mu.Lock()
+		j.status.State = Running
+		m.mu.Unlock()
+		m.save()
+
+		m.finish(j, run(ctx, &j.progress))
+	}()
+
+	return status
+}
+
+// acquire waits for a free slot, reporting false if ctx ends first.
+func (m *Manager) acquire(ctx context.Context) bool {
+	if m.slots == nil {
+		return ctx.Err() == nil
+	}
+	select {
+	case m.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (m *Manager) release() {
+	if m.slots != nil {
+		<-m.slots
+	}
+}
+
+func (m *Manager) finish(j *job, err error) {
+	m.mu.Lock()
+	j.status = j.snapshot()
+	now := m.now()
+	j.status.FinishedAt = &now
+	switch {
+	case err != nil && j.cancelled:
+		j.status.State = Cancelled
+	case err != nil:
+		j.status.State = Failed
+		j.status.Error = err.Error()
+	default:
+		j.status.State = Done
+	}
+	status := j.status
+	m.mu.Unlock()
+	m.save()
+
+	switch status.State {
+	case Done:
+		m.logger.Info(status.Kind+" job completed", "job", status.ID, "done", status.Done, "total", status.Total)
+	case Cancelled:
+		m.logger.Info(status.Kind+" job cancelled", "job", status.ID, "done", status.Done, "total", status.Total)
+	default:
+		m.logger.Warn(status.Kind+" job stopped", "job", status.ID, "done", status.Done, "total", status.Total, "error", err)
+	}
+}
+
+// Get returns the status of a job. It fails with ErrJobNotFound for unknown
+// or expired jobs.
+func (m *Manager) Get(id string) (Status, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return Status{}, ErrJobNotFound
+	}
+	return j.snapshot(), nil
+}
+
+// Cancel stops a queued or running job. The job reports Cancelled once its
+// work has wound down, which for a running job may take a moment. It fails
+// with ErrJobFinished for jobs that already ended.
+func (m *Manager) Cancel(id string) (Status, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return Status{}, ErrJobNotFound
+	}
+	if j.status.finished() {
+		return j.snapshot(), ErrJobFinished
+	}
+	j.cancelled = true
+	j.cancel()
+	return j.snapshot(), nil
+}
+
+// Wait blocks until every job has returned. Jobs stop once the context
+// given to NewManager is cancelled.
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+// prune drops expired jobs. The caller must hold m.mu.
+func (m *Manager) prune() {
+	if m.ttl <= 0 {
+		return
+	}
+	for id, j := range m.jobs {
+		if j.status.finished() && m.now().Sub(*j.status.FinishedAt) > m.ttl {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// snapshot copies the status with the current counters. The caller must
+// hold the manager's mutex.
+func (j *job) snapshot() Status {
+	status := j.status
+	if status.finished() {
+		return status
+	}
+	status.Done = int(j.progress.Done.Load())
+	status.Cached = int(j.progress.Cached.Load())
+	status.Fetched = int(j.progress.Fetched.Load())
+	status.Failed = int(j.progress.Failed.Load())
+	status.Removed = int(j.progress.Removed.Load())
+	status.BudgetExhausted = j.progress.BudgetExhausted.Load()
+	return status
+}
+
+// checkpoint persists the progress of running jobs until the manager's
+// context ends. Jobs save their final state themselves.
+func (m *Manager) checkpoint() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.save()
+		}
+	}
+}
+
+// load restores the jobs of the state file. Unfinished ones fail, the
+// process that ran them is gone.
+func (m *Manager) load() error {
+	if m.path == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(m.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read job state file: %w", err)
+	}
+	var statuses []Status
+	if err := json.Unmarshal(raw, &statuses); err != nil {
+		return fmt.Errorf("failed to parse job state file: %w", err)
+	}
+
+	now := m.now()
+	for _, s := range statuses {
+		if !s.finished() {
+			s.State = Failed
+			s.Error = errInterrupted.Error()
+			s.FinishedAt = &now
+		}
+		m.jobs[s.ID] = &job{status: s, cancel: func() {}}
+	}
+	m.prune()
+	return nil
+}
+
+// save writes every job to the state file. Failures are logged, jobs keep
+// running without persistence.
+func (m *Manager) save() {
+	if m.path == "" {
+		return
+	}
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	m.mu.Lock()
+	statuses := make([]Status, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		statuses = append(statuses, j.snapshot())
+	}
+	m.mu.Unlock()
+
+	if err := writeFileAtomic(m.path, statuses); err != nil {
+		m.logger.Error("failed to persist job state", "path", m.path, "error", err)
+	}
+}
+
+// writeFileAtomic writes v as JSON through a temporary file, so a crash
+// never leaves a torn file behind.
+func writeFileAtomic(path string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".jobs-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
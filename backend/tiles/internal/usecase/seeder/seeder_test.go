@@ -0,0 +1,204 @@
+package seeder
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+)
+
+func newTestManager(t *testing.T, cfg Config) *Manager {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m, err := NewManager(ctx, cfg, logger.FromContext(context.Background()))
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		m.Wait()
+	})
+	return m
+}
+
+// waitFor polls the job until it reaches state.
+func waitFor(t *testing.T, m *Manager, id string, state State) Status {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err := m.Get(id)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if status.State == state {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not reach %s, last status %+v", state, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// blockingJob counts one tile, then runs until its context ends.
+func blockingJob(ctx context.Context, p *Progress) error {
+	p.Done.Add(1)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestManager_RunsJobToCompletion(t *testing.T) {
+	m := newTestManager(t, Config{})
+
+	started := m.Start("seed", 3, func(ctx context.Context, p *Progress) error {
+		p.Done.Add(3)
+		p.Fetched.Add(2)
+		p.Cached.Add(1)
+		return nil
+	})
+	if started.State != Queued || started.Total != 3 {
+		t.Fatalf("unexpected start status %+v", started)
+	}
+
+	status := waitFor(t, m, started.ID, Done)
+	if status.Done != 3 || status.Fetched != 2 || status.Cached != 1 || status.FinishedAt == nil {
+		t.Fatalf("unexpected final status %+v", status)
+	}
+}
+
+func TestManager_ReportsFailures(t *testing.T) {
+	m := newTestManager(t, Config{})
+
+	started := m.Start("purge", 1, func(ctx context.Context, p *Progress) error {
+		return errors.New("cache unavailable")
+	})
+	if status := waitFor(t, m, started.ID, Failed); status.Error != "cache unavailable" {
+		t.Fatalf("unexpected error %q", status.Error)
+	}
+}
+
+func TestManager_CancelRunningJob(t *testing.T) {
+	m := newTestManager(t, Config{})
+
+	started := m.Start("seed", 10, blockingJob)
+	waitFor(t, m, started.ID, Running)
+
+	if _, err := m.Cancel(started.ID); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	status := waitFor(t, m, started.ID, Cancelled)
+	if status.Done != 1 || status.Error != "" {
+		t.Fatalf("unexpected cancelled status %+v", status)
+	}
+
+	if _, err := m.Cancel(started.ID); !errors.Is(err, ErrJobFinished) {
+		t.Fatalf("expected ErrJobFinished, got %v", err)
+	}
+	if _, err := m.Cancel("nope"); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestManager_QueuesBeyondWorkers(t *testing.T) {
+	m := newTestManager(t, Config{Workers: 1})
+
+	first := m.Start("seed", 1, blockingJob)
+	waitFor(t, m, first.ID, Running)
+
+	ran := make(chan struct{})
+	second := m.Start("seed", 1, func(ctx context.Context, p *Progress) error {
+		close(ran)
+		return nil
+	})
+	time.Sleep(20 * time.Millisecond)
+	if status, _ := m.Get(second.ID); status.State != Queued {
+		t.Fatalf("second job should wait for a worker, got %s", status.State)
+	}
+
+	m.Cancel(first.ID)
+	waitFor(t, m, second.ID, Done)
+	select {
+	case <-ran:
+	default:
+		t.Fatal("second job did not run")
+	}
+
+	// A queued job is cancelled without ever running
+	blocker := m.Start("seed", 1, blockingJob)
+	waitFor(t, m, blocker.ID, Running)
+	queued := m.Start("seed", 1, func(ctx context.Context, p *Progress) error {
+		t.Error("cancelled job ran")
+		return nil
+	})
+	m.Cancel(queued.ID)
+	waitFor(t, m, queued.ID, Cancelled)
+	m.Cancel(blocker.ID)
+}
+
+func TestManager_PersistsJobsAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m, err := NewManager(ctx, Config{StateFile: path}, logger.FromContext(context.Background()))
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	done := m.Start("seed", 2, func(ctx context.Context, p *Progress) error {
+		p.Done.Add(2)
+		p.Fetched.Add(2)
+		return nil
+	})
+	waitFor(t, m, done.ID, Done)
+	cancel()
+	m.Wait()
+
+	reloaded := newTestManager(t, Config{StateFile: path})
+	status, err := reloaded.Get(done.ID)
+	if err != nil || status.State != Done || status.Fetched != 2 {
+		t.Fatalf("finished job not restored: %+v, %v", status, err)
+	}
+}
+
+func TestManager_FailsJobsInterruptedByRestart(t *testing.T) {
+	// The state of a process stopped hard while the job ran
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	if err := writeFileAtomic(path, []Status{{ID: "interrupted", Kind: "seed", State: Running, Total: 5, Done: 2}}); err != nil {
+		t.Fatalf("failed to write state file: %v", err)
+	}
+
+	m := newTestManager(t, Config{StateFile: path})
+	status, err := m.Get("interrupted")
+	if err != nil || status.State != Failed || status.Error != errInterrupted.Error() || status.Done != 2 {
+		t.Fatalf("interrupted job should fail keeping its progress: %+v, %v", status, err)
+	}
+	if _, err := m.Cancel("interrupted"); !errors.Is(err, ErrJobFinished) {
+		t.Fatalf("expected ErrJobFinished, got %v", err)
+	}
+}
+
+func TestManager_ExpiresFinishedJobs(t *testing.T) {
+	now := time.Now()
+	m := newTestManager(t, Config{TTL: time.Hour})
+	m.mu.Lock()
+	m.now = func() time.Time { return now }
+	m.mu.Unlock()
+
+	running := m.Start("seed", 1, blockingJob)
+	finished := m.Start("seed", 1, func(ctx context.Context, p *Progress) error { return nil })
+	waitFor(t, m, finished.ID, Done)
+
+	m.mu.Lock()
+	m.now = func() time.Time { return now.Add(2 * time.Hour) }
+	m.mu.Unlock()
+	if _, err := m.Get(finished.ID); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("expected expired job to be gone, got %v", err)
+	}
+	if _, err := m.Get(running.ID); err != nil {
+		t.Fatalf("unfinished job must not expire: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package usecase
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultProvider names the upstream tile server in per-provider settings
+// such as Signers.
+const DefaultProvider = "default"
+
+var ErrInvalidSigner = errors.New("invalid upstream signer")
+
+// RequestSigner decorates an upstream request before it is sent, for
+// providers that only serve authenticated requests.
+type RequestSigner interface {
+	Sign(req *http.Request) error
+}
+
+// APIKeySigner appends a fixed access token as a query parameter.
+type APIKeySigner struct {
+	Param string
+	Key   string
+}
+
+func (s APIKeySigner) Sign(req *http.Request) error {
+	q := req.URL.Query()
+	q.Set(s.Param, s.Key)
+	req.URL.RawQuery = q.Encode()
+	return nil
+}
+
+// HMACSigner appends an HMAC-SHA256 of the request path and query, hex
+// encoded, as a query parameter. The secret itself is never sent.
+type HMACSigner struct {
+	Param  string
+	Secret []byte
+}
+
+func (s HMACSigner) Sign(req *http.Request) error {
+	q := req.URL.Query()
+	q.Del(s.Param)
+	req.URL.RawQuery = q.Encode()
+
+	q.Set(s.Param, HMACSignature(s.Secret, req.URL.Path, req.URL.RawQuery))
+	req.URL.RawQuery = q.Encode()
+	return nil
+}
+
+// HMACSignature is the signature HMACSigner adds for a path and encoded
+// query.
+func HMACSignature(secret []byte, path, rawQuery string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(path))
+	if rawQuery != "" {
+		mac.Write([]byte("?" + rawQuery))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ParseSigners parses signer specs keyed by provider, each one of
+// "apikey:<param>:<key>" or "hmac-sha256:<param>:<secret>".
+func ParseSigners(specs map[string]string) (map[string]RequestSigner, error) {
+	signers := make(map[string]RequestSigner, len(specs))
+	for provider, spec := range specs {
+		kind, rest, _ := strings.Cut(spec, ":")
+		param, secret, ok := strings.Cut(rest, ":")
+		if !ok || param == "" || secret == "" {
+			return nil, fmt.Errorf("%w for provider %s: expected kind:param:secret", ErrInvalidSigner, provider)
+		}
+		switch kind {
+		case "apikey":
+			signers[provider] = APIKeySigner{Param: param, Key: secret}
+		case "hmac-sha256":
+			signers[provider] = HMACSigner{Param: param, Secret: []byte(secret)}
+		default:
+			return nil, fmt.Errorf("%w for provider %s: unknown kind %q", ErrInvalidSigner, provider, kind)
+		}
+	}
+	return signers, nil
+}
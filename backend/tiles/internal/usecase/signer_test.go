@@ -0,0 +1,102 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newSigningProvider serves tiles only to requests carrying a valid HMAC
+// signature or access token, answering 403 otherwise.
+func newSigningProvider(t *testing.T, secret []byte, token string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		signature := q.Get("signature")
+		q.Del("signature")
+
+		signed := signature != "" && signature == HMACSignature(secret, r.URL.Path, q.Encode())
+		if !signed && (token == "" || q.Get("access_token") != token) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte("tile"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGetTile_SignsUpstreamRequests(t *testing.T) {
+	secret := []byte("s3cret")
+	provider := newSigningProvider(t, secret, "")
+
+	unsigned := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    newFakeCacheService(t).server.URL,
+		UpstreamTileURL: provider.URL,
+	})
+	if _, err := unsigned.GetTile(context.Background(), 3, 1, 2); err == nil {
+		t.Fatal("expected the provider to reject unsigned requests")
+	}
+
+	signed := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    newFakeCacheService(t).server.URL,
+		UpstreamTileURL: provider.URL,
+		Signers:         map[string]RequestSigner{DefaultProvider: HMACSigner{Param: "signature", Secret: secret}},
+	})
+	data, err := signed.GetTile(context.Background(), 3, 1, 2)
+	if err != nil {
+		t.Fatalf("GetTile failed: %v", err)
+	}
+	if string(data) != "tile" {
+		t.Fatalf("expected the provider's tile, got %q", data)
+	}
+}
+
+func TestGetTile_SignsPerProvider(t *testing.T) {
+	paid := newSigningProvider(t, nil, "token")
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:     newFakeCacheService(t).server.URL,
+		Providers:        map[string]string{"paid": paid.URL},
+		WeightedUpstream: WeightedUpstreamConfig{Weights: map[string]int{"paid": 1}},
+		Signers:          map[string]RequestSigner{"paid": APIKeySigner{Param: "access_token", Key: "token"}},
+	})
+	if _, err := uc.GetTile(context.Background(), 3, 1, 2); err != nil {
+		t.Fatalf("GetTile failed: %v", err)
+	}
+}
+
+func TestNewTileUseCase_RejectsSignerForUnknownProvider(t *testing.T) {
+	_, err := NewTileUseCase(TileUseCaseConfig{
+		Signers: map[string]RequestSigner{"paid": APIKeySigner{Param: "key", Key: "k"}},
+	}, testLogger())
+	if !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("expected ErrUnknownProvider, got %v", err)
+	}
+}
+
+func TestParseSigners(t *testing.T) {
+	signers, err := ParseSigners(map[string]string{
+		"osm":  "apikey:access_token:abc",
+		"paid": "hmac-sha256:sig:def",
+	})
+	if err != nil {
+		t.Fatalf("ParseSigners failed: %v", err)
+	}
+	if s, ok := signers["osm"].(APIKeySigner); !ok || s.Param != "access_token" || s.Key != "abc" {
+		t.Errorf("unexpected osm signer %#v", signers["osm"])
+	}
+	if s, ok := signers["paid"].(HMACSigner); !ok || s.Param != "sig" || string(s.Secret) != "def" {
+		t.Errorf("unexpected paid signer %#v", signers["paid"])
+	}
+
+	for _, spec := range []string{"apikey", "apikey:param", "apikey::key", "rsa:param:key"} {
+		if _, err := ParseSigners(map[string]string{"osm": spec}); !errors.Is(err, ErrInvalidSigner) {
+			t.Errorf("%q: expected ErrInvalidSigner, got %v", spec, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+var ErrUnknownProvider = errors.New("unknown tile provider")
+
+// TileDiff describes how the same tile differs between two providers.
+type TileDiff struct {
+	ProviderA string `json:"provider_a"`
+	ProviderB string `json:"provider_b"`
+	Identical bool   `json:"identical"`
+	SizeA     int    `json:"size_a"`
+	SizeB     int    `json:"size_b"`
+	// SameDimensions is false when the images cannot be compared pixel by pixel
+	SameDimensions  bool    `json:"same_dimensions"`
+	DifferingPixels int     `json:"differing_pixels"`
+	TotalPixels     int     `json:"total_pixels"`
+	DiffRatio       float64 `json:"diff_ratio"`
+}
+
+// DiffTile fetches the tile from both providers, bypassing the cache, and
+// compares the bytes and the decoded pixels.
+func (uc *TileUseCase) DiffTile(z, x, y int, providerA, providerB string) (*TileDiff, error) {
+	dataA, err := uc.fetchFromProvider(providerA, z, x, y)
+	if err != nil {
+		return nil, err
+	}
+	dataB, err := uc.fetchFromProvider(providerB, z, x, y)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &TileDiff{
+		ProviderA: providerA,
+		ProviderB: providerB,
+		Identical: bytes.Equal(dataA, dataB),
+		SizeA:     len(dataA),
+		SizeB:     len(dataB),
+	}
+
+	imgA, _, err := image.Decode(bytes.NewReader(dataA))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode tile from %s: %w", providerA, err)
+	}
+	imgB, _, err := image.Decode(bytes.NewReader(dataB))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode tile from %s: %w", providerB, err)
+	}
+
+	diff.DifferingPixels, diff.TotalPixels, diff.SameDimensions = pixelDiff(imgA, imgB)
+	if diff.TotalPixels > 0 {
+		diff.DiffRatio = float64(diff.DifferingPixels) / float64(diff.TotalPixels)
+	}
+
+	uc.logger.Info("compared tile between providers",
+		"z", z, "x", x, "y", y, "a", providerA, "b", providerB,
+		"identical", diff.Identical, "differing_pixels", diff.DifferingPixels)
+
+	return diff, nil
+}
+
+func (uc *TileUseCase) fetchFromProvider(provider string, z, x, y int) ([]byte, error) {
+	template, ok := uc.providers[provider]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, provider)
+	}
+	data, _, err := uc.fetchUpstream(context.Background(), provider, template.URL(z, x, y))
+	if err != nil {
+		return nil, fmt.Errorf("provider %s: %w", provider, err)
+	}
+	return data, nil
+}
+
+// pixelDiff counts pixels whose colour differs. Images of different sizes
+// are reported as entirely different.
+func pixelDiff(a, b image.Image) (differing, total int, sameDimensions bool) {
+	boundsA, boundsB := a.Bounds(), b.Bounds()
+	if boundsA.Dx() != boundsB.Dx() || boundsA.Dy() != boundsB.Dy() {
+		total = max(boundsA.Dx()*boundsA.Dy(), boundsB.Dx()*boundsB.Dy())
+		return total, total, false
+	}
+
+	for dy := 0; dy < boundsA.Dy(); dy++ {
+		for dx := 0; dx < boundsA.Dx(); dx++ {
+			r1, g1, b1, a1 := a.At(boundsA.Min.X+dx, boundsA.Min.Y+dy).RGBA()
+			r2, g2, b2, a2 := b.At(boundsB.Min.X+dx, boundsB.Min.Y+dy).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				differing++
+			}
+		}
+	}
+	return differing, boundsA.Dx() * boundsA.Dy(), true
+}
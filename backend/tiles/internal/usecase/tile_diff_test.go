@@ -0,0 +1,84 @@
+package usecase
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodeTestPNG(t *testing.T, size int, fill color.Color, marked int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.Set(x, y, fill)
+		}
+	}
+	// Paint the first `marked` pixels red to create a known difference
+	for i := 0; i < marked; i++ {
+		img.Set(i%size, i/size, color.RGBA{R: 255, A: 255})
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDiffTile(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	base := encodeTestPNG(t, 16, white, 0)
+
+	osm := newFakeUpstream(t, base)
+	mirror := newFakeUpstream(t, base)
+	other := newFakeUpstream(t, encodeTestPNG(t, 16, white, 10))
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		Providers: map[string]string{
+			"osm":    osm.server.URL,
+			"mirror": mirror.server.URL,
+			"other":  other.server.URL,
+		},
+	})
+
+	t.Run("identical", func(t *testing.T) {
+		diff, err := uc.DiffTile(3, 1, 2, "osm", "mirror")
+		if err != nil {
+			t.Fatalf("DiffTile failed: %v", err)
+		}
+		if !diff.Identical || diff.DifferingPixels != 0 || diff.DiffRatio != 0 {
+			t.Fatalf("expected identical tiles, got %+v", diff)
+		}
+		if diff.SizeA != len(base) || diff.SizeB != len(base) {
+			t.Fatalf("unexpected sizes: %+v", diff)
+		}
+		if diff.TotalPixels != 256 || !diff.SameDimensions {
+			t.Fatalf("unexpected dimensions: %+v", diff)
+		}
+	})
+
+	t.Run("different", func(t *testing.T) {
+		diff, err := uc.DiffTile(3, 1, 2, "osm", "other")
+		if err != nil {
+			t.Fatalf("DiffTile failed: %v", err)
+		}
+		if diff.Identical {
+			t.Fatalf("expected tiles to differ, got %+v", diff)
+		}
+		if diff.DifferingPixels != 10 || diff.TotalPixels != 256 {
+			t.Fatalf("expected 10 of 256 pixels to differ, got %+v", diff)
+		}
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		_, err := uc.DiffTile(3, 1, 2, "osm", "missing")
+		if !errors.Is(err, ErrUnknownProvider) {
+			t.Fatalf("expected ErrUnknownProvider, got %v", err)
+		}
+	})
+}
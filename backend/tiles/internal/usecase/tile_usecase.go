@@ -2,130 +2,1082 @@ package usecase
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/jaennil/guide_helper/backend/cache/pkg/cacherpc"
+	"github.com/jaennil/guide_helper/backend/cache/pkg/tilemath"
 	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
 	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-type cacheResponse struct {
-	Success bool      `json:"success"`
-	Message string    `json:"message"`
-	Data    cacheData `json:"data"`
-}
+// ErrMaintenance is returned instead of contacting upstream while the
+// service is in maintenance mode.
+var ErrMaintenance = errors.New("upstream disabled by maintenance mode")
+
+// ErrResponseBudgetExceeded is returned when upstream did not answer within
+// the response budget and there was no stale tile to fall back to.
+var ErrResponseBudgetExceeded = errors.New("response budget exceeded")
+
+// ErrNotCached is returned by GetTileFromCache when the cache has no copy of
+// the tile.
+var ErrNotCached = errors.New("tile not cached")
+
+// ErrTileNotFound is returned for tiles upstream does not have, whether
+// upstream just answered 404 or the cache recorded an earlier 404.
+var ErrTileNotFound = errors.New("tile does not exist upstream")
 
+// ErrUpstreamBodyTooLarge is returned when an upstream response exceeds the
+// buffer limit. Tiles are served from memory, so such a body is abandoned
+// rather than served or cached.
+var ErrUpstreamBodyTooLarge = errors.New("upstream response exceeds the buffer limit")
+
+// cacheData is what the cache knows about a tile, whichever API it was
+// read from.
 type cacheData struct {
-	Data   []byte `json:"data"`
-	Exists bool   `json:"exists"`
+	Data     []byte
+	Exists   bool
+	StoredAt *time.Time
+	// ETag is the cache's validator of Data, empty if it sent none
+	ETag string
+	// NotFound records that upstream has no such tile
+	NotFound bool
+}
+
+// The cache's raw tile endpoint reports when a tile was stored in
+// cacheStoredAtHeader, and marks a 404 for a tile recorded as missing
+// upstream with cacheNotFoundHeader.
+const (
+	cacheStoredAtHeader = "X-Tile-Stored-At"
+	cacheNotFoundHeader = "X-Tile-Not-Found"
+)
+
+type TileUseCaseConfig struct {
+	CacheBaseURL string
+	// CacheGRPCAddr, when set, reads and stores tiles over the cache's gRPC
+	// API at this address instead of HTTP. Health checks and purges keep
+	// using CacheBaseURL.
+	CacheGRPCAddr string
+	// CacheAPIKey is sent with purges, which the cache only accepts with
+	// one of its API keys
+	CacheAPIKey string
+	// UpstreamTileURL is the URLTemplate of the upstream tile server, or its
+	// base URL
+	UpstreamTileURL string
+	// MaxServedAge refuses cached tiles stored longer ago than this, regardless
+	// of the cache TTL. Zero disables the check.
+	MaxServedAge time.Duration
+	// Providers maps provider names to tile server URL templates or base
+	// URLs for comparisons and weighted fetches
+	Providers map[string]string
+	// Subdomains are what {s} in URL templates expands to, one after the
+	// other
+	Subdomains []string
+	// Retina expands {r} in URL templates to "@2x", fetching high
+	// resolution tiles
+	Retina bool
+	// IgnoreNoStore caches upstream tiles even when they are served with
+	// Cache-Control: no-store, for providers that set it on everything.
+	IgnoreNoStore bool
+	// Maintenance starts the service serving cached tiles only
+	Maintenance bool
+	StoreRetry  StoreRetryConfig
+	Budget      UpstreamBudgetConfig
+	// MaintenanceWindows are scheduled upstream outages. Inside them
+	// upstream is not contacted and expired cached tiles are served as is.
+	MaintenanceWindows []MaintenanceWindow
+	// VerifySampleRate is the fraction of cache hits that are also fetched
+	// from upstream to detect corrupted cache entries. Zero disables it.
+	VerifySampleRate float64
+	// OptimizePNG strips PNG chunks that do not affect rendering, such as
+	// text and timestamps, from upstream tiles before they are served and
+	// cached. It costs a pass over every fetched tile.
+	OptimizePNG bool
+	// MinTileBytes and MaxTileBytes bound the size of tiles worth caching,
+	// catching truncated and anomalous tiles. Zero disables a bound.
+	MinTileBytes int
+	MaxTileBytes int
+	// ResponseBudget bounds how long GetTile waits before falling back to a
+	// stale tile. Zero waits for upstream.
+	ResponseBudget time.Duration
+	// UpstreamProtocol is one of ProtocolHTTP1, ProtocolHTTP2 or
+	// ProtocolHTTP3; empty means HTTP/2.
+	UpstreamProtocol string
+	// ClientDisconnectGrace is how long an upstream fetch keeps going after
+	// the client went away. A tile fully fetched within it is still cached,
+	// a fetch cut off mid-body is discarded. Zero cancels it right away.
+	ClientDisconnectGrace time.Duration
+	// VariantCacheSize is how many reduced quality and transcoded tiles are
+	// kept in memory. Zero re-encodes them on every request.
+	VariantCacheSize int
+	// Encoders transcode tiles to the formats they are keyed by
+	Encoders map[Format]ImageEncoder
+	// MaxBufferBytes bounds how much of an upstream response is read into
+	// memory, guarding against upstreams streaming huge bodies. Zero
+	// disables the limit.
+	MaxBufferBytes int64
+	// WeightedUpstream spreads fetches over Providers instead of always
+	// using UpstreamTileURL.
+	WeightedUpstream WeightedUpstreamConfig
+	// NeighborPrefetch warms the tiles around a cache miss in the background
+	NeighborPrefetch NeighborPrefetchConfig
+	// CacheCircuit pauses cache stores while cache responses fail to parse
+	CacheCircuit CacheCircuitConfig
+	// SecondMiss only caches tiles requested again after a first miss.
+	// Prefetched tiles are always cached.
+	SecondMiss SecondMissConfig
+	// CacheNotFound records tiles upstream answers 404 for in the cache, so
+	// they are not requested again until the cache expires the record
+	CacheNotFound bool
+	// Signers sign requests to the providers they are keyed by, with
+	// DefaultProvider for UpstreamTileURL. Redirects to upstream are not
+	// signed, since that would hand the credentials to clients.
+	Signers map[string]RequestSigner
+	// ContentTypeModes decide, per provider keyed like Signers, what happens
+	// to tiles upstream serves as something other than PNG. Providers
+	// without a mode pass them through.
+	ContentTypeModes map[string]ContentTypeMode
+	// MaxZoom handles tiles above the zoom providers serve
+	MaxZoom MaxZoomConfig
+	// RetryBudget lets a request retry failed cache probes and upstream
+	// fetches within a shared budget
+	RetryBudget RetryBudgetConfig
+	// SharedFetch lets concurrent requests for a tile share its fetch
+	SharedFetch SharedFetchConfig
+	// EarlyRefresh refreshes cached tiles shortly before they expire
+	EarlyRefresh EarlyRefreshConfig
+	// CacheLatency skips cache probes while the cache is slow
+	CacheLatency CacheLatencyConfig
+	// RateLimit caps requests to upstream, whatever prompted them
+	RateLimit UpstreamRateLimitConfig
+	// StoreSource has the cache record the upstream URL each stored tile
+	// was fetched from, shown by the cache's tile meta endpoint
+	StoreSource bool
+	// Layers are named tile sets served next to the default tiles, each
+	// from its own upstream and cached apart from the others
+	Layers map[string]LayerConfig
+}
+
+// tileSourceHeader carries the upstream URL of a tile stored in the cache,
+// tileETagHeader and tileLastModifiedHeader the validators upstream served
+// it with.
+const (
+	tileSourceHeader       = "X-Tile-Source"
+	tileETagHeader         = "X-Tile-ETag"
+	tileLastModifiedHeader = "X-Tile-Last-Modified"
+)
+
+// tileOrigin is where a tile fresh from upstream came from: the URL it was
+// fetched from and the validators upstream served it with, zero if it sent
+// none.
+type tileOrigin struct {
+	URL          string
+	ETag         string
+	LastModified time.Time
+}
+
+// originOf is the origin of a tile fetched from upstreamURL with the given
+// response headers. An invalid Last-Modified is dropped.
+func originOf(upstreamURL string, header http.Header) tileOrigin {
+	origin := tileOrigin{URL: upstreamURL, ETag: header.Get("ETag")}
+	if value := header.Get("Last-Modified"); value != "" {
+		if lastModified, err := http.ParseTime(value); err == nil {
+			origin.LastModified = lastModified
+		}
+	}
+	return origin
+}
+
+// StoreRetryConfig controls how failed cache stores are retried. Delays grow
+// exponentially from BaseDelay up to MaxDelay and are fully jittered so that
+// stores failing together do not retry together.
+type StoreRetryConfig struct {
+	// MaxAttempts includes the first try; the tile is dropped after that
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
 }
 
 type TileUseCase struct {
-	cacheBaseURL      string
-	upstreamTileURL   string
-	httpClient        *http.Client
-	logger            logger.Logger
+	cacheBaseURL     string
+	cacheAPIKey      string
+	cacheRPC         *cacherpc.Client
+	upstream         *URLTemplate
+	maxServedAge     time.Duration
+	providers        map[string]*URLTemplate
+	layers           map[string]LayerConfig
+	layerURLs        map[string]*URLTemplate
+	signers          map[string]RequestSigner
+	contentTypeModes map[string]ContentTypeMode
+	maxZoom          MaxZoomConfig
+	retryBudget      RetryBudgetConfig
+	upstreams        *upstreamPool
+	ignoreNoStore    bool
+	cacheNotFound    bool
+	storeSource      bool
+	maintenance      atomic.Bool
+	// windows are maintenance windows and must not change after construction
+	windows         []MaintenanceWindow
+	budget          *upstreamBudget
+	rateLimiter     *rateLimiter
+	budgetExhausted atomic.Bool
+	storeRetry      StoreRetryConfig
+	stores          sync.WaitGroup
+	verifyRate      float64
+	optimizePNG     bool
+	minTileBytes    int
+	maxTileBytes    int
+	maxBufferBytes  int64
+	responseBudget  time.Duration
+	disconnectGrace time.Duration
+	variants        *variantCache
+	encoders        map[Format]ImageEncoder
+	encodeSlots     chan struct{}
+	misses          *missTracker
+	circuit         *cacheCircuit
+	cacheLatency    *cacheLatencyCircuit
+	neighbors       *neighborPrefetcher
+	fetches         *fetchSharing
+	earlyRefresh    *earlyRefresher
+	httpClient      *http.Client
+	upstreamClient  *http.Client
+	logger          logger.Logger
+	now             func() time.Time
+	sleep           func(time.Duration)
+	// upstreamTTFB and upstreamLatency observe upstream fetch timings
+	upstreamTTFB    prometheus.Observer
+	upstreamLatency prometheus.Observer
 }
 
-func NewTileUseCase(cacheBaseURL, upstreamTileURL string, logger logger.Logger) *TileUseCase {
-	return &TileUseCase{
-		cacheBaseURL:    cacheBaseURL,
-		upstreamTileURL: upstreamTileURL,
+func NewTileUseCase(cfg TileUseCaseConfig, logger logger.Logger) (*TileUseCase, error) {
+	uc := &TileUseCase{
+		cacheBaseURL:     cfg.CacheBaseURL,
+		cacheAPIKey:      cfg.CacheAPIKey,
+		maxServedAge:     cfg.MaxServedAge,
+		layers:           cfg.Layers,
+		signers:          cfg.Signers,
+		contentTypeModes: cfg.ContentTypeModes,
+		maxZoom:          cfg.MaxZoom,
+		retryBudget:      cfg.RetryBudget,
+		ignoreNoStore:    cfg.IgnoreNoStore,
+		cacheNotFound:    cfg.CacheNotFound,
+		storeSource:      cfg.StoreSource,
+		storeRetry:       cfg.StoreRetry,
+		verifyRate:       cfg.VerifySampleRate,
+		optimizePNG:      cfg.OptimizePNG,
+		minTileBytes:     cfg.MinTileBytes,
+		maxTileBytes:     cfg.MaxTileBytes,
+		maxBufferBytes:   cfg.MaxBufferBytes,
+		responseBudget:   cfg.ResponseBudget,
+		disconnectGrace:  cfg.ClientDisconnectGrace,
+		variants:         newVariantCache(cfg.VariantCacheSize),
+		encoders:         cfg.Encoders,
+		encodeSlots:      newEncodeSlots(),
+		misses:           newMissTracker(cfg.SecondMiss),
+		circuit:          newCacheCircuit(cfg.CacheCircuit),
+		cacheLatency:     newCacheLatencyCircuit(cfg.CacheLatency),
+		neighbors:        newNeighborPrefetcher(cfg.NeighborPrefetch),
+		fetches:          newFetchSharing(cfg.SharedFetch),
+		earlyRefresh:     newEarlyRefresher(cfg.EarlyRefresh, rand.Float64),
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		logger: logger,
+		logger:          logger,
+		now:             time.Now,
+		sleep:           time.Sleep,
+		upstreamTTFB:    metrics.TilesUpstreamTTFB,
+		upstreamLatency: metrics.TilesUpstreamLatency,
+	}
+	uc.maintenance.Store(cfg.Maintenance)
+	uc.windows = cfg.MaintenanceWindows
+
+	upstream, err := NewURLTemplate(cfg.UpstreamTileURL, cfg.Subdomains, cfg.Retina)
+	if err != nil {
+		return nil, err
+	}
+	uc.upstream = upstream
+	if uc.providers, err = newURLTemplates(cfg.Providers, cfg.Subdomains, cfg.Retina); err != nil {
+		return nil, err
+	}
+
+	transport, err := newUpstreamTransport(cfg.UpstreamProtocol, nil, logger)
+	if err != nil {
+		return nil, err
+	}
+	uc.upstreamClient = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: transport,
+	}
+
+	upstreams, err := newUpstreamPool(cfg.WeightedUpstream, cfg.Providers)
+	if err != nil {
+		return nil, err
+	}
+	uc.upstreams = upstreams
+
+	for provider := range cfg.Signers {
+		if _, ok := cfg.Providers[provider]; !ok && provider != DefaultProvider {
+			return nil, fmt.Errorf("%w: signer for %s", ErrUnknownProvider, provider)
+		}
+	}
+	for provider := range cfg.ContentTypeModes {
+		if _, ok := cfg.Providers[provider]; !ok && provider != DefaultProvider {
+			return nil, fmt.Errorf("%w: content type mode for %s", ErrUnknownProvider, provider)
+		}
+	}
+	if err := validateMaxZoom(cfg.MaxZoom, cfg.Providers, cfg.Layers); err != nil {
+		return nil, err
+	}
+	if err := validateLayers(cfg.Layers); err != nil {
+		return nil, err
+	}
+	layerTemplates := make(map[string]string, len(cfg.Layers))
+	for name, layer := range cfg.Layers {
+		layerTemplates[name] = layer.URLTemplate
+	}
+	if uc.layerURLs, err = newURLTemplates(layerTemplates, cfg.Subdomains, cfg.Retina); err != nil {
+		return nil, err
+	}
+
+	budget, err := loadUpstreamBudget(cfg.Budget, func() time.Time { return uc.now() })
+	if err != nil {
+		return nil, err
+	}
+	uc.budget = budget
+	uc.rateLimiter = newRateLimiter(cfg.RateLimit, func() time.Time { return uc.now() })
+
+	if cfg.CacheGRPCAddr != "" {
+		client, err := cacherpc.Dial(cfg.CacheGRPCAddr)
+		if err != nil {
+			return nil, err
+		}
+		uc.cacheRPC = client
+	}
+
+	return uc, nil
+}
+
+// Close releases the connection to the cache's gRPC API, if any. Call it
+// once stores have finished.
+func (uc *TileUseCase) Close() error {
+	if uc.cacheRPC == nil {
+		return nil
+	}
+	return uc.cacheRPC.Close()
+}
+
+// SetMaintenance switches maintenance mode, in which cache misses are not
+// fetched from upstream.
+func (uc *TileUseCase) SetMaintenance(enabled bool) {
+	if uc.maintenance.Swap(enabled) != enabled {
+		uc.logger.Warn("maintenance mode changed", "enabled", enabled)
 	}
 }
 
-func (uc *TileUseCase) GetTile(z, x, y int) ([]byte, error) {
+func (uc *TileUseCase) Maintenance() bool {
+	return uc.maintenance.Load()
+}
+
+// Timings breaks down where GetTileTimed spent its time. Phases that did not
+// run are zero.
+type Timings struct {
+	CacheProbe    time.Duration
+	UpstreamFetch time.Duration
+}
+
+// TileInfo describes how GetTileTimed served a tile.
+type TileInfo struct {
+	Timings
+	// ETag is the cache's validator of a tile served as the cache holds it,
+	// fresh or stale. It is empty for tiles from upstream, overzoomed ones
+	// and the placeholder.
+	ETag string
+}
+
+// GetTile serves the tile from the cache or upstream. With a response budget
+// configured it stops waiting for upstream once the budget elapses and falls
+// back to a stale cached tile, if there is one. Cancelling ctx, e.g. when
+// the client disconnects, cancels the upstream fetch after the configured
+// grace period.
+func (uc *TileUseCase) GetTile(ctx context.Context, z, x, y int) ([]byte, error) {
+	data, _, err := uc.GetTileTimed(ctx, z, x, y)
+	return data, err
+}
+
+// GetTileTimed is GetTile that also reports how long each phase took and
+// the cache's ETag of a cached tile. Tiles above the zoom upstream serves
+// are overzoomed or answered with the placeholder instead.
+func (uc *TileUseCase) GetTileTimed(ctx context.Context, z, x, y int) ([]byte, TileInfo, error) {
+	return uc.getTileTimed(ctx, "", z, x, y)
+}
+
+// getTileTimed is GetTileTimed for the tile of a layer, empty for the
+// default one.
+func (uc *TileUseCase) getTileTimed(ctx context.Context, layer string, z, x, y int) ([]byte, TileInfo, error) {
+	if native := uc.nativeZoomOf(layer); native >= 0 && z > native {
+		return uc.beyondMaxZoom(z, x, y, native, func(z, x, y int) ([]byte, TileInfo, error) {
+			return uc.getTileTimed(ctx, layer, z, x, y)
+		})
+	}
 	metrics.TilesRequests.Inc()
+	var info TileInfo
 
-	// Try to get from cache first
-	cacheURL := fmt.Sprintf("%s/api/v1/tile/%d/%d/%d", uc.cacheBaseURL, z, x, y)
-	uc.logger.Debug("checking cache", "url", cacheURL)
+	ctx = uc.withRetryBudget(ctx)
+	clientCtx := ctx
+	if uc.responseBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, uc.responseBudget)
+		defer cancel()
+	}
+	if uc.retryBudget.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, uc.retryBudget.Deadline)
+		defer cancel()
+	}
+
+	start := time.Now()
+	cached, fresh := uc.lookupCacheUnlessSlow(ctx, layer, z, x, y)
+	info.CacheProbe = time.Since(start)
+	data := cached.Data
+	if fresh && data == nil {
+		return nil, info, ErrTileNotFound
+	}
+	if fresh {
+		if uc.verifyRate > 0 && rand.Float64() < uc.verifyRate {
+			uc.stores.Add(1)
+			go func() {
+				defer uc.stores.Done()
+				uc.verifyCachedTile(layer, z, x, y, data)
+			}()
+		}
+		if uc.shouldRefreshEarly(cached.StoredAt) {
+			uc.refreshEarly(layer, z, x, y)
+		}
+		return data, TileInfo{Timings: info.Timings, ETag: cached.ETag}, nil
+	}
+	stale := data
+	staleInfo := func() TileInfo {
+		return TileInfo{Timings: info.Timings, ETag: cached.ETag}
+	}
+
+	if stale != nil && uc.inMaintenanceWindow() {
+		uc.logger.Info("upstream maintenance window, serving expired tile", "layer", layer, "z", z, "x", x, "y", y)
+		metrics.TilesMaintenanceWindowStale.Inc()
+		return stale, staleInfo(), nil
+	}
+
+	uc.warmNeighbors(layer, z, x, y)
+
+	type fetchResult struct {
+		data []byte
+		err  error
+	}
+	// Buffered so an abandoned fetch can still finish and fill the cache
+	result := make(chan fetchResult, 1)
+	start = time.Now()
+	go func() {
+		fetchCtx, cancel := uc.fetchContext(clientCtx)
+		defer cancel()
+		data, err := uc.sharedFetchAndCache(fetchCtx, layer, z, x, y)
+		result <- fetchResult{data: data, err: err}
+	}()
+
+	select {
+	case r := <-result:
+		info.UpstreamFetch = time.Since(start)
+		if errors.Is(r.err, ErrUpstreamThrottled) && stale != nil {
+			uc.logger.Info("upstream rate limited, serving expired tile", "layer", layer, "z", z, "x", x, "y", y)
+			return stale, staleInfo(), nil
+		}
+		return r.data, info, r.err
+	case <-ctx.Done():
+		info.UpstreamFetch = time.Since(start)
+		if err := clientCtx.Err(); err != nil {
+			uc.logger.Debug("client went away before the tile was fetched",
+				"layer", layer, "z", z, "x", x, "y", y, "grace", uc.disconnectGrace)
+			return nil, info, err
+		}
+		metrics.TilesResponseBudgetExceeded.Inc()
+		if stale != nil {
+			uc.logger.Warn("response budget exceeded, serving stale tile",
+				"layer", layer, "z", z, "x", x, "y", y, "budget", uc.responseBudget)
+			return stale, staleInfo(), nil
+		}
+		uc.logger.Warn("response budget exceeded, no stale tile to serve",
+			"layer", layer, "z", z, "x", x, "y", y, "budget", uc.responseBudget)
+		return nil, info, ErrResponseBudgetExceeded
+	}
+}
+
+// GetTileFromCache serves the tile from the cache only, never contacting
+// upstream. A tile past the max served age is still served since there is
+// nothing fresher to offer.
+func (uc *TileUseCase) GetTileFromCache(z, x, y int) ([]byte, TileInfo, error) {
+	return uc.getTileFromCache("", z, x, y)
+}
+
+// getTileFromCache is GetTileFromCache for the tile of a layer, empty for
+// the default one.
+func (uc *TileUseCase) getTileFromCache(layer string, z, x, y int) ([]byte, TileInfo, error) {
+	if native := uc.nativeZoomOf(layer); native >= 0 && z > native {
+		return uc.beyondMaxZoom(z, x, y, native, func(z, x, y int) ([]byte, TileInfo, error) {
+			return uc.getTileFromCache(layer, z, x, y)
+		})
+	}
+	metrics.TilesRequests.Inc()
+
+	start := time.Now()
+	cached, fresh := uc.lookupLayerCache(context.Background(), layer, z, x, y)
+	info := TileInfo{Timings: Timings{CacheProbe: time.Since(start)}}
+	if fresh && cached.Data == nil {
+		return nil, info, ErrTileNotFound
+	}
+	if cached.Data == nil {
+		return nil, info, ErrNotCached
+	}
+	info.ETag = cached.ETag
+	return cached.Data, info, nil
+}
 
-	resp, err := uc.httpClient.Get(cacheURL)
+// fetchContext derives the context of an upstream fetch from the client's.
+// The budget deadline does not carry over, so an abandoned fetch still fills
+// the cache, and cancellation only does once the disconnect grace elapsed.
+func (uc *TileUseCase) fetchContext(clientCtx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(clientCtx))
+	stop := context.AfterFunc(clientCtx, func() {
+		if uc.disconnectGrace <= 0 {
+			cancel()
+			return
+		}
+		time.AfterFunc(uc.disconnectGrace, cancel)
+	})
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// fetchAndCache fetches the tile of a layer, empty for the default one,
+// from upstream and stores it in the cache in the background when upstream
+// allows it. The store does not depend on ctx: once the whole tile arrived
+// it is cached even if the client went away. With the second miss policy a
+// tile is only stored on its second miss.
+func (uc *TileUseCase) fetchAndCache(ctx context.Context, layer string, z, x, y int) ([]byte, error) {
+	tileData, origin, cacheable, err := uc.fetchLayerTile(ctx, layer, z, x, y)
+	if errors.Is(err, ErrTileNotFound) && uc.cacheNotFound {
+		uc.stores.Add(1)
+		go func() {
+			defer uc.stores.Done()
+			uc.storeLayerWithRetry(layer, z, x, y, nil, tileOrigin{})
+		}()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !cacheable {
+		return tileData, nil
+	}
+	if !uc.misses.repeated(layer, z, x, y, uc.now()) {
+		uc.logger.Debug("first miss, not storing tile", "layer", layer, "z", z, "x", x, "y", y)
+		metrics.TilesFirstMissNotStored.Inc()
+		return tileData, nil
+	}
+
+	// Store in cache (fire and forget)
+	uc.stores.Add(1)
+	go func() {
+		defer uc.stores.Done()
+		uc.storeLayerWithRetry(layer, z, x, y, tileData, origin)
+	}()
+
+	return tileData, nil
+}
+
+// lookupCache is lookupLayerCache for the default layer.
+func (uc *TileUseCase) lookupCache(ctx context.Context, z, x, y int) ([]byte, *time.Time, bool) {
+	cached, fresh := uc.lookupLayerCache(ctx, "", z, x, y)
+	return cached.Data, cached.StoredAt, fresh
+}
+
+// lookupLayerCache asks the cache service for the tile of a layer, empty
+// for the default one, and reports whether it may be served. A tile refused
+// for exceeding the max served age is still returned so it can serve as a
+// fallback. A tile recorded as missing upstream is a fresh hit without data.
+// Cache failures are logged and reported as a miss so the tile can still
+// come from upstream, once the retries the request's budget allows are used
+// up.
+func (uc *TileUseCase) lookupLayerCache(ctx context.Context, layer string, z, x, y int) (cacheData, bool) {
+	read := uc.readCache
+	if uc.cacheRPC != nil {
+		read = uc.readCacheRPC
+	}
+	cached, err := read(ctx, layer, z, x, y)
 	if err != nil {
 		uc.logger.Warn("failed to check cache, will fetch from upstream", "error", err)
-	} else {
-		defer resp.Body.Close()
-
-		if resp.StatusCode == http.StatusOK {
-			// Parse JSON response to check if tile exists in cache
-			var cacheResp cacheResponse
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				uc.logger.Warn("failed to read cache response", "error", err)
-			} else {
-				if err := json.Unmarshal(body, &cacheResp); err != nil {
-					uc.logger.Warn("failed to parse cache response", "error", err)
-				} else if cacheResp.Data.Exists && len(cacheResp.Data.Data) > 0 {
-					// Cache hit! Return cached tile
-					uc.logger.Info("cache hit, returning cached tile", "size", len(cacheResp.Data.Data))
-					metrics.TilesCacheHits.Inc()
-					return cacheResp.Data.Data, nil
-				}
+		return cacheData{}, false
+	}
+
+	switch {
+	case cached.NotFound:
+		uc.logger.Info("cache records tile as missing upstream", "layer", layer, "z", z, "x", x, "y", y)
+		metrics.TilesCacheHits.Inc()
+		return cacheData{NotFound: true}, true
+	case cached.Exists && len(cached.Data) > 0 && uc.tooOld(cached.StoredAt):
+		uc.logger.Warn("cached tile exceeds max served age, refreshing from upstream",
+			"z", z, "x", x, "y", y, "stored_at", cached.StoredAt, "max_served_age", uc.maxServedAge)
+		metrics.TilesCacheTooOld.Inc()
+		metrics.TilesCacheMisses.Inc()
+		return cached, false
+	case cached.Exists && len(cached.Data) > 0:
+		// Cache hit! Return cached tile
+		uc.logger.Info("cache hit, returning cached tile", "size", len(cached.Data))
+		metrics.TilesCacheHits.Inc()
+		return cached, true
+	}
+	uc.logger.Info("cache miss, fetching from upstream")
+	metrics.TilesCacheMisses.Inc()
+
+	return cacheData{}, false
+}
+
+// readCache asks the cache's raw tile endpoint for the tile, which answers
+// with the tile bytes or 404. Only failing to reach the cache is an error;
+// tiles that cannot be read, such as truncated ones, are logged and read as
+// a miss.
+func (uc *TileUseCase) readCache(ctx context.Context, layer string, z, x, y int) (cacheData, error) {
+	cacheURL := uc.cacheBaseURL + cacheTilePath(layer, z, x, y) + "/raw"
+	uc.logger.Debug("checking cache", "url", cacheURL)
+
+	resp, err := uc.probeCache(ctx, cacheURL)
+	if err != nil {
+		return cacheData{}, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return cacheData{NotFound: resp.Header.Get(cacheNotFoundHeader) == "true"}, nil
+	default:
+		return cacheData{}, nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	cached := cacheData{Data: data, Exists: true, ETag: resp.Header.Get("ETag")}
+	if err == nil {
+		cached.StoredAt, err = parseStoredAt(resp.Header.Get(cacheStoredAtHeader))
+	}
+	uc.recordCacheParse(err)
+	if err != nil {
+		uc.logger.Warn("failed to read cache response", "error", err)
+		return cacheData{}, nil
+	}
+	return cached, nil
+}
+
+// parseStoredAt parses the cache's stored-at header, which is absent for
+// tiles stored without a time.
+func parseStoredAt(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	storedAt, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s header: %w", cacheStoredAtHeader, err)
+	}
+	return &storedAt, nil
+}
+
+// readCacheRPC asks the cache's gRPC API for the tile, retrying failed calls
+// while the request's retry budget lasts.
+func (uc *TileUseCase) readCacheRPC(ctx context.Context, layer string, z, x, y int) (cacheData, error) {
+	uc.logger.Debug("checking cache over grpc", "layer", layer, "z", z, "x", x, "y", y)
+
+	for {
+		resp, err := uc.cacheRPC.Get(ctx, &cacherpc.GetRequest{Z: uint32(z), X: uint32(x), Y: uint32(y), Layer: layer})
+		if err == nil {
+			cached := cacheData{Data: resp.Data, Exists: resp.Exists, NotFound: resp.NotFound, ETag: resp.Etag}
+			if resp.StoredAtUnixNanos != 0 {
+				storedAt := time.Unix(0, resp.StoredAtUnixNanos)
+				cached.StoredAt = &storedAt
 			}
+			return cached, nil
 		}
-		uc.logger.Info("cache miss, fetching from upstream")
-		metrics.TilesCacheMisses.Inc()
+		if !uc.retry(ctx, "cache") {
+			return cacheData{}, err
+		}
+		uc.logger.Debug("cache probe failed, retrying", "z", z, "x", x, "y", y, "error", err)
+	}
+}
+
+// probeCache requests a tile from the cache service, retrying failed
+// requests and server errors while the request's retry budget lasts. The
+// last response is returned even if it is a server error.
+func (uc *TileUseCase) probeCache(ctx context.Context, cacheURL string) (*http.Response, error) {
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, cacheURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		resp, err := uc.httpClient.Do(req)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			return resp, nil
+		}
+		if !uc.retry(ctx, "cache") {
+			return resp, err
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+		uc.logger.Debug("cache probe failed, retrying", "url", cacheURL, "error", err)
+	}
+}
+
+// fetchTile downloads the tile from the configured upstream tile server and
+// reports the URL it came from and whether it may be cached, which upstream
+// and the size bounds decide.
+// It fails with ErrMaintenance while maintenance mode is on or inside a
+// maintenance window, with ErrBeyondMaxZoom above the zoom upstream serves,
+// and with ErrUpstreamBudgetExhausted once the upstream budget is used up.
+func (uc *TileUseCase) fetchTile(ctx context.Context, z, x, y int) ([]byte, tileOrigin, bool, error) {
+	if err := uc.upstreamAvailable(z, x, y); err != nil {
+		return nil, tileOrigin{}, false, err
+	}
+	if native := uc.nativeZoom(); native >= 0 && z > native {
+		return nil, tileOrigin{}, false, fmt.Errorf("%w: %d is above %d", ErrBeyondMaxZoom, z, native)
+	}
+	if err := uc.takeUpstreamBudget(); err != nil {
+		return nil, tileOrigin{}, false, err
+	}
+
+	tileData, header, source, err := uc.fetchFromUpstreams(ctx, z, x, y)
+	if err != nil {
+		return nil, tileOrigin{}, false, err
+	}
+	tileData, cacheable := uc.cacheableTile(z, x, y, tileData, header)
+	return tileData, originOf(source, header), cacheable, nil
+}
+
+// upstreamAvailable fails with ErrMaintenance while maintenance mode is on
+// or inside a maintenance window.
+func (uc *TileUseCase) upstreamAvailable(z, x, y int) error {
+	if uc.maintenance.Load() {
+		uc.logger.Info("maintenance mode, not fetching from upstream", "z", z, "x", x, "y", y)
+		return ErrMaintenance
+	}
+	if uc.inMaintenanceWindow() {
+		uc.logger.Info("upstream maintenance window, not fetching from upstream", "z", z, "x", x, "y", y)
+		return ErrMaintenance
+	}
+	return nil
+}
+
+// cacheableTile optimizes a tile fresh from upstream and reports whether it
+// may be cached, which upstream's headers and the size bounds decide.
+func (uc *TileUseCase) cacheableTile(z, x, y int, tileData []byte, header http.Header) ([]byte, bool) {
+	uc.logger.Info("fetched tile from upstream", "size", len(tileData))
+	tileData = uc.optimizeTile(tileData)
+
+	if noStore(header) {
+		if !uc.ignoreNoStore {
+			uc.logger.Info("upstream forbids caching, not storing tile", "z", z, "x", x, "y", y)
+			metrics.TilesUpstreamNoStore.Inc()
+			return tileData, false
+		}
+		uc.logger.Debug("ignoring upstream no-store", "z", z, "x", x, "y", y)
+	}
+
+	if reason := uc.sizeRejection(len(tileData)); reason != "" {
+		uc.logger.Debug("tile size out of range, not storing tile",
+			"z", z, "x", x, "y", y, "size", len(tileData), "reason", reason,
+			"min", uc.minTileBytes, "max", uc.maxTileBytes)
+		metrics.TilesSizeRejected.WithLabelValues(reason).Inc()
+		return tileData, false
+	}
+
+	return tileData, true
+}
+
+// UpstreamURL returns where a client can fetch the tile from upstream
+// itself. With weighted providers one is picked by weight among the healthy
+// ones.
+func (uc *TileUseCase) UpstreamURL(z, x, y int) string {
+	if uc.upstreams != nil {
+		name, _ := uc.upstreams.pick(nil, uc.now())
+		return uc.providers[name].URL(z, x, y)
 	}
+	return uc.upstream.URL(z, x, y)
+}
+
+// fetchFromUpstreams fetches the tile from the upstream tile server or, with
+// weighted providers, from a provider picked by weight, and returns the URL
+// it was fetched from. A provider that fails
+// is skipped for a cooldown and the tile is fetched from another one. Failed
+// fetches are retried, and with a retry budget failing over draws from it.
+func (uc *TileUseCase) fetchFromUpstreams(ctx context.Context, z, x, y int) ([]byte, http.Header, string, error) {
+	if uc.upstreams == nil {
+		for {
+			// A retry goes to the next subdomain, if the template has them
+			upstreamURL := uc.upstream.URL(z, x, y)
+			uc.logger.Info("fetching from upstream", "url", upstreamURL)
+			tileData, header, err := uc.fetchUpstream(ctx, DefaultProvider, upstreamURL)
+			if err == nil || ctx.Err() != nil || !retryableFetch(err) || !uc.retryAfter(ctx, "upstream", retryAfterOf(err)) {
+				return tileData, header, upstreamURL, err
+			}
+		}
+	}
+
+	tried := make(map[string]bool)
+	for _, name := range uc.upstreams.names() {
+		tried[name] = !uc.servesZoom(name, z)
+	}
+	var lastErr error
+	for {
+		name, ok := uc.upstreams.pick(tried, uc.now())
+		if !ok {
+			return nil, nil, "", lastErr
+		}
+		tried[name] = true
 
-	// Fetch from upstream
-	upstreamURL := fmt.Sprintf("%s/%d/%d/%d.png", uc.upstreamTileURL, z, x, y)
-	uc.logger.Info("fetching from upstream", "url", upstreamURL)
+		upstreamURL := uc.providers[name].URL(z, x, y)
+		uc.logger.Info("fetching from upstream", "provider", name, "url", upstreamURL)
+		metrics.TilesUpstreamProviderRequests.WithLabelValues(name).Inc()
+		tileData, header, err := uc.fetchUpstream(ctx, name, upstreamURL)
+		if err == nil {
+			return tileData, header, upstreamURL, nil
+		}
+		// Providers serve the same tiles, a missing one is missing everywhere
+		if ctx.Err() != nil || errors.Is(err, ErrTileNotFound) {
+			return nil, nil, "", err
+		}
+
+		uc.logger.Warn("upstream provider failed, failing over", "provider", name, "error", err)
+		metrics.TilesUpstreamProviderFailures.WithLabelValues(name).Inc()
+		uc.upstreams.markDown(name, uc.now())
+		lastErr = fmt.Errorf("provider %s: %w", name, err)
+		if _, ok := retryBudgetFrom(ctx); ok && !uc.retry(ctx, "upstream") {
+			return nil, nil, "", lastErr
+		}
+	}
+}
+
+// sizeRejection reports why a tile of size bytes must not be cached, or an
+// empty string if it may be.
+func (uc *TileUseCase) sizeRejection(size int) string {
+	switch {
+	case uc.minTileBytes > 0 && size < uc.minTileBytes:
+		return "too_small"
+	case uc.maxTileBytes > 0 && size > uc.maxTileBytes:
+		return "too_large"
+	}
+	return ""
+}
 
+// fetchUpstream downloads a single tile from a provider's tile server
+// following the OpenStreetMap tile usage policy, signing the request when
+// the provider has a signer. Tiles that are not PNGs are handled according
+// to the provider's content type mode, those of named layers pass as they
+// are. Cancelling ctx aborts it, even mid-body. The request waits for the
+// rate limiter first and fails with ErrUpstreamThrottled if it would wait
+// too long.
+func (uc *TileUseCase) fetchUpstream(ctx context.Context, provider, upstreamURL string) ([]byte, http.Header, error) {
+	if err := uc.waitForUpstream(ctx); err != nil {
+		return nil, nil, err
+	}
 	metrics.TilesUpstreamRequests.Inc()
 	start := time.Now()
 
-	req, err := http.NewRequest(http.MethodGet, upstreamURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstreamURL, nil)
 	if err != nil {
 		uc.logger.Error("failed to create request", "error", err)
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set required headers for OpenStreetMap tile usage policy
 	req.Header.Set("User-Agent", "GuideHelper/1.0 (https://github.com/jaennil/guide_helper)")
 	req.Header.Set("Referer", "https://guidehelper.ru.tuna.am")
+	if signer, ok := uc.signers[provider]; ok {
+		if err := signer.Sign(req); err != nil {
+			return nil, nil, fmt.Errorf("failed to sign request for %s: %w", provider, err)
+		}
+	}
 
-	resp, err = uc.httpClient.Do(req)
-	latency := time.Since(start).Seconds()
-	metrics.TilesUpstreamLatency.Observe(latency)
+	// Time to first byte separates slow connections from slow transfers.
+	// Transports that do not report it fall back to when headers arrived.
+	var firstByte time.Time
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}))
+
+	resp, err := uc.upstreamClient.Do(req)
 	if err != nil {
+		uc.upstreamLatency.Observe(time.Since(start).Seconds())
 		uc.logger.Error("failed to fetch from upstream", "error", err)
-		return nil, fmt.Errorf("failed to fetch tile from upstream: %w", err)
+		return nil, nil, fmt.Errorf("failed to fetch tile from upstream: %w", err)
 	}
 	defer resp.Body.Close()
+	// Observe the full fetch, including the body, once this returns
+	defer func() { uc.upstreamLatency.Observe(time.Since(start).Seconds()) }()
+
+	if firstByte.IsZero() {
+		firstByte = time.Now()
+	}
+	uc.upstreamTTFB.Observe(firstByte.Sub(start).Seconds())
 
+	if resp.StatusCode == http.StatusNotFound {
+		uc.logger.Info("upstream has no such tile", "url", upstreamURL)
+		return nil, nil, fmt.Errorf("%w: upstream returned status %d", ErrTileNotFound, resp.StatusCode)
+	}
 	if resp.StatusCode != http.StatusOK {
 		uc.logger.Error("upstream returned non-200", "status", resp.StatusCode)
-		return nil, fmt.Errorf("upstream returned status %d", resp.StatusCode)
+		return nil, nil, &upstreamStatusError{
+			status:     resp.StatusCode,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), uc.now()),
+		}
 	}
 
-	tileData, err := io.ReadAll(resp.Body)
+	var body io.Reader = resp.Body
+	if uc.maxBufferBytes > 0 {
+		body = io.LimitReader(resp.Body, uc.maxBufferBytes+1)
+	}
+	tileData, err := io.ReadAll(body)
 	if err != nil {
 		uc.logger.Error("failed to read tile data", "error", err)
-		return nil, fmt.Errorf("failed to read tile data: %w", err)
+		return nil, nil, fmt.Errorf("failed to read tile data: %w", err)
+	}
+	if uc.maxBufferBytes > 0 && int64(len(tileData)) > uc.maxBufferBytes {
+		uc.logger.Warn("upstream response too large, abandoning it",
+			"url", upstreamURL, "limit", uc.maxBufferBytes, "content_length", resp.ContentLength)
+		metrics.TilesUpstreamBodyTooLarge.Inc()
+		return nil, nil, fmt.Errorf("%w of %d bytes", ErrUpstreamBodyTooLarge, uc.maxBufferBytes)
 	}
 
-	uc.logger.Info("fetched tile from upstream", "size", len(tileData))
+	// Layers serve whatever format their style uses, such as JPEG imagery
+	if !strings.HasPrefix(provider, layerProvider("")) {
+		tileData, err = uc.checkContentType(provider, resp.Header.Get("Content-Type"), tileData)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 
-	// Store in cache (fire and forget)
-	go func() {
-		if err := uc.storeTileInCache(z, x, y, tileData); err != nil {
-			uc.logger.Warn("failed to store tile in cache", "error", err)
+	return tileData, resp.Header, nil
+}
+
+// tooOld reports whether a cached tile must not be served because it was
+// stored longer ago than maxServedAge. Tiles without a store time pass.
+func (uc *TileUseCase) tooOld(storedAt *time.Time) bool {
+	if uc.maxServedAge <= 0 || storedAt == nil {
+		return false
+	}
+	return uc.now().Sub(*storedAt) > uc.maxServedAge
+}
+
+// verifyCachedTile compares a served cache hit against upstream and records
+// mismatches. It never changes what was served.
+func (uc *TileUseCase) verifyCachedTile(layer string, z, x, y int, cached []byte) {
+	upstream, _, _, err := uc.fetchLayerTile(context.Background(), layer, z, x, y)
+	if err != nil {
+		uc.logger.Debug("skipping cache verification, upstream unavailable",
+			"layer", layer, "z", z, "x", x, "y", y, "error", err)
+		return
+	}
+	if bytes.Equal(cached, upstream) {
+		return
+	}
+
+	uc.logger.Warn("cached tile does not match upstream",
+		"layer", layer, "z", z, "x", x, "y", y, "cached_size", len(cached), "upstream_size", len(upstream))
+	metrics.TilesCacheMismatch.Inc()
+}
+
+// noStore reports whether the response headers forbid storing the tile.
+func noStore(header http.Header) bool {
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+				return true
+			}
 		}
-	}()
+	}
+	return false
+}
 
-	return tileData, nil
+// storeLayerWithRetry stores the tile of a layer, retrying with jittered
+// exponential backoff and dropping it once the attempts are used up. origin
+// is where upstream served the tile from.
+func (uc *TileUseCase) storeLayerWithRetry(layer string, z, x, y int, data []byte, origin tileOrigin) {
+	attempts := max(uc.storeRetry.MaxAttempts, 1)
+
+	for attempt := 1; ; attempt++ {
+		err := uc.storeTileInCache(layer, z, x, y, data, origin)
+		if err == nil {
+			return
+		}
+		if errors.Is(err, ErrCacheStoreCircuitOpen) {
+			uc.logger.Debug("cache store circuit open, not storing tile", "z", z, "x", x, "y", y)
+			return
+		}
+		if attempt >= attempts {
+			uc.logger.Warn("failed to store tile in cache, dropping it",
+				"layer", layer, "z", z, "x", x, "y", y, "attempts", attempt, "error", err)
+			metrics.TilesCacheStoreDropped.Inc()
+			return
+		}
+
+		delay := uc.retryDelay(attempt)
+		uc.logger.Debug("failed to store tile in cache, retrying",
+			"z", z, "x", x, "y", y, "attempt", attempt, "delay", delay, "error", err)
+		metrics.TilesCacheStoreRetries.Inc()
+		uc.sleep(delay)
+	}
+}
+
+// WaitForStores blocks until every background cache store has finished,
+// including its retries, and every neighbor warm and sampled verification
+// with it.
+func (uc *TileUseCase) WaitForStores() {
+	uc.stores.Wait()
 }
 
-func (uc *TileUseCase) storeTileInCache(z, x, y int, data []byte) error {
-	cacheURL := fmt.Sprintf("%s/api/v1/tile/%d/%d/%d", uc.cacheBaseURL, z, x, y)
+// retryDelay picks a random delay up to the exponential backoff ceiling for
+// the given attempt ("full jitter").
+func (uc *TileUseCase) retryDelay(attempt int) time.Duration {
+	ceiling := uc.storeRetry.BaseDelay << (attempt - 1)
+	if ceiling <= 0 || (uc.storeRetry.MaxDelay > 0 && ceiling > uc.storeRetry.MaxDelay) {
+		ceiling = uc.storeRetry.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// storeTileInCache stores the tile of a layer, empty for the default one,
+// or records it as missing upstream when data is nil. The cache keeps the
+// validators upstream served the tile with, and with source storing enabled
+// the upstream URL it was fetched from.
+func (uc *TileUseCase) storeTileInCache(layer string, z, x, y int, data []byte, origin tileOrigin) error {
+	if uc.circuit.open(uc.now()) {
+		return ErrCacheStoreCircuitOpen
+	}
+	if uc.cacheRPC != nil {
+		return uc.storeTileRPC(layer, z, x, y, data, origin)
+	}
+
+	cacheURL := uc.cacheBaseURL + cacheTilePath(layer, z, x, y)
+	if data == nil {
+		cacheURL += "?not_found=true"
+	}
 	uc.logger.Debug("storing in cache", "url", cacheURL)
 
 	req, err := http.NewRequest(http.MethodPost, cacheURL, bytes.NewReader(data))
@@ -133,6 +1085,15 @@ func (uc *TileUseCase) storeTileInCache(z, x, y int, data []byte) error {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/octet-stream")
+	if uc.storeSource && origin.URL != "" {
+		req.Header.Set(tileSourceHeader, origin.URL)
+	}
+	if origin.ETag != "" {
+		req.Header.Set(tileETagHeader, origin.ETag)
+	}
+	if !origin.LastModified.IsZero() {
+		req.Header.Set(tileLastModifiedHeader, origin.LastModified.UTC().Format(http.TimeFormat))
+	}
 
 	resp, err := uc.httpClient.Do(req)
 	if err != nil {
@@ -144,6 +1105,39 @@ func (uc *TileUseCase) storeTileInCache(z, x, y int, data []byte) error {
 		return fmt.Errorf("cache returned status %d", resp.StatusCode)
 	}
 
-	uc.logger.Info("stored tile in cache", "z", z, "x", x, "y", y)
+	uc.logger.Info("stored tile in cache", "layer", layer, "z", z, "x", x, "y", y)
+	return nil
+}
+
+// storeTileRPC is storeTileInCache over the cache's gRPC API.
+func (uc *TileUseCase) storeTileRPC(layer string, z, x, y int, data []byte, origin tileOrigin) error {
+	ctx, cancel := context.WithTimeout(context.Background(), uc.httpClient.Timeout)
+	defer cancel()
+
+	req := &cacherpc.SetRequest{
+		Z: uint32(z), X: uint32(x), Y: uint32(y), Data: data, NotFound: data == nil, Layer: layer,
+		UpstreamEtag: origin.ETag,
+	}
+	if !origin.LastModified.IsZero() {
+		req.LastModifiedUnixNanos = origin.LastModified.UnixNano()
+	}
+	if uc.storeSource {
+		req.Source = origin.URL
+	}
+	uc.logger.Debug("storing in cache over grpc", "layer", layer, "z", z, "x", x, "y", y)
+	if _, err := uc.cacheRPC.Set(ctx, req); err != nil {
+		return fmt.Errorf("failed to store in cache: %w", err)
+	}
+
+	uc.logger.Info("stored tile in cache", "layer", layer, "z", z, "x", x, "y", y)
 	return nil
 }
+
+// cacheTilePath is the path of a tile in the cache's HTTP API, under the
+// layer's routes for a named layer.
+func cacheTilePath(layer string, z, x, y int) string {
+	if layer == "" {
+		return "/api/v1/tile/" + tilemath.Key(z, x, y)
+	}
+	return "/api/v1/layers/" + layer + "/tile/" + tilemath.Key(z, x, y)
+}
@@ -0,0 +1,844 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type fakeTile struct {
+	data     []byte
+	storedAt *time.Time
+	notFound bool
+	// source is the upstream URL reported with the store, etag and
+	// lastModified the validators
+	source       string
+	etag         string
+	lastModified string
+}
+
+// fakeCacheService mimics the cache service HTTP API backed by a map.
+// Tiles are read from the raw tile endpoint.
+type fakeCacheService struct {
+	mu     sync.Mutex
+	tiles  map[string]fakeTile
+	stored chan string
+	server *httptest.Server
+	// failStores makes the next N stores fail as if the service was down
+	failStores atomic.Int64
+}
+
+func newFakeCacheService(t *testing.T) *fakeCacheService {
+	t.Helper()
+
+	f := &fakeCacheService{
+		tiles:  make(map[string]fakeTile),
+		stored: make(chan string, 100),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeCacheService) put(z, x, y int, tile fakeTile) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tiles[fmt.Sprintf("%d/%d/%d", z, x, y)] = tile
+}
+
+func (f *fakeCacheService) get(z, x, y int) (fakeTile, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tile, ok := f.tiles[fmt.Sprintf("%d/%d/%d", z, x, y)]
+	return tile, ok
+}
+
+func (f *fakeCacheService) serve(w http.ResponseWriter, r *http.Request) {
+	var z, x, y int
+	if _, err := fmt.Sscanf(r.URL.Path, "/api/v1/tile/%d/%d/%d", &z, &x, &y); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	key := fmt.Sprintf("%d/%d/%d", z, x, y)
+
+	switch r.Method {
+	case http.MethodGet:
+		tile, ok := f.get(z, x, y)
+		if !ok || tile.notFound {
+			if tile.notFound {
+				w.Header().Set(cacheNotFoundHeader, "true")
+			}
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if tile.storedAt != nil {
+			w.Header().Set(cacheStoredAtHeader, tile.storedAt.Format(time.RFC3339Nano))
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(tile.data)
+	case http.MethodPost:
+		if f.failStores.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		now := time.Now()
+		f.put(z, x, y, fakeTile{
+			data:         body,
+			storedAt:     &now,
+			notFound:     r.URL.Query().Get("not_found") == "true",
+			source:       r.Header.Get(tileSourceHeader),
+			etag:         r.Header.Get(tileETagHeader),
+			lastModified: r.Header.Get(tileLastModifiedHeader),
+		})
+		w.WriteHeader(http.StatusOK)
+		f.stored <- key
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeCacheService) waitStored(t *testing.T) string {
+	t.Helper()
+	select {
+	case key := <-f.stored:
+		return key
+	case <-time.After(5 * time.Second):
+		t.Fatal("tile was not stored in cache")
+		return ""
+	}
+}
+
+// fakeUpstream serves the same body for every tile and counts requests.
+type fakeUpstream struct {
+	body   []byte
+	header http.Header
+	// block, when set, holds every response until it is closed
+	block    chan struct{}
+	requests atomic.Int64
+	server   *httptest.Server
+
+	mu    sync.Mutex
+	times []time.Time
+}
+
+func newFakeUpstream(t *testing.T, body []byte) *fakeUpstream {
+	t.Helper()
+
+	f := &fakeUpstream{body: body}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.requests.Add(1)
+		f.mu.Lock()
+		f.times = append(f.times, time.Now())
+		f.mu.Unlock()
+		if f.block != nil {
+			<-f.block
+		}
+		for k, v := range f.header {
+			w.Header()[k] = v
+		}
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "image/png")
+		}
+		w.Write(f.body)
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeUpstream) requestTimes() []time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]time.Time(nil), f.times...)
+}
+
+func testLogger() logger.Logger {
+	return logger.FromContext(context.Background())
+}
+
+func newTestUseCase(t *testing.T, cfg TileUseCaseConfig) *TileUseCase {
+	t.Helper()
+
+	uc, err := NewTileUseCase(cfg, testLogger())
+	if err != nil {
+		t.Fatalf("failed to create tile usecase: %v", err)
+	}
+	return uc
+}
+
+func TestGetTile_MaxServedAgeForcesRefresh(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("fresh"))
+
+	longAgo := time.Now().Add(-365 * 24 * time.Hour)
+	cacheSvc.put(5, 10, 12, fakeTile{data: []byte("stale"), storedAt: &longAgo})
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+		MaxServedAge:    time.Hour,
+	})
+
+	data, err := uc.GetTile(context.Background(), 5, 10, 12)
+	if err != nil {
+		t.Fatalf("GetTile failed: %v", err)
+	}
+	if string(data) != "fresh" {
+		t.Fatalf("expected refreshed tile, got %q", data)
+	}
+	if got := upstream.requests.Load(); got != 1 {
+		t.Fatalf("expected 1 upstream request, got %d", got)
+	}
+
+	cacheSvc.waitStored(t)
+	if tile, _ := cacheSvc.get(5, 10, 12); string(tile.data) != "fresh" {
+		t.Fatalf("expected cache to be refreshed, got %q", tile.data)
+	}
+}
+
+func TestGetTile_WithinMaxServedAgeServesCache(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("fresh"))
+
+	recently := time.Now().Add(-time.Minute)
+	cacheSvc.put(5, 10, 12, fakeTile{data: []byte("cached"), storedAt: &recently})
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+		MaxServedAge:    time.Hour,
+	})
+
+	data, err := uc.GetTile(context.Background(), 5, 10, 12)
+	if err != nil {
+		t.Fatalf("GetTile failed: %v", err)
+	}
+	if string(data) != "cached" {
+		t.Fatalf("expected cached tile, got %q", data)
+	}
+	if got := upstream.requests.Load(); got != 0 {
+		t.Fatalf("expected no upstream requests, got %d", got)
+	}
+}
+
+func TestGetTile_UpstreamNoStoreIsNotCached(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("private"))
+	upstream.header = http.Header{"Cache-Control": {"max-age=0, No-Store"}}
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+	})
+
+	data, err := uc.GetTile(context.Background(), 5, 10, 12)
+	if err != nil {
+		t.Fatalf("GetTile failed: %v", err)
+	}
+	if string(data) != "private" {
+		t.Fatalf("expected upstream tile, got %q", data)
+	}
+
+	select {
+	case key := <-cacheSvc.stored:
+		t.Fatalf("tile %s was cached despite no-store", key)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if _, ok := cacheSvc.get(5, 10, 12); ok {
+		t.Fatal("tile should not be in cache")
+	}
+}
+
+func TestGetTile_IgnoreNoStoreCaches(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("tile"))
+	upstream.header = http.Header{"Cache-Control": {"no-store"}}
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+		IgnoreNoStore:   true,
+	})
+
+	if _, err := uc.GetTile(context.Background(), 5, 10, 12); err != nil {
+		t.Fatalf("GetTile failed: %v", err)
+	}
+	if key := cacheSvc.waitStored(t); key != "5/10/12" {
+		t.Fatalf("unexpected stored key %q", key)
+	}
+}
+
+func TestGetTile_MaintenanceServesCacheOnly(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("fresh"))
+	cacheSvc.put(5, 10, 12, fakeTile{data: []byte("cached")})
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+	})
+	uc.SetMaintenance(true)
+
+	data, err := uc.GetTile(context.Background(), 5, 10, 12)
+	if err != nil {
+		t.Fatalf("GetTile failed for cached tile: %v", err)
+	}
+	if string(data) != "cached" {
+		t.Fatalf("expected cached tile, got %q", data)
+	}
+
+	if _, err := uc.GetTile(context.Background(), 5, 11, 12); !errors.Is(err, ErrMaintenance) {
+		t.Fatalf("expected ErrMaintenance on miss, got %v", err)
+	}
+	if got := upstream.requests.Load(); got != 0 {
+		t.Fatalf("expected no upstream requests, got %d", got)
+	}
+
+	uc.SetMaintenance(false)
+	if _, err := uc.GetTile(context.Background(), 5, 11, 12); err != nil {
+		t.Fatalf("GetTile failed after leaving maintenance: %v", err)
+	}
+	if got := upstream.requests.Load(); got != 1 {
+		t.Fatalf("expected 1 upstream request, got %d", got)
+	}
+}
+
+func newRetryingUseCase(t *testing.T, cacheSvc *fakeCacheService, cfg StoreRetryConfig) (*TileUseCase, *[]time.Duration) {
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL: cacheSvc.server.URL,
+		StoreRetry:   cfg,
+	})
+
+	var delays []time.Duration
+	uc.sleep = func(d time.Duration) { delays = append(delays, d) }
+	return uc, &delays
+}
+
+func TestStoreWithRetry_SucceedsAfterCacheRecovers(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	cacheSvc.failStores.Store(2)
+
+	cfg := StoreRetryConfig{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	uc, delays := newRetryingUseCase(t, cacheSvc, cfg)
+
+	uc.storeLayerWithRetry("", 5, 10, 12, []byte("tile"), tileOrigin{})
+
+	if tile, ok := cacheSvc.get(5, 10, 12); !ok || string(tile.data) != "tile" {
+		t.Fatal("expected tile to be stored once the cache recovered")
+	}
+	if len(*delays) != 2 {
+		t.Fatalf("expected 2 retries, got %d", len(*delays))
+	}
+	for i, d := range *delays {
+		if ceiling := cfg.BaseDelay << i; d < 0 || d > ceiling {
+			t.Fatalf("retry %d waited %s, want at most %s", i+1, d, ceiling)
+		}
+	}
+}
+
+func TestStoreWithRetry_DropsAfterMaxAttempts(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	cacheSvc.failStores.Store(100)
+
+	uc, delays := newRetryingUseCase(t, cacheSvc, StoreRetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	uc.storeLayerWithRetry("", 5, 10, 12, []byte("tile"), tileOrigin{})
+
+	if _, ok := cacheSvc.get(5, 10, 12); ok {
+		t.Fatal("tile should have been dropped")
+	}
+	if len(*delays) != 2 {
+		t.Fatalf("expected 2 retries before dropping, got %d", len(*delays))
+	}
+	if remaining := cacheSvc.failStores.Load(); remaining != 97 {
+		t.Fatalf("expected 3 store attempts, got %d", 100-remaining)
+	}
+}
+
+func TestWaitForStores_WaitsForRetries(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	cacheSvc.failStores.Store(2)
+	upstream := newFakeUpstream(t, []byte("tile"))
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+		StoreRetry:      StoreRetryConfig{MaxAttempts: 5, BaseDelay: 20 * time.Millisecond},
+	})
+
+	if _, err := uc.GetTile(context.Background(), 5, 10, 12); err != nil {
+		t.Fatalf("GetTile failed: %v", err)
+	}
+	uc.WaitForStores()
+
+	if _, ok := cacheSvc.get(5, 10, 12); !ok {
+		t.Fatal("expected the store to have finished its retries")
+	}
+}
+
+func TestStoreWithRetry_DelaysAreJittered(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	cacheSvc.failStores.Store(1000)
+
+	cfg := StoreRetryConfig{MaxAttempts: 2, BaseDelay: time.Second, MaxDelay: time.Second}
+	uc, delays := newRetryingUseCase(t, cacheSvc, cfg)
+
+	// Simulate a burst of stores failing together
+	for i := 0; i < 20; i++ {
+		uc.storeLayerWithRetry("", 5, i, 12, []byte("tile"), tileOrigin{})
+	}
+
+	distinct := make(map[time.Duration]bool)
+	for _, d := range *delays {
+		if d > cfg.MaxDelay {
+			t.Fatalf("delay %s exceeds max delay %s", d, cfg.MaxDelay)
+		}
+		distinct[d] = true
+	}
+	if len(distinct) < 2 {
+		t.Fatalf("expected jittered delays, got %v", *delays)
+	}
+}
+
+func TestGetTile_SampledVerificationCountsMismatch(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("upstream"))
+	cacheSvc.put(5, 10, 12, fakeTile{data: []byte("corrupted")})
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:     cacheSvc.server.URL,
+		UpstreamTileURL:  upstream.server.URL,
+		VerifySampleRate: 1,
+	})
+
+	before := testutil.ToFloat64(metrics.TilesCacheMismatch)
+
+	data, err := uc.GetTile(context.Background(), 5, 10, 12)
+	if err != nil {
+		t.Fatalf("GetTile failed: %v", err)
+	}
+	if string(data) != "corrupted" {
+		t.Fatalf("verification must not change the served tile, got %q", data)
+	}
+
+	// Verification runs in the background, tracked like a store
+	uc.WaitForStores()
+	if got := testutil.ToFloat64(metrics.TilesCacheMismatch); got != before+1 {
+		t.Fatalf("mismatch was not counted, got %v want %v", got, before+1)
+	}
+	if got := upstream.requests.Load(); got != 1 {
+		t.Fatalf("expected 1 verification request, got %d", got)
+	}
+}
+
+func TestGetTile_ResponseBudgetServesStaleTile(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("fresh"))
+	upstream.block = make(chan struct{})
+	t.Cleanup(func() { close(upstream.block) })
+
+	longAgo := time.Now().Add(-365 * 24 * time.Hour)
+	cacheSvc.put(5, 10, 12, fakeTile{data: []byte("stale"), storedAt: &longAgo})
+
+	const budget = 100 * time.Millisecond
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+		MaxServedAge:    time.Hour,
+		ResponseBudget:  budget,
+	})
+
+	start := time.Now()
+	data, err := uc.GetTile(context.Background(), 5, 10, 12)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("GetTile failed: %v", err)
+	}
+	if string(data) != "stale" {
+		t.Fatalf("expected stale tile, got %q", data)
+	}
+	if elapsed < budget || elapsed > 2*time.Second {
+		t.Fatalf("returned after %s, want shortly after the %s budget", elapsed, budget)
+	}
+
+	if _, err := uc.GetTile(context.Background(), 5, 11, 12); !errors.Is(err, ErrResponseBudgetExceeded) {
+		t.Fatalf("expected ErrResponseBudgetExceeded without a stale tile, got %v", err)
+	}
+}
+
+func histogramSample(t *testing.T, h prometheus.Histogram) (uint64, time.Duration) {
+	t.Helper()
+
+	var m dto.Metric
+	if err := h.Write(&m); err != nil {
+		t.Fatalf("failed to read histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount(), time.Duration(m.GetHistogram().GetSampleSum() * float64(time.Second))
+}
+
+func TestFetchUpstream_RecordsTimeToFirstByte(t *testing.T) {
+	const bodyDelay = 200 * time.Millisecond
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(bodyDelay)
+		w.Write([]byte("tile"))
+	}))
+	defer upstream.Close()
+
+	uc := newTestUseCase(t, TileUseCaseConfig{UpstreamTileURL: upstream.URL})
+	ttfbMetric := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "ttfb"})
+	latencyMetric := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency"})
+	uc.upstreamTTFB = ttfbMetric
+	uc.upstreamLatency = latencyMetric
+
+	if _, _, err := uc.fetchUpstream(context.Background(), DefaultProvider, upstream.URL+"/1/0/0.png"); err != nil {
+		t.Fatalf("fetchUpstream failed: %v", err)
+	}
+
+	count, ttfb := histogramSample(t, ttfbMetric)
+	if count != 1 {
+		t.Fatalf("expected one TTFB observation, got %d", count)
+	}
+	count, latency := histogramSample(t, latencyMetric)
+	if count != 1 {
+		t.Fatalf("expected one latency observation, got %d", count)
+	}
+
+	if latency < bodyDelay {
+		t.Fatalf("full fetch took %s, expected it to include the %s body delay", latency, bodyDelay)
+	}
+	if ttfb >= latency-bodyDelay/2 {
+		t.Fatalf("TTFB %s should be well below the full fetch time %s", ttfb, latency)
+	}
+}
+
+// newStallingUpstream sends the first half of body, then waits for release
+// before sending the rest. sent is closed once the first half is out.
+func newStallingUpstream(t *testing.T, body []byte) (url string, sent, release chan struct{}) {
+	t.Helper()
+
+	sent = make(chan struct{})
+	release = make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		w.Write(body[:len(body)/2])
+		w.(http.Flusher).Flush()
+		close(sent)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Write(body[len(body)/2:])
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, sent, release
+}
+
+func TestGetTile_ClientDisconnectAfterFetchStillCaches(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("tile"))
+	cacheSvc.failStores.Store(1)
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+		StoreRetry:      StoreRetryConfig{MaxAttempts: 3, BaseDelay: 50 * time.Millisecond},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := uc.GetTile(ctx, 5, 10, 12); err != nil {
+		t.Fatalf("GetTile failed: %v", err)
+	}
+	// The client goes away while the store is still being retried
+	cancel()
+
+	cacheSvc.waitStored(t)
+	if tile, _ := cacheSvc.get(5, 10, 12); string(tile.data) != "tile" {
+		t.Fatalf("expected fully fetched tile to be cached, got %q", tile.data)
+	}
+}
+
+func TestGetTile_ClientDisconnectMidFetchDiscardsTile(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstreamURL, sent, release := newStallingUpstream(t, []byte("partial tile"))
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstreamURL,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-sent
+		cancel()
+		close(release)
+	}()
+
+	if _, err := uc.GetTile(ctx, 5, 10, 12); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	uc.WaitForStores()
+	select {
+	case key := <-cacheSvc.stored:
+		t.Fatalf("partially fetched tile %s was cached", key)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestGetTile_ClientDisconnectGraceLetsFetchFinish(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstreamURL, sent, release := newStallingUpstream(t, []byte("late tile"))
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:          cacheSvc.server.URL,
+		UpstreamTileURL:       upstreamURL,
+		ClientDisconnectGrace: 5 * time.Second,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-sent
+		cancel()
+	}()
+
+	if _, err := uc.GetTile(ctx, 5, 10, 12); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	close(release)
+
+	cacheSvc.waitStored(t)
+	if tile, _ := cacheSvc.get(5, 10, 12); string(tile.data) != "late tile" {
+		t.Fatalf("expected tile finished within the grace to be cached, got %q", tile.data)
+	}
+}
+
+func TestGetTile_SizeBounds(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		reason string
+	}{
+		{name: "under min", body: "tiny", reason: "too_small"},
+		{name: "over max", body: "much too large tile", reason: "too_large"},
+		{name: "in range", body: "just right"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheSvc := newFakeCacheService(t)
+			upstream := newFakeUpstream(t, []byte(tt.body))
+
+			uc := newTestUseCase(t, TileUseCaseConfig{
+				CacheBaseURL:    cacheSvc.server.URL,
+				UpstreamTileURL: upstream.server.URL,
+				MinTileBytes:    8,
+				MaxTileBytes:    16,
+			})
+
+			before := map[string]float64{
+				"too_small": testutil.ToFloat64(metrics.TilesSizeRejected.WithLabelValues("too_small")),
+				"too_large": testutil.ToFloat64(metrics.TilesSizeRejected.WithLabelValues("too_large")),
+			}
+
+			data, err := uc.GetTile(context.Background(), 5, 10, 12)
+			if err != nil {
+				t.Fatalf("GetTile failed: %v", err)
+			}
+			if string(data) != tt.body {
+				t.Fatalf("expected the tile to be served anyway, got %q", data)
+			}
+			uc.WaitForStores()
+
+			_, cached := cacheSvc.get(5, 10, 12)
+			if cached != (tt.reason == "") {
+				t.Fatalf("cached = %v, want %v", cached, tt.reason == "")
+			}
+			for reason, count := range before {
+				want := count
+				if reason == tt.reason {
+					want++
+				}
+				if got := testutil.ToFloat64(metrics.TilesSizeRejected.WithLabelValues(reason)); got != want {
+					t.Fatalf("%s rejections = %v, want %v", reason, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetTile_CacheOnSecondMiss(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("tile"))
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+		SecondMiss:      SecondMissConfig{Window: time.Hour, Capacity: 10},
+	})
+	now := time.Now()
+	uc.now = func() time.Time { return now }
+
+	get := func(z, x, y int) {
+		t.Helper()
+		if _, err := uc.GetTile(context.Background(), z, x, y); err != nil {
+			t.Fatalf("GetTile failed: %v", err)
+		}
+		uc.WaitForStores()
+	}
+
+	get(5, 10, 12)
+	if _, cached := cacheSvc.get(5, 10, 12); cached {
+		t.Fatal("expected a tile requested once not to be cached")
+	}
+
+	now = now.Add(30 * time.Minute)
+	get(5, 10, 12)
+	if _, cached := cacheSvc.get(5, 10, 12); !cached {
+		t.Fatal("expected a tile requested twice within the window to be cached")
+	}
+
+	// A second miss after the window counts as a first miss again
+	get(6, 20, 24)
+	now = now.Add(2 * time.Hour)
+	get(6, 20, 24)
+	if _, cached := cacheSvc.get(6, 20, 24); cached {
+		t.Fatal("expected a tile requested twice outside the window not to be cached")
+	}
+	get(6, 20, 24)
+	if _, cached := cacheSvc.get(6, 20, 24); !cached {
+		t.Fatal("expected the tile to be cached after a repeated miss in the new window")
+	}
+}
+
+func TestGetTile_MaxBufferBytes(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, bytes.Repeat([]byte("x"), 64))
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+		MaxBufferBytes:  32,
+	})
+	before := testutil.ToFloat64(metrics.TilesUpstreamBodyTooLarge)
+
+	_, err := uc.GetTile(context.Background(), 5, 10, 12)
+	if !errors.Is(err, ErrUpstreamBodyTooLarge) {
+		t.Fatalf("expected ErrUpstreamBodyTooLarge, got %v", err)
+	}
+	uc.WaitForStores()
+	if _, cached := cacheSvc.get(5, 10, 12); cached {
+		t.Fatal("expected the oversized response not to be cached")
+	}
+	if got := testutil.ToFloat64(metrics.TilesUpstreamBodyTooLarge); got != before+1 {
+		t.Fatalf("body too large count = %v, want %v", got, before+1)
+	}
+
+	upstream.body = bytes.Repeat([]byte("x"), 32)
+	data, err := uc.GetTile(context.Background(), 5, 10, 12)
+	if err != nil {
+		t.Fatalf("GetTile failed: %v", err)
+	}
+	if len(data) != 32 {
+		t.Fatalf("expected a body at the limit to be served, got %d bytes", len(data))
+	}
+}
+
+func TestGetTile_CachesNotFound(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	var requests atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer upstream.Close()
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.URL,
+		CacheNotFound:   true,
+	})
+
+	if _, err := uc.GetTile(context.Background(), 19, 1, 1); !errors.Is(err, ErrTileNotFound) {
+		t.Fatalf("expected ErrTileNotFound, got %v", err)
+	}
+	if key := cacheSvc.waitStored(t); key != "19/1/1" {
+		t.Fatalf("expected the missing tile to be recorded, got %s", key)
+	}
+	if tile, _ := cacheSvc.get(19, 1, 1); !tile.notFound {
+		t.Fatal("expected the cache entry to be marked as not found")
+	}
+
+	if _, err := uc.GetTile(context.Background(), 19, 1, 1); !errors.Is(err, ErrTileNotFound) {
+		t.Fatalf("expected ErrTileNotFound from the cache, got %v", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("expected upstream to be asked once, got %d", got)
+	}
+}
+
+func TestGetTile_StoresUpstreamValidators(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	upstream := newFakeUpstream(t, []byte("tile"))
+	upstream.header = http.Header{
+		"Etag":          {`"v1"`},
+		"Last-Modified": {"Mon, 02 Jan 2006 15:04:05 GMT"},
+	}
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.server.URL,
+	})
+
+	if _, err := uc.GetTile(context.Background(), 5, 10, 12); err != nil {
+		t.Fatalf("GetTile failed: %v", err)
+	}
+	cacheSvc.waitStored(t)
+
+	tile, _ := cacheSvc.get(5, 10, 12)
+	if tile.etag != `"v1"` || tile.lastModified != "Mon, 02 Jan 2006 15:04:05 GMT" {
+		t.Fatalf("expected upstream validators to be stored, got etag %q last modified %q", tile.etag, tile.lastModified)
+	}
+}
+
+func TestGetTile_StoresSource(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		cacheSvc := newFakeCacheService(t)
+		upstream := newFakeUpstream(t, []byte("tile"))
+
+		uc := newTestUseCase(t, TileUseCaseConfig{
+			CacheBaseURL:    cacheSvc.server.URL,
+			UpstreamTileURL: upstream.server.URL,
+			StoreSource:     enabled,
+		})
+
+		if _, err := uc.GetTile(context.Background(), 5, 10, 12); err != nil {
+			t.Fatalf("GetTile failed: %v", err)
+		}
+		cacheSvc.waitStored(t)
+
+		want := ""
+		if enabled {
+			want = upstream.server.URL + "/5/10/12.png"
+		}
+		if tile, _ := cacheSvc.get(5, 10, 12); tile.source != want {
+			t.Fatalf("enabled=%v: expected source %q, got %q", enabled, want, tile.source)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+)
+
+var ErrInvalidEncoder = errors.New("invalid image encoder")
+
+// encodeTimeout bounds a single encoding, including waiting for a slot
+const encodeTimeout = 10 * time.Second
+
+// Format is an image format tiles can be transcoded to for clients that
+// accept it.
+type Format string
+
+const (
+	FormatAVIF Format = "avif"
+	FormatWebP Format = "webp"
+)
+
+// formatPreference lists the formats from the most compact one.
+var formatPreference = []Format{FormatAVIF, FormatWebP}
+
+// ContentType is the media type of the format, as listed in Accept headers.
+func (f Format) ContentType() string {
+	return "image/" + string(f)
+}
+
+// ImageEncoder encodes a PNG tile in another format.
+type ImageEncoder interface {
+	Encode(ctx context.Context, png []byte) ([]byte, error)
+}
+
+// CommandEncoder runs an external encoder, such as cwebp or avifenc, since
+// Go has neither encoder. Args are the command line with {in} replaced by
+// the path of the PNG and {out} by the path the encoder writes to.
+type CommandEncoder struct {
+	Args []string
+}
+
+func (e CommandEncoder) Encode(ctx context.Context, png []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "tile-encode-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := filepath.Join(dir, "tile.png"), filepath.Join(dir, "tile.out")
+	if err := os.WriteFile(in, png, 0o600); err != nil {
+		return nil, err
+	}
+	paths := strings.NewReplacer("{in}", in, "{out}", out)
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = paths.Replace(arg)
+	}
+
+	if output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w: %s", args[0], err, bytes.TrimSpace(output))
+	}
+	return os.ReadFile(out)
+}
+
+// ParseEncoders parses encoder command lines keyed by format, "webp" or
+// "avif". Each is split on spaces and must place {in} and {out}. The
+// commands must be installed.
+func ParseEncoders(commands map[string]string) (map[Format]ImageEncoder, error) {
+	encoders := make(map[Format]ImageEncoder, len(commands))
+	for name, command := range commands {
+		format := Format(name)
+		if !slices.Contains(formatPreference, format) {
+			return nil, fmt.Errorf("%w: unknown format %s, expected webp or avif", ErrInvalidEncoder, name)
+		}
+		args := strings.Fields(command)
+		if len(args) == 0 || !strings.Contains(command, "{in}") || !strings.Contains(command, "{out}") {
+			return nil, fmt.Errorf("%w for %s: expected a command line with {in} and {out}", ErrInvalidEncoder, name)
+		}
+		if _, err := exec.LookPath(args[0]); err != nil {
+			return nil, fmt.Errorf("%w for %s: %w", ErrInvalidEncoder, name, err)
+		}
+		encoders[format] = CommandEncoder{Args: args}
+	}
+	return encoders, nil
+}
+
+// Formats returns the formats tiles can be transcoded to, the most compact
+// first.
+func (uc *TileUseCase) Formats() []Format {
+	var formats []Format
+	for _, format := range formatPreference {
+		if _, ok := uc.encoders[format]; ok {
+			formats = append(formats, format)
+		}
+	}
+	return formats
+}
+
+// Transcode encodes a PNG tile in format and returns the data with its
+// content type. Tiles that are not PNGs, fail to encode or would not shrink
+// are returned as they are. Encodings are kept in memory along with the
+// reduced qualities, keyed by format.
+func (uc *TileUseCase) Transcode(z, x, y int, format Format, original []byte) ([]byte, string) {
+	encoder, ok := uc.encoders[format]
+	if !ok || tileContentType(original) != expectedContentType {
+		return original, tileContentType(original)
+	}
+
+	key := variantKey{z: z, x: x, y: y, format: format, checksum: crc32.ChecksumIEEE(original)}
+	if v, ok := uc.variants.get(key); ok {
+		metrics.TilesVariantCacheHits.Inc()
+		return v.data, v.contentType
+	}
+
+	data, err := uc.encode(encoder, original)
+	if err != nil {
+		uc.logger.Warn("failed to transcode tile, serving original", "z", z, "x", x, "y", y, "format", format, "error", err)
+		metrics.TilesTranscoded.WithLabelValues(string(format), "failed").Inc()
+		return original, expectedContentType
+	}
+	v := variant{data: data, contentType: format.ContentType()}
+	if len(data) >= len(original) {
+		v = variant{data: original, contentType: expectedContentType}
+		metrics.TilesTranscoded.WithLabelValues(string(format), "larger").Inc()
+	} else {
+		metrics.TilesTranscoded.WithLabelValues(string(format), "encoded").Inc()
+	}
+	uc.variants.add(key, v)
+	return v.data, v.contentType
+}
+
+// encode runs the encoder once a slot is free, so at most one encoding per
+// CPU runs at a time.
+func (uc *TileUseCase) encode(encoder ImageEncoder, png []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), encodeTimeout)
+	defer cancel()
+
+	select {
+	case uc.encodeSlots <- struct{}{}:
+		defer func() { <-uc.encodeSlots }()
+	case <-ctx.Done():
+		return nil, fmt.Errorf("no encoder slot: %w", ctx.Err())
+	}
+	return encoder.Encode(ctx, png)
+}
+
+// newEncodeSlots bounds concurrent encodings to the CPUs available.
+func newEncodeSlots() chan struct{} {
+	return make(chan struct{}, runtime.GOMAXPROCS(0))
+}
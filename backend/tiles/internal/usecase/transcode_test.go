@@ -0,0 +1,108 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeEncoder encodes every tile as the same bytes and counts encodings.
+type fakeEncoder struct {
+	data  []byte
+	err   error
+	calls atomic.Int64
+}
+
+func (e *fakeEncoder) Encode(ctx context.Context, png []byte) ([]byte, error) {
+	e.calls.Add(1)
+	return e.data, e.err
+}
+
+func TestTranscode_EncodesAndCachesPerFormat(t *testing.T) {
+	webp := &fakeEncoder{data: []byte("RIFF-webp")}
+	avif := &fakeEncoder{data: []byte("avif")}
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		VariantCacheSize: 10,
+		Encoders:         map[Format]ImageEncoder{FormatWebP: webp, FormatAVIF: avif},
+	})
+	original := testTilePNG(t)
+
+	if got := uc.Formats(); len(got) != 2 || got[0] != FormatAVIF || got[1] != FormatWebP {
+		t.Fatalf("expected avif before webp, got %v", got)
+	}
+
+	for range 2 {
+		data, contentType := uc.Transcode(5, 10, 12, FormatWebP, original)
+		if string(data) != "RIFF-webp" || contentType != "image/webp" {
+			t.Fatalf("unexpected webp tile %q, %s", data, contentType)
+		}
+	}
+	data, contentType := uc.Transcode(5, 10, 12, FormatAVIF, original)
+	if string(data) != "avif" || contentType != "image/avif" {
+		t.Fatalf("unexpected avif tile %q, %s", data, contentType)
+	}
+	if webp.calls.Load() != 1 || avif.calls.Load() != 1 {
+		t.Fatalf("expected one encoding per format, got webp %d, avif %d", webp.calls.Load(), avif.calls.Load())
+	}
+
+	// A refreshed tile is encoded again
+	refreshed := append(bytes.Clone(original[:len(original)-1]), 0)
+	uc.Transcode(5, 10, 12, FormatWebP, refreshed)
+	if webp.calls.Load() != 2 {
+		t.Fatalf("expected the changed tile to be encoded again, got %d encodings", webp.calls.Load())
+	}
+}
+
+func TestTranscode_ServesOriginalWhenEncodingDoesNotHelp(t *testing.T) {
+	original := testTilePNG(t)
+	tests := []struct {
+		name     string
+		encoder  *fakeEncoder
+		original []byte
+	}{
+		{"encoder fails", &fakeEncoder{err: errors.New("boom")}, original},
+		{"encoding is larger", &fakeEncoder{data: bytes.Repeat([]byte{1}, len(original)+1)}, original},
+		{"not a png", &fakeEncoder{data: []byte("webp")}, []byte("\xff\xd8\xff\xe0jpeg tile")},
+	}
+	for _, tt := range tests {
+		uc := newTestUseCase(t, TileUseCaseConfig{Encoders: map[Format]ImageEncoder{FormatWebP: tt.encoder}})
+		if data, _ := uc.Transcode(5, 10, 12, FormatWebP, tt.original); !bytes.Equal(data, tt.original) {
+			t.Errorf("%s: expected the original tile", tt.name)
+		}
+	}
+}
+
+func TestCommandEncoder(t *testing.T) {
+	encoder := CommandEncoder{Args: []string{"sh", "-c", `head -c 4 "$0" > "$1"`, "{in}", "{out}"}}
+	data, err := encoder.Encode(context.Background(), []byte("tile data"))
+	if err != nil || string(data) != "tile" {
+		t.Fatalf("Encode returned %q, %v", data, err)
+	}
+
+	failing := CommandEncoder{Args: []string{"sh", "-c", "echo bad input >&2; exit 1"}}
+	if _, err := failing.Encode(context.Background(), []byte("tile")); err == nil {
+		t.Fatal("expected the failed command to be reported")
+	}
+}
+
+func TestParseEncoders(t *testing.T) {
+	encoders, err := ParseEncoders(map[string]string{"webp": "cp {in} {out}"})
+	if err != nil {
+		t.Fatalf("ParseEncoders failed: %v", err)
+	}
+	if _, ok := encoders[FormatWebP].(CommandEncoder); !ok {
+		t.Fatalf("unexpected encoders %v", encoders)
+	}
+
+	for _, commands := range []map[string]string{
+		{"jxl": "cjxl {in} {out}"},
+		{"webp": "cwebp {in}"},
+		{"webp": "no-such-encoder-installed {in} {out}"},
+	} {
+		if _, err := ParseEncoders(commands); !errors.Is(err, ErrInvalidEncoder) {
+			t.Errorf("%v: expected ErrInvalidEncoder, got %v", commands, err)
+		}
+	}
+}
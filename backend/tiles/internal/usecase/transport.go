@@ -0,0 +1,103 @@
+package usecase
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// Upstream protocols. HTTP/2 is negotiated over TLS via ALPN and falls back
+// to HTTP/1.1 when the provider does not offer it, which is also what the
+// standard library does by default. HTTP/3 falls back to HTTP/2.
+const (
+	ProtocolHTTP1 = "http1"
+	ProtocolHTTP2 = "http2"
+	ProtocolHTTP3 = "http3"
+)
+
+const (
+	// h3HandshakeTimeout keeps a provider that drops UDP from stalling
+	// requests before they fall back to TCP
+	h3HandshakeTimeout = 2 * time.Second
+	// h3RetryAfter is how long HTTP/3 is skipped after it failed
+	h3RetryAfter = 5 * time.Minute
+)
+
+// newUpstreamTransport returns a round tripper speaking the given protocol.
+// tlsConfig may be nil to use the system roots.
+func newUpstreamTransport(protocol string, tlsConfig *tls.Config, l logger.Logger) (http.RoundTripper, error) {
+	// The transports adjust ALPN settings on their TLS config, so they must
+	// not share it
+	tcp := http.DefaultTransport.(*http.Transport).Clone()
+	tcp.TLSClientConfig = tlsConfig.Clone()
+
+	switch protocol {
+	case ProtocolHTTP1:
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		tcp.Protocols = protocols
+		return tcp, nil
+	case "", ProtocolHTTP2:
+		return tcp, nil
+	case ProtocolHTTP3:
+		return &h3Fallback{
+			h3: &http3.Transport{
+				TLSClientConfig: tlsConfig.Clone(),
+				QUICConfig:      &quic.Config{HandshakeIdleTimeout: h3HandshakeTimeout},
+			},
+			fallback: tcp,
+			logger:   l,
+			now:      time.Now,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown upstream protocol %q", protocol)
+	}
+}
+
+// h3Fallback tries HTTP/3 first and repeats failed requests over TCP. After
+// a failure HTTP/3 is left alone for h3RetryAfter so that every request does
+// not wait for a QUIC handshake that will not complete.
+type h3Fallback struct {
+	h3       http.RoundTripper
+	fallback http.RoundTripper
+	logger   logger.Logger
+	now      func() time.Time
+
+	mu          sync.Mutex
+	brokenUntil time.Time
+}
+
+func (t *h3Fallback) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	skip := t.now().Before(t.brokenUntil)
+	t.mu.Unlock()
+
+	// Only bodiless requests can be repeated safely
+	if skip || req.Body != nil && req.Body != http.NoBody {
+		return t.fallback.RoundTrip(req)
+	}
+
+	resp, err := t.h3.RoundTrip(req)
+	if err == nil {
+		return resp, nil
+	}
+	// A request the caller gave up on says nothing about HTTP/3 and cannot
+	// succeed over TCP either
+	if req.Context().Err() != nil {
+		return nil, err
+	}
+
+	t.logger.Warn("http/3 upstream request failed, falling back to tcp",
+		"host", req.URL.Host, "retry_after", h3RetryAfter, "error", err)
+	t.mu.Lock()
+	t.brokenUntil = t.now().Add(h3RetryAfter)
+	t.mu.Unlock()
+
+	return t.fallback.RoundTrip(req)
+}
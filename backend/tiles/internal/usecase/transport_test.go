@@ -0,0 +1,146 @@
+package usecase
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// newTLSUpstream starts an HTTPS server offering HTTP/2 and returns it with a
+// client TLS config trusting it.
+func newTLSUpstream(t *testing.T) (*httptest.Server, *tls.Config) {
+	t.Helper()
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tile"))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	return srv, &tls.Config{RootCAs: roots}
+}
+
+func protoFor(t *testing.T, protocol string, tlsConfig *tls.Config, url string) string {
+	t.Helper()
+
+	transport, err := newUpstreamTransport(protocol, tlsConfig, testLogger())
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+	client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	return resp.Proto
+}
+
+func TestUpstreamTransport_NegotiatesConfiguredProtocol(t *testing.T) {
+	srv, tlsConfig := newTLSUpstream(t)
+
+	if got := protoFor(t, ProtocolHTTP2, tlsConfig, srv.URL); got != "HTTP/2.0" {
+		t.Fatalf("http2: negotiated %s", got)
+	}
+	if got := protoFor(t, ProtocolHTTP1, tlsConfig, srv.URL); got != "HTTP/1.1" {
+		t.Fatalf("http1: negotiated %s", got)
+	}
+}
+
+func TestUpstreamTransport_HTTP3(t *testing.T) {
+	srv, tlsConfig := newTLSUpstream(t)
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("udp unavailable: %v", err)
+	}
+	h3 := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: srv.TLS.Certificates}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("tile"))
+		}),
+	}
+	go h3.Serve(udp)
+	t.Cleanup(func() { h3.Close() })
+
+	tlsConfig.ServerName = "example.com"
+	if got := protoFor(t, ProtocolHTTP3, tlsConfig, "https://"+udp.LocalAddr().String()); got != "HTTP/3.0" {
+		t.Fatalf("http3: negotiated %s", got)
+	}
+}
+
+type failingRoundTripper struct{ calls int }
+
+func (f *failingRoundTripper) RoundTrip(*http.Request) (*http.Response, error) {
+	f.calls++
+	return nil, errors.New("quic handshake timed out")
+}
+
+func TestUpstreamTransport_HTTP3FallsBackToTCP(t *testing.T) {
+	srv, tlsConfig := newTLSUpstream(t)
+
+	transport, err := newUpstreamTransport(ProtocolHTTP3, tlsConfig, testLogger())
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+	fb := transport.(*h3Fallback)
+	failing := &failingRoundTripper{}
+	fb.h3 = failing
+	client := &http.Client{Transport: fb}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("request %d failed: %v", i+1, err)
+		}
+		resp.Body.Close()
+		if resp.Proto != "HTTP/2.0" {
+			t.Fatalf("request %d: expected fallback to HTTP/2, got %s", i+1, resp.Proto)
+		}
+	}
+
+	// The second request must not wait for HTTP/3 again
+	if failing.calls != 1 {
+		t.Fatalf("expected HTTP/3 to be tried once, got %d", failing.calls)
+	}
+}
+
+func TestUpstreamTransport_HTTP3KeptAfterCanceledRequest(t *testing.T) {
+	_, tlsConfig := newTLSUpstream(t)
+
+	transport, err := newUpstreamTransport(ProtocolHTTP3, tlsConfig, testLogger())
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+	fb := transport.(*h3Fallback)
+	fb.h3 = &failingRoundTripper{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://tile.example.com/1/2/3.png", nil)
+	if _, err := fb.RoundTrip(req); err == nil {
+		t.Fatal("expected the canceled request to fail")
+	}
+
+	if !fb.brokenUntil.IsZero() {
+		t.Fatalf("expected HTTP/3 kept after a canceled request, broken until %v", fb.brokenUntil)
+	}
+}
+
+func TestUpstreamTransport_UnknownProtocol(t *testing.T) {
+	if _, err := newUpstreamTransport("spdy", nil, testLogger()); err == nil {
+		t.Fatal("expected an error for an unknown protocol")
+	}
+}
@@ -0,0 +1,135 @@
+package usecase
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultFailoverCooldown is how long a failed provider is skipped when no
+// cooldown is configured.
+const defaultFailoverCooldown = 30 * time.Second
+
+// WeightedUpstreamConfig spreads upstream fetches over named providers in
+// proportion to their weights, e.g. most traffic to OpenStreetMap and a
+// fraction to a paid provider with a small quota.
+type WeightedUpstreamConfig struct {
+	// Weights maps provider names from Providers to their share of traffic.
+	// Empty fetches every tile from the upstream tile server.
+	Weights map[string]int
+	// FailoverCooldown is how long a provider is skipped after a failed
+	// fetch. The remaining providers keep their relative weights.
+	FailoverCooldown time.Duration
+}
+
+type weightedUpstream struct {
+	name      string
+	weight    int
+	downUntil time.Time
+}
+
+// upstreamPool picks providers by weight among the healthy ones.
+type upstreamPool struct {
+	mu        sync.Mutex
+	upstreams []*weightedUpstream
+	cooldown  time.Duration
+	random    func() float64
+}
+
+// newUpstreamPool resolves the weighted provider names against providers.
+// It returns nil when no weights are configured.
+func newUpstreamPool(cfg WeightedUpstreamConfig, providers map[string]string) (*upstreamPool, error) {
+	if len(cfg.Weights) == 0 {
+		return nil, nil
+	}
+
+	pool := &upstreamPool{
+		cooldown: cfg.FailoverCooldown,
+		random:   rand.Float64,
+	}
+	if pool.cooldown <= 0 {
+		pool.cooldown = defaultFailoverCooldown
+	}
+	for name, weight := range cfg.Weights {
+		if _, ok := providers[name]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+		}
+		if weight < 0 {
+			return nil, fmt.Errorf("provider %s: weight must not be negative", name)
+		}
+		if weight == 0 {
+			continue
+		}
+		pool.upstreams = append(pool.upstreams, &weightedUpstream{name: name, weight: weight})
+	}
+	if len(pool.upstreams) == 0 {
+		return nil, fmt.Errorf("at least one provider needs a positive weight")
+	}
+	// Map iteration order is random, keep picks reproducible
+	sort.Slice(pool.upstreams, func(i, j int) bool { return pool.upstreams[i].name < pool.upstreams[j].name })
+
+	return pool, nil
+}
+
+// names lists the weighted providers. They do not change after construction.
+func (p *upstreamPool) names() []string {
+	names := make([]string, len(p.upstreams))
+	for i, u := range p.upstreams {
+		names[i] = u.name
+	}
+	return names
+}
+
+// pick chooses a provider not in tried by weight, preferring healthy ones.
+// When every remaining provider is down they are tried anyway rather than
+// failing the request. It reports false once all providers were tried.
+func (p *upstreamPool) pick(tried map[string]bool, now time.Time) (name string, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var healthy, down []*weightedUpstream
+	for _, u := range p.upstreams {
+		switch {
+		case tried[u.name]:
+		case now.Before(u.downUntil):
+			down = append(down, u)
+		default:
+			healthy = append(healthy, u)
+		}
+	}
+	candidates := healthy
+	if len(candidates) == 0 {
+		candidates = down
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	total := 0
+	for _, u := range candidates {
+		total += u.weight
+	}
+	r := p.random() * float64(total)
+	for _, u := range candidates {
+		r -= float64(u.weight)
+		if r < 0 {
+			return u.name, true
+		}
+	}
+	last := candidates[len(candidates)-1]
+	return last.name, true
+}
+
+// markDown skips the provider until the cooldown has passed.
+func (p *upstreamPool) markDown(name string, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, u := range p.upstreams {
+		if u.name == name {
+			u.downUntil = now.Add(p.cooldown)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetTile_WeightedProviders(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	osm := newFakeUpstream(t, []byte("osm"))
+	paid := newFakeUpstream(t, []byte("paid"))
+	// Keep the fake cache service small, only the selection matters here
+	osm.header = http.Header{"Cache-Control": {"no-store"}}
+	paid.header = http.Header{"Cache-Control": {"no-store"}}
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL: cacheSvc.server.URL,
+		Providers: map[string]string{
+			"osm":  osm.server.URL,
+			"paid": paid.server.URL,
+		},
+		WeightedUpstream: WeightedUpstreamConfig{
+			Weights: map[string]int{"osm": 3, "paid": 1},
+		},
+	})
+
+	const requests = 2000
+	for i := 0; i < requests; i++ {
+		if _, err := uc.GetTile(context.Background(), 12, i, 0); err != nil {
+			t.Fatalf("GetTile failed: %v", err)
+		}
+	}
+	uc.WaitForStores()
+
+	if got := osm.requests.Load() + paid.requests.Load(); got != requests {
+		t.Fatalf("expected %d upstream requests, got %d", requests, got)
+	}
+	share := float64(osm.requests.Load()) / requests
+	if math.Abs(share-0.75) > 0.05 {
+		t.Fatalf("osm served %.3f of requests, want about 0.75", share)
+	}
+}
+
+func TestGetTile_WeightedProvidersFailOver(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	healthy := newFakeUpstream(t, []byte("tile"))
+	var failing atomic.Int64
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failing.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(broken.Close)
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL: cacheSvc.server.URL,
+		Providers: map[string]string{
+			"broken":  broken.URL,
+			"healthy": healthy.server.URL,
+		},
+		WeightedUpstream: WeightedUpstreamConfig{
+			Weights:          map[string]int{"broken": 1000, "healthy": 1},
+			FailoverCooldown: time.Minute,
+		},
+	})
+
+	for i := 0; i < 10; i++ {
+		data, err := uc.GetTile(context.Background(), 12, i, 0)
+		if err != nil {
+			t.Fatalf("GetTile failed: %v", err)
+		}
+		if string(data) != "tile" {
+			t.Fatalf("expected the healthy provider's tile, got %q", data)
+		}
+	}
+	uc.WaitForStores()
+
+	// The broken provider is skipped once it failed
+	if got := failing.Load(); got != 1 {
+		t.Fatalf("expected 1 request to the broken provider, got %d", got)
+	}
+}
+
+func TestNewUpstreamPool_UnknownProvider(t *testing.T) {
+	_, err := newUpstreamPool(WeightedUpstreamConfig{Weights: map[string]int{"paid": 1}}, map[string]string{"osm": "http://osm"})
+	if !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("expected ErrUnknownProvider, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrInvalidURLTemplate is returned for upstream URL templates that cannot
+// be expanded.
+var ErrInvalidURLTemplate = errors.New("invalid upstream url template")
+
+// retinaSuffix is what {r} expands to for high resolution tiles.
+const retinaSuffix = "@2x"
+
+// URLTemplate builds upstream tile URLs from a template in the usual tile
+// URL scheme: {z}, {x} and {y} are the tile coordinates, {s} a subdomain
+// and {r} "@2x" for high resolution tiles or nothing. Subdomains are used
+// in turn, spreading requests over them. A template without coordinates
+// is a base URL with tiles at {z}/{x}/{y}.png under it.
+type URLTemplate struct {
+	template   string
+	subdomains []string
+	retina     bool
+	next       atomic.Uint64
+}
+
+// NewURLTemplate prepares template for expansion. It fails with
+// ErrInvalidURLTemplate when only some coordinates are placed or {s} is
+// used without subdomains.
+func NewURLTemplate(template string, subdomains []string, retina bool) (*URLTemplate, error) {
+	placed := 0
+	for _, placeholder := range []string{"{z}", "{x}", "{y}"} {
+		if strings.Contains(template, placeholder) {
+			placed++
+		}
+	}
+	switch placed {
+	case 0:
+		template = strings.TrimRight(template, "/") + "/{z}/{x}/{y}.png"
+	case 3:
+	default:
+		return nil, fmt.Errorf("%w: %s must place all of {z}, {x} and {y}", ErrInvalidURLTemplate, template)
+	}
+	if strings.Contains(template, "{s}") && len(subdomains) == 0 {
+		return nil, fmt.Errorf("%w: %s uses {s} without subdomains", ErrInvalidURLTemplate, template)
+	}
+	return &URLTemplate{template: template, subdomains: subdomains, retina: retina}, nil
+}
+
+// URL expands the template for a tile, with the next subdomain if it has
+// {s}.
+func (t *URLTemplate) URL(z, x, y int) string {
+	retina := ""
+	if t.retina {
+		retina = retinaSuffix
+	}
+	replacements := []string{
+		"{z}", strconv.Itoa(z),
+		"{x}", strconv.Itoa(x),
+		"{y}", strconv.Itoa(y),
+		"{r}", retina,
+	}
+	if strings.Contains(t.template, "{s}") {
+		i := (t.next.Add(1) - 1) % uint64(len(t.subdomains))
+		replacements = append(replacements, "{s}", t.subdomains[i])
+	}
+	return strings.NewReplacer(replacements...).Replace(t.template)
+}
+
+// String returns the template, a base URL expanded to the full template.
+func (t *URLTemplate) String() string {
+	return t.template
+}
+
+// newURLTemplates prepares the templates of named upstreams.
+func newURLTemplates(templates map[string]string, subdomains []string, retina bool) (map[string]*URLTemplate, error) {
+	prepared := make(map[string]*URLTemplate, len(templates))
+	for name, template := range templates {
+		t, err := NewURLTemplate(template, subdomains, retina)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		prepared[name] = t
+	}
+	return prepared, nil
+}
@@ -0,0 +1,84 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestURLTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		retina   bool
+		want     []string
+	}{
+		{"https://tile.example.org", false, []string{"https://tile.example.org/3/1/2.png"}},
+		{"https://tile.example.org/", false, []string{"https://tile.example.org/3/1/2.png"}},
+		{"https://tile.example.org/{z}/{y}/{x}.jpg", false, []string{"https://tile.example.org/3/2/1.jpg"}},
+		{"https://{s}.tile.example.org/{z}/{x}/{y}{r}.png", false, []string{
+			"https://a.tile.example.org/3/1/2.png",
+			"https://b.tile.example.org/3/1/2.png",
+			"https://c.tile.example.org/3/1/2.png",
+			"https://a.tile.example.org/3/1/2.png",
+		}},
+		{"https://tile.example.org/{z}/{x}/{y}{r}.png", true, []string{"https://tile.example.org/3/1/2@2x.png"}},
+	}
+	for _, tt := range tests {
+		template, err := NewURLTemplate(tt.template, []string{"a", "b", "c"}, tt.retina)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.template, err)
+		}
+		for i, want := range tt.want {
+			if got := template.URL(3, 1, 2); got != want {
+				t.Errorf("%s: expansion %d is %s, want %s", tt.template, i, got, want)
+			}
+		}
+	}
+
+	for _, invalid := range []string{
+		"https://tile.example.org/{z}/{x}.png",
+		"https://{s}.tile.example.org/{z}/{x}/{y}.png",
+	} {
+		if _, err := NewURLTemplate(invalid, nil, false); !errors.Is(err, ErrInvalidURLTemplate) {
+			t.Errorf("%s: expected ErrInvalidURLTemplate, got %v", invalid, err)
+		}
+	}
+}
+
+func TestGetTile_RotatesSubdomains(t *testing.T) {
+	cacheSvc := newFakeCacheService(t)
+	var (
+		mu    sync.Mutex
+		hosts []string
+	)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hosts = append(hosts, r.URL.Query().Get("s"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("tile"))
+	}))
+	defer upstream.Close()
+
+	uc := newTestUseCase(t, TileUseCaseConfig{
+		CacheBaseURL:    cacheSvc.server.URL,
+		UpstreamTileURL: upstream.URL + "/{z}/{x}/{y}.png?s={s}",
+		Subdomains:      []string{"a", "b"},
+	})
+	for y := range 3 {
+		if _, err := uc.GetTile(context.Background(), 5, 10, y); err != nil {
+			t.Fatalf("GetTile failed: %v", err)
+		}
+	}
+	uc.WaitForStores()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(hosts, ","); got != "a,b,a" {
+		t.Fatalf("upstream requests went to subdomains %s, want a,b,a", got)
+	}
+}
@@ -0,0 +1,172 @@
+package usecase
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"sync"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+)
+
+// ErrInvalidQuality is returned by ParseQuality for unknown quality names.
+var ErrInvalidQuality = errors.New("invalid quality, expected low or medium")
+
+// Quality selects a reduced encoding of a tile for bandwidth-constrained
+// clients.
+type Quality string
+
+const (
+	// QualityOriginal serves the tile as stored
+	QualityOriginal Quality = ""
+	// QualityMedium quantizes the tile to a 216-colour palette PNG
+	QualityMedium Quality = "medium"
+	// QualityLow re-encodes the tile as a low quality JPEG
+	QualityLow Quality = "low"
+)
+
+const lowQualityJPEG = 40
+
+// ParseQuality parses the q parameter of a tile request. Empty and
+// "original" select the original tile.
+func ParseQuality(s string) (Quality, error) {
+	switch s {
+	case "", "original":
+		return QualityOriginal, nil
+	case string(QualityMedium):
+		return QualityMedium, nil
+	case string(QualityLow):
+		return QualityLow, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidQuality, s)
+}
+
+// Reduce re-encodes a tile at the given quality and returns the data with
+// its content type, sniffed for original tiles since upstream may not serve
+// PNGs. Tiles that cannot be decoded, or would not shrink, are
+// returned as they are. Reduced tiles are kept in memory, keyed by tile,
+// quality and a checksum of the original so a refreshed tile is re-encoded.
+func (uc *TileUseCase) Reduce(z, x, y int, q Quality, original []byte) ([]byte, string) {
+	if q == QualityOriginal {
+		return original, tileContentType(original)
+	}
+
+	key := variantKey{z: z, x: x, y: y, quality: q, checksum: crc32.ChecksumIEEE(original)}
+	if v, ok := uc.variants.get(key); ok {
+		metrics.TilesVariantCacheHits.Inc()
+		return v.data, v.contentType
+	}
+
+	v, err := encodeVariant(q, original)
+	if err != nil {
+		uc.logger.Debug("failed to reduce tile, serving original", "z", z, "x", x, "y", y, "quality", q, "error", err)
+		return original, tileContentType(original)
+	}
+	if len(v.data) >= len(original) {
+		v = variant{data: original, contentType: tileContentType(original)}
+	}
+	uc.variants.add(key, v)
+	return v.data, v.contentType
+}
+
+func encodeVariant(q Quality, original []byte) (variant, error) {
+	img, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return variant{}, fmt.Errorf("failed to decode tile: %w", err)
+	}
+
+	var buf bytes.Buffer
+	switch q {
+	case QualityLow:
+		// JPEG has no alpha, so transparent areas are flattened onto white
+		flat := image.NewRGBA(img.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+		if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: lowQualityJPEG}); err != nil {
+			return variant{}, fmt.Errorf("failed to encode jpeg: %w", err)
+		}
+		return variant{data: buf.Bytes(), contentType: "image/jpeg"}, nil
+	case QualityMedium:
+		quantized := image.NewPaletted(img.Bounds(), palette.WebSafe)
+		draw.Draw(quantized, quantized.Bounds(), img, img.Bounds().Min, draw.Src)
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := encoder.Encode(&buf, quantized); err != nil {
+			return variant{}, fmt.Errorf("failed to encode png: %w", err)
+		}
+		return variant{data: buf.Bytes(), contentType: "image/png"}, nil
+	}
+	return variant{}, fmt.Errorf("%w: %q", ErrInvalidQuality, q)
+}
+
+type variantKey struct {
+	z, x, y  int
+	quality  Quality
+	format   Format
+	checksum uint32
+}
+
+type variant struct {
+	data        []byte
+	contentType string
+}
+
+// variantCache is an LRU of reduced tiles. A zero size disables it.
+type variantCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[variantKey]*list.Element
+}
+
+type variantEntry struct {
+	key   variantKey
+	value variant
+}
+
+func newVariantCache(size int) *variantCache {
+	return &variantCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[variantKey]*list.Element),
+	}
+}
+
+func (c *variantCache) get(key variantKey) (variant, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return variant{}, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*variantEntry).value, true
+}
+
+func (c *variantCache) add(key variantKey, v variant) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		e.Value.(*variantEntry).value = v
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.order.PushFront(&variantEntry{key: key, value: v})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*variantEntry).key)
+	}
+}
@@ -0,0 +1,109 @@
+package usecase
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testTilePNG encodes a noisy 256x256 tile, the kind reduced qualities help
+// with the most.
+func testTilePNG(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	seed := uint32(1)
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			seed = seed*1664525 + 1013904223
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(seed >> 24), A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode test tile: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestReduce_LowQualityIsSmallerAndCachedSeparately(t *testing.T) {
+	uc := newTestUseCase(t, TileUseCaseConfig{VariantCacheSize: 10})
+	original := testTilePNG(t)
+
+	low, contentType := uc.Reduce(5, 10, 12, QualityLow, original)
+	if contentType != "image/jpeg" {
+		t.Fatalf("expected image/jpeg, got %s", contentType)
+	}
+	if len(low) >= len(original) {
+		t.Fatalf("low quality tile has %d bytes, original %d", len(low), len(original))
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(low)); err != nil {
+		t.Fatalf("low quality tile is not a jpeg: %v", err)
+	}
+
+	if data, contentType := uc.Reduce(5, 10, 12, QualityOriginal, original); !bytes.Equal(data, original) || contentType != "image/png" {
+		t.Fatal("original quality must serve the tile unchanged")
+	}
+
+	before := testutil.ToFloat64(metrics.TilesVariantCacheHits)
+	again, _ := uc.Reduce(5, 10, 12, QualityLow, original)
+	if !bytes.Equal(again, low) {
+		t.Fatal("expected the cached low quality tile")
+	}
+	if got := testutil.ToFloat64(metrics.TilesVariantCacheHits); got != before+1 {
+		t.Fatalf("expected a variant cache hit, hits went from %v to %v", before, got)
+	}
+
+	medium, _ := uc.Reduce(5, 10, 12, QualityMedium, original)
+	if bytes.Equal(medium, low) {
+		t.Fatal("qualities must be cached under separate keys")
+	}
+}
+
+func TestReduce_UndecodableTileServedAsIs(t *testing.T) {
+	uc := newTestUseCase(t, TileUseCaseConfig{VariantCacheSize: 10})
+
+	data, contentType := uc.Reduce(5, 10, 12, QualityLow, []byte("not an image"))
+	if string(data) != "not an image" || contentType != "image/png" {
+		t.Fatalf("expected the original tile, got %q (%s)", data, contentType)
+	}
+}
+
+func TestParseQuality(t *testing.T) {
+	for input, want := range map[string]Quality{"": QualityOriginal, "original": QualityOriginal, "low": QualityLow, "medium": QualityMedium} {
+		got, err := ParseQuality(input)
+		if err != nil || got != want {
+			t.Fatalf("ParseQuality(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseQuality("best"); err == nil {
+		t.Fatal("expected an error for an unknown quality")
+	}
+}
+
+func TestVariantCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newVariantCache(2)
+	a, b, d := variantKey{x: 1}, variantKey{x: 2}, variantKey{x: 3}
+
+	c.add(a, variant{data: []byte("a")})
+	c.add(b, variant{data: []byte("b")})
+	c.get(a)
+	c.add(d, variant{data: []byte("d")})
+
+	if _, ok := c.get(b); ok {
+		t.Fatal("least recently used entry should be evicted")
+	}
+	if _, ok := c.get(a); !ok {
+		t.Fatal("recently used entry should be kept")
+	}
+	if _, ok := c.get(d); !ok {
+		t.Fatal("new entry should be kept")
+	}
+}
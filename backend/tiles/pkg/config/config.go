@@ -10,16 +10,66 @@ import (
 
 type (
 	Config struct {
-		HTTP      HTTP      `envPrefix:"HTTP_"`
-		Logger    Logger    `envPrefix:"LOGGER_"`
-		Telemetry Telemetry `envPrefix:"TELEMETRY_"`
-		Cache     Cache     `envPrefix:"CACHE_"`
-		Upstream  Upstream  `envPrefix:"UPSTREAM_"`
+		HTTP        HTTP        `envPrefix:"HTTP_"`
+		Logger      Logger      `envPrefix:"LOGGER_"`
+		Telemetry   Telemetry   `envPrefix:"TELEMETRY_"`
+		Cache       Cache       `envPrefix:"CACHE_"`
+		Upstream    Upstream    `envPrefix:"UPSTREAM_"`
+		Auth        Auth        `envPrefix:"AUTH_"`
+		Prefetch    Prefetch    `envPrefix:"PREFETCH_"`
+		Maintenance Maintenance `envPrefix:"MAINTENANCE_"`
+		Shutdown    Shutdown    `envPrefix:"SHUTDOWN_"`
+		Region      Region      `envPrefix:"REGION_"`
 	}
 
 	HTTP struct {
 		Server  Server        `envPrefix:"SERVER_"`
 		Timeout time.Duration `envPrefix:"TIMEOUT" envDefault:"10s"`
+		// BoundsHeaders adds the tile's geographic extent to tile responses
+		BoundsHeaders bool `env:"BOUNDS_HEADERS" envDefault:"false"`
+		// RequireImageAccept answers 406 to tile requests that do not accept images
+		RequireImageAccept bool `env:"REQUIRE_IMAGE_ACCEPT" envDefault:"false"`
+		// ServerTiming adds a Server-Timing header for client-side debugging
+		ServerTiming bool `env:"SERVER_TIMING" envDefault:"false"`
+		// ResponseBudget bounds how long a tile request waits for upstream
+		// before falling back to a stale cached tile
+		ResponseBudget time.Duration `env:"RESPONSE_BUDGET" envDefault:"0"`
+		// RetryBudget is how many retries of failed cache probes and upstream
+		// fetches one tile request may make in total, within RetryDeadline.
+		// The pause before each starts at RetryBackoff and doubles up to
+		// RetryMaxBackoff, randomized with RetryJitter. Zero disables retries.
+		RetryBudget     int           `env:"RETRY_BUDGET" envDefault:"0"`
+		RetryDeadline   time.Duration `env:"RETRY_DEADLINE" envDefault:"0"`
+		RetryBackoff    time.Duration `env:"RETRY_BACKOFF" envDefault:"100ms"`
+		RetryMaxBackoff time.Duration `env:"RETRY_MAX_BACKOFF" envDefault:"2s"`
+		RetryJitter     bool          `env:"RETRY_JITTER" envDefault:"true"`
+		// ClientDisconnectGrace keeps an upstream fetch going this long after
+		// the client disconnects so a tile that still arrives gets cached
+		ClientDisconnectGrace time.Duration `env:"CLIENT_DISCONNECT_GRACE" envDefault:"0"`
+		// QualityCacheSize is how many tiles reduced for the q parameter are
+		// kept in memory
+		QualityCacheSize int `env:"QUALITY_CACHE_SIZE" envDefault:"1024"`
+		// Encoders transcode tiles to webp or avif for clients whose Accept
+		// header lists the format, each a command line placing the {in} and
+		// {out} files, separated by semicolons, e.g.
+		// "webp=cwebp -quiet -q 80 {in} -o {out};avif=avifenc -s 8 {in} {out}".
+		// Transcoded tiles share QualityCacheSize.
+		Encoders map[string]string `env:"ENCODERS" envSeparator:";" envKeyValSeparator:"="`
+		// RedirectMisses answers cache misses with a redirect to the upstream
+		// tile server instead of fetching the tile
+		RedirectMisses bool `env:"REDIRECT_MISSES" envDefault:"false"`
+		// RootFormat is "text", serving RootText at "/", or "json", serving a
+		// service descriptor that includes it. RootText defaults to the
+		// OpenStreetMap attribution.
+		RootFormat string `env:"ROOT_FORMAT" envDefault:"text"`
+		RootText   string `env:"ROOT_TEXT"`
+		// Paths decides what happens to requests whose path only matches a
+		// route without its trailing slash or in another case: "redirect"
+		// to the route, "match" it directly, or "strict" 404
+		Paths string `env:"PATHS" envDefault:"redirect"`
+		// HealthChecks lists the dependencies checked by /healthz, out of
+		// "cache" and "upstream"; "none" checks nothing
+		HealthChecks []string `env:"HEALTH_CHECKS" envDefault:"cache,upstream"`
 	}
 
 	Server struct {
@@ -31,14 +81,191 @@ type (
 
 	Logger struct {
 		Level string `env:"LEVEL,required"`
+		// Encoding is "console" or "json"
+		Encoding string `env:"ENCODING" envDefault:"console"`
+		// Field keys override the encoder defaults to match the log platform,
+		// e.g. LEVEL_KEY=severity for GCP Cloud Logging
+		LevelKey   string `env:"LEVEL_KEY" envDefault:""`
+		MessageKey string `env:"MESSAGE_KEY" envDefault:""`
+		TimeKey    string `env:"TIME_KEY" envDefault:""`
+		CallerKey  string `env:"CALLER_KEY" envDefault:""`
 	}
 
 	Cache struct {
-		BaseURL string `env:"BASE_URL" envDefault:"http://cache:8080"`
+		// GRPCAddr reads and stores tiles over the cache's gRPC API, e.g.
+		// "cache:9090", instead of BaseURL
+		BaseURL      string        `env:"BASE_URL" envDefault:"http://cache:8080"`
+		GRPCAddr     string        `env:"GRPC_ADDR" envDefault:""`
+		MaxServedAge time.Duration `env:"MAX_SERVED_AGE" envDefault:"0"`
+		// APIKey authenticates purges with the cache, one of its
+		// AUTH_API_KEYS
+		APIKey string `env:"API_KEY" envDefault:""`
+		// Failed stores are retried with jittered exponential backoff
+		StoreMaxAttempts    int           `env:"STORE_MAX_ATTEMPTS" envDefault:"3"`
+		StoreRetryBaseDelay time.Duration `env:"STORE_RETRY_BASE_DELAY" envDefault:"200ms"`
+		StoreRetryMaxDelay  time.Duration `env:"STORE_RETRY_MAX_DELAY" envDefault:"5s"`
+		// NotFound records tiles upstream answers 404 for in the cache, which
+		// expires the records after its STORAGE_NOT_FOUND_TTL on any backend
+		NotFound bool `env:"NOT_FOUND" envDefault:"false"`
+		// VerifySampleRate is the fraction of cache hits compared against upstream
+		VerifySampleRate float64 `env:"VERIFY_SAMPLE_RATE" envDefault:"0"`
+		// Cache stores are paused for ParseErrorCooldown once more than
+		// ParseErrorRate of the cache responses within ParseErrorWindow fail
+		// to parse. Zero disables it.
+		ParseErrorRate     float64       `env:"PARSE_ERROR_RATE" envDefault:"0.5"`
+		ParseErrorWindow   time.Duration `env:"PARSE_ERROR_WINDOW" envDefault:"1m"`
+		ParseErrorCooldown time.Duration `env:"PARSE_ERROR_COOLDOWN" envDefault:"5m"`
+		// OptimizePNG strips metadata chunks such as text and timestamps from
+		// upstream tiles before serving and caching them
+		OptimizePNG bool `env:"OPTIMIZE_PNG" envDefault:"false"`
+		// Tiles outside this byte range are served but not cached, zero disables a bound
+		MinTileBytes int `env:"MIN_TILE_BYTES" envDefault:"0"`
+		MaxTileBytes int `env:"MAX_TILE_BYTES" envDefault:"0"`
+		// SecondMissWindow only caches tiles requested twice within it, so
+		// one-off requests do not fill the cache. Zero caches every miss.
+		SecondMissWindow   time.Duration `env:"SECOND_MISS_WINDOW" envDefault:"0"`
+		SecondMissCapacity int           `env:"SECOND_MISS_CAPACITY" envDefault:"10000"`
+		// EarlyRefreshTTL is the cache's tile TTL. Tiles served close to it
+		// are refreshed in the background with a probability rising towards
+		// expiry, over a window scaled by EarlyRefreshDelta and
+		// EarlyRefreshBeta. Zero disables it.
+		EarlyRefreshTTL   time.Duration `env:"EARLY_REFRESH_TTL" envDefault:"0"`
+		EarlyRefreshDelta time.Duration `env:"EARLY_REFRESH_DELTA" envDefault:"1m"`
+		EarlyRefreshBeta  float64       `env:"EARLY_REFRESH_BETA" envDefault:"1"`
+		// Cache probes are skipped for ProbeLatencyCooldown once the 95th
+		// percentile latency of the last ProbeLatencySamples probes exceeds
+		// ProbeLatencyThreshold. Zero disables it.
+		ProbeLatencyThreshold time.Duration `env:"PROBE_LATENCY_THRESHOLD" envDefault:"0"`
+		ProbeLatencySamples   int           `env:"PROBE_LATENCY_SAMPLES" envDefault:"100"`
+		ProbeLatencyCooldown  time.Duration `env:"PROBE_LATENCY_COOLDOWN" envDefault:"30s"`
+		// StoreSource records the upstream URL of each stored tile in the cache
+		StoreSource bool `env:"STORE_SOURCE" envDefault:"false"`
 	}
 
 	Upstream struct {
+		// TileServerURL is a tile URL template with {z}, {x} and {y}, and
+		// optionally {s} for Subdomains and {r} for Retina, e.g.
+		// "https://{s}.tile.example.org/{z}/{x}/{y}{r}.png". A base URL
+		// serves tiles at {z}/{x}/{y}.png under it.
 		TileServerURL string `env:"TILE_SERVER_URL" envDefault:"https://tile.openstreetmap.org"`
+		// Providers are named tile servers for comparisons and weighted fetches,
+		// given like TileServerURL, e.g. "osm=https://tile.openstreetmap.org"
+		Providers map[string]string `env:"PROVIDERS" envSeparator:"," envKeyValSeparator:"="`
+		// Subdomains are used in turn for {s} in tile URL templates, spreading
+		// requests over them
+		Subdomains []string `env:"SUBDOMAINS" envSeparator:"," envDefault:"a,b,c"`
+		// Retina expands {r} in tile URL templates to "@2x", fetching high
+		// resolution tiles where upstream has them
+		Retina bool `env:"RETINA" envDefault:"false"`
+		// Weights spread tile fetches over Providers in proportion, e.g.
+		// "osm=9,paid=1". Empty fetches every tile from TileServerURL.
+		Weights map[string]int `env:"WEIGHTS" envSeparator:"," envKeyValSeparator:"="`
+		// FailoverCooldown is how long a weighted provider is skipped after a failed fetch
+		FailoverCooldown time.Duration `env:"FAILOVER_COOLDOWN" envDefault:"30s"`
+		// Signers sign requests per provider, "default" being TileServerURL,
+		// e.g. "paid=apikey:access_token:<token>" or
+		// "paid=hmac-sha256:signature:<secret>"
+		Signers map[string]string `env:"SIGNERS" envSeparator:"," envKeyValSeparator:"="`
+		// ContentTypes decide per provider, "default" being TileServerURL, what
+		// happens to tiles not served as image/png: passthrough, convert to
+		// PNG or reject, e.g. "paid=convert". Unlisted providers pass through.
+		ContentTypes map[string]string `env:"CONTENT_TYPES" envSeparator:"," envKeyValSeparator:"="`
+		// MaxZoom is the highest zoom each provider serves, "default" being
+		// TileServerURL, and each layer's upstream as "layer:<name>", e.g.
+		// "default=19,paid=22,layer:satellite=18". Tiles above it are never
+		// requested upstream.
+		MaxZoom map[string]int `env:"MAX_ZOOM" envSeparator:"," envKeyValSeparator:"=" envDefault:"default=19"`
+		// Overzoom serves tiles above MaxZoom by upscaling their ancestor at
+		// MaxZoom. Otherwise the image at MaxZoomPlaceholder is served, or 404
+		// without one.
+		Overzoom           bool   `env:"OVERZOOM" envDefault:"false"`
+		MaxZoomPlaceholder string `env:"MAX_ZOOM_PLACEHOLDER"`
+		// MaxFetchesPerTile bounds the fetches of one tile in flight at once.
+		// Further requests for it wait for the first fetch, for up to
+		// SharedFetchWait before fetching on their own. Zero disables it.
+		MaxFetchesPerTile int           `env:"MAX_FETCHES_PER_TILE" envDefault:"1"`
+		SharedFetchWait   time.Duration `env:"SHARED_FETCH_WAIT" envDefault:"2s"`
+		// IgnoreNoStore caches tiles even if upstream sends Cache-Control: no-store
+		IgnoreNoStore bool `env:"IGNORE_NO_STORE" envDefault:"false"`
+		// Protocol is http1, http2 (negotiated, falls back to HTTP/1.1) or
+		// http3 (falls back to http2)
+		Protocol string `env:"PROTOCOL" envDefault:"http2"`
+		// MaxBodyBytes bounds how much of a response is buffered; larger
+		// responses are abandoned. Zero disables the limit.
+		MaxBodyBytes int64 `env:"MAX_BODY_BYTES" envDefault:"16777216"`
+		// Budgets cap upstream requests per UTC day and month, zero disables a cap
+		DailyBudget       int    `env:"DAILY_BUDGET" envDefault:"0"`
+		MonthlyBudget     int    `env:"MONTHLY_BUDGET" envDefault:"0"`
+		DailyBudgetFile   string `env:"DAILY_BUDGET_FILE" envDefault:"upstream_daily_budget.json"`
+		MonthlyBudgetFile string `env:"MONTHLY_BUDGET_FILE" envDefault:"upstream_monthly_budget.json"`
+		// RateLimit caps upstream requests per second with bursts of up to
+		// RateLimitBurst. Requests beyond it queue, at most RateLimitQueue of
+		// them for up to RateLimitTimeout, and are dropped otherwise. Zero
+		// disables the limit.
+		RateLimit        float64       `env:"RATE_LIMIT" envDefault:"0"`
+		RateLimitBurst   int           `env:"RATE_LIMIT_BURST" envDefault:"10"`
+		RateLimitQueue   int           `env:"RATE_LIMIT_QUEUE" envDefault:"100"`
+		RateLimitTimeout time.Duration `env:"RATE_LIMIT_TIMEOUT" envDefault:"5s"`
+		// Layers are named tile styles served at /api/v1/tiles/<layer>/z/x/y,
+		// each from a tile URL template like TileServerURL's, though never a
+		// base URL, separated by semicolons, e.g.
+		// "hot=https://{s}.tile.example.org/hot/{z}/{x}/{y}.png"
+		Layers map[string]string `env:"LAYERS" envSeparator:";" envKeyValSeparator:"=" envDefault:"osm=https://tile.openstreetmap.org/{z}/{x}/{y}.png;cyclosm=https://{s}.tile-cyclosm.openstreetmap.fr/cyclosm/{z}/{x}/{y}.png;humanitarian=https://{s}.tile.openstreetmap.fr/hot/{z}/{x}/{y}.png;satellite=https://server.arcgisonline.com/ArcGIS/rest/services/World_Imagery/MapServer/tile/{z}/{y}/{x}"`
+		// LayerAttributions credit the data and style of each of Layers,
+		// separated by semicolons
+		LayerAttributions map[string]string `env:"LAYER_ATTRIBUTIONS" envSeparator:";" envKeyValSeparator:"=" envDefault:"osm=© OpenStreetMap contributors;cyclosm=© OpenStreetMap contributors, style CyclOSM;humanitarian=© OpenStreetMap contributors, style Humanitarian OpenStreetMap Team;satellite=Imagery © Esri, Maxar, Earthstar Geographics"`
+	}
+
+	Auth struct {
+		// APIKeys grant access to the admin endpoints
+		APIKeys []string `env:"API_KEYS" envSeparator:","`
+		// AnonymousCacheOnly lets only requests with an API key fetch tiles from upstream
+		AnonymousCacheOnly bool `env:"ANONYMOUS_CACHE_ONLY" envDefault:"false"`
+	}
+
+	Prefetch struct {
+		Workers     int           `env:"WORKERS" envDefault:"2"`
+		MinInterval time.Duration `env:"MIN_INTERVAL" envDefault:"1s"`
+		DailyBudget int           `env:"DAILY_BUDGET" envDefault:"10000"`
+		BudgetFile  string        `env:"BUDGET_FILE" envDefault:"prefetch_budget.json"`
+		MaxTiles    int           `env:"MAX_TILES" envDefault:"10000"`
+		// JobTTL is how long finished jobs can still be polled
+		JobTTL time.Duration `env:"JOB_TTL" envDefault:"1h"`
+		// MaxRunningJobs is how many prefetch, warm, seed and purge jobs run
+		// at once, later ones queue. JobStateFile keeps their state across
+		// restarts, empty keeps it in memory only.
+		MaxRunningJobs int    `env:"MAX_RUNNING_JOBS" envDefault:"2"`
+		JobStateFile   string `env:"JOB_STATE_FILE" envDefault:"prefetch_jobs.json"`
+		// Neighbors warms the tiles within NeighborRadius of a cache miss in
+		// the background, at most NeighborMaxPending at a time
+		NeighborsEnabled    bool          `env:"NEIGHBORS_ENABLED" envDefault:"false"`
+		NeighborRadius      int           `env:"NEIGHBOR_RADIUS" envDefault:"1"`
+		NeighborMinInterval time.Duration `env:"NEIGHBOR_MIN_INTERVAL" envDefault:"100ms"`
+		NeighborMaxPending  int           `env:"NEIGHBOR_MAX_PENDING" envDefault:"64"`
+	}
+
+	Maintenance struct {
+		// Enabled serves cached tiles only and never contacts upstream
+		Enabled bool `env:"ENABLED" envDefault:"false"`
+		// Windows are scheduled upstream outages in UTC such as "02:00-04:00"
+		// or "Sun 23:30-01:00", separated by semicolons. Inside them expired
+		// tiles are served without contacting upstream.
+		Windows []string `env:"WINDOWS" envSeparator:";"`
+	}
+
+	// Shutdown bounds how long in-flight requests and background work such
+	// as prefetch jobs and queued cache stores may take to finish
+	Shutdown struct {
+		HTTPDrainTimeout   time.Duration `env:"HTTP_DRAIN_TIMEOUT" envDefault:"30s"`
+		WorkerDrainTimeout time.Duration `env:"WORKER_DRAIN_TIMEOUT" envDefault:"30s"`
+	}
+
+	// Region restricts serving to areas given as "west,south,east,north"
+	// boxes separated by semicolons. Tiles must overlap an allowed box, if
+	// any are set, and no denied box.
+	Region struct {
+		Allowed []string `env:"ALLOWED" envSeparator:";"`
+		Denied  []string `env:"DENIED" envSeparator:";"`
 	}
 
 	Telemetry struct {
@@ -47,9 +274,48 @@ type (
 		ServiceVersion string `env:"SERVICE_VERSION" envDefault:"1.0.0"`
 		Environment    string `env:"ENVIRONMENT" envDefault:"production"`
 		OTLPEndpoint   string `env:"OTLP_ENDPOINT" envDefault:"otel-collector.observability.svc.cluster.local:4317"`
+		// MetricsExporters lists how metrics are exported: "prometheus" serves
+		// them on /metrics, "otlp" pushes them to MetricsEndpoint every
+		// MetricsInterval. Either or both, independently of tracing.
+		MetricsExporters []string      `env:"METRICS_EXPORTERS" envSeparator:"," envDefault:"prometheus"`
+		MetricsEndpoint  string        `env:"METRICS_ENDPOINT"`
+		MetricsInterval  time.Duration `env:"METRICS_INTERVAL" envDefault:"30s"`
 	}
 )
 
+const redacted = "[REDACTED]"
+
+// Redact returns a copy of the config with secrets masked so it can be logged.
+func (c Config) Redact() Config {
+	if len(c.Auth.APIKeys) > 0 {
+		keys := make([]string, len(c.Auth.APIKeys))
+		for i := range keys {
+			keys[i] = redacted
+		}
+		c.Auth.APIKeys = keys
+	}
+	if c.Cache.APIKey != "" {
+		c.Cache.APIKey = redacted
+	}
+	return c
+}
+
+// Reload reads the config again for a running service. Values in the .env
+// file take precedence over the environment here, since the environment of a
+// running process cannot change.
+func Reload() (*Config, error) {
+	if err := godotenv.Overload(); err != nil {
+		log.Printf("NOTICE: .env file not found or cannot be loaded: %v\n", err)
+	}
+
+	cfg, err := env.ParseAs[Config]()
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
 func New() (*Config, error) {
 	err := godotenv.Load()
 	if err != nil {
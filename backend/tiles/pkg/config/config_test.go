@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRedact_MasksAPIKeys(t *testing.T) {
+	cfg := Config{Auth: Auth{APIKeys: []string{"key-one", "key-two"}}}
+
+	logged := fmt.Sprintf("%+v", cfg.Redact())
+	for _, key := range cfg.Auth.APIKeys {
+		if strings.Contains(logged, key) {
+			t.Fatalf("api key %q leaked: %s", key, logged)
+		}
+	}
+	if cfg.Auth.APIKeys[0] != "key-one" {
+		t.Fatal("Redact must not modify the original config")
+	}
+}
+
+func TestRedact_MasksCacheAPIKey(t *testing.T) {
+	cfg := Config{Cache: Cache{APIKey: "cache-key"}}
+
+	if logged := fmt.Sprintf("%+v", cfg.Redact()); strings.Contains(logged, "cache-key") {
+		t.Fatalf("cache api key leaked: %s", logged)
+	}
+}
@@ -3,27 +3,21 @@ package logger
 import (
 	"log"
 
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/config"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 type ZapLogger struct {
 	logger *zap.SugaredLogger
+	level  zap.AtomicLevel
 }
 
 var _ Logger = (*ZapLogger)(nil)
 
-func NewZapLogger(levelStr string) *ZapLogger {
-	developmentConfig := zap.NewDevelopmentConfig()
-
-	developmentConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
-	developmentConfig.EncoderConfig.EncodeCaller = zapcore.ShortCallerEncoder
-	developmentConfig.EncoderConfig.CallerKey = "caller"
-	developmentConfig.DisableCaller = false
-	level := toZapLevel(levelStr)
-	developmentConfig.Level = zap.NewAtomicLevelAt(level)
-
-	logger, err := developmentConfig.Build(
+func NewZapLogger(cfg config.Logger) *ZapLogger {
+	zc := zapConfig(cfg)
+	logger, err := zc.Build(
 		zap.AddCaller(),
 		zap.AddCallerSkip(1),
 	)
@@ -35,6 +29,39 @@ func NewZapLogger(levelStr string) *ZapLogger {
 
 	return &ZapLogger{
 		logger: sugared,
+		level:  zc.Level,
+	}
+}
+
+// zapConfig builds the zap configuration, applying any field keys set in cfg
+// on top of the development encoder defaults.
+func zapConfig(cfg config.Logger) zap.Config {
+	developmentConfig := zap.NewDevelopmentConfig()
+
+	developmentConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	developmentConfig.EncoderConfig.EncodeCaller = zapcore.ShortCallerEncoder
+	developmentConfig.EncoderConfig.CallerKey = "caller"
+	developmentConfig.DisableCaller = false
+	level := toZapLevel(cfg.Level)
+	developmentConfig.Level = zap.NewAtomicLevelAt(level)
+
+	if cfg.Encoding == "json" {
+		developmentConfig.Encoding = "json"
+		// Color codes would end up inside the JSON strings
+		developmentConfig.EncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	}
+
+	setKey(&developmentConfig.EncoderConfig.LevelKey, cfg.LevelKey)
+	setKey(&developmentConfig.EncoderConfig.MessageKey, cfg.MessageKey)
+	setKey(&developmentConfig.EncoderConfig.TimeKey, cfg.TimeKey)
+	setKey(&developmentConfig.EncoderConfig.CallerKey, cfg.CallerKey)
+
+	return developmentConfig
+}
+
+func setKey(key *string, override string) {
+	if override != "" {
+		*key = override
 	}
 }
 
@@ -49,6 +76,15 @@ func toZapLevel(levelStr string) zapcore.Level {
 	return level
 }
 
+// SetLevel changes the minimum level of entries logged from now on.
+func (l *ZapLogger) SetLevel(levelStr string) {
+	l.level.SetLevel(toZapLevel(levelStr))
+}
+
+func (l *ZapLogger) Level() zapcore.Level {
+	return l.level.Level()
+}
+
 func (l *ZapLogger) Debug(msg string, keysAndValues ...any) {
 	l.logger.Debugw(msg, keysAndValues...)
 }
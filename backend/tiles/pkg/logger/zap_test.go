@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/config"
+)
+
+func TestZapConfig_CustomFieldKeys(t *testing.T) {
+	cfg := zapConfig(config.Logger{
+		Level:      "INFO",
+		Encoding:   "json",
+		LevelKey:   "severity",
+		MessageKey: "message",
+		TimeKey:    "timestamp",
+		CallerKey:  "source",
+	})
+	out := filepath.Join(t.TempDir(), "log.json")
+	cfg.OutputPaths = []string{out}
+
+	zl, err := cfg.Build()
+	if err != nil {
+		t.Fatalf("failed to build logger: %v", err)
+	}
+	zl.Info("hello")
+	zl.Sync()
+
+	raw, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("failed to read log output: %v", err)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		t.Fatalf("log line is not JSON: %v\n%s", err, raw)
+	}
+
+	if entry["severity"] != "INFO" || entry["message"] != "hello" {
+		t.Fatalf("expected custom level and message keys, got %v", entry)
+	}
+	for _, key := range []string{"timestamp", "source"} {
+		if _, ok := entry[key]; !ok {
+			t.Errorf("expected %s key, got %v", key, entry)
+		}
+	}
+	for _, key := range []string{"L", "M", "T", "caller"} {
+		if _, ok := entry[key]; ok {
+			t.Errorf("default key %s should have been replaced, got %v", key, entry)
+		}
+	}
+}
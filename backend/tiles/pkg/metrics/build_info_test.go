@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBuildInfo_Registered(t *testing.T) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	for _, mf := range families {
+		if mf.GetName() != "build_info" {
+			continue
+		}
+		if len(mf.GetMetric()) != 1 {
+			t.Fatalf("expected one build_info series, got %d", len(mf.GetMetric()))
+		}
+		m := mf.GetMetric()[0]
+		if m.GetGauge().GetValue() != 1 {
+			t.Fatalf("build_info = %v, want 1", m.GetGauge().GetValue())
+		}
+
+		labels := make(map[string]string)
+		for _, lp := range m.GetLabel() {
+			labels[lp.GetName()] = lp.GetValue()
+		}
+		want := map[string]string{
+			"version":   Version,
+			"commit":    Commit,
+			"goversion": runtime.Version(),
+		}
+		if len(labels) != len(want) {
+			t.Fatalf("labels = %v, want %v", labels, want)
+		}
+		for k, v := range want {
+			if labels[k] != v {
+				t.Fatalf("label %s = %q, want %q", k, labels[k], v)
+			}
+		}
+		return
+	}
+	t.Fatal("build_info metric not registered")
+}
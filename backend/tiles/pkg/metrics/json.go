@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// snapshotPrefix selects the service's own metrics for JSON snapshots,
+// leaving out Go runtime and process metrics.
+const snapshotPrefix = "tiles_"
+
+// Snapshot flattens the service's metrics into name to value pairs. Labelled
+// series are keyed like `name{label="value"}`. Histograms contribute
+// name_count, name_sum and name_avg.
+func Snapshot(g prometheus.Gatherer) (map[string]float64, error) {
+	families, err := g.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]float64)
+	for _, mf := range families {
+		if !strings.HasPrefix(mf.GetName(), snapshotPrefix) {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			name := seriesName(mf.GetName(), m.GetLabel())
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				out[name] = m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				out[name] = m.GetGauge().GetValue()
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				out[name+"_count"] = float64(h.GetSampleCount())
+				out[name+"_sum"] = h.GetSampleSum()
+				if h.GetSampleCount() > 0 {
+					out[name+"_avg"] = h.GetSampleSum() / float64(h.GetSampleCount())
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+func seriesName(name string, labels []*dto.LabelPair) string {
+	if len(labels) == 0 {
+		return name
+	}
+	pairs := make([]string, 0, len(labels))
+	for _, lp := range labels {
+		pairs = append(pairs, lp.GetName()+`="`+lp.GetValue()+`"`)
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// JSONHandler serves Snapshot for monitoring setups that poll JSON instead
+// of scraping Prometheus.
+func JSONHandler(g prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		snapshot, err := Snapshot(g)
+		if err != nil {
+			http.Error(w, `{"error":"failed to gather metrics"}`, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshot)
+	})
+}
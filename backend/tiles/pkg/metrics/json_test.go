@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+func TestJSONHandler(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	factory := promauto.With(reg)
+	hits := factory.NewCounter(prometheus.CounterOpts{Name: "tiles_cache_hits_total"})
+	exhausted := factory.NewGauge(prometheus.GaugeOpts{Name: "tiles_upstream_budget_exhausted"})
+	latency := factory.NewHistogram(prometheus.HistogramOpts{Name: "tiles_upstream_latency_seconds"})
+	byStatus := factory.NewCounterVec(prometheus.CounterOpts{Name: "tiles_responses_total"}, []string{"status"})
+	factory.NewCounter(prometheus.CounterOpts{Name: "go_unrelated_total"}).Inc()
+
+	hits.Add(3)
+	exhausted.Set(1)
+	latency.Observe(0.2)
+	latency.Observe(0.4)
+	byStatus.WithLabelValues("200").Inc()
+
+	w := httptest.NewRecorder()
+	JSONHandler(reg).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/metrics.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	var got map[string]float64
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("response is not a flat JSON object of numbers: %v\n%s", err, w.Body.String())
+	}
+
+	want := map[string]float64{
+		"tiles_cache_hits_total":               3,
+		"tiles_upstream_budget_exhausted":      1,
+		"tiles_upstream_latency_seconds_count": 2,
+		`tiles_responses_total{status="200"}`:  1,
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("%s = %v, want %v", name, got[name], value)
+		}
+	}
+	if avg := got["tiles_upstream_latency_seconds_avg"]; avg < 0.29 || avg > 0.31 {
+		t.Errorf("latency average = %v, want 0.3", avg)
+	}
+	if _, ok := got["go_unrelated_total"]; ok {
+		t.Error("metrics of other subsystems must be left out")
+	}
+}
@@ -21,6 +21,36 @@ var (
 		Help: "Total number of cache misses in tiles service",
 	})
 
+	TilesCacheTooOld = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tiles_cache_too_old_total",
+		Help: "Total number of cached tiles refused for exceeding the max served age",
+	})
+
+	TilesResponseBudgetExceeded = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tiles_response_budget_exceeded_total",
+		Help: "Total number of tile requests that gave up waiting for upstream",
+	})
+
+	TilesEarlyRefresh = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tiles_early_refresh_total",
+		Help: "Total number of cached tiles refreshed before they expired, by result",
+	}, []string{"result"})
+
+	TilesSharedFetch = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tiles_shared_fetch_total",
+		Help: "Total number of tile fetches by how they were shared: leader, own, shared or timeout",
+	}, []string{"result"})
+
+	TilesRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tiles_retries_total",
+		Help: "Total number of cache probe and upstream fetch retries, by phase",
+	}, []string{"phase"})
+
+	TilesRetryBudgetExhausted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tiles_retry_budget_exhausted_total",
+		Help: "Total number of retries refused because the request's retry budget was used up, by phase",
+	}, []string{"phase"})
+
 	TilesUpstreamRequests = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "tiles_upstream_requests_total",
 		Help: "Total number of upstream (OSM) requests",
@@ -31,4 +61,130 @@ var (
 		Help:    "Latency of upstream tile fetches in seconds",
 		Buckets: prometheus.DefBuckets,
 	})
+
+	TilesUpstreamTTFB = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tiles_upstream_ttfb_seconds",
+		Help:    "Time from sending an upstream request to the first response byte in seconds",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	TilesCacheMismatch = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tiles_cache_mismatch_total",
+		Help: "Total number of sampled cache hits whose bytes differ from upstream",
+	})
+
+	TilesCacheStoreRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tiles_cache_store_retries_total",
+		Help: "Total number of retried tile stores to the cache service",
+	})
+
+	TilesCacheStoreDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tiles_cache_store_dropped_total",
+		Help: "Total number of tiles dropped after exhausting cache store retries",
+	})
+
+	TilesRetryAfter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tiles_retry_after_total",
+		Help: "Total number of retries that waited as long as the Retry-After header asked, by phase",
+	}, []string{"phase"})
+
+	TilesUpstreamThrottled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tiles_upstream_throttled_total",
+		Help: "Total number of upstream requests held by the rate limiter: delayed or dropped",
+	}, []string{"result"})
+
+	TilesUpstreamNoStore = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tiles_upstream_no_store_total",
+		Help: "Total number of upstream tiles not cached because of Cache-Control: no-store",
+	})
+
+	TilesMaintenanceWindowStale = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tiles_maintenance_window_stale_total",
+		Help: "Total number of expired tiles served during upstream maintenance windows",
+	})
+
+	TilesVariantCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tiles_variant_cache_hits_total",
+		Help: "Total number of reduced quality tiles served without re-encoding",
+	})
+
+	TilesTranscoded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tiles_transcoded_total",
+		Help: "Total number of tiles transcoded by format and result: encoded, larger or failed",
+	}, []string{"format", "result"})
+
+	TilesPNGBytesSaved = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tiles_png_bytes_saved_total",
+		Help: "Total number of bytes removed from upstream tiles by PNG optimization",
+	})
+
+	TilesSizeRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tiles_size_rejected_total",
+		Help: "Total number of upstream tiles not cached because of their size, by reason (too_small, too_large)",
+	}, []string{"reason"})
+
+	TilesUpstreamBodyTooLarge = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tiles_upstream_body_too_large_total",
+		Help: "Total number of upstream responses abandoned for exceeding the buffer limit",
+	})
+
+	TilesBeyondMaxZoom = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tiles_beyond_max_zoom_total",
+		Help: "Total number of tiles requested above the providers' max zoom, by how they were served",
+	}, []string{"result"})
+
+	TilesUnexpectedContentType = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tiles_unexpected_content_type_total",
+		Help: "Total number of upstream tiles served with a content type other than image/png, by provider and handling mode",
+	}, []string{"provider", "mode"})
+
+	TilesUpstreamProviderRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tiles_upstream_provider_requests_total",
+		Help: "Total number of tile fetches sent to each weighted upstream provider",
+	}, []string{"provider"})
+
+	TilesUpstreamProviderFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tiles_upstream_provider_failures_total",
+		Help: "Total number of failed fetches from each weighted upstream provider that triggered a failover",
+	}, []string{"provider"})
+
+	TilesNeighborPrefetch = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tiles_neighbor_prefetch_total",
+		Help: "Total number of neighbor tiles warmed after a cache miss, by result (fetched, cached, failed, dropped)",
+	}, []string{"result"})
+
+	TilesFirstMissNotStored = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tiles_first_miss_not_stored_total",
+		Help: "Total number of upstream tiles not cached because they missed the cache for the first time",
+	})
+
+	TilesCacheParseErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tiles_cache_parse_errors_total",
+		Help: "Total number of cache service responses that could not be parsed",
+	})
+
+	TilesCacheStoreCircuitOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "tiles_cache_store_circuit_open",
+		Help: "1 while cache stores are paused because cache responses fail to parse",
+	})
+
+	TilesCacheProbeBypassed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tiles_cache_probe_bypassed_total",
+		Help: "Cache probes skipped because recent probes were too slow",
+	})
+
+	TilesUpstreamBudgetExhausted = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "tiles_upstream_budget_exhausted",
+		Help: "1 while upstream requests are refused because the daily or monthly budget is used up",
+	})
+
+	TilesPrefetched = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tiles_prefetched_total",
+		Help: "Total number of tiles fetched from upstream by prefetch jobs",
+	})
+
+	TilesPrefetchBudgetExhausted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tiles_prefetch_budget_exhausted_total",
+		Help: "Total number of prefetch jobs paused because the daily upstream budget ran out",
+	})
 )
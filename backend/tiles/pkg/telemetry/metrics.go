@@ -0,0 +1,63 @@
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	otelprom "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// MetricsProducer exposes the metrics registered with g to OpenTelemetry
+// readers, so metrics are defined once in pkg/metrics and exported through
+// Prometheus, OTLP or both.
+func MetricsProducer(g prometheus.Gatherer) sdkmetric.Producer {
+	return otelprom.NewMetricProducer(otelprom.WithGatherer(g))
+}
+
+// InitMetrics pushes the service's Prometheus metrics to the OTLP endpoint
+// every interval.
+func InitMetrics(cfg Config, interval time.Duration, l logger.Logger) (func(context.Context) error, error) {
+	ctx := context.Background()
+
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.NewClient(
+		cfg.OTLPEndpoint,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithGRPCConn(conn))
+	if err != nil {
+		return nil, err
+	}
+
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(interval),
+		sdkmetric.WithProducer(MetricsProducer(prometheus.DefaultGatherer)),
+	)
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(res),
+	)
+
+	l.Info("otlp metrics export initialized", "service", cfg.ServiceName, "endpoint", cfg.OTLPEndpoint, "interval", interval)
+
+	// Shutting down flushes the metrics collected since the last export
+	return func(ctx context.Context) error {
+		shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		return mp.Shutdown(shutdownCtx)
+	}, nil
+}
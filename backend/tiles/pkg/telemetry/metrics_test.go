@@ -0,0 +1,41 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jaennil/guide_helper/backend/tiles/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestMetricsProducer_ExportsTileRequests(t *testing.T) {
+	reader := sdkmetric.NewManualReader(sdkmetric.WithProducer(MetricsProducer(prometheus.DefaultGatherer)))
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer mp.Shutdown(context.Background())
+
+	metrics.TilesRequests.Inc()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "tiles_requests_total" {
+				continue
+			}
+			sum, ok := m.Data.(metricdata.Sum[float64])
+			if !ok {
+				t.Fatalf("expected a float sum, got %T", m.Data)
+			}
+			if !sum.IsMonotonic || len(sum.DataPoints) != 1 || sum.DataPoints[0].Value < 1 {
+				t.Fatalf("expected the counted request, got %+v", sum)
+			}
+			return
+		}
+	}
+	t.Fatal("tiles_requests_total was not exported")
+}
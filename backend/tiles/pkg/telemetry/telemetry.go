@@ -22,17 +22,21 @@ type Config struct {
 	OTLPEndpoint   string
 }
 
-func InitTracer(cfg Config, l logger.Logger) (func(context.Context) error, error) {
-	ctx := context.Background()
-
-	// Create resource with service information
-	res, err := resource.New(ctx,
+// newResource describes the service to the collector.
+func newResource(ctx context.Context, cfg Config) (*resource.Resource, error) {
+	return resource.New(ctx,
 		resource.WithAttributes(
 			semconv.ServiceNameKey.String(cfg.ServiceName),
 			semconv.ServiceVersionKey.String(cfg.ServiceVersion),
 			semconv.DeploymentEnvironmentKey.String(cfg.Environment),
 		),
 	)
+}
+
+func InitTracer(cfg Config, l logger.Logger) (func(context.Context) error, error) {
+	ctx := context.Background()
+
+	res, err := newResource(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
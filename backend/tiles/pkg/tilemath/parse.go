@@ -0,0 +1,42 @@
+package tilemath
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+var coordPattern = regexp.MustCompile(`(\d+)/(\d+)/(\d+)`)
+
+// ParseTileList extracts one z/x/y coordinate per line, so both plain
+// coordinate lists and access log lines such as
+// "GET /api/v1/tile/12/2048/1361 HTTP/1.1" are accepted. Lines without a
+// valid coordinate are skipped and duplicates are dropped.
+func ParseTileList(r io.Reader) ([]Tile, error) {
+	seen := make(map[Tile]bool)
+	var tiles []Tile
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m := coordPattern.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+
+		z, errZ := strconv.Atoi(m[1])
+		x, errX := strconv.Atoi(m[2])
+		y, errY := strconv.Atoi(m[3])
+		if errZ != nil || errX != nil || errY != nil || !Valid(z, x, y) {
+			continue
+		}
+
+		t := Tile{Z: z, X: x, Y: y}
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		tiles = append(tiles, t)
+	}
+	return tiles, scanner.Err()
+}
@@ -0,0 +1,189 @@
+// Package tilemath converts between WGS84 coordinates and slippy map tiles.
+package tilemath
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const MaxZoom = 30
+
+var ErrInvalidBBox = errors.New("invalid bounding box")
+
+type Tile struct {
+	Z int `json:"z"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type Bounds struct {
+	North float64 `json:"north"`
+	South float64 `json:"south"`
+	East  float64 `json:"east"`
+	West  float64 `json:"west"`
+}
+
+// BBox is a geographic rectangle in degrees.
+type BBox struct {
+	West  float64 `json:"west"`
+	South float64 `json:"south"`
+	East  float64 `json:"east"`
+	North float64 `json:"north"`
+}
+
+// ParseBBox parses "west,south,east,north" in degrees.
+func ParseBBox(s string) (BBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return BBox{}, ErrInvalidBBox
+	}
+
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return BBox{}, ErrInvalidBBox
+		}
+		v[i] = f
+	}
+
+	b := BBox{West: v[0], South: v[1], East: v[2], North: v[3]}
+	return b, b.Validate()
+}
+
+// ParseBBoxes parses each value with ParseBBox, naming the first invalid one.
+func ParseBBoxes(values []string) ([]BBox, error) {
+	boxes := make([]BBox, 0, len(values))
+	for _, value := range values {
+		b, err := ParseBBox(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", err, value)
+		}
+		boxes = append(boxes, b)
+	}
+	return boxes, nil
+}
+
+func (b BBox) Validate() error {
+	if b.West < -180 || b.East > 180 || b.South < -90 || b.North > 90 {
+		return ErrInvalidBBox
+	}
+	if b.West >= b.East || b.South >= b.North {
+		return ErrInvalidBBox
+	}
+	return nil
+}
+
+// Intersects reports whether the two boxes overlap.
+func (b BBox) Intersects(o BBox) bool {
+	return b.West < o.East && o.West < b.East && b.South < o.North && o.South < b.North
+}
+
+// Contains reports whether the point lies inside the box.
+func (b BBox) Contains(lat, lon float64) bool {
+	return lon >= b.West && lon <= b.East && lat >= b.South && lat <= b.North
+}
+
+// LatLonToTile returns the tile containing the point at zoom z.
+func LatLonToTile(lat, lon float64, z int) Tile {
+	n := math.Exp2(float64(z))
+	x := int(math.Floor((lon + 180) / 360 * n))
+
+	latRad := lat * math.Pi / 180
+	y := int(math.Floor((1 - math.Log(math.Tan(latRad)+1/math.Cos(latRad))/math.Pi) / 2 * n))
+
+	maxIndex := int(n) - 1
+	return Tile{Z: z, X: clamp(x, 0, maxIndex), Y: clamp(y, 0, maxIndex)}
+}
+
+// TileToLatLonBounds returns the geographic extent of a tile.
+func TileToLatLonBounds(z, x, y int) Bounds {
+	n := math.Exp2(float64(z))
+	return Bounds{
+		North: tileYToLat(float64(y), n),
+		South: tileYToLat(float64(y+1), n),
+		West:  float64(x)/n*360 - 180,
+		East:  float64(x+1)/n*360 - 180,
+	}
+}
+
+// Center returns the midpoint of the bounds.
+func (b Bounds) Center() (lat, lon float64) {
+	return (b.North + b.South) / 2, (b.East + b.West) / 2
+}
+
+func (b Bounds) BBox() BBox {
+	return BBox{West: b.West, South: b.South, East: b.East, North: b.North}
+}
+
+// Valid reports whether the coordinates address an existing tile.
+func Valid(z, x, y int) bool {
+	if z < 0 || z > MaxZoom || x < 0 || y < 0 {
+		return false
+	}
+	n := 1 << z
+	return x < n && y < n
+}
+
+// CountInBBox returns how many tiles cover the box across the zoom range.
+func CountInBBox(b BBox, minZoom, maxZoom int) int {
+	count := 0
+	for z := minZoom; z <= maxZoom; z++ {
+		nw := LatLonToTile(b.North, b.West, z)
+		se := LatLonToTile(b.South, b.East, z)
+		count += (se.X - nw.X + 1) * (se.Y - nw.Y + 1)
+	}
+	return count
+}
+
+// TilesInBBox calls fn for every tile covering the box across the zoom
+// range, stopping early when fn returns false.
+func TilesInBBox(b BBox, minZoom, maxZoom int, fn func(Tile) bool) {
+	for z := minZoom; z <= maxZoom; z++ {
+		nw := LatLonToTile(b.North, b.West, z)
+		se := LatLonToTile(b.South, b.East, z)
+		for x := nw.X; x <= se.X; x++ {
+			for y := nw.Y; y <= se.Y; y++ {
+				if !fn(Tile{Z: z, X: x, Y: y}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Neighbors returns the tiles within radius of a tile at the same zoom,
+// excluding the tile itself. x wraps around the antimeridian, rows beyond
+// the poles are left out.
+func Neighbors(z, x, y, radius int) []Tile {
+	n := 1 << z
+	var tiles []Tile
+	seen := make(map[Tile]bool)
+	for dy := -radius; dy <= radius; dy++ {
+		ny := y + dy
+		if ny < 0 || ny >= n {
+			continue
+		}
+		for dx := -radius; dx <= radius; dx++ {
+			t := Tile{Z: z, X: ((x+dx)%n + n) % n, Y: ny}
+			// Low zooms are narrower than the radius and wrap onto themselves
+			if (t.X == x && t.Y == y) || seen[t] {
+				continue
+			}
+			seen[t] = true
+			tiles = append(tiles, t)
+		}
+	}
+	return tiles
+}
+
+func tileYToLat(y, n float64) float64 {
+	return math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180 / math.Pi
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
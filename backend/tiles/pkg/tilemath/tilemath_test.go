@@ -0,0 +1,109 @@
+package tilemath
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLatLonToTile(t *testing.T) {
+	// Moscow, zoom 10
+	tile := LatLonToTile(55.7558, 37.6173, 10)
+	if tile != (Tile{Z: 10, X: 619, Y: 320}) {
+		t.Fatalf("unexpected tile %+v", tile)
+	}
+}
+
+func TestTileToLatLonBounds_RoundTrip(t *testing.T) {
+	b := TileToLatLonBounds(10, 619, 320)
+	lat, lon := b.Center()
+	if got := LatLonToTile(lat, lon, 10); got != (Tile{Z: 10, X: 619, Y: 320}) {
+		t.Fatalf("center of tile maps to %+v", got)
+	}
+
+	world := TileToLatLonBounds(0, 0, 0)
+	if world.West != -180 || world.East != 180 || math.Abs(world.North-85.0511) > 1e-3 {
+		t.Fatalf("unexpected world bounds %+v", world)
+	}
+}
+
+func TestTilesInBBox(t *testing.T) {
+	b := BBox{West: 37.5, South: 55.7, East: 37.7, North: 55.8}
+
+	var tiles []Tile
+	TilesInBBox(b, 0, 12, func(tile Tile) bool {
+		tiles = append(tiles, tile)
+		return true
+	})
+
+	if len(tiles) != CountInBBox(b, 0, 12) {
+		t.Fatalf("iterated %d tiles, count says %d", len(tiles), CountInBBox(b, 0, 12))
+	}
+	for _, tile := range tiles {
+		if !TileToLatLonBounds(tile.Z, tile.X, tile.Y).BBox().Intersects(b) {
+			t.Fatalf("tile %+v does not intersect bbox", tile)
+		}
+	}
+}
+
+func TestParseTileList(t *testing.T) {
+	input := `12/2048/1361
+10.0.0.1 - - "GET /api/v1/tile/10/619/320 HTTP/1.1" 200 1234
+not a tile
+12/2048/1361
+3/99/0
+`
+	tiles, err := ParseTileList(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	want := []Tile{{Z: 12, X: 2048, Y: 1361}, {Z: 10, X: 619, Y: 320}}
+	if len(tiles) != len(want) {
+		t.Fatalf("got %+v, want %+v", tiles, want)
+	}
+	for i := range want {
+		if tiles[i] != want[i] {
+			t.Fatalf("got %+v, want %+v", tiles, want)
+		}
+	}
+}
+
+func TestParseBBoxes(t *testing.T) {
+	boxes, err := ParseBBoxes([]string{"37.3,55.5,37.9,55.9", " -10, -10, 10, 10 "})
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	want := []BBox{
+		{West: 37.3, South: 55.5, East: 37.9, North: 55.9},
+		{West: -10, South: -10, East: 10, North: 10},
+	}
+	if len(boxes) != len(want) || boxes[0] != want[0] || boxes[1] != want[1] {
+		t.Fatalf("got %+v, want %+v", boxes, want)
+	}
+
+	for _, invalid := range []string{"1,2,3", "10,0,0,10", "a,b,c,d", "0,0,190,10"} {
+		if _, err := ParseBBoxes([]string{invalid}); !errors.Is(err, ErrInvalidBBox) {
+			t.Fatalf("expected ErrInvalidBBox for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	if got := Neighbors(5, 10, 12, 1); len(got) != 8 {
+		t.Fatalf("expected 8 neighbors, got %v", got)
+	}
+
+	// West of x=0 wraps to the last column, north of y=0 is left out
+	got := Neighbors(2, 0, 0, 1)
+	want := []Tile{{Z: 2, X: 3, Y: 0}, {Z: 2, X: 1, Y: 0}, {Z: 2, X: 3, Y: 1}, {Z: 2, X: 0, Y: 1}, {Z: 2, X: 1, Y: 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Neighbors(2, 0, 0, 1) = %v, want %v", got, want)
+	}
+
+	if got := Neighbors(0, 0, 0, 1); len(got) != 0 {
+		t.Fatalf("expected no neighbors at zoom 0, got %v", got)
+	}
+}